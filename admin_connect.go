@@ -0,0 +1,175 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// AdminServiceName is the fully qualified name of the admin service in
+// proto/persistence/admin/v1/admin.proto.
+const AdminServiceName = "persistence.admin.v1.AdminService"
+
+// connectHealthResponse and the types below are the protojson forms of
+// the admin.proto messages: camelCase names and int64 as strings.
+type connectHealthResponse struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latencyMs,string"`
+	Error     string `json:"error,omitempty"`
+}
+
+type connectMigration struct {
+	Name       string     `json:"name"`
+	Comment    string     `json:"comment,omitempty"`
+	GroupID    int64      `json:"groupId,string"`
+	Applied    bool       `json:"applied"`
+	MigratedAt *time.Time `json:"migratedAt,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Checksum   string     `json:"checksum,omitempty"`
+	OutOfOrder bool       `json:"outOfOrder,omitempty"`
+}
+
+type connectMigrationStatusResponse struct {
+	Migrations []connectMigration `json:"migrations"`
+}
+
+type connectSeedRequest struct {
+	Patterns []string `json:"patterns"`
+}
+
+type connectOperationResponse struct {
+	Operation  string    `json:"operation"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMS int64     `json:"durationMs,string"`
+	Items      []string  `json:"items"`
+	Skipped    []string  `json:"skipped,omitempty"`
+}
+
+// connectError is a Connect protocol error body.
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *connectError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var connectErrorStatus = map[string]int{
+	"invalid_argument":  http.StatusBadRequest,
+	"unauthenticated":   http.StatusUnauthorized,
+	"deadline_exceeded": http.StatusGatewayTimeout,
+	"canceled":          499,
+	"internal":          http.StatusInternalServerError,
+}
+
+// NewAdminConnectHandler serves the AdminService of admin.proto over the
+// Connect protocol, unary calls with JSON payloads, so platform tooling
+// can drive every service through the same RPC without generated code
+// in this module. It returns the path to mount the handler on, like
+// connect-go generated constructors:
+//
+//	mux.Handle(persistence.NewAdminConnectHandler(client, persistence.WithAdminBearerToken(token)))
+//
+// Like NewAdminHandler it requires WithAdminAuth or WithAdminBearerToken,
+// without either every call fails as unauthenticated.
+//
+// gRPC and binary protobuf clients need a server generated from
+// admin.proto that calls the client methods.
+func NewAdminConnectHandler(client *Client, opts ...AdminOption) (string, http.Handler) {
+	s := newAdminService(client, opts)
+	prefix := "/" + AdminServiceName + "/"
+
+	mux := http.NewServeMux()
+	s.connectMethod(mux, prefix+"Health", func(ctx context.Context, _ []byte) (any, error) {
+		h := s.health(ctx)
+		return connectHealthResponse{Status: h.Status, LatencyMS: h.LatencyMS, Error: h.Error}, nil
+	})
+	s.connectMethod(mux, prefix+"MigrationStatus", func(ctx context.Context, _ []byte) (any, error) {
+		status, err := s.status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res := connectMigrationStatusResponse{Migrations: make([]connectMigration, 0, len(status))}
+		for _, m := range status {
+			res.Migrations = append(res.Migrations, connectMigration(m))
+		}
+		return res, nil
+	})
+	s.connectMethod(mux, prefix+"Migrate", func(ctx context.Context, _ []byte) (any, error) {
+		return connectOperation(s.migrate(ctx))
+	})
+	s.connectMethod(mux, prefix+"Rollback", func(ctx context.Context, _ []byte) (any, error) {
+		return connectOperation(s.rollback(ctx))
+	})
+	s.connectMethod(mux, prefix+"Seed", func(ctx context.Context, body []byte) (any, error) {
+		var req connectSeedRequest
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				return nil, &connectError{Code: "invalid_argument", Message: err.Error()}
+			}
+		}
+		return connectOperation(s.seed(ctx, req.Patterns))
+	})
+
+	return prefix, mux
+}
+
+func connectOperation(o *AdminOutcome, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	return connectOperationResponse{
+		Operation:  o.Operation,
+		StartedAt:  o.StartedAt,
+		DurationMS: o.DurationMS,
+		Items:      o.Items,
+		Skipped:    o.Skipped,
+	}, nil
+}
+
+func (s *adminService) connectMethod(mux *http.ServeMux, path string, fn func(ctx context.Context, body []byte) (any, error)) {
+	mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if !s.authorized(r) {
+			writeConnectError(w, &connectError{Code: "unauthenticated", Message: "unauthorized"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			writeConnectError(w, &connectError{Code: "invalid_argument", Message: err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.timeout)
+		defer cancel()
+		res, err := fn(ctx, body)
+		if err != nil {
+			writeConnectError(w, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, res)
+	})
+}
+
+func writeConnectError(w http.ResponseWriter, err error) {
+	var cerr *connectError
+	switch {
+	case errors.As(err, &cerr):
+	case errors.Is(err, context.DeadlineExceeded):
+		cerr = &connectError{Code: "deadline_exceeded", Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		cerr = &connectError{Code: "canceled", Message: err.Error()}
+	default:
+		cerr = &connectError{Code: "internal", Message: err.Error()}
+	}
+	writeAdminJSON(w, connectErrorStatus[cerr.Code], cerr)
+}
@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminConnectHandler(t *testing.T) {
+	path, handler := NewAdminConnectHandler(newAdminTestClient(t), WithAdminBearerToken("secret"))
+	assert.Equal(t, "/persistence.admin.v1.AdminService/", path)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(method, body, token string) (int, map[string]any) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path+method, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	status, out := call("Health", "{}", "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", out["status"])
+	assert.IsType(t, "", out["latencyMs"])
+
+	status, out = call("Migrate", "", "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, OperationMigrate, out["operation"])
+	assert.Equal(t, []any{"20240101000000"}, out["items"])
+
+	status, out = call("MigrationStatus", "{}", "secret")
+	assert.Equal(t, http.StatusOK, status)
+	migrations := out["migrations"].([]any)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, true, migrations[0].(map[string]any)["applied"])
+
+	status, out = call("Seed", `{"patterns": ["*.yml"]}`, "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, OperationSeed, out["operation"])
+
+	status, out = call("Seed", `{"patterns": 1}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_argument", out["code"])
+
+	status, out = call("Rollback", "{}", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "unauthenticated", out["code"])
+
+	status, _ = call("Unknown", "{}", "secret")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestAdminConnectHandlerRejectsWithoutAuthOption(t *testing.T) {
+	path, handler := NewAdminConnectHandler(newAdminTestClient(t))
+
+	for _, method := range []string{"Health", "MigrationStatus", "Migrate", "Rollback", "Seed"} {
+		req := httptest.NewRequest(http.MethodPost, path+method, bytes.NewBufferString("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer anything")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, method)
+		assert.Contains(t, rec.Body.String(), "unauthenticated")
+	}
+}
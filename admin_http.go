@@ -0,0 +1,268 @@
+package persistence
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminOption configures the admin handler.
+type AdminOption func(*adminOptions)
+
+type adminOptions struct {
+	authorize func(r *http.Request) bool
+	timeout   time.Duration
+}
+
+// WithAdminAuth sets the check every admin request must pass, requests
+// it rejects get 401. An auth option is required, the handler rejects
+// every request without one.
+func WithAdminAuth(fn func(r *http.Request) bool) AdminOption {
+	return func(o *adminOptions) {
+		o.authorize = fn
+	}
+}
+
+// WithAdminBearerToken authorizes requests carrying
+// "Authorization: Bearer <token>".
+func WithAdminBearerToken(token string) AdminOption {
+	return WithAdminAuth(func(r *http.Request) bool {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+	})
+}
+
+// WithAdminTimeout bounds each admin operation, 5 minutes by default.
+func WithAdminTimeout(d time.Duration) AdminOption {
+	return func(o *adminOptions) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// AdminOutcome is the JSON form of an OperationOutcome.
+type AdminOutcome struct {
+	Operation  string    `json:"operation"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Items      []string  `json:"items"`
+	Skipped    []string  `json:"skipped,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Code       string    `json:"code,omitempty"`
+}
+
+func newAdminOutcome(o *OperationOutcome) *AdminOutcome {
+	if o == nil {
+		return nil
+	}
+	out := &AdminOutcome{
+		Operation:  o.Operation,
+		StartedAt:  o.StartedAt,
+		DurationMS: o.Duration.Milliseconds(),
+		Items:      o.Items,
+		Skipped:    o.Skipped,
+	}
+	if o.Err != nil {
+		out.Error = o.Err.Error()
+		out.Code = ErrorCode(o.Err)
+	}
+	return out
+}
+
+// AdminMigration is the JSON form of a MigrationStatus.
+type AdminMigration struct {
+	Name       string     `json:"name"`
+	Comment    string     `json:"comment,omitempty"`
+	GroupID    int64      `json:"group_id"`
+	Applied    bool       `json:"applied"`
+	MigratedAt *time.Time `json:"migrated_at,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Checksum   string     `json:"checksum,omitempty"`
+	OutOfOrder bool       `json:"out_of_order,omitempty"`
+}
+
+func newAdminMigrations(status []MigrationStatus) []AdminMigration {
+	out := make([]AdminMigration, 0, len(status))
+	for _, s := range status {
+		m := AdminMigration{
+			Name:       s.Name,
+			Comment:    s.Comment,
+			GroupID:    s.GroupID,
+			Applied:    s.Applied,
+			Source:     s.Source,
+			Checksum:   s.Checksum,
+			OutOfOrder: s.OutOfOrder,
+		}
+		if s.Applied {
+			migratedAt := s.MigratedAt
+			m.MigratedAt = &migratedAt
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// AdminHealth is the response of the health endpoint.
+type AdminHealth struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// adminService runs the admin operations shared by the HTTP and RPC
+// transports. Migrate, rollback and seed are serialized across every
+// handler of the client.
+type adminService struct {
+	client *Client
+	opts   adminOptions
+	mu     *sync.Mutex
+}
+
+func newAdminService(client *Client, opts []AdminOption) *adminService {
+	mu := client.adminMu
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	s := &adminService{client: client, opts: adminOptions{timeout: 5 * time.Minute}, mu: mu}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&s.opts)
+		}
+	}
+	return s
+}
+
+// authorized reports whether r passes the configured auth check,
+// requests are rejected when none is configured.
+func (s *adminService) authorized(r *http.Request) bool {
+	return s.opts.authorize != nil && s.opts.authorize(r)
+}
+
+func (s *adminService) health(ctx context.Context) AdminHealth {
+	start := time.Now()
+	err := s.client.Ping(ctx)
+	h := AdminHealth{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		h.Status, h.Error = "unavailable", err.Error()
+	}
+	return h
+}
+
+func (s *adminService) status(ctx context.Context) ([]AdminMigration, error) {
+	status, err := s.client.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newAdminMigrations(status), nil
+}
+
+func (s *adminService) migrate(ctx context.Context) (*AdminOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.client.Migrate(ctx)
+	return s.outcome(s.client.LastReport().Migrate, OperationMigrate, err), err
+}
+
+func (s *adminService) rollback(ctx context.Context) (*AdminOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.client.Rollback(ctx)
+	return s.outcome(s.client.LastReport().Rollback, OperationRollback, err), err
+}
+
+func (s *adminService) seed(ctx context.Context, patterns []string) (*AdminOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if len(patterns) > 0 {
+		err = s.client.SeedOnly(ctx, patterns...)
+	} else {
+		err = s.client.Seed(ctx)
+	}
+	return s.outcome(s.client.LastReport().Seed, OperationSeed, err), err
+}
+
+// outcome falls back to a bare outcome for errors raised before the
+// operation recorded one, e.g. when migrations are not configured.
+func (s *adminService) outcome(o *OperationOutcome, operation string, err error) *AdminOutcome {
+	if o == nil {
+		o = &OperationOutcome{Operation: operation, StartedAt: time.Now(), Err: err}
+	}
+	return newAdminOutcome(o)
+}
+
+// NewAdminHandler returns an http.Handler exposing maintenance endpoints
+// for client, to mount under an admin router with http.StripPrefix:
+//
+//	GET  /health               ping the database
+//	GET  /migrations           migration status
+//	POST /migrations/migrate   apply pending migrations
+//	POST /migrations/rollback  roll back the last migration group
+//	POST /seed                 load fixtures, optionally ?pattern=users/*.yml
+//
+// Responses are JSON. Failed operations answer 500 with their outcome.
+// Requests must pass WithAdminAuth or WithAdminBearerToken, without
+// either option every request answers 401.
+func NewAdminHandler(client *Client, opts ...AdminOption) http.Handler {
+	s := newAdminService(client, opts)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		h := s.health(r.Context())
+		status := http.StatusOK
+		if h.Error != "" {
+			status = http.StatusServiceUnavailable
+		}
+		writeAdminJSON(w, status, h)
+	})
+	mux.HandleFunc("GET /migrations", func(w http.ResponseWriter, r *http.Request) {
+		status, err := s.status(r.Context())
+		if err != nil {
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error(), "code": ErrorCode(err)})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, status)
+	})
+	mux.HandleFunc("POST /migrations/migrate", s.handleOperation(func(ctx context.Context, _ *http.Request) (*AdminOutcome, error) {
+		return s.migrate(ctx)
+	}))
+	mux.HandleFunc("POST /migrations/rollback", s.handleOperation(func(ctx context.Context, _ *http.Request) (*AdminOutcome, error) {
+		return s.rollback(ctx)
+	}))
+	mux.HandleFunc("POST /seed", s.handleOperation(func(ctx context.Context, r *http.Request) (*AdminOutcome, error) {
+		return s.seed(ctx, r.URL.Query()["pattern"])
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *adminService) handleOperation(fn func(ctx context.Context, r *http.Request) (*AdminOutcome, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.timeout)
+		defer cancel()
+
+		outcome, err := fn(ctx, r)
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusInternalServerError
+		}
+		writeAdminJSON(w, status, outcome)
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,133 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func newAdminTestClient(t *testing.T) *Client {
+	t.Helper()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), "admin.db"))
+	require.NoError(t, err)
+
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, sqlitedialect.New(), WithLazyConnect())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	client.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_items.up.sql":   {Data: []byte("CREATE TABLE admin_items (id INTEGER PRIMARY KEY, name TEXT)")},
+		"20240101000000_items.down.sql": {Data: []byte("DROP TABLE admin_items")},
+	})
+	return client
+}
+
+func TestAdminHandler(t *testing.T) {
+	client := newAdminTestClient(t)
+	srv := httptest.NewServer(http.StripPrefix("/admin/db", NewAdminHandler(client, WithAdminBearerToken("secret"))))
+	defer srv.Close()
+
+	do := func(method, path string, v any) int {
+		req, err := http.NewRequest(method, srv.URL+"/admin/db"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if v != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+		}
+		return res.StatusCode
+	}
+
+	var health AdminHealth
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/health", &health))
+	assert.Equal(t, "ok", health.Status)
+
+	var status []AdminMigration
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/migrations", &status))
+	require.Len(t, status, 1)
+	assert.False(t, status[0].Applied)
+
+	var outcome AdminOutcome
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/migrations/migrate", &outcome))
+	assert.Equal(t, OperationMigrate, outcome.Operation)
+	assert.Equal(t, []string{"20240101000000"}, outcome.Items)
+
+	status = nil
+	do(http.MethodGet, "/migrations", &status)
+	assert.True(t, status[0].Applied)
+	assert.NotNil(t, status[0].MigratedAt)
+
+	outcome = AdminOutcome{}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/migrations/rollback", &outcome))
+	assert.Equal(t, OperationRollback, outcome.Operation)
+	assert.Equal(t, []string{"20240101000000"}, outcome.Items)
+
+	outcome = AdminOutcome{}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/seed?pattern=*.yml", &outcome))
+	assert.Equal(t, OperationSeed, outcome.Operation)
+	assert.Empty(t, outcome.Error)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/seed", nil))
+}
+
+func TestAdminHandlerRejectsUnauthorized(t *testing.T) {
+	handler := NewAdminHandler(newAdminTestClient(t), WithAdminBearerToken("secret"))
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/migrations/migrate", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestAdminHandlerRejectsWithoutAuthOption(t *testing.T) {
+	handler := NewAdminHandler(newAdminTestClient(t))
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/health"},
+		{http.MethodGet, "/migrations"},
+		{http.MethodPost, "/migrations/migrate"},
+		{http.MethodPost, "/migrations/rollback"},
+		{http.MethodPost, "/seed"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer anything")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, route.path)
+	}
+}
+
+func TestAdminHandlersShareLock(t *testing.T) {
+	client := newAdminTestClient(t)
+	httpService := newAdminService(client, nil)
+	rpcService := newAdminService(client, nil)
+	require.Same(t, httpService.mu, rpcService.mu)
+
+	// a migration running through one transport blocks the other
+	httpService.mu.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := rpcService.migrate(t.Context())
+		done <- err
+	}()
+	assert.Never(t, func() bool { return len(done) > 0 }, 30*time.Millisecond, 5*time.Millisecond)
+	httpService.mu.Unlock()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+)
+
+// ArchiveFS opens a .zip or .tar.gz archive as a read only fs.FS so a
+// schema bundle delivered as a single artifact can be used as a migration
+// or fixture source. The format is detected from the content: gzip data is
+// read as a tarball, anything else as a zip file.
+func ArchiveFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	magic := make([]byte, 2)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to read archive header")
+	}
+
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		return tarGzFS(io.NewSectionReader(r, 0, size))
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to open zip archive")
+	}
+	return zr, nil
+}
+
+// tarGzFS reads every regular file of a gzip compressed tarball in memory.
+func tarGzFS(r io.Reader) (fs.FS, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to open gzip archive")
+	}
+	defer gz.Close()
+
+	out := fstest.MapFS{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to read tar archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if !fs.ValidPath(name) {
+			return nil, apierrors.New("invalid path in tar archive", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"path": hdr.Name})
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to read tar entry").
+				WithMetadata(map[string]any{"path": hdr.Name})
+		}
+		out[name] = &fstest.MapFile{Data: data, Mode: fs.FileMode(hdr.Mode).Perm(), ModTime: hdr.ModTime}
+	}
+}
+
+// RegisterSQLMigrationsFromArchive adds the SQL migrations contained in a
+// .zip or .tar.gz archive, see ArchiveFS.
+func (m *Migrations) RegisterSQLMigrationsFromArchive(r io.ReaderAt, size int64) error {
+	fsys, err := ArchiveFS(r, size)
+	if err != nil {
+		return err
+	}
+	m.RegisterSQLMigrations(fsys)
+	return nil
+}
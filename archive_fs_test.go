@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var archiveTestFiles = map[string]string{
+	"migrations/20240101000000_archive.up.sql":   "CREATE TABLE archive_items (id INTEGER PRIMARY KEY)",
+	"migrations/20240101000000_archive.down.sql": "DROP TABLE IF EXISTS archive_items",
+}
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestArchiveFS(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"zip":    buildZip(t, archiveTestFiles),
+		"tar.gz": buildTarGz(t, archiveTestFiles),
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys, err := ArchiveFS(bytes.NewReader(data), int64(len(data)))
+			require.NoError(t, err)
+
+			body, err := fs.ReadFile(fsys, "migrations/20240101000000_archive.up.sql")
+			require.NoError(t, err)
+			assert.Equal(t, archiveTestFiles["migrations/20240101000000_archive.up.sql"], string(body))
+		})
+	}
+}
+
+func TestArchiveFS_InvalidArchive(t *testing.T) {
+	data := []byte("not an archive")
+	_, err := ArchiveFS(bytes.NewReader(data), int64(len(data)))
+	assert.Error(t, err)
+
+	data = []byte{0x1f, 0x8b, 0x00}
+	_, err = ArchiveFS(bytes.NewReader(data), int64(len(data)))
+	assert.Error(t, err)
+}
+
+func TestMigrations_RegisterSQLMigrationsFromArchive(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	data := buildTarGz(t, archiveTestFiles)
+	migrations := NewMigrations()
+	require.NoError(t, migrations.RegisterSQLMigrationsFromArchive(bytes.NewReader(data), int64(len(data))))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var tables []string
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE name = 'archive_items'").Scan(ctx, &tables))
+	assert.Equal(t, []string{"archive_items"}, tables)
+}
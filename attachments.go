@@ -0,0 +1,410 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultAttachmentInlineLimit = 64 << 10
+	defaultAttachmentOrphanGrace = time.Hour
+	maxAttachmentOutboxBackoff   = time.Hour
+
+	// AttachmentStorageDB marks attachments whose bytes are in blob_chunks.
+	AttachmentStorageDB = "db"
+	// AttachmentStorageBackend marks attachments whose bytes are in the
+	// BlobBackend.
+	AttachmentStorageBackend = "backend"
+)
+
+// ErrAttachmentNotFound indicates an attachment that does not exist.
+var ErrAttachmentNotFound = errors.New("persistence: attachment not found")
+
+// BlobBackend stores attachment bytes outside the database, e.g. on a
+// file system or in an S3 bucket through PutObject, GetObject and
+// DeleteObject. Deleting a missing key must not be an error.
+type BlobBackend interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Attachment is the metadata of a stored file, in the attachments table.
+type Attachment struct {
+	bun.BaseModel `bun:"table:attachments"`
+
+	ID          string    `bun:"id,pk"`
+	OwnerType   string    `bun:"owner_type"`
+	OwnerID     string    `bun:"owner_id"`
+	Name        string    `bun:"name,notnull"`
+	ContentType string    `bun:"content_type"`
+	Size        int64     `bun:"size,notnull"`
+	SHA256      string    `bun:"sha256,notnull"`
+	Storage     string    `bun:"storage,notnull"`
+	StorageKey  string    `bun:"storage_key,notnull"`
+	CreatedAt   time.Time `bun:"created_at,notnull"`
+}
+
+// AttachmentOutbox is a pending deletion of backend bytes, in the
+// attachment_outbox table.
+type AttachmentOutbox struct {
+	bun.BaseModel `bun:"table:attachment_outbox"`
+
+	ID          int64     `bun:"id,pk,autoincrement"`
+	StorageKey  string    `bun:"storage_key,notnull"`
+	AvailableAt time.Time `bun:"available_at,notnull"`
+	Attempts    int       `bun:"attempts,notnull"`
+	LastError   string    `bun:"last_error"`
+	CreatedAt   time.Time `bun:"created_at,notnull"`
+}
+
+// AttachmentsMigrationFS returns up and down migrations for the
+// attachments, attachment_outbox and blob_chunks tables, named
+// <version>_attachments, rendered for the dialect of db.
+func AttachmentsMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	fsys := modelTableMigrationFS(db, version, "attachments", (*BlobChunk)(nil), (*Attachment)(nil), (*AttachmentOutbox)(nil))
+	up := fsys[version+"_attachments.up.sql"]
+	up.Data = append(up.Data, "CREATE INDEX attachments_owner_idx ON attachments (owner_type, owner_id);\n"...)
+	up.Data = append(up.Data, "CREATE INDEX attachment_outbox_available_at_idx ON attachment_outbox (available_at);\n"...)
+	return fsys
+}
+
+// AttachmentsOption configures Attachments
+type AttachmentsOption func(*Attachments)
+
+// WithAttachmentBackend stores attachments larger than the inline limit
+// in backend. Without a backend all bytes are stored in the database.
+func WithAttachmentBackend(backend BlobBackend) AttachmentsOption {
+	return func(a *Attachments) {
+		a.backend = backend
+	}
+}
+
+// WithAttachmentInlineLimit sets the largest attachment stored in the
+// database when a backend is set, 64KiB by default.
+func WithAttachmentInlineLimit(n int) AttachmentsOption {
+	return func(a *Attachments) {
+		if n >= 0 {
+			a.inlineLimit = n
+		}
+	}
+}
+
+// WithAttachmentOrphanGrace sets how long backend bytes of an attachment
+// whose metadata was never committed are kept before ProcessOutbox
+// deletes them, one hour by default. It must exceed the longest
+// transaction creating attachments.
+func WithAttachmentOrphanGrace(grace time.Duration) AttachmentsOption {
+	return func(a *Attachments) {
+		if grace > 0 {
+			a.orphanGrace = grace
+		}
+	}
+}
+
+// Attachments stores files as metadata rows plus bytes, small files in
+// blob_chunks and larger ones in a BlobBackend.
+//
+// Metadata and database bytes are written in the transaction in ctx, if
+// any. Backend bytes cannot join it, so an outbox keeps both sides
+// consistent: before an upload a cleanup entry is committed, and the
+// transaction inserting the metadata removes it. When that transaction
+// rolls back the entry survives and ProcessOutbox deletes the orphaned
+// bytes after the grace period. Delete queues the backend deletion in
+// the same transaction as the metadata deletion.
+type Attachments struct {
+	db          bun.IDB
+	backend     BlobBackend
+	inlineLimit int
+	orphanGrace time.Duration
+	now         func() time.Time
+}
+
+// NewAttachments creates an attachment store on db.
+func NewAttachments(db bun.IDB, opts ...AttachmentsOption) *Attachments {
+	a := &Attachments{
+		db:          db,
+		inlineLimit: defaultAttachmentInlineLimit,
+		orphanGrace: defaultAttachmentOrphanGrace,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(a)
+		}
+	}
+	return a
+}
+
+// Create stores the content of r and inserts att, setting its ID when
+// empty, Size, SHA256, Storage, StorageKey and CreatedAt.
+func (a *Attachments) Create(ctx context.Context, att *Attachment, r io.Reader) error {
+	if att.ID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryInternal, "failed to generate attachment id")
+		}
+		att.ID = id
+	}
+	att.StorageKey = "attachments/" + att.ID
+	att.CreatedAt = a.now().UTC()
+
+	hash := sha256.New()
+	r = io.TeeReader(r, hash)
+	if a.backend == nil {
+		att.Storage = AttachmentStorageDB
+		return a.createInline(ctx, att, r, hash)
+	}
+
+	head := make([]byte, a.inlineLimit+1)
+	n, err := io.ReadFull(r, head)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		att.Storage = AttachmentStorageDB
+		return a.createInline(ctx, att, bytes.NewReader(head[:n]), hash)
+	case err != nil:
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read attachment content")
+	}
+
+	att.Storage = AttachmentStorageBackend
+	cleanup := &AttachmentOutbox{StorageKey: att.StorageKey, AvailableAt: att.CreatedAt.Add(a.orphanGrace), CreatedAt: att.CreatedAt}
+	// committed on its own, so it outlives a rolled back transaction
+	if _, err := a.db.NewInsert().Model(cleanup).Exec(ctx); err != nil {
+		return EnrichError(err, OperationInfo{Operation: "insert", Table: "attachment_outbox"})
+	}
+	size, err := a.backend.Put(ctx, att.StorageKey, io.MultiReader(bytes.NewReader(head[:n]), r))
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryExternal, "failed to store attachment content").
+			WithMetadata(map[string]any{"attachment_id": att.ID})
+	}
+	att.Size = size
+	att.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return RunInTx(ctx, IDBFromContext(ctx, a.db), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(att).Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "insert", Table: "attachments"})
+		}
+		if _, err := tx.NewDelete().Model(cleanup).WherePK().Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "delete", Table: "attachment_outbox"})
+		}
+		return nil
+	})
+}
+
+func (a *Attachments) createInline(ctx context.Context, att *Attachment, r io.Reader, digest hash.Hash) error {
+	return RunInTx(ctx, IDBFromContext(ctx, a.db), func(ctx context.Context, tx bun.Tx) error {
+		size, err := NewBlobStore(tx).Write(ctx, att.StorageKey, r)
+		if err != nil {
+			return err
+		}
+		att.Size = size
+		att.SHA256 = hex.EncodeToString(digest.Sum(nil))
+		if _, err := tx.NewInsert().Model(att).Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "insert", Table: "attachments"})
+		}
+		return nil
+	})
+}
+
+// Get returns the attachment with id, or an error wrapping
+// ErrAttachmentNotFound.
+func (a *Attachments) Get(ctx context.Context, id string) (*Attachment, error) {
+	att := new(Attachment)
+	err := IDBFromContext(ctx, a.db).NewSelect().Model(att).Where("id = ?", id).Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, apierrors.Wrap(ErrAttachmentNotFound, apierrors.CategoryNotFound, "attachment not found").
+			WithMetadata(map[string]any{"attachment_id": id})
+	case err != nil:
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load attachment")
+	}
+	return att, nil
+}
+
+// List returns the attachments of an owner, oldest first.
+func (a *Attachments) List(ctx context.Context, ownerType, ownerID string) ([]Attachment, error) {
+	var atts []Attachment
+	err := IDBFromContext(ctx, a.db).NewSelect().Model(&atts).
+		Where("owner_type = ?", ownerType).
+		Where("owner_id = ?", ownerID).
+		Order("created_at", "id").
+		Scan(ctx)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to list attachments")
+	}
+	return atts, nil
+}
+
+// Open returns the attachment with id and a reader of its bytes.
+func (a *Attachments) Open(ctx context.Context, id string) (*Attachment, io.ReadCloser, error) {
+	att, err := a.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if att.Storage == AttachmentStorageDB {
+		r, err := NewBlobStore(IDBFromContext(ctx, a.db)).Open(ctx, att.StorageKey)
+		return att, r, err
+	}
+	if a.backend == nil {
+		return nil, nil, apierrors.New("attachment is stored in a backend but none is configured", apierrors.CategoryInternal).
+			WithMetadata(map[string]any{"attachment_id": id})
+	}
+	r, err := a.backend.Open(ctx, att.StorageKey)
+	if err != nil {
+		return nil, nil, apierrors.Wrap(err, apierrors.CategoryExternal, "failed to open attachment content").
+			WithMetadata(map[string]any{"attachment_id": id})
+	}
+	return att, r, nil
+}
+
+// Delete removes the attachment with id. Database bytes are deleted in
+// the transaction, backend bytes are queued for ProcessOutbox.
+func (a *Attachments) Delete(ctx context.Context, id string) error {
+	return RunInTx(ctx, IDBFromContext(ctx, a.db), func(ctx context.Context, tx bun.Tx) error {
+		att, err := a.Get(ContextWithTx(ctx, tx), id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model(att).WherePK().Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "delete", Table: "attachments"})
+		}
+		if att.Storage == AttachmentStorageDB {
+			return NewBlobStore(tx).Delete(ctx, att.StorageKey)
+		}
+		now := a.now().UTC()
+		entry := &AttachmentOutbox{StorageKey: att.StorageKey, AvailableAt: now, CreatedAt: now}
+		if _, err := tx.NewInsert().Model(entry).Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "insert", Table: "attachment_outbox"})
+		}
+		return nil
+	})
+}
+
+// ProcessOutbox deletes the backend bytes of up to limit due outbox
+// entries and returns how many were deleted. Failed deletions are
+// retried with exponential backoff. Run it periodically, e.g. from a
+// job.
+func (a *Attachments) ProcessOutbox(ctx context.Context, limit int) (int, error) {
+	if a.backend == nil {
+		return 0, nil
+	}
+	var entries []AttachmentOutbox
+	err := a.db.NewSelect().Model(&entries).
+		Where("available_at <= ?", a.now().UTC()).
+		Order("id").
+		Limit(limit).
+		Scan(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load attachment outbox")
+	}
+
+	deleted := 0
+	for i := range entries {
+		entry := &entries[i]
+		if err := a.backend.Delete(ctx, entry.StorageKey); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.AvailableAt = a.now().UTC().Add(attachmentOutboxBackoff(entry.Attempts))
+			_, err = a.db.NewUpdate().Model(entry).Column("attempts", "last_error", "available_at").WherePK().Exec(ctx)
+			if err != nil {
+				return deleted, EnrichError(err, OperationInfo{Operation: "update", Table: "attachment_outbox"})
+			}
+			continue
+		}
+		if _, err := a.db.NewDelete().Model(entry).WherePK().Exec(ctx); err != nil {
+			return deleted, EnrichError(err, OperationInfo{Operation: "delete", Table: "attachment_outbox"})
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func attachmentOutboxBackoff(attempts int) time.Duration {
+	backoff := time.Second << min(attempts, 12)
+	return min(backoff, maxAttachmentOutboxBackoff)
+}
+
+// FSBlobBackend stores attachment bytes as files under a directory.
+type FSBlobBackend struct {
+	root string
+}
+
+// NewFSBlobBackend creates a backend storing files under root.
+func NewFSBlobBackend(root string) *FSBlobBackend {
+	return &FSBlobBackend{root: root}
+}
+
+func (b *FSBlobBackend) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", apierrors.New("invalid blob key", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"key": key})
+	}
+	return filepath.Join(b.root, filepath.FromSlash(key)), nil
+}
+
+// Put implements BlobBackend. The file is written to a temporary name
+// and renamed, so readers never see partial content.
+func (b *FSBlobBackend) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// Open implements BlobBackend.
+func (b *FSBlobBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, apierrors.Wrap(ErrBlobNotFound, apierrors.CategoryNotFound, "blob not found").
+			WithMetadata(map[string]any{"key": key})
+	}
+	return f, err
+}
+
+// Delete implements BlobBackend.
+func (b *FSBlobBackend) Delete(ctx context.Context, key string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func newAttachmentsTestDB(t *testing.T) *bun.DB {
+	t.Helper()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), "attachments.db")+"?_pragma=busy_timeout(5000)")
+	require.NoError(t, err)
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, model := range []any{(*BlobChunk)(nil), (*Attachment)(nil), (*AttachmentOutbox)(nil)} {
+		_, err := db.NewCreateTable().Model(model).Exec(context.Background())
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func readAttachment(t *testing.T, store *Attachments, id string) string {
+	t.Helper()
+	_, r, err := store.Open(context.Background(), id)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestAttachments_InlineAndBackend(t *testing.T) {
+	ctx := context.Background()
+	db := newAttachmentsTestDB(t)
+	dir := t.TempDir()
+	store := NewAttachments(db, WithAttachmentBackend(NewFSBlobBackend(dir)), WithAttachmentInlineLimit(8))
+
+	small := &Attachment{OwnerType: "invoice", OwnerID: "1", Name: "note.txt"}
+	require.NoError(t, store.Create(ctx, small, strings.NewReader("tiny")))
+	assert.Equal(t, AttachmentStorageDB, small.Storage)
+	assert.EqualValues(t, 4, small.Size)
+	sum := sha256.Sum256([]byte("tiny"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), small.SHA256)
+
+	large := &Attachment{OwnerType: "invoice", OwnerID: "1", Name: "scan.pdf"}
+	require.NoError(t, store.Create(ctx, large, strings.NewReader("larger than eight bytes")))
+	assert.Equal(t, AttachmentStorageBackend, large.Storage)
+	assert.EqualValues(t, 23, large.Size)
+	assert.FileExists(t, filepath.Join(dir, "attachments", large.ID))
+
+	outbox, err := db.NewSelect().Model((*AttachmentOutbox)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, outbox, "committed creates leave no cleanup entry")
+
+	assert.Equal(t, "tiny", readAttachment(t, store, small.ID))
+	assert.Equal(t, "larger than eight bytes", readAttachment(t, store, large.ID))
+
+	list, err := store.List(ctx, "invoice", "1")
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	require.NoError(t, store.Delete(ctx, small.ID))
+	require.NoError(t, store.Delete(ctx, large.ID))
+	_, err = store.Get(ctx, large.ID)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+	assert.FileExists(t, filepath.Join(dir, "attachments", large.ID), "deleted after commit by the outbox")
+
+	n, err := store.ProcessOutbox(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, filepath.Join(dir, "attachments", large.ID))
+	chunks, err := db.NewSelect().Model((*BlobChunk)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, chunks)
+}
+
+func TestAttachments_RollbackLeavesOrphanForOutbox(t *testing.T) {
+	ctx := context.Background()
+	db := newAttachmentsTestDB(t)
+	dir := t.TempDir()
+	now := time.Now()
+	store := NewAttachments(db, WithAttachmentBackend(NewFSBlobBackend(dir)), WithAttachmentInlineLimit(0))
+	store.now = func() time.Time { return now }
+
+	att := &Attachment{Name: "upload.bin"}
+	errRollback := errors.New("rollback")
+	err := RunInTx(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+		require.NoError(t, store.Create(ContextWithTx(ctx, tx), att, strings.NewReader("orphan")))
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	_, err = store.Get(ctx, att.ID)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+	path := filepath.Join(dir, "attachments", att.ID)
+	assert.FileExists(t, path)
+
+	n, err := store.ProcessOutbox(ctx, 10)
+	require.NoError(t, err)
+	assert.Zero(t, n, "kept during the grace period")
+
+	now = now.Add(2 * time.Hour)
+	n, err = store.ProcessOutbox(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFSBlobBackend_RejectsEscapingKeys(t *testing.T) {
+	backend := NewFSBlobBackend(t.TempDir())
+	_, err := backend.Put(context.Background(), "../escape", strings.NewReader("x"))
+	assert.Error(t, err)
+	assert.NoError(t, backend.Delete(context.Background(), "missing"))
+	_, err = backend.Open(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
@@ -0,0 +1,325 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	// AuthCredentialPassword is the credential kind of password hashes.
+	AuthCredentialPassword = "password"
+)
+
+var (
+	// ErrAuthUserNotFound indicates a user that does not exist.
+	ErrAuthUserNotFound = errors.New("persistence: auth user not found")
+	// ErrInvalidCredentials indicates an unknown user or a wrong password.
+	// Both cases share the error so callers do not leak which one failed.
+	ErrInvalidCredentials = errors.New("persistence: invalid credentials")
+	// ErrInvalidResetToken indicates a password reset token that does not
+	// exist, expired or was already used.
+	ErrInvalidResetToken = errors.New("persistence: invalid password reset token")
+)
+
+// AuthUser is an account stored in the auth_users table. Emails are
+// stored lower case.
+type AuthUser struct {
+	bun.BaseModel `bun:"table:auth_users"`
+
+	ID        string         `bun:"id,pk"`
+	Email     string         `bun:"email,notnull,unique"`
+	Username  string         `bun:"username"`
+	Role      string         `bun:"role"`
+	Status    string         `bun:"status"`
+	Metadata  map[string]any `bun:"metadata,type:jsonb"`
+	CreatedAt time.Time      `bun:"created_at,notnull"`
+	UpdatedAt time.Time      `bun:"updated_at,notnull"`
+}
+
+// AuthCredential is a secret of a user, such as a password hash, stored
+// in the auth_credentials table. A user has one credential per kind.
+type AuthCredential struct {
+	bun.BaseModel `bun:"table:auth_credentials"`
+
+	UserID    string    `bun:"user_id,pk"`
+	Kind      string    `bun:"kind,pk"`
+	Secret    string    `bun:"secret,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+}
+
+// AuthPasswordReset is a password reset token stored in the
+// auth_password_resets table. Only the SHA-256 of the token is stored.
+type AuthPasswordReset struct {
+	bun.BaseModel `bun:"table:auth_password_resets"`
+
+	TokenHash string       `bun:"token_hash,pk"`
+	UserID    string       `bun:"user_id,notnull"`
+	ExpiresAt time.Time    `bun:"expires_at,notnull"`
+	UsedAt    bun.NullTime `bun:"used_at"`
+	CreatedAt time.Time    `bun:"created_at,notnull"`
+}
+
+// AuthMigrationFS returns up and down migrations for the auth_users,
+// auth_credentials and auth_password_resets tables, named
+// <version>_auth, rendered for the dialect of db.
+func AuthMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	fsys := modelTableMigrationFS(db, version, "auth", (*AuthUser)(nil), (*AuthCredential)(nil), (*AuthPasswordReset)(nil))
+	up := fsys[version+"_auth.up.sql"]
+	up.Data = append(up.Data, "CREATE INDEX auth_password_resets_user_id_idx ON auth_password_resets (user_id);\n"...)
+	return fsys
+}
+
+// AuthStoreOption configures an AuthStore
+type AuthStoreOption func(*AuthStore)
+
+// WithPasswordResetTTL sets how long reset tokens are valid, one hour
+// by default.
+func WithPasswordResetTTL(ttl time.Duration) AuthStoreOption {
+	return func(s *AuthStore) {
+		if ttl > 0 {
+			s.resetTTL = ttl
+		}
+	}
+}
+
+// WithBcryptCost sets the bcrypt cost of password hashes.
+func WithBcryptCost(cost int) AuthStoreOption {
+	return func(s *AuthStore) {
+		if cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+			s.cost = cost
+		}
+	}
+}
+
+// AuthStore keeps users, password credentials and password reset tokens,
+// backing the user and credential repositories of go-auth.
+type AuthStore struct {
+	db       bun.IDB
+	resetTTL time.Duration
+	cost     int
+	now      func() time.Time
+	// dummyHash is compared when a user or its password is missing, so
+	// VerifyPassword takes as long as for a wrong password and its
+	// timing does not reveal which emails are registered.
+	dummyHash []byte
+}
+
+// NewAuthStore creates a store backed by db. The tables must exist, see
+// AuthMigrationFS.
+func NewAuthStore(db bun.IDB, opts ...AuthStoreOption) *AuthStore {
+	s := &AuthStore{db: db, resetTTL: defaultPasswordResetTTL, cost: bcrypt.DefaultCost, now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("persistence: dummy password"), s.cost)
+	return s
+}
+
+// CreateUser inserts user, generating its ID when empty.
+func (s *AuthStore) CreateUser(ctx context.Context, user *AuthUser) error {
+	if user.ID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryInternal, "failed to generate user id")
+		}
+		user.ID = id
+	}
+	now := s.now().UTC()
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+	user.CreatedAt, user.UpdatedAt = now, now
+	if _, err := IDBFromContext(ctx, s.db).NewInsert().Model(user).Exec(ctx); err != nil {
+		return EnrichError(err, OperationInfo{Operation: "create_user", Table: "auth_users"})
+	}
+	return nil
+}
+
+// UpdateUser saves user by ID.
+func (s *AuthStore) UpdateUser(ctx context.Context, user *AuthUser) error {
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+	user.UpdatedAt = s.now().UTC()
+	res, err := IDBFromContext(ctx, s.db).NewUpdate().Model(user).ExcludeColumn("created_at").WherePK().Exec(ctx)
+	if err != nil {
+		return EnrichError(err, OperationInfo{Operation: "update_user", Table: "auth_users"})
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return apierrors.Wrap(ErrAuthUserNotFound, apierrors.CategoryNotFound, "user not found")
+	}
+	return nil
+}
+
+// GetUserByID returns the user with id, or an error wrapping
+// ErrAuthUserNotFound.
+func (s *AuthStore) GetUserByID(ctx context.Context, id string) (*AuthUser, error) {
+	return s.getUser(ctx, "id = ?", id)
+}
+
+// GetUserByEmail returns the user with email, compared case
+// insensitively, or an error wrapping ErrAuthUserNotFound.
+func (s *AuthStore) GetUserByEmail(ctx context.Context, email string) (*AuthUser, error) {
+	return s.getUser(ctx, "email = ?", strings.ToLower(strings.TrimSpace(email)))
+}
+
+func (s *AuthStore) getUser(ctx context.Context, where string, arg any) (*AuthUser, error) {
+	user := new(AuthUser)
+	err := IDBFromContext(ctx, s.db).NewSelect().Model(user).Where(where, arg).Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, apierrors.Wrap(ErrAuthUserNotFound, apierrors.CategoryNotFound, "user not found")
+	case err != nil:
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load user")
+	}
+	return user, nil
+}
+
+// SetPassword stores the bcrypt hash of password as the password
+// credential of userID, replacing the previous one.
+func (s *AuthStore) SetPassword(ctx context.Context, userID, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to hash password")
+	}
+	now := s.now().UTC()
+	credential := &AuthCredential{UserID: userID, Kind: AuthCredentialPassword, Secret: string(hash), CreatedAt: now, UpdatedAt: now}
+	_, err = IDBFromContext(ctx, s.db).NewInsert().Model(credential).
+		On("CONFLICT (user_id, kind) DO UPDATE").
+		Set("secret = EXCLUDED.secret").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return EnrichError(err, OperationInfo{Operation: "set_password", Table: "auth_credentials"})
+	}
+	return nil
+}
+
+// VerifyPassword returns the user with email when password matches its
+// password credential, or an error wrapping ErrInvalidCredentials.
+func (s *AuthStore) VerifyPassword(ctx context.Context, email, password string) (*AuthUser, error) {
+	user, err := s.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrAuthUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, apierrors.Wrap(ErrInvalidCredentials, apierrors.CategoryAuth, "invalid credentials")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	credential := new(AuthCredential)
+	err = IDBFromContext(ctx, s.db).NewSelect().Model(credential).
+		Where("user_id = ?", user.ID).
+		Where("kind = ?", AuthCredentialPassword).
+		Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load credential")
+	}
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, apierrors.Wrap(ErrInvalidCredentials, apierrors.CategoryAuth, "invalid credentials")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(credential.Secret), []byte(password)) != nil {
+		return nil, apierrors.Wrap(ErrInvalidCredentials, apierrors.CategoryAuth, "invalid credentials")
+	}
+	return user, nil
+}
+
+// CreatePasswordReset returns a new reset token for userID, to send to
+// the user, and its expiry.
+func (s *AuthStore) CreatePasswordReset(ctx context.Context, userID string) (string, time.Time, error) {
+	token, err := newSessionID()
+	if err != nil {
+		return "", time.Time{}, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to generate reset token")
+	}
+	now := s.now().UTC()
+	reset := &AuthPasswordReset{TokenHash: hashResetToken(token), UserID: userID, ExpiresAt: now.Add(s.resetTTL), CreatedAt: now}
+	if _, err := IDBFromContext(ctx, s.db).NewInsert().Model(reset).Exec(ctx); err != nil {
+		return "", time.Time{}, EnrichError(err, OperationInfo{Operation: "create_password_reset", Table: "auth_password_resets"})
+	}
+	return token, reset.ExpiresAt, nil
+}
+
+// ResetPassword sets the password of the user owning token and marks
+// the token used, in one transaction. Expired, used and unknown tokens
+// return an error wrapping ErrInvalidResetToken.
+func (s *AuthStore) ResetPassword(ctx context.Context, token, password string) (*AuthUser, error) {
+	var user *AuthUser
+	err := RunInTx(ctx, IDBFromContext(ctx, s.db), func(ctx context.Context, tx bun.Tx) error {
+		ctx = ContextWithTx(ctx, tx)
+		now := s.now().UTC()
+
+		reset := new(AuthPasswordReset)
+		res, err := tx.NewUpdate().Model(reset).
+			Set("used_at = ?", now).
+			Where("token_hash = ?", hashResetToken(token)).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", now).
+			Returning("user_id").
+			Exec(ctx)
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to consume reset token")
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return apierrors.Wrap(ErrInvalidResetToken, apierrors.CategoryBadInput, "invalid password reset token")
+		}
+		if reset.UserID == "" {
+			// dialects without RETURNING
+			if err := tx.NewSelect().Model(reset).Column("user_id").Where("token_hash = ?", hashResetToken(token)).Scan(ctx); err != nil {
+				return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load reset token")
+			}
+		}
+
+		if err := s.SetPassword(ctx, reset.UserID, password); err != nil {
+			return err
+		}
+		user, err = s.GetUserByID(ctx, reset.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteExpiredPasswordResets removes expired and used reset tokens and
+// returns how many were removed.
+func (s *AuthStore) DeleteExpiredPasswordResets(ctx context.Context) (int64, error) {
+	res, err := IDBFromContext(ctx, s.db).NewDelete().Model((*AuthPasswordReset)(nil)).
+		WhereOr("expires_at <= ?", s.now().UTC()).
+		WhereOr("used_at IS NOT NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to delete expired reset tokens")
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUUID returns a random UUID v4.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,86 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := AuthMigrationFS(db, "20240101000000")
+	assert.Contains(t, string(fsys["20240101000000_auth.up.sql"].Data), "auth_password_resets_user_id_idx")
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(fsys).Migrate(ctx, db))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewAuthStore(db, WithPasswordResetTTL(time.Hour), WithBcryptCost(bcrypt.MinCost))
+	store.now = func() time.Time { return now }
+
+	user := &AuthUser{Email: " Ada@Example.com ", Username: "ada", Role: "admin"}
+	require.NoError(t, store.CreateUser(ctx, user))
+	assert.Len(t, user.ID, 36)
+	assert.Equal(t, "ada@example.com", user.Email)
+
+	loaded, err := store.GetUserByEmail(ctx, "ADA@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loaded.ID)
+
+	_, err = store.GetUserByID(ctx, "missing")
+	assert.ErrorIs(t, err, ErrAuthUserNotFound)
+	assert.ErrorIs(t, store.UpdateUser(ctx, &AuthUser{ID: "missing", Email: "x@example.com"}), ErrAuthUserNotFound)
+
+	loaded.Status = "active"
+	require.NoError(t, store.UpdateUser(ctx, loaded))
+	loaded, err = store.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "active", loaded.Status)
+
+	// missing users and passwords are compared against a dummy hash
+	// of the store cost, so they take as long as a wrong password
+	cost, err := bcrypt.Cost(store.dummyHash)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+
+	_, err = store.VerifyPassword(ctx, user.Email, "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	require.NoError(t, store.SetPassword(ctx, user.ID, "secret"))
+	require.NoError(t, store.SetPassword(ctx, user.ID, "secret2"))
+	verified, err := store.VerifyPassword(ctx, "ada@example.com", "secret2")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, verified.ID)
+	_, err = store.VerifyPassword(ctx, user.Email, "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = store.VerifyPassword(ctx, "nobody@example.com", "secret2")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	token, expires, err := store.CreatePasswordReset(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), expires)
+
+	reset, err := store.ResetPassword(ctx, token, "secret3")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, reset.ID)
+	_, err = store.VerifyPassword(ctx, user.Email, "secret3")
+	require.NoError(t, err)
+
+	_, err = store.ResetPassword(ctx, token, "secret4")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+
+	expired, _, err := store.CreatePasswordReset(ctx, user.ID)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = store.ResetPassword(ctx, expired, "secret4")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+
+	removed, err := store.DeleteExpiredPasswordResets(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, removed)
+}
@@ -0,0 +1,247 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+const defaultBackfillBatchSize = 1000
+
+// DataMigration tracks the progress of a batched data migration in the
+// data_migrations table, so an interrupted run resumes after LastKey.
+type DataMigration struct {
+	bun.BaseModel `bun:"table:data_migrations"`
+
+	Name         string       `bun:"name,pk"`
+	LastKey      string       `bun:"last_key"`
+	RowsAffected int64        `bun:"rows_affected,notnull"`
+	StartedAt    time.Time    `bun:"started_at,notnull"`
+	UpdatedAt    time.Time    `bun:"updated_at,notnull"`
+	CompletedAt  bun.NullTime `bun:"completed_at"`
+}
+
+// DataMigrationsMigrationFS returns up and down migrations for the
+// data_migrations table, named <version>_data_migrations, rendered for
+// the dialect of db.
+func DataMigrationsMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "data_migrations", (*DataMigration)(nil))
+}
+
+// BackfillSpec describes an UPDATE run by Backfill.
+type BackfillSpec struct {
+	// Name identifies the checkpoint in the data_migrations table.
+	Name  string
+	Table string
+	// Key is the single column the batches walk in order, "id" by
+	// default. Its values must be unique.
+	Key string
+	// Set is the SET clause, e.g. "region = 'eu'".
+	Set string
+	// Where optionally restricts the updated rows, e.g. "region IS NULL".
+	Where string
+	// BatchSize is the keys per transaction, 1000 by default.
+	BatchSize int
+	// RowsPerSecond caps the scanned keys per second, unlimited when zero.
+	RowsPerSecond float64
+	// Pause is the minimum wait between batches, to let replicas and
+	// vacuum catch up.
+	Pause time.Duration
+	// OnProgress is called after every batch.
+	OnProgress func(BackfillProgress)
+}
+
+// Validate checks the identifiers and expressions of the spec.
+func (s BackfillSpec) Validate() error {
+	if s.Name == "" {
+		return apierrors.New("backfill name is required", apierrors.CategoryBadInput)
+	}
+	for _, name := range []string{s.Table, s.Key} {
+		if err := ValidateIdentifier(name); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(s.Set) == "" {
+		return apierrors.New("backfill SET clause is required", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"backfill": s.Name})
+	}
+	for _, expr := range []string{s.Set, s.Where} {
+		if err := ValidateExpression(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillProgress reports a Backfill run. RowsAffected and LastKey
+// include the runs it resumed.
+type BackfillProgress struct {
+	Name         string
+	LastKey      string
+	RowsAffected int64
+	// Batches and Scanned count the batches and keys of this run.
+	Batches int
+	Scanned int64
+	Elapsed time.Duration
+	Done    bool
+}
+
+// Rate returns the scanned keys per second of this run.
+func (p BackfillProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Scanned) / p.Elapsed.Seconds()
+}
+
+// Backfill runs spec in batches of Key order, one short transaction per
+// batch, so UPDATEs touching millions of rows never hold long locks.
+// Each batch commits its checkpoint in the data_migrations table with
+// it: an interrupted backfill resumes after the last committed batch
+// and a completed one returns immediately with Done set.
+//
+//	progress, err := persistence.Backfill(ctx, db, persistence.BackfillSpec{
+//		Name:          "orders_currency",
+//		Table:         "orders",
+//		Set:           "currency = 'EUR'",
+//		Where:         "currency IS NULL",
+//		RowsPerSecond: 5000,
+//	})
+func Backfill(ctx context.Context, db bun.IDB, spec BackfillSpec) (BackfillProgress, error) {
+	if spec.Key == "" {
+		spec.Key = "id"
+	}
+	if spec.BatchSize <= 0 {
+		spec.BatchSize = defaultBackfillBatchSize
+	}
+	if err := spec.Validate(); err != nil {
+		return BackfillProgress{}, err
+	}
+
+	start := time.Now()
+	state := &DataMigration{Name: spec.Name}
+	err := db.NewSelect().Model(state).WherePK().Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		state.StartedAt = start.UTC()
+	case err != nil:
+		return BackfillProgress{}, EnrichError(err, OperationInfo{Operation: "select", Table: "data_migrations"})
+	}
+
+	progress := BackfillProgress{Name: spec.Name, LastKey: state.LastKey, RowsAffected: state.RowsAffected}
+	if !state.CompletedAt.IsZero() {
+		progress.Done = true
+		return progress, nil
+	}
+	report := func() {
+		progress.Elapsed = time.Since(start)
+		if spec.OnProgress != nil {
+			spec.OnProgress(progress)
+		}
+	}
+
+	table, key := bun.Ident(spec.Table), bun.Ident(spec.Key)
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		batchStart := time.Now()
+
+		var keys []string
+		q := db.NewSelect().TableExpr("?", table).ColumnExpr("?", key).OrderExpr("? ASC", key).Limit(spec.BatchSize)
+		if state.LastKey != "" {
+			q = q.Where("? > ?", key, state.LastKey)
+		}
+		if err := q.Scan(ctx, &keys); err != nil {
+			return progress, EnrichError(err, OperationInfo{Operation: "backfill", Table: spec.Table})
+		}
+		if len(keys) == 0 {
+			state.UpdatedAt = time.Now().UTC()
+			state.CompletedAt = bun.NullTime{Time: state.UpdatedAt}
+			if err := saveDataMigration(ctx, db, state); err != nil {
+				return progress, err
+			}
+			progress.Done = true
+			report()
+			return progress, nil
+		}
+
+		last := keys[len(keys)-1]
+		err := RunInTx(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+			q := tx.NewUpdate().TableExpr("?", table).Set(spec.Set).Where("? <= ?", key, last)
+			if state.LastKey != "" {
+				q = q.Where("? > ?", key, state.LastKey)
+			}
+			if spec.Where != "" {
+				q = q.Where(spec.Where)
+			}
+			res, err := q.Exec(ctx)
+			if err != nil {
+				return EnrichError(err, OperationInfo{Operation: "backfill", Table: spec.Table})
+			}
+			n, _ := res.RowsAffected()
+
+			next := *state
+			next.LastKey = last
+			next.RowsAffected += n
+			next.UpdatedAt = time.Now().UTC()
+			if err := saveDataMigration(ctx, tx, &next); err != nil {
+				return err
+			}
+			*state = next
+			return nil
+		})
+		if err != nil {
+			return progress, err
+		}
+
+		progress.LastKey = state.LastKey
+		progress.RowsAffected = state.RowsAffected
+		progress.Batches++
+		progress.Scanned += int64(len(keys))
+		report()
+
+		if err := backfillThrottle(ctx, spec, len(keys), time.Since(batchStart)); err != nil {
+			return progress, err
+		}
+	}
+}
+
+// backfillThrottle waits the pause, or longer when the batch was faster
+// than RowsPerSecond allows.
+func backfillThrottle(ctx context.Context, spec BackfillSpec, scanned int, took time.Duration) error {
+	wait := spec.Pause
+	if spec.RowsPerSecond > 0 {
+		budget := time.Duration(float64(scanned) / spec.RowsPerSecond * float64(time.Second))
+		wait = max(wait, budget-took)
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// saveDataMigration upserts the checkpoint of state, see NewUpsertQuery.
+func saveDataMigration(ctx context.Context, db bun.IDB, state *DataMigration) error {
+	q, err := NewUpsertQuery(db, state, []string{"name"}, []string{"last_key", "rows_affected", "updated_at", "completed_at"})
+	if err == nil {
+		_, err = q.Exec(ctx)
+	}
+	if err != nil {
+		return EnrichError(err, OperationInfo{Operation: "save", Table: "data_migrations"})
+	}
+	return nil
+}
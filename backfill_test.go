@@ -0,0 +1,157 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/schema"
+)
+
+type backfillAccount struct {
+	bun.BaseModel `bun:"table:backfill_accounts"`
+
+	ID     int64  `bun:"id,pk"`
+	Name   string `bun:"name"`
+	Region string `bun:"region,nullzero"`
+}
+
+func newBackfillTestDB(t *testing.T, rows int) *bun.DB {
+	t.Helper()
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	t.Cleanup(cleanup)
+	for _, model := range []any{(*backfillAccount)(nil), (*DataMigration)(nil)} {
+		_, err := db.NewCreateTable().Model(model).Exec(ctx)
+		require.NoError(t, err)
+	}
+	accounts := make([]backfillAccount, rows)
+	for i := range accounts {
+		accounts[i] = backfillAccount{ID: int64(i + 1), Name: "a"}
+	}
+	_, err := db.NewInsert().Model(&accounts).Exec(ctx)
+	require.NoError(t, err)
+	return db
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	db := newBackfillTestDB(t, 25)
+	_, err := db.NewUpdate().Model((*backfillAccount)(nil)).Set("region = 'us'").Where("id = 3").Exec(ctx)
+	require.NoError(t, err)
+
+	var reports []BackfillProgress
+	spec := BackfillSpec{
+		Name:       "add_region",
+		Table:      "backfill_accounts",
+		Set:        "region = 'eu'",
+		Where:      "region IS NULL",
+		BatchSize:  10,
+		OnProgress: func(p BackfillProgress) { reports = append(reports, p) },
+	}
+	progress, err := Backfill(ctx, db, spec)
+	require.NoError(t, err)
+	assert.True(t, progress.Done)
+	assert.Equal(t, 3, progress.Batches)
+	assert.EqualValues(t, 25, progress.Scanned)
+	assert.EqualValues(t, 24, progress.RowsAffected)
+	assert.Equal(t, "25", progress.LastKey)
+	require.Len(t, reports, 4)
+	assert.Equal(t, "10", reports[0].LastKey)
+	assert.True(t, reports[3].Done)
+
+	eu, err := db.NewSelect().Model((*backfillAccount)(nil)).Where("region = 'eu'").Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 24, eu)
+
+	// completed backfills do not run again
+	progress, err = Backfill(ctx, db, spec)
+	require.NoError(t, err)
+	assert.True(t, progress.Done)
+	assert.Zero(t, progress.Batches)
+}
+
+// duplicateKeyDialect has the upsert features of MySQL.
+type duplicateKeyDialect struct {
+	schema.Dialect
+}
+
+func (d duplicateKeyDialect) Features() feature.Feature {
+	return d.Dialect.Features().
+		Remove(feature.InsertOnConflict | feature.InsertReturning | feature.Returning).
+		Set(feature.InsertOnDuplicateKey)
+}
+
+func TestSaveDataMigration_DuplicateKey(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, duplicateKeyDialect{Dialect: pgdialect.New()})
+
+	mock.ExpectExec(`INSERT INTO "data_migrations" .* ON DUPLICATE KEY UPDATE "last_key" = VALUES\("last_key"\), "rows_affected" = VALUES\("rows_affected"\), "updated_at" = VALUES\("updated_at"\), "completed_at" = VALUES\("completed_at"\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, saveDataMigration(context.Background(), db, &DataMigration{Name: "add_region", LastKey: "20"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackfill_ResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	db := newBackfillTestDB(t, 25)
+
+	// a previous run committed the batches up to id 20
+	require.NoError(t, saveDataMigration(ctx, db, &DataMigration{Name: "add_region", LastKey: "20"}))
+
+	spec := BackfillSpec{Name: "add_region", Table: "backfill_accounts", Set: "region = 'eu'", Where: "region IS NULL", BatchSize: 2}
+	progress, err := Backfill(ctx, db, spec)
+	require.NoError(t, err)
+	assert.True(t, progress.Done)
+	assert.Equal(t, "25", progress.LastKey)
+	assert.EqualValues(t, 5, progress.RowsAffected)
+
+	filled, err := db.NewSelect().Model((*backfillAccount)(nil)).Where("region = 'eu'").Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, filled)
+
+	state := &DataMigration{Name: "add_region"}
+	require.NoError(t, db.NewSelect().Model(state).WherePK().Scan(ctx))
+	assert.False(t, state.CompletedAt.IsZero())
+
+	// completed backfills do not run again
+	_, err = db.NewUpdate().Model((*backfillAccount)(nil)).Set("region = NULL").Where("1 = 1").Exec(ctx)
+	require.NoError(t, err)
+	progress, err = Backfill(ctx, db, spec)
+	require.NoError(t, err)
+	assert.True(t, progress.Done)
+	filled, err = db.NewSelect().Model((*backfillAccount)(nil)).Where("region = 'eu'").Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, filled)
+}
+
+func TestBackfill_RateLimited(t *testing.T) {
+	ctx := context.Background()
+	db := newBackfillTestDB(t, 4)
+
+	start := time.Now()
+	_, err := Backfill(ctx, db, BackfillSpec{Name: "slow", Table: "backfill_accounts", Set: "name = 'b'", BatchSize: 2, RowsPerSecond: 40})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "two batches of two rows at 40 rows/s")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = Backfill(canceled, db, BackfillSpec{Name: "canceled", Table: "backfill_accounts", Set: "name = 'c'"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBackfillSpec_Validate(t *testing.T) {
+	assert.Error(t, BackfillSpec{Table: "t", Key: "id", Set: "a = 1"}.Validate())
+	assert.ErrorIs(t, BackfillSpec{Name: "n", Table: "t;", Key: "id", Set: "a = 1"}.Validate(), ErrUnsafeIdentifier)
+	assert.ErrorIs(t, BackfillSpec{Name: "n", Table: "t", Key: "id", Set: "a = 1; DROP TABLE t"}.Validate(), ErrUnsafeExpression)
+	assert.NoError(t, BackfillSpec{Name: "n", Table: "t", Key: "id", Set: "a = 1"}.Validate())
+}
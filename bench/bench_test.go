@@ -0,0 +1,192 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	persistence "github.com/goliatone/go-persistence-bun"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type benchItem struct {
+	bun.BaseModel `bun:"table:bench_items"`
+
+	ID    int64  `bun:"id,pk,autoincrement"`
+	Name  string `bun:"name,notnull"`
+	Score int64  `bun:"score,notnull"`
+}
+
+type target struct {
+	name string
+	open func(b *testing.B) *bun.DB
+}
+
+func targets() []target {
+	list := []target{{name: "sqlite", open: openSQLite}}
+	if dsn := os.Getenv("PERSISTENCE_BENCH_PG_DSN"); dsn != "" {
+		driver := os.Getenv("PERSISTENCE_BENCH_PG_DRIVER")
+		if driver == "" {
+			driver = "postgres"
+		}
+		list = append(list, target{name: "postgres", open: func(b *testing.B) *bun.DB {
+			return openPostgres(b, driver, dsn)
+		}})
+	}
+	return list
+}
+
+func openSQLite(b *testing.B) *bun.DB {
+	b.Helper()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	b.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func openPostgres(b *testing.B, driver, dsn string) *bun.DB {
+	b.Helper()
+	sqlDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		b.Skipf("postgres driver %q not available: %v", driver, err)
+	}
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	b.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// resetItems recreates bench_items with n rows.
+func resetItems(b *testing.B, db *bun.DB, n int) {
+	b.Helper()
+	ctx := context.Background()
+	if _, err := db.NewDropTable().Model((*benchItem)(nil)).IfExists().Exec(ctx); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.NewCreateTable().Model((*benchItem)(nil)).Exec(ctx); err != nil {
+		b.Fatal(err)
+	}
+	if n > 0 {
+		if _, err := persistence.BulkCopySlice(ctx, db, newItems(n)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newItems(n int) []benchItem {
+	items := make([]benchItem, n)
+	for i := range items {
+		items[i] = benchItem{Name: fmt.Sprintf("item-%d", i), Score: int64(i % 97)}
+	}
+	return items
+}
+
+func BenchmarkBulkInsert(b *testing.B) {
+	for _, tgt := range targets() {
+		for _, n := range []int{100, 1000} {
+			b.Run(fmt.Sprintf("%s/rows=%d", tgt.name, n), func(b *testing.B) {
+				db := tgt.open(b)
+				items := newItems(n)
+				ctx := context.Background()
+				b.ReportAllocs()
+				for b.Loop() {
+					b.StopTimer()
+					resetItems(b, db, 0)
+					b.StartTimer()
+					if _, err := persistence.BulkCopySlice(ctx, db, items); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPaginatedList(b *testing.B) {
+	for _, tgt := range targets() {
+		b.Run(tgt.name, func(b *testing.B) {
+			db := tgt.open(b)
+			resetItems(b, db, 5000)
+			ctx := context.Background()
+			b.ReportAllocs()
+			page := 0
+			for b.Loop() {
+				var items []benchItem
+				err := db.NewSelect().Model(&items).
+					Where("score > ?", 10).
+					Order("id").
+					Limit(50).
+					Offset((page % 40) * 50).
+					Scan(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				page++
+			}
+		})
+	}
+}
+
+func BenchmarkMigrationApply(b *testing.B) {
+	fsys := fstest.MapFS{}
+	for i := range 20 {
+		version := fmt.Sprintf("202401010000%02d", i)
+		fsys[version+"_t.up.sql"] = &fstest.MapFile{Data: fmt.Appendf(nil, "CREATE TABLE bench_m%d (id integer primary key, name varchar(50));", i)}
+		fsys[version+"_t.down.sql"] = &fstest.MapFile{Data: fmt.Appendf(nil, "DROP TABLE bench_m%d;", i)}
+	}
+
+	for _, tgt := range targets() {
+		b.Run(fmt.Sprintf("%s/migrations=20", tgt.name), func(b *testing.B) {
+			db := tgt.open(b)
+			ctx := context.Background()
+			b.ReportAllocs()
+			for b.Loop() {
+				migrations := persistence.NewMigrations().RegisterSQLMigrations(fsys)
+				if err := migrations.Migrate(ctx, db); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if err := migrations.RollbackAll(ctx, db); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkFixtureLoad(b *testing.B) {
+	var yml strings.Builder
+	yml.WriteString("- model: BenchItem\n  rows:\n")
+	for i := range 200 {
+		fmt.Fprintf(&yml, "    - name: item-%d\n      score: %d\n", i, i%97)
+	}
+	fsys := fstest.MapFS{"items.yml": {Data: []byte(yml.String())}}
+
+	for _, tgt := range targets() {
+		b.Run(fmt.Sprintf("%s/rows=200", tgt.name), func(b *testing.B) {
+			db := tgt.open(b)
+			db.RegisterModel((*benchItem)(nil))
+			ctx := context.Background()
+			b.ReportAllocs()
+			for b.Loop() {
+				b.StopTimer()
+				resetItems(b, db, 0)
+				b.StartTimer()
+				if err := persistence.NewSeedManager(db, persistence.WithFS(fsys)).Load(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package bench holds reproducible benchmarks of the persistence package:
+// bulk insert, paginated listing, migration apply and fixture load.
+//
+// Benchmarks run against in memory SQLite. Set PERSISTENCE_BENCH_PG_DSN,
+// and PERSISTENCE_BENCH_PG_DRIVER when the registered driver is not
+// named "postgres", to also run them against Postgres; the driver must be
+// linked into the test binary, e.g. with a local file importing it.
+//
+// Run with allocation counts and compare runs with benchstat:
+//
+//	go test -run '^$' -bench . -benchmem -count 6 ./bench > new.txt
+//	benchstat old.txt new.txt
+//
+// or use ./taskfile bench and ./taskfile bench:compare.
+package bench
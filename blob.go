@@ -0,0 +1,290 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const defaultBlobChunkSize = 256 << 10
+
+var (
+	// ErrBlobNotFound indicates a blob with no chunks.
+	ErrBlobNotFound = errors.New("persistence: blob not found")
+	// ErrLargeObjectUnsupported indicates large objects on a dialect
+	// other than Postgres.
+	ErrLargeObjectUnsupported = errors.New("persistence: large objects require postgres")
+)
+
+// BlobChunk is one chunk of a blob stored by BlobStore.
+type BlobChunk struct {
+	bun.BaseModel `bun:"table:blob_chunks"`
+
+	BlobID string `bun:"blob_id,pk"`
+	Seq    int64  `bun:"seq,pk"`
+	Data   []byte `bun:"data,notnull"`
+}
+
+// BlobMigrationFS returns up and down migrations for the blob_chunks
+// table, named <version>_blobs, rendered for the dialect of db.
+func BlobMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "blobs", (*BlobChunk)(nil))
+}
+
+// BlobStoreOption configures a BlobStore
+type BlobStoreOption func(*BlobStore)
+
+// WithBlobChunkSize sets the bytes per chunk row, 256KiB by default.
+func WithBlobChunkSize(n int) BlobStoreOption {
+	return func(s *BlobStore) {
+		if n > 0 {
+			s.chunkSize = n
+		}
+	}
+}
+
+// BlobStore streams large binary values in and out of chunk rows, bytea
+// on Postgres and BLOB on SQLite, so only one chunk is held in memory at
+// a time.
+type BlobStore struct {
+	db        bun.IDB
+	chunkSize int
+}
+
+// NewBlobStore creates a store on the blob_chunks table of db.
+func NewBlobStore(db bun.IDB, opts ...BlobStoreOption) *BlobStore {
+	s := &BlobStore{db: db, chunkSize: defaultBlobChunkSize}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Write stores the content of r as blob id, replacing any previous
+// content, and returns the number of bytes written. The chunks are
+// written in a transaction, or in the transaction db already is.
+func (s *BlobStore) Write(ctx context.Context, id string, r io.Reader) (int64, error) {
+	var written int64
+	err := RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := s.delete(ctx, tx, id); err != nil {
+			return err
+		}
+		buf := make([]byte, s.chunkSize)
+		for seq := int64(0); ; seq++ {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				chunk := &BlobChunk{BlobID: id, Seq: seq, Data: buf[:n]}
+				if _, err := tx.NewInsert().Model(chunk).Exec(ctx); err != nil {
+					return EnrichError(err, OperationInfo{Operation: "insert", Table: "blob_chunks"})
+				}
+				written += int64(n)
+			}
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				return nil
+			case err != nil:
+				return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read blob content").
+					WithMetadata(map[string]any{"blob_id": id})
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// Open returns a reader fetching blob id one chunk at a time. A blob
+// rewritten while it is read may be returned partly old and partly new,
+// open it in a transaction for a consistent read.
+func (s *BlobStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	exists, err := s.db.NewSelect().Model((*BlobChunk)(nil)).Where("blob_id = ?", id).Exists(ctx)
+	if err != nil {
+		return nil, EnrichError(err, OperationInfo{Operation: "select", Table: "blob_chunks"})
+	}
+	if !exists {
+		return nil, apierrors.Wrap(ErrBlobNotFound, apierrors.CategoryNotFound, "blob not found").
+			WithMetadata(map[string]any{"blob_id": id})
+	}
+	return &blobReader{ctx: ctx, db: s.db, id: id}, nil
+}
+
+// Size returns the length of blob id in bytes.
+func (s *BlobStore) Size(ctx context.Context, id string) (int64, error) {
+	var size sql.NullInt64
+	err := s.db.NewSelect().Model((*BlobChunk)(nil)).
+		ColumnExpr("SUM(LENGTH(data))").
+		Where("blob_id = ?", id).
+		Scan(ctx, &size)
+	if err != nil {
+		return 0, EnrichError(err, OperationInfo{Operation: "select", Table: "blob_chunks"})
+	}
+	if !size.Valid {
+		return 0, apierrors.Wrap(ErrBlobNotFound, apierrors.CategoryNotFound, "blob not found").
+			WithMetadata(map[string]any{"blob_id": id})
+	}
+	return size.Int64, nil
+}
+
+// Delete removes blob id. Deleting a missing blob is not an error.
+func (s *BlobStore) Delete(ctx context.Context, id string) error {
+	return s.delete(ctx, s.db, id)
+}
+
+func (s *BlobStore) delete(ctx context.Context, db bun.IDB, id string) error {
+	if _, err := db.NewDelete().Model((*BlobChunk)(nil)).Where("blob_id = ?", id).Exec(ctx); err != nil {
+		return EnrichError(err, OperationInfo{Operation: "delete", Table: "blob_chunks"})
+	}
+	return nil
+}
+
+type blobReader struct {
+	ctx context.Context
+	db  bun.IDB
+	id  string
+	seq int64
+	buf []byte
+	eof bool
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		var chunk BlobChunk
+		err := r.db.NewSelect().Model(&chunk).
+			Where("blob_id = ?", r.id).
+			Where("seq = ?", r.seq).
+			Scan(r.ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			r.eof = true
+			continue
+		}
+		if err != nil {
+			return 0, EnrichError(err, OperationInfo{Operation: "select", Table: "blob_chunks"})
+		}
+		r.buf = chunk.Data
+		r.seq++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *blobReader) Close() error {
+	r.buf, r.eof = nil, true
+	return nil
+}
+
+// WriteLargeObject stores the content of r as a new Postgres large
+// object, chunkSize bytes per lo_put call, and returns its OID. The
+// object is created in a transaction, or in the transaction db already
+// is.
+func WriteLargeObject(ctx context.Context, db bun.IDB, r io.Reader, chunkSize int) (uint32, error) {
+	if err := checkLargeObjects(db); err != nil {
+		return 0, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultBlobChunkSize
+	}
+
+	var oid uint32
+	err := RunInTx(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw("SELECT lo_create(0)").Scan(ctx, &oid); err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create large object")
+		}
+		buf := make([]byte, chunkSize)
+		var offset int64
+		for {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				if _, err := tx.NewRaw("SELECT lo_put(?, ?, ?)", oid, offset, buf[:n]).Exec(ctx); err != nil {
+					return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to write large object").
+						WithMetadata(map[string]any{"oid": oid, "offset": offset})
+				}
+				offset += int64(n)
+			}
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				return nil
+			case err != nil:
+				return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read large object content")
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return oid, nil
+}
+
+// OpenLargeObject returns a reader fetching the Postgres large object
+// oid chunkSize bytes per lo_get call.
+func OpenLargeObject(ctx context.Context, db bun.IDB, oid uint32, chunkSize int) (io.Reader, error) {
+	if err := checkLargeObjects(db); err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultBlobChunkSize
+	}
+	return &largeObjectReader{ctx: ctx, db: db, oid: oid, chunkSize: chunkSize}, nil
+}
+
+// DeleteLargeObject unlinks the Postgres large object oid.
+func DeleteLargeObject(ctx context.Context, db bun.IDB, oid uint32) error {
+	if err := checkLargeObjects(db); err != nil {
+		return err
+	}
+	if _, err := db.NewRaw("SELECT lo_unlink(?)", oid).Exec(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to unlink large object").
+			WithMetadata(map[string]any{"oid": oid})
+	}
+	return nil
+}
+
+func checkLargeObjects(db bun.IDB) error {
+	if db.Dialect().Name() != dialect.PG {
+		return apierrors.Wrap(ErrLargeObjectUnsupported, apierrors.CategoryBadInput, "large objects require postgres").
+			WithMetadata(map[string]any{"dialect": db.Dialect().Name().String()})
+	}
+	return nil
+}
+
+type largeObjectReader struct {
+	ctx       context.Context
+	db        bun.IDB
+	oid       uint32
+	chunkSize int
+	offset    int64
+	buf       []byte
+	eof       bool
+}
+
+func (r *largeObjectReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		var data []byte
+		err := r.db.NewRaw("SELECT lo_get(?, ?, ?)", r.oid, r.offset, r.chunkSize).Scan(r.ctx, &data)
+		if err != nil {
+			return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read large object").
+				WithMetadata(map[string]any{"oid": r.oid, "offset": r.offset})
+		}
+		r.offset += int64(len(data))
+		r.eof = len(data) < r.chunkSize
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
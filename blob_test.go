@@ -0,0 +1,106 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestBlobStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err := db.NewCreateTable().Model((*BlobChunk)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	store := NewBlobStore(db, WithBlobChunkSize(4))
+	content := []byte("attachment bytes, streamed in chunks")
+	n, err := store.Write(ctx, "doc-1", bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+
+	chunks, err := db.NewSelect().Model((*BlobChunk)(nil)).Where("blob_id = ?", "doc-1").Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 9, chunks)
+
+	r, err := store.Open(ctx, "doc-1")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, content, got)
+
+	_, err = store.Write(ctx, "doc-1", strings.NewReader("short"))
+	require.NoError(t, err)
+	size, err := store.Size(ctx, "doc-1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+
+	require.NoError(t, store.Delete(ctx, "doc-1"))
+	_, err = store.Open(ctx, "doc-1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	_, err = store.Size(ctx, "doc-1")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestBlobMigrationFS(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := BlobMigrationFS(db, "20250101000000")
+	assert.Contains(t, string(fsys["20250101000000_blobs.up.sql"].Data), `"blob_chunks"`)
+	assert.Contains(t, string(fsys["20250101000000_blobs.down.sql"].Data), `DROP TABLE IF EXISTS "blob_chunks"`)
+}
+
+func TestLargeObjects_Postgres(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT lo_create(0)")).
+		WillReturnRows(sqlmock.NewRows([]string{"lo_create"}).AddRow(42))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT lo_put(42, 0, '\x6c6172`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT lo_put(42, 3, '\x6765`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	oid, err := WriteLargeObject(ctx, db, strings.NewReader("large"), 3)
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, oid)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT lo_get(42, 0, 3)")).
+		WillReturnRows(sqlmock.NewRows([]string{"lo_get"}).AddRow([]byte("lar")))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT lo_get(42, 3, 3)")).
+		WillReturnRows(sqlmock.NewRows([]string{"lo_get"}).AddRow([]byte("ge")))
+
+	r, err := OpenLargeObject(ctx, db, oid, 3)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "large", string(got))
+
+	mock.ExpectExec(regexp.QuoteMeta("SELECT lo_unlink(42)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, DeleteLargeObject(ctx, db, oid))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLargeObjects_RequirePostgres(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := WriteLargeObject(context.Background(), db, strings.NewReader("x"), 0)
+	assert.ErrorIs(t, err, ErrLargeObjectUnsupported)
+	_, err = OpenLargeObject(context.Background(), db, 1, 0)
+	assert.ErrorIs(t, err, ErrLargeObjectUnsupported)
+}
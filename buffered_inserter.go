@@ -0,0 +1,379 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultBufferCapacity      = 10000
+	defaultBufferFlushSize     = 500
+	defaultBufferFlushInterval = time.Second
+)
+
+var (
+	// ErrBufferFull indicates a row dropped because the buffer was full.
+	ErrBufferFull = errors.New("persistence: insert buffer is full")
+	// ErrInserterClosed indicates a row added after Close.
+	ErrInserterClosed = errors.New("persistence: buffered inserter is closed")
+	// ErrRowsLost indicates rows that were buffered but never written.
+	ErrRowsLost = errors.New("persistence: buffered rows were lost")
+)
+
+// BufferedInserterStats counts the rows of a BufferedInserter.
+type BufferedInserterStats struct {
+	// Added rows were accepted by Add.
+	Added int64
+	// Written rows were inserted.
+	Written int64
+	// Dropped rows were rejected by Add because the buffer was full.
+	Dropped int64
+	// Failed rows were in a batch whose insert failed.
+	Failed int64
+	// Lost rows were still buffered when Close gave up.
+	Lost int64
+	// Pending rows are buffered and not written yet.
+	Pending int64
+}
+
+// BufferedInserterOption configures a BufferedInserter
+type BufferedInserterOption func(*bufferedInserterOptions)
+
+type bufferedInserterOptions struct {
+	capacity  int
+	flushSize int
+	interval  time.Duration
+	block     bool
+	onError   func(err error, rows int)
+	copyOpts  []BulkCopyOption
+}
+
+// WithBufferCapacity sets how many rows can wait for the batch being
+// built, 10000 by default.
+func WithBufferCapacity(n int) BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		if n > 0 {
+			o.capacity = n
+		}
+	}
+}
+
+// WithBufferFlushSize sets the rows per insert batch, 500 by default.
+func WithBufferFlushSize(n int) BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		if n > 0 {
+			o.flushSize = n
+		}
+	}
+}
+
+// WithBufferFlushInterval sets how often partial batches are written,
+// one second by default.
+func WithBufferFlushInterval(interval time.Duration) BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		if interval > 0 {
+			o.interval = interval
+		}
+	}
+}
+
+// WithBufferBlocking makes Add wait for room in a full buffer, until its
+// context is done, instead of dropping the row with ErrBufferFull.
+func WithBufferBlocking() BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		o.block = true
+	}
+}
+
+// WithBufferErrorHandler sets the function called with the error and
+// the size of every batch that fails to insert.
+func WithBufferErrorHandler(fn func(err error, rows int)) BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		o.onError = fn
+	}
+}
+
+// WithBufferCopyOptions sets the BulkCopy options of the batches, e.g.
+// WithCopier to use COPY on Postgres.
+func WithBufferCopyOptions(opts ...BulkCopyOption) BufferedInserterOption {
+	return func(o *bufferedInserterOptions) {
+		o.copyOpts = append(o.copyOpts, opts...)
+	}
+}
+
+// BufferedInserter batches inserts of T in memory and writes them with
+// BulkCopy when a batch is full or the flush interval elapses, for
+// metrics and log tables where per row inserts are too slow. Rows are
+// written at most once, failed batches are counted and reported but not
+// retried, and rows still buffered when Close gives up are counted as
+// lost, so it fits data that tolerates loss.
+type BufferedInserter[T any] struct {
+	db   bun.IDB
+	opts bufferedInserterOptions
+
+	rows     chan T
+	flushReq chan chan error
+	closing  chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+
+	// ctx bounds background flushes, Close cancels it when its own
+	// context is done.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.RWMutex
+	closed   bool
+	closeCtx context.Context
+	adding   sync.WaitGroup
+
+	added, written, dropped, failed, lost, pending atomic.Int64
+}
+
+// NewBufferedInserter starts an inserter writing to the table of T on
+// db. Call Close to flush and stop it.
+func NewBufferedInserter[T any](db bun.IDB, opts ...BufferedInserterOption) *BufferedInserter[T] {
+	o := bufferedInserterOptions{
+		capacity:  defaultBufferCapacity,
+		flushSize: defaultBufferFlushSize,
+		interval:  defaultBufferFlushInterval,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	b := &BufferedInserter[T]{
+		db:       db,
+		opts:     o,
+		rows:     make(chan T, o.capacity),
+		flushReq: make(chan chan error),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// Add buffers row. A full buffer drops it with ErrBufferFull, or with
+// WithBufferBlocking waits until there is room, ctx is done or Close is
+// called.
+func (b *BufferedInserter[T]) Add(ctx context.Context, row T) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrInserterClosed
+	}
+	b.adding.Add(1)
+	b.mu.RUnlock()
+	defer b.adding.Done()
+
+	// count the row first, so the writer never decrements below zero
+	b.pending.Add(1)
+	if b.opts.block {
+		select {
+		case b.rows <- row:
+		case <-ctx.Done():
+			b.pending.Add(-1)
+			b.dropped.Add(1)
+			return ctx.Err()
+		case <-b.closing:
+			b.pending.Add(-1)
+			return ErrInserterClosed
+		}
+	} else {
+		select {
+		case b.rows <- row:
+		default:
+			b.pending.Add(-1)
+			b.dropped.Add(1)
+			return ErrBufferFull
+		}
+	}
+	b.added.Add(1)
+	return nil
+}
+
+// Flush writes the buffered rows now and returns the first batch error.
+func (b *BufferedInserter[T]) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case b.flushReq <- reply:
+	case <-b.stopped:
+		return ErrInserterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting rows and writes the buffered ones with ctx. Adds
+// blocked on a full buffer return ErrInserterClosed, and a flush in
+// progress is cancelled when ctx is done. Rows that could not be written
+// are counted as lost and reported with an error wrapping ErrRowsLost.
+func (b *BufferedInserter[T]) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.closeCtx = ctx
+	b.mu.Unlock()
+	defer b.cancel()
+
+	// no row is sent once the adders returned, so the final drain sees
+	// them all
+	close(b.closing)
+	b.adding.Wait()
+	close(b.done)
+
+	select {
+	case <-b.stopped:
+	case <-ctx.Done():
+		b.cancel()
+		<-b.stopped
+	}
+
+	if lost := b.lost.Load(); lost > 0 {
+		return apierrors.Wrap(ErrRowsLost, apierrors.CategoryOperation, "buffered rows were lost on close").
+			WithMetadata(map[string]any{"lost": lost})
+	}
+	return nil
+}
+
+// Stats returns the row counters.
+func (b *BufferedInserter[T]) Stats() BufferedInserterStats {
+	return BufferedInserterStats{
+		Added:   b.added.Load(),
+		Written: b.written.Load(),
+		Dropped: b.dropped.Load(),
+		Failed:  b.failed.Load(),
+		Lost:    b.lost.Load(),
+		Pending: b.pending.Load(),
+	}
+}
+
+func (b *BufferedInserter[T]) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.opts.interval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, b.opts.flushSize)
+	flush := func(ctx context.Context) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := b.write(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+	// drain moves the buffered rows into batches, writing full ones.
+	drain := func(ctx context.Context) error {
+		var first error
+		for {
+			select {
+			case row := <-b.rows:
+				batch = append(batch, row)
+				if len(batch) >= b.opts.flushSize {
+					if err := flush(ctx); err != nil && first == nil {
+						first = err
+					}
+				}
+			default:
+				if err := flush(ctx); err != nil && first == nil {
+					first = err
+				}
+				return first
+			}
+		}
+	}
+
+	for {
+		// stop before taking more rows once Close was called
+		select {
+		case <-b.done:
+			b.closeDrain(&batch)
+			return
+		default:
+		}
+
+		select {
+		case row := <-b.rows:
+			batch = append(batch, row)
+			if len(batch) >= b.opts.flushSize {
+				_ = flush(b.ctx)
+			}
+		case <-ticker.C:
+			_ = flush(b.ctx)
+		case reply := <-b.flushReq:
+			reply <- drain(b.ctx)
+		case <-b.done:
+			b.closeDrain(&batch)
+			return
+		}
+	}
+}
+
+// closeDrain writes the remaining rows with the Close context, counting
+// rows it cannot write as lost.
+func (b *BufferedInserter[T]) closeDrain(batch *[]T) {
+	ctx := b.closeCtx
+	for {
+		for len(*batch) < b.opts.flushSize {
+			select {
+			case row := <-b.rows:
+				*batch = append(*batch, row)
+				continue
+			default:
+			}
+			break
+		}
+		if len(*batch) == 0 {
+			return
+		}
+		n := int64(len(*batch))
+		if ctx.Err() != nil || b.insert(ctx, *batch) != nil {
+			b.lost.Add(n)
+		} else {
+			b.written.Add(n)
+		}
+		b.pending.Add(-n)
+		*batch = (*batch)[:0]
+	}
+}
+
+func (b *BufferedInserter[T]) write(ctx context.Context, batch []T) error {
+	n := int64(len(batch))
+	defer b.pending.Add(-n)
+	if err := b.insert(ctx, batch); err != nil {
+		b.failed.Add(n)
+		if b.opts.onError != nil {
+			b.opts.onError(err, len(batch))
+		}
+		return err
+	}
+	b.written.Add(n)
+	return nil
+}
+
+func (b *BufferedInserter[T]) insert(ctx context.Context, batch []T) error {
+	if _, err := BulkCopySlice(ctx, b.db, batch, b.opts.copyOpts...); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to write buffered rows").
+			WithMetadata(map[string]any{"rows": len(batch)})
+	}
+	return nil
+}
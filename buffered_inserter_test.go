@@ -0,0 +1,209 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type bufferedMetric struct {
+	bun.BaseModel `bun:"table:buffered_metrics"`
+
+	ID    int64   `bun:"id,pk,autoincrement"`
+	Name  string  `bun:"name"`
+	Value float64 `bun:"value"`
+}
+
+func TestBufferedInserter_FlushesBySizeAndOnClose(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err := db.NewCreateTable().Model((*bufferedMetric)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	ins := NewBufferedInserter[bufferedMetric](db, WithBufferFlushSize(10), WithBufferFlushInterval(time.Hour))
+	for i := 0; i < 25; i++ {
+		require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "latency", Value: float64(i)}))
+	}
+	require.NoError(t, ins.Flush(ctx))
+
+	count, err := db.NewSelect().Model((*bufferedMetric)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 25, count)
+
+	require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "latency"}))
+	require.NoError(t, ins.Close(ctx))
+	assert.ErrorIs(t, ins.Add(ctx, bufferedMetric{}), ErrInserterClosed)
+
+	stats := ins.Stats()
+	assert.EqualValues(t, 26, stats.Added)
+	assert.EqualValues(t, 26, stats.Written)
+	assert.Zero(t, stats.Pending)
+	assert.Zero(t, stats.Lost)
+}
+
+func TestBufferedInserter_FlushesOnInterval(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err := db.NewCreateTable().Model((*bufferedMetric)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	ins := NewBufferedInserter[bufferedMetric](db, WithBufferFlushInterval(10*time.Millisecond))
+	defer ins.Close(ctx)
+	require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "cpu"}))
+
+	assert.Eventually(t, func() bool { return ins.Stats().Written == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestBufferedInserter_Backpressure(t *testing.T) {
+	ctx := context.Background()
+	// no table: every write fails
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	var failed []int
+	ins := NewBufferedInserter[bufferedMetric](db,
+		WithBufferCapacity(2),
+		WithBufferFlushSize(100),
+		WithBufferFlushInterval(time.Hour),
+		WithBufferErrorHandler(func(err error, rows int) { failed = append(failed, rows) }),
+	)
+
+	// the loop may move rows out of the channel, keep adding until full
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = ins.Add(ctx, bufferedMetric{Name: "x"})
+	}
+	assert.ErrorIs(t, err, ErrBufferFull)
+	assert.EqualValues(t, 1, ins.Stats().Dropped)
+
+	assert.Error(t, ins.Flush(ctx))
+	require.Len(t, failed, 1)
+	assert.EqualValues(t, failed[0], ins.Stats().Failed)
+
+	// hold the only connection so the flush of the first row waits
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	blocking := NewBufferedInserter[bufferedMetric](db, WithBufferCapacity(1), WithBufferFlushSize(1),
+		WithBufferFlushInterval(time.Hour), WithBufferBlocking())
+	require.NoError(t, blocking.Add(ctx, bufferedMetric{}))
+	require.Eventually(t, func() bool { return len(blocking.rows) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, blocking.Add(ctx, bufferedMetric{}))
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, blocking.Add(timeout, bufferedMetric{}), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = tx.Rollback()
+	}()
+	err = blocking.Close(timeout)
+	assert.True(t, errors.Is(err, ErrRowsLost))
+	assert.Equal(t, BufferedInserterStats{Added: 2, Dropped: 1, Failed: 1, Lost: 1}, blocking.Stats())
+}
+
+// blockingInsertHook holds inserts until their context is done.
+type blockingInsertHook struct {
+	started chan struct{}
+}
+
+func (h blockingInsertHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if event.Operation() == "INSERT" {
+		select {
+		case h.started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+	}
+	return ctx
+}
+
+func (blockingInsertHook) AfterQuery(context.Context, *bun.QueryEvent) {}
+
+func TestBufferedInserter_CloseCancelsFlushAndBlockedAdds(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err := db.NewCreateTable().Model((*bufferedMetric)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	hook := blockingInsertHook{started: make(chan struct{}, 1)}
+	db.AddQueryHook(hook)
+
+	ins := NewBufferedInserter[bufferedMetric](db,
+		WithBufferCapacity(1),
+		WithBufferFlushSize(1),
+		WithBufferFlushInterval(time.Hour),
+		WithBufferBlocking(),
+	)
+
+	require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "a"}))
+	<-hook.started
+	require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "b"}))
+
+	// the writer is stuck and the buffer is full, so this Add blocks
+	blocked := make(chan error, 1)
+	go func() { blocked <- ins.Add(ctx, bufferedMetric{Name: "c"}) }()
+	assert.Never(t, func() bool { return len(blocked) > 0 }, 20*time.Millisecond, 5*time.Millisecond)
+
+	closeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() { closed <- ins.Close(closeCtx) }()
+
+	select {
+	case err := <-closed:
+		assert.ErrorIs(t, err, ErrRowsLost)
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+	}
+	assert.ErrorIs(t, <-blocked, ErrInserterClosed)
+
+	stats := ins.Stats()
+	assert.EqualValues(t, 2, stats.Added)
+	assert.EqualValues(t, 1, stats.Failed)
+	assert.EqualValues(t, 1, stats.Lost)
+	assert.Zero(t, stats.Pending)
+}
+
+func TestBufferedInserter_PendingNeverNegative(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err := db.NewCreateTable().Model((*bufferedMetric)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	ins := NewBufferedInserter[bufferedMetric](db, WithBufferFlushSize(1), WithBufferFlushInterval(time.Hour))
+	stop := make(chan struct{})
+	negative := make(chan int64, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if p := ins.Stats().Pending; p < 0 {
+				negative <- p
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		require.NoError(t, ins.Add(ctx, bufferedMetric{Name: "n"}))
+	}
+	require.NoError(t, ins.Close(ctx))
+	close(stop)
+
+	select {
+	case p := <-negative:
+		t.Fatalf("pending went negative: %d", p)
+	default:
+	}
+	assert.Zero(t, ins.Stats().Pending)
+}
@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const defaultCopyBatchSize = 1000
+
+// Copier streams rows into a table using a driver specific bulk protocol,
+// e.g. pgx CopyFrom or lib/pq CopyIn for COPY FROM STDIN on Postgres.
+type Copier interface {
+	CopyFrom(ctx context.Context, table string, columns []string, rows iter.Seq[[]any]) (int64, error)
+}
+
+// CopierFunc adapts a function to Copier
+type CopierFunc func(ctx context.Context, table string, columns []string, rows iter.Seq[[]any]) (int64, error)
+
+// CopyFrom implements Copier
+func (f CopierFunc) CopyFrom(ctx context.Context, table string, columns []string, rows iter.Seq[[]any]) (int64, error) {
+	return f(ctx, table, columns, rows)
+}
+
+// BulkCopyOption configures BulkCopy
+type BulkCopyOption func(*bulkCopyOptions)
+
+type bulkCopyOptions struct {
+	copier    Copier
+	batchSize int
+	columns   []string
+}
+
+// WithCopier uses copier to stream rows on Postgres instead of
+// batched inserts.
+func WithCopier(copier Copier) BulkCopyOption {
+	return func(o *bulkCopyOptions) {
+		o.copier = copier
+	}
+}
+
+// WithCopyBatchSize sets the number of rows per INSERT in the fallback path.
+func WithCopyBatchSize(n int) BulkCopyOption {
+	return func(o *bulkCopyOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithCopyColumns restricts the copied columns. By default all columns
+// except auto increment primary keys are copied.
+func WithCopyColumns(columns ...string) BulkCopyOption {
+	return func(o *bulkCopyOptions) {
+		o.columns = append(o.columns, columns...)
+	}
+}
+
+// BulkCopy loads rows into the table of T and returns the number of
+// rows written. On Postgres with a Copier configured it uses COPY FROM
+// STDIN, which is much faster than INSERT batches for large loads. On
+// other dialects, or without a Copier, rows are written with batched
+// multi row inserts that stay under the dialect parameter limits.
+func BulkCopy[T any](ctx context.Context, db bun.IDB, rows iter.Seq[T], opts ...BulkCopyOption) (int64, error) {
+	options := bulkCopyOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	table := db.Dialect().Tables().Get(reflect.TypeOf((*T)(nil)).Elem())
+	fields, err := bulkCopyFields(table, options.columns)
+	if err != nil {
+		return 0, err
+	}
+
+	if options.copier != nil && db.Dialect().Name() == dialect.PG {
+		columns := make([]string, len(fields))
+		for i, field := range fields {
+			columns[i] = field.Name
+		}
+		values := func(yield func([]any) bool) {
+			for row := range rows {
+				v := reflect.ValueOf(&row).Elem()
+				out := make([]any, len(fields))
+				for i, field := range fields {
+					out[i] = field.Value(v).Interface()
+				}
+				if !yield(out) {
+					return
+				}
+			}
+		}
+		n, err := options.copier.CopyFrom(ctx, string(table.Name), columns, values)
+		if err != nil {
+			return n, fmt.Errorf("persistence: copy into %s: %w", table.Name, err)
+		}
+		return n, nil
+	}
+
+	batchSize := options.batchSize
+	if batchSize <= 0 {
+		batchSize = defaultCopyBatchSize
+		if db.Dialect().Name() == dialect.SQLite {
+			batchSize = max(1, sqliteMaxChunkSize/max(1, len(fields)))
+		}
+	}
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.Name
+	}
+
+	var total int64
+	batch := make([]T, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		q := db.NewInsert().Model(&batch)
+		if len(options.columns) > 0 {
+			q = q.Column(columns...)
+		}
+		res, err := q.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("persistence: bulk insert into %s: %w", table.Name, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			n = int64(len(batch))
+		}
+		total += n
+		batch = batch[:0]
+		return nil
+	}
+
+	for row := range rows {
+		batch = append(batch, row)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// BulkCopySlice is BulkCopy for an in memory slice.
+func BulkCopySlice[T any](ctx context.Context, db bun.IDB, rows []T, opts ...BulkCopyOption) (int64, error) {
+	return BulkCopy(ctx, db, func(yield func(T) bool) {
+		for _, row := range rows {
+			if !yield(row) {
+				return
+			}
+		}
+	}, opts...)
+}
+
+func bulkCopyFields(table *schema.Table, columns []string) ([]*schema.Field, error) {
+	if len(columns) == 0 {
+		fields := make([]*schema.Field, 0, len(table.Fields))
+		for _, field := range table.Fields {
+			if field.AutoIncrement || field.Tag.HasOption("scanonly") {
+				continue
+			}
+			fields = append(fields, field)
+		}
+		return fields, nil
+	}
+
+	fields := make([]*schema.Field, 0, len(columns))
+	for _, column := range columns {
+		field, ok := table.FieldMap[column]
+		if !ok {
+			return nil, fmt.Errorf("persistence: bulk copy: unknown column %q on %s", column, table.Name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
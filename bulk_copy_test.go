@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	"context"
+	"iter"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type copyItem struct {
+	bun.BaseModel `bun:"table:copy_items"`
+
+	ID   int64  `bun:"id,pk,autoincrement"`
+	Name string `bun:"name"`
+}
+
+func TestBulkCopy_SQLiteBatchedInserts(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*copyItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	rows := func(yield func(copyItem) bool) {
+		for i := 0; i < 25; i++ {
+			if !yield(copyItem{Name: "item"}) {
+				return
+			}
+		}
+	}
+
+	n, err := BulkCopy(ctx, db, rows, WithCopyBatchSize(10))
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), n)
+
+	count, err := db.NewSelect().Model((*copyItem)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 25, count)
+}
+
+func TestBulkCopy_PostgresUsesCopier(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	var gotTable string
+	var gotColumns []string
+	var gotRows [][]any
+	copier := CopierFunc(func(ctx context.Context, table string, columns []string, rows iter.Seq[[]any]) (int64, error) {
+		gotTable = table
+		gotColumns = columns
+		for row := range rows {
+			gotRows = append(gotRows, row)
+		}
+		return int64(len(gotRows)), nil
+	})
+
+	n, err := BulkCopySlice(ctx, db, []copyItem{{Name: "a"}, {Name: "b"}}, WithCopier(copier))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "copy_items", gotTable)
+	assert.Equal(t, []string{"name"}, gotColumns)
+	assert.Equal(t, [][]any{{"a"}, {"b"}}, gotRows)
+}
@@ -1,13 +1,18 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/extra/bundebug"
@@ -25,15 +30,22 @@ type QueryHookKeyer interface {
 // QueryHookErrorHandler handles invalid query hook registrations.
 type QueryHookErrorHandler func(db *bun.DB, hook bun.QueryHook, err error)
 
+// QueryHookUnwrapper is implemented by hooks that wrap another hook.
+type QueryHookUnwrapper interface {
+	UnwrapQueryHook() bun.QueryHook
+}
+
 var (
 	ErrQueryHookNil        = errors.New("query hook is nil")
 	ErrQueryHookNilPointer = errors.New("query hook is a nil pointer")
+	ErrQueryHookPanic      = errors.New("query hook panicked")
 )
 
 const (
 	defaultQueryHookPriority = 0
 	defaultBundebugPriority  = 10
 	defaultBunotelPriority   = 20
+	defaultQueryLogPriority  = 30
 )
 
 type hookEntry struct {
@@ -54,6 +66,33 @@ type clientOptions struct {
 	bunotelEnabled  bool
 	bunotelPriority int
 	bunotelOrder    int
+
+	lazyConnect    bool
+	startupRetries int
+	startupBackoff time.Duration
+
+	logSampling      int
+	logFields        map[string]any
+	queryLogEnabled  bool
+	queryLogPriority int
+	queryLogOrder    int
+
+	statementCacheSize int
+
+	migrationHistory bool
+	outOfOrderPolicy OutOfOrderPolicy
+	noopErrors       bool
+
+	pools              map[string]PoolConfig
+	credentialProvider CredentialProvider
+	credentialOptions  []CredentialOption
+	tls                *TLSConfig
+	failoverTargets    []string
+	failoverOptions    []FailoverOption
+	replicaRouting     bool
+
+	guardrails  *guardrailOptions
+	slowQueries *slowQueryOptions
 }
 
 // WithQueryHooks registers custom query hooks with default priority.
@@ -114,6 +153,119 @@ func WithBunotel() ClientOption {
 	}
 }
 
+// WithLazyConnect defers the initial connection check from New to Start.
+// Useful when the client is constructed before the database is reachable.
+func WithLazyConnect() ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.lazyConnect = true
+	}
+}
+
+// WithStartupRetry retries the startup connection check up to n times,
+// waiting backoff before the first retry and doubling it after each failure.
+func WithStartupRetry(n int, backoff time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		if n < 0 {
+			n = 0
+		}
+		if backoff < 0 {
+			backoff = 0
+		}
+		opts.startupRetries = n
+		opts.startupBackoff = backoff
+	}
+}
+
+// WithQueryLogging logs every query through the client Logger
+// at debug level with operation and duration fields.
+func WithQueryLogging() ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.hookOrder++
+		opts.queryLogEnabled = true
+		opts.queryLogPriority = defaultQueryLogPriority
+		opts.queryLogOrder = opts.hookOrder
+	}
+}
+
+// WithLogSampling emits only 1 of every n identical debug lines.
+func WithLogSampling(n int) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.logSampling = n
+	}
+}
+
+// WithLogFields adds structured fields, e.g. the database name,
+// to every line logged by the client, migrations and fixtures.
+func WithLogFields(fields map[string]any) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		if opts.logFields == nil {
+			opts.logFields = make(map[string]any, len(fields))
+		}
+		for k, v := range fields {
+			opts.logFields[k] = v
+		}
+	}
+}
+
+// WithStatementCache keeps up to size prepared statements for the
+// named queries registered with Client.Statements.
+func WithStatementCache(size int) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.statementCacheSize = size
+	}
+}
+
+// WithMigrationHistory records every migration run in the migration
+// history table, see Migrations.EnableHistory.
+func WithMigrationHistory() ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.migrationHistory = true
+	}
+}
+
+// WithOutOfOrderPolicy sets how Migrate handles pending migrations that
+// sort before the latest applied one.
+func WithOutOfOrderPolicy(policy OutOfOrderPolicy) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.outOfOrderPolicy = policy
+	}
+}
+
+// WithMigrationNoopErrors makes Migrate, Rollback and RollbackAll return
+// ErrNothingToMigrate and ErrNothingToRollback when there is nothing to do.
+func WithMigrationNoopErrors() ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		opts.noopErrors = true
+	}
+}
+
 // LogQueryHookErrorHandler logs and skips invalid query hooks.
 func LogQueryHookErrorHandler(db *bun.DB, hook bun.QueryHook, err error) {
 	log.Printf("persistence: query hook skipped: %v (type=%T)", err, hook)
@@ -128,10 +280,27 @@ type hookRegistryEntry struct {
 	mu      sync.Mutex
 	keys    map[string]struct{}
 	handler QueryHookErrorHandler
+	hooks   []*managedQueryHook
 }
 
+// hookRegistry maps weak pointers to each *bun.DB to its
+// *hookRegistryEntry, so the registry alone does not keep a db alive.
+// Entries are dropped by ReleaseHooks, Client.Close, or when the db is
+// garbage collected.
 var hookRegistry sync.Map
 
+// ReleaseHooks drops the registration bookkeeping of the query hooks on
+// db: the keys deduplicating them, the error handler and the data behind
+// Client.HookDiagnostics. The hooks stay attached to db. Client.Close
+// calls it for its databases; call it for a db that is discarded while
+// something still references it, e.g. in tests or per tenant pools.
+func ReleaseHooks(db *bun.DB) {
+	if db == nil {
+		return
+	}
+	hookRegistry.Delete(weak.Make(db))
+}
+
 func applyQueryHooks(db *bun.DB, cfg Config, opts *clientOptions) {
 	if db == nil || opts == nil {
 		return
@@ -158,6 +327,12 @@ func applyQueryHooks(db *bun.DB, cfg Config, opts *clientOptions) {
 				priority: opts.bunotelPriority,
 				order:    opts.bunotelOrder,
 			})
+			// right after bunotel, so its span is open around the hook
+			entries = append(entries, hookEntry{
+				hook:     spanMetricsHook{},
+				priority: opts.bunotelPriority + 1,
+				order:    opts.bunotelOrder,
+			})
 		}
 	}
 
@@ -172,11 +347,7 @@ func applyQueryHooks(db *bun.DB, cfg Config, opts *clientOptions) {
 		return entries[i].priority < entries[j].priority
 	})
 
-	hooks := make([]bun.QueryHook, 0, len(entries))
-	for _, entry := range entries {
-		hooks = append(hooks, entry.hook)
-	}
-	registerQueryHooks(db, hooks...)
+	registerQueryHooks(db, entries...)
 }
 
 func bundebugHook(cfg Config) bun.QueryHook {
@@ -200,7 +371,7 @@ func bunotelHook(cfg Config) bun.QueryHook {
 	return bunotel.NewQueryHook(bunotel.WithDBName(identifier))
 }
 
-func registerQueryHooks(db *bun.DB, hooks ...bun.QueryHook) {
+func registerQueryHooks(db *bun.DB, hooks ...hookEntry) {
 	if db == nil || len(hooks) == 0 {
 		return
 	}
@@ -217,10 +388,10 @@ func registerQueryHooks(db *bun.DB, hooks ...bun.QueryHook) {
 		handler = LogQueryHookErrorHandler
 	}
 
-	validHooks := make([]bun.QueryHook, 0, len(hooks))
+	validHooks := make([]hookEntry, 0, len(hooks))
 	for _, hook := range hooks {
-		if err := validateQueryHook(hook); err != nil {
-			handler(db, hook, err)
+		if err := validateQueryHook(hook.hook); err != nil {
+			handler(db, hook.hook, err)
 			continue
 		}
 		validHooks = append(validHooks, hook)
@@ -235,7 +406,8 @@ func registerQueryHooks(db *bun.DB, hooks ...bun.QueryHook) {
 	defer entry.mu.Unlock()
 
 	for _, hook := range validHooks {
-		if key, ok := queryHookKey(hook); ok {
+		key, ok := queryHookKey(hook.hook)
+		if ok {
 			if _, seen := localKeys[key]; seen {
 				continue
 			}
@@ -245,25 +417,178 @@ func registerQueryHooks(db *bun.DB, hooks ...bun.QueryHook) {
 			localKeys[key] = struct{}{}
 			entry.keys[key] = struct{}{}
 		}
-		db.AddQueryHook(hook)
+		managed := &managedQueryHook{
+			hook:     hook.hook,
+			db:       weak.Make(db),
+			key:      key,
+			priority: hook.priority,
+			order:    len(entry.hooks) + 1,
+		}
+		entry.hooks = append(entry.hooks, managed)
+		db.AddQueryHook(managed)
+	}
+}
+
+// UnwrapQueryHook returns the innermost hook of a chain of wrappers.
+func UnwrapQueryHook(hook bun.QueryHook) bun.QueryHook {
+	for {
+		unwrapper, ok := hook.(QueryHookUnwrapper)
+		if !ok {
+			return hook
+		}
+		inner := unwrapper.UnwrapQueryHook()
+		if inner == nil {
+			return hook
+		}
+		hook = inner
+	}
+}
+
+// managedQueryHook wraps every registered hook. It recovers panics
+// raised by the wrapped hook, reporting them through the
+// QueryHookErrorHandler, and records timing for diagnostics.
+type managedQueryHook struct {
+	hook bun.QueryHook
+	// db is weak so the registry entry holding the hook does not keep
+	// the db alive
+	db       weak.Pointer[bun.DB]
+	key      string
+	priority int
+	order    int
+
+	calls    atomic.Int64
+	panics   atomic.Int64
+	duration atomic.Int64
+}
+
+func (h *managedQueryHook) UnwrapQueryHook() bun.QueryHook {
+	return h.hook
+}
+
+// Init forwards bun's hook initialization to the wrapped hook.
+func (h *managedQueryHook) Init(db *bun.DB) {
+	if initer, ok := h.hook.(interface{ Init(*bun.DB) }); ok {
+		initer.Init(db)
+	}
+}
+
+func (h *managedQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) (out context.Context) {
+	out = ctx
+	h.calls.Add(1)
+	defer h.track(time.Now())
+	defer h.recover()
+	return h.hook.BeforeQuery(ctx, event)
+}
+
+func (h *managedQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	defer h.track(time.Now())
+	defer h.recover()
+	h.hook.AfterQuery(ctx, event)
+}
+
+func (h *managedQueryHook) track(start time.Time) {
+	h.duration.Add(int64(time.Since(start)))
+}
+
+func (h *managedQueryHook) recover() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	h.panics.Add(1)
+
+	db := h.db.Value()
+	handler := LogQueryHookErrorHandler
+	if entry := lookupHookRegistryEntry(db); entry != nil {
+		entry.mu.Lock()
+		if entry.handler != nil {
+			handler = entry.handler
+		}
+		entry.mu.Unlock()
+	}
+	handler(db, h.hook, fmt.Errorf("%w: %v", ErrQueryHookPanic, recovered))
+}
+
+func (h *managedQueryHook) diagnostic() QueryHookDiagnostic {
+	return QueryHookDiagnostic{
+		Type:          fmt.Sprintf("%T", UnwrapQueryHook(h.hook)),
+		Key:           h.key,
+		Priority:      h.priority,
+		Order:         h.order,
+		Calls:         h.calls.Load(),
+		Panics:        h.panics.Load(),
+		TotalDuration: time.Duration(h.duration.Load()),
 	}
 }
 
+// QueryHookDiagnostic describes a registered query hook
+// and its cumulative cost.
+type QueryHookDiagnostic struct {
+	Type          string
+	Key           string
+	Priority      int
+	Order         int
+	Calls         int64
+	Panics        int64
+	TotalDuration time.Duration
+}
+
+// AverageDuration returns the mean time spent in the hook per query.
+func (d QueryHookDiagnostic) AverageDuration() time.Duration {
+	if d.Calls == 0 {
+		return 0
+	}
+	return d.TotalDuration / time.Duration(d.Calls)
+}
+
+func queryHookDiagnostics(db *bun.DB) []QueryHookDiagnostic {
+	entry := lookupHookRegistryEntry(db)
+	if entry == nil {
+		return nil
+	}
+	entry.mu.Lock()
+	hooks := append([]*managedQueryHook(nil), entry.hooks...)
+	entry.mu.Unlock()
+
+	out := make([]QueryHookDiagnostic, 0, len(hooks))
+	for _, hook := range hooks {
+		out = append(out, hook.diagnostic())
+	}
+	return out
+}
+
 func getHookRegistryEntry(db *bun.DB) *hookRegistryEntry {
 	if db == nil {
 		return nil
 	}
-	if entry, ok := hookRegistry.Load(db); ok {
-		return entry.(*hookRegistryEntry)
+	if entry := lookupHookRegistryEntry(db); entry != nil {
+		return entry
 	}
 	entry := &hookRegistryEntry{
 		keys:    make(map[string]struct{}),
 		handler: LogQueryHookErrorHandler,
 	}
-	actual, _ := hookRegistry.LoadOrStore(db, entry)
+	key := weak.Make(db)
+	actual, loaded := hookRegistry.LoadOrStore(key, entry)
+	if !loaded {
+		// the cleanup must not reference db, or it would never run
+		runtime.AddCleanup(db, func(key weak.Pointer[bun.DB]) {
+			hookRegistry.CompareAndDelete(key, entry)
+		}, key)
+	}
 	return actual.(*hookRegistryEntry)
 }
 
+func lookupHookRegistryEntry(db *bun.DB) *hookRegistryEntry {
+	if db == nil {
+		return nil
+	}
+	if entry, ok := hookRegistry.Load(weak.Make(db)); ok {
+		return entry.(*hookRegistryEntry)
+	}
+	return nil
+}
+
 func setQueryHookErrorHandler(db *bun.DB, handler QueryHookErrorHandler) {
 	if db == nil {
 		return
@@ -2,11 +2,14 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"reflect"
+	"runtime"
 	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
+	"weak"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
@@ -129,7 +132,7 @@ func getQueryHooks(db *bun.DB) []bun.QueryHook {
 func hookOrderNames(hooks []bun.QueryHook) []string {
 	names := make([]string, 0, len(hooks))
 	for _, hook := range hooks {
-		switch h := hook.(type) {
+		switch h := UnwrapQueryHook(hook).(type) {
 		case *orderHook:
 			names = append(names, h.id)
 		case *bundebug.QueryHook:
@@ -249,9 +252,10 @@ func TestQueryHooks_BuiltinsOptIn(t *testing.T) {
 		defer cleanup()
 
 		hooks := getQueryHooks(client.DB())
-		assert.Len(t, hooks, 2)
+		assert.Len(t, hooks, 3)
 		assert.Contains(t, hookOrderNames(hooks), "bundebug")
 		assert.Contains(t, hookOrderNames(hooks), "bunotel")
+		assert.Contains(t, hookOrderNames(hooks), "persistence.spanMetricsHook")
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
@@ -279,6 +283,189 @@ func TestQueryHooks_OrderAndPriority(t *testing.T) {
 	defer cleanup()
 
 	hooks := getQueryHooks(client.DB())
-	assert.Equal(t, []string{"A", "C", "B", "bundebug", "bunotel"}, hookOrderNames(hooks))
+	assert.Equal(t, []string{"A", "C", "B", "bundebug", "bunotel", "persistence.spanMetricsHook"}, hookOrderNames(hooks))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestWithLazyConnect_DefersPingToStart(t *testing.T) {
+	defer resetInit()
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	client, err := New(cfg, db, pgdialect.New(), WithLazyConnect())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectPing()
+	require.NoError(t, client.Start(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithStartupRetry_RetriesPing(t *testing.T) {
+	defer resetInit()
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	_, err = New(cfg, db, pgdialect.New(), WithStartupRetry(2, time.Millisecond))
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithStartupRetry_GivesUp(t *testing.T) {
+	defer resetInit()
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	pingErr := errors.New("connection refused")
+	mock.ExpectPing().WillReturnError(pingErr)
+	mock.ExpectPing().WillReturnError(pingErr)
+
+	_, err = New(cfg, db, pgdialect.New(), WithStartupRetry(1, time.Millisecond))
+	assert.ErrorIs(t, err, pingErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type panickingHook struct {
+	inBefore bool
+}
+
+func (h *panickingHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if h.inBefore {
+		panic("before boom")
+	}
+	return ctx
+}
+
+func (h *panickingHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if !h.inBefore {
+		panic("after boom")
+	}
+}
+
+func TestQueryHooks_RecoversPanics(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+
+	var errs []error
+	handler := func(db *bun.DB, hook bun.QueryHook, err error) {
+		errs = append(errs, err)
+	}
+
+	before := &panickingHook{inBefore: true}
+	after := &panickingHook{}
+	counting := &countingHook{}
+
+	client, mock, cleanup := newTestClient(
+		t,
+		cfg,
+		WithQueryHookErrorHandler(handler),
+		WithQueryHooks(before, after, counting),
+	)
+	defer cleanup()
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"value"}).AddRow(1),
+	)
+
+	var out int
+	err := client.DB().NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, out)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counting.before))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counting.after))
+	if assert.Len(t, errs, 2) {
+		assert.ErrorIs(t, errs[0], ErrQueryHookPanic)
+		assert.Contains(t, errs[0].Error(), "before boom")
+		assert.ErrorIs(t, errs[1], ErrQueryHookPanic)
+		assert.Contains(t, errs[1].Error(), "after boom")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClient_HookDiagnostics(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+
+	hookA := &keyedHook{key: "a"}
+	hookB := &orderHook{id: "B"}
+
+	client, mock, cleanup := newTestClient(
+		t,
+		cfg,
+		WithQueryHooksPriority(5, hookB),
+		WithQueryHooks(hookA),
+	)
+	defer cleanup()
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"value"}).AddRow(1),
+	)
+	var out int
+	require.NoError(t, client.DB().NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out))
+
+	diags := client.HookDiagnostics()
+	require.Len(t, diags, 2)
+
+	assert.Equal(t, "*persistence.keyedHook", diags[0].Type)
+	assert.Equal(t, "*persistence.keyedHook:a", diags[0].Key)
+	assert.Equal(t, 0, diags[0].Priority)
+	assert.Equal(t, 1, diags[0].Order)
+	assert.Equal(t, int64(1), diags[0].Calls)
+
+	assert.Equal(t, "*persistence.orderHook", diags[1].Type)
+	assert.Equal(t, 5, diags[1].Priority)
+	assert.Equal(t, 2, diags[1].Order)
+	assert.Equal(t, int64(1), diags[1].Calls)
+	assert.Equal(t, diags[1].TotalDuration/time.Duration(diags[1].Calls), diags[1].AverageDuration())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseHooks_OnClose(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	client, mock, cleanup := newTestClient(t, cfg, WithQueryHooks(&countingHook{}))
+	defer cleanup()
+
+	require.Len(t, client.HookDiagnostics(), 1)
+	mock.ExpectClose()
+	require.NoError(t, client.Close())
+
+	assert.Nil(t, lookupHookRegistryEntry(client.DB()))
+	assert.Empty(t, client.HookDiagnostics())
+}
+
+func TestReleaseHooks_AllowsRegisteringAgain(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	hook := &countingHook{}
+	registerQueryHooks(db, hookEntry{hook: hook})
+	ReleaseHooks(db)
+	ReleaseHooks(nil)
+
+	registerQueryHooks(db, hookEntry{hook: hook})
+	assert.Len(t, queryHookDiagnostics(db), 1)
+}
+
+func TestHookRegistry_DroppedWhenDBCollected(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	registerQueryHooks(db, hookEntry{hook: &countingHook{}})
+	key := weak.Make(db)
+	_, ok := hookRegistry.Load(key)
+	require.True(t, ok)
+	db = nil
+
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		_, ok := hookRegistry.Load(key)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// ErrEntityNotFound is the cause of update and delete commands that
+// match no row.
+var ErrEntityNotFound = errors.New("persistence: entity not found")
+
+// Message types of the entity commands and queries, returned by their
+// Type method as go-command messages expect.
+const (
+	CreateEntityMessage = "persistence.entity.create"
+	UpdateEntityMessage = "persistence.entity.update"
+	DeleteEntityMessage = "persistence.entity.delete"
+	QueryEntityMessage  = "persistence.entity.query"
+)
+
+// CreateEntityCommand inserts Entity.
+type CreateEntityCommand[T any] struct {
+	Entity *T
+}
+
+// Type implements the go-command message interface.
+func (CreateEntityCommand[T]) Type() string { return CreateEntityMessage }
+
+// UpdateEntityCommand updates Entity by primary key, only Columns when
+// set.
+type UpdateEntityCommand[T any] struct {
+	Entity  *T
+	Columns []string
+}
+
+// Type implements the go-command message interface.
+func (UpdateEntityCommand[T]) Type() string { return UpdateEntityMessage }
+
+// DeleteEntityCommand deletes Entity by primary key.
+type DeleteEntityCommand[T any] struct {
+	Entity *T
+}
+
+// Type implements the go-command message interface.
+func (DeleteEntityCommand[T]) Type() string { return DeleteEntityMessage }
+
+// QueryEntityCriteria lists the entities matching Spec, every entity
+// when Spec is nil. OrderBy lists columns, "-" prefixed for descending.
+type QueryEntityCriteria[T any] struct {
+	Spec    Specification[*T]
+	OrderBy []string
+	Limit   int
+	Offset  int
+}
+
+// Type implements the go-command message interface.
+func (QueryEntityCriteria[T]) Type() string { return QueryEntityMessage }
+
+// EntityCommandHandler executes the entity commands of T. Create,
+// Update and Delete have the signature of go-command's Execute, so each
+// can be registered on the command bus for its message type as a
+// command function. Commands join the transaction in ctx, see
+// ContextWithTx.
+type EntityCommandHandler[T any] struct {
+	db bun.IDB
+}
+
+// NewEntityCommandHandler creates a command handler for T on db.
+func NewEntityCommandHandler[T any](db bun.IDB) *EntityCommandHandler[T] {
+	return &EntityCommandHandler[T]{db: db}
+}
+
+// Create executes a CreateEntityCommand.
+func (h *EntityCommandHandler[T]) Create(ctx context.Context, msg CreateEntityCommand[T]) error {
+	if _, err := IDBFromContext(ctx, h.db).NewInsert().Model(msg.Entity).Returning("*").Exec(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create entity")
+	}
+	return nil
+}
+
+// Update executes an UpdateEntityCommand.
+func (h *EntityCommandHandler[T]) Update(ctx context.Context, msg UpdateEntityCommand[T]) error {
+	q := IDBFromContext(ctx, h.db).NewUpdate().Model(msg.Entity).WherePK()
+	if len(msg.Columns) > 0 {
+		q = q.Column(msg.Columns...)
+	}
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to update entity")
+	}
+	return entityAffected(res)
+}
+
+// Delete executes a DeleteEntityCommand.
+func (h *EntityCommandHandler[T]) Delete(ctx context.Context, msg DeleteEntityCommand[T]) error {
+	res, err := IDBFromContext(ctx, h.db).NewDelete().Model(msg.Entity).WherePK().Exec(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to delete entity")
+	}
+	return entityAffected(res)
+}
+
+func entityAffected(res interface{ RowsAffected() (int64, error) }) error {
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return apierrors.Wrap(ErrEntityNotFound, apierrors.CategoryNotFound, "entity not found")
+	}
+	return nil
+}
+
+// EntityQueryHandler answers QueryEntityCriteria for T. Query matches
+// go-command's Querier.
+type EntityQueryHandler[T any] struct {
+	db bun.IDB
+}
+
+// NewEntityQueryHandler creates a query handler for T on db.
+func NewEntityQueryHandler[T any](db bun.IDB) *EntityQueryHandler[T] {
+	return &EntityQueryHandler[T]{db: db}
+}
+
+// Query executes a QueryEntityCriteria.
+func (h *EntityQueryHandler[T]) Query(ctx context.Context, msg QueryEntityCriteria[T]) ([]T, error) {
+	var out []T
+	q := IDBFromContext(ctx, h.db).NewSelect().Model(&out)
+	if msg.Spec != nil {
+		q = ApplySpecification(q, msg.Spec)
+	}
+	for _, order := range msg.OrderBy {
+		dir := "ASC"
+		if column, ok := strings.CutPrefix(order, "-"); ok {
+			order, dir = column, "DESC"
+		}
+		ident, err := SafeIdent(order)
+		if err != nil {
+			return nil, err
+		}
+		q = q.OrderExpr("? "+dir, ident)
+	}
+	if msg.Limit > 0 {
+		q = q.Limit(msg.Limit)
+	}
+	if msg.Offset > 0 {
+		q = q.Offset(msg.Offset)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to query entities")
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type commandWidget struct {
+	bun.BaseModel `bun:"table:command_widgets"`
+
+	ID    int64  `bun:"id,pk,autoincrement"`
+	Name  string `bun:"name"`
+	Color string `bun:"color"`
+}
+
+func TestEntityCommandAndQueryHandlers(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*commandWidget)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	commands := NewEntityCommandHandler[commandWidget](db)
+	queries := NewEntityQueryHandler[commandWidget](db)
+
+	assert.Equal(t, CreateEntityMessage, CreateEntityCommand[commandWidget]{}.Type())
+	for _, w := range []*commandWidget{{Name: "a", Color: "red"}, {Name: "b", Color: "blue"}, {Name: "c", Color: "red"}} {
+		require.NoError(t, commands.Create(ctx, CreateEntityCommand[commandWidget]{Entity: w}))
+		assert.NotZero(t, w.ID)
+	}
+
+	red := NewSpecification(func(w *commandWidget) bool { return w.Color == "red" }, "? = ?", bun.Ident("color"), "red")
+	widgets, err := queries.Query(ctx, QueryEntityCriteria[commandWidget]{Spec: red, OrderBy: []string{"-name"}})
+	require.NoError(t, err)
+	require.Len(t, widgets, 2)
+	assert.Equal(t, "c", widgets[0].Name)
+
+	widgets[0].Color = "green"
+	widgets[0].Name = "ignored"
+	require.NoError(t, commands.Update(ctx, UpdateEntityCommand[commandWidget]{Entity: &widgets[0], Columns: []string{"color"}}))
+
+	all, err := queries.Query(ctx, QueryEntityCriteria[commandWidget]{OrderBy: []string{"id"}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, "c", all[2].Name)
+	assert.Equal(t, "green", all[2].Color)
+
+	require.NoError(t, commands.Delete(ctx, DeleteEntityCommand[commandWidget]{Entity: &all[0]}))
+	err = commands.Delete(ctx, DeleteEntityCommand[commandWidget]{Entity: &all[0]})
+	assert.True(t, errors.Is(err, ErrEntityNotFound))
+
+	_, err = queries.Query(ctx, QueryEntityCriteria[commandWidget]{OrderBy: []string{"name; DROP TABLE command_widgets"}})
+	assert.True(t, errors.Is(err, ErrUnsafeIdentifier))
+}
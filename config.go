@@ -0,0 +1,141 @@
+package persistence
+
+import "time"
+
+// DefaultPingTimeout is the ping timeout used by NewConfig
+const DefaultPingTimeout = 5 * time.Second
+
+// BasicConfig is a ready to use Config implementation
+// for callers that do not rely on a config framework.
+type BasicConfig struct {
+	Debug             bool
+	Driver            string
+	Server            string
+	DSN               string
+	PingTimeout       time.Duration
+	OtelIdentifier    string
+	MigrationsEnabled bool
+	SeedsEnabled      bool
+}
+
+// ConfigOption configures a BasicConfig
+type ConfigOption func(*BasicConfig)
+
+// NewConfig builds a Config using functional options.
+// Migrations and seeds are enabled by default.
+//
+//	cfg := persistence.NewConfig(
+//		persistence.WithDSN("postgres://localhost:5432/app"),
+//		persistence.WithDebug(),
+//	)
+func NewConfig(opts ...ConfigOption) *BasicConfig {
+	cfg := &BasicConfig{
+		Driver:            DefaultDriver,
+		PingTimeout:       DefaultPingTimeout,
+		MigrationsEnabled: true,
+		SeedsEnabled:      true,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithDebug enables debug mode
+func WithDebug() ConfigOption {
+	return func(c *BasicConfig) {
+		c.Debug = true
+	}
+}
+
+// WithDriver sets the database driver name
+func WithDriver(driver string) ConfigOption {
+	return func(c *BasicConfig) {
+		c.Driver = driver
+	}
+}
+
+// WithServer sets the database server address
+func WithServer(server string) ConfigOption {
+	return func(c *BasicConfig) {
+		c.Server = server
+	}
+}
+
+// WithDSN sets the connection string
+func WithDSN(dsn string) ConfigOption {
+	return func(c *BasicConfig) {
+		c.DSN = dsn
+	}
+}
+
+// WithPingTimeout sets the connection ping timeout
+func WithPingTimeout(timeout time.Duration) ConfigOption {
+	return func(c *BasicConfig) {
+		c.PingTimeout = timeout
+	}
+}
+
+// WithOtelIdentifier sets the OpenTelemetry DB name
+func WithOtelIdentifier(identifier string) ConfigOption {
+	return func(c *BasicConfig) {
+		c.OtelIdentifier = identifier
+	}
+}
+
+// WithMigrationsEnabled toggles migrations
+func WithMigrationsEnabled(enabled bool) ConfigOption {
+	return func(c *BasicConfig) {
+		c.MigrationsEnabled = enabled
+	}
+}
+
+// WithSeedsEnabled toggles seeds
+func WithSeedsEnabled(enabled bool) ConfigOption {
+	return func(c *BasicConfig) {
+		c.SeedsEnabled = enabled
+	}
+}
+
+// GetDebug returns the debug flag
+func (c *BasicConfig) GetDebug() bool {
+	return c.Debug
+}
+
+// GetDriver returns the driver name
+func (c *BasicConfig) GetDriver() string {
+	return c.Driver
+}
+
+// GetServer returns the server address
+func (c *BasicConfig) GetServer() string {
+	return c.Server
+}
+
+// GetDSN returns the connection string
+func (c *BasicConfig) GetDSN() string {
+	return c.DSN
+}
+
+// GetPingTimeout returns the ping timeout
+func (c *BasicConfig) GetPingTimeout() time.Duration {
+	return c.PingTimeout
+}
+
+// GetOtelIdentifier returns the OpenTelemetry DB name
+func (c *BasicConfig) GetOtelIdentifier() string {
+	return c.OtelIdentifier
+}
+
+// GetMigrationsEnabled returns true if migrations should run
+func (c *BasicConfig) GetMigrationsEnabled() bool {
+	return c.MigrationsEnabled
+}
+
+// GetSeedsEnabled returns true if seeds should run
+func (c *BasicConfig) GetSeedsEnabled() bool {
+	return c.SeedsEnabled
+}
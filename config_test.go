@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestNewConfig_Defaults(t *testing.T) {
+	cfg := NewConfig()
+
+	assert.Equal(t, DefaultDriver, cfg.GetDriver())
+	assert.Equal(t, DefaultPingTimeout, cfg.GetPingTimeout())
+	assert.False(t, cfg.GetDebug())
+	assert.True(t, cfg.GetMigrationsEnabled())
+	assert.True(t, cfg.GetSeedsEnabled())
+}
+
+func TestNewConfig_Options(t *testing.T) {
+	cfg := NewConfig(
+		WithDSN("postgres://localhost:5432/app"),
+		WithDebug(),
+		WithDriver("sqlite"),
+		WithServer("localhost:5432"),
+		WithPingTimeout(time.Second),
+		WithOtelIdentifier("app-db"),
+		WithMigrationsEnabled(false),
+		WithSeedsEnabled(false),
+		nil,
+	)
+
+	assert.Equal(t, "postgres://localhost:5432/app", cfg.GetDSN())
+	assert.True(t, cfg.GetDebug())
+	assert.Equal(t, "sqlite", cfg.GetDriver())
+	assert.Equal(t, "localhost:5432", cfg.GetServer())
+	assert.Equal(t, time.Second, cfg.GetPingTimeout())
+	assert.Equal(t, "app-db", cfg.GetOtelIdentifier())
+	assert.False(t, cfg.GetMigrationsEnabled())
+	assert.False(t, cfg.GetSeedsEnabled())
+}
+
+func TestNewConfig_UsableWithNew(t *testing.T) {
+	defer resetInit()
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing()
+
+	client, err := New(NewConfig(WithSeedsEnabled(false)), db, pgdialect.New())
+	require.NoError(t, err)
+	assert.False(t, client.seedsEnabled)
+	assert.True(t, client.migrationsEnabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrInvalidConfig is the cause of configuration validation errors.
+var ErrInvalidConfig = errors.New("persistence: invalid configuration")
+
+// ValidateConfig checks cfg and the client options for missing or
+// contradictory settings, e.g. a zero ping timeout or a read replica
+// on SQLite. It returns a validation error wrapping ErrInvalidConfig
+// with every problem found as a field error, or nil. New and Open call
+// it before connecting.
+func ValidateConfig(cfg Config, opts ...ClientOption) error {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return validateConfig(cfg, nil, o, false)
+}
+
+// validateConfig validates cfg for New, and for Open when open is set,
+// which also needs a driver and a DSN. d may be nil, the driver name is
+// used to detect SQLite then.
+func validateConfig(cfg Config, d schema.Dialect, o *clientOptions, open bool) error {
+	var problems apierrors.ValidationErrors
+	add := func(field, format string, args ...any) {
+		problems = append(problems, apierrors.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg == nil {
+		add("config", "is required")
+		return invalidConfig(problems)
+	}
+
+	if timeout := cfg.GetPingTimeout(); timeout <= 0 {
+		add("ping_timeout", "must be positive, got %s; a zero timeout fails every connection check, use DefaultPingTimeout", timeout)
+	}
+	if open {
+		if cfg.GetDriver() == "" {
+			add("driver", "is required to open a connection, e.g. %q", DefaultDriver)
+		}
+		if configDSN(cfg) == "" {
+			add("dsn", "is required to open a connection, set it with GetDSN or GetServer")
+		}
+	}
+	if o.bunotelEnabled && cfg.GetOtelIdentifier() == "" {
+		add("otel_identifier", "is required by WithBunotel, without it no tracing hook is registered")
+	}
+
+	var sqlite bool
+	if d != nil {
+		sqlite = d.Name() == dialect.SQLite
+	} else {
+		sqlite = strings.Contains(strings.ToLower(cfg.GetDriver()), "sqlite")
+	}
+	if sqlite {
+		if _, ok := o.pools[ReplicaPool]; ok || o.replicaRouting {
+			add("read_replica", "is not supported on sqlite, which has no replication; remove WithReadReplica")
+		}
+		if len(o.failoverTargets) > 0 {
+			add("failover_targets", "are not supported on sqlite; remove WithFailoverTargets")
+		}
+	}
+
+	names := make([]string, 0, len(o.pools))
+	for name := range o.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pool := o.pools[name]
+		field := "pools." + name
+		if pool.MaxOpenConns < 0 || pool.MaxIdleConns < 0 || pool.ConnMaxLifetime < 0 || pool.ConnMaxIdleTime < 0 {
+			add(field, "limits must not be negative")
+		}
+		if pool.MaxOpenConns > 0 && pool.MaxIdleConns > pool.MaxOpenConns {
+			add(field, "MaxIdleConns (%d) is above MaxOpenConns (%d)", pool.MaxIdleConns, pool.MaxOpenConns)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return invalidConfig(problems)
+}
+
+func invalidConfig(problems apierrors.ValidationErrors) error {
+	err := apierrors.Wrap(ErrInvalidConfig, apierrors.CategoryValidation, "invalid persistence configuration")
+	err.ValidationErrors = problems
+	return err
+}
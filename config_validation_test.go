@@ -0,0 +1,70 @@
+package persistence
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func configProblems(t *testing.T, err error) map[string]string {
+	t.Helper()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	var apiErr *apierrors.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, apierrors.CategoryValidation, apiErr.Category)
+	problems := map[string]string{}
+	for _, fe := range apiErr.ValidationErrors {
+		problems[fe.Field] = fe.Message
+	}
+	return problems
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, ValidateConfig(NewConfig()))
+
+	problems := configProblems(t, ValidateConfig(nil))
+	assert.Contains(t, problems, "config")
+
+	problems = configProblems(t, ValidateConfig(
+		NewConfig(WithDriver(sqliteshim.ShimName), WithPingTimeout(0)),
+		WithBunotel(),
+		WithReadReplica(PoolConfig{DSN: "file:replica.db"}),
+		WithFailoverTargets("file:standby.db"),
+		WithPool("jobs", PoolConfig{MaxOpenConns: 2, MaxIdleConns: 5}),
+		WithPool("reports", PoolConfig{MaxOpenConns: -1}),
+	))
+	assert.Len(t, problems, 6, "every problem is reported at once: %v", problems)
+	assert.Contains(t, problems["ping_timeout"], "must be positive")
+	assert.Contains(t, problems["otel_identifier"], "WithBunotel")
+	assert.Contains(t, problems["read_replica"], "sqlite")
+	assert.Contains(t, problems, "failover_targets")
+	assert.Contains(t, problems["pools.jobs"], "MaxIdleConns (5) is above MaxOpenConns (2)")
+	assert.Contains(t, problems["pools.reports"], "negative")
+}
+
+func TestNew_RejectsInvalidConfig(t *testing.T) {
+	sqlDB, err := sql.Open(sqliteshim.ShimName, ":memory:")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = New(NewConfig(WithPingTimeout(time.Second)), sqlDB, sqlitedialect.New(),
+		WithLazyConnect(),
+		WithReadReplica(PoolConfig{DSN: "file:replica.db"}),
+	)
+	problems := configProblems(t, err)
+	assert.Contains(t, problems, "read_replica")
+}
+
+func TestOpen_RequiresDriverAndDSN(t *testing.T) {
+	_, err := Open(NewConfig(WithDriver("")), sqlitedialect.New())
+	problems := configProblems(t, err)
+	assert.Contains(t, problems, "driver")
+	assert.Contains(t, problems, "dsn")
+}
@@ -0,0 +1,165 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// DefaultEstimateThreshold is the row count below which estimated
+// totals fall back to an exact COUNT(*).
+const DefaultEstimateThreshold = 10000
+
+// TotalCount is the result of CountTotal.
+type TotalCount struct {
+	Value     int64
+	Estimated bool
+}
+
+// CountOption configures CountTotal
+type CountOption func(*countOptions)
+
+type countOptions struct {
+	estimate  bool
+	threshold int64
+}
+
+// WithEstimatedTotals uses planner statistics instead of an exact
+// COUNT(*) when the estimate is above the threshold.
+func WithEstimatedTotals() CountOption {
+	return func(o *countOptions) {
+		o.estimate = true
+	}
+}
+
+// WithEstimateThreshold sets the row count below which an exact
+// count is used even when estimation is enabled.
+func WithEstimateThreshold(rows int64) CountOption {
+	return func(o *countOptions) {
+		o.threshold = rows
+	}
+}
+
+// CountTotal counts the rows matched by q. By default it runs an exact
+// COUNT(*). With WithEstimatedTotals it first asks the planner for an
+// estimate and only counts exactly when the estimate is small or
+// unavailable, since exact counts dominate list endpoint latency on
+// large tables.
+func CountTotal(ctx context.Context, q *bun.SelectQuery, opts ...CountOption) (TotalCount, error) {
+	options := countOptions{threshold: DefaultEstimateThreshold}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	if options.estimate {
+		estimate, ok, err := EstimateQueryRows(ctx, q)
+		if err != nil {
+			return TotalCount{}, err
+		}
+		if ok && estimate >= options.threshold {
+			return TotalCount{Value: estimate, Estimated: true}, nil
+		}
+	}
+
+	count, err := q.Count(ctx)
+	if err != nil {
+		return TotalCount{}, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to count rows")
+	}
+	return TotalCount{Value: int64(count)}, nil
+}
+
+// EstimateQueryRows returns the planner row estimate for q. On Postgres
+// it uses EXPLAIN. Other dialects can only estimate unfiltered table
+// scans, see EstimateTableRows. The boolean is false when no estimate
+// is available.
+//
+// Like Count, the estimate ignores the LIMIT and OFFSET of q. Its ORDER BY
+// cannot be dropped from a bun query, it is left in place as a sort keeps
+// the row estimate of its input.
+func EstimateQueryRows(ctx context.Context, q *bun.SelectQuery) (int64, bool, error) {
+	db := q.DB()
+	q = q.Clone().Limit(0).Offset(0)
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		var plan string
+		if err := db.NewRaw("EXPLAIN (FORMAT JSON) ?", q).Scan(ctx, &plan); err != nil {
+			return 0, false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to explain query")
+		}
+		rows, err := planRows(plan)
+		if err != nil {
+			return 0, false, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to parse query plan")
+		}
+		return rows, true, nil
+	default:
+		if !isUnfilteredTableQuery(q) {
+			return 0, false, nil
+		}
+		return EstimateTableRows(ctx, db, q.GetTableName())
+	}
+}
+
+// EstimateTableRows returns an approximate row count for table using
+// pg_class.reltuples on Postgres and max(rowid) on SQLite. The boolean
+// is false when statistics are not available, e.g. before ANALYZE.
+func EstimateTableRows(ctx context.Context, db bun.IDB, table string) (int64, bool, error) {
+	table = strings.Trim(table, `"`+"`")
+	var estimate int64
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		err := db.NewRaw(
+			"SELECT COALESCE((SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass(?)), -1)",
+			table,
+		).Scan(ctx, &estimate)
+		if err != nil {
+			return 0, false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics").
+				WithMetadata(map[string]any{"table": table})
+		}
+	case dialect.SQLite:
+		err := db.NewRaw("SELECT COALESCE(MAX(rowid), 0) FROM ?", bun.Ident(table)).Scan(ctx, &estimate)
+		if err != nil {
+			return 0, false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics").
+				WithMetadata(map[string]any{"table": table})
+		}
+	default:
+		return 0, false, nil
+	}
+	if estimate < 0 {
+		return 0, false, nil
+	}
+	return estimate, true, nil
+}
+
+func planRows(plan string) (int64, error) {
+	var explained []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &explained); err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+	return int64(explained[0].Plan.PlanRows), nil
+}
+
+func isUnfilteredTableQuery(q *bun.SelectQuery) bool {
+	if q.GetTableName() == "" {
+		return false
+	}
+	query := strings.ToUpper(q.String())
+	for _, clause := range []string{" WHERE ", " JOIN ", " GROUP BY ", " HAVING ", " DISTINCT ", " UNION "} {
+		if strings.Contains(query, clause) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type estimateRecord struct {
+	bun.BaseModel `bun:"table:estimate_records"`
+	ID            int64  `bun:"id,pk,autoincrement"`
+	Kind          string `bun:"kind"`
+}
+
+func TestCountTotal_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*estimateRecord)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := db.NewInsert().Model(&estimateRecord{Kind: "a"}).Exec(ctx)
+		require.NoError(t, err)
+	}
+
+	total, err := CountTotal(ctx, db.NewSelect().Model((*estimateRecord)(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, TotalCount{Value: 5}, total)
+
+	total, err = CountTotal(ctx, db.NewSelect().Model((*estimateRecord)(nil)), WithEstimatedTotals(), WithEstimateThreshold(1))
+	require.NoError(t, err)
+	assert.Equal(t, TotalCount{Value: 5, Estimated: true}, total)
+
+	// pagination does not change the total
+	total, err = CountTotal(ctx, db.NewSelect().Model((*estimateRecord)(nil)).Limit(2), WithEstimatedTotals(), WithEstimateThreshold(1))
+	require.NoError(t, err)
+	assert.Equal(t, TotalCount{Value: 5, Estimated: true}, total)
+
+	// below threshold falls back to exact counts
+	total, err = CountTotal(ctx, db.NewSelect().Model((*estimateRecord)(nil)), WithEstimatedTotals())
+	require.NoError(t, err)
+	assert.False(t, total.Estimated)
+
+	// filtered queries cannot be estimated on sqlite
+	total, err = CountTotal(ctx, db.NewSelect().Model((*estimateRecord)(nil)).Where("kind = ?", "b"), WithEstimatedTotals(), WithEstimateThreshold(1))
+	require.NoError(t, err)
+	assert.Equal(t, TotalCount{Value: 0}, total)
+}
+
+func TestEstimateQueryRows_Postgres(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT`).WillReturnRows(
+		sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 125000}}]`),
+	)
+
+	total, err := CountTotal(context.Background(), db.NewSelect().Model((*estimateRecord)(nil)).Where("kind = ?", "a"), WithEstimatedTotals())
+	require.NoError(t, err)
+	assert.Equal(t, TotalCount{Value: 125000, Estimated: true}, total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEstimateQueryRows_IgnoresLimit(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT .* WHERE \(kind = 'a'\)$`).WillReturnRows(
+		sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 125000}}]`),
+	)
+
+	q := db.NewSelect().Model((*estimateRecord)(nil)).Where("kind = ?", "a").Limit(20).Offset(40)
+	rows, ok, err := EstimateQueryRows(context.Background(), q)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(125000), rows)
+	assert.Contains(t, q.String(), "LIMIT 20 OFFSET 40", "the query itself is not changed")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEstimateTableRows_Postgres(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectQuery(`SELECT COALESCE\(\(SELECT reltuples::bigint FROM pg_class`).WillReturnRows(
+		sqlmock.NewRows([]string{"reltuples"}).AddRow(-1),
+	)
+
+	_, ok, err := EstimateTableRows(context.Background(), db, "estimate_records")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/schema"
+)
+
+// Counters maintains denormalized counter columns, e.g. posts.comment_count,
+// with atomic UPDATE statements and optional reconciliation against the
+// rows being counted.
+type Counters struct {
+	db  bun.IDB
+	lgr Logger
+}
+
+// NewCounters creates counters backed by db.
+func NewCounters(db bun.IDB) *Counters {
+	return &Counters{db: db, lgr: &defaultLogger{}}
+}
+
+// SetLogger sets the logger used by the background reconciler.
+func (c *Counters) SetLogger(lgr Logger) *Counters {
+	if lgr != nil {
+		c.lgr = lgr
+	}
+	return c
+}
+
+// Increment adds delta to column of the row of model with primary key id
+// in a single UPDATE and returns the new value. A missing row returns a
+// NotFound error wrapping sql.ErrNoRows.
+func (c *Counters) Increment(ctx context.Context, model any, id any, column string, delta int64) (int64, error) {
+	table, err := counterTable(c.db, model, column)
+	if err != nil {
+		return 0, err
+	}
+
+	meta := map[string]any{"table": table.Name, "column": column, "id": id}
+	q := c.db.NewUpdate().
+		Model(model).
+		Set("? = ? + ?", bun.Ident(column), bun.Ident(column), delta).
+		Where("? = ?", table.PKs[0].SQLName, id)
+
+	var value int64
+	if c.db.Dialect().Features().Has(feature.Returning) {
+		err = q.Returning("?", bun.Ident(column)).Scan(ctx, &value)
+	} else {
+		var res sql.Result
+		if res, err = q.Exec(ctx); err == nil {
+			if n, _ := res.RowsAffected(); n == 0 {
+				err = sql.ErrNoRows
+			} else {
+				err = c.db.NewSelect().Model(model).Column(column).Where("? = ?", table.PKs[0].SQLName, id).Scan(ctx, &value)
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, apierrors.Wrap(err, apierrors.CategoryNotFound, "counter row not found").WithMetadata(meta)
+	case err != nil:
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to update counter").WithMetadata(meta)
+	}
+	return value, nil
+}
+
+// Decrement subtracts delta from column, see Increment.
+func (c *Counters) Decrement(ctx context.Context, model any, id any, column string, delta int64) (int64, error) {
+	return c.Increment(ctx, model, id, column, -delta)
+}
+
+// CounterSpec describes a counter column and the rows it counts.
+type CounterSpec struct {
+	// Model is the table holding the counter, e.g. (*Post)(nil).
+	Model any
+	// Column is the counter column, e.g. comment_count.
+	Column string
+	// Source is the table of the counted rows, e.g. (*Comment)(nil).
+	Source any
+	// ForeignKey is the Source column referencing the Model primary key.
+	ForeignKey string
+	// Where optionally restricts the counted rows, e.g. "deleted_at IS NULL".
+	Where string
+	Args  []any
+}
+
+// Reconcile resets every counter of spec that drifted from the actual
+// count of source rows and returns the number of corrected rows.
+func (c *Counters) Reconcile(ctx context.Context, spec CounterSpec) (int64, error) {
+	table, err := counterTable(c.db, spec.Model, spec.Column)
+	if err != nil {
+		return 0, err
+	}
+	srcType := modelType(reflect.TypeOf(spec.Source))
+	if srcType == nil || spec.ForeignKey == "" {
+		return 0, apierrors.New("counter spec requires a source model and foreign key", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"table": table.Name, "column": spec.Column})
+	}
+	source := c.db.Dialect().Tables().Get(srcType)
+
+	count := "SELECT COUNT(*) FROM ? AS counter_src WHERE counter_src.? = ?TableAlias.?"
+	args := []any{source.SQLName, bun.Ident(spec.ForeignKey), table.PKs[0].SQLName}
+	if spec.Where != "" {
+		count += " AND (" + spec.Where + ")"
+		args = append(args, spec.Args...)
+	}
+
+	setArgs := append([]any{bun.Ident(spec.Column)}, args...)
+	res, err := c.db.NewUpdate().
+		Model(spec.Model).
+		Set("? = ("+count+")", setArgs...).
+		Where("?TableAlias.? <> ("+count+")", setArgs...).
+		Exec(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to reconcile counter").
+			WithMetadata(map[string]any{"table": table.Name, "column": spec.Column})
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// StartReconciler reconciles the specs every interval until ctx is done
+// or the returned stop function is called.
+func (c *Counters) StartReconciler(ctx context.Context, interval time.Duration, specs ...CounterSpec) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, spec := range specs {
+					n, err := c.Reconcile(ctx, spec)
+					if err != nil {
+						c.lgr.Error("counter reconciliation failed", "column", spec.Column, "error", err)
+						continue
+					}
+					if n > 0 {
+						c.lgr.Warn("counter drift corrected", "column", spec.Column, "rows", n)
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func counterTable(db bun.IDB, model any, column string) (*schema.Table, error) {
+	typ := modelType(reflect.TypeOf(model))
+	if typ == nil {
+		return nil, apierrors.New("counter model must be a struct", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": fmt.Sprintf("%T", model)})
+	}
+	table := db.Dialect().Tables().Get(typ)
+	if len(table.PKs) != 1 {
+		return nil, apierrors.New("counter model requires a single column primary key", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": table.TypeName})
+	}
+	if !table.HasField(column) {
+		return nil, apierrors.New("counter column is not a field of the model", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": table.TypeName, "column": column})
+	}
+	return table, nil
+}
@@ -0,0 +1,107 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type counterPost struct {
+	bun.BaseModel `bun:"table:counter_posts"`
+
+	ID           int64 `bun:"id,pk,autoincrement"`
+	CommentCount int64 `bun:"comment_count,notnull"`
+}
+
+type counterComment struct {
+	bun.BaseModel `bun:"table:counter_comments"`
+
+	ID      int64 `bun:"id,pk,autoincrement"`
+	PostID  int64 `bun:"post_id,notnull"`
+	Deleted bool  `bun:"deleted,notnull"`
+}
+
+func setupCounterTables(t *testing.T, db *bun.DB) {
+	t.Helper()
+	ctx := context.Background()
+	for _, model := range []any{(*counterPost)(nil), (*counterComment)(nil)} {
+		_, err := db.NewCreateTable().Model(model).Exec(ctx)
+		require.NoError(t, err)
+	}
+}
+
+func TestCounters_Increment(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	setupCounterTables(t, db)
+
+	post := &counterPost{}
+	_, err := db.NewInsert().Model(post).Exec(ctx)
+	require.NoError(t, err)
+
+	counters := NewCounters(db)
+	value, err := counters.Increment(ctx, (*counterPost)(nil), post.ID, "comment_count", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), value)
+
+	value, err = counters.Decrement(ctx, (*counterPost)(nil), post.ID, "comment_count", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+
+	_, err = counters.Increment(ctx, (*counterPost)(nil), post.ID+100, "comment_count", 1)
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeNotFound, ErrorCode(err))
+
+	_, err = counters.Increment(ctx, (*counterPost)(nil), post.ID, "missing", 1)
+	require.Error(t, err)
+}
+
+func TestCounters_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	setupCounterTables(t, db)
+
+	posts := []counterPost{{CommentCount: 5}, {CommentCount: 1}, {CommentCount: 0}}
+	_, err := db.NewInsert().Model(&posts).Exec(ctx)
+	require.NoError(t, err)
+	comments := []counterComment{
+		{PostID: posts[0].ID}, {PostID: posts[0].ID}, {PostID: posts[0].ID, Deleted: true},
+		{PostID: posts[1].ID},
+	}
+	_, err = db.NewInsert().Model(&comments).Exec(ctx)
+	require.NoError(t, err)
+
+	spec := CounterSpec{
+		Model:      (*counterPost)(nil),
+		Column:     "comment_count",
+		Source:     (*counterComment)(nil),
+		ForeignKey: "post_id",
+		Where:      "deleted = ?",
+		Args:       []any{false},
+	}
+	counters := NewCounters(db)
+	n, err := counters.Reconcile(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var counts []int64
+	require.NoError(t, db.NewSelect().Model((*counterPost)(nil)).Column("comment_count").Order("id").Scan(ctx, &counts))
+	assert.Equal(t, []int64{2, 1, 0}, counts)
+
+	_, err = db.NewUpdate().Model((*counterPost)(nil)).Set("comment_count = 9").Where("id = ?", posts[2].ID).Exec(ctx)
+	require.NoError(t, err)
+
+	stop := counters.StartReconciler(ctx, 5*time.Millisecond, spec)
+	defer stop()
+	assert.Eventually(t, func() bool {
+		var count int64
+		err := db.NewSelect().Model((*counterPost)(nil)).Column("comment_count").Where("id = ?", posts[2].ID).Scan(ctx, &count)
+		return err == nil && count == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,302 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+)
+
+const defaultCredentialRefreshBefore = time.Minute
+
+// Credentials are a database username and password, e.g. a Vault lease
+// or an IAM auth token. A zero ExpiresAt means the provider is asked
+// again for every new connection.
+type Credentials struct {
+	Username  string
+	Password  string
+	ExpiresAt time.Time
+}
+
+// CredentialProvider returns the current database credentials.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function to CredentialProvider.
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialProvider
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// CredentialConnector opens connections with the credentials of a
+// CredentialProvider. When the credentials change, connections opened
+// with the previous ones finish their current work and are then closed
+// by database/sql instead of being reused, so rotation needs no
+// downtime. Use it with sql.OpenDB.
+type CredentialConnector struct {
+	driver        driver.Driver
+	dsn           string
+	provider      CredentialProvider
+	refreshBefore time.Duration
+	now           func() time.Time
+
+	mu         sync.Mutex
+	current    Credentials
+	cached     bool
+	generation atomic.Int64
+}
+
+// CredentialOption configures a CredentialConnector
+type CredentialOption func(*CredentialConnector)
+
+// WithCredentialRefreshBefore sets how long before ExpiresAt cached
+// credentials are refreshed, one minute by default.
+func WithCredentialRefreshBefore(d time.Duration) CredentialOption {
+	return func(c *CredentialConnector) {
+		if d >= 0 {
+			c.refreshBefore = d
+		}
+	}
+}
+
+// NewCredentialConnector returns a connector for d that sets the
+// username and password of dsn from provider. URL (postgres://...),
+// key=value (host=... user=...) and user:password@tcp(...) DSNs are
+// supported.
+func NewCredentialConnector(d driver.Driver, dsn string, provider CredentialProvider, opts ...CredentialOption) *CredentialConnector {
+	c := &CredentialConnector{
+		driver:        d,
+		dsn:           dsn,
+		provider:      provider,
+		refreshBefore: defaultCredentialRefreshBefore,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c
+}
+
+// WithCredentialProvider opens the client of Open and the labeled pools
+// of WithPool with credentials from provider, see CredentialConnector.
+// Clients created with New open their pool with NewCredentialConnector.
+func WithCredentialProvider(provider CredentialProvider, opts ...CredentialOption) ClientOption {
+	return func(o *clientOptions) {
+		if o == nil {
+			return
+		}
+		o.credentialProvider = provider
+		o.credentialOptions = opts
+	}
+}
+
+// Rotate drops the cached credentials, so the next connection asks the
+// provider, and retires every open connection once it is idle. Call it
+// when the provider signals a rotation.
+func (c *CredentialConnector) Rotate() {
+	c.mu.Lock()
+	c.cached = false
+	c.mu.Unlock()
+	c.generation.Add(1)
+}
+
+// Generation returns how many times the credentials changed.
+func (c *CredentialConnector) Generation() int64 {
+	return c.generation.Load()
+}
+
+func (c *CredentialConnector) credentials(ctx context.Context) (Credentials, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached && !c.current.ExpiresAt.IsZero() && c.now().Before(c.current.ExpiresAt.Add(-c.refreshBefore)) {
+		return c.current, c.generation.Load(), nil
+	}
+	creds, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, 0, apierrors.Wrap(err, apierrors.CategoryAuth, "failed to get database credentials")
+	}
+	if c.cached && (creds.Username != c.current.Username || creds.Password != c.current.Password) {
+		c.generation.Add(1)
+	}
+	c.current, c.cached = creds, true
+	return creds, c.generation.Load(), nil
+}
+
+// Connect implements driver.Connector.
+func (c *CredentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	creds, generation, err := c.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := dsnWithCredentials(c.dsn, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn driver.Conn
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = connector.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else if conn, err = c.driver.Open(dsn); err != nil {
+		return nil, err
+	}
+	return &generationConn{Conn: conn, current: &c.generation, generation: generation}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *CredentialConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// OpenDB opens a database on the connector.
+func (c *CredentialConnector) OpenDB() *sql.DB {
+	return sql.OpenDB(c)
+}
+
+// mysqlUserinfoRE matches up to the last @ before the protocol, so
+// passwords may contain @.
+var mysqlUserinfoRE = regexp.MustCompile(`^(.*)@[a-z]*\(`)
+
+// dsnWithCredentials sets the username and password of dsn. An empty
+// username keeps the one in dsn.
+func dsnWithCredentials(dsn string, creds Credentials) (string, error) {
+	switch {
+	case strings.Contains(dsn, "://"):
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid DSN")
+		}
+		username := creds.Username
+		if username == "" {
+			username = u.User.Username()
+		}
+		u.User = url.UserPassword(username, creds.Password)
+		return u.String(), nil
+	case mysqlUserinfoRE.MatchString(dsn):
+		at := mysqlUserinfoRE.FindStringSubmatchIndex(dsn)[3]
+		username, _, _ := strings.Cut(dsn[:at], ":")
+		if creds.Username != "" {
+			username = creds.Username
+		}
+		return username + ":" + creds.Password + dsn[at:], nil
+	default:
+		fields := strings.Fields(dsn)
+		out := fields[:0]
+		for _, field := range fields {
+			key, _, _ := strings.Cut(field, "=")
+			if key == "password" || (key == "user" && creds.Username != "") {
+				continue
+			}
+			out = append(out, field)
+		}
+		if creds.Username != "" {
+			out = append(out, "user="+quoteDSNValue(creds.Username))
+		}
+		out = append(out, "password="+quoteDSNValue(creds.Password))
+		return strings.Join(out, " "), nil
+	}
+}
+
+// quoteDSNValue quotes a libpq key=value connection string value.
+func quoteDSNValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+// generationConn is a connection opened at a generation of its
+// connector, credentials or failover target, retired once the
+// connector moves to a newer one.
+type generationConn struct {
+	driver.Conn
+	current    *atomic.Int64
+	generation int64
+}
+
+func (c *generationConn) stale() bool {
+	return c.generation < c.current.Load()
+}
+
+// IsValid implements driver.Validator, database/sql closes stale
+// connections instead of returning them to the pool.
+func (c *generationConn) IsValid() bool {
+	if c.stale() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// Ping implements driver.Pinger so database/sql pings reach the
+// wrapped connection.
+func (c *generationConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *generationConn) ResetSession(ctx context.Context) error {
+	if c.stale() {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *generationConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *generationConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *generationConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *generationConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *generationConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
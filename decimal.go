@@ -0,0 +1,410 @@
+package persistence
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+var (
+	// ErrCurrencyMismatch indicates arithmetic between amounts in different currencies.
+	ErrCurrencyMismatch = errors.New("persistence: currency mismatch")
+	// ErrDivisionByZero indicates a decimal division by zero.
+	ErrDivisionByZero = errors.New("persistence: decimal division by zero")
+)
+
+// Decimal is an exact fixed point number for money and other values
+// where float drift is not acceptable. It is stored as its string form,
+// which Postgres NUMERIC and MySQL DECIMAL columns accept as is and SQLite
+// keeps verbatim in TEXT columns, see DecimalSQLType.
+//
+// The zero value is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+// NewDecimal returns unscaled * 10^-scale, e.g. NewDecimal(1234, 2) is 12.34.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	if scale < 0 {
+		return NewDecimal(unscaled, 0).Mul(Decimal{unscaled: pow10(-scale)})
+	}
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// NewDecimalFromInt returns n as a decimal with no fractional digits.
+func NewDecimalFromInt(n int64) Decimal {
+	return NewDecimal(n, 0)
+}
+
+// ParseDecimal parses a plain decimal literal such as "-12.340".
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	sign := ""
+	if rest, ok := strings.CutPrefix(text, "-"); ok {
+		sign, text = "-", rest
+	} else {
+		text = strings.TrimPrefix(text, "+")
+	}
+
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("persistence: invalid decimal %q", s)
+	}
+
+	unscaled, ok := new(big.Int).SetString(sign+intPart+fracPart, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("persistence: invalid decimal %q", s)
+	}
+	return Decimal{unscaled: unscaled, scale: int32(len(fracPart))}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics on invalid input.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pow10 returns 10^n for n >= 0.
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescale returns the unscaled value of d at a scale >= d.scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return new(big.Int).Set(d.int())
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// Scale returns the number of fractional digits.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Cmp compares d and other numerically, ignoring scale.
+func (d Decimal) Cmp(other Decimal) int {
+	scale := max(d.scale, other.scale)
+	return d.rescale(scale).Cmp(other.rescale(scale))
+}
+
+// Equal reports whether d and other are numerically equal.
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+// Add returns d + other.
+func (d Decimal) Add(other Decimal) Decimal {
+	scale := max(d.scale, other.scale)
+	return Decimal{unscaled: new(big.Int).Add(d.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+// Sub returns d - other.
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d.Add(other.Neg())
+}
+
+// Mul returns d * other.
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), other.int()), scale: d.scale + other.scale}
+}
+
+// Div returns d / other rounded half away from zero to scale digits; a
+// negative scale rounds like Round.
+func (d Decimal) Div(other Decimal, scale int32) (Decimal, error) {
+	if other.IsZero() {
+		return Decimal{}, ErrDivisionByZero
+	}
+	num := new(big.Rat).SetFrac(d.int(), pow10(d.scale))
+	den := new(big.Rat).SetFrac(other.int(), pow10(other.scale))
+	return ratToDecimal(num.Quo(num, den), scale), nil
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Abs returns |d|.
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Round rounds d half away from zero to scale fractional digits. A negative
+// scale rounds to tens, hundreds and so on, returning a decimal at scale 0.
+func (d Decimal) Round(scale int32) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: d.rescale(scale), scale: scale}
+	}
+	return ratToDecimal(new(big.Rat).SetFrac(d.int(), pow10(d.scale)), scale)
+}
+
+// ratToDecimal rounds r half away from zero to scale fractional digits. A
+// negative scale rounds to a multiple of 10^-scale and returns scale 0.
+func ratToDecimal(r *big.Rat, scale int32) Decimal {
+	if scale < 0 {
+		unit := pow10(-scale)
+		d := ratToDecimal(new(big.Rat).Quo(r, new(big.Rat).SetInt(unit)), 0)
+		return Decimal{unscaled: d.unscaled.Mul(d.unscaled, unit)}
+	}
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(scale)))
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// round half away from zero: |2 * rem| >= denom
+	if new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{unscaled: q, scale: scale}
+}
+
+// Float64 returns the nearest float64, for display or statistics only.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return f
+}
+
+// String returns d with exactly Scale fractional digits.
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Value implements driver.Valuer.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan implements sql.Scanner. NULL is rejected, use NullDecimal for
+// nullable columns.
+func (d *Decimal) Scan(src any) error {
+	if d == nil {
+		return fmt.Errorf("persistence: Decimal scan target is nil")
+	}
+
+	var (
+		parsed Decimal
+		err    error
+	)
+	switch typed := src.(type) {
+	case nil:
+		return fmt.Errorf("persistence: Decimal scan: NULL value, use NullDecimal")
+	case string:
+		parsed, err = ParseDecimal(typed)
+	case []byte:
+		parsed, err = ParseDecimal(string(typed))
+	case int64:
+		parsed = NewDecimalFromInt(typed)
+	case float64:
+		// columns with numeric affinity, e.g. sqlite NUMERIC, return floats
+		parsed, err = ParseDecimal(strconv.FormatFloat(typed, 'f', -1, 64))
+	default:
+		return fmt.Errorf("persistence: Decimal scan: unsupported source type %T", src)
+	}
+	if err != nil {
+		return fmt.Errorf("persistence: Decimal scan: %w", err)
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalJSON encodes d as a JSON string to avoid float conversion by clients.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, d.String()), nil
+}
+
+// UnmarshalJSON accepts JSON strings and numbers.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if unquoted, err := strconv.Unquote(string(data)); err == nil {
+		return d.UnmarshalText([]byte(unquoted))
+	}
+	return d.UnmarshalText(data)
+}
+
+// NullDecimal is a Decimal that may be NULL.
+type NullDecimal struct {
+	Decimal Decimal
+	Valid   bool
+}
+
+// Value implements driver.Valuer.
+func (n NullDecimal) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Decimal.Value()
+}
+
+// Scan implements sql.Scanner.
+func (n *NullDecimal) Scan(src any) error {
+	if src == nil {
+		n.Decimal, n.Valid = Decimal{}, false
+		return nil
+	}
+	if err := n.Decimal.Scan(src); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Money is an amount in a currency, embedded in models with a column
+// prefix:
+//
+//	type Invoice struct {
+//		bun.BaseModel `bun:"table:invoices"`
+//		ID    int64                `bun:"id,pk,autoincrement"`
+//		Total persistence.Money    `bun:"embed:total_"`
+//	}
+//
+// which maps to the total_amount and total_currency columns.
+type Money struct {
+	Amount   Decimal `bun:"amount,notnull" json:"amount"`
+	Currency string  `bun:"currency,notnull" json:"currency"`
+}
+
+// NewMoney returns amount in currency.
+func NewMoney(amount Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add returns m + other. Both must share a currency.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount.Add(other.Amount), Currency: m.Currency}, nil
+}
+
+// Sub returns m - other. Both must share a currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount.Sub(other.Amount), Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by factor, e.g. a quantity or a tax rate.
+func (m Money) Mul(factor Decimal) Money {
+	return Money{Amount: m.Amount.Mul(factor), Currency: m.Currency}
+}
+
+// Round rounds the amount to scale fractional digits.
+func (m Money) Round(scale int32) Money {
+	return Money{Amount: m.Amount.Round(scale), Currency: m.Currency}
+}
+
+// Allocate splits m into n parts at the amount scale that add up
+// exactly to m, distributing the remainder to the first parts.
+func (m Money) Allocate(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	total := m.Amount.int()
+	count := big.NewInt(int64(n))
+	share, rem := new(big.Int).QuoRem(total, count, new(big.Int))
+
+	unit := big.NewInt(int64(rem.Sign()))
+	remaining := new(big.Int).Abs(rem).Int64()
+	parts := make([]Money, n)
+	for i := range parts {
+		unscaled := new(big.Int).Set(share)
+		if int64(i) < remaining {
+			unscaled.Add(unscaled, unit)
+		}
+		parts[i] = Money{Amount: Decimal{unscaled: unscaled, scale: m.Amount.scale}, Currency: m.Currency}
+	}
+	return parts
+}
+
+// String returns the amount followed by the currency, e.g. "12.50 EUR".
+func (m Money) String() string {
+	return strings.TrimSpace(m.Amount.String() + " " + m.Currency)
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency == other.Currency {
+		return nil
+	}
+	return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+}
+
+// DecimalSQLType returns the column type for decimals with the given
+// precision and scale: NUMERIC on Postgres, DECIMAL on MySQL and TEXT on
+// SQLite, where NUMERIC affinity would convert values to floats. Use it
+// in migrations or as the bun type tag for the target dialect.
+func DecimalSQLType(db bun.IDB, precision, scale int) string {
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		return fmt.Sprintf("NUMERIC(%d,%d)", precision, scale)
+	case dialect.MySQL:
+		return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+	default:
+		return "TEXT"
+	}
+}
@@ -0,0 +1,122 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	a := MustParseDecimal("0.1")
+	b := MustParseDecimal("0.2")
+	assert.Equal(t, "0.3", a.Add(b).String())
+	assert.True(t, a.Add(b).Equal(MustParseDecimal("0.30")))
+	assert.Equal(t, "-0.1", a.Sub(b).String())
+	assert.Equal(t, "0.02", a.Mul(b).String())
+	assert.Equal(t, "12.34", NewDecimal(1234, 2).String())
+	assert.Equal(t, "-0.05", NewDecimal(-5, 2).String())
+	assert.Equal(t, "1200", NewDecimal(12, -2).String())
+
+	q, err := NewDecimalFromInt(10).Div(NewDecimalFromInt(3), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "3.3333", q.String())
+
+	q, err = NewDecimalFromInt(-2).Div(NewDecimalFromInt(3), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "-0.67", q.String())
+
+	_, err = a.Div(Decimal{}, 2)
+	require.ErrorIs(t, err, ErrDivisionByZero)
+
+	assert.Equal(t, "2.35", MustParseDecimal("2.345").Round(2).String())
+	assert.Equal(t, "-2.35", MustParseDecimal("-2.345").Round(2).String())
+	assert.Equal(t, "2.3400", MustParseDecimal("2.34").Round(4).String())
+	assert.Equal(t, "1300", MustParseDecimal("1250").Round(-2).String())
+	assert.Equal(t, "-1200", MustParseDecimal("-1249.99").Round(-2).String())
+	assert.Equal(t, "0", MustParseDecimal("4.9").Round(-1).String())
+
+	q, err = NewDecimalFromInt(10000).Div(NewDecimalFromInt(3), -2)
+	require.NoError(t, err)
+	assert.Equal(t, "3300", q.String())
+	assert.Equal(t, 1, MustParseDecimal("1.01").Cmp(MustParseDecimal("1.001")))
+	assert.True(t, Decimal{}.IsZero())
+	assert.Equal(t, "0", Decimal{}.String())
+
+	for _, invalid := range []string{"", ".", "-", "1e5", "1.2.3", "abc"} {
+		_, err := ParseDecimal(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	data, err := json.Marshal(MustParseDecimal("19.990"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"19.990"`, string(data))
+
+	var fromString, fromNumber Decimal
+	require.NoError(t, json.Unmarshal([]byte(`"1.50"`), &fromString))
+	require.NoError(t, json.Unmarshal([]byte(`1.50`), &fromNumber))
+	assert.Equal(t, "1.50", fromString.String())
+	assert.Equal(t, "1.50", fromNumber.String())
+}
+
+func TestMoney_AddAndAllocate(t *testing.T) {
+	eur := NewMoney(MustParseDecimal("10.00"), "EUR")
+
+	sum, err := eur.Add(NewMoney(MustParseDecimal("0.10"), "EUR"))
+	require.NoError(t, err)
+	assert.Equal(t, "10.10 EUR", sum.String())
+
+	_, err = eur.Add(NewMoney(MustParseDecimal("1"), "USD"))
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	parts := eur.Allocate(3)
+	require.Len(t, parts, 3)
+	assert.Equal(t, "3.34", parts[0].Amount.String())
+	assert.Equal(t, "3.33", parts[2].Amount.String())
+	total := Decimal{}
+	for _, part := range parts {
+		total = total.Add(part.Amount)
+	}
+	assert.True(t, total.Equal(eur.Amount))
+}
+
+type decimalInvoice struct {
+	bun.BaseModel `bun:"table:decimal_invoices"`
+
+	ID       int64       `bun:"id,pk,autoincrement"`
+	Total    Money       `bun:"embed:total_"`
+	Discount NullDecimal `bun:"discount"`
+}
+
+func TestDecimal_SQLiteRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*decimalInvoice)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	invoice := &decimalInvoice{Total: NewMoney(MustParseDecimal("12345678901234567890.10"), "USD")}
+	_, err = db.NewInsert().Model(invoice).Exec(ctx)
+	require.NoError(t, err)
+
+	var loaded decimalInvoice
+	require.NoError(t, db.NewSelect().Model(&loaded).Where("id = ?", invoice.ID).Scan(ctx))
+	assert.Equal(t, "12345678901234567890.10", loaded.Total.Amount.String())
+	assert.Equal(t, "USD", loaded.Total.Currency)
+	assert.False(t, loaded.Discount.Valid)
+}
+
+func TestDecimalSQLType(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	assert.Equal(t, "TEXT", DecimalSQLType(db, 20, 4))
+	assert.Equal(t, "NUMERIC(20,4)", DecimalSQLType(bun.NewDB(nil, pgdialect.New()), 20, 4))
+}
@@ -0,0 +1,112 @@
+package persistence
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// dialectBlockEnd closes a statement level dialect block:
+//
+//	---bun:dialect:postgres
+//	CREATE INDEX CONCURRENTLY users_email_idx ON users (email);
+//	---bun:end
+//	---bun:dialect:sqlite
+//	CREATE INDEX users_email_idx ON users (email);
+//	---bun:end
+//
+// A dialect annotation followed by ---bun:end, before any other
+// annotation, opens a block. Otherwise it scopes the whole file.
+const dialectBlockEnd = "---bun:end"
+
+type dialectLine struct {
+	text       string
+	annotation bool
+	end        bool
+	blockStart bool
+	dialects   []string // dialects of the enclosing block, if any
+}
+
+func (o dialectOptions) scanDialectLines(data []byte) []dialectLine {
+	raw := strings.Split(string(data), "\n")
+	lines := make([]dialectLine, len(raw))
+	for i, text := range raw {
+		trimmed := strings.ToLower(strings.TrimSpace(text))
+		lines[i] = dialectLine{
+			text:       text,
+			annotation: strings.HasPrefix(trimmed, dialectAnnotationPrefix),
+			end:        trimmed == dialectBlockEnd,
+		}
+	}
+
+	var current []string
+	for i := range lines {
+		switch {
+		case lines[i].annotation:
+			if opensDialectBlock(lines, i) {
+				lines[i].blockStart = true
+				current = o.parseDialectAnnotation(lines[i].text)
+				if current == nil {
+					current = []string{}
+				}
+			}
+		case lines[i].end:
+			current = nil
+		default:
+			lines[i].dialects = current
+		}
+	}
+	return lines
+}
+
+func opensDialectBlock(lines []dialectLine, i int) bool {
+	for j := i + 1; j < len(lines); j++ {
+		if lines[j].end {
+			return true
+		}
+		if lines[j].annotation {
+			return false
+		}
+	}
+	return false
+}
+
+func (o dialectOptions) parseDialectAnnotation(line string) []string {
+	line = strings.TrimSpace(line)
+	value := strings.TrimSpace(line[len(dialectAnnotationPrefix):])
+	if value == "" {
+		return nil
+	}
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	var dialects []string
+	for _, field := range fields {
+		if normalized := o.normalize(field); normalized != "" {
+			dialects = append(dialects, normalized)
+		}
+	}
+	return dialects
+}
+
+// filterDialectBlocks blanks out the lines of blocks scoped to other
+// dialects, along with the block markers, keeping line numbers intact.
+func (o dialectOptions) filterDialectBlocks(data []byte, dialect string) []byte {
+	if !bytes.Contains(bytes.ToLower(data), []byte(dialectBlockEnd)) {
+		return data
+	}
+
+	lines := o.scanDialectLines(data)
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		switch {
+		case line.blockStart, line.end:
+			out[i] = ""
+		case line.dialects != nil && !slices.Contains(line.dialects, dialect):
+			out[i] = ""
+		default:
+			out[i] = line.text
+		}
+	}
+	return []byte(strings.Join(out, "\n"))
+}
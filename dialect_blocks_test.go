@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterDialectBlocks(t *testing.T) {
+	opts := defaultDialectOptions()
+	data := []byte(`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);
+---bun:dialect:postgres
+CREATE INDEX CONCURRENTLY users_email_idx ON users (email);
+---bun:end
+---bun:dialect:sqlite3
+CREATE INDEX users_email_idx ON users (email);
+---bun:END
+SELECT 1;`)
+
+	assert.Empty(t, opts.extractDialects(data))
+	assert.Equal(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);
+
+
+
+
+CREATE INDEX users_email_idx ON users (email);
+
+SELECT 1;`, string(opts.filterDialectBlocks(data, "sqlite")))
+
+	fileLevel := []byte("---bun:dialect:postgres\nSELECT 1;")
+	assert.Equal(t, []string{"postgres"}, opts.extractDialects(fileLevel))
+	assert.Equal(t, fileLevel, opts.filterDialectBlocks(fileLevel, "sqlite"))
+}
+
+func TestDialectBlocksMigrate(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := fstest.MapFS{
+		"0001_blocks.up.sql": {Data: []byte(`CREATE TABLE blk_users (id INTEGER PRIMARY KEY, email TEXT);
+---bun:dialect:postgres
+CREATE INDEX CONCURRENTLY blk_users_email_idx ON blk_users (email);
+---bun:end
+---bun:dialect:sqlite
+CREATE INDEX blk_users_email_idx ON blk_users (email);
+---bun:end
+`)},
+	}
+
+	migrations := NewMigrations()
+	migrations.RegisterDialectMigrations(fsys)
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var indexes int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'blk_users_email_idx'").Scan(ctx, &indexes))
+	assert.Equal(t, 1, indexes)
+}
@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+)
+
+// Migration layer names for WithLayerPrecedence
+const (
+	MigrationLayerDialect = "dialect"
+	MigrationLayerRoot    = "root"
+	MigrationLayerCommon  = "common"
+)
+
+var defaultLayerPrecedence = []migrationLayer{layerDialect, layerRoot, layerCommon}
+
+// WithLayerPrecedence sets which layer wins when the same migration
+// version exists in more than one layer, highest precedence first. The
+// winning layer shadows the whole migration, both its up and down
+// files, in the other layers. Layers not listed keep their default
+// relative order: dialect, root, common.
+//
+//	persistence.WithLayerPrecedence(persistence.MigrationLayerRoot, persistence.MigrationLayerDialect)
+func WithLayerPrecedence(layers ...string) DialectMigrationOption {
+	return func(opts *dialectOptions) {
+		if opts == nil {
+			return
+		}
+		opts.precedence = nil
+		for _, name := range layers {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case MigrationLayerDialect:
+				opts.precedence = append(opts.precedence, layerDialect)
+			case MigrationLayerRoot:
+				opts.precedence = append(opts.precedence, layerRoot)
+			case MigrationLayerCommon:
+				opts.precedence = append(opts.precedence, layerCommon)
+			}
+		}
+	}
+}
+
+func (o dialectOptions) layerPrecedence() []migrationLayer {
+	out := make([]migrationLayer, 0, len(defaultLayerPrecedence))
+	seen := map[migrationLayer]struct{}{}
+	for _, layer := range append(append([]migrationLayer(nil), o.precedence...), defaultLayerPrecedence...) {
+		if _, ok := seen[layer]; ok {
+			continue
+		}
+		seen[layer] = struct{}{}
+		out = append(out, layer)
+	}
+	return out
+}
+
+// shadowLayers removes from each layer the migration versions already
+// provided by a layer with higher precedence.
+func shadowLayers(layers map[migrationLayer]fs.FS, precedence []migrationLayer) {
+	claimed := map[string]struct{}{}
+	for _, layer := range precedence {
+		files, ok := layers[layer].(fstest.MapFS)
+		if !ok {
+			continue
+		}
+		provided := map[string]struct{}{}
+		for path := range files {
+			key := migrationVersionKey(path)
+			if _, ok := claimed[key]; ok {
+				delete(files, path)
+				continue
+			}
+			provided[key] = struct{}{}
+		}
+		for key := range provided {
+			claimed[key] = struct{}{}
+		}
+	}
+}
+
+// migrationVersionKey returns the version bun uses to identify the
+// migration in path, or the path itself for unrecognized names.
+func migrationVersionKey(path string) string {
+	if matches := orderedMigrationNameRE.FindStringSubmatch(strings.ToLower(filepath.Base(path))); matches != nil {
+		return matches[1]
+	}
+	return path
+}
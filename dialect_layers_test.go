@@ -0,0 +1,46 @@
+package persistence
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectLayerShadowing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_init.up.sql":                 {Data: []byte("root up")},
+		"0001_init.down.sql":               {Data: []byte("root down")},
+		"common/0001_init_common.up.sql":   {Data: []byte("common up")},
+		"common/0002_base.up.sql":          {Data: []byte("common base")},
+		"sqlite/0001_init_sqlite.up.sql":   {Data: []byte("sqlite up")},
+		"sqlite/0003_sqlite_only.up.sql":   {Data: []byte("sqlite only")},
+		"postgres/0003_pg_only.up.sql":     {Data: []byte("pg only")},
+		"postgres/0003_pg_only.down.sql":   {Data: []byte("pg only down")},
+		"sqlite/nested/0004_deep.up.sql":   {Data: []byte("sqlite deep")},
+		"common/nested/0004_deep.down.sql": {Data: []byte("common deep down")},
+	}
+
+	reg := dialectRegistration{root: fsys, opts: defaultDialectOptions()}
+	result, err := reg.buildForDialect("sqlite")
+	require.NoError(t, err)
+
+	files := collectFilesFromSources(t, result.fileSystems)
+	assert.Equal(t, map[string]string{
+		"0001_init_sqlite.up.sql": "sqlite up",
+		"0002_base.up.sql":        "common base",
+		"0003_sqlite_only.up.sql": "sqlite only",
+		"nested/0004_deep.up.sql": "sqlite deep",
+	}, files)
+
+	WithLayerPrecedence(MigrationLayerRoot)(&reg.opts)
+	result, err = reg.buildForDialect("sqlite")
+	require.NoError(t, err)
+
+	files = collectFilesFromSources(t, result.fileSystems)
+	assert.Equal(t, "root up", files["0001_init.up.sql"])
+	assert.Equal(t, "root down", files["0001_init.down.sql"])
+	assert.NotContains(t, files, "0001_init_sqlite.up.sql")
+	assert.NotContains(t, files, "0001_init_common.up.sql")
+}
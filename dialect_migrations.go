@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"path/filepath"
 	"sort"
@@ -52,9 +53,11 @@ var defaultDialectAliases = map[string]string{
 	"postgresql": "postgres",
 	"pg":         "postgres",
 	"pgdialect":  "postgres",
+	"pgx":        "postgres",
 	"sqlite":     "sqlite",
 	"sqlite3":    "sqlite",
 	"sqldialect": "sqlite",
+	"sqliteshim": "sqlite",
 }
 
 // DialectMigrationOption configures dialect-aware migration registration.
@@ -82,6 +85,11 @@ type dialectOptions struct {
 	sourceLabel       string
 	contract          *DialectValidationContract
 	validateOnMigrate bool
+	metadataOnly      bool
+	transpiler        DialectTranspiler
+	validationModels  []any
+	registeredModels  bool
+	precedence        []migrationLayer
 }
 
 type dialectRegistration struct {
@@ -241,6 +249,21 @@ func WithValidateOnMigrate(enabled bool) DialectMigrationOption {
 	}
 }
 
+// WithMetadataOnlyValidation makes dialect validation read only the
+// header of every SQL file, its leading comment and blank lines, to find
+// the file level annotations instead of loading whole files for every
+// target. File level annotations must then be part of the header, and a
+// dialect block opened in the header is read as a file level
+// annotation. Migrations and model table checks still read whole files.
+func WithMetadataOnlyValidation(enabled bool) DialectMigrationOption {
+	return func(opts *dialectOptions) {
+		if opts == nil {
+			return
+		}
+		opts.metadataOnly = enabled
+	}
+}
+
 func (o dialectOptions) normalize(name string) string {
 	n := strings.ToLower(strings.TrimSpace(name))
 	if n == "" {
@@ -300,33 +323,21 @@ func (o dialectOptions) candidateDirectories(name string) []string {
 	return dirs
 }
 
+// extractDialects returns the file level dialect annotations.
+// Annotations opening a statement block are ignored, see dialect_blocks.go.
 func (o dialectOptions) extractDialects(data []byte) []string {
-	scanner := bufio.NewScanner(bytes.NewReader(data))
 	var dialects []string
 	seen := map[string]struct{}{}
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		if !strings.HasPrefix(strings.ToLower(line), dialectAnnotationPrefix) {
+	for _, line := range o.scanDialectLines(data) {
+		if !line.annotation || line.blockStart {
 			continue
 		}
-		value := strings.TrimSpace(line[len(dialectAnnotationPrefix):])
-		if value == "" {
-			continue
-		}
-		fields := strings.FieldsFunc(value, func(r rune) bool {
-			return r == ',' || r == ';' || r == ' ' || r == '\t'
-		})
-		for _, field := range fields {
-			if normalized := o.normalize(field); normalized != "" {
-				if _, ok := seen[normalized]; ok {
-					continue
-				}
-				seen[normalized] = struct{}{}
-				dialects = append(dialects, normalized)
+		for _, normalized := range o.parseDialectAnnotation(line.text) {
+			if _, ok := seen[normalized]; ok {
+				continue
 			}
+			seen[normalized] = struct{}{}
+			dialects = append(dialects, normalized)
 		}
 	}
 	return dialects
@@ -350,6 +361,23 @@ func (r dialectRegistration) buildForDialect(name string) (dialectBuildResult, e
 	return builder.build()
 }
 
+// buildForValidation builds the layers of target for validation. In
+// metadata only mode the files are listed without their content and
+// the header annotations are shared across targets through headers.
+func (r dialectRegistration) buildForValidation(target string, headers map[string][]string) (dialectBuildResult, error) {
+	if !r.opts.metadataOnly {
+		return r.buildForDialect(target)
+	}
+	builder := dialectFSBuilder{
+		root:         r.root,
+		dialect:      target,
+		opts:         r.opts,
+		metadataOnly: true,
+		headers:      headers,
+	}
+	return builder.build()
+}
+
 func (r dialectRegistration) resolveDialect(ctx context.Context, db *bun.DB) (string, error) {
 	if r.opts.explicitDialect != "" {
 		return r.opts.explicitDialect, nil
@@ -437,9 +465,10 @@ func (r dialectRegistration) validate(ctx context.Context, db *bun.DB, idx int)
 		ValidationContract: contract,
 	}
 	inventories := make(map[string]dialectSQLInventory, len(normalizedTargets))
+	headers := make(map[string][]string)
 
 	for _, target := range normalizedTargets {
-		buildResult, err := r.buildForDialect(target)
+		buildResult, err := r.buildForValidation(target, headers)
 		if err != nil {
 			return err
 		}
@@ -467,6 +496,14 @@ func (r dialectRegistration) validate(ctx context.Context, db *bun.DB, idx int)
 		result.MissingDialects[target] = dedupeStrings(reasons)
 	}
 
+	if models := r.opts.models(); len(models) > 0 && db != nil {
+		for dialect, reasons := range r.modelTableReasons(db, models, normalizedTargets) {
+			existing := result.MissingDialects[dialect]
+			existing = append(existing, reasons...)
+			result.MissingDialects[dialect] = dedupeStrings(existing)
+		}
+	}
+
 	if contract != nil && contract.RequireVersionParityAcrossTargets {
 		for dialect, reasons := range versionParityReasons(inventories, normalizedTargets) {
 			existing := result.MissingDialects[dialect]
@@ -692,6 +729,10 @@ type dialectFSBuilder struct {
 	root    fs.FS
 	dialect string
 	opts    dialectOptions
+	// metadataOnly lists the matching files without their content,
+	// headers caches the header annotations by layer and path.
+	metadataOnly bool
+	headers      map[string][]string
 }
 
 func (b dialectFSBuilder) build() (dialectBuildResult, error) {
@@ -701,33 +742,46 @@ func (b dialectFSBuilder) build() (dialectBuildResult, error) {
 		diagnostics: make([]layerDiagnostic, 0, 3),
 	}
 
-	if fsCommon, diag, err := b.buildCommonLayer(); err != nil {
-		result.diagnostics = append(result.diagnostics, diag)
-		return result, err
-	} else {
+	layers := make(map[migrationLayer]fs.FS, 3)
+	builders := []struct {
+		layer migrationLayer
+		build func() (fs.FS, layerDiagnostic, error)
+	}{
+		{layerCommon, b.buildCommonLayer},
+		{layerRoot, b.buildRootLayer},
+		{layerDialect, b.buildDialectLayer},
+	}
+	for _, builder := range builders {
+		layerFS, diag, err := builder.build()
 		result.diagnostics = append(result.diagnostics, diag)
-		if fsCommon != nil {
-			result.fileSystems = append(result.fileSystems, fsCommon)
+		if err != nil {
+			return result, err
+		}
+		if layerFS != nil {
+			layers[builder.layer] = layerFS
 		}
 	}
 
-	if fsRoot, diag, err := b.buildRootLayer(); err != nil {
-		result.diagnostics = append(result.diagnostics, diag)
-		return result, err
-	} else {
-		result.diagnostics = append(result.diagnostics, diag)
-		if fsRoot != nil {
-			result.fileSystems = append(result.fileSystems, fsRoot)
+	precedence := b.opts.layerPrecedence()
+	shadowLayers(layers, precedence)
+
+	if b.opts.transpiler != nil && !b.metadataOnly {
+		shared := make([]fs.FS, 0, 2)
+		for _, layer := range []migrationLayer{layerCommon, layerRoot} {
+			if layerFS, ok := layers[layer]; ok {
+				shared = append(shared, layerFS)
+			}
+		}
+		if err := b.transpileShared(shared, layers[layerDialect]); err != nil {
+			return result, apierrors.Wrap(err, apierrors.CategoryInternal, "dialect transpiler failed").
+				WithMetadata(map[string]any{"dialect": b.dialect})
 		}
 	}
 
-	if fsDialect, diag, err := b.buildDialectLayer(); err != nil {
-		result.diagnostics = append(result.diagnostics, diag)
-		return result, err
-	} else {
-		result.diagnostics = append(result.diagnostics, diag)
-		if fsDialect != nil {
-			result.fileSystems = append(result.fileSystems, fsDialect)
+	// discover lowest precedence first so the highest one wins any remaining overlap
+	for i := len(precedence) - 1; i >= 0; i-- {
+		if layerFS, ok := layers[precedence[i]]; ok {
+			result.fileSystems = append(result.fileSystems, layerFS)
 		}
 	}
 
@@ -816,6 +870,17 @@ func (b dialectFSBuilder) collectLayer(fsys fs.FS, layer migrationLayer, name st
 
 		totalCandidates++
 
+		if b.metadataOnly {
+			dialects, err := b.headerDialects(fsys, name, path)
+			if err != nil {
+				return err
+			}
+			if b.includes(dialects) {
+				files[path] = &fstest.MapFile{Mode: 0o644}
+			}
+			return nil
+		}
+
 		data, err := fs.ReadFile(fsys, path)
 		if err != nil {
 			return err
@@ -823,6 +888,7 @@ func (b dialectFSBuilder) collectLayer(fsys fs.FS, layer migrationLayer, name st
 		if !b.shouldInclude(data) {
 			return nil
 		}
+		data = b.opts.filterDialectBlocks(data, b.dialect)
 
 		files[path] = &fstest.MapFile{
 			Data: data,
@@ -853,7 +919,10 @@ func (b dialectFSBuilder) collectLayer(fsys fs.FS, layer migrationLayer, name st
 }
 
 func (b dialectFSBuilder) shouldInclude(data []byte) bool {
-	dialects := b.opts.extractDialects(data)
+	return b.includes(b.opts.extractDialects(data))
+}
+
+func (b dialectFSBuilder) includes(dialects []string) bool {
 	if len(dialects) == 0 {
 		return true
 	}
@@ -865,6 +934,58 @@ func (b dialectFSBuilder) shouldInclude(data []byte) bool {
 	return false
 }
 
+// headerDialects returns the file level annotations of the header of
+// path in the layer directory dir, reading them once per validation.
+func (b dialectFSBuilder) headerDialects(fsys fs.FS, dir, path string) ([]string, error) {
+	key := dir + "\x00" + path
+	if dialects, ok := b.headers[key]; ok {
+		return dialects, nil
+	}
+	header, err := readSQLHeader(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	dialects := b.opts.extractDialects(header)
+	if b.headers != nil {
+		b.headers[key] = dialects
+	}
+	return dialects, nil
+}
+
+// readSQLHeader reads the leading comment and blank lines of a SQL
+// file, stopping at the first statement line.
+func readSQLHeader(fsys fs.FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header []byte
+	r := bufio.NewReader(f)
+	for {
+		line, isPrefix, err := r.ReadLine()
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && !bytes.HasPrefix(trimmed, []byte("--")) {
+			return header, nil
+		}
+		header = append(header, line...)
+		// annotations are short, skip the rest of long comment lines
+		for isPrefix {
+			if _, isPrefix, err = r.ReadLine(); err != nil {
+				return header, nil
+			}
+		}
+		header = append(header, '\n')
+	}
+}
+
 func openSubFS(fsys fs.FS, dir string) (fs.FS, bool, error) {
 	if dir == "" {
 		return nil, false, nil
@@ -0,0 +1,118 @@
+package persistence
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+var createTableRE = regexp.MustCompile("(?i)\\bCREATE\\s+(?:TEMP\\w*\\s+|UNLOGGED\\s+)?TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?([\\w.\"`\\[\\]]+)")
+
+// WithValidationModels makes dialect validation assert that the table of
+// every given model is created by at least one up migration for each
+// validation target.
+func WithValidationModels(models ...any) DialectMigrationOption {
+	return func(opts *dialectOptions) {
+		if opts == nil {
+			return
+		}
+		opts.validationModels = append(opts.validationModels, models...)
+	}
+}
+
+// WithRegisteredModelValidation is WithValidationModels for every model
+// registered with RegisterModel and RegisterMany2ManyModel.
+func WithRegisteredModelValidation() DialectMigrationOption {
+	return func(opts *dialectOptions) {
+		if opts == nil {
+			return
+		}
+		opts.registeredModels = true
+	}
+}
+
+func (o dialectOptions) models() []any {
+	models := append([]any(nil), o.validationModels...)
+	if o.registeredModels {
+		models = append(models, RegisteredModels()...)
+	}
+	return models
+}
+
+// modelTableReasons reports, per target, the model tables that no up
+// migration creates.
+func (r dialectRegistration) modelTableReasons(db *bun.DB, models []any, targets []string) map[string][]string {
+	tables := make(map[string]string)
+	for _, model := range models {
+		typ := modelType(reflect.TypeOf(model))
+		if typ == nil {
+			continue
+		}
+		table := db.Dialect().Tables().Get(typ)
+		tables[strings.ToLower(string(table.Name))] = typ.String()
+	}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string][]string)
+	for _, target := range targets {
+		buildResult, err := r.buildForDialect(target)
+		if err != nil {
+			out[target] = append(out[target], err.Error())
+			continue
+		}
+		created, err := createdTables(buildResult.fileSystems)
+		if err != nil {
+			out[target] = append(out[target], err.Error())
+			continue
+		}
+		for _, name := range names {
+			if _, ok := created[name]; !ok {
+				out[target] = append(out[target], fmt.Sprintf("table %q for model %s is not created by any migration", name, tables[name]))
+			}
+		}
+	}
+	for target := range out {
+		out[target] = dedupeStrings(out[target])
+	}
+	return out
+}
+
+func createdTables(sources []fs.FS) (map[string]struct{}, error) {
+	created := make(map[string]struct{})
+	for _, source := range sources {
+		err := fs.WalkDir(source, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(strings.ToLower(path), ".up.sql") {
+				return nil
+			}
+			data, err := fs.ReadFile(source, path)
+			if err != nil {
+				return err
+			}
+			for _, match := range createTableRE.FindAllStringSubmatch(string(data), -1) {
+				name := match[1]
+				if idx := strings.LastIndex(name, "."); idx >= 0 {
+					name = name[idx+1:]
+				}
+				created[strings.ToLower(strings.Trim(name, "\"`[]"))] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
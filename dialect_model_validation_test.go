@@ -0,0 +1,49 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type validationUser struct {
+	bun.BaseModel `bun:"table:users"`
+	ID            int64 `bun:"id,pk"`
+}
+
+type validationOrder struct {
+	bun.BaseModel `bun:"table:orders"`
+	ID            int64 `bun:"id,pk"`
+}
+
+func TestValidateDialectsModelTables(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := fstest.MapFS{
+		"common/0001_users.up.sql":    {Data: []byte(`CREATE TABLE IF NOT EXISTS "users" (id BIGINT PRIMARY KEY);`)},
+		"postgres/0002_orders.up.sql": {Data: []byte(`CREATE TABLE public.orders (id BIGINT PRIMARY KEY);`)},
+	}
+
+	var result DialectValidationResult
+	migrations := NewMigrations()
+	migrations.RegisterDialectMigrations(fsys,
+		WithValidationTargets("postgres", "sqlite"),
+		WithValidationModels((*validationUser)(nil), (*validationOrder)(nil)),
+		WithDialectValidator(func(ctx context.Context, r DialectValidationResult) error {
+			result = r
+			return nil
+		}),
+	)
+
+	require.NoError(t, migrations.ValidateDialects(ctx, db))
+	assert.NotContains(t, result.MissingDialects, "postgres")
+	assert.Equal(t, []string{
+		`table "orders" for model persistence.validationOrder is not created by any migration`,
+	}, result.MissingDialects["sqlite"])
+}
@@ -0,0 +1,103 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// ErrUnknownDialect is returned when a dialect name is not recognized.
+var ErrUnknownDialect = errors.New("persistence: unknown dialect")
+
+// ResolveFromEnv resolves the dialect from the environment variable key.
+// An unset variable falls back to the database dialect; an unknown value
+// returns an error wrapping ErrUnknownDialect.
+func ResolveFromEnv(key string) DialectResolver {
+	return func(context.Context, *bun.DB) (string, error) {
+		value := strings.TrimSpace(os.Getenv(key))
+		if value == "" {
+			return "", nil
+		}
+		if name := normalizeDialectName(value); name != "" {
+			return name, nil
+		}
+		accepted := slices.Sorted(maps.Keys(defaultDialectAliases))
+		return "", apierrors.Wrap(ErrUnknownDialect, apierrors.CategoryValidation,
+			fmt.Sprintf("%s=%q is not a known dialect, accepted values: %s", key, value, strings.Join(accepted, ", ")),
+		).WithMetadata(map[string]any{"key": key, "value": value, "accepted": accepted})
+	}
+}
+
+// ResolveFromDSN resolves the dialect from a connection string, e.g.
+// postgres://..., file:app.db?cache=shared or :memory:.
+func ResolveFromDSN(dsn string) DialectResolver {
+	return func(context.Context, *bun.DB) (string, error) {
+		name := DialectFromDSN(dsn)
+		if name == "" && strings.TrimSpace(dsn) != "" {
+			return "", fmt.Errorf("persistence: cannot detect dialect from dsn")
+		}
+		return name, nil
+	}
+}
+
+// ResolveFromConfig resolves the dialect from the config driver and,
+// when the config implements GetDSN, from its DSN.
+func ResolveFromConfig(cfg Config) DialectResolver {
+	return func(context.Context, *bun.DB) (string, error) {
+		if cfg == nil {
+			return "", nil
+		}
+		if name := normalizeDialectName(cfg.GetDriver()); name != "" {
+			return name, nil
+		}
+		if dsnCfg, ok := cfg.(interface{ GetDSN() string }); ok {
+			return DialectFromDSN(dsnCfg.GetDSN()), nil
+		}
+		return "", nil
+	}
+}
+
+// DialectFromDSN returns the canonical dialect name for dsn, or an empty
+// string if it cannot be detected.
+func DialectFromDSN(dsn string) string {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" {
+		return ""
+	}
+	lower := strings.ToLower(dsn)
+
+	if u, err := url.Parse(lower); err == nil && u.Scheme != "" {
+		switch u.Scheme {
+		case "file":
+			return "sqlite"
+		default:
+			if name := normalizeDialectName(u.Scheme); name != "" {
+				return name
+			}
+		}
+	}
+
+	switch {
+	case lower == ":memory:", strings.HasPrefix(lower, "file:"):
+		return "sqlite"
+	case strings.HasSuffix(lower, ".db"), strings.HasSuffix(lower, ".sqlite"), strings.HasSuffix(lower, ".sqlite3"):
+		return "sqlite"
+	case strings.Contains(lower, "host=") || strings.Contains(lower, "dbname="):
+		return "postgres"
+	}
+	return ""
+}
+
+// normalizeDialectName maps known aliases, e.g. "pgx" or "sqlite3",
+// to their canonical name. Unknown names return an empty string.
+func normalizeDialectName(name string) string {
+	return defaultDialectAliases[strings.ToLower(strings.TrimSpace(name))]
+}
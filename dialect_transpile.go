@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"io/fs"
+	"regexp"
+	"testing/fstest"
+)
+
+// DialectTranspiler adapts the SQL of a shared migration to the target
+// dialect. It returns the SQL unchanged when it has nothing to adapt.
+type DialectTranspiler func(target, path string, sql []byte) ([]byte, error)
+
+// WithDialectTranspiler transpiles common and root migrations for the
+// target dialect when no dialect-specific file with the same name exists.
+// Use PostgresToSQLiteTranspiler for migrations written for Postgres.
+func WithDialectTranspiler(transpiler DialectTranspiler) DialectMigrationOption {
+	return func(opts *dialectOptions) {
+		if opts == nil {
+			return
+		}
+		opts.transpiler = transpiler
+	}
+}
+
+type transpileRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+var postgresToSQLiteRules = []transpileRule{
+	{regexp.MustCompile(`(?i)\b(BIG|SMALL)?SERIAL\s+PRIMARY\s+KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\b(BIG|SMALL)?SERIAL\b`), "INTEGER"},
+	{regexp.MustCompile(`(?i)\bTIMESTAMP\s+WITH(OUT)?\s+TIME\s+ZONE\b`), "TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\bTIMESTAMPTZ\b`), "TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\bJSONB?\b`), "TEXT"},
+	{regexp.MustCompile(`(?i)\bUUID\b`), "TEXT"},
+	{regexp.MustCompile(`(?i)\bBYTEA\b`), "BLOB"},
+	{regexp.MustCompile(`(?i)\bDOUBLE\s+PRECISION\b`), "REAL"},
+	{regexp.MustCompile(`(?i)\bNOW\(\)`), "CURRENT_TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\b(CREATE\s+(UNIQUE\s+)?INDEX|DROP\s+INDEX)\s+CONCURRENTLY\b`), "$1"},
+	{regexp.MustCompile(`::[A-Za-z_][A-Za-z0-9_]*(\[\])?`), ""},
+}
+
+// PostgresToSQLiteTranspiler rewrites common Postgres DDL to SQLite:
+// SERIAL keys become INTEGER PRIMARY KEY AUTOINCREMENT, TIMESTAMPTZ,
+// JSONB, UUID and BYTEA map to SQLite storage classes, NOW() becomes
+// CURRENT_TIMESTAMP and CONCURRENTLY and ::casts are dropped. Other
+// targets are returned unchanged.
+func PostgresToSQLiteTranspiler(target, _ string, sql []byte) ([]byte, error) {
+	if target != "sqlite" {
+		return sql, nil
+	}
+	for _, rule := range postgresToSQLiteRules {
+		sql = rule.re.ReplaceAll(sql, []byte(rule.repl))
+	}
+	return sql, nil
+}
+
+// transpileShared transpiles the files of the shared layers that the
+// dialect layer does not override.
+func (b dialectFSBuilder) transpileShared(shared []fs.FS, dialectLayer fs.FS) error {
+	overrides, _ := dialectLayer.(fstest.MapFS)
+	for _, layer := range shared {
+		files, ok := layer.(fstest.MapFS)
+		if !ok {
+			continue
+		}
+		for path, file := range files {
+			if _, ok := overrides[path]; ok {
+				continue
+			}
+			data, err := b.opts.transpiler(b.dialect, path, file.Data)
+			if err != nil {
+				return err
+			}
+			file.Data = data
+		}
+	}
+	return nil
+}
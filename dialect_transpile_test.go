@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresToSQLiteTranspiler(t *testing.T) {
+	in := []byte(`CREATE TABLE events (
+	id BIGSERIAL PRIMARY KEY,
+	ref UUID NOT NULL,
+	payload JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	seq SERIAL
+);
+CREATE INDEX CONCURRENTLY events_ref_idx ON events (ref);
+UPDATE events SET payload = '{}'::jsonb;`)
+
+	out, err := PostgresToSQLiteTranspiler("sqlite", "0001_events.up.sql", in)
+	require.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ref TEXT NOT NULL,
+	payload TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	seq INTEGER
+);
+CREATE INDEX events_ref_idx ON events (ref);
+UPDATE events SET payload = '{}';`, string(out))
+
+	out, err = PostgresToSQLiteTranspiler("postgres", "0001_events.up.sql", in)
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestDialectTranspilerFallback(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := fstest.MapFS{
+		"0001_events.up.sql":          {Data: []byte("CREATE TABLE tr_events (id BIGSERIAL PRIMARY KEY, payload JSONB)")},
+		"0002_views.up.sql":           {Data: []byte("CREATE TABLE tr_views (id BIGSERIAL PRIMARY KEY)")},
+		"sqlite/0002_views.up.sql":    {Data: []byte("CREATE TABLE tr_views_sqlite (id INTEGER PRIMARY KEY)")},
+		"postgres/0002_views.up.sql":  {Data: []byte("CREATE TABLE tr_views (id BIGSERIAL PRIMARY KEY)")},
+		"postgres/0001_events.up.sql": {Data: []byte("CREATE TABLE tr_events (id BIGSERIAL PRIMARY KEY)")},
+	}
+
+	migrations := NewMigrations()
+	migrations.RegisterDialectMigrations(fsys, WithDialectTranspiler(PostgresToSQLiteTranspiler))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var tables []string
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'tr_%' ORDER BY name").Scan(ctx, &tables))
+	assert.Equal(t, []string{"tr_events", "tr_views_sqlite"}, tables)
+}
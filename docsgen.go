@@ -0,0 +1,377 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// SchemaDoc describes the registered models and the migrations of a
+// database, see GenerateSchemaDocs.
+type SchemaDoc struct {
+	Tables     []TableDoc
+	Migrations []MigrationStatus
+}
+
+// TableDoc describes the table of a registered model.
+type TableDoc struct {
+	Name      string
+	Model     string
+	Columns   []ColumnDoc
+	Relations []RelationDoc
+}
+
+// ColumnDoc describes a model column.
+type ColumnDoc struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+	Unique     bool
+	Default    string
+}
+
+// RelationDoc describes a model relation.
+type RelationDoc struct {
+	Name  string
+	Type  string
+	Table string
+	// Through is the join table of many to many relations.
+	Through string
+	// Join lists the join conditions, e.g. "users.id = posts.user_id".
+	Join []string
+}
+
+// Relation types reported in RelationDoc.Type.
+const (
+	RelationHasOne     = "has-one"
+	RelationBelongsTo  = "belongs-to"
+	RelationHasMany    = "has-many"
+	RelationManyToMany = "many-to-many"
+)
+
+// GenerateSchemaDocs describes the models registered on db and, when
+// migrations is not nil, the status of its migrations.
+func GenerateSchemaDocs(ctx context.Context, db *bun.DB, migrations *Migrations) (*SchemaDoc, error) {
+	doc := &SchemaDoc{}
+	for _, table := range registeredTables(db) {
+		doc.Tables = append(doc.Tables, tableDoc(table, db.Dialect().DefaultSchema()))
+	}
+	sort.Slice(doc.Tables, func(i, j int) bool {
+		return doc.Tables[i].Name < doc.Tables[j].Name
+	})
+
+	if migrations != nil {
+		status, err := migrations.Status(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		doc.Migrations = status
+	}
+	return doc, nil
+}
+
+// registeredTables returns the tables known to db, without the bun
+// migrate bookkeeping tables.
+func registeredTables(db *bun.DB) []*schema.Table {
+	var tables []*schema.Table
+	for _, table := range db.Dialect().Tables().All() {
+		if table.Type.PkgPath() != "github.com/uptrace/bun/migrate" {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// SchemaDocs runs GenerateSchemaDocs with the client database and
+// migrations.
+func (c Client) SchemaDocs(ctx context.Context) (*SchemaDoc, error) {
+	return GenerateSchemaDocs(ctx, c.db, c.migrations)
+}
+
+func tableDoc(table *schema.Table, defaultSchema string) TableDoc {
+	unique := map[string]bool{}
+	for _, fields := range table.Unique {
+		if len(fields) == 1 {
+			unique[fields[0].Name] = true
+		}
+	}
+
+	doc := TableDoc{Name: tableDocName(table, defaultSchema), Model: table.TypeName}
+	for _, field := range table.Fields {
+		doc.Columns = append(doc.Columns, ColumnDoc{
+			Name:       field.Name,
+			Type:       field.CreateTableSQLType,
+			PrimaryKey: field.IsPK,
+			NotNull:    field.NotNull,
+			Unique:     unique[field.Name],
+			Default:    field.SQLDefault,
+		})
+	}
+
+	names := make([]string, 0, len(table.Relations))
+	for name := range table.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Relations = append(doc.Relations, relationDoc(table, name, table.Relations[name], defaultSchema))
+	}
+	return doc
+}
+
+func relationDoc(table *schema.Table, name string, rel *schema.Relation, defaultSchema string) RelationDoc {
+	doc := RelationDoc{Name: name, Table: tableDocName(rel.JoinTable, defaultSchema)}
+	base, join := tableDocName(table, defaultSchema), doc.Table
+	switch rel.Type {
+	case schema.HasOneRelation:
+		doc.Type = RelationHasOne
+	case schema.BelongsToRelation:
+		doc.Type = RelationBelongsTo
+	case schema.HasManyRelation:
+		doc.Type = RelationHasMany
+	case schema.ManyToManyRelation:
+		doc.Type = RelationManyToMany
+		doc.Through = tableDocName(rel.M2MTable, defaultSchema)
+		for i := range rel.BasePKs {
+			doc.Join = append(doc.Join, fmt.Sprintf("%s.%s = %s.%s", base, rel.BasePKs[i].Name, doc.Through, rel.M2MBasePKs[i].Name))
+		}
+		for i := range rel.JoinPKs {
+			doc.Join = append(doc.Join, fmt.Sprintf("%s.%s = %s.%s", doc.Through, rel.M2MJoinPKs[i].Name, join, rel.JoinPKs[i].Name))
+		}
+		return doc
+	}
+	for i := range rel.BasePKs {
+		doc.Join = append(doc.Join, fmt.Sprintf("%s.%s = %s.%s", base, rel.BasePKs[i].Name, join, rel.JoinPKs[i].Name))
+	}
+	return doc
+}
+
+// tableDocName qualifies the table name unless it is in the default schema.
+func tableDocName(table *schema.Table, defaultSchema string) string {
+	if table == nil {
+		return ""
+	}
+	if table.Schema != "" && table.Schema != defaultSchema {
+		return table.Schema + "." + table.Name
+	}
+	return table.Name
+}
+
+var mermaidWordRE = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Mermaid returns an ER diagram of the tables and their relations in
+// mermaid syntax.
+func (d *SchemaDoc) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	for _, table := range d.Tables {
+		fmt.Fprintf(&b, "    %s {\n", mermaidWordRE.ReplaceAllString(table.Name, "_"))
+		for _, column := range table.Columns {
+			typ := strings.Trim(mermaidWordRE.ReplaceAllString(column.Type, "_"), "_")
+			if typ == "" {
+				typ = "unknown"
+			}
+			fmt.Fprintf(&b, "        %s %s", typ, column.Name)
+			if column.PrimaryKey {
+				b.WriteString(" PK")
+			} else if column.Unique {
+				b.WriteString(" UK")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, table := range d.Tables {
+		for _, rel := range table.Relations {
+			var card string
+			switch rel.Type {
+			case RelationHasOne:
+				card = "||--o|"
+			case RelationBelongsTo:
+				card = "}o--||"
+			case RelationHasMany:
+				card = "||--o{"
+			case RelationManyToMany:
+				card = "}o--o{"
+			default:
+				continue
+			}
+			fmt.Fprintf(&b, "    %s %s %s : %q\n",
+				mermaidWordRE.ReplaceAllString(table.Name, "_"), card,
+				mermaidWordRE.ReplaceAllString(rel.Table, "_"), rel.Name)
+		}
+	}
+	return b.String()
+}
+
+// SchemaDocOption configures the Markdown and HTML output of a SchemaDoc.
+type SchemaDocOption func(*schemaDocOptions)
+
+type schemaDocOptions struct {
+	title   string
+	mermaid bool
+}
+
+// WithSchemaDocTitle sets the document title, "Database Schema" by default.
+func WithSchemaDocTitle(title string) SchemaDocOption {
+	return func(o *schemaDocOptions) {
+		o.title = title
+	}
+}
+
+// WithSchemaDocMermaid includes the mermaid ER diagram.
+func WithSchemaDocMermaid() SchemaDocOption {
+	return func(o *schemaDocOptions) {
+		o.mermaid = true
+	}
+}
+
+func newSchemaDocOptions(opts []SchemaDocOption) schemaDocOptions {
+	o := schemaDocOptions{title: "Database Schema"}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WriteMarkdown writes the document as Markdown to w.
+func (d *SchemaDoc) WriteMarkdown(w io.Writer, opts ...SchemaDocOption) error {
+	o := newSchemaDocOptions(opts)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", o.title)
+	if o.mermaid {
+		fmt.Fprintf(&b, "\n```mermaid\n%s```\n", d.Mermaid())
+	}
+
+	for _, table := range d.Tables {
+		fmt.Fprintf(&b, "\n## %s\n\nModel: `%s`\n\n", table.Name, table.Model)
+		b.WriteString("| Column | Type | Key | Not Null | Default |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, column := range table.Columns {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+				column.Name, column.Type, columnKey(column), yesNo(column.NotNull || column.PrimaryKey), markdownCell(column.Default))
+		}
+		if len(table.Relations) > 0 {
+			b.WriteString("\nRelations:\n\n")
+			for _, rel := range table.Relations {
+				fmt.Fprintf(&b, "- `%s` %s `%s`", rel.Name, rel.Type, rel.Table)
+				if rel.Through != "" {
+					fmt.Fprintf(&b, " through `%s`", rel.Through)
+				}
+				if len(rel.Join) > 0 {
+					fmt.Fprintf(&b, " on `%s`", strings.Join(rel.Join, " AND "))
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	if len(d.Migrations) > 0 {
+		b.WriteString("\n## Migrations\n\n")
+		b.WriteString("| Name | Applied | Migrated At | Source |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, m := range d.Migrations {
+			migratedAt := ""
+			if m.Applied {
+				migratedAt = m.MigratedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", m.Name, yesNo(m.Applied), migratedAt, markdownCell(m.Source))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func columnKey(column ColumnDoc) string {
+	switch {
+	case column.PrimaryKey:
+		return "PK"
+	case column.Unique:
+		return "UNIQUE"
+	}
+	return ""
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+var schemaDocHTML = template.Must(template.New("schema").Funcs(template.FuncMap{
+	"key":   columnKey,
+	"yesNo": yesNo,
+	"join":  strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Mermaid}}
+<pre class="mermaid">
+{{.Mermaid}}</pre>
+{{- end}}
+{{- range .Doc.Tables}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p>Model: <code>{{.Model}}</code></p>
+<table>
+<tr><th>Column</th><th>Type</th><th>Key</th><th>Not Null</th><th>Default</th></tr>
+{{- range .Columns}}
+<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{key .}}</td><td>{{yesNo (or .NotNull .PrimaryKey)}}</td><td>{{.Default}}</td></tr>
+{{- end}}
+</table>
+{{- if .Relations}}
+<ul>
+{{- range .Relations}}
+<li><code>{{.Name}}</code> {{.Type}} <a href="#{{.Table}}">{{.Table}}</a>{{if .Through}} through <code>{{.Through}}</code>{{end}}{{if .Join}} on <code>{{join .Join " AND "}}</code>{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- end}}
+{{- if .Doc.Migrations}}
+<h2>Migrations</h2>
+<table>
+<tr><th>Name</th><th>Applied</th><th>Migrated At</th><th>Source</th></tr>
+{{- range .Doc.Migrations}}
+<tr><td>{{.Name}}</td><td>{{yesNo .Applied}}</td><td>{{if .Applied}}{{.MigratedAt.UTC.Format "2006-01-02 15:04:05"}}{{end}}</td><td>{{.Source}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the document as a standalone HTML page to w. The ER
+// diagram is emitted as a mermaid block for mermaid.js to render.
+func (d *SchemaDoc) WriteHTML(w io.Writer, opts ...SchemaDocOption) error {
+	o := newSchemaDocOptions(opts)
+	data := struct {
+		Title   string
+		Mermaid string
+		Doc     *SchemaDoc
+	}{Title: o.title, Doc: d}
+	if o.mermaid {
+		data.Mermaid = d.Mermaid()
+	}
+	return schemaDocHTML.Execute(w, data)
+}
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type docsAuthor struct {
+	bun.BaseModel `bun:"table:doc_authors"`
+
+	ID    int64       `bun:"id,pk,autoincrement"`
+	Email string      `bun:"email,notnull,unique"`
+	Posts []*docsPost `bun:"rel:has-many,join:id=author_id"`
+}
+
+type docsPost struct {
+	bun.BaseModel `bun:"table:doc_posts"`
+
+	ID       int64       `bun:"id,pk,autoincrement"`
+	AuthorID int64       `bun:"author_id"`
+	Status   string      `bun:"status,default:'draft'"`
+	Author   *docsAuthor `bun:"rel:belongs-to,join:author_id=id"`
+}
+
+func TestGenerateSchemaDocs(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*docsAuthor)(nil), (*docsPost)(nil))
+	migrations := NewMigrations().RegisterSQLMigrations(modelTableMigrationFS(db, "20240101000000", "docs", (*docsAuthor)(nil), (*docsPost)(nil)))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	doc, err := GenerateSchemaDocs(ctx, db, migrations)
+	require.NoError(t, err)
+
+	require.Len(t, doc.Tables, 2)
+	authors := doc.Tables[0]
+	assert.Equal(t, "doc_authors", authors.Name)
+	assert.Equal(t, "DocsAuthor", authors.Model)
+	assert.Equal(t, ColumnDoc{Name: "email", Type: "VARCHAR", NotNull: true, Unique: true}, authors.Columns[1])
+	assert.Equal(t, []RelationDoc{{
+		Name:  "Posts",
+		Type:  RelationHasMany,
+		Table: "doc_posts",
+		Join:  []string{"doc_authors.id = doc_posts.author_id"},
+	}}, authors.Relations)
+
+	require.Len(t, doc.Migrations, 1)
+	assert.Equal(t, "20240101000000", doc.Migrations[0].Name)
+	assert.True(t, doc.Migrations[0].Applied)
+
+	var md bytes.Buffer
+	require.NoError(t, doc.WriteMarkdown(&md, WithSchemaDocMermaid()))
+	assert.Contains(t, md.String(), "# Database Schema")
+	assert.Contains(t, md.String(), "| status | VARCHAR |  | no | 'draft' |")
+	assert.Contains(t, md.String(), "- `Author` belongs-to `doc_authors` on `doc_posts.author_id = doc_authors.id`")
+	assert.Contains(t, md.String(), "doc_authors ||--o{ doc_posts : \"Posts\"")
+	assert.Contains(t, md.String(), "## Migrations")
+
+	var html bytes.Buffer
+	require.NoError(t, doc.WriteHTML(&html, WithSchemaDocTitle("Blog")))
+	assert.Contains(t, html.String(), "<h1>Blog</h1>")
+	assert.Contains(t, html.String(), `<a href="#doc_authors">doc_authors</a>`)
+	assert.NotContains(t, html.String(), "mermaid")
+}
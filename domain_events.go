@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// EventRecorder can be embedded in models to accumulate domain
+// events while the entity changes. It is ignored by bun.
+//
+//	type Order struct {
+//		bun.BaseModel `bun:"table:orders"`
+//		persistence.EventRecorder
+//		ID int64 `bun:"id,pk"`
+//	}
+type EventRecorder struct {
+	events []any
+}
+
+// RecordEvent appends a domain event
+func (r *EventRecorder) RecordEvent(events ...any) {
+	r.events = append(r.events, events...)
+}
+
+// PeekEvents returns the recorded events without clearing them
+func (r *EventRecorder) PeekEvents() []any {
+	return append([]any(nil), r.events...)
+}
+
+// PullEvents returns and clears the recorded events
+func (r *EventRecorder) PullEvents() []any {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// ClearEvents discards the recorded events
+func (r *EventRecorder) ClearEvents() {
+	r.events = nil
+}
+
+// EventSource is implemented by models embedding EventRecorder. The
+// events are read when they are published and cleared only once the
+// transaction publishing them commits.
+type EventSource interface {
+	PeekEvents() []any
+	ClearEvents()
+}
+
+// EventPublisher publishes domain events within the transaction that
+// persisted the entities, e.g. by writing them to an outbox table,
+// so events are only visible if the transaction commits.
+type EventPublisher interface {
+	Publish(ctx context.Context, tx bun.Tx, events []any) error
+}
+
+// EventPublisherFunc adapts a function to EventPublisher.
+type EventPublisherFunc func(ctx context.Context, tx bun.Tx, events []any) error
+
+// Publish implements EventPublisher
+func (f EventPublisherFunc) Publish(ctx context.Context, tx bun.Tx, events []any) error {
+	return f(ctx, tx, events)
+}
+
+// collectEvents reads the events of every entity implementing
+// EventSource without clearing them, and returns the sources read.
+func collectEvents(entities ...any) ([]any, []EventSource) {
+	var events []any
+	var sources []EventSource
+	for _, entity := range entities {
+		if source, ok := entity.(EventSource); ok {
+			events = append(events, source.PeekEvents()...)
+			sources = append(sources, source)
+		}
+	}
+	return events, sources
+}
@@ -0,0 +1,122 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type eventOrder struct {
+	bun.BaseModel `bun:"table:orders"`
+	EventRecorder
+	ID int64 `bun:"id,pk"`
+}
+
+type orderPlaced struct {
+	ID int64
+}
+
+func TestEventRecorder(t *testing.T) {
+	order := &eventOrder{ID: 1}
+	order.RecordEvent(orderPlaced{ID: 1}, "audit")
+
+	assert.Len(t, order.PeekEvents(), 2)
+	assert.Equal(t, []any{orderPlaced{ID: 1}, "audit"}, order.PullEvents())
+	assert.Empty(t, order.PullEvents())
+
+	order.RecordEvent("x")
+	order.ClearEvents()
+	assert.Empty(t, order.PeekEvents())
+}
+
+func TestUnitOfWork_PublishesEventsOnCommit(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "orders" \("id"\) VALUES \(1\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var published []any
+	uow := NewUnitOfWork(db).SetEventPublisher(EventPublisherFunc(func(ctx context.Context, tx bun.Tx, events []any) error {
+		published = append(published, events...)
+		_, err := tx.NewRaw("INSERT INTO outbox VALUES (1)").Exec(ctx)
+		return err
+	}))
+
+	order := &eventOrder{ID: 1}
+	order.RecordEvent(orderPlaced{ID: 1})
+	require.NoError(t, uow.RegisterNew(order))
+	require.NoError(t, uow.Commit(context.Background()))
+
+	assert.Equal(t, []any{orderPlaced{ID: 1}}, published)
+	assert.Empty(t, order.PeekEvents())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_PublishFailureRollsBack(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	publishErr := errors.New("outbox unavailable")
+	var published []any
+	uow := NewUnitOfWork(db).SetEventPublisher(EventPublisherFunc(func(ctx context.Context, tx bun.Tx, events []any) error {
+		if publishErr != nil {
+			return publishErr
+		}
+		published = append(published, events...)
+		return nil
+	}))
+
+	order := &eventOrder{ID: 1}
+	order.RecordEvent(orderPlaced{ID: 1})
+	require.NoError(t, uow.RegisterNew(order))
+
+	err = uow.Commit(context.Background())
+	assert.ErrorIs(t, err, publishErr)
+	assert.Equal(t, []any{orderPlaced{ID: 1}}, order.PeekEvents(), "events are kept for a retry")
+
+	publishErr = nil
+	require.NoError(t, uow.Commit(context.Background()))
+	assert.Equal(t, []any{orderPlaced{ID: 1}}, published)
+	assert.Empty(t, order.PeekEvents())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_KeepsEventsWithoutPublisher(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	order := &eventOrder{ID: 1}
+	order.RecordEvent(orderPlaced{ID: 1})
+	uow := NewUnitOfWork(db)
+	require.NoError(t, uow.RegisterNew(order))
+	require.NoError(t, uow.Commit(context.Background()))
+
+	assert.Equal(t, []any{orderPlaced{ID: 1}}, order.PeekEvents())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
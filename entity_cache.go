@@ -0,0 +1,268 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const defaultEntityCacheSize = 10000
+
+// EntityCacheOption configures an EntityCache
+type EntityCacheOption func(*entityCacheOptions)
+
+type entityCacheOptions struct {
+	ttl        time.Duration
+	maxEntries int
+	findOpts   []FindByIDsOption
+}
+
+// WithEntityCacheTTL expires entries after ttl. Zero disables expiry.
+func WithEntityCacheTTL(ttl time.Duration) EntityCacheOption {
+	return func(o *entityCacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithEntityCacheSize caps the number of cached entities.
+func WithEntityCacheSize(n int) EntityCacheOption {
+	return func(o *entityCacheOptions) {
+		o.maxEntries = n
+	}
+}
+
+// WithEntityCacheFindOptions passes options to FindByIDs on cache misses.
+func WithEntityCacheFindOptions(opts ...FindByIDsOption) EntityCacheOption {
+	return func(o *entityCacheOptions) {
+		o.findOpts = append(o.findOpts, opts...)
+	}
+}
+
+// EntityCacheStats reports cache counters
+type EntityCacheStats struct {
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+	Entries       int
+	Generation    uint64
+}
+
+// HitRatio returns hits / (hits + misses), or 0 when nothing was read.
+func (s EntityCacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// EntityCache is a read-through cache of entities keyed by primary key.
+//
+// Every entry is tagged with the cache generation at load time. Writes
+// to the table bump the generation, which makes all older entries
+// stale. Register the cache as a query hook to invalidate on writes:
+//
+//	cache := persistence.NewEntityCache[User, int64](db)
+//	client, _ := persistence.New(cfg, sqlDB, dialect, persistence.WithQueryHooks(cache))
+//
+// External change feeds (e.g. LISTEN/NOTIFY) can call Invalidate or
+// InvalidateAll directly.
+type EntityCache[T any, ID comparable] struct {
+	db    bun.IDB
+	table string
+	opts  entityCacheOptions
+
+	mu      sync.RWMutex
+	entries map[ID]entityCacheEntry[T]
+	// keyGenerations counts Invalidate calls per ID while loads are in
+	// flight, so a load that raced an Invalidate does not store.
+	keyGenerations map[ID]uint64
+	loading        int
+
+	generation    atomic.Uint64
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+type entityCacheEntry[T any] struct {
+	value      T
+	generation uint64
+	expiresAt  time.Time
+}
+
+// NewEntityCache creates a cache for T
+func NewEntityCache[T any, ID comparable](db bun.IDB, opts ...EntityCacheOption) *EntityCache[T, ID] {
+	options := entityCacheOptions{maxEntries: defaultEntityCacheSize}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if options.maxEntries <= 0 {
+		options.maxEntries = defaultEntityCacheSize
+	}
+
+	cache := &EntityCache[T, ID]{
+		db:             db,
+		opts:           options,
+		entries:        make(map[ID]entityCacheEntry[T]),
+		keyGenerations: make(map[ID]uint64),
+	}
+	if typ := modelType(reflect.TypeOf((*T)(nil))); typ != nil {
+		cache.table = string(db.Dialect().Tables().Get(typ).Name)
+	}
+	return cache
+}
+
+// Get returns the entity with id, loading it on a miss. It returns
+// sql.ErrNoRows when no row matches.
+func (c *EntityCache[T, ID]) Get(ctx context.Context, id ID) (T, error) {
+	if value, ok := c.lookup(id); ok {
+		c.hits.Add(1)
+		return value, nil
+	}
+	c.misses.Add(1)
+
+	var zero T
+	generation := c.generation.Load()
+	keyGeneration := c.beginLoad(id)
+	defer c.endLoad()
+	rows, err := FindByIDs[T](ctx, c.db, []ID{id}, c.opts.findOpts...)
+	if err != nil {
+		return zero, err
+	}
+	if len(rows) == 0 {
+		return zero, sql.ErrNoRows
+	}
+	c.store(id, rows[0], generation, keyGeneration)
+	return rows[0], nil
+}
+
+// Invalidate drops the given IDs from the cache.
+func (c *EntityCache[T, ID]) Invalidate(ids ...ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		delete(c.entries, id)
+		if c.loading > 0 {
+			c.keyGenerations[id]++
+		}
+	}
+	c.invalidations.Add(int64(len(ids)))
+}
+
+// InvalidateAll bumps the generation so every cached entry is stale.
+func (c *EntityCache[T, ID]) InvalidateAll() {
+	c.generation.Add(1)
+	c.invalidations.Add(1)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *EntityCache[T, ID]) Stats() EntityCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+	return EntityCacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       entries,
+		Generation:    c.generation.Load(),
+	}
+}
+
+// BeforeQuery implements bun.QueryHook.
+func (c *EntityCache[T, ID]) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery invalidates the cache after successful writes to its table.
+func (c *EntityCache[T, ID]) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if event == nil || event.Err != nil || event.IQuery == nil {
+		return
+	}
+	switch event.Operation() {
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE TABLE", "DROP TABLE":
+	default:
+		return
+	}
+	table := strings.Trim(event.IQuery.GetTableName(), `"`+"`")
+	if strings.EqualFold(table, c.table) {
+		c.InvalidateAll()
+	}
+}
+
+func (c *EntityCache[T, ID]) lookup(id ID) (T, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[id]
+	c.mu.RUnlock()
+
+	if !ok || entry.generation != c.generation.Load() {
+		var zero T
+		return zero, false
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// beginLoad registers a load of id and returns its current key generation.
+func (c *EntityCache[T, ID]) beginLoad(id ID) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loading++
+	return c.keyGenerations[id]
+}
+
+// endLoad forgets key generations once no load is in flight.
+func (c *EntityCache[T, ID]) endLoad() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loading--
+	if c.loading == 0 {
+		clear(c.keyGenerations)
+	}
+}
+
+func (c *EntityCache[T, ID]) store(id ID, value T, generation, keyGeneration uint64) {
+	entry := entityCacheEntry[T]{value: value, generation: generation}
+	if c.opts.ttl > 0 {
+		entry.expiresAt = time.Now().Add(c.opts.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keyGenerations[id] != keyGeneration {
+		return
+	}
+	if _, ok := c.entries[id]; !ok && len(c.entries) >= c.opts.maxEntries {
+		c.evictLocked()
+	}
+	c.entries[id] = entry
+}
+
+// evictLocked drops stale entries, or an arbitrary one if none are stale.
+func (c *EntityCache[T, ID]) evictLocked() {
+	current := c.generation.Load()
+	for id, entry := range c.entries {
+		if entry.generation != current {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) < c.opts.maxEntries {
+		return
+	}
+	for id := range c.entries {
+		delete(c.entries, id)
+		return
+	}
+}
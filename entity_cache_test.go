@@ -0,0 +1,128 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+// invalidateOnSelect invalidates ids in the cache after every SELECT,
+// standing in for a write that lands while a load is in flight.
+type invalidateOnSelect struct {
+	cache *EntityCache[findItem, int64]
+	ids   []int64
+}
+
+func (h *invalidateOnSelect) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *invalidateOnSelect) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if event.Operation() == "SELECT" {
+		h.cache.Invalidate(h.ids...)
+	}
+}
+
+func TestEntityCache_ReadThroughAndInvalidateOnWrite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	cache := NewEntityCache[findItem, int64](db)
+	db.AddQueryHook(cache)
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&findItem{ID: 1, Name: "a"}).Exec(ctx)
+	require.NoError(t, err)
+
+	item, err := cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+
+	item, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.InDelta(t, 0.5, stats.HitRatio(), 0.001)
+
+	_, err = db.NewUpdate().Model(&findItem{ID: 1, Name: "b"}).WherePK().Exec(ctx)
+	require.NoError(t, err)
+
+	item, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "b", item.Name)
+	assert.Equal(t, int64(2), cache.Stats().Misses)
+
+	_, err = cache.Get(ctx, 99)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestEntityCache_InvalidateAndEviction(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]findItem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}).Exec(ctx)
+	require.NoError(t, err)
+
+	cache := NewEntityCache[findItem, int64](db, WithEntityCacheSize(1))
+
+	_, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+	_, err = cache.Get(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Stats().Entries)
+
+	cache.Invalidate(2)
+	assert.Equal(t, 0, cache.Stats().Entries)
+
+	_, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+	cache.InvalidateAll()
+	_, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(0), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Generation)
+}
+
+func TestEntityCache_InvalidateDuringLoadSkipsStore(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]findItem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}).Exec(ctx)
+	require.NoError(t, err)
+
+	cache := NewEntityCache[findItem, int64](db)
+	hook := &invalidateOnSelect{cache: cache, ids: []int64{1}}
+	db.AddQueryHook(hook)
+
+	item, err := cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+	assert.Equal(t, 0, cache.Stats().Entries, "load raced an Invalidate of its key")
+
+	_, err = cache.Get(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Stats().Entries, "Invalidate of another key does not block the store")
+
+	hook.ids = nil
+	_, err = cache.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cache.Stats().Entries)
+	assert.Empty(t, cache.keyGenerations)
+}
@@ -0,0 +1,160 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// Stable error codes set as the go-errors text code of enriched errors,
+// so callers can map them, e.g. to HTTP status codes, without matching
+// on driver messages.
+const (
+	ErrorCodeNotFound             = "NOT_FOUND"
+	ErrorCodeUniqueViolation      = "UNIQUE_VIOLATION"
+	ErrorCodeConstraintViolation  = "CONSTRAINT_VIOLATION"
+	ErrorCodeSerializationFailure = "SERIALIZATION_FAILURE"
+	ErrorCodeTimeout              = "TIMEOUT"
+	ErrorCodeCanceled             = "CANCELED"
+	ErrorCodeConnection           = "CONNECTION"
+	ErrorCodeMigrationFailed      = "MIGRATION_FAILED"
+	ErrorCodeRollbackFailed       = "ROLLBACK_FAILED"
+	ErrorCodeSeedFailed           = "SEED_FAILED"
+	ErrorCodeDatabase             = "DATABASE_ERROR"
+)
+
+// OperationInfo describes the operation an error is enriched with.
+type OperationInfo struct {
+	// Operation names the failed operation, e.g. "migrate" or "find_by_ids".
+	Operation string
+	// Table is the table the operation targeted, if any.
+	Table string
+	// Dialect is the database dialect name.
+	Dialect string
+	// Start is when the operation started, used to compute its duration.
+	Start time.Time
+	// Code overrides the classified error code, e.g. ErrorCodeMigrationFailed.
+	Code string
+}
+
+// EnrichError wraps err with the operation, table, dialect and duration
+// metadata and a stable error code. A code already set in the err chain
+// wins over info.Code, which wins over the code classified from the
+// database error. The classified code is always kept as the db_error
+// metadata field. Nil errors are returned as is.
+func EnrichError(err error, info OperationInfo) error {
+	if err == nil {
+		return nil
+	}
+
+	dbCode, category := classifyDBError(err)
+	code := textCode(err)
+	if code == "" {
+		code = info.Code
+	}
+	if code == "" {
+		code = dbCode
+	}
+
+	metadata := map[string]any{"db_error": dbCode}
+	if info.Operation != "" {
+		metadata["operation"] = info.Operation
+	}
+	if info.Table != "" {
+		metadata["table"] = info.Table
+	}
+	if info.Dialect != "" {
+		metadata["dialect"] = info.Dialect
+	}
+	if !info.Start.IsZero() {
+		metadata["duration_ms"] = time.Since(info.Start).Milliseconds()
+	}
+
+	var richErr *apierrors.Error
+	if errors.As(err, &richErr) && richErr == err {
+		return richErr.WithTextCode(code).WithMetadata(metadata)
+	}
+
+	message := "database operation failed"
+	if info.Operation != "" {
+		message = info.Operation + " failed"
+	}
+	return apierrors.Wrap(err, category, message).WithTextCode(code).WithMetadata(metadata)
+}
+
+// ErrorCode returns the first error code found in the err chain, or
+// the code classified from the underlying database error.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	if code := textCode(err); code != "" {
+		return code
+	}
+	code, _ := classifyDBError(err)
+	return code
+}
+
+func textCode(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if richErr, ok := e.(*apierrors.Error); ok && richErr.TextCode != "" {
+			return richErr.TextCode
+		}
+	}
+	return ""
+}
+
+// classifyDBError maps driver and context errors to an error
+// code and go-errors category.
+func classifyDBError(err error) (string, apierrors.Category) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrorCodeNotFound, apierrors.CategoryNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeTimeout, apierrors.CategoryOperation
+	case errors.Is(err, context.Canceled):
+		return ErrorCodeCanceled, apierrors.CategoryOperation
+	case errors.Is(err, sql.ErrConnDone):
+		return ErrorCodeConnection, apierrors.CategoryExternal
+	case IsRetryableTxError(err):
+		return ErrorCodeSerializationFailure, apierrors.CategoryConflict
+	}
+
+	state := ""
+	var stater interface{ SQLState() string }
+	if errors.As(err, &stater) {
+		state = stater.SQLState()
+	}
+	msg := strings.ToLower(err.Error())
+
+	switch {
+	case state == "23505" ||
+		strings.Contains(msg, "duplicate key value") ||
+		strings.Contains(msg, "unique constraint failed") ||
+		strings.Contains(msg, "duplicate entry"):
+		return ErrorCodeUniqueViolation, apierrors.CategoryConflict
+	case strings.HasPrefix(state, "23") ||
+		strings.Contains(msg, "constraint failed") ||
+		strings.Contains(msg, "violates foreign key constraint") ||
+		strings.Contains(msg, "violates not-null constraint") ||
+		strings.Contains(msg, "violates check constraint"):
+		return ErrorCodeConstraintViolation, apierrors.CategoryConflict
+	case strings.HasPrefix(state, "08") ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "bad connection"):
+		return ErrorCodeConnection, apierrors.CategoryExternal
+	}
+	return ErrorCodeDatabase, apierrors.CategoryOperation
+}
+
+func dialectName(db bun.IDB) string {
+	if db == nil || db.Dialect() == nil {
+		return ""
+	}
+	return db.Dialect().Name().String()
+}
@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sqlStateErr string
+
+func (e sqlStateErr) Error() string    { return "driver error " + string(e) }
+func (e sqlStateErr) SQLState() string { return string(e) }
+
+func TestErrorCode_Classification(t *testing.T) {
+	cases := map[string]error{
+		ErrorCodeNotFound:             fmt.Errorf("find: %w", sql.ErrNoRows),
+		ErrorCodeTimeout:              context.DeadlineExceeded,
+		ErrorCodeCanceled:             context.Canceled,
+		ErrorCodeUniqueViolation:      errors.New("UNIQUE constraint failed: users.email"),
+		ErrorCodeConstraintViolation:  sqlStateErr("23503"),
+		ErrorCodeSerializationFailure: sqlStateErr("40001"),
+		ErrorCodeConnection:           sqlStateErr("08006"),
+		ErrorCodeDatabase:             errors.New("syntax error"),
+	}
+	for code, err := range cases {
+		assert.Equal(t, code, ErrorCode(err), err.Error())
+	}
+	assert.Empty(t, ErrorCode(nil))
+}
+
+func TestEnrichError(t *testing.T) {
+	assert.NoError(t, EnrichError(nil, OperationInfo{}))
+
+	err := EnrichError(sql.ErrNoRows, OperationInfo{Operation: "find_by_ids", Table: "users", Dialect: "sqlite"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, ErrorCodeNotFound, ErrorCode(err))
+
+	var richErr *apierrors.Error
+	require.True(t, errors.As(err, &richErr))
+	assert.Equal(t, apierrors.CategoryNotFound, richErr.Category)
+	assert.Equal(t, "users", richErr.Metadata["table"])
+	assert.Equal(t, "sqlite", richErr.Metadata["dialect"])
+
+	err = EnrichError(errors.New("boom"), OperationInfo{Code: ErrorCodeMigrationFailed})
+	assert.Equal(t, ErrorCodeMigrationFailed, ErrorCode(err))
+
+	inner := apierrors.New("out of order", apierrors.CategoryValidation).WithTextCode("MIGRATIONS_OUT_OF_ORDER")
+	err = EnrichError(fmt.Errorf("wrapped: %w", inner), OperationInfo{Code: ErrorCodeMigrationFailed})
+	assert.Equal(t, "MIGRATIONS_OUT_OF_ORDER", ErrorCode(err))
+}
+
+func TestMigrations_MigrateErrorIsEnriched(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_broken.up.sql": {Data: []byte("CREATE TABLE")},
+	})
+
+	err := migrations.Migrate(ctx, db)
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeMigrationFailed, ErrorCode(err))
+
+	var richErr *apierrors.Error
+	require.True(t, errors.As(err, &richErr))
+	assert.Equal(t, "migrate", richErr.Metadata["operation"])
+	assert.Equal(t, "bun_migrations", richErr.Metadata["table"])
+	assert.Equal(t, "sqlite", richErr.Metadata["dialect"])
+	assert.Contains(t, richErr.Metadata, "duration_ms")
+}
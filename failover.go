@@ -0,0 +1,314 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+)
+
+const (
+	defaultFailoverProbeInterval = 5 * time.Second
+	defaultFailoverThreshold     = 3
+)
+
+// ErrNoFailoverTarget indicates that no failover target was reachable.
+var ErrNoFailoverTarget = errors.New("persistence: no reachable failover target")
+
+// FailoverTarget is a database the client can connect to. Name labels
+// it in events and logs, so it should not contain credentials.
+type FailoverTarget struct {
+	Name      string
+	Connector driver.Connector
+}
+
+// FailoverEvent reports a change of the active target. Err is the
+// failure that caused it, nil for a manual Promote.
+type FailoverEvent struct {
+	From string
+	To   string
+	Err  error
+	At   time.Time
+}
+
+// FailoverOption configures a FailoverConnector
+type FailoverOption func(*FailoverConnector)
+
+// WithFailoverProbeInterval sets how often Run probes the active target,
+// five seconds by default.
+func WithFailoverProbeInterval(interval time.Duration) FailoverOption {
+	return func(f *FailoverConnector) {
+		if interval > 0 {
+			f.interval = interval
+		}
+	}
+}
+
+// WithFailoverThreshold sets how many consecutive probe or connect
+// failures promote the next target, three by default.
+func WithFailoverThreshold(n int) FailoverOption {
+	return func(f *FailoverConnector) {
+		if n > 0 {
+			f.threshold = n
+		}
+	}
+}
+
+// WithFailoverHandler registers fn to receive failover events.
+func WithFailoverHandler(fn func(FailoverEvent)) FailoverOption {
+	return func(f *FailoverConnector) {
+		if fn != nil {
+			f.handlers = append(f.handlers, fn)
+		}
+	}
+}
+
+// FailoverConnector connects to the active target of an ordered list,
+// the first one being the primary. When the active target fails the
+// threshold in a row, the next reachable target is promoted and
+// connections to the previous one are retired once idle. The connector
+// stays on the promoted target until Promote is called, so a recovered
+// primary is not used before it is known to be writable again.
+type FailoverConnector struct {
+	targets   []FailoverTarget
+	interval  time.Duration
+	threshold int
+	handlers  []func(FailoverEvent)
+	now       func() time.Time
+
+	mu         sync.Mutex
+	active     int
+	failures   int
+	generation atomic.Int64
+}
+
+// NewFailoverConnector creates a connector for targets, which must not
+// be empty.
+func NewFailoverConnector(targets []FailoverTarget, opts ...FailoverOption) *FailoverConnector {
+	f := &FailoverConnector{
+		targets:   targets,
+		interval:  defaultFailoverProbeInterval,
+		threshold: defaultFailoverThreshold,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(f)
+		}
+	}
+	return f
+}
+
+// WithFailoverTargets makes Open fail over from the config DSN to dsns,
+// tried in order, see FailoverConnector. Client.Start runs the health
+// probes.
+func WithFailoverTargets(dsns ...string) ClientOption {
+	return func(o *clientOptions) {
+		if o == nil {
+			return
+		}
+		o.failoverTargets = append(o.failoverTargets, dsns...)
+	}
+}
+
+// WithFailoverOptions configures the connector of WithFailoverTargets.
+func WithFailoverOptions(opts ...FailoverOption) ClientOption {
+	return func(o *clientOptions) {
+		if o == nil {
+			return
+		}
+		o.failoverOptions = append(o.failoverOptions, opts...)
+	}
+}
+
+// Failover returns the failover connector of a client opened with
+// WithFailoverTargets, or nil.
+func (c Client) Failover() *FailoverConnector {
+	return c.failover
+}
+
+// Active returns the name of the active target.
+func (f *FailoverConnector) Active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets[f.active].Name
+}
+
+// Connect implements driver.Connector.
+func (f *FailoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if len(f.targets) == 0 {
+		return nil, ErrNoFailoverTarget
+	}
+	for attempt := 0; ; attempt++ {
+		f.mu.Lock()
+		active, generation := f.active, f.generation.Load()
+		f.mu.Unlock()
+
+		conn, err := f.targets[active].Connector.Connect(ctx)
+		if err == nil {
+			f.succeeded(active)
+			return &generationConn{Conn: conn, current: &f.generation, generation: generation}, nil
+		}
+		if attempt > 0 || !f.failed(ctx, active, err) {
+			return nil, err
+		}
+	}
+}
+
+// Driver implements driver.Connector.
+func (f *FailoverConnector) Driver() driver.Driver {
+	return f.targets[0].Connector.Driver()
+}
+
+// OpenDB opens a database on the connector.
+func (f *FailoverConnector) OpenDB() *sql.DB {
+	return sql.OpenDB(f)
+}
+
+// Probe pings the active target, counting a failure toward the
+// threshold.
+func (f *FailoverConnector) Probe(ctx context.Context) error {
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+
+	if err := pingConnector(ctx, f.targets[active].Connector); err != nil {
+		f.failed(ctx, active, err)
+		return err
+	}
+	f.succeeded(active)
+	return nil
+}
+
+// Run probes the active target every probe interval until ctx is done.
+func (f *FailoverConnector) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, f.interval)
+			_ = f.Probe(probeCtx)
+			cancel()
+		}
+	}
+}
+
+// Promote makes the target called name active, e.g. to fail back to a
+// recovered primary.
+func (f *FailoverConnector) Promote(name string) error {
+	for i, target := range f.targets {
+		if target.Name == name {
+			f.mu.Lock()
+			from := f.promote(i)
+			f.mu.Unlock()
+			f.emit(FailoverEvent{From: from, To: name, At: f.now()})
+			return nil
+		}
+	}
+	return apierrors.New("unknown failover target", apierrors.CategoryNotFound).
+		WithMetadata(map[string]any{"target": name})
+}
+
+func (f *FailoverConnector) succeeded(index int) {
+	f.mu.Lock()
+	if f.active == index {
+		f.failures = 0
+	}
+	f.mu.Unlock()
+}
+
+// failed records a failure of target index and, at the threshold,
+// promotes the next reachable target. It reports whether the active
+// target changed.
+func (f *FailoverConnector) failed(ctx context.Context, index int, cause error) bool {
+	f.mu.Lock()
+	if f.active != index {
+		f.mu.Unlock()
+		return true
+	}
+	f.failures++
+	if f.failures < f.threshold {
+		f.mu.Unlock()
+		return false
+	}
+	f.mu.Unlock()
+
+	for i := 1; i < len(f.targets); i++ {
+		candidate := (index + i) % len(f.targets)
+		if pingConnector(ctx, f.targets[candidate].Connector) != nil {
+			continue
+		}
+		f.mu.Lock()
+		if f.active != index {
+			f.mu.Unlock()
+			return true
+		}
+		from := f.promote(candidate)
+		f.mu.Unlock()
+		f.emit(FailoverEvent{From: from, To: f.targets[candidate].Name, Err: cause, At: f.now()})
+		return true
+	}
+	return false
+}
+
+// promote switches to target index and retires the open connections.
+// The caller holds mu.
+func (f *FailoverConnector) promote(index int) string {
+	from := f.targets[f.active].Name
+	f.active, f.failures = index, 0
+	f.generation.Add(1)
+	return from
+}
+
+func (f *FailoverConnector) emit(event FailoverEvent) {
+	for _, handler := range f.handlers {
+		handler(event)
+	}
+}
+
+func pingConnector(ctx context.Context, connector driver.Connector) error {
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if p, ok := conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// dsnHost returns the host of dsn, to name targets without exposing
+// credentials.
+func dsnHost(dsn string, index int) string {
+	switch {
+	case strings.Contains(dsn, "://"):
+		if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+			return u.Host
+		}
+	case mysqlUserinfoRE.MatchString(dsn):
+		if _, rest, ok := strings.Cut(dsn[strings.Index(dsn, "@"):], "("); ok {
+			if host, _, ok := strings.Cut(rest, ")"); ok {
+				return host
+			}
+		}
+	default:
+		for _, field := range strings.Fields(dsn) {
+			if host, ok := strings.CutPrefix(field, "host="); ok {
+				return strings.Trim(host, "'")
+			}
+		}
+	}
+	return fmt.Sprintf("target-%d", index)
+}
@@ -0,0 +1,316 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrFakeUnexpectedQuery is returned by a FakeDriver for queries without
+// a programmed response.
+var ErrFakeUnexpectedQuery = errors.New("persistence: unexpected query")
+
+var (
+	fingerprintStringRE = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumberRE = regexp.MustCompile(`\b\d+(?:\.\d+)?\b|\$\d+`)
+	fingerprintListRE   = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	fingerprintRowsRE   = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+	fingerprintSpaceRE  = regexp.MustCompile(`\s+`)
+)
+
+// QueryFingerprint returns query with literals and placeholders replaced
+// by ?, lists collapsed and whitespace normalized, so queries differing
+// only in their arguments share a fingerprint.
+func QueryFingerprint(query string) string {
+	fp := fingerprintStringRE.ReplaceAllString(query, "?")
+	fp = fingerprintNumberRE.ReplaceAllString(fp, "?")
+	fp = fingerprintListRE.ReplaceAllString(fp, "?")
+	fp = fingerprintRowsRE.ReplaceAllString(fp, "(?)")
+	fp = fingerprintSpaceRE.ReplaceAllString(fp, " ")
+	return strings.ToLower(strings.TrimSpace(fp))
+}
+
+// FakeResponse is the programmed outcome of a query fingerprint.
+type FakeResponse struct {
+	fingerprint string
+	columns     []string
+	rows        [][]driver.Value
+	lastID      int64
+	affected    int64
+	err         error
+	times       int
+	calls       int
+}
+
+// Rows makes the query return rows with columns.
+func (r *FakeResponse) Rows(columns []string, rows ...[]any) *FakeResponse {
+	r.columns = columns
+	r.rows = r.rows[:0]
+	for _, row := range rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			value, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Sprintf("persistence: fake row value %T: %v", v, err))
+			}
+			values[i] = value
+		}
+		r.rows = append(r.rows, values)
+	}
+	return r
+}
+
+// Result makes the statement report lastInsertID and rowsAffected.
+func (r *FakeResponse) Result(lastInsertID, rowsAffected int64) *FakeResponse {
+	r.lastID = lastInsertID
+	r.affected = rowsAffected
+	return r
+}
+
+// Err makes the query fail with err.
+func (r *FakeResponse) Err(err error) *FakeResponse {
+	r.err = err
+	return r
+}
+
+// Times limits the response to n calls. By default it answers every call.
+func (r *FakeResponse) Times(n int) *FakeResponse {
+	r.times = n
+	return r
+}
+
+// FakeDriver is an in memory database/sql driver with canned responses
+// keyed by QueryFingerprint, for unit tests that need a bun.DB without a
+// database. Unlike regex expectations, programming a query by example
+// keeps matching when literal values or whitespace change, and order is
+// not enforced.
+type FakeDriver struct {
+	mu        sync.Mutex
+	responses map[string][]*FakeResponse
+	log       []string
+	lenient   bool
+}
+
+// NewFakeDB returns a bun.DB with dialect on a new FakeDriver.
+func NewFakeDB(dialect schema.Dialect) (*bun.DB, *FakeDriver) {
+	fake := &FakeDriver{responses: make(map[string][]*FakeResponse)}
+	return bun.NewDB(sql.OpenDB(fake), dialect), fake
+}
+
+// Lenient makes unprogrammed statements succeed, with no rows and no
+// affected rows, instead of failing with ErrFakeUnexpectedQuery. Useful
+// for flows such as migrations where only a few queries matter.
+func (f *FakeDriver) Lenient() *FakeDriver {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lenient = true
+	return f
+}
+
+// On programs a response for queries with the fingerprint of query.
+// Responses for the same fingerprint are used in order, the last one
+// repeating unless limited with Times.
+func (f *FakeDriver) On(query string) *FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fp := QueryFingerprint(query)
+	r := &FakeResponse{fingerprint: fp}
+	f.responses[fp] = append(f.responses[fp], r)
+	return r
+}
+
+// Queries returns every statement received, including BEGIN, COMMIT
+// and ROLLBACK, in order.
+func (f *FakeDriver) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.log...)
+}
+
+// Reset forgets programmed responses and received statements.
+func (f *FakeDriver) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = make(map[string][]*FakeResponse)
+	f.log = nil
+}
+
+// Unused returns an error listing programmed responses never used.
+func (f *FakeDriver) Unused() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for fp, responses := range f.responses {
+		for _, r := range responses {
+			if r.calls == 0 {
+				errs = append(errs, fmt.Errorf("persistence: fake response not used: %s", fp))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FakeDriver) respond(query string) (*FakeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, query)
+
+	fp := QueryFingerprint(query)
+	for _, r := range f.responses[fp] {
+		if r.times > 0 && r.calls >= r.times {
+			continue
+		}
+		r.calls++
+		return r, r.err
+	}
+	if f.lenient {
+		return &FakeResponse{fingerprint: fp}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrFakeUnexpectedQuery, fp)
+}
+
+func (f *FakeDriver) record(stmt string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, stmt)
+}
+
+// Connect implements driver.Connector.
+func (f *FakeDriver) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: f}, nil
+}
+
+// Driver implements driver.Connector.
+func (f *FakeDriver) Driver() driver.Driver {
+	return f
+}
+
+// Open implements driver.Driver.
+func (f *FakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{fake: f}, nil
+}
+
+type fakeConn struct {
+	fake *FakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.fake.record("BEGIN")
+	return &fakeTx{fake: c.fake}, nil
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c.Begin()
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	return nil
+}
+
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	r, err := c.fake.respond(query)
+	if err != nil {
+		return nil, err
+	}
+	return fakeResult{lastID: r.lastID, affected: r.affected}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.fake.respond(query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: r.columns, rows: r.rows}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type fakeTx struct {
+	fake *FakeDriver
+}
+
+func (t *fakeTx) Commit() error {
+	t.fake.record("COMMIT")
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.fake.record("ROLLBACK")
+	return nil
+}
+
+type fakeResult struct {
+	lastID   int64
+	affected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,82 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type fakeUser struct {
+	bun.BaseModel `bun:"table:users"`
+
+	ID   int64  `bun:"id,pk,autoincrement"`
+	Name string `bun:"name"`
+}
+
+func TestQueryFingerprint(t *testing.T) {
+	assert.Equal(t,
+		`select * from "users" where id in (?) and name = ? limit ?`,
+		QueryFingerprint("SELECT *  FROM \"users\"\n WHERE id IN (1, 2, 3) AND name = 'o''brien' LIMIT 10"),
+	)
+	assert.Equal(t,
+		QueryFingerprint(`INSERT INTO t (a) VALUES (1), (2)`),
+		QueryFingerprint(`INSERT INTO t (a) VALUES ($1)`),
+	)
+	assert.Equal(t, `select * from t1`, QueryFingerprint(`SELECT * FROM t1`))
+}
+
+func TestFakeDriver(t *testing.T) {
+	ctx := context.Background()
+	db, fake := NewFakeDB(pgdialect.New())
+
+	fake.On(`SELECT "fake_user"."id", "fake_user"."name" FROM "users" AS "fake_user" WHERE (id = 1)`).
+		Rows([]string{"id", "name"}, []any{7, "ada"})
+	fake.On(`INSERT INTO "users" ("id", "name") VALUES (DEFAULT, 'x') RETURNING "id"`).
+		Rows([]string{"id"}, []any{42})
+	boom := errors.New("boom")
+	fake.On(`DELETE FROM "users" AS "fake_user" WHERE (id = 1)`).Result(0, 1).Times(1)
+	fake.On(`DELETE FROM "users" AS "fake_user" WHERE (id = 1)`).Err(boom)
+
+	user := new(fakeUser)
+	require.NoError(t, db.NewSelect().Model(user).Where("id = ?", 99).Scan(ctx))
+	assert.Equal(t, "ada", user.Name)
+
+	inserted := &fakeUser{Name: "grace"}
+	_, err := db.NewInsert().Model(inserted).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), inserted.ID)
+
+	res, err := db.NewDelete().Model((*fakeUser)(nil)).Where("id = ?", 5).Exec(ctx)
+	require.NoError(t, err)
+	n, _ := res.RowsAffected()
+	assert.Equal(t, int64(1), n)
+	_, err = db.NewDelete().Model((*fakeUser)(nil)).Where("id = ?", 5).Exec(ctx)
+	require.ErrorIs(t, err, boom)
+
+	_, err = db.NewUpdate().Model((*fakeUser)(nil)).Set("name = ?", "z").Where("id = 1").Exec(ctx)
+	require.ErrorIs(t, err, ErrFakeUnexpectedQuery)
+
+	require.NoError(t, fake.Unused())
+	fake.On("SELECT 1")
+	require.Error(t, fake.Unused())
+	assert.Len(t, fake.Queries(), 5)
+}
+
+func TestFakeDriver_LenientMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, fake := NewFakeDB(pgdialect.New())
+	fake.Lenient()
+
+	migrations := NewMigrations().RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE users (id bigint);")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	})
+	require.NoError(t, migrations.Migrate(ctx, db))
+	assert.Contains(t, fake.Queries(), "CREATE TABLE users (id bigint);\n")
+}
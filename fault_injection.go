@@ -0,0 +1,272 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand/v2"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrInjectedFault is the default error of FaultError rules.
+var ErrInjectedFault = errors.New("persistence: injected fault")
+
+// FaultAction is what a FaultRule does to a matching query.
+type FaultAction int
+
+const (
+	// FaultDelay sleeps before running the query.
+	FaultDelay FaultAction = iota
+	// FaultError fails the query with the rule error.
+	FaultError
+	// FaultDrop fails the query as if the connection was lost.
+	FaultDrop
+)
+
+// FaultRule injects a fault into a share of the queries matching Pattern.
+type FaultRule struct {
+	// Pattern is a regular expression matched against the SQL. Empty
+	// matches every query.
+	Pattern string
+	Action  FaultAction
+	// Percent of matching queries affected, from 0 to 100. Zero affects
+	// every matching query.
+	Percent float64
+	// Delay is the sleep of FaultDelay rules.
+	Delay time.Duration
+	// Err is returned by FaultError rules, ErrInjectedFault by default.
+	Err error
+}
+
+type faultRule struct {
+	FaultRule
+	re *regexp.Regexp
+}
+
+// FaultInjector delays, fails or drops queries matching its rules, to
+// verify retry and circuit breaker behavior in integration tests. It is
+// meant for tests only.
+//
+// As a bun query hook it can delay queries and abort them by canceling
+// their context, so callers see context.Canceled. Wrap the driver with
+// Connector to return the rule errors themselves, e.g. serialization
+// failures for RunInTxWithRetry.
+type FaultInjector struct {
+	rules   []faultRule
+	enabled atomic.Bool
+	hits    atomic.Int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewFaultInjector compiles rules and panics on an invalid pattern, like
+// regexp.MustCompile, since rules are fixed in test code.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	f := &FaultInjector{rand: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+	for _, rule := range rules {
+		compiled := faultRule{FaultRule: rule}
+		if rule.Pattern != "" {
+			compiled.re = regexp.MustCompile(rule.Pattern)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	f.enabled.Store(true)
+	return f
+}
+
+// WithFaultInjection registers a FaultInjector with rules as a query hook.
+func WithFaultInjection(rules ...FaultRule) ClientOption {
+	return WithQueryHooks(NewFaultInjector(rules...))
+}
+
+// SetEnabled turns fault injection on or off.
+func (f *FaultInjector) SetEnabled(enabled bool) {
+	f.enabled.Store(enabled)
+}
+
+// Injected returns how many faults were injected.
+func (f *FaultInjector) Injected() int64 {
+	return f.hits.Load()
+}
+
+// match returns the first rule hitting query, or nil.
+func (f *FaultInjector) match(query string) *faultRule {
+	if !f.enabled.Load() {
+		return nil
+	}
+	for i := range f.rules {
+		rule := &f.rules[i]
+		if rule.re != nil && !rule.re.MatchString(query) {
+			continue
+		}
+		if rule.Percent > 0 && rule.Percent < 100 {
+			f.mu.Lock()
+			skip := f.rand.Float64()*100 >= rule.Percent
+			f.mu.Unlock()
+			if skip {
+				continue
+			}
+		}
+		f.hits.Add(1)
+		return rule
+	}
+	return nil
+}
+
+// apply runs rule and returns the error the query should fail with.
+func (r *faultRule) apply(ctx context.Context) error {
+	switch r.Action {
+	case FaultDelay:
+		if !sleepContext(ctx, r.Delay) {
+			return ctx.Err()
+		}
+		return nil
+	case FaultDrop:
+		return driver.ErrBadConn
+	default:
+		if r.Err != nil {
+			return r.Err
+		}
+		return ErrInjectedFault
+	}
+}
+
+// BeforeQuery implements bun.QueryHook.
+func (f *FaultInjector) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	rule := f.match(event.Query)
+	if rule == nil {
+		return ctx
+	}
+	if err := rule.apply(ctx); err != nil {
+		ctx, cancel := context.WithCancelCause(ctx)
+		cancel(err)
+		return ctx
+	}
+	return ctx
+}
+
+// AfterQuery implements bun.QueryHook.
+func (f *FaultInjector) AfterQuery(context.Context, *bun.QueryEvent) {}
+
+// Connector wraps a driver connector so matching queries fail with the
+// rule errors. Use it with sql.OpenDB. Prepared statements are checked
+// when they are prepared.
+func (f *FaultInjector) Connector(base driver.Connector) driver.Connector {
+	return &faultConnector{base: base, injector: f}
+}
+
+// OpenDB opens a database on d with faults injected, for drivers
+// registered with database/sql, e.g. sql.Open(...).Driver().
+func (f *FaultInjector) OpenDB(d driver.Driver, dsn string) (*sql.DB, error) {
+	var base driver.Connector = dsnConnector{driver: d, dsn: dsn}
+	if dc, ok := d.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		base = connector
+	}
+	return sql.OpenDB(f.Connector(base)), nil
+}
+
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type faultConnector struct {
+	base     driver.Connector
+	injector *FaultInjector
+}
+
+func (c *faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn, injector: c.injector}, nil
+}
+
+func (c *faultConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+type faultConn struct {
+	driver.Conn
+	injector *FaultInjector
+}
+
+func (c *faultConn) fault(ctx context.Context, query string) error {
+	if rule := c.injector.match(query); rule != nil {
+		return rule.apply(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.fault(ctx, query); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.fault(ctx, query); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.fault(ctx, query); err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *faultConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestFaultInjector_Hook(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	injector := NewFaultInjector(
+		FaultRule{Pattern: `(?i)^SELECT 2`, Action: FaultDelay, Delay: 20 * time.Millisecond},
+		FaultRule{Pattern: `(?i)^SELECT 3`, Action: FaultError},
+	)
+	db.AddQueryHook(injector)
+
+	start := time.Now()
+	_, err := db.ExecContext(ctx, "SELECT 2")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	_, err = db.ExecContext(ctx, "SELECT 3")
+	require.ErrorIs(t, err, context.Canceled)
+
+	injector.SetEnabled(false)
+	_, err = db.ExecContext(ctx, "SELECT 3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), injector.Injected())
+}
+
+func TestFaultInjector_Connector(t *testing.T) {
+	ctx := context.Background()
+	probe, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	require.NoError(t, probe.Close())
+
+	conflict := errors.New("serialization failure")
+	injector := NewFaultInjector(
+		FaultRule{Pattern: `flaky`, Action: FaultError, Err: conflict},
+		FaultRule{Pattern: `gone`, Action: FaultDrop},
+		FaultRule{Pattern: `never`, Action: FaultError, Percent: 1e-9},
+	)
+	sqlDB, err := injector.OpenDB(probe.Driver(), "file::memory:")
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "SELECT 'flaky'")
+	require.ErrorIs(t, err, conflict)
+
+	_, err = db.ExecContext(ctx, "SELECT 'gone'")
+	require.ErrorIs(t, err, driver.ErrBadConn)
+
+	var n int
+	require.NoError(t, db.NewRaw("SELECT ?", 1).Scan(ctx, &n))
+	assert.Equal(t, 1, n)
+
+	_, err = db.ExecContext(ctx, "SELECT 'never'")
+	require.NoError(t, err)
+}
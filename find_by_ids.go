@@ -0,0 +1,130 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	sqliteMaxChunkSize  = 999
+	defaultMaxChunkSize = 10000
+)
+
+// ErrFindByIDsModel indicates a model without a single column primary key.
+var ErrFindByIDsModel = errors.New("persistence: FindByIDs requires a model with a single primary key")
+
+// FindByIDsOption configures FindByIDs
+type FindByIDsOption func(*findByIDsOptions)
+
+type findByIDsOptions struct {
+	chunkSize     int
+	preserveOrder bool
+	query         func(*bun.SelectQuery) *bun.SelectQuery
+}
+
+// WithChunkSize overrides the number of IDs per IN query.
+func WithChunkSize(size int) FindByIDsOption {
+	return func(o *findByIDsOptions) {
+		o.chunkSize = size
+	}
+}
+
+// WithPreserveOrder returns results in the order of the input IDs.
+// IDs without a matching row are skipped, repeated IDs repeat the row.
+func WithPreserveOrder() FindByIDsOption {
+	return func(o *findByIDsOptions) {
+		o.preserveOrder = true
+	}
+}
+
+// WithFindQuery customizes each chunk query, e.g. to add relations.
+func WithFindQuery(fn func(*bun.SelectQuery) *bun.SelectQuery) FindByIDsOption {
+	return func(o *findByIDsOptions) {
+		o.query = fn
+	}
+}
+
+// FindByIDs loads the rows of T whose primary key is in ids. Large ID
+// lists are split in chunks that stay under the dialect parameter limits
+// (999 on SQLite) and the results are merged. Duplicate IDs are queried once.
+func FindByIDs[T any, ID comparable](ctx context.Context, db bun.IDB, ids []ID, opts ...FindByIDsOption) ([]T, error) {
+	began := time.Now()
+	options := findByIDsOptions{chunkSize: maxChunkSize(db)}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if options.chunkSize <= 0 {
+		options.chunkSize = maxChunkSize(db)
+	}
+
+	table := db.Dialect().Tables().Get(reflect.TypeOf((*T)(nil)).Elem())
+	if len(table.PKs) != 1 {
+		return nil, ErrFindByIDsModel
+	}
+	pk := table.PKs[0]
+
+	unique := make([]ID, 0, len(ids))
+	seen := make(map[ID]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+
+	out := make([]T, 0, len(unique))
+	for start := 0; start < len(unique); start += options.chunkSize {
+		end := min(start+options.chunkSize, len(unique))
+
+		var chunk []T
+		q := db.NewSelect().Model(&chunk).Where("?TableAlias.? IN (?)", bun.Ident(pk.Name), bun.In(unique[start:end]))
+		if options.query != nil {
+			q = options.query(q)
+		}
+		if err := q.Scan(ctx); err != nil {
+			return nil, EnrichError(err, OperationInfo{Operation: "find_by_ids", Table: table.Name, Dialect: dialectName(db), Start: began})
+		}
+		out = append(out, chunk...)
+	}
+
+	if !options.preserveOrder {
+		return out, nil
+	}
+
+	byID := indexByPK(pk, out)
+	ordered := make([]T, 0, len(out))
+	for _, id := range ids {
+		if item, ok := byID[fmt.Sprint(id)]; ok {
+			ordered = append(ordered, item)
+		}
+	}
+	return ordered, nil
+}
+
+// indexByPK maps rows by the string form of their primary key so
+// IDs of a different but compatible type can be matched.
+func indexByPK[T any](pk *schema.Field, rows []T) map[string]T {
+	out := make(map[string]T, len(rows))
+	for _, row := range rows {
+		key := fmt.Sprint(pk.Value(reflect.ValueOf(&row).Elem()).Interface())
+		out[key] = row
+	}
+	return out
+}
+
+func maxChunkSize(db bun.IDB) int {
+	if db.Dialect().Name() == dialect.SQLite {
+		return sqliteMaxChunkSize
+	}
+	return defaultMaxChunkSize
+}
@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type findItem struct {
+	bun.BaseModel `bun:"table:find_items"`
+	ID            int64  `bun:"id,pk"`
+	Name          string `bun:"name"`
+}
+
+func TestFindByIDs_ChunksAndOrders(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	items := make([]findItem, 0, 20)
+	for i := int64(1); i <= 20; i++ {
+		items = append(items, findItem{ID: i, Name: "item"})
+	}
+	_, err = db.NewInsert().Model(&items).Exec(ctx)
+	require.NoError(t, err)
+
+	queries := 0
+	countChunks := WithFindQuery(func(q *bun.SelectQuery) *bun.SelectQuery {
+		queries++
+		return q
+	})
+
+	ids := []int64{15, 3, 99, 7, 3, 20, 1}
+	found, err := FindByIDs[findItem](ctx, db, ids, WithChunkSize(2), WithPreserveOrder(), countChunks)
+	require.NoError(t, err)
+	assert.Equal(t, 3, queries)
+
+	got := make([]int64, 0, len(found))
+	for _, item := range found {
+		got = append(got, item.ID)
+	}
+	assert.Equal(t, []int64{15, 3, 7, 3, 20, 1}, got)
+
+	found, err = FindByIDs[findItem](ctx, db, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Len(t, found, 3)
+
+	found, err = FindByIDs[findItem, int64](ctx, db, nil)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ScaffoldFixtures generates starter fixture files with one example row
+// per model, for the models given or, without any, every model
+// registered on db. Files are numbered so models load after the models
+// they belong to, and foreign keys reference the example row of the
+// related model through a dbfixture template. Write the result with
+// os.CopyFS and edit the values before committing them.
+func ScaffoldFixtures(db *bun.DB, models ...any) fstest.MapFS {
+	var tables []*schema.Table
+	if len(models) == 0 {
+		tables = registeredTables(db)
+	} else {
+		for _, model := range models {
+			tables = append(tables, db.Table(reflect.TypeOf(model)))
+		}
+	}
+
+	files := fstest.MapFS{}
+	for i, table := range sortTablesByDependency(tables) {
+		name := fmt.Sprintf("%02d_%s.yml", i+1, table.Name)
+		files[name] = &fstest.MapFile{Data: scaffoldFixture(table)}
+	}
+	return files
+}
+
+// sortTablesByDependency orders tables so that every table comes after
+// the tables of its belongs-to relations. Cycles keep name order.
+func sortTablesByDependency(tables []*schema.Table) []*schema.Table {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Name < tables[j].Name
+	})
+
+	included := make(map[*schema.Table]bool, len(tables))
+	for _, table := range tables {
+		included[table] = true
+	}
+
+	out := make([]*schema.Table, 0, len(tables))
+	visited := make(map[*schema.Table]bool, len(tables))
+	var visit func(table *schema.Table)
+	visit = func(table *schema.Table) {
+		if visited[table] {
+			return
+		}
+		visited[table] = true
+		for _, rel := range sortedRelations(table) {
+			if rel.Type == schema.BelongsToRelation && included[rel.JoinTable] {
+				visit(rel.JoinTable)
+			}
+		}
+		out = append(out, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+	return out
+}
+
+func sortedRelations(table *schema.Table) []*schema.Relation {
+	names := make([]string, 0, len(table.Relations))
+	for name := range table.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rels := make([]*schema.Relation, len(names))
+	for i, name := range names {
+		rels[i] = table.Relations[name]
+	}
+	return rels
+}
+
+func scaffoldRowID(table *schema.Table) string {
+	return strings.ToLower(table.TypeName) + "1"
+}
+
+func scaffoldFixture(table *schema.Table) []byte {
+	// foreign keys filled from the related example row
+	refs := map[string]string{}
+	for _, rel := range sortedRelations(table) {
+		if rel.Type != schema.BelongsToRelation {
+			continue
+		}
+		for i, field := range rel.BasePKs {
+			refs[field.Name] = fmt.Sprintf("{{ $.%s.%s.%s }}", rel.JoinTable.TypeName, scaffoldRowID(rel.JoinTable), rel.JoinPKs[i].GoName)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "- model: %s\n  rows:\n", table.TypeName)
+	fmt.Fprintf(&b, "    - _id: %s\n", scaffoldRowID(table))
+	for _, field := range table.Fields {
+		if field == table.SoftDeleteField || field.SQLDefault != "" || field.AutoIncrement || field.Identity {
+			continue
+		}
+		value, ok := refs[field.Name]
+		if ok {
+			value = strconv.Quote(value)
+		} else if value, ok = scaffoldValue(table, field); !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "      %s: %s\n", field.Name, value)
+	}
+	return []byte(b.String())
+}
+
+// scaffoldValue returns an example YAML value for field.
+func scaffoldValue(table *schema.Table, field *schema.Field) (string, bool) {
+	typ := field.IndirectType
+	if typ == timeType {
+		return strconv.Quote(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)), true
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		if field.IsPK {
+			return strconv.Quote(table.Name + "-1"), true
+		}
+		return strconv.Quote("example " + field.Name), true
+	case reflect.Bool:
+		return "false", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "1", true
+	case reflect.Float32, reflect.Float64:
+		return "1.0", true
+	case reflect.Map, reflect.Struct:
+		return "{}", true
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "", false
+		}
+		return "[]", true
+	case reflect.Array:
+		// e.g. uuid.UUID
+		if typ.Len() == 16 && typ.Elem().Kind() == reflect.Uint8 {
+			return strconv.Quote("00000000-0000-4000-8000-000000000001"), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type scaffoldTeam struct {
+	bun.BaseModel `bun:"table:scaffold_teams"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Name      string    `bun:"name,notnull"`
+	Active    bool      `bun:"active"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+}
+
+type scaffoldMember struct {
+	bun.BaseModel `bun:"table:scaffold_members"`
+
+	ID     int64         `bun:"id,pk,autoincrement"`
+	TeamID int64         `bun:"team_id,notnull"`
+	Role   string        `bun:"role,default:'member'"`
+	Team   *scaffoldTeam `bun:"rel:belongs-to,join:team_id=id"`
+}
+
+func TestScaffoldFixtures(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	files := ScaffoldFixtures(db, (*scaffoldMember)(nil), (*scaffoldTeam)(nil))
+	require.Len(t, files, 2)
+	assert.Equal(t, "- model: ScaffoldTeam\n  rows:\n    - _id: scaffoldteam1\n      name: \"example name\"\n      active: false\n      created_at: \"2024-01-01T00:00:00Z\"\n", string(files["01_scaffold_teams.yml"].Data))
+	assert.Equal(t, "- model: ScaffoldMember\n  rows:\n    - _id: scaffoldmember1\n      team_id: \"{{ $.ScaffoldTeam.scaffoldteam1.ID }}\"\n", string(files["02_scaffold_members.yml"].Data))
+
+	migrations := NewMigrations().RegisterSQLMigrations(modelTableMigrationFS(db, "20240101000000", "scaffold", (*scaffoldTeam)(nil), (*scaffoldMember)(nil)))
+	require.NoError(t, migrations.Migrate(ctx, db))
+	require.NoError(t, NewSeedManager(db, WithFS(files)).Load(ctx))
+
+	var member scaffoldMember
+	require.NoError(t, db.NewSelect().Model(&member).Relation("Team").Scan(ctx))
+	require.NotNil(t, member.Team)
+	assert.Equal(t, "example name", member.Team.Name)
+	assert.Equal(t, "member", member.Role)
+}
@@ -2,13 +2,17 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	apierrors "github.com/goliatone/go-errors"
 	"github.com/goliatone/hashid/pkg/hashid"
@@ -19,6 +23,7 @@ import (
 
 // Fixtures manages fixtures and seeds
 type Fixtures struct {
+	mu         sync.Mutex
 	dirs       []fs.FS
 	db         *bun.DB
 	truncate   bool
@@ -27,9 +32,23 @@ type Fixtures struct {
 	fixture    *dbfixture.Fixture
 	opts       []FixtureOption
 	FileFilter func(path, name string) bool
+	history    bool
+	onceFilter func(path, name string) bool
+	lastSeed   *OperationOutcome
 	lgr        Logger
 }
 
+// fixtureState is a consistent snapshot of the
+// state required to load fixture files.
+type fixtureState struct {
+	fixture *dbfixture.Fixture
+	dirs    []fs.FS
+	filter  func(path, name string) bool
+	history bool
+	once    func(path, name string) bool
+	report  *seedReport
+}
+
 // FixtureOption configures the seed manager
 type FixtureOption func(s *Fixtures)
 
@@ -88,7 +107,16 @@ func NewSeedManager(db *bun.DB, opts ...FixtureOption) *Fixtures {
 	return s
 }
 
+// init rebuilds the fixture state from scratch using the
+// currently registered options. Callers must hold s.mu.
 func (s *Fixtures) init() {
+	s.dirs = nil
+	s.truncate = false
+	s.drop = false
+	s.history = false
+	s.onceFilter = defaultOnceFilter
+	s.funcMap = defaultFuncs()
+
 	for _, o := range s.opts {
 		o(s)
 	}
@@ -102,28 +130,124 @@ func (s *Fixtures) init() {
 		opts = append(opts, dbfixture.WithTruncateTables())
 	}
 
-	opts = append(opts, dbfixture.WithTemplateFuncs(s.funcMap))
+	opts = append(opts, dbfixture.WithTemplateFuncs(s.funcMap), dbfixture.WithBeforeInsert(seedTxInsert))
 
 	// Recreate will drop existing table
 	s.fixture = dbfixture.New(s.db, opts...)
 }
 
-// AddOptions will configure options
+// AddOptions will configure options.
+// Options are applied lazily, the next Load or LoadFile
+// call rebuilds the fixture with the full option set.
 func (s *Fixtures) AddOptions(opts ...FixtureOption) *Fixtures {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.opts = append(s.opts, opts...)
+	s.fixture = nil
 	return s
 }
 
-// Load will load all fixtures from all configured directories.
-// It returns a rich error if any part of the process fails.
-func (s *Fixtures) Load(ctx context.Context) error {
+// SetLogger sets the fixtures logger
+func (s *Fixtures) SetLogger(logger Logger) {
+	if logger == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lgr = logger
+}
+
+// Reset rebuilds the underlying dbfixture with the
+// current options.
+func (s *Fixtures) Reset() *Fixtures {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+	return s
+}
+
+// prepare initializes the fixture if needed and returns a
+// consistent snapshot of the state required to load files.
+func (s *Fixtures) prepare() fixtureState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.fixture == nil {
 		s.init()
 	}
 
+	return fixtureState{
+		fixture: s.fixture,
+		dirs:    append([]fs.FS(nil), s.dirs...),
+		filter:  s.FileFilter,
+		history: s.history,
+		once:    s.onceFilter,
+		report:  &seedReport{},
+	}
+}
+
+// Load will load all fixtures from all configured directories.
+// It returns a rich error if any part of the process fails.
+// When ctx is done it stops before the next file, letting the one in
+// flight complete, and returns an ErrInterrupted error; LastSeed lists
+// the files loaded.
+func (s *Fixtures) Load(ctx context.Context) (err error) {
+	start := time.Now()
+	state := s.prepare()
+	defer func() { err = s.finish(state, "seed", start, err) }()
+
+	return s.loadAll(ctx, state)
+}
+
+// LoadMatching loads the fixture files of every configured directory
+// whose path matches one of the glob patterns, see path.Match. Patterns
+// without a slash are also matched against the file name, so "users.yml"
+// matches "seeds/users.yml". The file filter still applies.
+func (s *Fixtures) LoadMatching(ctx context.Context, patterns ...string) (err error) {
+	start := time.Now()
+	state := s.prepare()
+	defer func() { err = s.finish(state, "seed", start, err) }()
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid fixture pattern").
+				WithMetadata(map[string]any{"pattern": pattern})
+		}
+	}
+
+	filter := state.filter
+	state.filter = func(p, name string) bool {
+		return filter(p, name) && matchFixturePattern(patterns, p, name)
+	}
+
+	return s.loadAll(ctx, state)
+}
+
+// LoadFS loads the fixture files of fsys without registering it,
+// using the configured options and file filter.
+func (s *Fixtures) LoadFS(ctx context.Context, fsys fs.FS) (err error) {
+	start := time.Now()
+	state := s.prepare()
+	defer func() { err = s.finish(state, "seed", start, err) }()
+
+	return s.load(ctx, state, fsys)
+}
+
+// loadAll loads every directory of state, joining the errors.
+func (s *Fixtures) loadAll(ctx context.Context, state fixtureState) error {
 	var allErrors []error
-	for _, dir := range s.dirs {
-		if err := s.load(ctx, dir); err != nil {
+	for _, dir := range state.dirs {
+		err := s.load(ctx, state, dir)
+		if errors.Is(err, ErrInterrupted) {
+			if len(allErrors) == 0 {
+				return err
+			}
+			allErrors = append(allErrors, err)
+			break
+		}
+		if err != nil {
 			allErrors = append(allErrors, err)
 		}
 	}
@@ -136,9 +260,30 @@ func (s *Fixtures) Load(ctx context.Context) error {
 	return nil
 }
 
+// finish enriches err and records the outcome of a load.
+func (s *Fixtures) finish(state fixtureState, operation string, start time.Time, err error) error {
+	err = EnrichError(err, OperationInfo{Operation: operation, Dialect: dialectName(s.db), Start: start, Code: ErrorCodeSeedFailed})
+	s.recordOutcome(newOperationOutcome(OperationSeed, start, err), state.report)
+	return err
+}
+
+func matchFixturePattern(patterns []string, p, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // load walks a single directory and loads all valid fixture files within it.
 // This is the internal method where the logical bug was fixed.
-func (s *Fixtures) load(ctx context.Context, dir fs.FS) error {
+func (s *Fixtures) load(ctx context.Context, state fixtureState, dir fs.FS) error {
 	return fs.WalkDir(dir, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return apierrors.Wrap(err, apierrors.CategoryInternal, "error walking directory").WithMetadata(map[string]any{"path": path})
@@ -148,13 +293,16 @@ func (s *Fixtures) load(ctx context.Context, dir fs.FS) error {
 			return nil
 		}
 
-		if !s.FileFilter(path, d.Name()) {
+		if !state.filter(path, d.Name()) {
 			s.lgr.Debug("skipping file due to filter", "path", path)
 			return nil
 		}
 
-		s.lgr.Debug("loading fixture file", "file", path)
-		if loadErr := s.fixture.Load(ctx, dir, path); loadErr != nil {
+		if ctx.Err() != nil {
+			return interruptedError(ctx, OperationSeed, state.report.loaded)
+		}
+
+		if loadErr := s.loadFile(context.WithoutCancel(ctx), state, dir, path, d.Name()); loadErr != nil {
 			return apierrors.Wrap(loadErr, apierrors.CategoryOperation, "failed to load fixture data").
 				WithMetadata(map[string]any{"file": path})
 		}
@@ -164,21 +312,20 @@ func (s *Fixtures) load(ctx context.Context, dir fs.FS) error {
 }
 
 // LoadFile will search for and load a single file across all configured directories.
-func (s *Fixtures) LoadFile(ctx context.Context, file string) error {
-	if s.fixture == nil {
-		s.init()
-	}
+func (s *Fixtures) LoadFile(ctx context.Context, file string) (err error) {
+	start := time.Now()
+	state := s.prepare()
+	defer func() { err = s.finish(state, "seed_file", start, err) }()
 
-	if len(s.dirs) == 0 {
+	if len(state.dirs) == 0 {
 		return apierrors.Wrap(fs.ErrNotExist, apierrors.CategoryBadInput, "no filesystems configured to search for file").
 			WithMetadata(map[string]any{"file": file})
 	}
 
 	var lastErr error
-	for _, dir := range s.dirs {
-		err := s.fixture.Load(ctx, dir, file)
+	for _, dir := range state.dirs {
+		err := s.loadFile(ctx, state, dir, file, path.Base(file))
 		if err == nil {
-			s.lgr.Debug("loading fixture file", "file", file)
 			return nil
 		}
 
@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dbfixture"
+	"github.com/uptrace/bun/dialect"
+)
+
+// SeedRecord is a once-only fixture file that has been loaded,
+// stored in the seed_history table when seed history is enabled.
+type SeedRecord struct {
+	bun.BaseModel `bun:"table:seed_history"`
+
+	ID       int64     `bun:"id,pk,autoincrement"`
+	Path     string    `bun:"path,notnull,unique"`
+	Checksum string    `bun:"checksum"`
+	LoadedAt time.Time `bun:"loaded_at,notnull"`
+}
+
+// WithSeedHistory records once-only fixture files in the seed_history
+// table and skips them on later loads, which makes Seed safe to call on
+// every startup. Files are once-only when their name contains ".once.",
+// e.g. users.once.yml, see WithOnceFilter. A once-only file is loaded in
+// one transaction with its history record, so concurrent instances load
+// it once and a failed load can be retried.
+func WithSeedHistory() FixtureOption {
+	return func(s *Fixtures) {
+		s.history = true
+	}
+}
+
+// WithOnceFilter overrides which fixture files are loaded only once
+// when seed history is enabled.
+func WithOnceFilter(fn func(path, name string) bool) FixtureOption {
+	return func(s *Fixtures) {
+		if fn != nil {
+			s.onceFilter = fn
+		}
+	}
+}
+
+func defaultOnceFilter(_, name string) bool {
+	return strings.Contains(name, ".once.")
+}
+
+// SeedHistory lists the once-only fixture files already loaded.
+func (s *Fixtures) SeedHistory(ctx context.Context) ([]SeedRecord, error) {
+	if err := s.createSeedHistory(ctx); err != nil {
+		return nil, err
+	}
+	var records []SeedRecord
+	if err := s.db.NewSelect().Model(&records).Order("id").Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read seed history")
+	}
+	return records, nil
+}
+
+// loadFile loads a single fixture file, skipping and recording
+// once-only files when seed history is enabled.
+func (s *Fixtures) loadFile(ctx context.Context, state fixtureState, dir fs.FS, path, name string) error {
+	if !state.history || !state.once(path, name) {
+		s.lgr.Debug("loading fixture file", "file", path)
+		if err := state.fixture.Load(ctx, dir, path); err != nil {
+			return err
+		}
+		state.report.loaded = append(state.report.loaded, path)
+		return nil
+	}
+
+	data, err := fs.ReadFile(dir, path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	if err := s.createSeedHistory(ctx); err != nil {
+		return err
+	}
+
+	// The history row is claimed before the file is loaded, in the same
+	// transaction, so a concurrent loader blocks on the unique path and
+	// skips the file once this one commits.
+	loaded := false
+	err = RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		record := SeedRecord{Path: path, Checksum: checksum, LoadedAt: time.Now().UTC()}
+		insert := tx.NewInsert().Model(&record)
+		if tx.Dialect().Name() == dialect.MySQL {
+			insert = insert.Ignore()
+		} else {
+			insert = insert.On("CONFLICT DO NOTHING")
+		}
+		res, err := insert.Exec(ctx)
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to record seed history").
+				WithMetadata(map[string]any{"file": path})
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			s.lgr.Debug("loading once-only fixture file", "file", path)
+			loaded = true
+			return state.fixture.Load(context.WithValue(ctx, seedTxKey{}, tx), dir, path)
+		}
+
+		if err := tx.NewSelect().Model(&record).Where("path = ?", path).Scan(ctx); err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read seed history")
+		}
+		if record.Checksum != checksum {
+			s.lgr.Warn("once-only fixture changed after it was loaded", "file", path)
+		}
+		s.lgr.Debug("skipping once-only fixture file already loaded", "file", path, "loaded_at", record.LoadedAt)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if loaded {
+		state.report.loaded = append(state.report.loaded, path)
+	} else {
+		state.report.skipped = append(state.report.skipped, path)
+	}
+	return nil
+}
+
+func (s *Fixtures) createSeedHistory(ctx context.Context) error {
+	if _, err := s.db.NewCreateTable().Model((*SeedRecord)(nil)).IfNotExists().Exec(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create seed history table")
+	}
+	return nil
+}
+
+// seedTxKey carries the transaction loading a once-only fixture file.
+type seedTxKey struct{}
+
+// seedTxInsert runs fixture inserts on the transaction of a once-only
+// file, so its rows commit together with its seed history record.
+func seedTxInsert(ctx context.Context, data *dbfixture.BeforeInsertData) error {
+	if tx, ok := ctx.Value(seedTxKey{}).(bun.Tx); ok {
+		data.Query.Conn(tx)
+	}
+	return nil
+}
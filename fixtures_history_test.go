@@ -0,0 +1,114 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type seedHistoryItem struct {
+	ID   int64  `bun:"id,pk"`
+	Name string `bun:"name"`
+}
+
+func TestFixtures_SeedHistory(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	fixtures := NewSeedManager(db, WithSeedHistory(), WithFS(fstest.MapFS{
+		"items.once.yml": {Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: 1\n      name: once\n")},
+	}))
+
+	require.NoError(t, fixtures.Load(ctx))
+	require.NoError(t, fixtures.Load(ctx))
+
+	count, err := db.NewSelect().Model((*seedHistoryItem)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	records, err := fixtures.SeedHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "items.once.yml", records[0].Path)
+	assert.NotEmpty(t, records[0].Checksum)
+}
+
+func TestFixtures_SeedHistoryBeforeFirstLoad(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	records, err := NewSeedManager(db, WithSeedHistory()).SeedHistory(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestFixtures_SeedHistoryLoadIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	// the second row fails, the first must not stay behind
+	broken := NewSeedManager(db, WithSeedHistory(), WithFS(fstest.MapFS{
+		"items.once.yml": {Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: 1\n      name: a\n    - id: 1\n      name: b\n")},
+	}))
+	require.Error(t, broken.Load(ctx))
+
+	count, err := db.NewSelect().Model((*seedHistoryItem)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	records, err := broken.SeedHistory(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	// concurrent instances load a fixed file once
+	fsys := fstest.MapFS{
+		"items.once.yml": {Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: 1\n      name: once\n")},
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = NewSeedManager(db, WithSeedHistory(), WithFS(fsys)).Load(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	count, err = db.NewSelect().Model((*seedHistoryItem)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestFixtures_OnceFilesReloadWithoutHistory(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	fixtures := NewSeedManager(db, WithFS(fstest.MapFS{
+		"items.once.yml": {Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: 1\n      name: once\n")},
+	}))
+
+	require.NoError(t, fixtures.Load(ctx))
+	assert.Error(t, fixtures.Load(ctx), "duplicate primary key without history")
+}
@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtures_LoadMatchingAndLoadFS(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	row := func(id, name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: " + id + "\n      name: " + name + "\n")}
+	}
+	fixtures := NewSeedManager(db, WithFS(fstest.MapFS{
+		"base/users.yml": row("1", "users"),
+		"base/roles.yml": row("2", "roles"),
+		"demo/data.yml":  row("3", "demo"),
+	}))
+
+	names := func() []string {
+		var out []string
+		require.NoError(t, db.NewSelect().Model((*seedHistoryItem)(nil)).Column("name").Order("id").Scan(ctx, &out))
+		return out
+	}
+
+	require.NoError(t, fixtures.LoadMatching(ctx, "users.yml"))
+	assert.Equal(t, []string{"users"}, names())
+
+	require.NoError(t, fixtures.LoadMatching(ctx, "demo/*"))
+	assert.Equal(t, []string{"users", "demo"}, names())
+
+	assert.Error(t, fixtures.LoadMatching(ctx, "[invalid"))
+
+	require.NoError(t, fixtures.LoadFS(ctx, fstest.MapFS{"adhoc.yml": row("4", "adhoc")}))
+	assert.Equal(t, []string{"users", "demo", "adhoc"}, names())
+	assert.Len(t, fixtures.prepare().dirs, 1)
+}
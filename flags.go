@@ -0,0 +1,235 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+const defaultFlagsTTL = 30 * time.Second
+
+// FeatureFlag is a runtime flag stored in the feature_flags table.
+// Enabled drives boolean checks and Value holds an optional typed
+// payload, e.g. a rollout percentage or a JSON document.
+type FeatureFlag struct {
+	bun.BaseModel `bun:"table:feature_flags"`
+
+	Name        string    `bun:"name,pk" json:"name"`
+	Enabled     bool      `bun:"enabled,notnull" json:"enabled"`
+	Value       string    `bun:"value" json:"value,omitempty"`
+	Description string    `bun:"description" json:"description,omitempty"`
+	UpdatedAt   time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// FeatureFlagsMigrationFS returns up and down migrations for the
+// feature_flags table, named <version>_feature_flags.
+func FeatureFlagsMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "feature_flags", (*FeatureFlag)(nil))
+}
+
+// modelTableMigrationFS renders CREATE and DROP TABLE migrations for
+// models in the dialect of db.
+func modelTableMigrationFS(db bun.IDB, version, name string, models ...any) fstest.MapFS {
+	var up, down []byte
+	for i, model := range models {
+		up = append(up, db.NewCreateTable().Model(model).IfNotExists().String()...)
+		up = append(up, ";\n"...)
+		// drop in reverse order
+		drop := db.NewDropTable().Model(models[len(models)-1-i]).IfExists().String()
+		down = append(down, drop...)
+		down = append(down, ";\n"...)
+	}
+	base := fmt.Sprintf("%s_%s", version, name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: up},
+		base + ".down.sql": {Data: down},
+	}
+}
+
+// FlagsOption configures Flags
+type FlagsOption func(*Flags)
+
+// WithFlagsTTL sets how long flags are cached, 30 seconds by default.
+// A zero TTL disables caching.
+func WithFlagsTTL(ttl time.Duration) FlagsOption {
+	return func(f *Flags) {
+		if ttl >= 0 {
+			f.ttl = ttl
+		}
+	}
+}
+
+// Flags reads feature flags with a per flag TTL cache, so hot paths can
+// check flags without a query per call. Missing flags are cached too.
+type Flags struct {
+	db  bun.IDB
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]flagEntry
+}
+
+type flagEntry struct {
+	flag    FeatureFlag
+	found   bool
+	expires time.Time
+}
+
+// NewFlags creates a flag store backed by db. The feature_flags table
+// must exist, see FeatureFlagsMigrationFS.
+func NewFlags(db bun.IDB, opts ...FlagsOption) *Flags {
+	f := &Flags{
+		db:    db,
+		ttl:   defaultFlagsTTL,
+		now:   time.Now,
+		cache: make(map[string]flagEntry),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(f)
+		}
+	}
+	return f
+}
+
+// Get returns the named flag and whether it exists.
+func (f *Flags) Get(ctx context.Context, name string) (FeatureFlag, bool, error) {
+	now := f.now()
+	f.mu.Lock()
+	entry, ok := f.cache[name]
+	f.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.flag, entry.found, nil
+	}
+
+	var flag FeatureFlag
+	err := f.db.NewSelect().Model(&flag).Where("name = ?", name).Scan(ctx)
+	found := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return FeatureFlag{}, false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read feature flag").
+			WithMetadata(map[string]any{"flag": name})
+	}
+
+	if f.ttl > 0 {
+		f.mu.Lock()
+		f.cache[name] = flagEntry{flag: flag, found: found, expires: now.Add(f.ttl)}
+		f.mu.Unlock()
+	}
+	return flag, found, nil
+}
+
+// Set creates or updates flag and refreshes its cache entry.
+func (f *Flags) Set(ctx context.Context, flag FeatureFlag) error {
+	flag.UpdatedAt = f.now().UTC()
+	if _, err := Upsert(ctx, f.db, &flag, []string{"name"}, nil); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to save feature flag").
+			WithMetadata(map[string]any{"flag": flag.Name})
+	}
+	f.Invalidate(flag.Name)
+	return nil
+}
+
+// Delete removes the named flag.
+func (f *Flags) Delete(ctx context.Context, name string) error {
+	if _, err := f.db.NewDelete().Model((*FeatureFlag)(nil)).Where("name = ?", name).Exec(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to delete feature flag").
+			WithMetadata(map[string]any{"flag": name})
+	}
+	f.Invalidate(name)
+	return nil
+}
+
+// List returns every flag ordered by name, bypassing the cache.
+func (f *Flags) List(ctx context.Context) ([]FeatureFlag, error) {
+	var flags []FeatureFlag
+	if err := f.db.NewSelect().Model(&flags).Order("name").Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to list feature flags")
+	}
+	return flags, nil
+}
+
+// Invalidate drops cached entries for names, or all entries when
+// called without names.
+func (f *Flags) Invalidate(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(names) == 0 {
+		clear(f.cache)
+		return
+	}
+	for _, name := range names {
+		delete(f.cache, name)
+	}
+}
+
+// Enabled reports whether the named flag exists and is enabled. Read
+// errors are treated as disabled.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	flag, found, err := f.Get(ctx, name)
+	return err == nil && found && flag.Enabled
+}
+
+// String returns the value of an enabled flag, or def.
+func (f *Flags) String(ctx context.Context, name, def string) string {
+	flag, found, err := f.Get(ctx, name)
+	if err != nil || !found || !flag.Enabled {
+		return def
+	}
+	return flag.Value
+}
+
+// Int returns the value of an enabled flag parsed as an integer, or def.
+func (f *Flags) Int(ctx context.Context, name string, def int64) int64 {
+	return flagValue(ctx, f, name, def, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+}
+
+// Float returns the value of an enabled flag parsed as a float, or def.
+func (f *Flags) Float(ctx context.Context, name string, def float64) float64 {
+	return flagValue(ctx, f, name, def, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+}
+
+// Duration returns the value of an enabled flag parsed with
+// time.ParseDuration, or def.
+func (f *Flags) Duration(ctx context.Context, name string, def time.Duration) time.Duration {
+	return flagValue(ctx, f, name, def, time.ParseDuration)
+}
+
+// JSON decodes the value of the named flag into dst and reports whether
+// the flag exists and is enabled.
+func (f *Flags) JSON(ctx context.Context, name string, dst any) (bool, error) {
+	flag, found, err := f.Get(ctx, name)
+	if err != nil || !found || !flag.Enabled {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(flag.Value), dst); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid feature flag value").
+			WithMetadata(map[string]any{"flag": name})
+	}
+	return true, nil
+}
+
+func flagValue[T any](ctx context.Context, f *Flags, name string, def T, parse func(string) (T, error)) T {
+	flag, found, err := f.Get(ctx, name)
+	if err != nil || !found || !flag.Enabled {
+		return def
+	}
+	value, err := parse(flag.Value)
+	if err != nil {
+		return def
+	}
+	return value
+}
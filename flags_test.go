@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlags_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations().RegisterSQLMigrations(FeatureFlagsMigrationFS(db, "20240101000000"))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	flags := NewFlags(db, WithFlagsTTL(time.Minute))
+	flags.now = func() time.Time { return now }
+
+	assert.False(t, flags.Enabled(ctx, "checkout.v2"))
+	assert.Equal(t, int64(10), flags.Int(ctx, "rollout", 10))
+
+	require.NoError(t, flags.Set(ctx, FeatureFlag{Name: "checkout.v2", Enabled: true}))
+	require.NoError(t, flags.Set(ctx, FeatureFlag{Name: "rollout", Enabled: true, Value: "25"}))
+	require.NoError(t, flags.Set(ctx, FeatureFlag{Name: "timeout", Enabled: true, Value: "1500ms"}))
+	require.NoError(t, flags.Set(ctx, FeatureFlag{Name: "limits", Enabled: true, Value: `{"max":3}`}))
+	require.NoError(t, flags.Set(ctx, FeatureFlag{Name: "ratio", Enabled: false, Value: "0.5"}))
+
+	assert.True(t, flags.Enabled(ctx, "checkout.v2"))
+	assert.Equal(t, int64(25), flags.Int(ctx, "rollout", 10))
+	assert.Equal(t, 1500*time.Millisecond, flags.Duration(ctx, "timeout", time.Second))
+	assert.Equal(t, 0.1, flags.Float(ctx, "ratio", 0.1), "disabled flags return the default")
+	assert.Equal(t, "fallback", flags.String(ctx, "missing", "fallback"))
+
+	var limits struct{ Max int }
+	ok, err := flags.JSON(ctx, "limits", &limits)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, limits.Max)
+
+	// writes from elsewhere are visible once the TTL expires
+	_, err = db.NewUpdate().Model((*FeatureFlag)(nil)).Set("enabled = ?", false).Where("name = ?", "checkout.v2").Exec(ctx)
+	require.NoError(t, err)
+	assert.True(t, flags.Enabled(ctx, "checkout.v2"))
+	now = now.Add(2 * time.Minute)
+	assert.False(t, flags.Enabled(ctx, "checkout.v2"))
+
+	require.NoError(t, flags.Delete(ctx, "rollout"))
+	assert.Equal(t, int64(10), flags.Int(ctx, "rollout", 10))
+
+	list, err := flags.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 4)
+
+	require.NoError(t, migrations.RollbackAll(ctx, db))
+}
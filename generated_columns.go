@@ -0,0 +1,121 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+	"testing/fstest"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// GeneratedColumn materializes a VirtualField as a generated column, so
+// a frequently queried JSON key can be indexed like any other column.
+type GeneratedColumn struct {
+	Table  string
+	Column string
+	Field  VirtualField
+	// Type is the column type, TEXT by default (VARCHAR(255) on MySQL).
+	Type string
+	// Index adds an index named <table>_<column>_idx.
+	Index bool
+}
+
+// Validate checks the table, column, type and virtual field.
+func (g GeneratedColumn) Validate() error {
+	for _, name := range []string{g.Table, g.Column} {
+		if err := ValidateIdentifier(name); err != nil {
+			return err
+		}
+	}
+	if err := ValidateExpression(g.Type); err != nil {
+		return err
+	}
+	return g.Field.Validate()
+}
+
+func (g GeneratedColumn) indexName() string {
+	return strings.ReplaceAll(g.Table, ".", "_") + "_" + g.Column + "_idx"
+}
+
+// UpSQL returns the statements adding the column, and its index, for
+// the dialect. Postgres and MySQL store the value, SQLite can only add
+// virtual generated columns with ALTER TABLE, which it can still index.
+func (g GeneratedColumn) UpSQL(d schema.Dialect) ([]string, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	gen := schema.NewQueryGen(d)
+	typ, storage := g.Type, "STORED"
+	switch d.Name() {
+	case dialect.SQLite:
+		storage = "VIRTUAL"
+	case dialect.MySQL:
+		if typ == "" {
+			typ = "VARCHAR(255)"
+		}
+	}
+	if typ == "" {
+		typ = "TEXT"
+	}
+
+	stmts := []string{string(gen.AppendQuery(nil, "ALTER TABLE ? ADD COLUMN ? ? GENERATED ALWAYS AS (?) ?",
+		bun.Ident(g.Table), bun.Ident(g.Column), bun.Safe(typ), g.Field, bun.Safe(storage)))}
+	if g.Index {
+		stmts = append(stmts, string(gen.AppendQuery(nil, "CREATE INDEX ? ON ? (?)",
+			bun.Ident(g.indexName()), bun.Ident(g.Table), bun.Ident(g.Column))))
+	}
+	return stmts, nil
+}
+
+// DownSQL returns the statements dropping the index and the column.
+func (g GeneratedColumn) DownSQL(d schema.Dialect) ([]string, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	gen := schema.NewQueryGen(d)
+	var stmts []string
+	if g.Index {
+		if d.Name() == dialect.MySQL {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "DROP INDEX ? ON ?", bun.Ident(g.indexName()), bun.Ident(g.Table))))
+		} else {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "DROP INDEX IF EXISTS ?", bun.Ident(g.indexName()))))
+		}
+	}
+	stmts = append(stmts, string(gen.AppendQuery(nil, "ALTER TABLE ? DROP COLUMN ?", bun.Ident(g.Table), bun.Ident(g.Column))))
+	return stmts, nil
+}
+
+// GeneratedColumnsMigrationFS returns a migration adding columns for the
+// dialect of db, to register with RegisterSQLMigrations. Columns are
+// dropped in reverse order on rollback.
+func GeneratedColumnsMigrationFS(db bun.IDB, version, name string, columns ...GeneratedColumn) (fstest.MapFS, error) {
+	var up, down []byte
+	for i := range columns {
+		stmts, err := columns[i].UpSQL(db.Dialect())
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range stmts {
+			up = append(up, stmt...)
+			up = append(up, ";\n"...)
+		}
+
+		stmts, err = columns[len(columns)-1-i].DownSQL(db.Dialect())
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range stmts {
+			down = append(down, stmt...)
+			down = append(down, ";\n"...)
+		}
+	}
+	base := fmt.Sprintf("%s_%s", version, name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: up},
+		base + ".down.sql": {Data: down},
+	}, nil
+}
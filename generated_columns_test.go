@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestGeneratedColumnPostgresSQL(t *testing.T) {
+	col := GeneratedColumn{
+		Table:  "accounts",
+		Column: "plan",
+		Field:  NewVirtualField("metadata", "billing.plan"),
+		Index:  true,
+	}
+
+	up, err := col.UpSQL(pgdialect.New())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`ALTER TABLE "accounts" ADD COLUMN "plan" TEXT GENERATED ALWAYS AS ("metadata" #>> ARRAY['billing','plan']) STORED`,
+		`CREATE INDEX "accounts_plan_idx" ON "accounts" ("plan")`,
+	}, up)
+
+	down, err := col.DownSQL(pgdialect.New())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`DROP INDEX IF EXISTS "accounts_plan_idx"`,
+		`ALTER TABLE "accounts" DROP COLUMN "plan"`,
+	}, down)
+}
+
+func TestGeneratedColumnRejectsUnsafeInput(t *testing.T) {
+	_, err := GeneratedColumn{Table: "accounts", Column: "plan; --", Field: NewVirtualField("metadata", "plan")}.UpSQL(pgdialect.New())
+	assert.True(t, errors.Is(err, ErrUnsafeIdentifier))
+
+	_, err = GeneratedColumn{Table: "accounts", Column: "plan", Type: "TEXT; DROP TABLE accounts", Field: NewVirtualField("metadata", "plan")}.UpSQL(pgdialect.New())
+	assert.True(t, errors.Is(err, ErrUnsafeExpression))
+}
+
+func TestGeneratedColumnsMigrationSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE accounts (id INTEGER PRIMARY KEY, metadata TEXT)`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO accounts (id, metadata) VALUES (1, '{"billing":{"plan":"pro"}}'), (2, '{"billing":{"plan":"free"}}')`)
+	require.NoError(t, err)
+
+	fsys, err := GeneratedColumnsMigrationFS(db, "20240101000000", "accounts_plan", GeneratedColumn{
+		Table:  "accounts",
+		Column: "plan",
+		Field:  NewVirtualField("metadata", "billing.plan"),
+		Index:  true,
+	})
+	require.NoError(t, err)
+
+	migrations := NewMigrations().RegisterSQLMigrations(fsys)
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var ids []int64
+	require.NoError(t, db.NewSelect().Table("accounts").Column("id").Where("plan = ?", "pro").Scan(ctx, &ids))
+	assert.Equal(t, []int64{1}, ids)
+
+	var indexes int
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = 'accounts_plan_idx'").Scan(ctx, &indexes))
+	assert.Equal(t, 1, indexes)
+
+	require.NoError(t, migrations.Rollback(ctx, db))
+	var columns int
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM pragma_table_xinfo('accounts') WHERE name = 'plan'").Scan(ctx, &columns))
+	assert.Zero(t, columns)
+}
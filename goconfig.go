@@ -0,0 +1,132 @@
+package persistence
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultGoConfigPrefix is the key prefix FromGoConfig reads.
+const DefaultGoConfigPrefix = "persistence"
+
+// ErrConfigNil indicates Reconfigure was called without a config.
+var ErrConfigNil = errors.New("persistence: config is nil")
+
+// GoConfigValues is the key lookup of a go-config container, the koanf
+// instance it wraps satisfies it.
+type GoConfigValues interface {
+	Exists(key string) bool
+	String(key string) string
+	Bool(key string) bool
+	Duration(key string) time.Duration
+}
+
+// GoConfigOption configures FromGoConfig
+type GoConfigOption func(*goConfigOptions)
+
+type goConfigOptions struct {
+	prefix string
+}
+
+// WithGoConfigPrefix sets the key prefix, "persistence" by default. An
+// empty prefix reads top level keys.
+func WithGoConfigPrefix(prefix string) GoConfigOption {
+	return func(o *goConfigOptions) {
+		o.prefix = prefix
+	}
+}
+
+// FromGoConfig maps go-config values to a BasicConfig. Keys are read
+// below the prefix:
+//
+//	persistence:
+//	  driver: postgres
+//	  dsn: postgres://localhost:5432/app
+//	  debug: false
+//	  ping_timeout: 5s
+//	  otel_identifier: app
+//	  migrations_enabled: true
+//	  seeds_enabled: false
+//
+// Missing keys keep the NewConfig defaults.
+func FromGoConfig(values GoConfigValues, opts ...GoConfigOption) *BasicConfig {
+	o := &goConfigOptions{prefix: DefaultGoConfigPrefix}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+
+	cfg := NewConfig()
+	if values == nil {
+		return cfg
+	}
+	key := func(name string) string {
+		if o.prefix == "" {
+			return name
+		}
+		return o.prefix + "." + name
+	}
+	str := func(name string, dst *string) {
+		if values.Exists(key(name)) {
+			*dst = values.String(key(name))
+		}
+	}
+	flag := func(name string, dst *bool) {
+		if values.Exists(key(name)) {
+			*dst = values.Bool(key(name))
+		}
+	}
+
+	str("driver", &cfg.Driver)
+	str("server", &cfg.Server)
+	str("dsn", &cfg.DSN)
+	str("otel_identifier", &cfg.OtelIdentifier)
+	flag("debug", &cfg.Debug)
+	flag("migrations_enabled", &cfg.MigrationsEnabled)
+	flag("seeds_enabled", &cfg.SeedsEnabled)
+	if values.Exists(key("ping_timeout")) {
+		if timeout := values.Duration(key("ping_timeout")); timeout > 0 {
+			cfg.PingTimeout = timeout
+		}
+	}
+	return cfg
+}
+
+// Reconfigure swaps the client config, applying the ping timeout and the
+// GetMigrationsEnabled and GetSeedsEnabled toggles. Connection settings
+// (driver, server, DSN) need a new client, changes to them are logged
+// and otherwise ignored. Call it from one goroutine, e.g. a config
+// watcher, not concurrently with other client calls.
+func (c *Client) Reconfigure(cfg Config) error {
+	if cfg == nil {
+		return ErrConfigNil
+	}
+
+	if c.config != nil && (cfg.GetDriver() != c.config.GetDriver() ||
+		cfg.GetServer() != c.config.GetServer() ||
+		configDSN(cfg) != configDSN(c.config)) {
+		c.lgr.Warn("persistence connection settings changed, restart to apply them")
+	}
+
+	c.config = cfg
+	c.migrationsEnabled = true
+	if cmgr, ok := cfg.(interface{ GetMigrationsEnabled() bool }); ok {
+		c.migrationsEnabled = cmgr.GetMigrationsEnabled()
+	}
+	c.seedsEnabled = true
+	if smgr, ok := cfg.(interface{ GetSeedsEnabled() bool }); ok {
+		c.seedsEnabled = smgr.GetSeedsEnabled()
+	}
+	return nil
+}
+
+// GoConfigReloader returns a callback that rebuilds the config from
+// values and reconfigures c, to register as the go-config watch
+// callback.
+func GoConfigReloader(c *Client, values GoConfigValues, opts ...GoConfigOption) func() {
+	return func() {
+		if err := c.Reconfigure(FromGoConfig(values, opts...)); err != nil {
+			c.lgr.Error("persistence reconfigure failed", "error", err)
+		}
+	}
+}
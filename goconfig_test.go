@@ -0,0 +1,81 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type mapConfigValues map[string]any
+
+func (m mapConfigValues) Exists(key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func (m mapConfigValues) String(key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func (m mapConfigValues) Bool(key string) bool {
+	b, _ := m[key].(bool)
+	return b
+}
+
+func (m mapConfigValues) Duration(key string) time.Duration {
+	if s, ok := m[key].(string); ok {
+		d, _ := time.ParseDuration(s)
+		return d
+	}
+	return 0
+}
+
+func TestFromGoConfig(t *testing.T) {
+	cfg := FromGoConfig(mapConfigValues{
+		"persistence.driver":        "postgres",
+		"persistence.dsn":           "postgres://localhost:5432/app",
+		"persistence.debug":         true,
+		"persistence.ping_timeout":  "2s",
+		"persistence.seeds_enabled": false,
+	})
+	assert.Equal(t, "postgres", cfg.Driver)
+	assert.Equal(t, "postgres://localhost:5432/app", cfg.DSN)
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, 2*time.Second, cfg.PingTimeout)
+	assert.True(t, cfg.MigrationsEnabled)
+	assert.False(t, cfg.SeedsEnabled)
+
+	cfg = FromGoConfig(mapConfigValues{"db.server": "localhost"}, WithGoConfigPrefix("db"))
+	assert.Equal(t, "localhost", cfg.Server)
+	assert.Equal(t, DefaultDriver, cfg.Driver)
+	assert.Equal(t, DefaultPingTimeout, cfg.PingTimeout)
+
+	assert.Equal(t, NewConfig(), FromGoConfig(nil))
+}
+
+func TestClient_Reconfigure(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, pgdialect.New(), WithLazyConnect())
+	require.NoError(t, err)
+	assert.ErrorIs(t, client.Reconfigure(nil), ErrConfigNil)
+
+	values := mapConfigValues{"persistence.migrations_enabled": false, "persistence.ping_timeout": "3s"}
+	GoConfigReloader(client, values)()
+	assert.Equal(t, 3*time.Second, client.Config().GetPingTimeout())
+	assert.False(t, client.migrationsEnabled)
+	assert.True(t, client.seedsEnabled)
+
+	values["persistence.migrations_enabled"] = true
+	values["persistence.seeds_enabled"] = false
+	GoConfigReloader(client, values)()
+	assert.True(t, client.migrationsEnabled)
+	assert.False(t, client.seedsEnabled)
+}
@@ -0,0 +1,107 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// DefaultGolangMigrateTable is the version table of golang-migrate.
+const DefaultGolangMigrateTable = "schema_migrations"
+
+var (
+	golangMigrateFileRE  = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	golangMigrateTitleRE = regexp.MustCompile(`[^0-9a-z_\-]+`)
+)
+
+// GolangMigrateFS adapts a golang-migrate directory of
+// NNNN_title.up.sql/NNNN_title.down.sql files to the file names bun
+// expects, lower casing titles and replacing characters bun rejects.
+// Versions are kept, so the migration names match the versions recorded
+// by golang-migrate. Other files are ignored.
+func GolangMigrateFS(fsys fs.FS) (fstest.MapFS, error) {
+	out := fstest.MapFS{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		match := golangMigrateFileRE.FindStringSubmatch(d.Name())
+		if match == nil {
+			return nil
+		}
+		version, title, direction := match[1], match[2], match[3]
+		if len(version) > 14 {
+			return apierrors.New("golang-migrate version is longer than 14 digits", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"file": p})
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		title = strings.Trim(golangMigrateTitleRE.ReplaceAllString(strings.ToLower(title), "_"), "_")
+		if title == "" {
+			title = "migration"
+		}
+		out[path.Join(path.Dir(p), version+"_"+title+"."+direction+".sql")] = &fstest.MapFile{Data: data}
+		return nil
+	})
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to read golang-migrate directory")
+	}
+	return out, nil
+}
+
+// ImportGolangMigrateState marks every registered migration whose
+// version is at or below the version recorded by golang-migrate in table,
+// schema_migrations when empty, as applied, so Migrate only runs newer
+// ones. A dirty golang-migrate state is rejected, fix it with the
+// golang-migrate CLI first. It returns the migrations marked.
+func (m *Migrations) ImportGolangMigrateState(ctx context.Context, db *bun.DB, table string) ([]string, error) {
+	if table == "" {
+		table = DefaultGolangMigrateTable
+	}
+
+	var state struct {
+		Version int64 `bun:"version"`
+		Dirty   bool  `bun:"dirty"`
+	}
+	err := db.NewRaw("SELECT version, dirty FROM ? LIMIT 1", bun.Ident(table)).Scan(ctx, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read golang-migrate state").
+			WithMetadata(map[string]any{"table": table})
+	}
+	if state.Dirty {
+		return nil, apierrors.New("golang-migrate state is dirty", apierrors.CategoryConflict).
+			WithMetadata(map[string]any{"table": table, "version": state.Version})
+	}
+
+	status, err := m.Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, migration := range status {
+		version, err := strconv.ParseInt(migration.Name, 10, 64)
+		if err != nil || version > state.Version || migration.Applied {
+			continue
+		}
+		names = append(names, migration.Name)
+	}
+	if err := m.MarkApplied(ctx, db, names...); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGolangMigrateFS(t *testing.T) {
+	fsys, err := GolangMigrateFS(fstest.MapFS{
+		"migrations/000001_Create Users.up.sql":   {Data: []byte("CREATE TABLE gm_users (id INTEGER PRIMARY KEY)")},
+		"migrations/000001_Create Users.down.sql": {Data: []byte("DROP TABLE gm_users")},
+		"migrations/000002_add.email.up.sql":      {Data: []byte("ALTER TABLE gm_users ADD COLUMN email TEXT")},
+		"migrations/README.md":                    {Data: []byte("docs")},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for name := range fsys {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"migrations/000001_create_users.up.sql",
+		"migrations/000001_create_users.down.sql",
+		"migrations/000002_add_email.up.sql",
+	}, names)
+
+	_, err = GolangMigrateFS(fstest.MapFS{"123456789012345_x.up.sql": {}})
+	assert.Error(t, err)
+}
+
+func TestImportGolangMigrateState(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	// schema applied by golang-migrate up to version 2
+	for _, stmt := range []string{
+		"CREATE TABLE gm_users (id INTEGER PRIMARY KEY)",
+		"ALTER TABLE gm_users ADD COLUMN email TEXT",
+		"CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+		"INSERT INTO schema_migrations (version, dirty) VALUES (2, false)",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	fsys, err := GolangMigrateFS(fstest.MapFS{
+		"000001_create_users.up.sql": {Data: []byte("CREATE TABLE gm_users (id INTEGER PRIMARY KEY)")},
+		"000002_add_email.up.sql":    {Data: []byte("ALTER TABLE gm_users ADD COLUMN email TEXT")},
+		"000003_add_name.up.sql":     {Data: []byte("ALTER TABLE gm_users ADD COLUMN name TEXT")},
+	})
+	require.NoError(t, err)
+	migrations := NewMigrations().RegisterSQLMigrations(fsys)
+
+	imported, err := migrations.ImportGolangMigrateState(ctx, db, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"000001", "000002"}, imported)
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+	assert.Equal(t, []string{"000003"}, migrations.LastMigrate().Items)
+
+	imported, err = migrations.ImportGolangMigrateState(ctx, db, "")
+	require.NoError(t, err)
+	assert.Empty(t, imported)
+
+	_, err = db.ExecContext(ctx, "UPDATE schema_migrations SET dirty = true")
+	require.NoError(t, err)
+	_, err = migrations.ImportGolangMigrateState(ctx, db, DefaultGolangMigrateTable)
+	assert.Error(t, err)
+}
@@ -0,0 +1,346 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// Roles created by DefaultGrants.
+const (
+	RoleMigrations = "app_migrations"
+	RoleReadWrite  = "app_rw"
+	RoleReadOnly   = "app_ro"
+)
+
+// ErrGrantsUnsupported indicates role and grant management on a dialect
+// other than Postgres.
+var ErrGrantsUnsupported = errors.New("persistence: grants require postgres")
+
+var (
+	tablePrivileges    = privilegeSet("ALL", "SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER")
+	columnPrivileges   = privilegeSet("SELECT", "INSERT", "UPDATE", "REFERENCES")
+	schemaPrivileges   = privilegeSet("ALL", "USAGE", "CREATE")
+	sequencePrivileges = privilegeSet("ALL", "USAGE", "SELECT", "UPDATE")
+)
+
+func privilegeSet(privileges ...string) map[string]bool {
+	set := make(map[string]bool, len(privileges))
+	for _, p := range privileges {
+		set[p] = true
+	}
+	return set
+}
+
+// GrantRole is a role created when missing. Roles without Login are
+// group roles, granted to login roles with InRoles.
+type GrantRole struct {
+	Name  string
+	Login bool
+	// InRoles lists roles this role becomes a member of.
+	InRoles []string
+}
+
+// SchemaGrant grants schema privileges (USAGE, CREATE) and privileges on
+// every sequence of the schema, which inserts into serial columns need.
+type SchemaGrant struct {
+	Role string
+	// Schema is public when empty.
+	Schema             string
+	Privileges         []string
+	SequencePrivileges []string
+}
+
+// TableGrant grants privileges on the tables of Models, every registered
+// model when empty. With Columns the grant is limited to those columns,
+// which only SELECT, INSERT, UPDATE and REFERENCES support.
+type TableGrant struct {
+	Role       string
+	Privileges []string
+	Models     []any
+	Columns    []string
+}
+
+// Grants declares roles and their privileges on registered models, to
+// keep least-privilege setups in migrations.
+type Grants struct {
+	Roles   []GrantRole
+	Schemas []SchemaGrant
+	Tables  []TableGrant
+	// DropRoles makes DownSQL drop Roles. Roles are cluster wide and may
+	// be used elsewhere, so set it only on the migration creating them.
+	DropRoles bool
+}
+
+// DefaultGrants declares app_migrations, which owns schema changes,
+// app_rw, which reads and writes rows, and app_ro, which only reads.
+// All three are group roles, grant them to login roles with InRoles.
+func DefaultGrants() Grants {
+	return Grants{
+		Roles: []GrantRole{{Name: RoleMigrations}, {Name: RoleReadWrite}, {Name: RoleReadOnly}},
+		Schemas: []SchemaGrant{
+			{Role: RoleMigrations, Privileges: []string{"USAGE", "CREATE"}, SequencePrivileges: []string{"ALL"}},
+			{Role: RoleReadWrite, Privileges: []string{"USAGE"}, SequencePrivileges: []string{"USAGE", "SELECT"}},
+			{Role: RoleReadOnly, Privileges: []string{"USAGE"}},
+		},
+		Tables: []TableGrant{
+			{Role: RoleMigrations, Privileges: []string{"ALL"}},
+			{Role: RoleReadWrite, Privileges: []string{"SELECT", "INSERT", "UPDATE", "DELETE"}},
+			{Role: RoleReadOnly, Privileges: []string{"SELECT"}},
+		},
+	}
+}
+
+// ForModels returns the table grants of g limited to models, without
+// roles and schema grants, for a migration granting access to models
+// added after the first grants migration. Its DownSQL only revokes the
+// privileges on those tables.
+func (g Grants) ForModels(models ...any) Grants {
+	out := Grants{Tables: make([]TableGrant, len(g.Tables))}
+	for i, grant := range g.Tables {
+		grant.Models = models
+		out.Tables[i] = grant
+	}
+	return out
+}
+
+// UpSQL returns the statements creating the roles and granting the
+// privileges on db.
+func (g Grants) UpSQL(db *bun.DB) ([]string, error) {
+	if err := checkGrantsDialect(db); err != nil {
+		return nil, err
+	}
+	gen := schema.NewQueryGen(db.Dialect())
+
+	var stmts []string
+	for _, role := range g.Roles {
+		if err := ValidateIdentifier(role.Name); err != nil {
+			return nil, err
+		}
+		login := "NOLOGIN"
+		if role.Login {
+			login = "LOGIN"
+		}
+		stmts = append(stmts, string(gen.AppendQuery(nil,
+			"DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = ?) THEN CREATE ROLE ? ?; END IF; END $$",
+			role.Name, bun.Ident(role.Name), bun.Safe(login))))
+		for _, parent := range role.InRoles {
+			if err := ValidateIdentifier(parent); err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, string(gen.AppendQuery(nil, "GRANT ? TO ?", bun.Ident(parent), bun.Ident(role.Name))))
+		}
+	}
+
+	for _, grant := range g.Schemas {
+		schemaName, err := grant.validate()
+		if err != nil {
+			return nil, err
+		}
+		if len(grant.Privileges) > 0 {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "GRANT ? ON SCHEMA ? TO ?",
+				bun.Safe(joinPrivileges(grant.Privileges)), bun.Ident(schemaName), bun.Ident(grant.Role))))
+		}
+		if len(grant.SequencePrivileges) > 0 {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "GRANT ? ON ALL SEQUENCES IN SCHEMA ? TO ?",
+				bun.Safe(joinPrivileges(grant.SequencePrivileges)), bun.Ident(schemaName), bun.Ident(grant.Role))))
+		}
+	}
+
+	for _, grant := range g.Tables {
+		tables, err := grant.tables(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "GRANT ? ON ? TO ?",
+				bun.Safe(grant.privilegeList(gen)), bun.Safe(table.SQLName), bun.Ident(grant.Role))))
+		}
+	}
+	return stmts, nil
+}
+
+// DownSQL returns the statements revoking what UpSQL granted, in reverse
+// order. Roles are dropped only with DropRoles.
+func (g Grants) DownSQL(db *bun.DB) ([]string, error) {
+	if err := checkGrantsDialect(db); err != nil {
+		return nil, err
+	}
+	gen := schema.NewQueryGen(db.Dialect())
+
+	var stmts []string
+	for i := len(g.Tables) - 1; i >= 0; i-- {
+		grant := g.Tables[i]
+		tables, err := grant.tables(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "REVOKE ? ON ? FROM ?",
+				bun.Safe(grant.privilegeList(gen)), bun.Safe(table.SQLName), bun.Ident(grant.Role))))
+		}
+	}
+
+	for i := len(g.Schemas) - 1; i >= 0; i-- {
+		grant := g.Schemas[i]
+		schemaName, err := grant.validate()
+		if err != nil {
+			return nil, err
+		}
+		if len(grant.SequencePrivileges) > 0 {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "REVOKE ? ON ALL SEQUENCES IN SCHEMA ? FROM ?",
+				bun.Safe(joinPrivileges(grant.SequencePrivileges)), bun.Ident(schemaName), bun.Ident(grant.Role))))
+		}
+		if len(grant.Privileges) > 0 {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "REVOKE ? ON SCHEMA ? FROM ?",
+				bun.Safe(joinPrivileges(grant.Privileges)), bun.Ident(schemaName), bun.Ident(grant.Role))))
+		}
+	}
+
+	for i := len(g.Roles) - 1; i >= 0; i-- {
+		role := g.Roles[i]
+		if err := ValidateIdentifier(role.Name); err != nil {
+			return nil, err
+		}
+		for j := len(role.InRoles) - 1; j >= 0; j-- {
+			if err := ValidateIdentifier(role.InRoles[j]); err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, string(gen.AppendQuery(nil, "REVOKE ? FROM ?", bun.Ident(role.InRoles[j]), bun.Ident(role.Name))))
+		}
+		if g.DropRoles {
+			stmts = append(stmts, string(gen.AppendQuery(nil, "DROP ROLE IF EXISTS ?", bun.Ident(role.Name))))
+		}
+	}
+	return stmts, nil
+}
+
+// GrantsMigrationFS returns the grants as a migration named
+// <version>_<name>, to register with RegisterSQLMigrations. Register it
+// after the migrations creating the tables. When models are added,
+// register a new migration with grants.ForModels for them, so rolling
+// it back leaves the earlier grants in place.
+func GrantsMigrationFS(db *bun.DB, version, name string, grants Grants) (fstest.MapFS, error) {
+	up, err := grants.UpSQL(db)
+	if err != nil {
+		return nil, err
+	}
+	down, err := grants.DownSQL(db)
+	if err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("%s_%s", version, name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: []byte(strings.Join(up, ";\n") + ";\n")},
+		base + ".down.sql": {Data: []byte(strings.Join(down, ";\n") + ";\n")},
+	}, nil
+}
+
+func checkGrantsDialect(db *bun.DB) error {
+	if db.Dialect().Name() != dialect.PG {
+		return apierrors.Wrap(ErrGrantsUnsupported, apierrors.CategoryBadInput, "grants require postgres").
+			WithMetadata(map[string]any{"dialect": db.Dialect().Name().String()})
+	}
+	return nil
+}
+
+func (g SchemaGrant) validate() (string, error) {
+	schemaName := g.Schema
+	if schemaName == "" {
+		schemaName = "public"
+	}
+	for _, name := range []string{g.Role, schemaName} {
+		if err := ValidateIdentifier(name); err != nil {
+			return "", err
+		}
+	}
+	if err := validatePrivileges(g.Privileges, schemaPrivileges); err != nil {
+		return "", err
+	}
+	return schemaName, validatePrivileges(g.SequencePrivileges, sequencePrivileges)
+}
+
+func (g TableGrant) tables(db *bun.DB) ([]*schema.Table, error) {
+	if err := ValidateIdentifier(g.Role); err != nil {
+		return nil, err
+	}
+	if len(g.Privileges) == 0 {
+		return nil, apierrors.New("table grant has no privileges", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"role": g.Role})
+	}
+	allowed := tablePrivileges
+	if len(g.Columns) > 0 {
+		allowed = columnPrivileges
+	}
+	if err := validatePrivileges(g.Privileges, allowed); err != nil {
+		return nil, err
+	}
+
+	var tables []*schema.Table
+	if len(g.Models) == 0 {
+		tables = registeredTables(db)
+		sort.Slice(tables, func(i, j int) bool {
+			return tables[i].Name < tables[j].Name
+		})
+	} else {
+		for _, model := range g.Models {
+			tables = append(tables, db.Table(reflect.TypeOf(model)))
+		}
+	}
+	for _, table := range tables {
+		for _, column := range g.Columns {
+			if err := ValidateIdentifier(column); err != nil {
+				return nil, err
+			}
+			if !table.HasField(column) {
+				return nil, apierrors.New("grant column does not exist", apierrors.CategoryBadInput).
+					WithMetadata(map[string]any{"table": table.Name, "column": column})
+			}
+		}
+	}
+	return tables, nil
+}
+
+// privilegeList renders the privileges, each with the column list of a
+// column grant, e.g. SELECT ("id", "email").
+func (g TableGrant) privilegeList(gen schema.QueryGen) string {
+	if len(g.Columns) == 0 {
+		return joinPrivileges(g.Privileges)
+	}
+	columns := make([]string, len(g.Columns))
+	for i, column := range g.Columns {
+		columns[i] = string(gen.AppendQuery(nil, "?", bun.Ident(column)))
+	}
+	list := " (" + strings.Join(columns, ", ") + ")"
+	privileges := make([]string, len(g.Privileges))
+	for i, p := range g.Privileges {
+		privileges[i] = strings.ToUpper(p) + list
+	}
+	return strings.Join(privileges, ", ")
+}
+
+func joinPrivileges(privileges []string) string {
+	out := make([]string, len(privileges))
+	for i, p := range privileges {
+		out[i] = strings.ToUpper(p)
+	}
+	return strings.Join(out, ", ")
+}
+
+func validatePrivileges(privileges []string, allowed map[string]bool) error {
+	for _, p := range privileges {
+		if !allowed[strings.ToUpper(p)] {
+			return apierrors.New("invalid privilege", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"privilege": p})
+		}
+	}
+	return nil
+}
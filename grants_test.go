@@ -0,0 +1,131 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type grantAccount struct {
+	bun.BaseModel `bun:"table:grant_accounts"`
+
+	ID    int64  `bun:"id,pk,autoincrement"`
+	Email string `bun:"email"`
+	Token string `bun:"token"`
+}
+
+func TestGrantsMigrationFS(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	grants := Grants{
+		Roles: []GrantRole{{Name: RoleReadOnly}, {Name: "reporting", Login: true, InRoles: []string{RoleReadOnly}}},
+		Schemas: []SchemaGrant{
+			{Role: RoleReadOnly, Privileges: []string{"usage"}, SequencePrivileges: []string{"SELECT"}},
+		},
+		Tables: []TableGrant{
+			{Role: RoleReadOnly, Privileges: []string{"SELECT"}, Models: []any{(*grantAccount)(nil)}, Columns: []string{"id", "email"}},
+		},
+		DropRoles: true,
+	}
+	fsys, err := GrantsMigrationFS(db, "20240101000000", "grants", grants)
+	require.NoError(t, err)
+
+	assert.Equal(t, `DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app_ro') THEN CREATE ROLE "app_ro" NOLOGIN; END IF; END $$;
+DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'reporting') THEN CREATE ROLE "reporting" LOGIN; END IF; END $$;
+GRANT "app_ro" TO "reporting";
+GRANT USAGE ON SCHEMA "public" TO "app_ro";
+GRANT SELECT ON ALL SEQUENCES IN SCHEMA "public" TO "app_ro";
+GRANT SELECT ("id", "email") ON "grant_accounts" TO "app_ro";
+`, string(fsys["20240101000000_grants.up.sql"].Data))
+	assert.Equal(t, `REVOKE SELECT ("id", "email") ON "grant_accounts" FROM "app_ro";
+REVOKE SELECT ON ALL SEQUENCES IN SCHEMA "public" FROM "app_ro";
+REVOKE USAGE ON SCHEMA "public" FROM "app_ro";
+REVOKE "app_ro" FROM "reporting";
+DROP ROLE IF EXISTS "reporting";
+DROP ROLE IF EXISTS "app_ro";
+`, string(fsys["20240101000000_grants.down.sql"].Data))
+}
+
+func TestGrants_DefaultGrants(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	db.RegisterModel((*grantAccount)(nil))
+
+	stmts, err := DefaultGrants().UpSQL(db)
+	require.NoError(t, err)
+	assert.Contains(t, stmts, `GRANT ALL ON "grant_accounts" TO "app_migrations"`)
+	assert.Contains(t, stmts, `GRANT SELECT, INSERT, UPDATE, DELETE ON "grant_accounts" TO "app_rw"`)
+	assert.Contains(t, stmts, `GRANT SELECT ON "grant_accounts" TO "app_ro"`)
+	assert.Contains(t, stmts, `GRANT USAGE, CREATE ON SCHEMA "public" TO "app_migrations"`)
+}
+
+type grantInvoice struct {
+	bun.BaseModel `bun:"table:grant_invoices"`
+
+	ID int64 `bun:"id,pk,autoincrement"`
+}
+
+func TestGrants_ForModelsRevokesOnlyItsOwnGrants(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	db.RegisterModel((*grantAccount)(nil), (*grantInvoice)(nil))
+
+	down, err := DefaultGrants().DownSQL(db)
+	require.NoError(t, err)
+	for _, stmt := range down {
+		assert.NotContains(t, stmt, "DROP ROLE", "roles are kept without DropRoles")
+	}
+
+	followUp := DefaultGrants().ForModels((*grantInvoice)(nil))
+	up, err := followUp.UpSQL(db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`GRANT ALL ON "grant_invoices" TO "app_migrations"`,
+		`GRANT SELECT, INSERT, UPDATE, DELETE ON "grant_invoices" TO "app_rw"`,
+		`GRANT SELECT ON "grant_invoices" TO "app_ro"`,
+	}, up)
+
+	down, err = followUp.DownSQL(db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`REVOKE SELECT ON "grant_invoices" FROM "app_ro"`,
+		`REVOKE SELECT, INSERT, UPDATE, DELETE ON "grant_invoices" FROM "app_rw"`,
+		`REVOKE ALL ON "grant_invoices" FROM "app_migrations"`,
+	}, down)
+}
+
+func TestGrants_Invalid(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	cases := []Grants{
+		{Tables: []TableGrant{{Role: "app_ro", Privileges: []string{"DROP"}, Models: []any{(*grantAccount)(nil)}}}},
+		{Tables: []TableGrant{{Role: "app_ro", Privileges: []string{"DELETE"}, Models: []any{(*grantAccount)(nil)}, Columns: []string{"id"}}}},
+		{Tables: []TableGrant{{Role: "app_ro", Privileges: []string{"SELECT"}, Models: []any{(*grantAccount)(nil)}, Columns: []string{"missing"}}}},
+		{Tables: []TableGrant{{Role: "app_ro", Models: []any{(*grantAccount)(nil)}}}},
+		{Roles: []GrantRole{{Name: "app ro"}}},
+		{Schemas: []SchemaGrant{{Role: "app_ro", Privileges: []string{"SELECT"}}}},
+	}
+	for _, grants := range cases {
+		_, err := grants.UpSQL(db)
+		assert.Error(t, err)
+	}
+
+	sqlite, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	_, err = DefaultGrants().UpSQL(sqlite)
+	assert.ErrorIs(t, err, ErrGrantsUnsupported)
+}
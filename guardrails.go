@@ -0,0 +1,213 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// ErrGuardrailViolation is the cause of queries aborted by a guardrail.
+var ErrGuardrailViolation = errors.New("persistence: query guardrail violated")
+
+// Guardrail rules reported in GuardrailViolation.Rule.
+const (
+	GuardrailMaxRows      = "max-rows"
+	GuardrailMissingLimit = "missing-limit"
+	GuardrailMaxCost      = "max-cost"
+)
+
+// GuardrailAction is what happens to a query breaking a guardrail.
+type GuardrailAction int
+
+const (
+	// GuardrailWarn logs the violation and lets the query run.
+	GuardrailWarn GuardrailAction = iota
+	// GuardrailAbort cancels the query context before it runs, so the
+	// caller gets context.Canceled. Row counts are only known after the
+	// query, so GuardrailMaxRows violations are always logged.
+	GuardrailAbort
+)
+
+// GuardrailViolation describes a query breaking a guardrail.
+type GuardrailViolation struct {
+	Rule  string
+	Query string
+	Table string
+	Rows  int64
+	Cost  float64
+	Limit float64
+}
+
+type guardrailOptions struct {
+	maxRows     int64
+	maxCost     float64
+	largeTables map[string]struct{}
+	action      GuardrailAction
+	handler     func(ctx context.Context, v GuardrailViolation)
+}
+
+func (g *guardrailOptions) enabled() bool {
+	return g != nil && (g.maxRows > 0 || g.maxCost > 0 || len(g.largeTables) > 0)
+}
+
+func guardrailsOf(opts *clientOptions) *guardrailOptions {
+	if opts.guardrails == nil {
+		opts.guardrails = &guardrailOptions{}
+	}
+	return opts.guardrails
+}
+
+// WithMaxRows reports SELECT queries returning more than n rows.
+func WithMaxRows(n int64) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		guardrailsOf(opts).maxRows = n
+	}
+}
+
+// WithMaxQueryCost checks SELECT queries with EXPLAIN on Postgres and
+// reports those whose estimated total cost is above cost. It costs an
+// extra round trip per SELECT, so enable it where that is acceptable.
+func WithMaxQueryCost(cost float64) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		guardrailsOf(opts).maxCost = cost
+	}
+}
+
+// WithLargeTables reports SELECT queries reading one of tables without
+// a LIMIT, catching accidental full table reads.
+func WithLargeTables(tables ...string) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		g := guardrailsOf(opts)
+		if g.largeTables == nil {
+			g.largeTables = make(map[string]struct{}, len(tables))
+		}
+		for _, table := range tables {
+			g.largeTables[strings.ToLower(table)] = struct{}{}
+		}
+	}
+}
+
+// WithGuardrailAction sets whether guardrail violations are only
+// logged, the default, or abort the query.
+func WithGuardrailAction(action GuardrailAction) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		guardrailsOf(opts).action = action
+	}
+}
+
+// WithGuardrailHandler calls fn for every violation in addition to
+// logging it, e.g. to count them in metrics or fail tests.
+func WithGuardrailHandler(fn func(ctx context.Context, v GuardrailViolation)) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		guardrailsOf(opts).handler = fn
+	}
+}
+
+var (
+	guardrailLimitRE = regexp.MustCompile(`(?i)\bLIMIT\b|\bFETCH\s+(?:FIRST|NEXT)\b|^\s*SELECT\s+count\(`)
+	guardrailTableRE = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+((?:["` + "`" + `]?\w+["` + "`" + `]?\.)?["` + "`" + `]?\w+["` + "`" + `]?)`)
+)
+
+// guardrailHook enforces the guardrails configured on a client.
+type guardrailHook struct {
+	client *Client
+	opts   *guardrailOptions
+}
+
+func (h *guardrailHook) QueryHookKey() string {
+	return "guardrails"
+}
+
+func (h *guardrailHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if !strings.EqualFold(event.Operation(), "SELECT") {
+		return ctx
+	}
+
+	if len(h.opts.largeTables) > 0 && !guardrailLimitRE.MatchString(event.Query) {
+		for _, match := range guardrailTableRE.FindAllStringSubmatch(event.Query, -1) {
+			table := strings.ToLower(strings.Trim(match[1][strings.LastIndex(match[1], ".")+1:], "\"`"))
+			if _, ok := h.opts.largeTables[table]; ok {
+				return h.violate(ctx, GuardrailViolation{Rule: GuardrailMissingLimit, Query: event.Query, Table: table})
+			}
+		}
+	}
+
+	if h.opts.maxCost > 0 && event.DB != nil && event.DB.Dialect().Name() == dialect.PG {
+		// explain on the raw sql.DB so the hooks do not run again
+		var plan string
+		if err := event.DB.DB.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+event.Query).Scan(&plan); err == nil {
+			if cost, ok := explainTotalCost(plan); ok && cost > h.opts.maxCost {
+				return h.violate(ctx, GuardrailViolation{Rule: GuardrailMaxCost, Query: event.Query, Cost: cost, Limit: h.opts.maxCost})
+			}
+		}
+	}
+	return ctx
+}
+
+func (h *guardrailHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if h.opts.maxRows <= 0 || event.Err != nil || event.Result == nil || !strings.EqualFold(event.Operation(), "SELECT") {
+		return
+	}
+	if rows, err := event.Result.RowsAffected(); err == nil && rows > h.opts.maxRows {
+		h.report(ctx, GuardrailViolation{Rule: GuardrailMaxRows, Query: event.Query, Rows: rows, Limit: float64(h.opts.maxRows)})
+	}
+}
+
+func (h *guardrailHook) violate(ctx context.Context, v GuardrailViolation) context.Context {
+	h.report(ctx, v)
+	if h.opts.action != GuardrailAbort {
+		return ctx
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	cancel(ErrGuardrailViolation)
+	return ctx
+}
+
+func (h *guardrailHook) report(ctx context.Context, v GuardrailViolation) {
+	if queryLgr := h.client.queryLogger(); queryLgr != nil {
+		NewContextLogger(queryLgr).WarnCtx(ctx, "query guardrail violated",
+			"rule", v.Rule,
+			"table", v.Table,
+			"rows", v.Rows,
+			"cost", v.Cost,
+			"limit", v.Limit,
+			"query", v.Query,
+		)
+	}
+	if h.opts.handler != nil {
+		h.opts.handler(ctx, v)
+	}
+}
+
+// explainTotalCost reads the total cost of an EXPLAIN (FORMAT JSON) plan.
+func explainTotalCost(plan string) (float64, bool) {
+	var explain []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &explain); err != nil || len(explain) == 0 {
+		return 0, false
+	}
+	return explain[0].Plan.TotalCost, true
+}
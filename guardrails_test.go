@@ -0,0 +1,116 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type guardedEvent struct {
+	bun.BaseModel `bun:"table:events"`
+
+	ID int64 `bun:"id,pk"`
+}
+
+func TestGuardrails_SQLite(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), "guard.db"))
+	require.NoError(t, err)
+
+	var violations []GuardrailViolation
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, sqlitedialect.New(),
+		WithLazyConnect(),
+		WithMaxRows(2),
+		WithLargeTables("events"),
+		WithGuardrailHandler(func(_ context.Context, v GuardrailViolation) {
+			violations = append(violations, v)
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	db := client.DB()
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE events (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO events (id) VALUES (1), (2), (3)")
+	require.NoError(t, err)
+
+	var events []guardedEvent
+	require.NoError(t, db.NewSelect().Model(&events).Limit(10).Scan(ctx))
+	require.Len(t, violations, 1)
+	assert.Equal(t, GuardrailMaxRows, violations[0].Rule)
+	assert.Equal(t, int64(3), violations[0].Rows)
+
+	violations = nil
+	require.NoError(t, db.NewSelect().Model(&events).Where("id = 1").Scan(ctx))
+	require.Len(t, violations, 1)
+	assert.Equal(t, GuardrailMissingLimit, violations[0].Rule)
+	assert.Equal(t, "events", violations[0].Table)
+
+	violations = nil
+	_, err = db.NewSelect().Model((*guardedEvent)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, violations, "counts are not full reads")
+}
+
+func TestGuardrails_Abort(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), "guard.db"))
+	require.NoError(t, err)
+
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, sqlitedialect.New(),
+		WithLazyConnect(),
+		WithLargeTables("events"),
+		WithGuardrailAction(GuardrailAbort),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.DB().ExecContext(ctx, "CREATE TABLE events (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+
+	_, err = client.DB().QueryContext(ctx, `SELECT * FROM "events" JOIN other ON true`)
+	require.ErrorIs(t, err, context.Canceled)
+
+	rows, err := client.DB().QueryContext(ctx, `SELECT * FROM events LIMIT 1`)
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+}
+
+func TestGuardrails_MaxCostPostgres(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	var violations []GuardrailViolation
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, pgdialect.New(),
+		WithLazyConnect(),
+		WithMaxQueryCost(1000),
+		WithGuardrailHandler(func(_ context.Context, v GuardrailViolation) {
+			violations = append(violations, v)
+		}),
+	)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT \* FROM orders`).
+		WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow(`[{"Plan":{"Total Cost":15432.5}}]`))
+	mock.ExpectQuery(`SELECT \* FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rows, err := client.DB().QueryContext(context.Background(), "SELECT * FROM orders")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, violations, 1)
+	assert.Equal(t, GuardrailMaxCost, violations[0].Rule)
+	assert.InDelta(t, 15432.5, violations[0].Cost, 0.001)
+}
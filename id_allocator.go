@@ -0,0 +1,183 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/feature"
+)
+
+const defaultIDBlockSize = 100
+
+// ErrIDSequenceIncrement indicates a native sequence exists with an
+// increment other than the allocator block size, so its blocks would
+// overlap.
+var ErrIDSequenceIncrement = errors.New("persistence: id sequence increment does not match the block size")
+
+// IDSequence is a named counter in the id_sequences table. NextValue is
+// the first value not yet handed out to any allocator.
+type IDSequence struct {
+	bun.BaseModel `bun:"table:id_sequences"`
+
+	Name      string `bun:"name,pk"`
+	NextValue int64  `bun:"next_value,notnull"`
+}
+
+// IDAllocatorOption configures an IDAllocator
+type IDAllocatorOption func(*IDAllocator)
+
+// WithIDBlockSize sets how many ids are reserved per database round trip.
+func WithIDBlockSize(n int64) IDAllocatorOption {
+	return func(a *IDAllocator) {
+		if n > 0 {
+			a.blockSize = n
+		}
+	}
+}
+
+// WithNativeSequences reserves blocks from Postgres sequences named
+// <name>_hilo_seq, created on first use with INCREMENT BY the block size.
+// The name does not collide with the sequences of SERIAL and IDENTITY
+// columns, and an existing sequence with another increment is rejected
+// with ErrIDSequenceIncrement. Other dialects keep using the
+// id_sequences table.
+func WithNativeSequences() IDAllocatorOption {
+	return func(a *IDAllocator) {
+		a.native = true
+	}
+}
+
+// IDAllocator hands out numeric ids before insert using the hi-lo
+// pattern: each process reserves a block of ids in one atomic statement
+// and serves them from memory. Ids are unique and increasing per process
+// but may have gaps when a process exits with part of its block unused.
+type IDAllocator struct {
+	db        bun.IDB
+	blockSize int64
+	native    bool
+
+	mu       sync.Mutex
+	prepared map[string]bool
+	blocks   map[string]*idBlock
+}
+
+type idBlock struct {
+	next  int64
+	limit int64
+}
+
+// NewIDAllocator creates an allocator backed by db.
+func NewIDAllocator(db bun.IDB, opts ...IDAllocatorOption) *IDAllocator {
+	a := &IDAllocator{
+		db:        db,
+		blockSize: defaultIDBlockSize,
+		prepared:  make(map[string]bool),
+		blocks:    make(map[string]*idBlock),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(a)
+		}
+	}
+	return a
+}
+
+// Next returns the next id of the named sequence.
+func (a *IDAllocator) Next(ctx context.Context, name string) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	block := a.blocks[name]
+	if block == nil || block.next >= block.limit {
+		start, err := a.reserve(ctx, name)
+		if err != nil {
+			return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to reserve id block").
+				WithMetadata(map[string]any{"sequence": name, "block_size": a.blockSize})
+		}
+		block = &idBlock{next: start, limit: start + a.blockSize}
+		a.blocks[name] = block
+	}
+
+	id := block.next
+	block.next++
+	return id, nil
+}
+
+// reserve claims the next block of name and returns its first id.
+func (a *IDAllocator) reserve(ctx context.Context, name string) (int64, error) {
+	if a.native && a.db.Dialect().Name() == dialect.PG {
+		return a.reserveNative(ctx, name)
+	}
+
+	if !a.prepared[""] {
+		if _, err := a.db.NewCreateTable().Model((*IDSequence)(nil)).IfNotExists().Exec(ctx); err != nil {
+			return 0, err
+		}
+		a.prepared[""] = true
+	}
+
+	var end int64
+	err := RunInTx(ctx, a.db, func(ctx context.Context, tx bun.Tx) error {
+		insert := tx.NewInsert().Model(&IDSequence{Name: name, NextValue: 1})
+		if tx.Dialect().Name() == dialect.MySQL {
+			insert = insert.Ignore()
+		} else {
+			insert = insert.On("CONFLICT DO NOTHING")
+		}
+		if _, err := insert.Exec(ctx); err != nil {
+			return err
+		}
+
+		update := tx.NewUpdate().
+			Model((*IDSequence)(nil)).
+			Set("next_value = next_value + ?", a.blockSize).
+			Where("name = ?", name)
+		if tx.Dialect().Features().Has(feature.Returning) {
+			return update.Returning("next_value").Scan(ctx, &end)
+		}
+		if _, err := update.Exec(ctx); err != nil {
+			return err
+		}
+		return tx.NewSelect().Model((*IDSequence)(nil)).Column("next_value").Where("name = ?", name).Scan(ctx, &end)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return end - a.blockSize, nil
+}
+
+func (a *IDAllocator) reserveNative(ctx context.Context, name string) (int64, error) {
+	seqName := name + "_hilo_seq"
+	seq := bun.Ident(seqName)
+	if !a.prepared[name] {
+		_, err := a.db.NewRaw(fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS ? INCREMENT BY %d", a.blockSize), seq).Exec(ctx)
+		if err != nil {
+			return 0, err
+		}
+		// IF NOT EXISTS keeps an existing sequence as is
+		var increment int64
+		err = a.db.NewRaw(
+			"SELECT increment_by FROM pg_sequences WHERE schemaname = current_schema() AND sequencename = ?",
+			seqName,
+		).Scan(ctx, &increment)
+		if err != nil {
+			return 0, err
+		}
+		if increment != a.blockSize {
+			return 0, apierrors.Wrap(ErrIDSequenceIncrement, apierrors.CategoryBadInput, "id sequence increment does not match the block size").
+				WithMetadata(map[string]any{"sequence": seqName, "increment": increment})
+		}
+		a.prepared[name] = true
+	}
+
+	var start int64
+	if err := a.db.NewRaw("SELECT nextval('?')", seq).Scan(ctx, &start); err != nil {
+		return 0, err
+	}
+	return start, nil
+}
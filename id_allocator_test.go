@@ -0,0 +1,112 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestIDAllocator_SQLiteBlocks(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	first := NewIDAllocator(db, WithIDBlockSize(3))
+	second := NewIDAllocator(db, WithIDBlockSize(3))
+
+	var got []int64
+	for range 4 {
+		id, err := first.Next(ctx, "orders")
+		require.NoError(t, err)
+		got = append(got, id)
+	}
+	id, err := second.Next(ctx, "orders")
+	require.NoError(t, err)
+	got = append(got, id)
+
+	// first reserves 1-3 and 4-6, second 7-9
+	assert.Equal(t, []int64{1, 2, 3, 4, 7}, got)
+
+	other, err := first.Next(ctx, "invoices")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), other)
+
+	var seq IDSequence
+	require.NoError(t, db.NewSelect().Model(&seq).Where("name = ?", "orders").Scan(ctx))
+	assert.Equal(t, int64(10), seq.NextValue)
+}
+
+func TestIDAllocator_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	allocator := NewIDAllocator(db, WithIDBlockSize(5))
+	var (
+		mu   sync.Mutex
+		seen = map[int64]bool{}
+		wg   sync.WaitGroup
+	)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				id, err := allocator.Next(ctx, "tickets")
+				assert.NoError(t, err)
+				mu.Lock()
+				assert.False(t, seen[id], "duplicate id %d", id)
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 40)
+}
+
+func TestIDAllocator_NativeSequence(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectExec(`CREATE SEQUENCE IF NOT EXISTS "orders_hilo_seq" INCREMENT BY 50`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT increment_by FROM pg_sequences .* sequencename = 'orders_hilo_seq'`).
+		WillReturnRows(sqlmock.NewRows([]string{"increment_by"}).AddRow(50))
+	mock.ExpectQuery(`SELECT nextval\('"orders_hilo_seq"'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(101))
+
+	allocator := NewIDAllocator(db, WithIDBlockSize(50), WithNativeSequences())
+	id, err := allocator.Next(context.Background(), "orders")
+	require.NoError(t, err)
+	assert.Equal(t, int64(101), id)
+
+	id, err = allocator.Next(context.Background(), "orders")
+	require.NoError(t, err)
+	assert.Equal(t, int64(102), id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIDAllocator_NativeSequenceIncrementMismatch(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	// orders has a SERIAL id, its orders_id_seq sequence is left alone,
+	// while orders_hilo_seq was created earlier with another block size
+	mock.ExpectExec(`CREATE SEQUENCE IF NOT EXISTS "orders_hilo_seq" INCREMENT BY 50`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT increment_by FROM pg_sequences`).
+		WillReturnRows(sqlmock.NewRows([]string{"increment_by"}).AddRow(1))
+
+	allocator := NewIDAllocator(db, WithIDBlockSize(50), WithNativeSequences())
+	_, err = allocator.Next(context.Background(), "orders")
+	require.ErrorIs(t, err, ErrIDSequenceIncrement)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,166 @@
+package persistence
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// IndexAdvice reports whether a table has an index supporting
+// keyset pagination over the given sort columns.
+type IndexAdvice struct {
+	Table      string
+	Columns    []string
+	Supported  bool
+	IndexName  string
+	Indexes    map[string][]string
+	Suggestion string
+}
+
+// AdviseKeysetIndex inspects the catalog to find an index whose leading
+// key columns match columns, in order. Without one, keyset pagination on
+// those columns degrades into a sequential scan. Partial indexes and
+// included columns are ignored, and when several indexes match the one
+// with the fewest columns, then the first by name, is reported.
+// Supports Postgres and SQLite.
+func AdviseKeysetIndex(ctx context.Context, db bun.IDB, table string, columns ...string) (IndexAdvice, error) {
+	advice := IndexAdvice{
+		Table:   table,
+		Columns: normalizeColumns(columns),
+	}
+	if table == "" || len(advice.Columns) == 0 {
+		return advice, apierrors.New("table and at least one sort column are required", apierrors.CategoryBadInput)
+	}
+
+	indexes, err := tableIndexes(ctx, db, table)
+	if err != nil {
+		return advice, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to inspect table indexes").
+			WithMetadata(map[string]any{"table": table})
+	}
+	advice.Indexes = indexes
+
+	var candidates []string
+	for name, indexColumns := range indexes {
+		if hasColumnPrefix(indexColumns, advice.Columns) {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) > 0 {
+		slices.SortFunc(candidates, func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(indexes[a]), len(indexes[b])), cmp.Compare(a, b))
+		})
+		advice.Supported = true
+		advice.IndexName = candidates[0]
+		return advice, nil
+	}
+
+	advice.Suggestion = fmt.Sprintf(
+		"CREATE INDEX %s_%s_keyset_idx ON %s (%s)",
+		table, strings.Join(advice.Columns, "_"), table, strings.Join(advice.Columns, ", "),
+	)
+	return advice, nil
+}
+
+// LogKeysetIndexAdvice runs AdviseKeysetIndex and emits a warning
+// when the sort columns are not backed by an index.
+func LogKeysetIndexAdvice(ctx context.Context, db bun.IDB, lgr Logger, table string, columns ...string) (IndexAdvice, error) {
+	advice, err := AdviseKeysetIndex(ctx, db, table, columns...)
+	if err != nil {
+		return advice, err
+	}
+	if lgr == nil {
+		lgr = &defaultLogger{}
+	}
+	if !advice.Supported {
+		lgr.Warn("keyset pagination without supporting index",
+			"table", advice.Table,
+			"columns", strings.Join(advice.Columns, ","),
+			"suggestion", advice.Suggestion,
+		)
+	}
+	return advice, nil
+}
+
+func tableIndexes(ctx context.Context, db bun.IDB, table string) (map[string][]string, error) {
+	type indexColumn struct {
+		IndexName  string `bun:"index_name"`
+		ColumnName string `bun:"column_name"`
+	}
+	var rows []indexColumn
+
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		err := db.NewRaw(`
+			SELECT i.relname AS index_name, a.attname AS column_name
+			FROM pg_index x
+			JOIN pg_class t ON t.oid = x.indrelid
+			JOIN pg_class i ON i.oid = x.indexrelid
+			JOIN LATERAL unnest(x.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+			JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+			WHERE t.relname = ? AND pg_table_is_visible(t.oid)
+				AND x.indpred IS NULL AND k.ord <= x.indnkeyatts
+			ORDER BY i.relname, k.ord`, table).Scan(ctx, &rows)
+		if err != nil {
+			return nil, err
+		}
+	case dialect.SQLite:
+		err := db.NewRaw(`
+			SELECT il.name AS index_name, ii.name AS column_name
+			FROM pragma_index_list(?) AS il, pragma_index_info(il.name) AS ii
+			WHERE il.partial = 0
+			ORDER BY il.name, ii.seqno`, table).Scan(ctx, &rows)
+		if err != nil {
+			return nil, err
+		}
+		var pks []indexColumn
+		err = db.NewRaw(`
+			SELECT 'primary_key' AS index_name, name AS column_name
+			FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table).Scan(ctx, &pks)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, pks...)
+	default:
+		return nil, fmt.Errorf("index inspection not supported for dialect %q", db.Dialect().Name())
+	}
+
+	out := make(map[string][]string)
+	for _, row := range rows {
+		out[row.IndexName] = append(out[row.IndexName], strings.ToLower(row.ColumnName))
+	}
+	return out, nil
+}
+
+func normalizeColumns(columns []string) []string {
+	out := make([]string, 0, len(columns))
+	for _, column := range columns {
+		column = strings.ToLower(strings.TrimSpace(column))
+		// accept ORDER BY style input, e.g. "created_at DESC"
+		if idx := strings.IndexAny(column, " \t"); idx > 0 {
+			column = column[:idx]
+		}
+		column = strings.Trim(column, `"`)
+		if column != "" {
+			out = append(out, column)
+		}
+	}
+	return out
+}
+
+func hasColumnPrefix(indexColumns, columns []string) bool {
+	if len(indexColumns) < len(columns) {
+		return false
+	}
+	for i, column := range columns {
+		if indexColumns[i] != column {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestAdviseKeysetIndex_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE advisor_events (
+			id INTEGER PRIMARY KEY,
+			tenant_id TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `CREATE INDEX advisor_events_tenant_created_idx ON advisor_events (tenant_id, created_at, id)`)
+	require.NoError(t, err)
+
+	advice, err := AdviseKeysetIndex(ctx, db, "advisor_events", "tenant_id", "created_at DESC")
+	require.NoError(t, err)
+	assert.True(t, advice.Supported)
+	assert.Equal(t, "advisor_events_tenant_created_idx", advice.IndexName)
+
+	advice, err = AdviseKeysetIndex(ctx, db, "advisor_events", "id")
+	require.NoError(t, err)
+	assert.True(t, advice.Supported)
+	assert.Equal(t, "primary_key", advice.IndexName)
+
+	rec := &recordingLogger{}
+	advice, err = LogKeysetIndexAdvice(ctx, db, rec, "advisor_events", "created_at", "id")
+	require.NoError(t, err)
+	assert.False(t, advice.Supported)
+	assert.Equal(t, "CREATE INDEX advisor_events_created_at_id_keyset_idx ON advisor_events (created_at, id)", advice.Suggestion)
+	require.Len(t, rec.Lines(), 1)
+	assert.Contains(t, rec.Lines()[0], "keyset pagination without supporting index")
+}
+
+func TestAdviseKeysetIndex_Candidates(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	for _, stmt := range []string{
+		`CREATE TABLE advisor_jobs (id INTEGER PRIMARY KEY, queue TEXT NOT NULL, state TEXT NOT NULL, run_at TIMESTAMP)`,
+		`CREATE INDEX advisor_jobs_pending_idx ON advisor_jobs (run_at) WHERE state = 'pending'`,
+		`CREATE INDEX advisor_jobs_b_idx ON advisor_jobs (queue, run_at, id)`,
+		`CREATE INDEX advisor_jobs_c_idx ON advisor_jobs (queue, run_at)`,
+		`CREATE INDEX advisor_jobs_a_idx ON advisor_jobs (queue, run_at)`,
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	advice, err := AdviseKeysetIndex(ctx, db, "advisor_jobs", "run_at")
+	require.NoError(t, err)
+	assert.False(t, advice.Supported, "partial indexes do not support every page")
+	assert.NotContains(t, advice.Indexes, "advisor_jobs_pending_idx")
+
+	for range 5 {
+		advice, err = AdviseKeysetIndex(ctx, db, "advisor_jobs", "queue", "run_at")
+		require.NoError(t, err)
+		assert.Equal(t, "advisor_jobs_a_idx", advice.IndexName)
+	}
+}
+
+func TestAdviseKeysetIndex_PostgresKeyColumns(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectQuery(`x\.indpred IS NULL AND k\.ord <= x\.indnkeyatts`).WillReturnRows(
+		sqlmock.NewRows([]string{"index_name", "column_name"}).
+			AddRow("events_pkey", "id").
+			AddRow("events_tenant_idx", "tenant_id"),
+	)
+
+	advice, err := AdviseKeysetIndex(context.Background(), db, "events", "tenant_id")
+	require.NoError(t, err)
+	assert.Equal(t, "events_tenant_idx", advice.IndexName)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdviseKeysetIndex_ValidatesInput(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := AdviseKeysetIndex(context.Background(), db, "events")
+	assert.Error(t, err)
+}
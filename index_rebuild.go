@@ -0,0 +1,225 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	// MaintenanceRunning marks a maintenance task in progress.
+	MaintenanceRunning = "running"
+	// MaintenanceSucceeded marks a completed maintenance task.
+	MaintenanceSucceeded = "succeeded"
+	// MaintenanceFailed marks a maintenance task that returned an error.
+	MaintenanceFailed = "failed"
+
+	// IndexRebuildConcurrently is the method of REINDEX CONCURRENTLY
+	// rebuilds, on Postgres 12 and later.
+	IndexRebuildConcurrently = "reindex_concurrently"
+	// IndexRebuildSwap is the method of rebuilds creating a new index
+	// concurrently and swapping it in, on older versions.
+	IndexRebuildSwap = "swap"
+
+	postgres12 = 120000
+)
+
+// ErrIndexRebuildUnsupported indicates an index rebuild on a dialect
+// other than Postgres.
+var ErrIndexRebuildUnsupported = errors.New("persistence: online index rebuilds require postgres")
+
+// MaintenanceTask records a maintenance operation in the
+// maintenance_tasks table.
+type MaintenanceTask struct {
+	bun.BaseModel `bun:"table:maintenance_tasks"`
+
+	ID         int64        `bun:"id,pk,autoincrement"`
+	Kind       string       `bun:"kind,notnull"`
+	Target     string       `bun:"target,notnull"`
+	Method     string       `bun:"method"`
+	Node       string       `bun:"node"`
+	Status     string       `bun:"status,notnull"`
+	Error      string       `bun:"error"`
+	StartedAt  time.Time    `bun:"started_at,notnull"`
+	FinishedAt bun.NullTime `bun:"finished_at"`
+}
+
+// MaintenanceTasksMigrationFS returns up and down migrations for the
+// maintenance_tasks table, named <version>_maintenance_tasks, rendered
+// for the dialect of db.
+func MaintenanceTasksMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "maintenance_tasks", (*MaintenanceTask)(nil))
+}
+
+// IndexRebuilderOption configures an IndexRebuilder
+type IndexRebuilderOption func(*IndexRebuilder)
+
+// WithMaintenanceNode sets the node name recorded on tasks, the host
+// name by default.
+func WithMaintenanceNode(node string) IndexRebuilderOption {
+	return func(r *IndexRebuilder) {
+		if node != "" {
+			r.node = node
+		}
+	}
+}
+
+// IndexRebuilder rebuilds bloated Postgres indexes without blocking
+// writes. Every rebuild holds a lock named after the index, so when
+// several nodes schedule the same rebuild only one runs it, and is
+// recorded as a MaintenanceTask.
+type IndexRebuilder struct {
+	db    *bun.DB
+	locks *Locks
+	node  string
+	now   func() time.Time
+}
+
+// NewIndexRebuilder creates a rebuilder on db electing the node running
+// each rebuild with locks.
+func NewIndexRebuilder(db *bun.DB, locks *Locks, opts ...IndexRebuilderOption) *IndexRebuilder {
+	node, _ := os.Hostname()
+	r := &IndexRebuilder{db: db, locks: locks, node: node, now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// Rebuild rebuilds index, optionally schema qualified, with REINDEX
+// CONCURRENTLY on Postgres 12 and later. Older versions build a copy
+// with CREATE INDEX CONCURRENTLY, drop the original concurrently and
+// rename the copy, which leaves the table briefly without the index and
+// does not support indexes backing constraints.
+//
+// It returns an error wrapping ErrLockNotAcquired, and no task, when
+// another node is rebuilding the index.
+func (r *IndexRebuilder) Rebuild(ctx context.Context, index string) (*MaintenanceTask, error) {
+	if r.db.Dialect().Name() != dialect.PG {
+		return nil, apierrors.Wrap(ErrIndexRebuildUnsupported, apierrors.CategoryBadInput, "online index rebuilds require postgres").
+			WithMetadata(map[string]any{"dialect": r.db.Dialect().Name().String()})
+	}
+	if err := ValidateIdentifier(index); err != nil {
+		return nil, err
+	}
+
+	var task *MaintenanceTask
+	err := r.locks.WithLock(ctx, "reindex:"+index, func(ctx context.Context) error {
+		task = &MaintenanceTask{Kind: "reindex", Target: index, Node: r.node, Status: MaintenanceRunning, StartedAt: r.now().UTC()}
+		if _, err := r.db.NewInsert().Model(task).Exec(ctx); err != nil {
+			return EnrichError(err, OperationInfo{Operation: "insert", Table: "maintenance_tasks"})
+		}
+
+		method, rebuildErr := r.rebuild(ctx, index)
+		task.Method = method
+		task.Status = MaintenanceSucceeded
+		if rebuildErr != nil {
+			task.Status = MaintenanceFailed
+			task.Error = rebuildErr.Error()
+		}
+		task.FinishedAt = bun.NullTime{Time: r.now().UTC()}
+		// record the outcome even when ctx was canceled mid rebuild
+		_, err := r.db.NewUpdate().Model(task).Column("method", "status", "error", "finished_at").WherePK().Exec(context.WithoutCancel(ctx))
+		if rebuildErr != nil {
+			return rebuildErr
+		}
+		if err != nil {
+			return EnrichError(err, OperationInfo{Operation: "update", Table: "maintenance_tasks"})
+		}
+		return nil
+	}, LockTry())
+	return task, err
+}
+
+// RebuildAll rebuilds indexes in order, skipping those another node is
+// rebuilding, and returns the tasks it ran.
+func (r *IndexRebuilder) RebuildAll(ctx context.Context, indexes ...string) ([]*MaintenanceTask, error) {
+	var tasks []*MaintenanceTask
+	for _, index := range indexes {
+		task, err := r.Rebuild(ctx, index)
+		if task != nil {
+			tasks = append(tasks, task)
+		}
+		if err != nil && !errors.Is(err, ErrLockNotAcquired) {
+			return tasks, err
+		}
+	}
+	return tasks, nil
+}
+
+func (r *IndexRebuilder) rebuild(ctx context.Context, index string) (string, error) {
+	var version int
+	if err := r.db.NewRaw("SELECT current_setting('server_version_num')::int").Scan(ctx, &version); err != nil {
+		return "", apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read server version")
+	}
+	if version >= postgres12 {
+		if _, err := r.db.NewRaw("REINDEX INDEX CONCURRENTLY ?", bun.Ident(index)).Exec(ctx); err != nil {
+			return IndexRebuildConcurrently, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to reindex").
+				WithMetadata(map[string]any{"index": index})
+		}
+		return IndexRebuildConcurrently, nil
+	}
+	return IndexRebuildSwap, r.swap(ctx, index)
+}
+
+func (r *IndexRebuilder) swap(ctx context.Context, index string) error {
+	var def string
+	var constraint bool
+	err := r.db.NewRaw("SELECT pg_get_indexdef(?::regclass), EXISTS (SELECT 1 FROM pg_constraint WHERE conindid = ?::regclass)", index, index).
+		Scan(ctx, &def, &constraint)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read index definition").
+			WithMetadata(map[string]any{"index": index})
+	}
+	if constraint {
+		return apierrors.New("index backs a constraint, rebuilding it online requires Postgres 12", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"index": index})
+	}
+	at, on := strings.Index(def, " INDEX "), strings.Index(def, " ON ")
+	if at < 0 || on < at {
+		return apierrors.New("unexpected index definition", apierrors.CategoryInternal).
+			WithMetadata(map[string]any{"index": index, "definition": def})
+	}
+
+	schemaPrefix, name := "", index
+	if dot := strings.LastIndex(index, "."); dot >= 0 {
+		schemaPrefix, name = index[:dot+1], index[dot+1:]
+	}
+	tmpName := name + "_rebuild"
+	tmp := bun.Ident(schemaPrefix + tmpName)
+	// the definition may contain ?, pass it as a safe value so it is not
+	// parsed for placeholders
+	create := def[:at] + " INDEX CONCURRENTLY " +
+		string(schema.NewQueryGen(r.db.Dialect()).AppendQuery(nil, "?", bun.Ident(tmpName))) + def[on:]
+
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		// an invalid copy left by an interrupted rebuild
+		{"DROP INDEX CONCURRENTLY IF EXISTS ?", []any{tmp}},
+		{"?", []any{bun.Safe(create)}},
+		{"DROP INDEX CONCURRENTLY ?", []any{bun.Ident(index)}},
+		{"ALTER INDEX ? RENAME TO ?", []any{tmp, bun.Ident(name)}},
+	}
+	for i, step := range steps {
+		if _, err := r.db.NewRaw(step.query, step.args...).Exec(ctx); err != nil {
+			if i == 1 {
+				_, _ = r.db.NewRaw("DROP INDEX CONCURRENTLY IF EXISTS ?", tmp).Exec(context.WithoutCancel(ctx))
+			}
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to swap rebuilt index").
+				WithMetadata(map[string]any{"index": index, "step": i})
+		}
+	}
+	return nil
+}
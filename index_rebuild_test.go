@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func newIndexRebuilderMock(t *testing.T) (*IndexRebuilder, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	return NewIndexRebuilder(db, NewLocks(db), WithMaintenanceNode("node-1")), mock
+}
+
+func expectMaintenanceTask(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock(`)).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "maintenance_tasks"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+}
+
+func TestIndexRebuilder_ReindexConcurrently(t *testing.T) {
+	r, mock := newIndexRebuilderMock(t)
+	expectMaintenanceTask(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT current_setting('server_version_num')::int`)).
+		WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow(160002))
+	mock.ExpectExec(regexp.QuoteMeta(`REINDEX INDEX CONCURRENTLY "orders_created_at_idx"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "maintenance_tasks"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock(`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	task, err := r.Rebuild(context.Background(), "orders_created_at_idx")
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, task.ID)
+	assert.Equal(t, IndexRebuildConcurrently, task.Method)
+	assert.Equal(t, MaintenanceSucceeded, task.Status)
+	assert.Equal(t, "node-1", task.Node)
+	assert.False(t, task.FinishedAt.IsZero())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIndexRebuilder_SwapBeforePostgres12(t *testing.T) {
+	r, mock := newIndexRebuilderMock(t)
+	expectMaintenanceTask(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT current_setting('server_version_num')::int`)).
+		WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow(110005))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_get_indexdef('public.orders_meta_idx'::regclass)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"def", "constraint"}).
+			AddRow(`CREATE INDEX orders_meta_idx ON public.orders USING gin (meta) WHERE (meta ? 'tag'::text)`, false))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX CONCURRENTLY IF EXISTS "public"."orders_meta_idx_rebuild"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE INDEX CONCURRENTLY "orders_meta_idx_rebuild" ON public.orders USING gin (meta) WHERE (meta ? 'tag'::text)`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX CONCURRENTLY "public"."orders_meta_idx"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER INDEX "public"."orders_meta_idx_rebuild" RENAME TO "orders_meta_idx"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "maintenance_tasks"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock(`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	task, err := r.Rebuild(context.Background(), "public.orders_meta_idx")
+	require.NoError(t, err)
+	assert.Equal(t, IndexRebuildSwap, task.Method)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIndexRebuilder_OneNodeRuns(t *testing.T) {
+	r, mock := newIndexRebuilderMock(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock(`)).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+
+	task, err := r.Rebuild(context.Background(), "orders_created_at_idx")
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+	assert.Nil(t, task)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock(`)).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+	tasks, err := r.RebuildAll(context.Background(), "orders_created_at_idx")
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIndexRebuilder_RequiresPostgres(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := NewIndexRebuilder(db, NewLocks(db)).Rebuild(context.Background(), "idx")
+	assert.ErrorIs(t, err, ErrIndexRebuildUnsupported)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"io"
 	"io/fs"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uptrace/bun"
@@ -18,6 +21,7 @@ var (
 	bunMtx              sync.Mutex
 	modelsToRegister    []any
 	m2mModelsToRegister []any
+	registeredModels    []any
 )
 
 // DefaultDriver is the Postgres driver
@@ -48,9 +52,22 @@ type Client struct {
 	sqlDB             *sql.DB
 	migrations        *Migrations
 	fixtures          *Fixtures
+	statements        *StatementCache
+	pools             map[string]*bun.DB
+	failover          *FailoverConnector
 	migrationsEnabled bool
 	seedsEnabled      bool
+	lazyConnect       bool
+	startupRetries    int
+	startupBackoff    time.Duration
+	logSampling       int
+	logFields         map[string]any
 	lgr               Logger
+	// queryLgr is swapped by SetLogger while query hooks read it.
+	queryLgr *atomic.Pointer[Logger]
+	// adminMu serializes the operations of every admin handler of the
+	// client, HTTP and RPC alike.
+	adminMu *sync.Mutex
 }
 
 // RegisterModel registers a model in Bun or,
@@ -61,19 +78,70 @@ type Client struct {
 // can be referenced in table relations and fixtures.
 // persistence.RegisterModel((*models.User)(nil))
 // persistence.RegisterModel(&model.User{})
+// Models registered after New are only queued and a warning is
+// logged, use Client.RegisterModel instead.
 func RegisterModel(model ...any) {
 	bunMtx.Lock()
 	defer bunMtx.Unlock()
 
-	// TODO: Should we panic if we do this after New?
+	warnLateRegistration("RegisterModel")
 	modelsToRegister = append(modelsToRegister, model...)
+	registeredModels = append(registeredModels, model...)
 }
 
+// RegisterMany2ManyModel registers many to many join models, which
+// bun requires before the models that reference them.
 func RegisterMany2ManyModel(model ...any) {
 	bunMtx.Lock()
 	defer bunMtx.Unlock()
-	// TODO: Should we panic if we do this after New?
+
+	warnLateRegistration("RegisterMany2ManyModel")
 	m2mModelsToRegister = append(m2mModelsToRegister, model...)
+	registeredModels = append(registeredModels, model...)
+}
+
+// warnLateRegistration logs when package level registration happens
+// after New consumed the queue. Callers must hold bunMtx.
+func warnLateRegistration(fn string) {
+	if bunDB != nil {
+		log.Printf("persistence: %s called after New has no effect on the client, use Client.%s", fn, fn)
+	}
+}
+
+// RegisterModel registers models on the live bun.DB so they take
+// effect immediately, and adds them to RegisteredModels. It fails
+// with ErrUnregisteredM2MModel when a model references an m2m join
+// model that is not registered yet.
+func (c Client) RegisterModel(model ...any) error {
+	bunMtx.Lock()
+	defer bunMtx.Unlock()
+
+	for _, m := range model {
+		if err := registerModels(c.db, m); err != nil {
+			return err
+		}
+		for _, pool := range c.pools {
+			if err := registerModels(pool, m); err != nil {
+				return err
+			}
+		}
+		registeredModels = append(registeredModels, m)
+	}
+	return nil
+}
+
+// RegisterMany2ManyModel registers many to many join models on the
+// live bun.DB. Register them before the models that reference them.
+func (c Client) RegisterMany2ManyModel(model ...any) error {
+	return c.RegisterModel(model...)
+}
+
+// RegisteredModels returns every model passed to RegisterModel and
+// RegisterMany2ManyModel.
+func RegisteredModels() []any {
+	bunMtx.Lock()
+	defer bunMtx.Unlock()
+	return append([]any(nil), registeredModels...)
 }
 
 // New creates a new client
@@ -90,6 +158,9 @@ func New(cfg Config, sqlDB *sql.DB, dialect schema.Dialect, opts ...ClientOption
 		}
 		opt(clientOpts)
 	}
+	if err := validateConfig(cfg, dialect, clientOpts, false); err != nil {
+		return nil, err
+	}
 
 	client := Client{
 		config:            cfg,
@@ -98,6 +169,62 @@ func New(cfg Config, sqlDB *sql.DB, dialect schema.Dialect, opts ...ClientOption
 		seedsEnabled:      true,
 		migrationsEnabled: true,
 		sqlDB:             sqlDB,
+		lazyConnect:       clientOpts.lazyConnect,
+		startupRetries:    clientOpts.startupRetries,
+		startupBackoff:    clientOpts.startupBackoff,
+		logSampling:       clientOpts.logSampling,
+		logFields:         map[string]any{},
+		queryLgr:          &atomic.Pointer[Logger]{},
+		adminMu:           &sync.Mutex{},
+	}
+
+	if clientOpts.migrationHistory {
+		client.migrations.EnableHistory()
+	}
+	if clientOpts.outOfOrderPolicy != "" {
+		client.migrations.SetOutOfOrderPolicy(clientOpts.outOfOrderPolicy)
+	}
+	if clientOpts.noopErrors {
+		client.migrations.SetNoopErrors(true)
+	}
+
+	if dialect != nil {
+		client.logFields["dialect"] = dialect.Name().String()
+	}
+	for k, v := range clientOpts.logFields {
+		client.logFields[k] = v
+	}
+
+	if clientOpts.queryLogEnabled {
+		clientOpts.hooks = append(clientOpts.hooks, hookEntry{
+			hook:     &queryLogHook{client: &client},
+			priority: clientOpts.queryLogPriority,
+			order:    clientOpts.queryLogOrder,
+		})
+	}
+
+	if clientOpts.replicaRouting {
+		clientOpts.hooks = append(clientOpts.hooks, hookEntry{
+			hook:     writeTrackingHook{},
+			priority: defaultQueryHookPriority,
+			order:    -1,
+		})
+	}
+
+	if clientOpts.guardrails.enabled() {
+		clientOpts.hooks = append(clientOpts.hooks, hookEntry{
+			hook:     &guardrailHook{client: &client, opts: clientOpts.guardrails},
+			priority: defaultQueryHookPriority,
+			order:    -1,
+		})
+	}
+
+	if clientOpts.slowQueries.enabled() {
+		clientOpts.hooks = append(clientOpts.hooks, hookEntry{
+			hook:     &slowQueryHook{client: &client, opts: clientOpts.slowQueries},
+			priority: defaultQueryHookPriority,
+			order:    -1,
+		})
 	}
 
 	// our config can optionally configure migrations enablement
@@ -116,24 +243,82 @@ func New(cfg Config, sqlDB *sql.DB, dialect schema.Dialect, opts ...ClientOption
 	applyQueryHooks(bunDB, cfg, clientOpts)
 
 	// NOTE: m2m models should be registered first!
-	bunDB.RegisterModel(m2mModelsToRegister...)
-
-	bunDB.RegisterModel(modelsToRegister...)
+	bunMtx.Lock()
+	err := registerModels(bunDB, m2mModelsToRegister...)
+	if err == nil {
+		err = registerModels(bunDB, modelsToRegister...)
+	}
+	if err == nil && len(clientOpts.pools) > 0 {
+		client.pools, err = openPools(cfg, sqlDB, dialect, clientOpts)
+		for _, pool := range client.pools {
+			if err == nil {
+				err = registerModels(pool, registeredModels...)
+			}
+		}
+	}
 
 	modelsToRegister = nil
+	bunMtx.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
 	client.db = bunDB
 
 	client.fixtures = NewSeedManager(bunDB)
 
-	return &client, client.Check()
+	client.statements = NewStatementCache(sqlDB, clientOpts.statementCacheSize)
+
+	client.SetLogger(&defaultLogger{})
+
+	if client.lazyConnect {
+		return &client, nil
+	}
+
+	return &client, client.connect(context.Background())
 }
 
+// queryLogger returns the logger used by the query hooks, or nil.
+func (c *Client) queryLogger() Logger {
+	if c == nil || c.queryLgr == nil {
+		return nil
+	}
+	if lgr := c.queryLgr.Load(); lgr != nil {
+		return *lgr
+	}
+	return nil
+}
+
+// SetLogger sets the logger used by the client, migrations and fixtures.
+// Each component logs with its own "component" field plus the
+// client level fields, see WithLogFields.
 func (c *Client) SetLogger(logger Logger) {
-	c.lgr = logger
+	if logger == nil {
+		logger = &defaultLogger{}
+	}
+	logger = NewSampledLogger(logger, c.logSampling)
+
+	c.lgr = WithLoggerFields(logger, c.componentLogFields("persistence"))
+	queryLgr := WithLoggerFields(logger, c.componentLogFields("query"))
+	if c.queryLgr == nil {
+		c.queryLgr = &atomic.Pointer[Logger]{}
+	}
+	c.queryLgr.Store(&queryLgr)
 	if c.migrations != nil {
-		c.migrations.SetLogger(logger)
+		c.migrations.SetLogger(WithLoggerFields(logger, c.componentLogFields("migrations")))
 	}
+	if c.fixtures != nil {
+		c.fixtures.SetLogger(WithLoggerFields(logger, c.componentLogFields("fixtures")))
+	}
+}
+
+func (c *Client) componentLogFields(component string) map[string]any {
+	fields := make(map[string]any, len(c.logFields)+1)
+	for k, v := range c.logFields {
+		fields[k] = v
+	}
+	fields["component"] = component
+	return fields
 }
 
 // Seed will run seeds
@@ -145,6 +330,25 @@ func (c Client) Seed(ctx context.Context) error {
 	return c.fixtures.Load(ctx)
 }
 
+// SeedOnly loads the registered fixture files matching
+// the glob patterns, see Fixtures.LoadMatching.
+func (c Client) SeedOnly(ctx context.Context, patterns ...string) error {
+	if !c.seedsEnabled {
+		c.lgr.Warn("persistence seed is disabled")
+		return nil
+	}
+	return c.fixtures.LoadMatching(ctx, patterns...)
+}
+
+// SeedFrom loads the fixture files of fsys without registering it.
+func (c Client) SeedFrom(ctx context.Context, fsys fs.FS) error {
+	if !c.seedsEnabled {
+		c.lgr.Warn("persistence seed is disabled")
+		return nil
+	}
+	return c.fixtures.LoadFS(ctx, fsys)
+}
+
 // GetFixtures will return fixtures
 func (c Client) GetFixtures() *Fixtures {
 	return c.fixtures
@@ -165,6 +369,17 @@ func (c Client) Migrate(ctx context.Context) error {
 	return c.migrations.Migrate(ctx, c.db)
 }
 
+// MigrateWithRollbackOnFailure migrates db rolling back the whole
+// group if any migration in it fails.
+func (c Client) MigrateWithRollbackOnFailure(ctx context.Context) error {
+	if !c.migrationsEnabled {
+		c.lgr.Warn("[WARN] persistence migrations are disabled")
+		return nil
+	}
+
+	return c.migrations.MigrateWithRollbackOnFailure(ctx, c.db)
+}
+
 // RegisterFixtures adds file based fixtures
 func (c Client) RegisterFixtures(migrations ...fs.FS) *Fixtures {
 	for _, f := range migrations {
@@ -173,11 +388,33 @@ func (c Client) RegisterFixtures(migrations ...fs.FS) *Fixtures {
 	return c.GetFixtures()
 }
 
+// RegisterFixturesFromArchive adds the fixture files contained
+// in a .zip or .tar.gz archive, see ArchiveFS.
+func (c Client) RegisterFixturesFromArchive(r io.ReaderAt, size int64) (*Fixtures, error) {
+	fsys, err := ArchiveFS(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return c.RegisterFixtures(fsys), nil
+}
+
 // RegisterSQLMigrations adds SQL based migrations
 func (c Client) RegisterSQLMigrations(migrations ...fs.FS) *Migrations {
 	return c.migrations.RegisterSQLMigrations(migrations...)
 }
 
+// RegisterSQLMigrationsFromArchive adds the SQL migrations contained
+// in a .zip or .tar.gz archive, see ArchiveFS.
+func (c Client) RegisterSQLMigrationsFromArchive(r io.ReaderAt, size int64) error {
+	return c.migrations.RegisterSQLMigrationsFromArchive(r, size)
+}
+
+// MigrationNamespace returns the migrations registered under name, tracked
+// in their own <name>_migrations table, see Migrations.Namespace.
+func (c Client) MigrationNamespace(name string) *Migrations {
+	return c.migrations.Namespace(name)
+}
+
 // RegisterDialectMigrations adds dialect-aware SQL migrations.
 func (c Client) RegisterDialectMigrations(root fs.FS, opts ...DialectMigrationOption) *Migrations {
 	return c.migrations.RegisterDialectMigrations(root, opts...)
@@ -205,6 +442,12 @@ func (c Client) RollbackAll(ctx context.Context, opts ...migrate.MigrationOption
 	return c.migrations.RollbackAll(ctx, c.db, opts...)
 }
 
+// MigrationStatus lists registered migrations with their applied
+// state and latest recorded run.
+func (c Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return c.migrations.Status(ctx, c.db)
+}
+
 // Report returns the status of migrations.
 // It returns nil if Execute has not been called
 // or has failed.
@@ -212,11 +455,33 @@ func (c Client) Report() *migrate.MigrationGroup {
 	return c.migrations.Report()
 }
 
+// LastReport returns the outcomes of the latest Migrate,
+// Rollback and Seed operations.
+func (c Client) LastReport() OperationsReport {
+	return OperationsReport{
+		Migrate:  c.migrations.LastMigrate(),
+		Rollback: c.migrations.LastRollback(),
+		Seed:     c.fixtures.LastSeed(),
+	}
+}
+
 // DB returns a database
 func (c Client) DB() *bun.DB {
 	return c.db
 }
 
+// HookDiagnostics lists the registered query hooks in execution
+// order, with the cumulative time spent in each of them.
+func (c Client) HookDiagnostics() []QueryHookDiagnostic {
+	return queryHookDiagnostics(c.db)
+}
+
+// Statements returns the named query registry and its prepared
+// statement cache, see WithStatementCache.
+func (c Client) Statements() *StatementCache {
+	return c.statements
+}
+
 // Config returns the client configuration
 func (c Client) Config() Config {
 	return c.config
@@ -235,6 +500,30 @@ func (c Client) Check() error {
 	return c.Ping(ctx)
 }
 
+// connect pings the database honoring the configured
+// startup retry policy. Each attempt gets its own ping timeout.
+func (c Client) connect(ctx context.Context) error {
+	backoff := c.startupBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, c.config.GetPingTimeout())
+		err = c.Ping(pingCtx)
+		cancel()
+		if err == nil || attempt >= c.startupRetries {
+			return err
+		}
+
+		c.lgr.Warn("persistence connect attempt failed, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
 // MustConnect will panic if no connection
 func (c Client) MustConnect() {
 	if err := c.Check(); err != nil {
@@ -246,7 +535,12 @@ func (c Client) MustConnect() {
 // Close will close the client
 func (c Client) Close() error {
 	// TODO: wrap errors
+	if c.statements != nil {
+		_ = c.statements.Close()
+	}
+	_ = c.closePools()
 	c.db.Close()
+	ReleaseHooks(c.db)
 	return c.sqlDB.Close()
 }
 
@@ -254,10 +548,13 @@ func (c Client) Close() error {
 func (c *Client) Start(ctx context.Context) error {
 	c.lgr.Info("Initializing database", "timeout", c.config.GetPingTimeout())
 
-	ctx, cancel := context.WithTimeout(ctx, c.config.GetPingTimeout())
+	ctx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
 
-	return c.Ping(ctx)
+	if c.failover != nil {
+		go c.failover.Run(ctx)
+	}
+	return c.connect(ctx)
 }
 
 // Stop will stop the service
@@ -273,7 +570,8 @@ func (c *Client) Stop(ctx context.Context) error {
 	case <-ctx.Done():
 		err = errors.New("max time exeeded")
 	default:
-		err = c.db.Close()
+		err = errors.Join(c.closePools(), c.db.Close())
+		ReleaseHooks(c.db)
 	}
 
 	return err
@@ -1,11 +1,15 @@
 package persistence
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"embed"
+	"log"
+	"os"
 
 	"io/fs"
+	"sync"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -14,6 +18,7 @@ import (
 	"github.com/goliatone/go-errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 )
@@ -202,3 +207,71 @@ func TestFixturesLoad(t *testing.T) {
 		assert.NotNil(t, fixtures.fixture)
 	})
 }
+
+func TestFixturesAddOptionsAfterInit(t *testing.T) {
+	mockDB := bun.NewDB(new(sql.DB), pgdialect.New())
+	fixtures := NewSeedManager(mockDB)
+
+	fixtures.Reset()
+	assert.NotNil(t, fixtures.fixture)
+	assert.Len(t, fixtures.dirs, 0)
+
+	fixtures.AddOptions(WithFS(fstest.MapFS{}), WithTrucateTables())
+	assert.Nil(t, fixtures.fixture)
+
+	state := fixtures.prepare()
+	assert.NotNil(t, state.fixture)
+	assert.Len(t, state.dirs, 1)
+	assert.True(t, fixtures.truncate)
+
+	// re-initializing must not duplicate option side effects
+	fixtures.Reset()
+	assert.Len(t, fixtures.dirs, 1)
+}
+
+func TestFixturesConcurrentAddOptions(t *testing.T) {
+	mockDB := bun.NewDB(new(sql.DB), pgdialect.New())
+	fixtures := NewSeedManager(mockDB)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			fixtures.AddOptions(WithFS(fstest.MapFS{}))
+		}()
+		go func() {
+			defer wg.Done()
+			fixtures.prepare()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, fixtures.prepare().dirs, 10)
+}
+
+func TestClientRegisterModelAfterNew(t *testing.T) {
+	defer resetInit()
+
+	type LateModel struct {
+		ID int64 `bun:"id,pk"`
+	}
+
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	client, err := New(staticConfig{pingTimeout: time.Second}, db, pgdialect.New(), WithLazyConnect())
+	require.NoError(t, err)
+
+	require.NoError(t, client.RegisterModel((*LateModel)(nil)))
+	assert.NotNil(t, client.DB().Dialect().Tables().ByModel("LateModel"))
+	assert.Contains(t, RegisteredModels(), (*LateModel)(nil))
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	RegisterModel((*LateModel)(nil))
+	assert.Contains(t, buf.String(), "RegisterModel called after New")
+}
@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun/migrate"
+)
+
+// ErrInterrupted is the cause of the errors returned when ctx is done
+// between the units of work of a fixture load, Migrate or RollbackAll.
+// The error also matches the context error, and its metadata lists the
+// completed units, as does the operation outcome.
+var ErrInterrupted = errors.New("persistence: operation interrupted")
+
+// interruptedError reports operation stopped by ctx after completing
+// the done units.
+func interruptedError(ctx context.Context, operation string, done []string) error {
+	cause := context.Cause(ctx)
+	code, _ := classifyDBError(cause)
+	return apierrors.Wrap(fmt.Errorf("%w: %w", ErrInterrupted, cause), apierrors.CategoryOperation, operation+" interrupted").
+		WithTextCode(code).
+		WithMetadata(map[string]any{
+			"operation": operation,
+			"completed": slices.Clone(done),
+		})
+}
+
+// migrationInterrupts stops a migrator between migrations once ctx is
+// done. The migrator runs with a context without cancellation, so the
+// migration in flight is never cut half way.
+type migrationInterrupts struct {
+	ctx     context.Context
+	stopped *migrate.Migration
+}
+
+// wrap returns migrations with every up and down function checking ctx
+// before it runs.
+func (i *migrationInterrupts) wrap(migrations *migrate.Migrations) *migrate.Migrations {
+	wrapped := migrate.NewMigrations()
+	for _, migration := range migrations.Sorted() {
+		if up := migration.Up; up != nil {
+			migration.Up = func(ctx context.Context, migrator *migrate.Migrator, migration *migrate.Migration) error {
+				if i.ctx.Err() != nil {
+					i.stopped = migration
+					return ErrInterrupted
+				}
+				return up(ctx, migrator, migration)
+			}
+		}
+		if down := migration.Down; down != nil {
+			migration.Down = func(ctx context.Context, migrator *migrate.Migrator, migration *migrate.Migration) error {
+				if i.ctx.Err() != nil {
+					i.stopped = migration
+					return ErrInterrupted
+				}
+				return down(ctx, migrator, migration)
+			}
+		}
+		wrapped.Add(migration)
+	}
+	return wrapped
+}
+
+// restore reverts the mark the migrator set on the stopped migration
+// before calling it, applied when migrating and unapplied when rolling
+// back.
+func (i *migrationInterrupts) restore(migrator *migrate.Migrator, up bool) error {
+	ctx := context.WithoutCancel(i.ctx)
+	var err error
+	if up {
+		err = migrator.MarkUnapplied(ctx, i.stopped)
+	} else {
+		err = migrator.MarkApplied(ctx, i.stopped)
+	}
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to restore the status of an interrupted migration").
+			WithMetadata(map[string]any{"migration": i.stopped.Name})
+	}
+	return nil
+}
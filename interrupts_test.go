@@ -0,0 +1,125 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+// cancelOnQuery cancels a context after the first query containing match.
+type cancelOnQuery struct {
+	match  string
+	cancel context.CancelFunc
+}
+
+func (h *cancelOnQuery) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *cancelOnQuery) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if strings.Contains(event.Query, h.match) {
+		h.cancel()
+	}
+}
+
+func assertInterrupted(t *testing.T, err error, completed []string) {
+	t.Helper()
+	require.ErrorIs(t, err, ErrInterrupted)
+	assert.ErrorIs(t, err, context.Canceled)
+	var apiErr *apierrors.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeCanceled, apiErr.TextCode)
+	assert.Equal(t, completed, apiErr.Metadata["completed"])
+}
+
+func TestMigrations_InterruptedBetweenMigrations(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	hook := &cancelOnQuery{}
+	db.AddQueryHook(hook)
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_a.up.sql":   {Data: []byte("CREATE TABLE interrupt_a (id INTEGER PRIMARY KEY)")},
+		"20240101000000_a.down.sql": {Data: []byte("DROP TABLE interrupt_a")},
+		"20240102000000_b.up.sql":   {Data: []byte("CREATE TABLE interrupt_b (id INTEGER PRIMARY KEY)")},
+		"20240102000000_b.down.sql": {Data: []byte("DROP TABLE interrupt_b")},
+		"20240103000000_c.up.sql":   {Data: []byte("CREATE TABLE interrupt_c (id INTEGER PRIMARY KEY)")},
+		"20240103000000_c.down.sql": {Data: []byte("DROP TABLE interrupt_c")},
+	})
+
+	applied := func() []string {
+		var names []string
+		require.NoError(t, db.NewSelect().Table(migrations.TableName()).Column("name").Order("name").Scan(context.Background(), &names))
+		return names
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hook.match, hook.cancel = "CREATE TABLE interrupt_b", cancel
+	err := migrations.Migrate(ctx, db)
+	assertInterrupted(t, err, []string{"20240101000000", "20240102000000"})
+
+	outcome := migrations.LastMigrate()
+	assert.True(t, outcome.Interrupted)
+	assert.Equal(t, []string{"20240101000000", "20240102000000"}, outcome.Items)
+	assert.Equal(t, []string{"20240101000000", "20240102000000"}, applied(), "the skipped migration is not marked applied")
+
+	require.NoError(t, migrations.Migrate(context.Background(), db))
+	assert.Equal(t, []string{"20240103000000"}, migrations.LastMigrate().Items)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	hook.match, hook.cancel = "DROP TABLE interrupt_c", cancel
+	err = migrations.RollbackAll(ctx, db)
+	assertInterrupted(t, err, []string{"20240103000000"})
+
+	outcome = migrations.LastRollback()
+	assert.True(t, outcome.Interrupted)
+	assert.Equal(t, []string{"20240103000000"}, outcome.Items)
+	assert.Equal(t, []string{"20240101000000", "20240102000000"}, applied(), "the skipped group stays applied")
+
+	hook.match = "\x00"
+	require.NoError(t, migrations.RollbackAll(context.Background(), db))
+	assert.Empty(t, applied())
+
+	cancel()
+	assertInterrupted(t, migrations.Migrate(ctx, db), nil)
+	assert.Empty(t, applied())
+}
+
+func TestFixtures_InterruptedBetweenFiles(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(context.Background())
+	require.NoError(t, err)
+
+	row := func(id, name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: " + id + "\n      name: " + name + "\n")}
+	}
+	fixtures := NewSeedManager(db,
+		WithFS(fstest.MapFS{"a.yml": row("1", "a"), "b.yml": row("2", "b")}),
+		WithFS(fstest.MapFS{"c.yml": row("3", "c")}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db.AddQueryHook(&cancelOnQuery{match: "INSERT", cancel: cancel})
+
+	err = fixtures.Load(ctx)
+	assertInterrupted(t, err, []string{"a.yml"})
+
+	outcome := fixtures.LastSeed()
+	assert.True(t, outcome.Interrupted)
+	assert.Equal(t, []string{"a.yml"}, outcome.Items)
+
+	count, err := db.NewSelect().Model((*seedHistoryItem)(nil)).Count(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "the file in flight completes, the others are not loaded")
+}
@@ -0,0 +1,104 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrJobEnqueuerNil indicates RunInTxWithJobs was called without an enqueuer.
+var ErrJobEnqueuerNil = errors.New("persistence: job enqueuer is nil")
+
+// TxManager runs functions in a database transaction. Client implements
+// it, so job workers can depend on the interface instead of the client.
+type TxManager interface {
+	RunInTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error
+}
+
+// JobEnqueuer inserts jobs through the caller's transaction, so a job
+// exists only if the writes that scheduled it commit. Job frameworks on
+// database/sql are adapted with JobEnqueuerFunc, e.g. a river client
+// using the riverdatabasesql driver:
+//
+//	enqueuer := persistence.JobEnqueuerFunc(func(ctx context.Context, tx *sql.Tx, job any) error {
+//		_, err := riverClient.InsertTx(ctx, tx, job.(river.JobArgs), nil)
+//		return err
+//	})
+type JobEnqueuer interface {
+	EnqueueTx(ctx context.Context, tx *sql.Tx, job any) error
+}
+
+// JobEnqueuerFunc adapts a function to JobEnqueuer.
+type JobEnqueuerFunc func(ctx context.Context, tx *sql.Tx, job any) error
+
+// EnqueueTx implements JobEnqueuer
+func (f JobEnqueuerFunc) EnqueueTx(ctx context.Context, tx *sql.Tx, job any) error {
+	return f(ctx, tx, job)
+}
+
+type txContextKey struct{}
+
+// ContextWithTx stores tx in ctx. Client.RunInTx joins it instead of
+// starting a new transaction, which lets job workers run their handler
+// in the transaction that completes the job.
+func ContextWithTx(ctx context.Context, tx bun.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// TxFromContext returns the transaction stored with ContextWithTx.
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(bun.Tx)
+	return tx, ok
+}
+
+// IDBFromContext returns the transaction in ctx, or db without one.
+func IDBFromContext(ctx context.Context, db bun.IDB) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// RunInTx executes fn in a transaction on the client database, joining
+// the transaction in ctx if there is one. fn gets a context carrying
+// the transaction, see TxFromContext.
+func (c Client) RunInTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return RunInTx(ctx, IDBFromContext(ctx, c.db), func(ctx context.Context, tx bun.Tx) error {
+		if fn == nil {
+			return ErrTxFuncNil
+		}
+		return fn(ContextWithTx(ctx, tx), tx)
+	})
+}
+
+// SQLDB returns the database/sql handle of the default pool, for job
+// frameworks that open their own driver on it, e.g. riverdatabasesql.
+func (c Client) SQLDB() *sql.DB {
+	return c.sqlDB
+}
+
+// RunInTxWithJobs runs fn in a transaction and enqueues the jobs it
+// returns through the same transaction, committing writes and jobs
+// together (transactional enqueue).
+func RunInTxWithJobs(ctx context.Context, txm TxManager, enqueuer JobEnqueuer, fn func(ctx context.Context, tx bun.Tx) ([]any, error)) error {
+	if enqueuer == nil {
+		return ErrJobEnqueuerNil
+	}
+	if fn == nil {
+		return ErrTxFuncNil
+	}
+	return txm.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		jobs, err := fn(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if err := enqueuer.EnqueueTx(ctx, tx.Tx, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
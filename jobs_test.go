@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestRunInTxWithJobs(t *testing.T) {
+	ctx := context.Background()
+	client := newAdminTestClient(t)
+	db := client.DB()
+
+	for _, stmt := range []string{
+		"CREATE TABLE job_orders (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE job_queue (kind TEXT)",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	enqueuer := JobEnqueuerFunc(func(ctx context.Context, tx *sql.Tx, job any) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO job_queue (kind) VALUES (?)", job)
+		return err
+	})
+
+	err := RunInTxWithJobs(ctx, client, enqueuer, func(ctx context.Context, tx bun.Tx) ([]any, error) {
+		_, err := tx.ExecContext(ctx, "INSERT INTO job_orders (id) VALUES (1)")
+		return []any{"send_receipt"}, err
+	})
+	require.NoError(t, err)
+
+	boom := errors.New("boom")
+	err = RunInTxWithJobs(ctx, client, JobEnqueuerFunc(func(context.Context, *sql.Tx, any) error { return boom }), func(ctx context.Context, tx bun.Tx) ([]any, error) {
+		_, err := tx.ExecContext(ctx, "INSERT INTO job_orders (id) VALUES (2)")
+		return []any{"send_receipt"}, err
+	})
+	assert.ErrorIs(t, err, boom)
+
+	var orders, jobs int
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM job_orders").Scan(ctx, &orders))
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM job_queue").Scan(ctx, &jobs))
+	assert.Equal(t, 1, orders)
+	assert.Equal(t, 1, jobs)
+
+	assert.ErrorIs(t, RunInTxWithJobs(ctx, client, nil, nil), ErrJobEnqueuerNil)
+}
+
+func TestClientRunInTxJoinsContextTx(t *testing.T) {
+	ctx := context.Background()
+	client := newAdminTestClient(t)
+
+	_, err := client.DB().ExecContext(ctx, "CREATE TABLE job_orders (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+
+	err = client.RunInTx(ctx, func(ctx context.Context, outer bun.Tx) error {
+		_, ok := TxFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, outer, IDBFromContext(ctx, client.DB()))
+
+		return client.RunInTx(ctx, func(ctx context.Context, inner bun.Tx) error {
+			assert.Equal(t, outer, inner)
+			if _, err := inner.ExecContext(ctx, "INSERT INTO job_orders (id) VALUES (1)"); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+	})
+	assert.Error(t, err)
+
+	var orders int
+	require.NoError(t, client.DB().NewRaw("SELECT count(*) FROM job_orders").Scan(ctx, &orders))
+	assert.Zero(t, orders)
+	assert.NotNil(t, client.SQLDB())
+}
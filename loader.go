@@ -0,0 +1,200 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultLoaderWait     = 2 * time.Millisecond
+	defaultLoaderMaxBatch = 100
+)
+
+// LoaderOption configures a Loader
+type LoaderOption func(*loaderOptions)
+
+type loaderOptions struct {
+	wait     time.Duration
+	maxBatch int
+	findOpts []FindByIDsOption
+}
+
+// WithLoaderWait sets how long a batch collects IDs before querying.
+func WithLoaderWait(wait time.Duration) LoaderOption {
+	return func(o *loaderOptions) {
+		o.wait = wait
+	}
+}
+
+// WithLoaderMaxBatch flushes a batch as soon as it holds n IDs.
+func WithLoaderMaxBatch(n int) LoaderOption {
+	return func(o *loaderOptions) {
+		o.maxBatch = n
+	}
+}
+
+// WithLoaderFindOptions passes options to the underlying FindByIDs call.
+func WithLoaderFindOptions(opts ...FindByIDsOption) LoaderOption {
+	return func(o *loaderOptions) {
+		o.findOpts = append(o.findOpts, opts...)
+	}
+}
+
+// Loader coalesces concurrent Load calls into a single IN query and
+// caches the results. Loaders are meant to live for a single request,
+// see ContextWithLoader.
+type Loader[T any, ID comparable] struct {
+	db   bun.IDB
+	opts loaderOptions
+
+	mu    sync.Mutex
+	batch *loaderBatch[T, ID]
+	cache map[ID]*loaderBatch[T, ID]
+}
+
+type loaderBatch[T any, ID comparable] struct {
+	ctx     context.Context
+	ids     []ID
+	done    chan struct{}
+	flushed bool
+	rows    map[string]T
+	err     error
+}
+
+// NewLoader creates a Loader for T
+func NewLoader[T any, ID comparable](db bun.IDB, opts ...LoaderOption) *Loader[T, ID] {
+	options := loaderOptions{
+		wait:     defaultLoaderWait,
+		maxBatch: defaultLoaderMaxBatch,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	if options.maxBatch <= 0 {
+		options.maxBatch = defaultLoaderMaxBatch
+	}
+	return &Loader[T, ID]{
+		db:    db,
+		opts:  options,
+		cache: make(map[ID]*loaderBatch[T, ID]),
+	}
+}
+
+// Load returns the row with the given ID. It returns sql.ErrNoRows
+// when no row matches.
+func (l *Loader[T, ID]) Load(ctx context.Context, id ID) (T, error) {
+	var zero T
+
+	l.mu.Lock()
+	batch, ok := l.cache[id]
+	if !ok {
+		batch = l.batch
+		if batch == nil {
+			batch = &loaderBatch[T, ID]{
+				ctx:  context.WithoutCancel(ctx),
+				done: make(chan struct{}),
+			}
+			l.batch = batch
+			time.AfterFunc(l.opts.wait, func() { l.flush(batch) })
+		}
+		batch.ids = append(batch.ids, id)
+		l.cache[id] = batch
+		if len(batch.ids) >= l.opts.maxBatch {
+			go l.flush(batch)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-batch.done:
+	}
+
+	if batch.err != nil {
+		return zero, batch.err
+	}
+	row, found := batch.rows[fmt.Sprint(id)]
+	if !found {
+		return zero, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+// LoadMany loads several IDs, coalescing them in the same batch.
+func (l *Loader[T, ID]) LoadMany(ctx context.Context, ids ...ID) ([]T, []error) {
+	rows := make([]T, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows[i], errs[i] = l.Load(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return rows, errs
+}
+
+// Clear removes id from the cache so the next Load queries again.
+func (l *Loader[T, ID]) Clear(id ID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, id)
+}
+
+func (l *Loader[T, ID]) flush(batch *loaderBatch[T, ID]) {
+	l.mu.Lock()
+	if batch.flushed {
+		l.mu.Unlock()
+		return
+	}
+	batch.flushed = true
+	if l.batch == batch {
+		l.batch = nil
+	}
+	ids := append([]ID(nil), batch.ids...)
+	l.mu.Unlock()
+
+	defer close(batch.done)
+
+	rows, err := FindByIDs[T](batch.ctx, l.db, ids, l.opts.findOpts...)
+	if err != nil {
+		batch.err = err
+		l.mu.Lock()
+		for _, id := range ids {
+			if l.cache[id] == batch {
+				delete(l.cache, id)
+			}
+		}
+		l.mu.Unlock()
+		return
+	}
+
+	table := l.db.Dialect().Tables().Get(reflect.TypeOf((*T)(nil)).Elem())
+	batch.rows = indexByPK(table.PKs[0], rows)
+}
+
+type loaderContextKey struct {
+	typ reflect.Type
+}
+
+// ContextWithLoader stores loader in ctx, typically once per request.
+func ContextWithLoader[T any, ID comparable](ctx context.Context, loader *Loader[T, ID]) context.Context {
+	return context.WithValue(ctx, loaderContextKey{typ: reflect.TypeOf(loader)}, loader)
+}
+
+// LoaderFromContext returns the loader for T stored in ctx.
+func LoaderFromContext[T any, ID comparable](ctx context.Context) (*Loader[T, ID], bool) {
+	loader, ok := ctx.Value(loaderContextKey{typ: reflect.TypeOf((*Loader[T, ID])(nil))}).(*Loader[T, ID])
+	return loader, ok
+}
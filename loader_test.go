@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestLoader_CoalescesConcurrentLoads(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]findItem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}}).Exec(ctx)
+	require.NoError(t, err)
+
+	var queries int32
+	loader := NewLoader[findItem, int64](db,
+		WithLoaderWait(20*time.Millisecond),
+		WithLoaderFindOptions(WithFindQuery(func(q *bun.SelectQuery) *bun.SelectQuery {
+			atomic.AddInt32(&queries, 1)
+			return q
+		})),
+	)
+
+	ctx = ContextWithLoader(ctx, loader)
+	fromCtx, ok := LoaderFromContext[findItem, int64](ctx)
+	require.True(t, ok)
+	require.Same(t, loader, fromCtx)
+
+	rows, errs := fromCtx.LoadMany(ctx, 1, 2, 3, 42)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&queries))
+	assert.Equal(t, "a", rows[0].Name)
+	assert.Equal(t, "c", rows[2].Name)
+	assert.NoError(t, errs[1])
+	assert.ErrorIs(t, errs[3], sql.ErrNoRows)
+
+	// cached results do not hit the database again
+	item, err := loader.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "b", item.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&queries))
+
+	loader.Clear(2)
+	_, err = loader.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries))
+}
+
+func TestLoader_MaxBatchFlushesEarly(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&findItem{ID: 1, Name: "a"}).Exec(ctx)
+	require.NoError(t, err)
+
+	loader := NewLoader[findItem, int64](db, WithLoaderWait(time.Hour), WithLoaderMaxBatch(1))
+
+	item, err := loader.Load(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", item.Name)
+}
@@ -0,0 +1,446 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	defaultLockTTL          = 30 * time.Second
+	defaultLockPollInterval = 50 * time.Millisecond
+)
+
+var (
+	// ErrLockNotAcquired indicates a lock held elsewhere that could not be
+	// acquired before the wait ended.
+	ErrLockNotAcquired = errors.New("persistence: lock not acquired")
+	// ErrLockLost indicates a lock lost while fn was running, because its
+	// lease could not be renewed or its connection died.
+	ErrLockLost = errors.New("persistence: lock lost")
+)
+
+// LockRecord is a lease in the distributed_locks table, used where
+// advisory locks are not available.
+type LockRecord struct {
+	bun.BaseModel `bun:"table:distributed_locks"`
+
+	Name      string    `bun:"name,pk"`
+	Owner     string    `bun:"owner,notnull"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+}
+
+// LocksMigrationFS returns up and down migrations for the
+// distributed_locks table, named <version>_distributed_locks.
+func LocksMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "distributed_locks", (*LockRecord)(nil))
+}
+
+// LockStats are counters of lock activity since the Locks was created.
+type LockStats struct {
+	// Acquired counts locks taken.
+	Acquired int64
+	// Contended counts acquisitions that found the lock held at least once.
+	Contended int64
+	// NotAcquired counts acquisitions that gave up.
+	NotAcquired int64
+	// Lost counts locks lost while held.
+	Lost int64
+	// Errors counts database errors while locking or unlocking.
+	Errors int64
+	// WaitTime is the total time spent waiting for locks.
+	WaitTime time.Duration
+	// HeldTime is the total time locks were held.
+	HeldTime time.Duration
+}
+
+// LocksOption configures Locks
+type LocksOption func(*Locks)
+
+// WithLockTable uses the distributed_locks table on Postgres too, e.g.
+// behind a transaction pooler where session advisory locks are unsafe.
+func WithLockTable() LocksOption {
+	return func(l *Locks) {
+		l.table = true
+	}
+}
+
+// WithLockTTL sets the lease of table locks, 30 seconds by default. The
+// lease is renewed every third of it while the lock is held, so it only
+// bounds how long a crashed holder blocks others. Advisory lock
+// connections are checked at the same interval.
+func WithLockTTL(ttl time.Duration) LocksOption {
+	return func(l *Locks) {
+		if ttl > 0 {
+			l.ttl = ttl
+		}
+	}
+}
+
+// WithLockPollInterval sets how often a waiting acquisition retries,
+// 50ms by default.
+func WithLockPollInterval(interval time.Duration) LocksOption {
+	return func(l *Locks) {
+		if interval > 0 {
+			l.poll = interval
+		}
+	}
+}
+
+// LockOption configures a single WithLock call
+type LockOption func(*lockConfig)
+
+type lockConfig struct {
+	wait    bool
+	timeout time.Duration
+}
+
+// LockTry fails with ErrLockNotAcquired right away when the lock is held.
+func LockTry() LockOption {
+	return func(c *lockConfig) {
+		c.wait = false
+	}
+}
+
+// LockTimeout waits at most timeout for the lock. By default WithLock
+// waits until the context is done.
+func LockTimeout(timeout time.Duration) LockOption {
+	return func(c *lockConfig) {
+		c.wait = true
+		c.timeout = timeout
+	}
+}
+
+// Locks is a distributed mutex keyed by name. On Postgres it uses
+// session advisory locks on a dedicated connection; other dialects use
+// leases in the distributed_locks table, see LocksMigrationFS.
+type Locks struct {
+	db    *bun.DB
+	table bool
+	ttl   time.Duration
+	poll  time.Duration
+
+	mu    sync.Mutex
+	stats LockStats
+}
+
+// NewLocks creates a lock manager backed by db.
+func NewLocks(db *bun.DB, opts ...LocksOption) *Locks {
+	l := &Locks{
+		db:    db,
+		table: db.Dialect().Name() != dialect.PG,
+		ttl:   defaultLockTTL,
+		poll:  defaultLockPollInterval,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(l)
+		}
+	}
+	return l
+}
+
+// Stats returns a snapshot of the lock counters.
+func (l *Locks) Stats() LockStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// WithLock runs fn while holding the named lock and releases it when fn
+// returns. It fails with an error wrapping ErrLockNotAcquired when the
+// lock cannot be taken within the wait allowed by opts. If the lease
+// cannot be renewed or the advisory lock connection dies while fn runs,
+// the context of fn is cancelled and WithLock returns an error wrapping
+// ErrLockLost.
+func (l *Locks) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...LockOption) error {
+	cfg := lockConfig{wait: true}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+
+	waitCtx := ctx
+	if cfg.wait && cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	var lock heldLock
+	if l.table {
+		lock = &tableLock{locks: l, name: name}
+	} else {
+		lock = &advisoryLock{db: l.db, key: advisoryLockKey(name)}
+	}
+
+	start := time.Now()
+	contended := false
+	for {
+		ok, err := lock.tryLock(ctx)
+		if err != nil {
+			l.record(func(s *LockStats) { s.Errors++ })
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to acquire lock").
+				WithMetadata(map[string]any{"lock": name})
+		}
+		if ok {
+			break
+		}
+		contended = true
+		if !cfg.wait {
+			return l.notAcquired(name, start, contended)
+		}
+		select {
+		case <-waitCtx.Done():
+			return l.notAcquired(name, start, contended)
+		case <-time.After(l.poll):
+		}
+	}
+
+	acquired := time.Now()
+	l.record(func(s *LockStats) {
+		s.Acquired++
+		s.WaitTime += acquired.Sub(start)
+		if contended {
+			s.Contended++
+		}
+	})
+
+	fnCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	lock.watch(l.ttl/3, func(err error) {
+		l.record(func(s *LockStats) { s.Lost++ })
+		cancel(apierrors.Wrap(ErrLockLost, apierrors.CategoryConflict, "lock was lost while held").
+			WithMetadata(map[string]any{"lock": name, "error": err.Error()}))
+	})
+
+	fnErr := fn(fnCtx)
+
+	// release even when ctx is done, so the lock is not left behind
+	err := lock.unlock(context.WithoutCancel(ctx))
+	l.record(func(s *LockStats) {
+		s.HeldTime += time.Since(acquired)
+		if err != nil {
+			s.Errors++
+		}
+	})
+	if cause := context.Cause(fnCtx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to release lock").
+			WithMetadata(map[string]any{"lock": name})
+	}
+	return nil
+}
+
+func (l *Locks) notAcquired(name string, start time.Time, contended bool) error {
+	l.record(func(s *LockStats) {
+		s.NotAcquired++
+		s.WaitTime += time.Since(start)
+		if contended {
+			s.Contended++
+		}
+	})
+	return apierrors.Wrap(ErrLockNotAcquired, apierrors.CategoryConflict, "lock is held elsewhere").
+		WithTextCode("LOCK_NOT_ACQUIRED").
+		WithMetadata(map[string]any{"lock": name})
+}
+
+func (l *Locks) record(fn func(*LockStats)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(&l.stats)
+}
+
+type heldLock interface {
+	tryLock(ctx context.Context) (bool, error)
+	// watch checks the held lock every interval until unlock and calls
+	// lost once it can no longer be trusted.
+	watch(interval time.Duration, lost func(err error))
+	unlock(ctx context.Context) error
+}
+
+// watchLock runs check every interval until stop is called, calling
+// lost and returning on the first error.
+func watchLock(interval time.Duration, check func(ctx context.Context) error, lost func(err error)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := check(ctx); err != nil {
+					if ctx.Err() == nil {
+						lost(err)
+					}
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// advisoryLockKey maps a lock name to a Postgres advisory lock key.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// advisoryLock holds a session advisory lock on its own connection, so
+// unlock runs on the session that took the lock.
+type advisoryLock struct {
+	db   *bun.DB
+	key  int64
+	conn *bun.Conn
+	stop func()
+}
+
+func (a *advisoryLock) tryLock(ctx context.Context) (bool, error) {
+	if a.conn == nil {
+		conn, err := a.db.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		a.conn = &conn
+	}
+	var ok bool
+	if err := a.conn.NewRaw("SELECT pg_try_advisory_lock(?)", a.key).Scan(ctx, &ok); err != nil {
+		a.close()
+		return false, err
+	}
+	if !ok {
+		a.close()
+	}
+	return ok, nil
+}
+
+// watch pings the lock connection, the lock is released by the server
+// when its session ends.
+func (a *advisoryLock) watch(interval time.Duration, lost func(err error)) {
+	conn := a.conn
+	a.stop = watchLock(interval, func(ctx context.Context) error {
+		return conn.PingContext(ctx)
+	}, lost)
+}
+
+func (a *advisoryLock) unlock(ctx context.Context) error {
+	if a.stop != nil {
+		a.stop()
+	}
+	defer a.close()
+	_, err := a.conn.NewRaw("SELECT pg_advisory_unlock(?)", a.key).Exec(ctx)
+	return err
+}
+
+func (a *advisoryLock) close() {
+	if a.conn != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+}
+
+// tableLock holds a lease row in distributed_locks and renews it in the
+// background until unlocked. The lock is lost when a renewal fails or
+// finds the lease taken over.
+type tableLock struct {
+	locks *Locks
+	name  string
+	owner string
+	stop  func()
+}
+
+func (t *tableLock) tryLock(ctx context.Context) (bool, error) {
+	if t.owner == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return false, err
+		}
+		t.owner = hex.EncodeToString(buf)
+	}
+
+	db := t.locks.db
+	now := time.Now().UTC()
+	var ok bool
+	err := RunInTx(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().Model((*LockRecord)(nil)).
+			Where("name = ?", t.name).
+			Where("expires_at <= ?", now).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		insert := tx.NewInsert().Model(&LockRecord{Name: t.name, Owner: t.owner, ExpiresAt: now.Add(t.locks.ttl)})
+		if tx.Dialect().Name() == dialect.MySQL {
+			insert = insert.Ignore()
+		} else {
+			insert = insert.On("CONFLICT DO NOTHING")
+		}
+		res, err := insert.Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		ok = n > 0
+		return err
+	})
+	return ok, err
+}
+
+func (t *tableLock) watch(interval time.Duration, lost func(err error)) {
+	t.stop = watchLock(interval, t.renew, lost)
+}
+
+func (t *tableLock) renew(ctx context.Context) error {
+	res, err := t.locks.db.NewUpdate().Model((*LockRecord)(nil)).
+		Set("expires_at = ?", time.Now().UTC().Add(t.locks.ttl)).
+		Where("name = ?", t.name).
+		Where("owner = ?", t.owner).
+		Exec(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			t.locks.record(func(s *LockStats) { s.Errors++ })
+		}
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("lease was taken over")
+	}
+	return nil
+}
+
+func (t *tableLock) unlock(ctx context.Context) error {
+	if t.stop != nil {
+		t.stop()
+	}
+	_, err := t.locks.db.NewDelete().Model((*LockRecord)(nil)).
+		Where("name = ?", t.name).
+		Where("owner = ?", t.owner).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestLocks_TableSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(LocksMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+
+	locks := NewLocks(db, WithLockPollInterval(5*time.Millisecond))
+	other := NewLocks(db, WithLockPollInterval(5*time.Millisecond))
+
+	ran := false
+	err := locks.WithLock(ctx, "report", func(ctx context.Context) error {
+		ran = true
+
+		err := other.WithLock(ctx, "report", func(context.Context) error { return nil }, LockTry())
+		require.ErrorIs(t, err, ErrLockNotAcquired)
+		assert.Equal(t, "LOCK_NOT_ACQUIRED", ErrorCode(err))
+
+		err = other.WithLock(ctx, "report", func(context.Context) error { return nil }, LockTimeout(20*time.Millisecond))
+		require.ErrorIs(t, err, ErrLockNotAcquired)
+
+		return other.WithLock(ctx, "other", func(context.Context) error { return nil }, LockTry())
+	})
+	require.NoError(t, err)
+	assert.True(t, ran)
+
+	boom := errors.New("boom")
+	err = other.WithLock(ctx, "report", func(context.Context) error { return boom }, LockTry())
+	require.ErrorIs(t, err, boom)
+
+	var count int
+	require.NoError(t, db.NewSelect().Model((*LockRecord)(nil)).ColumnExpr("COUNT(*)").Scan(ctx, &count))
+	assert.Zero(t, count, "locks are released")
+
+	stats := other.Stats()
+	assert.Equal(t, int64(2), stats.Acquired)
+	assert.Equal(t, int64(2), stats.NotAcquired)
+	assert.Equal(t, int64(2), stats.Contended)
+	assert.Positive(t, stats.WaitTime)
+}
+
+func TestLocks_TableExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(LocksMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+	_, err := db.NewInsert().Model(&LockRecord{Name: "job", Owner: "crashed", ExpiresAt: time.Now().UTC().Add(-time.Minute)}).Exec(ctx)
+	require.NoError(t, err)
+
+	err = NewLocks(db).WithLock(ctx, "job", func(context.Context) error { return nil }, LockTry())
+	require.NoError(t, err)
+}
+
+func TestLocks_TableLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(LocksMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+
+	locks := NewLocks(db, WithLockTTL(30*time.Millisecond))
+	err := locks.WithLock(ctx, "job", func(ctx context.Context) error {
+		// another holder took the lease over
+		_, err := db.NewUpdate().Model((*LockRecord)(nil)).Set("owner = ?", "other").Where("name = ?", "job").Exec(ctx)
+		require.NoError(t, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("fn context was not cancelled")
+		}
+	})
+	require.ErrorIs(t, err, ErrLockLost)
+	assert.Equal(t, int64(1), locks.Stats().Lost)
+}
+
+func TestLocks_PostgresAdvisoryConnectionLost(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	key := advisoryLockKey("migrate")
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key))).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectPing().WillReturnError(errors.New("connection reset by peer"))
+	mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key))).
+		WillReturnError(errors.New("connection reset by peer"))
+
+	locks := NewLocks(db, WithLockTTL(30*time.Millisecond))
+	err = locks.WithLock(context.Background(), "migrate", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, ErrLockLost)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLocks_PostgresAdvisory(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	key := advisoryLockKey("migrate")
+	lock := regexp.QuoteMeta(fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key))
+	unlock := regexp.QuoteMeta(fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key))
+
+	mock.ExpectQuery(lock).WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+	mock.ExpectQuery(lock).WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	locks := NewLocks(db, WithLockPollInterval(time.Millisecond))
+	require.NoError(t, locks.WithLock(context.Background(), "migrate", func(context.Context) error { return nil }))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	stats := locks.Stats()
+	assert.Equal(t, int64(1), stats.Acquired)
+	assert.Equal(t, int64(1), stats.Contended)
+}
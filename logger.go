@@ -3,8 +3,13 @@ package persistence
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Logger receives a message followed by key/value pairs.
 type Logger interface {
 	Debug(format string, args ...any)
 	Info(format string, args ...any)
@@ -13,6 +18,13 @@ type Logger interface {
 	Fatal(format string, args ...any)
 }
 
+// FieldsLogger is implemented by loggers that natively
+// support structured fields. When a logger does not
+// implement it, fields are appended as key/value args.
+type FieldsLogger interface {
+	WithFields(fields map[string]any) Logger
+}
+
 var LoggerEnabled = false
 
 type defaultLogger struct {
@@ -20,31 +32,185 @@ type defaultLogger struct {
 
 func (d *defaultLogger) Debug(format string, args ...any) {
 	if LoggerEnabled {
-		fmt.Printf("[DEBUG] "+format+"\n", args...)
+		fmt.Println("[DEBUG] " + formatLogLine(format, args))
 	}
 }
 
 func (d *defaultLogger) Info(format string, args ...any) {
 	if LoggerEnabled {
-		fmt.Printf("[INFO] "+format+"\n", args...)
+		fmt.Println("[INFO] " + formatLogLine(format, args))
 	}
 }
 
 func (d *defaultLogger) Warn(format string, args ...any) {
 	if LoggerEnabled {
-		fmt.Printf("[WARN] "+format+"\n", args...)
+		fmt.Println("[WARN] " + formatLogLine(format, args))
 	}
 }
 
 func (d *defaultLogger) Error(format string, args ...any) {
 	if LoggerEnabled {
-		fmt.Printf("[ERROR] "+format+"\n", args...)
+		fmt.Println("[ERROR] " + formatLogLine(format, args))
 	}
 }
 
 func (d *defaultLogger) Fatal(format string, args ...any) {
 	if LoggerEnabled {
-		fmt.Printf("[FATAL] "+format+"\n", args...)
+		fmt.Println("[FATAL] " + formatLogLine(format, args))
 		os.Exit(1)
 	}
 }
+
+// formatLogLine renders a message followed by key/value pairs, the
+// form every logger call of this package uses. The message is never
+// treated as a printf format, so a literal % is kept as is.
+func formatLogLine(msg string, args []any) string {
+	if len(args) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+			continue
+		}
+		fmt.Fprintf(&b, " %v", args[i])
+	}
+	return b.String()
+}
+
+// WithLoggerFields returns a logger that attaches the given
+// fields to every log line.
+func WithLoggerFields(lgr Logger, fields map[string]any) Logger {
+	if lgr == nil {
+		lgr = &defaultLogger{}
+	}
+	if len(fields) == 0 {
+		return lgr
+	}
+	if fl, ok := lgr.(FieldsLogger); ok {
+		return fl.WithFields(fields)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kv := make([]any, 0, len(fields)*2)
+	for _, k := range keys {
+		kv = append(kv, k, fields[k])
+	}
+
+	if fl, ok := lgr.(*fieldsLogger); ok {
+		return &fieldsLogger{
+			next:   fl.next,
+			fields: append(append([]any(nil), fl.fields...), kv...),
+		}
+	}
+
+	return &fieldsLogger{next: lgr, fields: kv}
+}
+
+type fieldsLogger struct {
+	next   Logger
+	fields []any
+}
+
+func (l *fieldsLogger) args(args []any) []any {
+	return append(append([]any(nil), args...), l.fields...)
+}
+
+func (l *fieldsLogger) Debug(format string, args ...any) {
+	l.next.Debug(format, l.args(args)...)
+}
+
+func (l *fieldsLogger) Info(format string, args ...any) {
+	l.next.Info(format, l.args(args)...)
+}
+
+func (l *fieldsLogger) Warn(format string, args ...any) {
+	l.next.Warn(format, l.args(args)...)
+}
+
+func (l *fieldsLogger) Error(format string, args ...any) {
+	l.next.Error(format, l.args(args)...)
+}
+
+func (l *fieldsLogger) Fatal(format string, args ...any) {
+	l.next.Fatal(format, l.args(args)...)
+}
+
+// maxSampledLines bounds the memory used to track
+// identical debug lines.
+const maxSampledLines = 1024
+
+// NewSampledLogger returns a logger that emits only 1 of every
+// n identical debug lines. Other levels are never sampled.
+// Lines are considered identical when message and args match,
+// ignoring time.Duration values.
+func NewSampledLogger(lgr Logger, n int) Logger {
+	if lgr == nil {
+		lgr = &defaultLogger{}
+	}
+	if n <= 1 {
+		return lgr
+	}
+	return &sampledLogger{
+		Logger: lgr,
+		every:  uint64(n),
+		seen:   make(map[string]uint64),
+	}
+}
+
+type sampledLogger struct {
+	Logger
+	mu    sync.Mutex
+	every uint64
+	seen  map[string]uint64
+}
+
+func (l *sampledLogger) Debug(format string, args ...any) {
+	if l.sample(format, args) {
+		l.Logger.Debug(format, args...)
+	}
+}
+
+// sample reports whether this occurrence of the line should be emitted.
+func (l *sampledLogger) sample(format string, args []any) bool {
+	key := sampleKey(format, args)
+
+	l.mu.Lock()
+	if len(l.seen) >= maxSampledLines {
+		l.seen = make(map[string]uint64)
+	}
+	count := l.seen[key]
+	l.seen[key] = count + 1
+	l.mu.Unlock()
+
+	return count%l.every == 0
+}
+
+// sampleKey identifies a log line, durations are ignored so
+// timing data does not make otherwise identical lines unique.
+func sampleKey(format string, args []any) string {
+	var b strings.Builder
+	b.WriteString(format)
+	for _, arg := range args {
+		if _, ok := arg.(time.Duration); ok {
+			continue
+		}
+		fmt.Fprintf(&b, "|%v", arg)
+	}
+	return b.String()
+}
+
+func (l *sampledLogger) WithFields(fields map[string]any) Logger {
+	return &sampledLogger{
+		Logger: WithLoggerFields(l.Logger, fields),
+		every:  l.every,
+		seen:   make(map[string]uint64),
+	}
+}
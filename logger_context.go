@@ -0,0 +1,173 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	apierrors "github.com/goliatone/go-errors"
+)
+
+// ContextLogger is implemented by loggers that take the request
+// context, e.g. to correlate log lines with traces, and that log
+// go-errors categories and metadata as structured fields. Plain
+// loggers are adapted with NewContextLogger.
+type ContextLogger interface {
+	Logger
+	DebugCtx(ctx context.Context, msg string, args ...any)
+	InfoCtx(ctx context.Context, msg string, args ...any)
+	WarnCtx(ctx context.Context, msg string, args ...any)
+	ErrorCtx(ctx context.Context, msg string, args ...any)
+	ErrorErr(ctx context.Context, err error, msg string, args ...any)
+}
+
+// LogContextExtractor returns key/value pairs to attach to
+// log lines from a context, e.g. trace and span IDs.
+type LogContextExtractor func(ctx context.Context) []any
+
+var (
+	logExtractorsMu sync.RWMutex
+	logExtractors   []LogContextExtractor
+)
+
+// RegisterLogContextExtractor adds an extractor used by adapted
+// loggers to enrich every context aware log line.
+func RegisterLogContextExtractor(fn LogContextExtractor) {
+	if fn == nil {
+		return
+	}
+	logExtractorsMu.Lock()
+	defer logExtractorsMu.Unlock()
+	logExtractors = append(logExtractors, fn)
+}
+
+type logFieldsKey struct{}
+
+// ContextWithLogFields returns a context carrying key/value pairs
+// that context aware log calls attach to their line.
+func ContextWithLogFields(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(logFieldsKey{}).([]any)
+	return context.WithValue(ctx, logFieldsKey{}, append(append([]any(nil), existing...), args...))
+}
+
+// contextLogArgs returns the fields carried by ctx followed by the
+// registered extractor fields.
+func contextLogArgs(ctx context.Context) []any {
+	if ctx == nil {
+		return nil
+	}
+	args, _ := ctx.Value(logFieldsKey{}).([]any)
+	args = append([]any(nil), args...)
+
+	logExtractorsMu.RLock()
+	extractors := append([]LogContextExtractor(nil), logExtractors...)
+	logExtractorsMu.RUnlock()
+
+	for _, extract := range extractors {
+		args = append(args, extract(ctx)...)
+	}
+	return args
+}
+
+// ErrorLogFields returns err as key/value pairs. go-errors values
+// contribute their category, text code and metadata as separate fields.
+func ErrorLogFields(err error) []any {
+	if err == nil {
+		return nil
+	}
+	args := []any{"error", err.Error()}
+
+	var richErr *apierrors.Error
+	if !errors.As(err, &richErr) {
+		return args
+	}
+
+	args = append(args, "error_category", string(richErr.Category))
+	if richErr.TextCode != "" {
+		args = append(args, "error_code", richErr.TextCode)
+	}
+	if len(richErr.Metadata) > 0 {
+		args = append(args, "error_metadata", richErr.Metadata)
+	}
+	return args
+}
+
+// NewContextLogger adapts lgr to ContextLogger. Loggers that already
+// implement it are returned as is, otherwise the context fields are
+// appended to the args of the plain Logger methods.
+func NewContextLogger(lgr Logger) ContextLogger {
+	if lgr == nil {
+		lgr = &defaultLogger{}
+	}
+	if cl, ok := lgr.(ContextLogger); ok {
+		return cl
+	}
+	return &contextLogger{Logger: lgr}
+}
+
+type contextLogger struct {
+	Logger
+}
+
+func (l *contextLogger) DebugCtx(ctx context.Context, msg string, args ...any) {
+	l.Debug(msg, append(args, contextLogArgs(ctx)...)...)
+}
+
+func (l *contextLogger) InfoCtx(ctx context.Context, msg string, args ...any) {
+	l.Info(msg, append(args, contextLogArgs(ctx)...)...)
+}
+
+func (l *contextLogger) WarnCtx(ctx context.Context, msg string, args ...any) {
+	l.Warn(msg, append(args, contextLogArgs(ctx)...)...)
+}
+
+func (l *contextLogger) ErrorCtx(ctx context.Context, msg string, args ...any) {
+	l.Error(msg, append(args, contextLogArgs(ctx)...)...)
+}
+
+func (l *contextLogger) ErrorErr(ctx context.Context, err error, msg string, args ...any) {
+	args = append(args, ErrorLogFields(err)...)
+	l.Error(msg, append(args, contextLogArgs(ctx)...)...)
+}
+
+func (l *fieldsLogger) DebugCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.next).DebugCtx(ctx, msg, l.args(args)...)
+}
+
+func (l *fieldsLogger) InfoCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.next).InfoCtx(ctx, msg, l.args(args)...)
+}
+
+func (l *fieldsLogger) WarnCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.next).WarnCtx(ctx, msg, l.args(args)...)
+}
+
+func (l *fieldsLogger) ErrorCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.next).ErrorCtx(ctx, msg, l.args(args)...)
+}
+
+func (l *fieldsLogger) ErrorErr(ctx context.Context, err error, msg string, args ...any) {
+	NewContextLogger(l.next).ErrorErr(ctx, err, msg, l.args(args)...)
+}
+
+func (l *sampledLogger) DebugCtx(ctx context.Context, msg string, args ...any) {
+	if l.sample(msg, args) {
+		NewContextLogger(l.Logger).DebugCtx(ctx, msg, args...)
+	}
+}
+
+func (l *sampledLogger) InfoCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.Logger).InfoCtx(ctx, msg, args...)
+}
+
+func (l *sampledLogger) WarnCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.Logger).WarnCtx(ctx, msg, args...)
+}
+
+func (l *sampledLogger) ErrorCtx(ctx context.Context, msg string, args ...any) {
+	NewContextLogger(l.Logger).ErrorCtx(ctx, msg, args...)
+}
+
+func (l *sampledLogger) ErrorErr(ctx context.Context, err error, msg string, args ...any) {
+	NewContextLogger(l.Logger).ErrorErr(ctx, err, msg, args...)
+}
@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type traceKey struct{}
+
+func TestContextLogger_AdaptsPlainLogger(t *testing.T) {
+	RegisterLogContextExtractor(func(ctx context.Context) []any {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			return []any{"trace_id", id}
+		}
+		return nil
+	})
+
+	rec := &recordingLogger{}
+	lgr := NewContextLogger(WithLoggerFields(rec, map[string]any{"component": "query"}))
+
+	ctx := ContextWithLogFields(context.Background(), "request_id", "r1")
+	ctx = context.WithValue(ctx, traceKey{}, "t1")
+	lgr.InfoCtx(ctx, "running", "step", 1)
+
+	require.Len(t, rec.Lines(), 1)
+	assert.Equal(t, "INFO running step=1 component=query request_id=r1 trace_id=t1", rec.Lines()[0])
+}
+
+func TestContextLogger_ErrorErr(t *testing.T) {
+	rec := &recordingLogger{}
+	lgr := NewContextLogger(rec)
+
+	err := apierrors.New("boom", apierrors.CategoryOperation).
+		WithTextCode("MIGRATION_FAILED").
+		WithMetadata(map[string]any{"table": "users"})
+	lgr.ErrorErr(context.Background(), err, "migrate")
+
+	require.Len(t, rec.Lines(), 1)
+	line := rec.Lines()[0]
+	assert.Contains(t, line, "error_category=operation")
+	assert.Contains(t, line, "error_code=MIGRATION_FAILED")
+	assert.Contains(t, line, "error_metadata=map[table:users]")
+
+	assert.Equal(t, []any{"error", "plain"}, ErrorLogFields(errors.New("plain")))
+	assert.Nil(t, ErrorLogFields(nil))
+}
+
+func TestContextLogger_SampledDebug(t *testing.T) {
+	rec := &recordingLogger{}
+	lgr := NewContextLogger(NewSampledLogger(rec, 2))
+
+	for range 4 {
+		lgr.DebugCtx(context.Background(), "query executed")
+	}
+	assert.Len(t, rec.Lines(), 2)
+}
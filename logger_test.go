@@ -0,0 +1,134 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+formatLogLine(format, args))
+}
+
+func (l *recordingLogger) Debug(format string, args ...any) { l.record("DEBUG", format, args...) }
+func (l *recordingLogger) Info(format string, args ...any)  { l.record("INFO", format, args...) }
+func (l *recordingLogger) Warn(format string, args ...any)  { l.record("WARN", format, args...) }
+func (l *recordingLogger) Error(format string, args ...any) { l.record("ERROR", format, args...) }
+func (l *recordingLogger) Fatal(format string, args ...any) { l.record("FATAL", format, args...) }
+
+func (l *recordingLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestFormatLogLine(t *testing.T) {
+	assert.Equal(t, "plain", formatLogLine("plain", nil))
+	assert.Equal(t, "100% done", formatLogLine("100% done", nil))
+	assert.Equal(t, "100% done table=users", formatLogLine("100% done", []any{"table", "users"}))
+	assert.Equal(t, "value %d n=42", formatLogLine("value %d", []any{"n", 42}))
+	assert.Equal(t, "loading file=a.yml", formatLogLine("loading", []any{"file", "a.yml"}))
+	assert.Equal(t, "odd key=v dangling", formatLogLine("odd", []any{"key", "v", "dangling"}))
+}
+
+func TestWithLoggerFields(t *testing.T) {
+	rec := &recordingLogger{}
+	lgr := WithLoggerFields(rec, map[string]any{"component": "migrations", "dialect": "pg"})
+	lgr = WithLoggerFields(lgr, map[string]any{"db": "app"})
+
+	lgr.Info("running", "step", 1)
+
+	assert.Equal(t, []string{"INFO running step=1 component=migrations dialect=pg db=app"}, rec.Lines())
+}
+
+func TestSampledLogger(t *testing.T) {
+	rec := &recordingLogger{}
+	lgr := NewSampledLogger(rec, 3)
+
+	for i := 0; i < 7; i++ {
+		lgr.Debug("query executed", "duration", time.Duration(i))
+	}
+	lgr.Debug("other line")
+	lgr.Info("not sampled")
+	lgr.Info("not sampled")
+
+	lines := rec.Lines()
+	assert.Len(t, lines, 6)
+	assert.Equal(t, "DEBUG other line", lines[3])
+}
+
+func TestClient_QueryLoggingWithFields(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	client, mock, cleanup := newTestClient(t, cfg,
+		WithQueryLogging(),
+		WithLogSampling(2),
+		WithLogFields(map[string]any{"db": "app"}),
+	)
+	defer cleanup()
+
+	rec := &recordingLogger{}
+	client.SetLogger(rec)
+
+	for i := 0; i < 4; i++ {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+		var out int
+		require.NoError(t, client.DB().NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out))
+	}
+
+	lines := rec.Lines()
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Contains(t, line, "query executed")
+		assert.Contains(t, line, "component=query")
+		assert.Contains(t, line, "db=app")
+		assert.Contains(t, line, fmt.Sprintf("dialect=%s", client.DB().Dialect().Name()))
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClient_SetLoggerDuringQueries(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	client, mock, cleanup := newTestClient(t, cfg, WithQueryLogging())
+	defer cleanup()
+
+	db := client.DB()
+	const queries = 20
+	for range queries {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range queries {
+			client.SetLogger(&recordingLogger{})
+		}
+	}()
+
+	for range queries {
+		var out int
+		require.NoError(t, db.NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out))
+	}
+	<-done
+
+	rec := &recordingLogger{}
+	client.SetLogger(rec)
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+	var out int
+	require.NoError(t, client.DB().NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out))
+	require.Len(t, rec.Lines(), 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
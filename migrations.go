@@ -3,16 +3,28 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	apierrors "github.com/goliatone/go-errors"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/migrate"
 )
 
+var (
+	// ErrNothingToMigrate is returned by Migrate when every registered
+	// migration is already applied and SetNoopErrors is enabled.
+	ErrNothingToMigrate = errors.New("persistence: no new migrations to run")
+	// ErrNothingToRollback is returned by Rollback and RollbackAll when
+	// no migration group is applied and SetNoopErrors is enabled.
+	ErrNothingToRollback = errors.New("persistence: no migrations to roll back")
+)
+
 // DriverConfig remains the same
 type DriverConfig interface {
 	Connect(options ...bun.DBOption) (*bun.DB, *sql.DB, error)
@@ -27,8 +39,18 @@ type Migrations struct {
 	dialectRegistrations []dialectRegistration
 	orderedRegistrations []orderedSourceRegistration
 	orderedMetadata      map[string]OrderedMigrationMetadata
+	sources              map[string]migrationSource
+	historyEnabled       bool
+	outOfOrderPolicy     OutOfOrderPolicy
+	namespace            string
+	noopErrors           bool
+	lastMigrate          *OperationOutcome
+	lastRollback         *OperationOutcome
+	namespaces           []migrationNamespace
 	migrations           *migrate.MigrationGroup
 	lgr                  Logger
+	discoveryGeneration  uint64
+	discovery            *migrationDiscovery
 }
 
 func NewMigrations() *Migrations {
@@ -43,8 +65,12 @@ func NewMigrations() *Migrations {
 }
 
 func (m *Migrations) SetLogger(logger Logger) {
-	if logger != nil {
-		m.lgr = logger
+	if logger == nil {
+		return
+	}
+	m.lgr = logger
+	for _, ns := range m.namespaceMigrations() {
+		ns.migrations.SetLogger(WithLoggerFields(logger, map[string]any{"namespace": ns.name}))
 	}
 }
 
@@ -55,6 +81,26 @@ func (m *Migrations) logger() Logger {
 	return m.lgr
 }
 
+// SetNoopErrors makes Migrate, Rollback and RollbackAll return
+// ErrNothingToMigrate and ErrNothingToRollback instead of nil when
+// there is nothing to do.
+func (m *Migrations) SetNoopErrors(enabled bool) *Migrations {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.noopErrors = enabled
+	return m
+}
+
+// noop returns sentinel when noop errors are enabled.
+func (m *Migrations) noop(sentinel error) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.noopErrors {
+		return sentinel
+	}
+	return nil
+}
+
 // TODO: We need to make sure we run down migrations in the reverse order that
 // were up.run
 
@@ -66,56 +112,43 @@ func (m *Migrations) initSQLMigrations(ctx context.Context, db *bun.DB) (*migrat
 	files := append([]fs.FS(nil), m.Files...)
 	dialectRegistrations := append([]dialectRegistration(nil), m.dialectRegistrations...)
 	orderedRegistrations := append([]orderedSourceRegistration(nil), m.orderedRegistrations...)
+	historyEnabled := m.historyEnabled
 	m.mx.Unlock()
 
 	if len(files) == 0 && len(dialectRegistrations) == 0 && len(orderedRegistrations) == 0 {
 		return nil, nil // Nothing to do
 	}
 
-	migrations := migrate.NewMigrations()
+	units := make([]discoveryUnit, 0, len(files)+len(dialectRegistrations)+len(orderedRegistrations))
 	for i, migrationFS := range files {
-		if err := migrations.Discover(migrationFS); err != nil {
-			return nil, apierrors.Wrap(err,
-				apierrors.CategoryInternal,
-				"failed to discover filesystem migrations",
-			).WithMetadata(map[string]any{"index": i})
-		}
+		units = append(units, discoveryUnit{kind: discoverySQL, index: i, fsys: migrationFS})
 	}
-
-	for i, registration := range dialectRegistrations {
-		buildResult, err := registration.buildFileSystems(ctx, db)
-		if err != nil {
-			return nil, apierrors.Wrap(err,
-				apierrors.CategoryInternal,
-				"failed to prepare dialect-specific migrations",
-			).WithMetadata(map[string]any{"index": i})
-		}
-		for j, migrationFS := range buildResult.fileSystems {
-			if err := migrations.Discover(migrationFS); err != nil {
-				return nil, apierrors.Wrap(err,
-					apierrors.CategoryInternal,
-					"failed to discover dialect filesystem migrations",
-				).WithMetadata(map[string]any{"index": j, "dialect_registration": i})
-			}
-		}
+	for i := range dialectRegistrations {
+		units = append(units, discoveryUnit{kind: discoveryDialect, index: i, dialect: &dialectRegistrations[i]})
+	}
+	for i := range orderedRegistrations {
+		units = append(units, discoveryUnit{kind: discoveryOrdered, index: i, ordered: &orderedRegistrations[i]})
 	}
 
-	orderedMigrations, orderedMetadata, err := buildOrderedMigrations(ctx, db, orderedRegistrations)
+	sets, err := m.discoverUnits(ctx, db, units)
 	if err != nil {
 		return nil, err
 	}
-	for _, migration := range orderedMigrations {
-		migrations.Add(migration)
-	}
+	migrations, sources, orderedMetadata := mergeDiscoveredSets(sets)
 
 	m.mx.Lock()
 	m.orderedMetadata = orderedMetadata
+	m.sources = sources
 	m.mx.Unlock()
 
 	if len(migrations.Sorted()) == 0 {
 		return nil, nil
 	}
 
+	if historyEnabled {
+		return m.withHistory(ctx, db, migrations, sources)
+	}
+
 	return migrations, nil
 }
 
@@ -123,6 +156,7 @@ func (m *Migrations) initSQLMigrations(ctx context.Context, db *bun.DB) (*migrat
 func (m *Migrations) RegisterSQLMigrations(migrations ...fs.FS) *Migrations {
 	m.mx.Lock()
 	m.Files = append(m.Files, migrations...)
+	m.invalidateDiscovery()
 	m.mx.Unlock()
 	return m
 }
@@ -146,6 +180,7 @@ func (m *Migrations) RegisterDialectMigrations(root fs.FS, opts ...DialectMigrat
 		root: root,
 		opts: config,
 	})
+	m.invalidateDiscovery()
 	m.mx.Unlock()
 
 	return m
@@ -155,6 +190,7 @@ func (m *Migrations) RegisterDialectMigrations(root fs.FS, opts ...DialectMigrat
 func (m *Migrations) RegisterOrderedMigrationSources(sources ...OrderedMigrationSource) error {
 	m.mx.Lock()
 	defer m.mx.Unlock()
+	defer m.invalidateDiscovery()
 
 	seen := make(map[string]struct{}, len(m.orderedRegistrations)+len(sources))
 	for _, existing := range m.orderedRegistrations {
@@ -218,65 +254,153 @@ func (m *Migrations) ValidateDialects(ctx context.Context, db *bun.DB) error {
 	return nil
 }
 
-// run is a helper to execute migrations for a given collection
+// run is a helper to execute migrations for a given collection.
+// It returns ErrNothingToMigrate with the empty group when every
+// migration is already applied. When ctx is done between migrations
+// it returns the group applied so far with an ErrInterrupted error.
 func (m *Migrations) run(ctx context.Context, db *bun.DB, migrations *migrate.Migrations) (*migrate.MigrationGroup, error) {
-	migrator := migrate.NewMigrator(db, migrations)
+	if ctx.Err() != nil {
+		return nil, interruptedError(ctx, OperationMigrate, nil)
+	}
+
+	interrupts := &migrationInterrupts{ctx: ctx}
+	migrator := m.newMigrator(db, interrupts.wrap(migrations))
 	if err := migrator.Init(ctx); err != nil {
 		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator")
 	}
 
-	group, err := migrator.Migrate(ctx)
-	if err != nil {
-		if strings.Contains(err.Error(), "no new migrations") {
-			return nil, nil // not an error, just nothing to do
+	if err := m.checkOutOfOrder(ctx, migrator); err != nil {
+		return nil, err
+	}
+
+	group, err := migrator.Migrate(context.WithoutCancel(ctx))
+	if interrupts.stopped != nil {
+		group.Migrations = group.Migrations[:len(group.Migrations)-1]
+		if err := interrupts.restore(migrator, true); err != nil {
+			return group, err
 		}
+		names := migrationNames(group.Migrations)
+		m.logger().Debug("migrations: interrupted", "applied", names, "next", interrupts.stopped.Name)
+		return group, interruptedError(ctx, OperationMigrate, names)
+	}
+	if err != nil {
 		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to run migrations")
 	}
 
 	if group.IsZero() {
 		m.logger().Debug("migrations: no new migrations were applied in this group")
-	} else {
-		m.logger().Debug("migrations: successfully applied migration group", "group", group.String())
-		m.logOrderedGroup(group.Migrations)
+		return group, ErrNothingToMigrate
 	}
 
+	m.logger().Debug("migrations: successfully applied migration group", "group", group.String())
+	m.logOrderedGroup(group.Migrations)
 	return group, nil
 }
 
 // Migrate runs SQL file-based migrations discovered from registered filesystems.
+// Errors other than dialect validation errors are enriched, see EnrichError.
+// When nothing was applied it returns nil, or ErrNothingToMigrate if
+// SetNoopErrors is enabled. When ctx is done it stops before the next
+// migration, letting the one in flight complete, and returns an
+// ErrInterrupted error; LastMigrate lists the migrations applied.
 func (m *Migrations) Migrate(ctx context.Context, db *bun.DB) error {
+	start := time.Now()
+	applied, err := m.migrate(ctx, db)
+
+	outcome := newOperationOutcome(OperationMigrate, start, err)
+	if applied && (err == nil || outcome.Interrupted) {
+		outcome.Group = m.Report()
+		if outcome.Group != nil {
+			outcome.Items = migrationNames(outcome.Group.Migrations)
+		}
+	}
+	m.recordOutcome(outcome)
+
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return m.noop(ErrNothingToMigrate)
+	}
+	return nil
+}
+
+// migrate runs the migrations and their namespaces and
+// reports whether any migration was applied.
+func (m *Migrations) migrate(ctx context.Context, db *bun.DB) (applied bool, err error) {
 	// Only run SQL migrations if that's all you have
 	m.logger().Debug("migrations: running SQL file-based migrations...")
 
+	if ctx.Err() != nil {
+		return false, interruptedError(ctx, OperationMigrate, nil)
+	}
+
 	if m.shouldValidateDialectsOnMigrate() {
 		if err := m.ValidateDialects(ctx, db); err != nil {
-			return err
+			return false, err
 		}
 	}
 
+	start := time.Now()
+	defer func() {
+		err = EnrichError(err, OperationInfo{Operation: "migrate", Table: m.TableName(), Dialect: dialectName(db), Start: start, Code: ErrorCodeMigrationFailed})
+	}()
+
 	sqlMigrations, err := m.initSQLMigrations(ctx, db)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if sqlMigrations != nil && len(sqlMigrations.Sorted()) > 0 {
 		sqlMigrationsGroup, err := m.run(ctx, db, sqlMigrations)
-		if err != nil {
-			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to run SQL migrations")
+		if errors.Is(err, ErrInterrupted) {
+			if sqlMigrationsGroup != nil && len(sqlMigrationsGroup.Migrations) > 0 {
+				m.migrations = sqlMigrationsGroup
+				applied = true
+			}
+			return applied, err
+		}
+		if err != nil && !errors.Is(err, ErrNothingToMigrate) {
+			return false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to run SQL migrations")
 		}
 		m.migrations = sqlMigrationsGroup
+		applied = err == nil
 	} else {
 		m.logger().Debug("migrations: no SQL migrations found")
 	}
 
+	namespacesApplied, err := m.migrateNamespaces(ctx, db)
+	if err != nil {
+		return applied, err
+	}
+
 	m.logger().Debug("migrations: all migration groups completed")
-	return nil
+	return applied || namespacesApplied, nil
 }
 
 // Rollback will only roll back the most recent migration,
 // which will be from the SQL set if it exists, otherwise from the Go set.
+// When there is nothing to roll back it returns nil, or
+// ErrNothingToRollback if SetNoopErrors is enabled.
 // TODO: more robust implementation which requires more complex logic
-func (m *Migrations) Rollback(ctx context.Context, db *bun.DB, opts ...migrate.MigrationOption) error {
+func (m *Migrations) Rollback(ctx context.Context, db *bun.DB, opts ...migrate.MigrationOption) (err error) {
+	start := time.Now()
+	var rolledBack *migrate.MigrationGroup
+	defer func() {
+		if !errors.Is(err, ErrNothingToRollback) {
+			err = EnrichError(err, OperationInfo{Operation: "rollback", Table: m.TableName(), Dialect: dialectName(db), Start: start, Code: ErrorCodeRollbackFailed})
+		}
+		outcome := newOperationOutcome(OperationRollback, start, err)
+		if errors.Is(err, ErrNothingToRollback) {
+			outcome.Err = nil
+		}
+		if rolledBack != nil {
+			outcome.Group = rolledBack
+			outcome.Items = rolledBackNames(rolledBack.Migrations)
+		}
+		m.recordOutcome(outcome)
+	}()
+
 	sqlMigrations, err := m.initSQLMigrations(ctx, db)
 	if err != nil {
 		return err
@@ -285,69 +409,123 @@ func (m *Migrations) Rollback(ctx context.Context, db *bun.DB, opts ...migrate.M
 	if sqlMigrations == nil {
 		//no migrations registered so nothing to rollback
 		m.logger().Debug("migrations: no migrations registered to roll back")
-		return nil
+		return m.noop(ErrNothingToRollback)
 	}
 
-	migrator := migrate.NewMigrator(db, sqlMigrations)
+	migrator := m.newMigrator(db, sqlMigrations)
 	if err := migrator.Init(ctx); err != nil {
 		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator for rollback")
 	}
 
 	group, err := migrator.Rollback(ctx, opts...)
 	if err != nil {
-		if strings.Contains(err.Error(), "no migrations to roll back") {
-			m.logger().Debug("migrations: no migrations to roll back")
-			return nil
-		}
 		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to rollback migrations")
 	}
 
 	m.migrations = group
-	if group != nil && !group.IsZero() {
-		m.logger().Debug("migrations: successfully rolled back migration group", "group", group.String())
-		m.logOrderedGroup(group.Migrations)
+	if len(group.Migrations) == 0 {
+		m.logger().Debug("migrations: no migrations to roll back")
+		return m.noop(ErrNothingToRollback)
 	}
 
+	rolledBack = group
+	m.logger().Debug("migrations: successfully rolled back migration group", "group", group.String())
+	m.logOrderedGroup(group.Migrations)
 	return nil
 }
 
-// RollbackAll rollbacks every registered migration group.
+// RollbackAll rollbacks every registered migration group,
+// namespaces first in reverse creation order. When there is nothing
+// to roll back it returns nil, or ErrNothingToRollback if
+// SetNoopErrors is enabled. Like Migrate it stops between migrations
+// when ctx is done, LastRollback then lists the migrations rolled back.
 func (m *Migrations) RollbackAll(ctx context.Context, db *bun.DB, opts ...migrate.MigrationOption) error {
-	sqlMigrations, err := m.initSQLMigrations(ctx, db)
+	start := time.Now()
+	rolledBack, err := m.rollbackAll(ctx, db, opts...)
+
+	outcome := newOperationOutcome(OperationRollbackAll, start, err)
+	outcome.Items = rolledBack
+	if err == nil {
+		outcome.Group = m.Report()
+	}
+	m.recordOutcome(outcome)
+
 	if err != nil {
 		return err
 	}
+	if len(rolledBack) == 0 {
+		return m.noop(ErrNothingToRollback)
+	}
+	return nil
+}
+
+// rollbackAll rolls back the migrations and their namespaces
+// and returns the names of the rolled back migrations.
+func (m *Migrations) rollbackAll(ctx context.Context, db *bun.DB, opts ...migrate.MigrationOption) (rolledBack []string, err error) {
+	start := time.Now()
+	defer func() {
+		err = EnrichError(err, OperationInfo{Operation: "rollback_all", Table: m.TableName(), Dialect: dialectName(db), Start: start, Code: ErrorCodeRollbackFailed})
+	}()
+
+	if ctx.Err() != nil {
+		return nil, interruptedError(ctx, OperationRollbackAll, nil)
+	}
+
+	rolledBack, err = m.rollbackAllNamespaces(ctx, db, opts...)
+	if err != nil {
+		return rolledBack, err
+	}
+
+	sqlMigrations, err := m.initSQLMigrations(ctx, db)
+	if err != nil {
+		return rolledBack, err
+	}
 
 	if sqlMigrations == nil {
 		//no migrations registered so nothing to rollback
 		m.logger().Debug("migrations: no migrations registered to roll back")
-		return nil
+		return rolledBack, nil
 	}
 
-	migrator := migrate.NewMigrator(db, sqlMigrations)
+	interrupts := &migrationInterrupts{ctx: ctx}
+	migrator := m.newMigrator(db, interrupts.wrap(sqlMigrations))
 	if err := migrator.Init(ctx); err != nil {
-		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator for rollback")
+		return rolledBack, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator for rollback")
 	}
 
 	var lastGroup *migrate.MigrationGroup
 	for {
-		group, err := migrator.Rollback(ctx, opts...)
-		if err != nil {
-			if strings.Contains(err.Error(), "no migrations to roll back") {
-				break
+		if ctx.Err() != nil {
+			m.migrations = lastGroup
+			return rolledBack, interruptedError(ctx, OperationRollbackAll, rolledBack)
+		}
+		group, err := migrator.Rollback(context.WithoutCancel(ctx), opts...)
+		if interrupts.stopped != nil {
+			// the group is rolled back from its last migration
+			stopped := slices.IndexFunc(group.Migrations, func(migration migrate.Migration) bool {
+				return migration.Name == interrupts.stopped.Name
+			})
+			rolledBack = append(rolledBack, rolledBackNames(group.Migrations[stopped+1:])...)
+			if err := interrupts.restore(migrator, false); err != nil {
+				return rolledBack, err
 			}
-			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to rollback all migrations")
+			m.logger().Debug("migrations: rollback interrupted", "rolled_back", rolledBack, "next", interrupts.stopped.Name)
+			return rolledBack, interruptedError(ctx, OperationRollbackAll, rolledBack)
+		}
+		if err != nil {
+			return rolledBack, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to rollback all migrations")
 		}
 		if len(group.Migrations) == 0 {
 			break
 		}
 		lastGroup = group
+		rolledBack = append(rolledBack, rolledBackNames(group.Migrations)...)
 		m.logger().Debug("migrations: rolled back group", "group", group.String())
 		m.logOrderedGroup(group.Migrations)
 	}
 
 	m.migrations = lastGroup
-	return nil
+	return rolledBack, nil
 }
 
 // Report returns the status of the last migration group.
@@ -0,0 +1,276 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"sync"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+type discoveryKind uint8
+
+const (
+	discoverySQL discoveryKind = iota
+	discoveryDialect
+	discoveryOrdered
+)
+
+// discoveryKey identifies a registration discovered for a dialect.
+type discoveryKey struct {
+	kind    discoveryKind
+	index   int
+	dialect string
+}
+
+// discoveredSet is the result of discovering a single registration.
+// It is shared by every call and must not be modified.
+type discoveredSet struct {
+	migrations migrate.MigrationSlice
+	// ordered migrations are added as is, the others are merged by name
+	// like migrate.Migrations.Discover does across filesystems.
+	ordered  bool
+	sources  map[string]migrationSource
+	metadata map[string]OrderedMigrationMetadata
+}
+
+// discoveryEntry discovers a registration once, concurrent callers
+// wait for the first one. stamp is the listing of the filesystem it
+// was discovered from, see listingStamp.
+type discoveryEntry struct {
+	stamp uint64
+	once  sync.Once
+	set   *discoveredSet
+	err   error
+}
+
+// migrationDiscovery caches the discovered registrations. It is
+// replaced whenever a migration source is registered.
+type migrationDiscovery struct {
+	generation uint64
+	files      int
+	entries    map[discoveryKey]*discoveryEntry
+}
+
+// discoveryUnit is one registration to discover.
+type discoveryUnit struct {
+	kind    discoveryKind
+	index   int
+	fsys    fs.FS
+	dialect *dialectRegistration
+	ordered *orderedSourceRegistration
+}
+
+// invalidateDiscovery drops the discovery cache, callers must hold m.mx.
+func (m *Migrations) invalidateDiscovery() {
+	m.discoveryGeneration++
+	m.discovery = nil
+}
+
+// discoveryEntry returns the cache entry of key for a filesystem with
+// the given listing stamp, callers must hold m.mx.
+func (m *Migrations) discoveryEntry(key discoveryKey, stamp uint64) *discoveryEntry {
+	// Files is exported, count it so direct appends are picked up too
+	if m.discovery == nil || m.discovery.generation != m.discoveryGeneration || m.discovery.files != len(m.Files) {
+		m.discovery = &migrationDiscovery{
+			generation: m.discoveryGeneration,
+			files:      len(m.Files),
+			entries:    make(map[discoveryKey]*discoveryEntry),
+		}
+	}
+	entry, ok := m.discovery.entries[key]
+	if !ok || entry.stamp != stamp {
+		entry = &discoveryEntry{stamp: stamp}
+		m.discovery.entries[key] = entry
+	}
+	return entry
+}
+
+// forgetDiscovery drops a failed entry so the next call retries it.
+func (m *Migrations) forgetDiscovery(key discoveryKey, entry *discoveryEntry) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.discovery != nil && m.discovery.entries[key] == entry {
+		delete(m.discovery.entries, key)
+	}
+}
+
+// discoverUnits discovers every unit concurrently, reusing the cached
+// sets, and returns them in registration order.
+func (m *Migrations) discoverUnits(ctx context.Context, db *bun.DB, units []discoveryUnit) ([]*discoveredSet, error) {
+	sets := make([]*discoveredSet, len(units))
+	errs := make([]error, len(units))
+
+	var wg sync.WaitGroup
+	for i, unit := range units {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sets[i], errs[i] = m.discoverUnit(ctx, db, unit)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+func (m *Migrations) discoverUnit(ctx context.Context, db *bun.DB, unit discoveryUnit) (*discoveredSet, error) {
+	key := discoveryKey{kind: unit.kind, index: unit.index}
+	root := unit.fsys
+	registration := unit.dialect
+	if unit.ordered != nil {
+		registration = &unit.ordered.registration
+	}
+	// resolvers may depend on db, so the dialect is resolved on every call
+	if registration != nil {
+		dialect, err := registration.resolveDialect(ctx, db)
+		if err != nil {
+			return nil, unit.wrapBuildError(err)
+		}
+		key.dialect = dialect
+		root = registration.root
+	}
+
+	// walking the listing is cheap next to reading and hashing every
+	// file, and catches filesystems changed since, e.g. os.DirFS
+	stamp, err := listingStamp(root)
+	if err != nil {
+		return unit.discover(key.dialect)
+	}
+
+	m.mx.Lock()
+	entry := m.discoveryEntry(key, stamp)
+	m.mx.Unlock()
+
+	entry.once.Do(func() {
+		entry.set, entry.err = unit.discover(key.dialect)
+	})
+	if entry.err != nil {
+		m.forgetDiscovery(key, entry)
+	}
+	return entry.set, entry.err
+}
+
+func (u discoveryUnit) discover(dialect string) (*discoveredSet, error) {
+	switch u.kind {
+	case discoveryDialect:
+		buildResult, err := u.dialect.buildForDialect(dialect)
+		if err != nil {
+			return nil, u.wrapBuildError(err)
+		}
+		return discoverFileSystems(buildResult.fileSystems, u.dialect.opts.sourceLabel, func(err error, j int, message string) error {
+			return apierrors.Wrap(err, apierrors.CategoryInternal, message+" dialect filesystem migrations").
+				WithMetadata(map[string]any{"index": j, "dialect_registration": u.index})
+		})
+	case discoveryOrdered:
+		buildResult, err := u.ordered.registration.buildForDialect(dialect)
+		if err != nil {
+			return nil, u.wrapBuildError(err)
+		}
+		return buildOrderedSource(u.index, *u.ordered, buildResult)
+	default:
+		return discoverFileSystems([]fs.FS{u.fsys}, "sql", func(err error, _ int, message string) error {
+			return apierrors.Wrap(err, apierrors.CategoryInternal, message+" filesystem migrations").
+				WithMetadata(map[string]any{"index": u.index})
+		})
+	}
+}
+
+func (u discoveryUnit) wrapBuildError(err error) error {
+	if u.kind == discoveryOrdered {
+		return apierrors.Wrap(err, apierrors.CategoryInternal, "failed to prepare ordered source dialect migrations").
+			WithMetadata(map[string]any{"source_index": u.index, "source_name": u.ordered.name})
+	}
+	return apierrors.Wrap(err, apierrors.CategoryInternal, "failed to prepare dialect-specific migrations").
+		WithMetadata(map[string]any{"index": u.index})
+}
+
+// discoverFileSystems discovers the migrations of fileSystems in order,
+// wrap builds the error of the failed step.
+func discoverFileSystems(fileSystems []fs.FS, label string, wrap func(err error, index int, message string) error) (*discoveredSet, error) {
+	migrations := migrate.NewMigrations()
+	sources := make(map[string]migrationSource)
+	for j, migrationFS := range fileSystems {
+		if err := migrations.Discover(migrationFS); err != nil {
+			return nil, wrap(err, j, "failed to discover")
+		}
+		if err := collectMigrationSources(sources, migrationFS, label); err != nil {
+			return nil, wrap(err, j, "failed to read")
+		}
+	}
+	return &discoveredSet{migrations: migrations.Sorted(), sources: sources}, nil
+}
+
+// mergeDiscoveredSets builds the migrations of sets, merging the
+// migrations found in several filesystems by name.
+func mergeDiscoveredSets(sets []*discoveredSet) (*migrate.Migrations, map[string]migrationSource, map[string]OrderedMigrationMetadata) {
+	var merged migrate.MigrationSlice
+	byName := make(map[string]int)
+	var ordered migrate.MigrationSlice
+	sources := make(map[string]migrationSource)
+	metadata := make(map[string]OrderedMigrationMetadata)
+
+	for _, set := range sets {
+		for name, source := range set.sources {
+			sources[name] = source
+		}
+		for name, meta := range set.metadata {
+			metadata[name] = meta
+		}
+		if set.ordered {
+			ordered = append(ordered, set.migrations...)
+			continue
+		}
+		for _, migration := range set.migrations {
+			i, ok := byName[migration.Name]
+			if !ok {
+				byName[migration.Name] = len(merged)
+				merged = append(merged, migration)
+				continue
+			}
+			merged[i].Comment = migration.Comment
+			if migration.Up != nil {
+				merged[i].Up = migration.Up
+			}
+			if migration.Down != nil {
+				merged[i].Down = migration.Down
+			}
+		}
+	}
+
+	migrations := migrate.NewMigrations()
+	for _, migration := range append(merged, ordered...) {
+		migrations.Add(migration)
+	}
+	return migrations, sources, metadata
+}
+
+// listingStamp hashes the paths, sizes and modification times of the
+// files of fsys.
+func listingStamp(fsys fs.FS) (uint64, error) {
+	h := fnv.New64a()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
@@ -0,0 +1,105 @@
+package persistence
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readCountingFS counts the SQL files opened.
+type readCountingFS struct {
+	fs.FS
+	reads atomic.Int64
+}
+
+func (f *readCountingFS) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, ".sql") {
+		f.reads.Add(1)
+	}
+	return f.FS.Open(name)
+}
+
+func TestInitSQLMigrations_CachesDiscovery(t *testing.T) {
+	ctx := context.Background()
+	plain := &readCountingFS{FS: fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE t1 (id INTEGER)")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t1")},
+	}}
+	dialect := &readCountingFS{FS: fstest.MapFS{
+		"common/0002_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER)")},
+		"common/0002_users.down.sql": {Data: []byte("DROP TABLE users")},
+	}}
+
+	m := NewMigrations()
+	m.RegisterSQLMigrations(plain)
+	m.RegisterDialectMigrations(dialect, WithDialectName("sqlite"))
+
+	first, err := m.initSQLMigrations(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, first.Sorted(), 2)
+	plainReads, dialectReads := plain.reads.Load(), dialect.reads.Load()
+	require.Positive(t, plainReads)
+	require.Positive(t, dialectReads)
+
+	second, err := m.initSQLMigrations(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, migrationNames(first.Sorted()), migrationNames(second.Sorted()))
+	assert.Equal(t, plainReads, plain.reads.Load(), "cached sets are reused")
+	assert.Equal(t, dialectReads, dialect.reads.Load())
+
+	m.RegisterSQLMigrations(fstest.MapFS{
+		"0003_more.up.sql": {Data: []byte("CREATE TABLE t3 (id INTEGER)")},
+	})
+	third, err := m.initSQLMigrations(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, third.Sorted(), 3)
+	assert.Greater(t, plain.reads.Load(), plainReads, "a registration invalidates the cache")
+
+	plain.FS.(fstest.MapFS)["0004_changed.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	fourth, err := m.initSQLMigrations(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, fourth.Sorted(), 4, "a changed listing is discovered again")
+}
+
+func TestInitSQLMigrations_MergesAcrossFileSystems(t *testing.T) {
+	m := NewMigrations()
+	m.RegisterSQLMigrations(
+		fstest.MapFS{"0001_init.up.sql": {Data: []byte("CREATE TABLE t1 (id INTEGER)")}},
+		fstest.MapFS{"0001_init.down.sql": {Data: []byte("DROP TABLE t1")}},
+	)
+
+	migrations, err := m.initSQLMigrations(context.Background(), nil)
+	require.NoError(t, err)
+	sorted := migrations.Sorted()
+	require.Len(t, sorted, 1)
+	assert.NotNil(t, sorted[0].Up)
+	assert.NotNil(t, sorted[0].Down)
+}
+
+func TestInitSQLMigrations_Concurrent(t *testing.T) {
+	m := NewMigrations()
+	for i := range 8 {
+		m.RegisterSQLMigrations(fstest.MapFS{
+			"000" + string(rune('1'+i)) + "_m.up.sql": {Data: []byte("SELECT 1")},
+		})
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrations, err := m.initSQLMigrations(context.Background(), nil)
+			assert.NoError(t, err)
+			assert.Len(t, migrations.Sorted(), 8)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,263 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	MigrationDirectionUp   = "up"
+	MigrationDirectionDown = "down"
+)
+
+// MigrationRun is one execution of a migration, stored in the
+// companion table named by Migrations.HistoryTableName when history is
+// enabled.
+type MigrationRun struct {
+	bun.BaseModel `bun:"table:bun_migration_history"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	Name       string    `bun:"name,notnull"`
+	Comment    string    `bun:"comment"`
+	GroupID    int64     `bun:"group_id"`
+	Direction  string    `bun:"direction,notnull"`
+	Source     string    `bun:"source"`
+	Checksum   string    `bun:"checksum"`
+	AppliedBy  string    `bun:"applied_by"`
+	Host       string    `bun:"host"`
+	StartedAt  time.Time `bun:"started_at,notnull"`
+	DurationMS int64     `bun:"duration_ms"`
+	Error      string    `bun:"error"`
+}
+
+// Duration returns how long the run took
+func (r MigrationRun) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// MigrationStatus describes a registered migration and its latest run.
+type MigrationStatus struct {
+	Name       string
+	Comment    string
+	GroupID    int64
+	Applied    bool
+	MigratedAt time.Time
+	Source     string
+	Checksum   string
+	OutOfOrder bool
+	LastRun    *MigrationRun
+}
+
+type migrationActorKey struct{}
+
+// ContextWithMigrationActor sets who is running migrations, recorded
+// as applied_by in the migration history. It defaults to user@host.
+func ContextWithMigrationActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, migrationActorKey{}, actor)
+}
+
+// EnableHistory records every migration run, with timing, actor,
+// source label and checksum, in the bun_migration_history table, or
+// <namespace>_migration_history for a namespace.
+func (m *Migrations) EnableHistory() *Migrations {
+	m.mx.Lock()
+	m.historyEnabled = true
+	m.mx.Unlock()
+	return m
+}
+
+// History returns the recorded runs, newest first. When names are
+// given only runs of those migrations are returned.
+func (m *Migrations) History(ctx context.Context, db bun.IDB, names ...string) ([]MigrationRun, error) {
+	var runs []MigrationRun
+	q := db.NewSelect().Model(&runs).ModelTableExpr("? AS ?", bun.Ident(m.HistoryTableName()), bun.Ident("migration_run")).Order("id DESC")
+	if len(names) > 0 {
+		q = q.Where("name IN (?)", bun.In(names))
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration history")
+	}
+	return runs, nil
+}
+
+// Status lists every registered migration with its applied state and,
+// when history is enabled, its latest recorded run.
+func (m *Migrations) Status(ctx context.Context, db *bun.DB) ([]MigrationStatus, error) {
+	sqlMigrations, err := m.initSQLMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if sqlMigrations == nil {
+		return nil, nil
+	}
+
+	migrator := m.newMigrator(db, sqlMigrations)
+	if err := migrator.Init(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator")
+	}
+	migrations, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration status")
+	}
+
+	m.mx.Lock()
+	sources := m.sources
+	historyEnabled := m.historyEnabled
+	m.mx.Unlock()
+
+	lastRuns := map[string]*MigrationRun{}
+	if historyEnabled {
+		runs, err := m.History(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		for i := range runs {
+			if _, ok := lastRuns[runs[i].Name]; !ok {
+				lastRuns[runs[i].Name] = &runs[i]
+			}
+		}
+	}
+
+	outOfOrder := map[string]bool{}
+	for _, migration := range outOfOrderMigrations(migrations) {
+		outOfOrder[migration.Name] = true
+	}
+
+	out := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		source := sources[migration.Name]
+		out = append(out, MigrationStatus{
+			Name:       migration.Name,
+			Comment:    migration.Comment,
+			GroupID:    migration.GroupID,
+			Applied:    migration.IsApplied(),
+			MigratedAt: migration.MigratedAt,
+			Source:     source.label,
+			Checksum:   source.checksum,
+			OutOfOrder: outOfOrder[migration.Name],
+			LastRun:    lastRuns[migration.Name],
+		})
+	}
+	return out, nil
+}
+
+type migrationSource struct {
+	label    string
+	checksum string
+}
+
+// collectMigrationSources records the source label and up file checksum
+// of every migration in fsys. Later filesystems override earlier ones,
+// matching how discovery layers them.
+func collectMigrationSources(dst map[string]migrationSource, fsys fs.FS, label string) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".up.sql") {
+			return nil
+		}
+		matches := orderedMigrationNameRE.FindStringSubmatch(filepath.Base(path))
+		if matches == nil {
+			return nil
+		}
+		checksum, err := migrationFileChecksum(fsys, path)
+		if err != nil {
+			return err
+		}
+		dst[matches[1]] = migrationSource{label: label, checksum: checksum}
+		return nil
+	})
+}
+
+func migrationFileChecksum(fsys fs.FS, path string) (string, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// withHistory wraps every migration so its runs are recorded.
+func (m *Migrations) withHistory(ctx context.Context, db *bun.DB, migrations *migrate.Migrations, sources map[string]migrationSource) (*migrate.Migrations, error) {
+	if _, err := db.NewCreateTable().Model((*MigrationRun)(nil)).ModelTableExpr("?", bun.Ident(m.HistoryTableName())).IfNotExists().Exec(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create migration history table")
+	}
+
+	wrapped := migrate.NewMigrations()
+	for _, migration := range migrations.Sorted() {
+		source := sources[migration.Name]
+		if up := migration.Up; up != nil {
+			migration.Up = func(ctx context.Context, migrator *migrate.Migrator, migration *migrate.Migration) error {
+				return m.recordRun(ctx, migrator, migration, MigrationDirectionUp, source, func() error {
+					return up(ctx, migrator, migration)
+				})
+			}
+		}
+		if down := migration.Down; down != nil {
+			migration.Down = func(ctx context.Context, migrator *migrate.Migrator, migration *migrate.Migration) error {
+				return m.recordRun(ctx, migrator, migration, MigrationDirectionDown, source, func() error {
+					return down(ctx, migrator, migration)
+				})
+			}
+		}
+		wrapped.Add(migration)
+	}
+	return wrapped, nil
+}
+
+func (m *Migrations) recordRun(ctx context.Context, migrator *migrate.Migrator, migration *migrate.Migration, direction string, source migrationSource, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	run := &MigrationRun{
+		Name:       migration.Name,
+		Comment:    migration.Comment,
+		GroupID:    migration.GroupID,
+		Direction:  direction,
+		Source:     source.label,
+		Checksum:   source.checksum,
+		AppliedBy:  migrationActor(ctx),
+		Host:       migrationHost(),
+		StartedAt:  start.UTC(),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if _, insertErr := migrator.DB().NewInsert().Model(run).ModelTableExpr("?", bun.Ident(m.HistoryTableName())).Exec(context.WithoutCancel(ctx)); insertErr != nil {
+		NewContextLogger(m.logger()).WarnCtx(ctx, "migrations: failed to record migration history", "migration", migration.Name, "error", insertErr)
+	}
+	return err
+}
+
+func migrationActor(ctx context.Context) string {
+	if actor, ok := ctx.Value(migrationActorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	return name + "@" + migrationHost()
+}
+
+func migrationHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_HistoryRecordsRuns(t *testing.T) {
+	ctx := ContextWithMigrationActor(context.Background(), "deployer")
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations().EnableHistory()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE hist_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE hist_users")},
+	})
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+	require.NoError(t, migrations.Rollback(ctx, db))
+
+	runs, err := migrations.History(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+
+	assert.Equal(t, MigrationDirectionDown, runs[0].Direction)
+	assert.Equal(t, MigrationDirectionUp, runs[1].Direction)
+	for _, run := range runs {
+		assert.Equal(t, "20240101000000", run.Name)
+		assert.Equal(t, int64(1), run.GroupID)
+		assert.Equal(t, "deployer", run.AppliedBy)
+		assert.Equal(t, "sql", run.Source)
+		assert.Len(t, run.Checksum, 64)
+		assert.Empty(t, run.Error)
+	}
+
+	status, err := migrations.Status(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.False(t, status[0].Applied)
+	assert.Equal(t, runs[1].Checksum, status[0].Checksum)
+	require.NotNil(t, status[0].LastRun)
+	assert.Equal(t, MigrationDirectionDown, status[0].LastRun.Direction)
+}
+
+func TestMigrations_HistoryPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations().EnableHistory()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_app.up.sql": {Data: []byte("CREATE TABLE hist_app (id INTEGER PRIMARY KEY)")},
+	})
+	auth := migrations.Namespace("auth")
+	auth.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_auth.up.sql": {Data: []byte("CREATE TABLE hist_auth (id INTEGER PRIMARY KEY)")},
+	})
+	assert.Equal(t, "bun_migration_history", migrations.HistoryTableName())
+	assert.Equal(t, "auth_migration_history", auth.HistoryTableName())
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	runs, err := migrations.History(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "app", runs[0].Comment)
+
+	runs, err = auth.History(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "auth", runs[0].Comment)
+}
@@ -0,0 +1,208 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+var (
+	gooseFileRE      = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+	gooseDirectiveRE = regexp.MustCompile(`^--\s*\+goose\s+(\w+)`)
+)
+
+// GooseFS splits goose annotated SQL files, NNNN_name.sql with
+// "-- +goose Up" and "-- +goose Down" sections, into the up and down
+// files bun expects. StatementBegin/StatementEnd and NO TRANSACTION
+// annotations are dropped, bun runs each file as is. Go migrations and
+// other files are ignored.
+func GooseFS(fsys fs.FS) (fstest.MapFS, error) {
+	out := fstest.MapFS{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		match := gooseFileRE.FindStringSubmatch(d.Name())
+		if match == nil {
+			return nil
+		}
+		version, title := match[1], match[2]
+		if len(version) > 14 {
+			return apierrors.New("goose version is longer than 14 digits", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"file": p})
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		up, down, err := splitGooseSQL(data)
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid goose migration").
+				WithMetadata(map[string]any{"file": p})
+		}
+
+		title = strings.Trim(golangMigrateTitleRE.ReplaceAllString(strings.ToLower(title), "_"), "_")
+		if title == "" {
+			title = "migration"
+		}
+		base := path.Join(path.Dir(p), version+"_"+title)
+		out[base+".up.sql"] = &fstest.MapFile{Data: up}
+		if len(bytes.TrimSpace(down)) > 0 {
+			out[base+".down.sql"] = &fstest.MapFile{Data: down}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to read goose directory")
+	}
+	return out, nil
+}
+
+func splitGooseSQL(data []byte) (up, down []byte, err error) {
+	var current *[]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := gooseDirectiveRE.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			switch match[1] {
+			case "Up":
+				current = &up
+			case "Down":
+				current = &down
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		*current = append(*current, line...)
+		*current = append(*current, '\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(bytes.TrimSpace(up)) == 0 {
+		return nil, nil, fmt.Errorf("missing -- +goose Up section")
+	}
+	return up, down, nil
+}
+
+var atlasTypeRE = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\(\d+(,\s*\d+)?\))?$`)
+
+// AtlasSchemaHCL returns the Atlas HCL schema of the given models or,
+// without any, every model registered on db, for teams that plan or
+// diff schema changes with Atlas. Tables carry their columns, primary
+// key, single column unique indexes and belongs-to foreign keys.
+func AtlasSchemaHCL(db *bun.DB, models ...any) []byte {
+	var tables []*schema.Table
+	if len(models) == 0 {
+		tables = registeredTables(db)
+	} else {
+		for _, model := range models {
+			tables = append(tables, db.Table(reflect.TypeOf(model)))
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Name < tables[j].Name
+	})
+
+	defaultSchema := db.Dialect().DefaultSchema()
+	schemaOf := func(table *schema.Table) string {
+		if table.Schema != "" {
+			return table.Schema
+		}
+		return defaultSchema
+	}
+
+	schemas := map[string]bool{}
+	var b bytes.Buffer
+	for _, table := range tables {
+		schemas[schemaOf(table)] = true
+	}
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "schema %q {}\n", name)
+	}
+
+	for _, table := range tables {
+		fmt.Fprintf(&b, "\ntable %q {\n  schema = schema.%s\n", table.Name, schemaOf(table))
+		for _, field := range table.Fields {
+			fmt.Fprintf(&b, "  column %q {\n    null = %t\n    type = %s\n", field.Name, !field.NotNull && !field.IsPK, atlasType(field.CreateTableSQLType))
+			if field.SQLDefault != "" {
+				fmt.Fprintf(&b, "    default = sql(%s)\n", strconv.Quote(field.SQLDefault))
+			}
+			b.WriteString("  }\n")
+		}
+		if len(table.PKs) > 0 {
+			fmt.Fprintf(&b, "  primary_key {\n    columns = [%s]\n  }\n", atlasColumns(table.PKs))
+		}
+		for _, rel := range sortedRelations(table) {
+			if rel.Type != schema.BelongsToRelation {
+				continue
+			}
+			fmt.Fprintf(&b, "  foreign_key %q {\n    columns = [%s]\n    ref_columns = [%s]\n  }\n",
+				table.Name+"_"+rel.BasePKs[0].Name+"_fkey",
+				atlasColumns(rel.BasePKs), atlasRefColumns(rel.JoinTable, rel.JoinPKs))
+		}
+
+		groups := make([]string, 0, len(table.Unique))
+		for group, fields := range table.Unique {
+			if len(fields) == 1 {
+				groups = append(groups, group)
+			}
+		}
+		sort.Strings(groups)
+		for _, group := range groups {
+			field := table.Unique[group][0]
+			fmt.Fprintf(&b, "  index %q {\n    unique = true\n    columns = [column.%s]\n  }\n",
+				table.Name+"_"+field.Name+"_key", field.Name)
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
+
+// atlasType writes simple types such as varchar(255) as HCL type
+// expressions and anything else, e.g. "timestamp with time zone", with
+// sql("...").
+func atlasType(sqlType string) string {
+	typ := strings.ToLower(sqlType)
+	if atlasTypeRE.MatchString(typ) {
+		return typ
+	}
+	return "sql(" + strconv.Quote(typ) + ")"
+}
+
+func atlasColumns(fields []*schema.Field) string {
+	refs := make([]string, len(fields))
+	for i, field := range fields {
+		refs[i] = "column." + field.Name
+	}
+	return strings.Join(refs, ", ")
+}
+
+func atlasRefColumns(table *schema.Table, fields []*schema.Field) string {
+	refs := make([]string, len(fields))
+	for i, field := range fields {
+		refs[i] = "table." + table.Name + ".column." + field.Name
+	}
+	return strings.Join(refs, ", ")
+}
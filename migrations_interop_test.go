@@ -0,0 +1,100 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGooseFS(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys, err := GooseFS(fstest.MapFS{
+		"20240101000000_create_gs_users.sql": {Data: []byte(`-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE gs_users (id INTEGER PRIMARY KEY);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE gs_users;
+`)},
+		"20240102000000_Seed.sql": {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\nINSERT INTO gs_users (id) VALUES (1);\n")},
+		"20240103000000_code.go":  {Data: []byte("package migrations")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE gs_users (id INTEGER PRIMARY KEY);\n\n", string(fsys["20240101000000_create_gs_users.up.sql"].Data))
+	assert.Equal(t, "DROP TABLE gs_users;\n", string(fsys["20240101000000_create_gs_users.down.sql"].Data))
+	assert.Contains(t, fsys, "20240102000000_seed.up.sql")
+	assert.NotContains(t, fsys, "20240102000000_seed.down.sql")
+	assert.Len(t, fsys, 3)
+
+	migrations := NewMigrations().RegisterSQLMigrations(fsys)
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var count int
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM gs_users").Scan(ctx, &count))
+	assert.Equal(t, 1, count)
+
+	_, err = GooseFS(fstest.MapFS{"1_missing.sql": {Data: []byte("CREATE TABLE x (id INT);")}})
+	assert.Error(t, err)
+}
+
+func TestAtlasSchemaHCL(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	hcl := string(AtlasSchemaHCL(db, (*docsPost)(nil), (*docsAuthor)(nil)))
+	assert.Equal(t, `schema "main" {}
+
+table "doc_authors" {
+  schema = schema.main
+  column "id" {
+    null = false
+    type = integer
+  }
+  column "email" {
+    null = false
+    type = varchar
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "doc_authors_email_key" {
+    unique = true
+    columns = [column.email]
+  }
+}
+
+table "doc_posts" {
+  schema = schema.main
+  column "id" {
+    null = false
+    type = integer
+  }
+  column "author_id" {
+    null = true
+    type = integer
+  }
+  column "status" {
+    null = true
+    type = varchar
+    default = sql("'draft'")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  foreign_key "doc_posts_author_id_fkey" {
+    columns = [column.author_id]
+    ref_columns = [table.doc_authors.column.id]
+  }
+}
+`, hcl)
+
+	assert.Equal(t, `sql("timestamp with time zone")`, atlasType("TIMESTAMP WITH TIME ZONE"))
+	assert.Equal(t, "varchar(255)", atlasType("VARCHAR(255)"))
+}
@@ -0,0 +1,286 @@
+package persistence
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration lint rules
+const (
+	LintDropWithoutIfExists = "drop-without-if-exists"
+	LintNonConcurrentIndex  = "non-concurrent-index"
+	LintColumnTypeRewrite   = "column-type-rewrite"
+	LintMissingDown         = "missing-down"
+	LintTimestampWithoutTZ  = "timestamp-without-time-zone"
+)
+
+// Lint finding severities
+const (
+	LintSeverityWarning = "warning"
+	LintSeverityError   = "error"
+)
+
+// LintFinding is a potentially dangerous pattern found in a migration.
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Line     int    `json:"line,omitempty"`
+	Dialect  string `json:"dialect,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d: [%s] %s", f.Path, f.Line, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s", f.Path, f.Rule, f.Message)
+}
+
+// LintFindings is the result of Lint
+type LintFindings []LintFinding
+
+// HasErrors reports whether any finding has error severity.
+func (f LintFindings) HasErrors() bool {
+	for _, finding := range f {
+		if finding.Severity == LintSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// LintOption configures Lint
+type LintOption func(*lintOptions)
+
+type lintOptions struct {
+	dialect    string
+	ignore     map[string]struct{}
+	severities map[string]string
+}
+
+// WithLintDialect sets the dialect assumed for files outside a dialect
+// directory and without a dialect annotation. Defaults to postgres.
+func WithLintDialect(name string) LintOption {
+	return func(o *lintOptions) {
+		o.dialect = name
+	}
+}
+
+// WithLintIgnore disables the given rules.
+func WithLintIgnore(rules ...string) LintOption {
+	return func(o *lintOptions) {
+		for _, rule := range rules {
+			o.ignore[rule] = struct{}{}
+		}
+	}
+}
+
+// WithLintSeverity overrides the severity of a rule, e.g. to fail CI
+// on LintNonConcurrentIndex.
+func WithLintSeverity(rule, severity string) LintOption {
+	return func(o *lintOptions) {
+		o.severities[rule] = severity
+	}
+}
+
+var (
+	lintDropRE        = regexp.MustCompile(`(?is)^\s*DROP\s+(TABLE|INDEX|VIEW|MATERIALIZED\s+VIEW|SEQUENCE|TYPE|SCHEMA|TRIGGER|FUNCTION)\s+(CONCURRENTLY\s+)?(IF\s+EXISTS)?`)
+	lintCreateIndexRE = regexp.MustCompile(`(?is)^\s*CREATE\s+(UNIQUE\s+)?INDEX\s+(CONCURRENTLY)?`)
+	lintAlterTypeRE   = regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\b`)
+	lintTableDDLRE    = regexp.MustCompile(`(?is)^\s*(CREATE|ALTER)\s+TABLE\b`)
+	lintTimestampRE   = regexp.MustCompile(`(?is)\bTIMESTAMP\b(\s*\(\s*\d+\s*\))?(\s+(WITH|WITHOUT)\s+TIME\s+ZONE)?`)
+)
+
+// Lint checks the SQL migrations in fsys for dangerous patterns:
+// drops without IF EXISTS, index creation without CONCURRENTLY on
+// Postgres, column type changes that rewrite the table, TIMESTAMP
+// WITHOUT TIME ZONE columns on Postgres and up files without a
+// matching down file. Files in dialect directories, or with a
+// dialect annotation, are checked with that dialect's rules.
+func Lint(fsys fs.FS, opts ...LintOption) (LintFindings, error) {
+	options := lintOptions{
+		dialect:    defaultDialectName,
+		ignore:     map[string]struct{}{},
+		severities: map[string]string{},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	dialectOpts := defaultDialectOptions()
+
+	var findings LintFindings
+	add := func(finding LintFinding) {
+		if _, ok := options.ignore[finding.Rule]; ok {
+			return
+		}
+		finding.Severity = LintSeverityWarning
+		if severity, ok := options.severities[finding.Rule]; ok {
+			finding.Severity = severity
+		}
+		findings = append(findings, finding)
+	}
+
+	files := map[string]struct{}{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(p), sqlFileExtension) {
+			return nil
+		}
+		files[p] = struct{}{}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		dialects := dialectOpts.extractDialects(data)
+		if len(dialects) == 0 {
+			dialect := options.dialect
+			if dir := strings.SplitN(p, "/", 2); len(dir) == 2 {
+				if canonical, ok := dialectOpts.aliases[strings.ToLower(dir[0])]; ok {
+					dialect = canonical
+				}
+			}
+			dialects = []string{dialect}
+		}
+
+		down := strings.HasSuffix(strings.ToLower(p), ".down.sql")
+		for _, stmt := range splitLintStatements(string(data)) {
+			for _, dialect := range dialects {
+				lintSQL(stmt, p, dialect, down, add)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for p := range files {
+		key, direction, ok := parseMigrationKey(p)
+		if !ok || direction != "up" {
+			continue
+		}
+		if _, ok := files[p[:len(key)]+".down.sql"]; ok {
+			continue
+		}
+		add(LintFinding{
+			Rule:    LintMissingDown,
+			Path:    p,
+			Message: fmt.Sprintf("no down migration %s", path.Base(p[:len(key)]+".down.sql")),
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+type lintStatement struct {
+	sql  string
+	line int
+}
+
+// splitLintStatements strips line comments and splits on semicolons,
+// keeping the line where each statement starts.
+func splitLintStatements(content string) []lintStatement {
+	var out []lintStatement
+	var b strings.Builder
+	start := 0
+
+	for i, line := range strings.Split(content, "\n") {
+		if idx := strings.Index(line, "--"); idx >= 0 {
+			line = line[:idx]
+		}
+		for {
+			if start == 0 && strings.TrimSpace(line) != "" {
+				start = i + 1
+			}
+			idx := strings.Index(line, ";")
+			if idx < 0 {
+				b.WriteString(line)
+				b.WriteString("\n")
+				break
+			}
+			b.WriteString(line[:idx])
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				out = append(out, lintStatement{sql: stmt, line: start})
+			}
+			b.Reset()
+			start = 0
+			line = line[idx+1:]
+		}
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		out = append(out, lintStatement{sql: stmt, line: start})
+	}
+	return out
+}
+
+func lintSQL(stmt lintStatement, p, dialect string, down bool, add func(LintFinding)) {
+	if m := lintDropRE.FindStringSubmatch(stmt.sql); m != nil && m[3] == "" {
+		add(LintFinding{
+			Rule:    LintDropWithoutIfExists,
+			Path:    p,
+			Line:    stmt.line,
+			Dialect: dialect,
+			Message: fmt.Sprintf("DROP %s without IF EXISTS", strings.ToUpper(strings.Join(strings.Fields(m[1]), " "))),
+		})
+	}
+
+	if dialect != "postgres" {
+		return
+	}
+
+	if m := lintCreateIndexRE.FindStringSubmatch(stmt.sql); m != nil && m[2] == "" && !down {
+		add(LintFinding{
+			Rule:    LintNonConcurrentIndex,
+			Path:    p,
+			Line:    stmt.line,
+			Dialect: dialect,
+			Message: "CREATE INDEX without CONCURRENTLY locks writes on the table",
+		})
+	}
+
+	if lintAlterTypeRE.MatchString(stmt.sql) {
+		add(LintFinding{
+			Rule:    LintColumnTypeRewrite,
+			Path:    p,
+			Line:    stmt.line,
+			Dialect: dialect,
+			Message: "changing a column type may rewrite the table under an exclusive lock",
+		})
+	}
+
+	if lintTableDDLRE.MatchString(stmt.sql) && hasTimestampWithoutTZ(stmt.sql) {
+		add(LintFinding{
+			Rule:    LintTimestampWithoutTZ,
+			Path:    p,
+			Line:    stmt.line,
+			Dialect: dialect,
+			Message: "TIMESTAMP WITHOUT TIME ZONE drops the offset, use TIMESTAMPTZ",
+		})
+	}
+}
+
+func hasTimestampWithoutTZ(sql string) bool {
+	for _, m := range lintTimestampRE.FindAllStringSubmatch(sql, -1) {
+		if !strings.EqualFold(m[3], "WITH") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint_Findings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_users.up.sql": {Data: []byte(`
+CREATE TABLE users (id BIGSERIAL PRIMARY KEY, email TEXT);
+-- DROP TABLE ignored_in_comment;
+CREATE INDEX users_email_idx ON users (email);
+`)},
+		"0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_alter.up.sql": {Data: []byte(`ALTER TABLE users
+	ALTER COLUMN email TYPE VARCHAR(255);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS users_id_idx ON users (id);`)},
+		"sqlite/0003_idx.up.sql":   {Data: []byte("CREATE INDEX idx ON users (email);")},
+		"sqlite/0003_idx.down.sql": {Data: []byte("DROP INDEX IF EXISTS idx;")},
+	}
+
+	findings, err := Lint(fsys)
+	require.NoError(t, err)
+
+	type key struct {
+		rule string
+		path string
+		line int
+	}
+	got := make([]key, 0, len(findings))
+	for _, finding := range findings {
+		got = append(got, key{finding.Rule, finding.Path, finding.Line})
+	}
+	assert.Equal(t, []key{
+		{LintDropWithoutIfExists, "0001_users.down.sql", 1},
+		{LintNonConcurrentIndex, "0001_users.up.sql", 4},
+		{LintMissingDown, "0002_alter.up.sql", 0},
+		{LintColumnTypeRewrite, "0002_alter.up.sql", 1},
+	}, got)
+	assert.False(t, findings.HasErrors())
+}
+
+func TestLint_Options(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_idx.up.sql": {Data: []byte("CREATE INDEX idx ON users (email);")},
+	}
+
+	findings, err := Lint(fsys,
+		WithLintIgnore(LintMissingDown),
+		WithLintSeverity(LintNonConcurrentIndex, LintSeverityError),
+	)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.True(t, findings.HasErrors())
+	assert.Equal(t, "0001_idx.up.sql:1: [non-concurrent-index] CREATE INDEX without CONCURRENTLY locks writes on the table", findings[0].String())
+
+	findings, err = Lint(fsys, WithLintDialect("sqlite"), WithLintIgnore(LintMissingDown))
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+}
+
+func TestLint_TimestampWithoutTimeZone(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_events.up.sql": {Data: []byte(`
+CREATE TABLE events (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP WITH TIME ZONE
+);
+ALTER TABLE events ADD COLUMN seen_at TIMESTAMP(3);
+ALTER TABLE events ADD COLUMN read_at timestamp without time zone;
+`)},
+		"0001_events.down.sql":      {Data: []byte("DROP TABLE IF EXISTS events;")},
+		"sqlite/0002_logs.up.sql":   {Data: []byte("CREATE TABLE logs (at TIMESTAMP);")},
+		"sqlite/0002_logs.down.sql": {Data: []byte("DROP TABLE IF EXISTS logs;")},
+	}
+
+	findings, err := Lint(fsys)
+	require.NoError(t, err)
+
+	var lines []int
+	for _, finding := range findings {
+		assert.Equal(t, LintTimestampWithoutTZ, finding.Rule)
+		assert.Equal(t, "0001_events.up.sql", finding.Path)
+		lines = append(lines, finding.Line)
+	}
+	assert.Equal(t, []int{7, 8}, lines)
+}
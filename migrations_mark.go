@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	MigrationDirectionMarkApplied   = "mark_applied"
+	MigrationDirectionMarkUnapplied = "mark_unapplied"
+)
+
+// MarkApplied records the named migrations as applied without running
+// them, e.g. to reconcile a hotfix applied by hand. All marked
+// migrations share a new group. Already applied migrations are skipped.
+func (m *Migrations) MarkApplied(ctx context.Context, db *bun.DB, names ...string) error {
+	return m.mark(ctx, db, names, true)
+}
+
+// MarkUnapplied removes the named migrations from bun_migrations without
+// running their down migrations, so they run again on the next Migrate.
+// Migrations that are not applied are skipped.
+func (m *Migrations) MarkUnapplied(ctx context.Context, db *bun.DB, names ...string) error {
+	return m.mark(ctx, db, names, false)
+}
+
+func (m *Migrations) mark(ctx context.Context, db *bun.DB, names []string, applied bool) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	sqlMigrations, err := m.initSQLMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	if sqlMigrations == nil {
+		return apierrors.New("no migrations registered", apierrors.CategoryNotFound).
+			WithMetadata(map[string]any{"migrations": names})
+	}
+
+	migrator := m.newMigrator(db, sqlMigrations)
+	if err := migrator.Init(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator")
+	}
+	status, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration status")
+	}
+
+	byName := make(map[string]*migrate.Migration, len(status))
+	for i := range status {
+		byName[status[i].Name] = &status[i]
+	}
+	for _, name := range names {
+		if _, ok := byName[name]; !ok {
+			return apierrors.New("unknown migration", apierrors.CategoryNotFound).
+				WithMetadata(map[string]any{"migration": name})
+		}
+	}
+
+	groupID := status.LastGroupID() + 1
+	direction := MigrationDirectionMarkUnapplied
+	if applied {
+		direction = MigrationDirectionMarkApplied
+	}
+
+	m.mx.Lock()
+	sources := m.sources
+	historyEnabled := m.historyEnabled
+	m.mx.Unlock()
+
+	for _, name := range names {
+		migration := byName[name]
+		if migration.IsApplied() == applied {
+			continue
+		}
+
+		if applied {
+			migration.GroupID = groupID
+			migration.MigratedAt = time.Now()
+			err = migrator.MarkApplied(ctx, migration)
+		} else {
+			err = migrator.MarkUnapplied(ctx, migration)
+		}
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to mark migration").
+				WithMetadata(map[string]any{"migration": name, "direction": direction})
+		}
+
+		m.logger().Info("migrations: marked migration", "migration", name, "direction", direction)
+
+		if historyEnabled {
+			source := sources[name]
+			_ = m.recordRun(ctx, migrator, migration, direction, source, func() error { return nil })
+		}
+	}
+	return nil
+}
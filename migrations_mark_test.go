@@ -0,0 +1,44 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_MarkAppliedAndUnapplied(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations().EnableHistory()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":  {Data: []byte("CREATE TABLE mark_users (id INTEGER PRIMARY KEY)")},
+		"20240102000000_hotfix.up.sql": {Data: []byte("CREATE TABLE mark_hotfix (id INTEGER PRIMARY KEY)")},
+	})
+
+	require.NoError(t, migrations.MarkApplied(ctx, db, "20240102000000"))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var tables []string
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE name LIKE 'mark_%'").Scan(ctx, &tables))
+	assert.Equal(t, []string{"mark_users"}, tables)
+
+	status, err := migrations.Status(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.True(t, status[0].Applied)
+	assert.True(t, status[1].Applied)
+	assert.Equal(t, MigrationDirectionMarkApplied, status[1].LastRun.Direction)
+
+	require.NoError(t, migrations.MarkUnapplied(ctx, db, "20240102000000"))
+	require.NoError(t, migrations.Migrate(ctx, db))
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE name LIKE 'mark_%' ORDER BY name").Scan(ctx, &tables))
+	assert.Equal(t, []string{"mark_hotfix", "mark_users"}, tables)
+
+	err = migrations.MarkApplied(ctx, db, "20990101000000")
+	assert.Error(t, err)
+}
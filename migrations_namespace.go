@@ -0,0 +1,137 @@
+package persistence
+
+import (
+	"context"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+type migrationNamespace struct {
+	name       string
+	migrations *Migrations
+}
+
+// Namespace returns the migrations registered under name, creating them on
+// first use. A namespace tracks its state in its own <name>_migrations and
+// <name>_migration_locks tables so independent modules embedded in one app
+// can version their schemas without file name collisions.
+//
+// Namespaces inherit the history, out of order and noop error settings at
+// creation time and are migrated after the default migrations, in the order they
+// were created. An empty name returns m.
+func (m *Migrations) Namespace(name string) *Migrations {
+	if name == "" {
+		return m
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for _, ns := range m.namespaces {
+		if ns.name == name {
+			return ns.migrations
+		}
+	}
+
+	child := NewMigrations()
+	child.namespace = name
+	child.historyEnabled = m.historyEnabled
+	child.outOfOrderPolicy = m.outOfOrderPolicy
+	child.noopErrors = m.noopErrors
+	child.SetLogger(WithLoggerFields(m.logger(), map[string]any{"namespace": name}))
+
+	m.namespaces = append(m.namespaces, migrationNamespace{name: name, migrations: child})
+	return child
+}
+
+// Namespaces lists the namespace names in creation order.
+func (m *Migrations) Namespaces() []string {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	names := make([]string, 0, len(m.namespaces))
+	for _, ns := range m.namespaces {
+		names = append(names, ns.name)
+	}
+	return names
+}
+
+// TableName returns the table bun uses to track applied migrations.
+func (m *Migrations) TableName() string {
+	if m.namespace == "" {
+		return "bun_migrations"
+	}
+	return m.namespace + "_migrations"
+}
+
+func (m *Migrations) locksTableName() string {
+	if m.namespace == "" {
+		return "bun_migration_locks"
+	}
+	return m.namespace + "_migration_locks"
+}
+
+// HistoryTableName returns the table recording migration runs, see
+// EnableHistory.
+func (m *Migrations) HistoryTableName() string {
+	if m.namespace == "" {
+		return "bun_migration_history"
+	}
+	return m.namespace + "_migration_history"
+}
+
+// RecoveryTableName returns the table holding the recovery markers of
+// MigrateWithRollbackOnFailure.
+func (m *Migrations) RecoveryTableName() string {
+	if m.namespace == "" {
+		return "bun_migration_recovery"
+	}
+	return m.namespace + "_migration_recovery"
+}
+
+func (m *Migrations) newMigrator(db *bun.DB, migrations *migrate.Migrations) *migrate.Migrator {
+	return migrate.NewMigrator(db, migrations,
+		migrate.WithTableName(m.TableName()),
+		migrate.WithLocksTableName(m.locksTableName()),
+	)
+}
+
+func (m *Migrations) namespaceMigrations() []migrationNamespace {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return append([]migrationNamespace(nil), m.namespaces...)
+}
+
+// migrateNamespaces migrates every namespace and reports
+// whether any of them applied migrations.
+func (m *Migrations) migrateNamespaces(ctx context.Context, db *bun.DB) (bool, error) {
+	applied := false
+	for _, ns := range m.namespaceMigrations() {
+		nsApplied, err := ns.migrations.migrate(ctx, db)
+		if err != nil {
+			return applied, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to run namespace migrations").
+				WithMetadata(map[string]any{"namespace": ns.name})
+		}
+		applied = applied || nsApplied
+	}
+	return applied, nil
+}
+
+// rollbackAllNamespaces rolls back every namespace in reverse creation
+// order and returns the names of the rolled back migrations.
+func (m *Migrations) rollbackAllNamespaces(ctx context.Context, db *bun.DB, opts ...migrate.MigrationOption) ([]string, error) {
+	var rolledBack []string
+	namespaces := m.namespaceMigrations()
+	for i := len(namespaces) - 1; i >= 0; i-- {
+		ns := namespaces[i]
+		names, err := ns.migrations.rollbackAll(ctx, db, opts...)
+		rolledBack = append(rolledBack, names...)
+		if err != nil {
+			return rolledBack, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to rollback namespace migrations").
+				WithMetadata(map[string]any{"namespace": ns.name})
+		}
+	}
+	return rolledBack, nil
+}
@@ -0,0 +1,46 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_Namespace(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_init.up.sql":   {Data: []byte("CREATE TABLE ns_app (id INTEGER PRIMARY KEY)")},
+		"20240101000000_init.down.sql": {Data: []byte("DROP TABLE ns_app")},
+	})
+	migrations.Namespace("auth").RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_init.up.sql":   {Data: []byte("CREATE TABLE ns_auth (id INTEGER PRIMARY KEY)")},
+		"20240101000000_init.down.sql": {Data: []byte("DROP TABLE ns_auth")},
+	})
+
+	assert.Same(t, migrations.Namespace("auth"), migrations.Namespace("auth"))
+	assert.Same(t, migrations, migrations.Namespace(""))
+	assert.Equal(t, []string{"auth"}, migrations.Namespaces())
+	assert.Equal(t, "auth_migrations", migrations.Namespace("auth").TableName())
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	var tables []string
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('ns_app', 'ns_auth', 'bun_migrations', 'auth_migrations') ORDER BY name").Scan(ctx, &tables))
+	assert.Equal(t, []string{"auth_migrations", "bun_migrations", "ns_app", "ns_auth"}, tables)
+
+	var count int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM auth_migrations").Scan(ctx, &count))
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, migrations.RollbackAll(ctx, db))
+	tables = nil
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE name LIKE 'ns_%'").Scan(ctx, &tables))
+	assert.Empty(t, tables)
+}
@@ -0,0 +1,35 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_NoopErrors(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations().SetNoopErrors(true)
+	assert.ErrorIs(t, migrations.Rollback(ctx, db), ErrNothingToRollback)
+
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_init.up.sql":   {Data: []byte("CREATE TABLE noop_items (id INTEGER PRIMARY KEY)")},
+		"20240101000000_init.down.sql": {Data: []byte("DROP TABLE noop_items")},
+	})
+
+	assert.ErrorIs(t, migrations.Rollback(ctx, db), ErrNothingToRollback)
+	require.NoError(t, migrations.Migrate(ctx, db))
+	assert.ErrorIs(t, migrations.Migrate(ctx, db), ErrNothingToMigrate)
+
+	require.NoError(t, migrations.RollbackAll(ctx, db))
+	assert.ErrorIs(t, migrations.RollbackAll(ctx, db), ErrNothingToRollback)
+
+	migrations.SetNoopErrors(false)
+	require.NoError(t, migrations.Migrate(ctx, db))
+	assert.NoError(t, migrations.Migrate(ctx, db))
+}
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun/migrate"
+)
+
+// ErrOutOfOrderMigrations is returned by Migrate when pending migrations
+// sort before the latest applied one and the policy is OutOfOrderFail.
+var ErrOutOfOrderMigrations = errors.New("persistence: out-of-order migrations")
+
+// OutOfOrderPolicy controls what Migrate does with pending migrations
+// whose name sorts before the latest applied migration, which is common
+// with parallel feature branches.
+type OutOfOrderPolicy string
+
+const (
+	// OutOfOrderApply applies them silently, bun's default behavior.
+	OutOfOrderApply OutOfOrderPolicy = "apply"
+	// OutOfOrderWarn logs a warning and applies them.
+	OutOfOrderWarn OutOfOrderPolicy = "warn"
+	// OutOfOrderFail refuses to migrate.
+	OutOfOrderFail OutOfOrderPolicy = "fail"
+)
+
+// SetOutOfOrderPolicy sets the out-of-order migration policy.
+func (m *Migrations) SetOutOfOrderPolicy(policy OutOfOrderPolicy) *Migrations {
+	m.mx.Lock()
+	m.outOfOrderPolicy = policy
+	m.mx.Unlock()
+	return m
+}
+
+// outOfOrderMigrations returns pending migrations that sort before the
+// latest applied migration.
+func outOfOrderMigrations(status migrate.MigrationSlice) migrate.MigrationSlice {
+	var latest string
+	for _, migration := range status {
+		if migration.IsApplied() && migration.Name > latest {
+			latest = migration.Name
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+
+	var out migrate.MigrationSlice
+	for _, migration := range status {
+		if !migration.IsApplied() && migration.Name < latest {
+			out = append(out, migration)
+		}
+	}
+	return out
+}
+
+// checkOutOfOrder applies the configured policy before migrating.
+func (m *Migrations) checkOutOfOrder(ctx context.Context, migrator *migrate.Migrator) error {
+	m.mx.Lock()
+	policy := m.outOfOrderPolicy
+	m.mx.Unlock()
+
+	if policy == "" || policy == OutOfOrderApply {
+		return nil
+	}
+
+	status, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration status")
+	}
+	pending := outOfOrderMigrations(status)
+	if len(pending) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(pending))
+	for i, migration := range pending {
+		names[i] = migration.Name
+	}
+
+	if policy == OutOfOrderFail {
+		return apierrors.Wrap(ErrOutOfOrderMigrations,
+			apierrors.CategoryValidation,
+			"pending migrations sort before the latest applied migration",
+		).WithTextCode("MIGRATIONS_OUT_OF_ORDER").WithMetadata(map[string]any{"migrations": names})
+	}
+
+	m.logger().Warn("migrations: applying out-of-order migrations", "migrations", names)
+	return nil
+}
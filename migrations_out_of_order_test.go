@@ -0,0 +1,65 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func outOfOrderTestMigrations(t *testing.T, policy OutOfOrderPolicy) (*Migrations, func()) {
+	t.Helper()
+
+	fsys := fstest.MapFS{
+		"20240103000000_later.up.sql": {Data: []byte("SELECT 1")},
+	}
+	migrations := NewMigrations().SetOutOfOrderPolicy(policy)
+	migrations.RegisterSQLMigrations(fsys)
+	return migrations, func() {
+		fsys["20240101000000_branch.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	}
+}
+
+func TestMigrations_OutOfOrderFail(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations, addBranch := outOfOrderTestMigrations(t, OutOfOrderFail)
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	addBranch()
+	err := migrations.Migrate(ctx, db)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrOutOfOrderMigrations))
+
+	status, err := migrations.Status(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.True(t, status[0].OutOfOrder)
+	assert.False(t, status[0].Applied)
+	assert.False(t, status[1].OutOfOrder)
+}
+
+func TestMigrations_OutOfOrderWarnApplies(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	lgr := &recordingLogger{}
+	migrations, addBranch := outOfOrderTestMigrations(t, OutOfOrderWarn)
+	migrations.SetLogger(lgr)
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	addBranch()
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	status, err := migrations.Status(ctx, db)
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.Contains(t, strings.Join(lgr.Lines(), "\n"), "WARN migrations: applying out-of-order migrations")
+}
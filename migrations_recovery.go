@@ -0,0 +1,260 @@
+package persistence
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	MigrationRecoveryApplying   = "applying"
+	MigrationRecoveryApplied    = "applied"
+	MigrationRecoveryRolledBack = "rolled_back"
+	MigrationRecoveryFailed     = "rollback_failed"
+)
+
+// MigrationRecoveryMarker records a migration group while it is being
+// applied so a failed or interrupted deploy can be rolled back. Markers
+// are stored in the table named by Migrations.RecoveryTableName.
+type MigrationRecoveryMarker struct {
+	bun.BaseModel `bun:"table:bun_migration_recovery"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	GroupID    int64     `bun:"group_id,notnull"`
+	Migrations string    `bun:"migrations"`
+	Status     string    `bun:"status,notnull"`
+	Error      string    `bun:"error"`
+	StartedAt  time.Time `bun:"started_at,notnull"`
+	FinishedAt time.Time `bun:"finished_at,nullzero"`
+}
+
+// MigrateWithRollbackOnFailure applies pending migrations as a single
+// group and rolls back every migration of that group if one of them
+// fails. This is meant for dialects without transactional DDL, e.g.
+// MySQL, where a failure would otherwise leave the schema half migrated.
+//
+// The group is recorded in a recovery marker table before it is
+// applied. If a previous run was interrupted and left a marker in the
+// applying state, its group is rolled back first. Recovery and migrate
+// run under the migration lock, and namespaces are handled the same way
+// after the default migrations. Like Migrate the outcome is reported by
+// LastMigrate.
+func (m *Migrations) MigrateWithRollbackOnFailure(ctx context.Context, db *bun.DB) error {
+	start := time.Now()
+	applied, err := m.migrateWithRollback(ctx, db)
+
+	outcome := newOperationOutcome(OperationMigrate, start, err)
+	if applied && err == nil {
+		outcome.Group = m.Report()
+		if outcome.Group != nil {
+			outcome.Items = migrationNames(outcome.Group.Migrations)
+		}
+	}
+	m.recordOutcome(outcome)
+
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return m.noop(ErrNothingToMigrate)
+	}
+	return nil
+}
+
+// migrateWithRollback runs the recoverable migrate for m and its
+// namespaces and reports whether any migration was applied.
+func (m *Migrations) migrateWithRollback(ctx context.Context, db *bun.DB) (bool, error) {
+	applied, err := m.migrateGroupWithRollback(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	for _, ns := range m.namespaceMigrations() {
+		nsApplied, err := ns.migrations.migrateWithRollback(ctx, db)
+		if err != nil {
+			return applied, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to run namespace migrations").
+				WithMetadata(map[string]any{"namespace": ns.name})
+		}
+		applied = applied || nsApplied
+	}
+	return applied, nil
+}
+
+func (m *Migrations) migrateGroupWithRollback(ctx context.Context, db *bun.DB) (applied bool, err error) {
+	sqlMigrations, err := m.initSQLMigrations(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	if sqlMigrations == nil {
+		m.logger().Debug("migrations: no SQL migrations found")
+		return false, nil
+	}
+
+	migrator := m.newMigrator(db, sqlMigrations)
+	if err := migrator.Init(ctx); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to initialize migrator")
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryConflict, "failed to acquire migration lock").
+			WithMetadata(map[string]any{"table": m.locksTableName()})
+	}
+	defer func() {
+		if unlockErr := migrator.Unlock(context.WithoutCancel(ctx)); unlockErr != nil {
+			m.logger().Warn("migrations: failed to release migration lock", "error", unlockErr)
+		}
+	}()
+
+	if _, err := db.NewCreateTable().Model((*MigrationRecoveryMarker)(nil)).ModelTableExpr("?", bun.Ident(m.RecoveryTableName())).IfNotExists().Exec(ctx); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create migration recovery table")
+	}
+
+	if err := m.recoverInterruptedGroups(ctx, db, migrator); err != nil {
+		return false, err
+	}
+	if err := m.checkOutOfOrder(ctx, migrator); err != nil {
+		return false, err
+	}
+
+	status, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration status")
+	}
+	pending := status.Unapplied()
+	if len(pending) == 0 {
+		m.logger().Debug("migrations: no new migrations were applied in this group")
+		return false, nil
+	}
+
+	names := make([]string, len(pending))
+	for i, migration := range pending {
+		names[i] = migration.Name
+	}
+	marker := &MigrationRecoveryMarker{
+		GroupID:    status.LastGroupID() + 1,
+		Migrations: strings.Join(names, ","),
+		Status:     MigrationRecoveryApplying,
+		StartedAt:  time.Now().UTC(),
+	}
+	if _, err := db.NewInsert().Model(marker).ModelTableExpr("?", bun.Ident(m.RecoveryTableName())).Exec(ctx); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to record migration recovery marker")
+	}
+
+	group, migrateErr := migrator.Migrate(ctx)
+	if migrateErr == nil {
+		m.migrations = group
+		m.logger().Debug("migrations: successfully applied migration group", "group", group.String())
+		m.logOrderedGroup(group.Migrations)
+		return true, m.finishRecoveryMarker(ctx, db, marker, MigrationRecoveryApplied, nil)
+	}
+
+	NewContextLogger(m.logger()).ErrorErr(ctx, migrateErr, "migrations: group failed, rolling back", "group_id", marker.GroupID)
+
+	rollbackErr := m.rollbackGroup(ctx, migrator, marker.GroupID)
+	if rollbackErr != nil {
+		_ = m.finishRecoveryMarker(ctx, db, marker, MigrationRecoveryFailed, apierrors.Join(migrateErr, rollbackErr))
+		return false, apierrors.Wrap(apierrors.Join(migrateErr, rollbackErr),
+			apierrors.CategoryOperation,
+			"failed to roll back migration group after failure",
+		).WithMetadata(map[string]any{"group_id": marker.GroupID, "migrations": names})
+	}
+
+	_ = m.finishRecoveryMarker(ctx, db, marker, MigrationRecoveryRolledBack, migrateErr)
+	return false, apierrors.Wrap(migrateErr,
+		apierrors.CategoryOperation,
+		"migration group failed and was rolled back",
+	).WithMetadata(map[string]any{"group_id": marker.GroupID, "migrations": names})
+}
+
+// RecoveryMarkers returns the recorded recovery markers, newest first.
+func (m *Migrations) RecoveryMarkers(ctx context.Context, db bun.IDB) ([]MigrationRecoveryMarker, error) {
+	var markers []MigrationRecoveryMarker
+	if err := db.NewSelect().Model(&markers).ModelTableExpr(m.recoveryTableExpr()).Order("id DESC").Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration recovery markers")
+	}
+	return markers, nil
+}
+
+func (m *Migrations) recoverInterruptedGroups(ctx context.Context, db *bun.DB, migrator *migrate.Migrator) error {
+	var markers []MigrationRecoveryMarker
+	err := db.NewSelect().
+		Model(&markers).
+		ModelTableExpr(m.recoveryTableExpr()).
+		Where("status = ?", MigrationRecoveryApplying).
+		Order("id DESC").
+		Scan(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read migration recovery markers")
+	}
+
+	for i := range markers {
+		marker := &markers[i]
+		m.logger().Warn("migrations: rolling back interrupted group", "group_id", marker.GroupID)
+		if err := m.rollbackGroup(ctx, migrator, marker.GroupID); err != nil {
+			_ = m.finishRecoveryMarker(ctx, db, marker, MigrationRecoveryFailed, err)
+			return apierrors.Wrap(err,
+				apierrors.CategoryOperation,
+				"failed to roll back interrupted migration group",
+			).WithMetadata(map[string]any{"group_id": marker.GroupID})
+		}
+		if err := m.finishRecoveryMarker(ctx, db, marker, MigrationRecoveryRolledBack, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackGroup runs the down migrations of groupID in reverse order.
+// The last migration of the group is the one that failed and may be
+// partially applied, so its down errors are logged and ignored.
+func (m *Migrations) rollbackGroup(ctx context.Context, migrator *migrate.Migrator, groupID int64) error {
+	status, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	var group migrate.MigrationSlice
+	for _, migration := range status {
+		if migration.GroupID == groupID {
+			group = append(group, migration)
+		}
+	}
+
+	for i := len(group) - 1; i >= 0; i-- {
+		migration := &group[i]
+		if migration.Down != nil {
+			if err := migration.Down(ctx, migrator, migration); err != nil {
+				if i != len(group)-1 {
+					return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to roll back migration").
+						WithMetadata(map[string]any{"migration": migration.Name})
+				}
+				m.logger().Warn("migrations: down of failed migration returned an error", "migration", migration.Name, "error", err)
+			}
+		}
+		if err := migrator.MarkUnapplied(ctx, migration); err != nil {
+			return err
+		}
+		m.logger().Debug("migrations: rolled back migration", "migration", migration.Name, "group_id", groupID)
+	}
+	return nil
+}
+
+// recoveryTableExpr returns the marker table with the model alias.
+func (m *Migrations) recoveryTableExpr() (string, any, any) {
+	return "? AS ?", bun.Ident(m.RecoveryTableName()), bun.Ident("migration_recovery_marker")
+}
+
+func (m *Migrations) finishRecoveryMarker(ctx context.Context, db bun.IDB, marker *MigrationRecoveryMarker, status string, cause error) error {
+	marker.Status = status
+	marker.FinishedAt = time.Now().UTC()
+	if cause != nil {
+		marker.Error = cause.Error()
+	}
+	_, err := db.NewUpdate().Model(marker).ModelTableExpr(m.recoveryTableExpr()).Column("status", "finished_at", "error").WherePK().Exec(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to update migration recovery marker")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_MigrateWithRollbackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE rb_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE rb_users")},
+		"20240102000000_bad.up.sql":     {Data: []byte("CREATE TABLE rb_bad (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1)")},
+		"20240102000000_bad.down.sql":   {Data: []byte("DROP TABLE rb_bad")},
+	})
+
+	err := migrations.MigrateWithRollbackOnFailure(ctx, db)
+	require.Error(t, err)
+
+	var tables int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('rb_users', 'rb_bad')").Scan(ctx, &tables))
+	assert.Equal(t, 0, tables)
+
+	var applied int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM bun_migrations").Scan(ctx, &applied))
+	assert.Equal(t, 0, applied)
+
+	markers, err := migrations.RecoveryMarkers(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, markers, 1)
+	assert.Equal(t, MigrationRecoveryRolledBack, markers[0].Status)
+	assert.NotEmpty(t, markers[0].Error)
+}
+
+func TestMigrations_MigrateWithRollbackOnFailure_RecoversInterruptedGroup(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE rc_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE rc_users")},
+	})
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	// simulate a deploy that crashed after applying group 1
+	_, err := db.NewCreateTable().Model((*MigrationRecoveryMarker)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&MigrationRecoveryMarker{
+		GroupID:   1,
+		Status:    MigrationRecoveryApplying,
+		StartedAt: time.Now(),
+	}).Exec(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, migrations.MigrateWithRollbackOnFailure(ctx, db))
+
+	markers, err := migrations.RecoveryMarkers(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, markers, 2)
+	assert.Equal(t, int64(1), markers[0].GroupID)
+	assert.Equal(t, MigrationRecoveryApplied, markers[0].Status)
+	assert.Equal(t, MigrationRecoveryRolledBack, markers[1].Status)
+}
+
+func TestMigrations_MigrateWithRollbackOnFailure_PerNamespace(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	auth := NewMigrations().Namespace("auth")
+	auth.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE rc_auth_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE rc_auth_users")},
+	})
+	assert.Equal(t, "auth_migration_recovery", auth.RecoveryTableName())
+
+	require.NoError(t, auth.MigrateWithRollbackOnFailure(ctx, db))
+
+	var tables []string
+	require.NoError(t, db.NewRaw("SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE '%migration_recovery'").Scan(ctx, &tables))
+	assert.Equal(t, []string{"auth_migration_recovery"}, tables)
+
+	markers, err := auth.RecoveryMarkers(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, markers, 1)
+	assert.Equal(t, MigrationRecoveryApplied, markers[0].Status)
+}
+
+func TestMigrations_MigrateWithRollbackOnFailure_IncludesNamespaces(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE rn_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE rn_users")},
+	})
+	migrations.Namespace("billing").RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_invoices.up.sql":   {Data: []byte("CREATE TABLE rn_invoices (id INTEGER PRIMARY KEY)")},
+		"20240101000000_invoices.down.sql": {Data: []byte("DROP TABLE rn_invoices")},
+	})
+
+	require.NoError(t, migrations.MigrateWithRollbackOnFailure(ctx, db))
+
+	var tables int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('rn_users', 'rn_invoices')").Scan(ctx, &tables))
+	assert.Equal(t, 2, tables)
+
+	markers, err := migrations.Namespace("billing").RecoveryMarkers(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, markers, 1)
+	assert.Equal(t, MigrationRecoveryApplied, markers[0].Status)
+
+	outcome := migrations.LastMigrate()
+	require.NotNil(t, outcome)
+	assert.NoError(t, outcome.Err)
+	assert.Equal(t, []string{"20240101000000"}, outcome.Items)
+}
+
+func TestMigrations_MigrateWithRollbackOnFailure_HoldsLock(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_users.up.sql":   {Data: []byte("CREATE TABLE rl_users (id INTEGER PRIMARY KEY)")},
+		"20240101000000_users.down.sql": {Data: []byte("DROP TABLE rl_users")},
+	})
+
+	sqlMigrations, err := migrations.initSQLMigrations(ctx, db)
+	require.NoError(t, err)
+	other := migrations.newMigrator(db, sqlMigrations)
+	require.NoError(t, other.Init(ctx))
+	require.NoError(t, other.Lock(ctx))
+
+	err = migrations.MigrateWithRollbackOnFailure(ctx, db)
+	require.Error(t, err)
+	require.NotNil(t, migrations.LastMigrate())
+	assert.Error(t, migrations.LastMigrate().Err)
+
+	var tables int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'rl_users'").Scan(ctx, &tables))
+	assert.Equal(t, 0, tables)
+
+	require.NoError(t, other.Unlock(ctx))
+	require.NoError(t, migrations.MigrateWithRollbackOnFailure(ctx, db))
+}
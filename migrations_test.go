@@ -6,6 +6,7 @@ import (
 	iofs "io/fs"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
 
@@ -259,6 +260,94 @@ func TestValidateDialectsReportsMissingDialects(t *testing.T) {
 	require.Contains(t, strings.Join(reasons, ""), "SQL files exist but none match dialect")
 }
 
+// byteCountingFS counts the bytes read from its files.
+type byteCountingFS struct {
+	iofs.FS
+	read atomic.Int64
+}
+
+type byteCountingFile struct {
+	iofs.File
+	read *atomic.Int64
+}
+
+func (f *byteCountingFS) Open(name string) (iofs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rdf, ok := file.(iofs.ReadDirFile); ok {
+		return rdf, nil
+	}
+	return byteCountingFile{File: file, read: &f.read}, nil
+}
+
+func (f byteCountingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.read.Add(int64(n))
+	return n, err
+}
+
+func TestValidateDialectsMetadataOnly(t *testing.T) {
+	ctx := context.Background()
+	body := strings.Repeat("INSERT INTO t VALUES (1);\n", 40000)
+	fsys := &byteCountingFS{FS: fstest.MapFS{
+		"0001_init.up.sql":             {Data: []byte("-- create the schema\n\n---bun:dialect:postgres\n" + body)},
+		"0001_init.down.sql":           {Data: []byte("---bun:dialect:postgres\nDROP TABLE t;")},
+		"common/0002_seed.up.sql":      {Data: []byte("-- " + strings.Repeat("x", 10000) + "\n" + body)},
+		"sqlite/0001_init.up.sql":      {Data: []byte("CREATE TABLE t (id INTEGER);")},
+		"common/0002_seed.down.sql":    {Data: []byte("DELETE FROM t;")},
+		"postgres/0004_pg.up.sql":      {Data: []byte("---bun:dialect:postgres\nSELECT 1;")},
+		"postgres/0004_pg.down.sql":    {Data: []byte("SELECT 1;")},
+		"postgres/0005_other.up.sql":   {Data: []byte("---bun:dialect:sqlite\nSELECT 1;")},
+		"postgres/0005_other.down.sql": {Data: []byte("SELECT 1;")},
+	}}
+
+	validate := func(opts ...DialectMigrationOption) DialectValidationResult {
+		var captured DialectValidationResult
+		m := NewMigrations()
+		m.RegisterDialectMigrations(fsys, append([]DialectMigrationOption{
+			WithValidationTargets("postgres", "sqlite"),
+			WithDialectValidationContract(DialectValidationContract{RequireUpDownPairs: true}),
+			WithDialectValidator(func(ctx context.Context, result DialectValidationResult) error {
+				captured = result
+				return nil
+			}),
+		}, opts...)...)
+		require.NoError(t, m.ValidateDialects(ctx, bun.NewDB(nil, pgdialect.New())))
+		return captured
+	}
+
+	full := validate()
+	fullRead := fsys.read.Swap(0)
+	headers := validate(WithMetadataOnlyValidation(true))
+	headersRead := fsys.read.Swap(0)
+
+	require.NotEmpty(t, full.MissingDialects)
+	assert.Equal(t, full.MissingDialects, headers.MissingDialects)
+	assert.Less(t, headersRead, fullRead/50, "only the headers are read")
+	assert.Less(t, headersRead, int64(64*1024))
+}
+
+func TestReadSQLHeader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.sql": {Data: []byte("-- " + strings.Repeat("x", 8192) + "\n  \n---bun:dialect:sqlite\nSELECT 1;\n---bun:dialect:postgres\n")},
+		"b.sql": {Data: []byte("---bun:dialect:postgres")},
+	}
+	header, err := readSQLHeader(fsys, "a.sql")
+	require.NoError(t, err)
+	assert.Contains(t, string(header), "---bun:dialect:sqlite")
+	assert.NotContains(t, string(header), "SELECT")
+	assert.NotContains(t, string(header), "postgres")
+
+	header, err = readSQLHeader(fsys, "b.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "---bun:dialect:postgres\n", string(header))
+
+	_, err = readSQLHeader(fsys, "missing.sql")
+	assert.ErrorIs(t, err, iofs.ErrNotExist)
+}
+
 func TestValidateDialectsDefaultPanics(t *testing.T) {
 	ctx := context.Background()
 	fsys := fstest.MapFS{
@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// ErrUnregisteredM2MModel indicates a relation references a many to many
+// join model that is not registered before the model using it.
+var ErrUnregisteredM2MModel = errors.New("persistence: m2m join model is not registered")
+
+// registerModels registers models on db in order. A model whose m2m
+// relation references a join table that is not registered yet fails
+// with ErrUnregisteredM2MModel, and any other bun registration panic is
+// returned as an error.
+func registerModels(db *bun.DB, models ...any) (err error) {
+	var current any
+	defer func() {
+		if r := recover(); r != nil {
+			err = apierrors.New(fmt.Sprint(r), apierrors.CategoryInternal).
+				WithTextCode("MODEL_REGISTRATION_FAILED").
+				WithMetadata(map[string]any{"model": fmt.Sprintf("%T", current)})
+		}
+	}()
+
+	for _, model := range models {
+		current = model
+		if err := validateM2MRelations(db, model); err != nil {
+			return err
+		}
+		db.RegisterModel(model)
+	}
+	return nil
+}
+
+// validateM2MRelations checks that every m2m relation of model
+// references a registered join table.
+func validateM2MRelations(db *bun.DB, model any) error {
+	typ := modelType(reflect.TypeOf(model))
+	if typ == nil {
+		return nil
+	}
+
+	for _, rel := range m2mTags(typ) {
+		if db.Dialect().Tables().ByName(rel.table) != nil {
+			continue
+		}
+		return apierrors.Wrap(ErrUnregisteredM2MModel, apierrors.CategoryValidation,
+			fmt.Sprintf("%s.%s references m2m table %q which is not registered, register its model with RegisterMany2ManyModel before %s",
+				typ.Name(), rel.field, rel.table, typ.Name()),
+		).WithTextCode("M2M_MODEL_NOT_REGISTERED").WithMetadata(map[string]any{
+			"model": typ.Name(),
+			"field": rel.field,
+			"table": rel.table,
+		})
+	}
+	return nil
+}
+
+type m2mTag struct {
+	field string
+	table string
+}
+
+// m2mTags lists the m2m relations declared on typ, including
+// the ones of embedded structs.
+func m2mTags(typ reflect.Type) []m2mTag {
+	var out []m2mTag
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && embedded != reflect.TypeOf(bun.BaseModel{}) {
+				out = append(out, m2mTags(embedded)...)
+			}
+			continue
+		}
+
+		for _, option := range strings.Split(field.Tag.Get("bun"), ",") {
+			if table, ok := strings.CutPrefix(strings.TrimSpace(option), "m2m:"); ok && table != "" {
+				out = append(out, m2mTag{field: field.Name, table: table})
+			}
+		}
+	}
+	return out
+}
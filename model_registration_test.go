@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"testing"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type m2mOrderUser struct {
+	ID     int64           `bun:"id,pk"`
+	Groups []m2mOrderGroup `bun:"m2m:m2m_order_user_groups,join:User=Group"`
+}
+
+type m2mOrderGroup struct {
+	ID int64 `bun:"id,pk"`
+}
+
+type m2mOrderUserGroup struct {
+	bun.BaseModel `bun:"table:m2m_order_user_groups"`
+
+	UserID  int64          `bun:",pk"`
+	User    *m2mOrderUser  `bun:"rel:belongs-to,join:user_id=id"`
+	GroupID int64          `bun:",pk"`
+	Group   *m2mOrderGroup `bun:"rel:belongs-to,join:group_id=id"`
+}
+
+type m2mBrokenUser struct {
+	ID     int64           `bun:"id,pk"`
+	Groups []m2mOrderGroup `bun:"m2m:m2m_order_user_groups,join:Owner=Group"`
+}
+
+func TestRegisterModels_M2MOrdering(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+
+	err := registerModels(db, (*m2mOrderUser)(nil))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnregisteredM2MModel)
+	assert.Contains(t, err.Error(), `m2mOrderUser.Groups references m2m table "m2m_order_user_groups"`)
+
+	var richErr *apierrors.Error
+	require.ErrorAs(t, err, &richErr)
+	assert.Equal(t, "M2M_MODEL_NOT_REGISTERED", richErr.TextCode)
+
+	db = bun.NewDB(nil, pgdialect.New())
+	require.NoError(t, registerModels(db, (*m2mOrderUserGroup)(nil), (*m2mOrderUser)(nil), (*m2mOrderGroup)(nil)))
+	assert.NotNil(t, db.Dialect().Tables().ByModel("M2mOrderUser"))
+}
+
+func TestRegisterModels_RecoversBunPanics(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	require.NoError(t, registerModels(db, (*m2mOrderUserGroup)(nil)))
+
+	err := registerModels(db, (*m2mBrokenUser)(nil))
+	require.Error(t, err)
+
+	var richErr *apierrors.Error
+	require.ErrorAs(t, err, &richErr)
+	assert.Equal(t, "MODEL_REGISTRATION_FAILED", richErr.TextCode)
+}
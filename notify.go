@@ -0,0 +1,327 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	defaultNotifyPollInterval = time.Second
+	defaultNotifyRetention    = time.Hour
+	defaultNotifyBuffer       = 64
+	defaultNotifyLookback     = 30 * time.Second
+)
+
+// Message is a notification received on a channel.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// NotificationRecord is a message in the notifications table, used to
+// deliver notifications by polling where LISTEN/NOTIFY is not available.
+type NotificationRecord struct {
+	bun.BaseModel `bun:"table:notifications"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Channel   string    `bun:"channel,notnull"`
+	Payload   string    `bun:"payload,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+}
+
+// NotifyMigrationFS returns up and down migrations for the notifications
+// table and its channel index, named <version>_notifications.
+func NotifyMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	fsys := modelTableMigrationFS(db, version, "notifications", (*NotificationRecord)(nil))
+	up := fsys[version+"_notifications.up.sql"]
+	up.Data = append(up.Data, "CREATE INDEX notifications_channel_id_idx ON notifications (channel, id);\n"...)
+	return fsys
+}
+
+// NotifyListener receives Postgres notifications on a dedicated
+// connection. It matches the listener of the bun pgdriver package, and
+// drivers with a different API can be adapted to it.
+type NotifyListener interface {
+	Listen(ctx context.Context, channels ...string) error
+	Receive(ctx context.Context) (channel string, payload string, err error)
+	Close() error
+}
+
+// NotifyOption configures Notify
+type NotifyOption func(*Notify)
+
+// WithNotifyListener enables LISTEN/NOTIFY on Postgres. newListener is
+// called for every subscription. Without it every dialect, Postgres
+// included, uses the notifications table.
+func WithNotifyListener(newListener func(ctx context.Context) (NotifyListener, error)) NotifyOption {
+	return func(n *Notify) {
+		n.newListener = newListener
+	}
+}
+
+// WithNotifyPollInterval sets how often subscriptions poll the
+// notifications table, and how long they wait before reconnecting a
+// failed listener. One second by default.
+func WithNotifyPollInterval(interval time.Duration) NotifyOption {
+	return func(n *Notify) {
+		if interval > 0 {
+			n.poll = interval
+		}
+	}
+}
+
+// WithNotifyLookback sets how long table subscriptions keep re-reading
+// ids below the newest one delivered, 30 seconds by default. Ids are
+// assigned at insert, so a transaction that commits after a later one
+// makes its message visible below the cursor; it is still delivered
+// if it commits within the lookback.
+func WithNotifyLookback(lookback time.Duration) NotifyOption {
+	return func(n *Notify) {
+		if lookback > 0 {
+			n.lookback = lookback
+		}
+	}
+}
+
+// WithNotifyRetention sets how long Cleanup keeps table notifications,
+// one hour by default.
+func WithNotifyRetention(retention time.Duration) NotifyOption {
+	return func(n *Notify) {
+		if retention > 0 {
+			n.retention = retention
+		}
+	}
+}
+
+// WithNotifyErrorHandler receives errors of background subscriptions,
+// which keep retrying after reporting them.
+func WithNotifyErrorHandler(onError func(error)) NotifyOption {
+	return func(n *Notify) {
+		n.onError = onError
+	}
+}
+
+// Notify is lightweight cross instance signaling without a broker. With
+// a listener on Postgres it uses LISTEN/NOTIFY; otherwise messages are
+// written to the notifications table, see NotifyMigrationFS, and
+// subscribers poll it. Delivery is at most once and only to subscribers
+// active when the message is published.
+type Notify struct {
+	db          bun.IDB
+	newListener func(ctx context.Context) (NotifyListener, error)
+	poll        time.Duration
+	lookback    time.Duration
+	retention   time.Duration
+	onError     func(error)
+}
+
+// NewNotify creates a notifier backed by db.
+func NewNotify(db bun.IDB, opts ...NotifyOption) *Notify {
+	n := &Notify{db: db, poll: defaultNotifyPollInterval, lookback: defaultNotifyLookback, retention: defaultNotifyRetention}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(n)
+		}
+	}
+	return n
+}
+
+func (n *Notify) listens() bool {
+	return n.newListener != nil && n.db.Dialect().Name() == dialect.PG
+}
+
+// Publish sends payload to the subscribers of channel.
+func (n *Notify) Publish(ctx context.Context, channel, payload string) error {
+	return n.PublishTx(ctx, n.db, channel, payload)
+}
+
+// PublishTx sends payload using db, which may be a transaction so the
+// message is only delivered if it commits.
+func (n *Notify) PublishTx(ctx context.Context, db bun.IDB, channel, payload string) error {
+	var err error
+	if n.listens() {
+		_, err = db.NewRaw("SELECT pg_notify(?, ?)", channel, payload).Exec(ctx)
+	} else {
+		record := &NotificationRecord{Channel: channel, Payload: payload, CreatedAt: time.Now().UTC()}
+		_, err = db.NewInsert().Model(record).Exec(ctx)
+	}
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to publish notification").
+			WithMetadata(map[string]any{"channel": channel})
+	}
+	return nil
+}
+
+// Subscribe delivers the messages published on channel until ctx is
+// done, then closes the returned channel. Messages are dropped when the
+// subscriber falls behind by more than the channel buffer. Table
+// subscriptions return an error when the starting point cannot be read.
+func (n *Notify) Subscribe(ctx context.Context, channel string) (<-chan Message, error) {
+	if n.listens() {
+		out := make(chan Message, defaultNotifyBuffer)
+		go n.listen(ctx, channel, out)
+		return out, nil
+	}
+
+	// read the starting point now, so messages published after
+	// Subscribe returns are not missed
+	last, err := n.lastID(ctx)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read notifications cursor").
+			WithMetadata(map[string]any{"channel": channel})
+	}
+	out := make(chan Message, defaultNotifyBuffer)
+	go n.pollTable(ctx, channel, last, out)
+	return out, nil
+}
+
+func (n *Notify) listen(ctx context.Context, channel string, out chan<- Message) {
+	defer close(out)
+	for {
+		err := n.receive(ctx, channel, out)
+		if ctx.Err() != nil {
+			return
+		}
+		n.report(err)
+		if !sleepContext(ctx, n.poll) {
+			return
+		}
+	}
+}
+
+func (n *Notify) receive(ctx context.Context, channel string, out chan<- Message) error {
+	ln, err := n.newListener(ctx)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	if err := ln.Listen(ctx, channel); err != nil {
+		return err
+	}
+	for {
+		ch, payload, err := ln.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		deliverMessage(out, Message{Channel: ch, Payload: payload})
+	}
+}
+
+// pollTable reads every id above floor, delivering those not seen yet.
+// Ids seen longer than the lookback ago raise the floor, so the re-read
+// window stays bounded.
+func (n *Notify) pollTable(ctx context.Context, channel string, floor int64, out chan<- Message) {
+	defer close(out)
+	seen := make(map[int64]time.Time)
+	for sleepContext(ctx, n.poll) {
+		var records []NotificationRecord
+		err := n.db.NewSelect().Model(&records).
+			Where("channel = ?", channel).
+			Where("id > ?", floor).
+			Order("id").
+			Scan(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				n.report(err)
+			}
+			continue
+		}
+		now := time.Now()
+		for _, record := range records {
+			if _, ok := seen[record.ID]; ok {
+				continue
+			}
+			seen[record.ID] = now
+			deliverMessage(out, Message{Channel: record.Channel, Payload: record.Payload})
+		}
+		for id, at := range seen {
+			if now.Sub(at) > n.lookback {
+				floor = max(floor, id)
+				delete(seen, id)
+			}
+		}
+		for id := range seen {
+			if id <= floor {
+				delete(seen, id)
+			}
+		}
+	}
+}
+
+func (n *Notify) lastID(ctx context.Context) (int64, error) {
+	var last int64
+	err := n.db.NewSelect().Model((*NotificationRecord)(nil)).ColumnExpr("COALESCE(MAX(id), 0)").Scan(ctx, &last)
+	return last, err
+}
+
+// Cleanup deletes table notifications older than the retention and
+// returns how many were removed.
+func (n *Notify) Cleanup(ctx context.Context) (int64, error) {
+	cutoff := time.Now().UTC().Add(-n.retention)
+	res, err := n.db.NewDelete().Model((*NotificationRecord)(nil)).Where("created_at < ?", cutoff).Exec(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to clean up notifications")
+	}
+	count, _ := res.RowsAffected()
+	return count, nil
+}
+
+// StartCleanup runs Cleanup every interval until ctx is done or the
+// returned stop function is called. Errors are passed to the error
+// handler.
+func (n *Notify) StartCleanup(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := n.Cleanup(ctx); err != nil {
+					n.report(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (n *Notify) report(err error) {
+	if err != nil && n.onError != nil && !errors.Is(err, context.Canceled) {
+		n.onError(err)
+	}
+}
+
+func deliverMessage(out chan<- Message, msg Message) {
+	select {
+	case out <- msg:
+	default:
+	}
+}
+
+// sleepContext waits for d and reports false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
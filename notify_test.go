@@ -0,0 +1,160 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestNotify_PollingSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := NotifyMigrationFS(db, "20240101000000")
+	assert.Contains(t, string(fsys["20240101000000_notifications.up.sql"].Data), "notifications_channel_id_idx")
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(fsys).Migrate(ctx, db))
+
+	notify := NewNotify(db, WithNotifyPollInterval(5*time.Millisecond))
+	require.NoError(t, notify.Publish(ctx, "cache", "before subscribe"))
+
+	subCtx, cancel := context.WithCancel(ctx)
+	messages, err := notify.Subscribe(subCtx, "cache")
+	require.NoError(t, err)
+
+	require.NoError(t, notify.Publish(ctx, "cache", "users:1"))
+	require.NoError(t, notify.Publish(ctx, "other", "ignored"))
+	require.NoError(t, notify.Publish(ctx, "cache", "users:2"))
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case msg := <-messages:
+			assert.Equal(t, "cache", msg.Channel)
+			got = append(got, msg.Payload)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+	assert.Equal(t, []string{"users:1", "users:2"}, got)
+
+	cancel()
+	for range messages {
+	}
+
+	removed, err := NewNotify(db, WithNotifyRetention(time.Nanosecond)).Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), removed)
+}
+
+func TestNotify_PollingDeliversLateCommits(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(NotifyMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+
+	notify := NewNotify(db, WithNotifyPollInterval(5*time.Millisecond))
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages, err := notify.Subscribe(subCtx, "cache")
+	require.NoError(t, err)
+
+	receive := func() string {
+		select {
+		case msg := <-messages:
+			return msg.Payload
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for notifications")
+			return ""
+		}
+	}
+
+	_, err = db.NewInsert().Model(&NotificationRecord{ID: 10, Channel: "cache", Payload: "second", CreatedAt: time.Now()}).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "second", receive())
+
+	// a transaction holding a lower id commits after id 10 was delivered
+	_, err = db.NewInsert().Model(&NotificationRecord{ID: 5, Channel: "cache", Payload: "first", CreatedAt: time.Now()}).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "first", receive())
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected duplicate %q", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotify_SubscribeReportsCursorError(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	messages, err := NewNotify(db).Subscribe(context.Background(), "cache")
+	assert.Error(t, err)
+	assert.Nil(t, messages)
+}
+
+type fakeNotifyListener struct {
+	channels []string
+	messages chan Message
+	closed   bool
+}
+
+func (l *fakeNotifyListener) Listen(_ context.Context, channels ...string) error {
+	l.channels = append(l.channels, channels...)
+	return nil
+}
+
+func (l *fakeNotifyListener) Receive(ctx context.Context) (string, string, error) {
+	select {
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	case msg := <-l.messages:
+		return msg.Channel, msg.Payload, nil
+	}
+}
+
+func (l *fakeNotifyListener) Close() error {
+	l.closed = true
+	return nil
+}
+
+func TestNotify_ListenPostgres(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	listener := &fakeNotifyListener{messages: make(chan Message, 1)}
+	notify := NewNotify(db, WithNotifyListener(func(context.Context) (NotifyListener, error) {
+		return listener, nil
+	}))
+
+	mock.ExpectExec(`SELECT pg_notify\('jobs', 'ready'\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, notify.Publish(context.Background(), "jobs", "ready"))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := notify.Subscribe(ctx, "jobs")
+	require.NoError(t, err)
+	listener.messages <- Message{Channel: "jobs", Payload: "ready"}
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, Message{Channel: "jobs", Payload: "ready"}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+
+	cancel()
+	for range messages {
+	}
+	assert.Equal(t, []string{"jobs"}, listener.channels)
+	assert.True(t, listener.closed)
+}
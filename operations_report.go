@@ -0,0 +1,128 @@
+package persistence
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	OperationMigrate     = "migrate"
+	OperationRollback    = "rollback"
+	OperationRollbackAll = "rollback_all"
+	OperationSeed        = "seed"
+)
+
+// OperationOutcome is the result of the latest run of an operation.
+type OperationOutcome struct {
+	Operation string
+	StartedAt time.Time
+	Duration  time.Duration
+	// Group is the migration group applied or rolled back, if any.
+	Group *migrate.MigrationGroup
+	// Items are the migrations applied or rolled back, or the fixture
+	// files loaded.
+	Items []string
+	// Skipped are the once-only fixture files already loaded.
+	Skipped []string
+	// Interrupted reports whether ctx stopped the operation between two
+	// units of work, Items then lists the units completed before.
+	Interrupted bool
+	Err         error
+}
+
+// Count returns the number of migrations or files processed.
+func (o *OperationOutcome) Count() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.Items)
+}
+
+// Succeeded reports whether the operation ran without error.
+func (o *OperationOutcome) Succeeded() bool {
+	return o != nil && o.Err == nil
+}
+
+// OperationsReport aggregates the latest Migrate, Rollback and Seed
+// outcomes. Operations that have not run are nil.
+type OperationsReport struct {
+	Migrate  *OperationOutcome
+	Rollback *OperationOutcome
+	Seed     *OperationOutcome
+}
+
+func newOperationOutcome(operation string, start time.Time, err error) *OperationOutcome {
+	return &OperationOutcome{
+		Operation:   operation,
+		StartedAt:   start,
+		Duration:    time.Since(start),
+		Interrupted: errors.Is(err, ErrInterrupted),
+		Err:         err,
+	}
+}
+
+func migrationNames(migrations migrate.MigrationSlice) []string {
+	names := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		names = append(names, migration.Name)
+	}
+	return names
+}
+
+// rolledBackNames lists a rolled back group in the order
+// its migrations were rolled back.
+func rolledBackNames(migrations migrate.MigrationSlice) []string {
+	names := migrationNames(migrations)
+	slices.Reverse(names)
+	return names
+}
+
+// LastMigrate returns the outcome of the latest Migrate call, or nil.
+func (m *Migrations) LastMigrate() *OperationOutcome {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.lastMigrate
+}
+
+// LastRollback returns the outcome of the latest Rollback or
+// RollbackAll call, or nil.
+func (m *Migrations) LastRollback() *OperationOutcome {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.lastRollback
+}
+
+func (m *Migrations) recordOutcome(outcome *OperationOutcome) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if outcome.Operation == OperationMigrate {
+		m.lastMigrate = outcome
+		return
+	}
+	m.lastRollback = outcome
+}
+
+// LastSeed returns the outcome of the latest fixture load, or nil.
+func (s *Fixtures) LastSeed() *OperationOutcome {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeed
+}
+
+func (s *Fixtures) recordOutcome(outcome *OperationOutcome, report *seedReport) {
+	outcome.Items = report.loaded
+	outcome.Skipped = report.skipped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeed = outcome
+}
+
+// seedReport collects the files processed by a single load.
+type seedReport struct {
+	loaded  []string
+	skipped []string
+}
@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_LastOutcomes(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	migrations := NewMigrations()
+	assert.Nil(t, migrations.LastMigrate())
+	assert.Nil(t, migrations.LastRollback())
+
+	migrations.RegisterSQLMigrations(fstest.MapFS{
+		"20240101000000_a.up.sql":   {Data: []byte("CREATE TABLE report_a (id INTEGER PRIMARY KEY)")},
+		"20240101000000_a.down.sql": {Data: []byte("DROP TABLE report_a")},
+		"20240102000000_b.up.sql":   {Data: []byte("CREATE TABLE report_b (id INTEGER PRIMARY KEY)")},
+		"20240102000000_b.down.sql": {Data: []byte("DROP TABLE report_b")},
+	})
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+	outcome := migrations.LastMigrate()
+	require.NotNil(t, outcome)
+	assert.True(t, outcome.Succeeded())
+	assert.Equal(t, OperationMigrate, outcome.Operation)
+	assert.Equal(t, []string{"20240101000000", "20240102000000"}, outcome.Items)
+	assert.NotNil(t, outcome.Group)
+
+	require.NoError(t, migrations.Migrate(ctx, db))
+	assert.Equal(t, 0, migrations.LastMigrate().Count())
+
+	require.NoError(t, migrations.RollbackAll(ctx, db))
+	outcome = migrations.LastRollback()
+	require.NotNil(t, outcome)
+	assert.Equal(t, OperationRollbackAll, outcome.Operation)
+	assert.Equal(t, []string{"20240102000000", "20240101000000"}, outcome.Items)
+
+	require.NoError(t, migrations.Rollback(ctx, db))
+	assert.Equal(t, OperationRollback, migrations.LastRollback().Operation)
+	assert.Equal(t, 0, migrations.LastRollback().Count())
+}
+
+func TestFixtures_LastSeed(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	db.RegisterModel((*seedHistoryItem)(nil))
+	_, err := db.NewCreateTable().Model((*seedHistoryItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	fixtures := NewSeedManager(db, WithSeedHistory(), WithFS(fstest.MapFS{
+		"items.once.yml": {Data: []byte("- model: SeedHistoryItem\n  rows:\n    - id: 1\n      name: once\n")},
+	}))
+	assert.Nil(t, fixtures.LastSeed())
+
+	require.NoError(t, fixtures.Load(ctx))
+	assert.Equal(t, []string{"items.once.yml"}, fixtures.LastSeed().Items)
+
+	require.NoError(t, fixtures.Load(ctx))
+	assert.Empty(t, fixtures.LastSeed().Items)
+	assert.Equal(t, []string{"items.once.yml"}, fixtures.LastSeed().Skipped)
+
+	require.Error(t, fixtures.LoadFile(ctx, "missing.yml"))
+	assert.False(t, fixtures.LastSeed().Succeeded())
+}
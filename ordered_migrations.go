@@ -1,7 +1,6 @@
 package persistence
 
 import (
-	"context"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -10,7 +9,6 @@ import (
 	"strings"
 
 	apierrors "github.com/goliatone/go-errors"
-	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/migrate"
 )
 
@@ -62,42 +60,38 @@ type orderedLayerIdentity struct {
 	direction orderedDirection
 }
 
-func buildOrderedMigrations(
-	ctx context.Context,
-	db *bun.DB,
-	registrations []orderedSourceRegistration,
-) ([]migrate.Migration, map[string]OrderedMigrationMetadata, error) {
-	if len(registrations) == 0 {
-		return nil, map[string]OrderedMigrationMetadata{}, nil
+// buildOrderedSource compiles the migrations of an ordered source from
+// its dialect layers.
+func buildOrderedSource(sourceIdx int, source orderedSourceRegistration, buildResult dialectBuildResult) (*discoveredSet, error) {
+	sourceMigrations, sourceMeta, err := compileOrderedSourceMigrations(source.name, sourceIdx, buildResult.fileSystems)
+	if err != nil {
+		return nil, apierrors.Wrap(err,
+			apierrors.CategoryInternal,
+			"failed to compile ordered source migrations",
+		).WithMetadata(map[string]any{"source_index": sourceIdx, "source_name": source.name})
 	}
 
-	out := make([]migrate.Migration, 0)
-	metadata := make(map[string]OrderedMigrationMetadata)
-
-	for sourceIdx, source := range registrations {
-		buildResult, err := source.registration.buildFileSystems(ctx, db)
-		if err != nil {
-			return nil, nil, apierrors.Wrap(err,
+	versions := make(map[string]migrationSource)
+	for _, layer := range buildResult.fileSystems {
+		if err := collectMigrationSources(versions, layer, source.name); err != nil {
+			return nil, apierrors.Wrap(err,
 				apierrors.CategoryInternal,
-				"failed to prepare ordered source dialect migrations",
-			).WithMetadata(map[string]any{"source_index": sourceIdx, "source_name": source.name})
-		}
-
-		sourceMigrations, sourceMeta, err := compileOrderedSourceMigrations(source.name, sourceIdx, buildResult.fileSystems)
-		if err != nil {
-			return nil, nil, apierrors.Wrap(err,
-				apierrors.CategoryInternal,
-				"failed to compile ordered source migrations",
+				"failed to read ordered source migrations",
 			).WithMetadata(map[string]any{"source_index": sourceIdx, "source_name": source.name})
 		}
+	}
 
-		out = append(out, sourceMigrations...)
-		for syntheticName, meta := range sourceMeta {
-			metadata[syntheticName] = meta
-		}
+	sources := make(map[string]migrationSource, len(sourceMeta))
+	for syntheticName, meta := range sourceMeta {
+		sources[syntheticName] = versions[meta.OriginalVersion]
 	}
 
-	return out, metadata, nil
+	return &discoveredSet{
+		migrations: sourceMigrations,
+		ordered:    true,
+		sources:    sources,
+		metadata:   sourceMeta,
+	}, nil
 }
 
 func compileOrderedSourceMigrations(
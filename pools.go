@@ -0,0 +1,139 @@
+package persistence
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// DefaultPool is the label of the pool passed to New.
+const DefaultPool = "default"
+
+// PoolConfig sets the limits of a labeled connection pool.
+type PoolConfig struct {
+	// DSN overrides the connection string, which defaults to the
+	// Config DSN (GetDSN) or server (GetServer).
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// WithPool adds a dedicated connection pool labeled name, opened on the
+// same driver as the client, so heavy work such as background jobs can
+// run with its own limits without starving request traffic. Get it with
+// Client.Pool.
+func WithPool(name string, cfg PoolConfig) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		if opts.pools == nil {
+			opts.pools = make(map[string]PoolConfig)
+		}
+		opts.pools[name] = cfg
+	}
+}
+
+// Pool returns the bun.DB of the pool labeled name, with the client
+// query hooks and registered models. Unknown labels get the default
+// pool, so code can label its work before a dedicated pool exists.
+func (c Client) Pool(name string) *bun.DB {
+	if db, ok := c.pools[name]; ok {
+		return db
+	}
+	return c.db
+}
+
+// PoolStats returns the database/sql stats of every pool by label,
+// including the default pool.
+func (c Client) PoolStats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{DefaultPool: c.sqlDB.Stats()}
+	for name, db := range c.pools {
+		stats[name] = db.DB.Stats()
+	}
+	return stats
+}
+
+func (c Client) closePools() error {
+	var errs []error
+	for _, db := range c.pools {
+		errs = append(errs, db.Close())
+		ReleaseHooks(db)
+	}
+	return errors.Join(errs...)
+}
+
+// openPools opens the labeled pools on the driver of sqlDB. Opening
+// does not connect, database/sql dials on first use.
+func openPools(cfg Config, sqlDB *sql.DB, dialect schema.Dialect, opts *clientOptions) (map[string]*bun.DB, error) {
+	pools := make(map[string]*bun.DB, len(opts.pools))
+	for name, poolCfg := range opts.pools {
+		dsn := poolCfg.DSN
+		if dsn == "" {
+			dsn = configDSN(cfg)
+		}
+		if opts.tls != nil {
+			var err error
+			if dsn, err = opts.tls.ApplyDSN(dsn); err != nil {
+				for _, open := range pools {
+					_ = open.Close()
+				}
+				return nil, err
+			}
+		}
+
+		var db *sql.DB
+		var err error
+		if opts.credentialProvider != nil {
+			db = NewCredentialConnector(sqlDB.Driver(), dsn, opts.credentialProvider, opts.credentialOptions...).OpenDB()
+		} else {
+			db, err = openPool(sqlDB.Driver(), dsn)
+		}
+		if err != nil {
+			for _, open := range pools {
+				_ = open.Close()
+			}
+			return nil, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to open connection pool").
+				WithMetadata(map[string]any{"pool": name})
+		}
+		db.SetMaxOpenConns(poolCfg.MaxOpenConns)
+		db.SetMaxIdleConns(poolCfg.MaxIdleConns)
+		db.SetConnMaxLifetime(poolCfg.ConnMaxLifetime)
+		db.SetConnMaxIdleTime(poolCfg.ConnMaxIdleTime)
+
+		pool := bun.NewDB(db, dialect)
+		applyQueryHooks(pool, cfg, opts)
+		pools[name] = pool
+	}
+	return pools, nil
+}
+
+func openPool(d driver.Driver, dsn string) (*sql.DB, error) {
+	connector, err := connectorFor(d, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// connectorFor returns the connector of dsn on d.
+func connectorFor(d driver.Driver, dsn string) (driver.Connector, error) {
+	if dc, ok := d.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return dsnConnector{driver: d, dsn: dsn}, nil
+}
+
+func configDSN(cfg Config) string {
+	if c, ok := cfg.(interface{ GetDSN() string }); ok && c.GetDSN() != "" {
+		return c.GetDSN()
+	}
+	return cfg.GetServer()
+}
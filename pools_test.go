@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestClientPools(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "pools.db")
+	sqlDB, err := sql.Open(sqliteshim.ShimName, dsn)
+	require.NoError(t, err)
+
+	recorder := NewQueryRecorder()
+	client, err := New(
+		NewConfig(WithDSN(dsn), WithPingTimeout(time.Second)),
+		sqlDB,
+		sqlitedialect.New(),
+		WithLazyConnect(),
+		WithQueryHooks(recorder),
+		WithPool("jobs", PoolConfig{MaxOpenConns: 1}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	jobs := client.Pool("jobs")
+	require.NotSame(t, client.DB(), jobs)
+	assert.Same(t, client.DB(), client.Pool("unknown"), "unknown labels use the default pool")
+
+	_, err = client.DB().ExecContext(ctx, "CREATE TABLE pool_items (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	_, err = jobs.ExecContext(ctx, "INSERT INTO pool_items (id) VALUES (1)")
+	require.NoError(t, err, "pools share the database")
+	assert.Equal(t, 2, recorder.Count(), "pools share query hooks")
+
+	stats := client.PoolStats()
+	assert.Equal(t, 1, stats["jobs"].MaxOpenConnections)
+	assert.Contains(t, stats, DefaultPool)
+}
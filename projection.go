@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/uptrace/bun"
+)
+
+// ProjectionField maps a DTO field, identified by its bun column
+// name, to the SQL expression that produces it.
+type ProjectionField struct {
+	Field string
+	Expr  string
+	Args  []any
+
+	virtual *virtualProjection
+}
+
+type virtualProjection struct {
+	source string
+	key    string
+	asJSON bool
+}
+
+// ProjectColumn maps field to a model column.
+func ProjectColumn(field, column string) ProjectionField {
+	return ProjectionField{Field: field, Expr: "?", Args: []any{bun.Ident(column)}}
+}
+
+// ProjectExpr maps field to an arbitrary SQL expression.
+func ProjectExpr(field, expr string, args ...any) ProjectionField {
+	return ProjectionField{Field: field, Expr: expr, Args: args}
+}
+
+// ProjectVirtual maps field to a key or nested path inside a JSON
+// column, see NewVirtualField.
+func ProjectVirtual(field, source, key string, asJSON bool) ProjectionField {
+	return ProjectionField{
+		Field:   field,
+		virtual: &virtualProjection{source: source, key: key, asJSON: asJSON},
+	}
+}
+
+// ProjectionRegistry maps DTO types to the columns selected for them.
+type ProjectionRegistry struct {
+	mu          sync.RWMutex
+	projections map[reflect.Type][]ProjectionField
+}
+
+// NewProjectionRegistry creates an empty registry
+func NewProjectionRegistry() *ProjectionRegistry {
+	return &ProjectionRegistry{
+		projections: make(map[reflect.Type][]ProjectionField),
+	}
+}
+
+// DefaultProjections is the registry used by ScanInto and ScanOneInto.
+var DefaultProjections = NewProjectionRegistry()
+
+// Register sets the projection for the DTO type of dst.
+//
+//	persistence.DefaultProjections.Register((*UserSummary)(nil),
+//		persistence.ProjectColumn("id", "id"),
+//		persistence.ProjectVirtual("plan", "metadata", "plan", false),
+//	)
+func (r *ProjectionRegistry) Register(dst any, fields ...ProjectionField) *ProjectionRegistry {
+	typ := modelType(reflect.TypeOf(dst))
+	if typ == nil {
+		return r
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.projections[typ] = append([]ProjectionField(nil), fields...)
+	return r
+}
+
+// Lookup returns the projection registered for the DTO type of dst.
+func (r *ProjectionRegistry) Lookup(dst any) ([]ProjectionField, bool) {
+	typ := modelType(reflect.TypeOf(dst))
+	if typ == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fields, ok := r.projections[typ]
+	return fields, ok
+}
+
+// Apply selects the projection columns for dst on q. Without a registered
+// projection the columns are derived from the DTO bun tags.
+func (r *ProjectionRegistry) Apply(q *bun.SelectQuery, dst any) *bun.SelectQuery {
+	if fields, ok := r.Lookup(dst); ok {
+		for _, field := range fields {
+			if field.virtual != nil {
+				expr := NewVirtualField(field.virtual.source, field.virtual.key)
+				expr.AsJSON = field.virtual.asJSON
+				if err := expr.Validate(); err != nil {
+					return q.Err(err)
+				}
+				q = q.ColumnExpr("? AS ?", expr, bun.Ident(field.Field))
+				continue
+			}
+			args := append(append([]any(nil), field.Args...), bun.Ident(field.Field))
+			q = q.ColumnExpr(field.Expr+" AS ?", args...)
+		}
+		return q
+	}
+
+	typ := modelType(reflect.TypeOf(dst))
+	if typ == nil {
+		return q
+	}
+	table := q.DB().Dialect().Tables().Get(typ)
+	columns := make([]string, 0, len(table.Fields))
+	for _, field := range table.Fields {
+		columns = append(columns, field.Name)
+	}
+	return q.Column(columns...)
+}
+
+// ScanInto selects only the columns needed by Dst and scans the
+// rows into a slice of Dst, avoiding full model hydration.
+func ScanInto[Dst any](ctx context.Context, q *bun.SelectQuery) ([]Dst, error) {
+	var out []Dst
+	if err := DefaultProjections.Apply(q, (*Dst)(nil)).Scan(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ScanOneInto is like ScanInto but scans a single row.
+func ScanOneInto[Dst any](ctx context.Context, q *bun.SelectQuery) (Dst, error) {
+	var out Dst
+	err := DefaultProjections.Apply(q, (*Dst)(nil)).Limit(1).Scan(ctx, &out)
+	return out, err
+}
@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type projectionAccount struct {
+	bun.BaseModel `bun:"table:projection_accounts"`
+	ID            int64   `bun:"id,pk,autoincrement"`
+	Email         string  `bun:"email"`
+	Name          string  `bun:"name"`
+	Bio           string  `bun:"bio"`
+	Metadata      JSONMap `bun:"metadata"`
+}
+
+type accountSummary struct {
+	ID    int64  `bun:"id"`
+	Email string `bun:"email"`
+}
+
+type accountPlan struct {
+	ID      int64  `bun:"id"`
+	Label   string `bun:"label"`
+	Plan    string `bun:"plan"`
+	Premium bool   `bun:"premium"`
+}
+
+func TestScanInto_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*projectionAccount)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]projectionAccount{
+		{Email: "a@example.com", Name: "A", Metadata: JSONMap{"plan": "pro"}},
+		{Email: "b@example.com", Name: "B", Metadata: JSONMap{"plan": "free"}},
+	}).Exec(ctx)
+	require.NoError(t, err)
+
+	summaries, err := ScanInto[accountSummary](ctx, db.NewSelect().Model((*projectionAccount)(nil)).Order("id"))
+	require.NoError(t, err)
+	assert.Equal(t, []accountSummary{{ID: 1, Email: "a@example.com"}, {ID: 2, Email: "b@example.com"}}, summaries)
+
+	DefaultProjections.Register((*accountPlan)(nil),
+		ProjectColumn("id", "id"),
+		ProjectExpr("label", "upper(?)", bun.Ident("name")),
+		ProjectVirtual("plan", "metadata", "plan", false),
+		ProjectExpr("premium", "? = 'pro'", bun.Safe(VirtualFieldExpr(VirtualDialectSQLite, "metadata", "plan", false))),
+	)
+
+	plan, err := ScanOneInto[accountPlan](ctx, db.NewSelect().Model((*projectionAccount)(nil)).Where("id = ?", 1))
+	require.NoError(t, err)
+	assert.Equal(t, accountPlan{ID: 1, Label: "A", Plan: "pro", Premium: true}, plan)
+
+	fields, ok := DefaultProjections.Lookup(accountPlan{})
+	assert.True(t, ok)
+	assert.Len(t, fields, 4)
+}
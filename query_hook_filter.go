@@ -0,0 +1,156 @@
+package persistence
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// QueryHookFilter reports whether a hook should run for the given query.
+type QueryHookFilter func(event *bun.QueryEvent) bool
+
+// WithQueryHookFilter registers hook with default priority, invoking it
+// only for queries accepted by filter. A nil filter accepts every query.
+func WithQueryHookFilter(hook bun.QueryHook, filter QueryHookFilter) ClientOption {
+	return WithQueryHookFilterPriority(defaultQueryHookPriority, hook, filter)
+}
+
+// WithQueryHookFilterPriority registers a filtered hook with the given priority.
+func WithQueryHookFilterPriority(priority int, hook bun.QueryHook, filter QueryHookFilter) ClientOption {
+	if filter == nil || validateQueryHook(hook) != nil {
+		return WithQueryHooksPriority(priority, hook)
+	}
+	return WithQueryHooksPriority(priority, &filteredQueryHook{hook: hook, filter: filter})
+}
+
+// FilterOperations accepts queries whose operation matches one of ops,
+// e.g. "SELECT" or "INSERT". Matching is case insensitive.
+func FilterOperations(ops ...string) QueryHookFilter {
+	set := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		set[strings.ToUpper(strings.TrimSpace(op))] = struct{}{}
+	}
+	return func(event *bun.QueryEvent) bool {
+		if event == nil {
+			return false
+		}
+		_, ok := set[strings.ToUpper(event.Operation())]
+		return ok
+	}
+}
+
+// FilterTables accepts queries targeting one of the given tables.
+func FilterTables(tables ...string) QueryHookFilter {
+	set := make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		set[strings.ToLower(strings.TrimSpace(table))] = struct{}{}
+	}
+	return func(event *bun.QueryEvent) bool {
+		if event == nil || event.IQuery == nil {
+			return false
+		}
+		table := strings.ToLower(strings.Trim(event.IQuery.GetTableName(), `"`+"`"))
+		_, ok := set[table]
+		return ok
+	}
+}
+
+// FilterModels accepts queries whose model is one of the given models.
+// Models can be passed as pointers, values or slices.
+//
+//	persistence.FilterModels((*User)(nil))
+func FilterModels(models ...any) QueryHookFilter {
+	set := make(map[reflect.Type]struct{}, len(models))
+	for _, model := range models {
+		if typ := modelType(reflect.TypeOf(model)); typ != nil {
+			set[typ] = struct{}{}
+		}
+	}
+	return func(event *bun.QueryEvent) bool {
+		if event == nil || event.IQuery == nil {
+			return false
+		}
+		model := event.IQuery.GetModel()
+		if model == nil {
+			return false
+		}
+		typ := modelType(reflect.TypeOf(model.Value()))
+		if typ == nil {
+			return false
+		}
+		_, ok := set[typ]
+		return ok
+	}
+}
+
+// NotFilter negates a filter.
+func NotFilter(filter QueryHookFilter) QueryHookFilter {
+	return func(event *bun.QueryEvent) bool {
+		return filter == nil || !filter(event)
+	}
+}
+
+// AnyFilter accepts queries accepted by at least one filter.
+func AnyFilter(filters ...QueryHookFilter) QueryHookFilter {
+	return func(event *bun.QueryEvent) bool {
+		for _, filter := range filters {
+			if filter != nil && filter(event) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func modelType(typ reflect.Type) reflect.Type {
+	for typ != nil {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			typ = typ.Elem()
+		case reflect.Struct:
+			return typ
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// filteredQueryHook only forwards events accepted by filter.
+type filteredQueryHook struct {
+	hook   bun.QueryHook
+	filter QueryHookFilter
+}
+
+func (h *filteredQueryHook) UnwrapQueryHook() bun.QueryHook {
+	return h.hook
+}
+
+// QueryHookKey dedupes filtered registrations of the same hook.
+func (h *filteredQueryHook) QueryHookKey() string {
+	key, _ := queryHookKey(h.hook)
+	return key
+}
+
+// Init forwards bun's hook initialization to the wrapped hook.
+func (h *filteredQueryHook) Init(db *bun.DB) {
+	if initer, ok := h.hook.(interface{ Init(*bun.DB) }); ok {
+		initer.Init(db)
+	}
+}
+
+func (h *filteredQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if !h.filter(event) {
+		return ctx
+	}
+	return h.hook.BeforeQuery(ctx, event)
+}
+
+func (h *filteredQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if !h.filter(event) {
+		return
+	}
+	h.hook.AfterQuery(ctx, event)
+}
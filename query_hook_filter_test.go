@@ -0,0 +1,87 @@
+package persistence
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type filterTestUser struct {
+	bun.BaseModel `bun:"table:users"`
+	ID            int64 `bun:"id,pk"`
+}
+
+func TestWithQueryHookFilter_Operations(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	hook := &countingHook{}
+
+	client, mock, cleanup := newTestClient(t, cfg, WithQueryHookFilter(hook, FilterOperations("insert")))
+	defer cleanup()
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("INSERT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	ctx := context.Background()
+	user := &filterTestUser{}
+	require.NoError(t, client.DB().NewSelect().Model(user).Where("id = 1").Scan(ctx))
+	_, err := client.DB().NewInsert().Model(&filterTestUser{}).Returning("id").Exec(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hook.before))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hook.after))
+	assert.Equal(t, []string{"*persistence.countingHook"}, hookOrderNames(getQueryHooks(client.DB())))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithQueryHookFilter_Dedupe(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	hook := &countingHook{}
+	keyed, other := &keyedHook{key: "dup"}, &keyedHook{key: "dup"}
+
+	client, mock, cleanup := newTestClient(t, cfg,
+		WithQueryHookFilter(hook, FilterOperations("select")),
+		WithQueryHookFilter(hook, FilterOperations("select")),
+		WithQueryHookFilter(keyed, FilterOperations("select")),
+		WithQueryHookFilter(other, FilterOperations("select")),
+	)
+	defer cleanup()
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+
+	var out int
+	require.NoError(t, client.DB().NewSelect().ColumnExpr("1 AS value").Scan(context.Background(), &out))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hook.before))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&keyed.before))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&other.before))
+	assert.Len(t, getQueryHooks(client.DB()), 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryHookFilters(t *testing.T) {
+	cfg := staticConfig{pingTimeout: 5 * time.Second}
+	client, _, cleanup := newTestClient(t, cfg)
+	defer cleanup()
+
+	selectUsers := &bun.QueryEvent{IQuery: client.DB().NewSelect().Model((*filterTestUser)(nil))}
+	selectOther := &bun.QueryEvent{IQuery: client.DB().NewSelect().Table("accounts")}
+	raw := &bun.QueryEvent{Query: "UPDATE accounts SET x = 1"}
+
+	assert.True(t, FilterTables("users")(selectUsers))
+	assert.False(t, FilterTables("users")(selectOther))
+	assert.False(t, FilterTables("users")(raw))
+
+	assert.True(t, FilterModels((*filterTestUser)(nil))(selectUsers))
+	assert.True(t, FilterModels([]filterTestUser{})(selectUsers))
+	assert.False(t, FilterModels((*filterTestUser)(nil))(selectOther))
+
+	assert.True(t, FilterOperations("update")(raw))
+	assert.False(t, NotFilter(FilterOperations("update"))(raw))
+	assert.True(t, AnyFilter(FilterTables("users"), FilterOperations("UPDATE"))(raw))
+	assert.False(t, AnyFilter()(raw))
+}
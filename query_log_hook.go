@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// queryLogHook logs executed queries through the client logger.
+type queryLogHook struct {
+	client *Client
+}
+
+func (h *queryLogHook) QueryHookKey() string {
+	return "query-log"
+}
+
+func (h *queryLogHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *queryLogHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	queryLgr := h.client.queryLogger()
+	if queryLgr == nil {
+		return
+	}
+
+	lgr := NewContextLogger(queryLgr)
+	duration := time.Since(event.StartTime)
+	if event.Err != nil {
+		lgr.DebugCtx(ctx, "query failed", "operation", event.Operation(), "duration", duration, "error", event.Err)
+		return
+	}
+	lgr.DebugCtx(ctx, "query executed", "operation", event.Operation(), "duration", duration)
+}
@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// UpdateGoldenEnv is the environment variable that makes
+// QueryRecorder.CompareGolden rewrite golden files instead of comparing.
+const UpdateGoldenEnv = "PERSISTENCE_UPDATE_GOLDEN"
+
+var (
+	// ErrGoldenMismatch indicates recorded SQL that differs from a golden file.
+	ErrGoldenMismatch = errors.New("persistence: recorded SQL does not match golden file")
+	// ErrQueryCountExceeded indicates more queries than expected were run.
+	ErrQueryCountExceeded = errors.New("persistence: query count exceeded")
+)
+
+// RecordedQuery is a query captured by a QueryRecorder.
+type RecordedQuery struct {
+	Operation string
+	SQL       string
+	Args      []any
+	Err       error
+}
+
+// QueryRecorderOption configures a QueryRecorder
+type QueryRecorderOption func(*QueryRecorder)
+
+// WithRecorderNormalizer rewrites SQL before it is recorded, e.g. to
+// mask generated ids or timestamps so golden files stay stable.
+func WithRecorderNormalizer(fn func(string) string) QueryRecorderOption {
+	return func(r *QueryRecorder) {
+		r.normalize = fn
+	}
+}
+
+// WithRecorderFilter records only queries accepted by filter.
+func WithRecorderFilter(filter QueryHookFilter) QueryRecorderOption {
+	return func(r *QueryRecorder) {
+		r.filter = filter
+	}
+}
+
+// QueryRecorder is a query hook that captures the rendered SQL of every
+// query, to assert it against golden files in tests and catch accidental
+// query count increases such as N+1 selects.
+//
+//	rec := persistence.NewQueryRecorder()
+//	db.AddQueryHook(rec)
+//	...
+//	require.NoError(t, rec.CompareGolden("testdata/list_users.golden"))
+//	require.NoError(t, rec.ExpectMaxQueries(2))
+type QueryRecorder struct {
+	normalize func(string) string
+	filter    QueryHookFilter
+
+	mu      sync.Mutex
+	queries []RecordedQuery
+}
+
+// NewQueryRecorder creates an empty recorder.
+func NewQueryRecorder(opts ...QueryRecorderOption) *QueryRecorder {
+	r := &QueryRecorder{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// BeforeQuery implements bun.QueryHook.
+func (r *QueryRecorder) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements bun.QueryHook.
+func (r *QueryRecorder) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if r.filter != nil && !r.filter(event) {
+		return
+	}
+	query := event.Query
+	if r.normalize != nil {
+		query = r.normalize(query)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, RecordedQuery{
+		Operation: event.Operation(),
+		SQL:       query,
+		Args:      append([]any(nil), event.QueryArgs...),
+		Err:       event.Err,
+	})
+}
+
+// Queries returns the recorded queries in execution order.
+func (r *QueryRecorder) Queries() []RecordedQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedQuery(nil), r.queries...)
+}
+
+// SQL returns the recorded SQL in execution order.
+func (r *QueryRecorder) SQL() []string {
+	queries := r.Queries()
+	out := make([]string, len(queries))
+	for i, q := range queries {
+		out[i] = q.SQL
+	}
+	return out
+}
+
+// Count returns how many queries were recorded.
+func (r *QueryRecorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queries)
+}
+
+// Reset forgets the recorded queries, e.g. after test setup.
+func (r *QueryRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = nil
+}
+
+// Golden returns the recorded SQL as golden file content, one
+// statement per line terminated by a semicolon.
+func (r *QueryRecorder) Golden() string {
+	var b strings.Builder
+	for _, query := range r.SQL() {
+		b.WriteString(query)
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// CompareGolden compares the recorded SQL with the golden file at path
+// and returns an error wrapping ErrGoldenMismatch when they differ. With
+// PERSISTENCE_UPDATE_GOLDEN set the file is written instead.
+func (r *QueryRecorder) CompareGolden(path string) error {
+	got := r.Golden()
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(got), 0o644)
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryNotFound, "failed to read golden file").
+			WithMetadata(map[string]any{"path": path, "update_env": UpdateGoldenEnv})
+	}
+	if string(want) == got {
+		return nil
+	}
+	return apierrors.Wrap(ErrGoldenMismatch, apierrors.CategoryValidation,
+		fmt.Sprintf("recorded SQL does not match %s\n--- want\n%s--- got\n%s", path, want, got),
+	).WithTextCode("GOLDEN_MISMATCH").WithMetadata(map[string]any{"path": path})
+}
+
+// ExpectMaxQueries returns an error wrapping ErrQueryCountExceeded, listing
+// the recorded SQL, when more than max queries were recorded.
+func (r *QueryRecorder) ExpectMaxQueries(max int) error {
+	sqls := r.SQL()
+	if len(sqls) <= max {
+		return nil
+	}
+	return apierrors.Wrap(ErrQueryCountExceeded, apierrors.CategoryValidation,
+		fmt.Sprintf("expected at most %d queries, got %d:\n%s", max, len(sqls), strings.Join(sqls, "\n")),
+	).WithTextCode("QUERY_COUNT_EXCEEDED").WithMetadata(map[string]any{"max": max, "count": len(sqls)})
+}
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type recordedItem struct {
+	bun.BaseModel `bun:"table:recorded_items"`
+
+	ID   int64  `bun:"id,pk,autoincrement"`
+	Name string `bun:"name"`
+}
+
+func TestQueryRecorder_Golden(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*recordedItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	digits := regexp.MustCompile(`\d+`)
+	rec := NewQueryRecorder(
+		WithRecorderNormalizer(func(s string) string { return digits.ReplaceAllString(s, "?") }),
+		WithRecorderFilter(FilterOperations("INSERT", "SELECT")),
+	)
+	db.AddQueryHook(rec)
+
+	_, err = db.NewInsert().Model(&recordedItem{Name: "a"}).Exec(ctx)
+	require.NoError(t, err)
+	var items []recordedItem
+	require.NoError(t, db.NewSelect().Model(&items).Where("id > ?", 0).Scan(ctx))
+	_, err = db.NewDelete().Model((*recordedItem)(nil)).Where("id = ?", 1).Exec(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, rec.Count())
+	assert.Equal(t, "SELECT", rec.Queries()[1].Operation)
+
+	path := filepath.Join(t.TempDir(), "items.golden")
+	require.Error(t, rec.CompareGolden(path), "missing golden file")
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	require.NoError(t, rec.CompareGolden(path))
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "recorded_items" ("name") VALUES ('a') RETURNING "id";`+"\n"+
+		`SELECT "recorded_item"."id", "recorded_item"."name" FROM "recorded_items" AS "recorded_item" WHERE (id > ?);`+"\n", string(golden))
+
+	t.Setenv(UpdateGoldenEnv, "")
+	require.NoError(t, rec.CompareGolden(path))
+
+	_, err = db.NewSelect().Model((*recordedItem)(nil)).Count(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(t, rec.CompareGolden(path), ErrGoldenMismatch)
+
+	require.NoError(t, rec.ExpectMaxQueries(3))
+	err = rec.ExpectMaxQueries(2)
+	require.ErrorIs(t, err, ErrQueryCountExceeded)
+	assert.Equal(t, "QUERY_COUNT_EXCEEDED", ErrorCode(err))
+
+	rec.Reset()
+	assert.Zero(t, rec.Count())
+}
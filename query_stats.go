@@ -0,0 +1,288 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultQueryStatsReservoir       = 512
+	defaultQueryStatsMaxFingerprints = 1000
+
+	// QueryStatsOther is the fingerprint queries are aggregated under
+	// once the fingerprint limit is reached.
+	QueryStatsOther = "<other>"
+)
+
+// FingerprintStats aggregates the queries sharing a QueryFingerprint.
+type FingerprintStats struct {
+	Fingerprint string `json:"fingerprint"`
+	Operation   string `json:"operation"`
+	// Calls estimates the executions, scaling the sampled ones by the
+	// sample rate.
+	Calls   int64 `json:"calls"`
+	Sampled int64 `json:"sampled"`
+	Errors  int64 `json:"errors"`
+	// Rows is the rows returned or affected by the sampled queries.
+	Rows  int64         `json:"rows"`
+	Total time.Duration `json:"total"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	Max   time.Duration `json:"max"`
+}
+
+// QueryStatsOption configures QueryStats
+type QueryStatsOption func(*QueryStats)
+
+// WithQueryStatsSampleRate records a fraction of the queries, between 0
+// and 1, to bound the overhead on busy services. All queries are
+// recorded by default.
+func WithQueryStatsSampleRate(rate float64) QueryStatsOption {
+	return func(s *QueryStats) {
+		if rate > 0 && rate <= 1 {
+			s.rate = rate
+		}
+	}
+}
+
+// WithQueryStatsReservoir sets the latencies kept per fingerprint to
+// estimate percentiles, 512 by default.
+func WithQueryStatsReservoir(n int) QueryStatsOption {
+	return func(s *QueryStats) {
+		if n > 0 {
+			s.reservoir = n
+		}
+	}
+}
+
+// WithQueryStatsMaxFingerprints caps the tracked fingerprints, 1000 by
+// default. Queries with new fingerprints past the cap are aggregated
+// under QueryStatsOther.
+func WithQueryStatsMaxFingerprints(n int) QueryStatsOption {
+	return func(s *QueryStats) {
+		if n > 0 {
+			s.maxFingerprints = n
+		}
+	}
+}
+
+// WithQueryStatsLogger makes Run log the top fingerprints by total time
+// at info level.
+func WithQueryStatsLogger(logger Logger, top int) QueryStatsOption {
+	return func(s *QueryStats) {
+		s.logger = logger
+		s.top = top
+	}
+}
+
+// WithQueryStatsExporter makes Run pass every snapshot to fn, e.g. to
+// publish them as metrics.
+func WithQueryStatsExporter(fn func(ctx context.Context, stats []FingerprintStats)) QueryStatsOption {
+	return func(s *QueryStats) {
+		s.exporter = fn
+	}
+}
+
+// QueryStats is a query hook aggregating call counts, rows and latency
+// percentiles per query fingerprint in process, giving
+// pg_stat_statements like insight on any dialect, SQLite included.
+//
+//	stats := persistence.NewQueryStats(persistence.WithQueryStatsSampleRate(0.1))
+//	client, _ := persistence.New(cfg, sqlDB, dialect, persistence.WithQueryHooks(stats))
+//	go stats.Run(ctx, time.Minute)
+type QueryStats struct {
+	rate            float64
+	reservoir       int
+	maxFingerprints int
+	logger          Logger
+	top             int
+	exporter        func(ctx context.Context, stats []FingerprintStats)
+
+	mu           sync.Mutex
+	fingerprints map[string]*fingerprintAggregate
+}
+
+type fingerprintAggregate struct {
+	operation string
+	sampled   int64
+	errors    int64
+	rows      int64
+	total     time.Duration
+	max       time.Duration
+	latencies []time.Duration
+}
+
+// NewQueryStats creates an empty aggregator.
+func NewQueryStats(opts ...QueryStatsOption) *QueryStats {
+	s := &QueryStats{
+		rate:            1,
+		reservoir:       defaultQueryStatsReservoir,
+		maxFingerprints: defaultQueryStatsMaxFingerprints,
+		fingerprints:    make(map[string]*fingerprintAggregate),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// BeforeQuery implements bun.QueryHook.
+func (s *QueryStats) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements bun.QueryHook.
+func (s *QueryStats) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if s.rate < 1 && rand.Float64() >= s.rate {
+		return
+	}
+	duration := time.Since(event.StartTime)
+	// fingerprint outside the lock, it is the costly part
+	fingerprint := QueryFingerprint(event.Query)
+	var rows int64
+	if event.Result != nil {
+		rows, _ = event.Result.RowsAffected()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg, ok := s.fingerprints[fingerprint]
+	if !ok {
+		if len(s.fingerprints) >= s.maxFingerprints {
+			fingerprint = QueryStatsOther
+			agg = s.fingerprints[fingerprint]
+		}
+		if agg == nil {
+			agg = &fingerprintAggregate{}
+			if fingerprint != QueryStatsOther {
+				// raw bun queries all report SELECT, read the statement instead
+				operation, _, _ := strings.Cut(fingerprint, " ")
+				agg.operation = strings.ToUpper(operation)
+			}
+			s.fingerprints[fingerprint] = agg
+		}
+	}
+
+	agg.sampled++
+	agg.rows += max(rows, 0)
+	agg.total += duration
+	agg.max = max(agg.max, duration)
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		agg.errors++
+	}
+	// reservoir sampling keeps a uniform sample of the latencies
+	if len(agg.latencies) < s.reservoir {
+		agg.latencies = append(agg.latencies, duration)
+	} else if i := rand.Int64N(agg.sampled); i < int64(s.reservoir) {
+		agg.latencies[i] = duration
+	}
+}
+
+// Snapshot returns the statistics of every fingerprint, by descending
+// total time.
+func (s *QueryStats) Snapshot() []FingerprintStats {
+	s.mu.Lock()
+	out := make([]FingerprintStats, 0, len(s.fingerprints))
+	latencies := make([][]time.Duration, 0, len(s.fingerprints))
+	for fingerprint, agg := range s.fingerprints {
+		out = append(out, FingerprintStats{
+			Fingerprint: fingerprint,
+			Operation:   agg.operation,
+			Calls:       int64(float64(agg.sampled)/s.rate + 0.5),
+			Sampled:     agg.sampled,
+			Errors:      agg.errors,
+			Rows:        agg.rows,
+			Total:       agg.total,
+			Mean:        agg.total / time.Duration(agg.sampled),
+			Max:         agg.max,
+		})
+		latencies = append(latencies, slices.Clone(agg.latencies))
+	}
+	s.mu.Unlock()
+
+	for i := range out {
+		slices.Sort(latencies[i])
+		out[i].P50 = percentile(latencies[i], 0.50)
+		out[i].P95 = percentile(latencies[i], 0.95)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total == out[j].Total {
+			return out[i].Fingerprint < out[j].Fingerprint
+		}
+		return out[i].Total > out[j].Total
+	})
+	return out
+}
+
+// Reset drops the aggregated statistics.
+func (s *QueryStats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fingerprints = make(map[string]*fingerprintAggregate)
+}
+
+// Run logs and exports a snapshot every interval, and a last one when
+// ctx is done, then returns ctx.Err().
+func (s *QueryStats) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.export(context.WithoutCancel(ctx))
+			return ctx.Err()
+		case <-ticker.C:
+			s.export(ctx)
+		}
+	}
+}
+
+func (s *QueryStats) export(ctx context.Context) {
+	if s.logger == nil && s.exporter == nil {
+		return
+	}
+	stats := s.Snapshot()
+	if s.exporter != nil {
+		s.exporter(ctx, stats)
+	}
+	if s.logger == nil {
+		return
+	}
+	for i, fs := range stats {
+		if s.top > 0 && i >= s.top {
+			break
+		}
+		s.logger.Info("query fingerprint",
+			"fingerprint", fs.Fingerprint,
+			"calls", fs.Calls,
+			"errors", fs.Errors,
+			"rows", fs.Rows,
+			"total", fs.Total,
+			"p50", fs.P50,
+			"p95", fs.P95,
+			"max", fs.Max,
+		)
+	}
+}
+
+// percentile returns the nearest rank percentile p of sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -0,0 +1,128 @@
+package persistence
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestQueryStats_AggregatesByFingerprint(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE stats_items (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+	defer db.ExecContext(ctx, `DROP TABLE stats_items`)
+
+	stats := NewQueryStats()
+	db.AddQueryHook(stats)
+
+	for i := 1; i <= 5; i++ {
+		_, err := db.NewRaw("INSERT INTO stats_items (id, name) VALUES (?, ?)", i, "item").Exec(ctx)
+		require.NoError(t, err)
+	}
+	var names []string
+	require.NoError(t, db.NewSelect().Table("stats_items").Column("name").Where("id > ?", 1).Scan(ctx, &names))
+	_, err = db.ExecContext(ctx, `SELECT * FROM stats_missing`)
+	require.Error(t, err)
+
+	snapshot := stats.Snapshot()
+	require.Len(t, snapshot, 3)
+
+	byFingerprint := map[string]FingerprintStats{}
+	for _, fs := range snapshot {
+		byFingerprint[fs.Fingerprint] = fs
+	}
+	insert, ok := byFingerprint[`insert into stats_items (id, name) values (?)`]
+	require.True(t, ok, "fingerprints: %v", snapshot)
+	assert.Equal(t, "INSERT", insert.Operation)
+	assert.Equal(t, int64(5), insert.Calls)
+	assert.Equal(t, int64(5), insert.Rows)
+	assert.Positive(t, insert.P50)
+	assert.LessOrEqual(t, insert.P50, insert.P95)
+	assert.LessOrEqual(t, insert.P95, insert.Max)
+
+	selected := byFingerprint[`select "name" from "stats_items" where (id > ?)`]
+	assert.Equal(t, int64(1), selected.Calls)
+	assert.Equal(t, int64(4), selected.Rows)
+
+	failed := byFingerprint[`select * from stats_missing`]
+	assert.Equal(t, int64(1), failed.Errors)
+
+	for i := 1; i < len(snapshot); i++ {
+		assert.GreaterOrEqual(t, snapshot[i-1].Total, snapshot[i].Total)
+	}
+
+	stats.Reset()
+	assert.Empty(t, stats.Snapshot())
+}
+
+func TestQueryStats_SamplingAndLimits(t *testing.T) {
+	stats := NewQueryStats(WithQueryStatsSampleRate(0.5), WithQueryStatsMaxFingerprints(2), WithQueryStatsReservoir(4))
+	for i := 0; i < 2000; i++ {
+		stats.AfterQuery(context.Background(), &bun.QueryEvent{
+			Query:     []string{"SELECT 1", "SELECT * FROM a WHERE id = 1", "SELECT * FROM b"}[i%3],
+			StartTime: time.Now().Add(-time.Millisecond),
+		})
+	}
+
+	snapshot := stats.Snapshot()
+	require.Len(t, snapshot, 3, "two fingerprints and the overflow")
+	var calls, sampled int64
+	for _, fs := range snapshot {
+		calls += fs.Calls
+		sampled += fs.Sampled
+	}
+	assert.InDelta(t, 2000, calls, 200, "calls are scaled by the sample rate")
+	assert.InDelta(t, 1000, sampled, 200)
+	assert.Len(t, stats.fingerprints[snapshot[0].Fingerprint].latencies, 4)
+
+	var fingerprints []string
+	for _, fs := range snapshot {
+		fingerprints = append(fingerprints, fs.Fingerprint)
+	}
+	assert.Contains(t, fingerprints, QueryStatsOther)
+}
+
+func TestQueryStats_Run(t *testing.T) {
+	logs := &recordingLogger{}
+	exported := make(chan []FingerprintStats, 1)
+	stats := NewQueryStats(
+		WithQueryStatsLogger(logs, 1),
+		WithQueryStatsExporter(func(_ context.Context, s []FingerprintStats) {
+			select {
+			case exported <- s:
+			default:
+			}
+		}),
+	)
+	stats.AfterQuery(context.Background(), &bun.QueryEvent{Query: "SELECT 1", StartTime: time.Now()})
+	stats.AfterQuery(context.Background(), &bun.QueryEvent{Query: "SELECT 2 + 2", StartTime: time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, stats.Run(ctx, time.Hour), context.Canceled)
+
+	select {
+	case s := <-exported:
+		assert.Len(t, s, 2)
+	default:
+		t.Fatal("snapshot not exported")
+	}
+	lines := logs.Lines()
+	require.Len(t, lines, 1, "only the top fingerprint is logged")
+	assert.True(t, strings.HasPrefix(lines[0], "INFO query fingerprint"))
+}
+
+func TestPercentile(t *testing.T) {
+	values := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Duration(5), percentile(values, 0.5))
+	assert.Equal(t, time.Duration(10), percentile(values, 0.95))
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.5))
+}
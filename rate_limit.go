@@ -0,0 +1,166 @@
+package persistence
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// RateLimitBucket is the token bucket state of one key in the
+// rate_limits table. UpdatedMs is the unix time in milliseconds of the
+// last refill, kept as an integer so the refill is portable SQL.
+type RateLimitBucket struct {
+	bun.BaseModel `bun:"table:rate_limits"`
+
+	Bucket    string  `bun:"bucket,pk"`
+	Tokens    float64 `bun:"tokens,notnull"`
+	UpdatedMs int64   `bun:"updated_ms,notnull"`
+}
+
+// RateLimitMigrationFS returns up and down migrations for the
+// rate_limits table, named <version>_rate_limits.
+func RateLimitMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "rate_limits", (*RateLimitBucket)(nil))
+}
+
+// RateLimitResult is the outcome of a rate limit check.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of tokens left in the bucket.
+	Remaining float64
+	// RetryAfter is how long until the request would be allowed, zero
+	// when it was allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimiter is a token bucket limiter keyed by arbitrary strings and
+// stored in the database, for per key throttling shared between
+// instances when no Redis is available. Each check is a single
+// conditional UPDATE that refills and takes tokens atomically.
+type RateLimiter struct {
+	db    bun.IDB
+	rate  float64
+	burst float64
+	now   func() time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second
+// with bursts of up to burst requests. The rate_limits table must exist,
+// see RateLimitMigrationFS.
+func NewRateLimiter(db bun.IDB, rate float64, burst int) *RateLimiter {
+	return &RateLimiter{db: db, rate: rate, burst: float64(burst), now: time.Now}
+}
+
+// Allow takes one token from the bucket of key.
+func (l *RateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN takes n tokens from the bucket of key if available. The bucket
+// is left untouched when the request is not allowed.
+func (l *RateLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	now := l.now().UnixMilli()
+	cost := float64(n)
+	least := "LEAST"
+	if l.db.Dialect().Name() == dialect.SQLite {
+		least = "MIN"
+	}
+	refill := least + "(?, tokens + (? - updated_ms) * ?)"
+	perMs := l.rate / 1000
+
+	var result RateLimitResult
+	err := RunInTx(ctx, l.db, func(ctx context.Context, tx bun.Tx) error {
+		insert := tx.NewInsert().Model(&RateLimitBucket{Bucket: key, Tokens: l.burst, UpdatedMs: now})
+		if tx.Dialect().Name() == dialect.MySQL {
+			insert = insert.Ignore()
+		} else {
+			insert = insert.On("CONFLICT DO NOTHING")
+		}
+		if _, err := insert.Exec(ctx); err != nil {
+			return err
+		}
+
+		res, err := tx.NewUpdate().
+			Model((*RateLimitBucket)(nil)).
+			Set("tokens = "+refill+" - ?", l.burst, now, perMs, cost).
+			Set("updated_ms = ?", now).
+			Where("bucket = ?", key).
+			Where(refill+" >= ?", l.burst, now, perMs, cost).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		result.Allowed = affected > 0
+
+		var bucket RateLimitBucket
+		if err := tx.NewSelect().Model(&bucket).Where("bucket = ?", key).Scan(ctx); err != nil {
+			return err
+		}
+		result.Remaining = bucket.Tokens
+		if !result.Allowed {
+			available := math.Min(l.burst, bucket.Tokens+float64(now-bucket.UpdatedMs)*perMs)
+			result.Remaining = available
+			if l.rate > 0 {
+				wait := (cost - available) / l.rate
+				result.RetryAfter = time.Duration(math.Ceil(wait*1000)) * time.Millisecond
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return RateLimitResult{}, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to check rate limit").
+			WithMetadata(map[string]any{"bucket": key})
+	}
+	return result, nil
+}
+
+// Cleanup deletes buckets idle long enough to be full again, which
+// behave exactly like missing buckets, and returns how many were removed.
+func (l *RateLimiter) Cleanup(ctx context.Context) (int64, error) {
+	if l.rate <= 0 {
+		return 0, nil
+	}
+	idle := int64(math.Ceil(l.burst / l.rate * 1000))
+	cutoff := l.now().UnixMilli() - idle
+	res, err := l.db.NewDelete().Model((*RateLimitBucket)(nil)).Where("updated_ms <= ?", cutoff).Exec(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to clean up rate limits")
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// StartCleanup runs Cleanup every interval until ctx is done or the
+// returned stop function is called. Errors are passed to onError when
+// it is not nil.
+func (l *RateLimiter) StartCleanup(ctx context.Context, interval time.Duration, onError func(error)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := l.Cleanup(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(RateLimitMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+
+	now := time.UnixMilli(1_700_000_000_000)
+	limiter := NewRateLimiter(db, 2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := range 3 {
+		result, err := limiter.Allow(ctx, "ip:1")
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "request %d", i)
+	}
+
+	result, err := limiter.Allow(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	other, err := limiter.Allow(ctx, "ip:2")
+	require.NoError(t, err)
+	assert.True(t, other.Allowed, "buckets are per key")
+	assert.InDelta(t, 2, other.Remaining, 0.001)
+
+	now = now.Add(500 * time.Millisecond)
+	result, err = limiter.Allow(ctx, "ip:1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.InDelta(t, 0, result.Remaining, 0.001)
+
+	result, err = limiter.AllowN(ctx, "ip:1", 5)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "requests above the burst never pass")
+
+	now = now.Add(time.Second)
+	removed, err := limiter.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed, "only the bucket idle for burst/rate is removed")
+
+	now = now.Add(500 * time.Millisecond)
+	removed, err = limiter.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+}
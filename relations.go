@@ -0,0 +1,129 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrUnknownRelation indicates a preloaded relation is not declared on the model.
+var ErrUnknownRelation = errors.New("persistence: unknown relation")
+
+// RelationSpec describes a relation to preload, with optional
+// filters, order and nested relations.
+type RelationSpec struct {
+	// Name is the relation field name, e.g. "Author". Dotted paths
+	// such as "Author.Profile" are expanded into nested specs.
+	Name      string
+	Where     []Criteria
+	Order     []string
+	Relations []RelationSpec
+}
+
+// Rel returns a spec for the named relation with nested relations.
+func Rel(name string, nested ...RelationSpec) RelationSpec {
+	return RelationSpec{Name: name, Relations: nested}
+}
+
+// With returns specs for relation names, dotted paths included.
+func With(relations ...string) []RelationSpec {
+	specs := make([]RelationSpec, 0, len(relations))
+	for _, name := range relations {
+		specs = append(specs, Rel(name))
+	}
+	return specs
+}
+
+// Filter adds a condition applied to the relation query.
+func (r RelationSpec) Filter(expr string, args ...any) RelationSpec {
+	r.Where = append(slices.Clone(r.Where), Criteria{Expr: expr, Args: args})
+	return r
+}
+
+// OrderBy adds order expressions applied to the relation query.
+func (r RelationSpec) OrderBy(order ...string) RelationSpec {
+	r.Order = append(slices.Clone(r.Order), order...)
+	return r
+}
+
+// Preload adds the relations to q, validating every name against the
+// relations registered for the query model so typos fail before the
+// query runs. Errors wrap ErrUnknownRelation.
+func Preload(q *bun.SelectQuery, relations ...RelationSpec) (*bun.SelectQuery, error) {
+	if q.GetModel() == nil {
+		return nil, apierrors.New("preload requires a query with a model", apierrors.CategoryBadInput)
+	}
+	typ := modelType(reflect.TypeOf(q.GetModel().Value()))
+	if typ == nil {
+		return nil, apierrors.New("preload requires a struct model", apierrors.CategoryBadInput)
+	}
+	table := q.DB().Dialect().Tables().Get(typ)
+
+	for _, spec := range relations {
+		var err error
+		if q, err = preloadRelation(q, table, "", spec); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func preloadRelation(q *bun.SelectQuery, table *schema.Table, prefix string, spec RelationSpec) (*bun.SelectQuery, error) {
+	name, rest, nested := strings.Cut(spec.Name, ".")
+	if nested {
+		outer := RelationSpec{Name: name, Relations: []RelationSpec{{
+			Name:      rest,
+			Where:     spec.Where,
+			Order:     spec.Order,
+			Relations: spec.Relations,
+		}}}
+		return preloadRelation(q, table, prefix, outer)
+	}
+
+	rel, ok := table.Relations[name]
+	if !ok {
+		available := make([]string, 0, len(table.Relations))
+		for relName := range table.Relations {
+			available = append(available, relName)
+		}
+		slices.Sort(available)
+		return nil, apierrors.Wrap(ErrUnknownRelation, apierrors.CategoryBadInput,
+			fmt.Sprintf("%s has no relation %q", table.TypeName, name),
+		).WithMetadata(map[string]any{
+			"model":     table.TypeName,
+			"relation":  prefix + name,
+			"available": available,
+		})
+	}
+
+	path := prefix + name
+	if len(spec.Where) == 0 && len(spec.Order) == 0 {
+		q = q.Relation(path)
+	} else {
+		q = q.Relation(path, func(sq *bun.SelectQuery) *bun.SelectQuery {
+			for _, criteria := range spec.Where {
+				if !criteria.IsZero() {
+					sq = sq.Where(criteria.Expr, criteria.Args...)
+				}
+			}
+			if len(spec.Order) > 0 {
+				sq = sq.Order(spec.Order...)
+			}
+			return sq
+		})
+	}
+
+	for _, child := range spec.Relations {
+		var err error
+		if q, err = preloadRelation(q, rel.JoinTable, path+".", child); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,90 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type relProfile struct {
+	bun.BaseModel `bun:"table:rel_profiles"`
+	ID            int64  `bun:"id,pk"`
+	Bio           string `bun:"bio"`
+}
+
+type relAuthor struct {
+	bun.BaseModel `bun:"table:rel_authors"`
+	ID            int64       `bun:"id,pk"`
+	Name          string      `bun:"name"`
+	ProfileID     int64       `bun:"profile_id"`
+	Profile       *relProfile `bun:"rel:belongs-to,join:profile_id=id"`
+	Posts         []*relPost  `bun:"rel:has-many,join:id=author_id"`
+}
+
+type relPost struct {
+	bun.BaseModel `bun:"table:rel_posts"`
+	ID            int64      `bun:"id,pk"`
+	AuthorID      int64      `bun:"author_id"`
+	Title         string     `bun:"title"`
+	Published     bool       `bun:"published"`
+	Author        *relAuthor `bun:"rel:belongs-to,join:author_id=id"`
+}
+
+func TestPreload(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	for _, model := range []any{(*relProfile)(nil), (*relAuthor)(nil), (*relPost)(nil)} {
+		_, err := db.NewCreateTable().Model(model).Exec(ctx)
+		require.NoError(t, err)
+	}
+	_, err := db.NewInsert().Model(&relProfile{ID: 1, Bio: "bio"}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&relAuthor{ID: 1, Name: "ann", ProfileID: 1}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]relPost{
+		{ID: 1, AuthorID: 1, Title: "b", Published: true},
+		{ID: 2, AuthorID: 1, Title: "draft", Published: false},
+		{ID: 3, AuthorID: 1, Title: "a", Published: true},
+	}).Exec(ctx)
+	require.NoError(t, err)
+
+	var author relAuthor
+	q, err := Preload(db.NewSelect().Model(&author).Where("?TableAlias.id = 1"),
+		Rel("Posts").Filter("published = ?", true).OrderBy("title ASC"),
+		Rel("Profile"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, q.Scan(ctx))
+
+	require.NotNil(t, author.Profile)
+	assert.Equal(t, "bio", author.Profile.Bio)
+	require.Len(t, author.Posts, 2)
+	assert.Equal(t, "a", author.Posts[0].Title)
+	assert.Equal(t, "b", author.Posts[1].Title)
+
+	var posts []relPost
+	q, err = Preload(db.NewSelect().Model(&posts).OrderExpr("?TableAlias.id"), With("Author.Profile")...)
+	require.NoError(t, err)
+	require.NoError(t, q.Scan(ctx))
+	require.Len(t, posts, 3)
+	require.NotNil(t, posts[0].Author)
+	require.NotNil(t, posts[0].Author.Profile)
+	assert.Equal(t, "bio", posts[0].Author.Profile.Bio)
+}
+
+func TestPreload_UnknownRelation(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := Preload(db.NewSelect().Model((*relAuthor)(nil)), With("Post")...)
+	require.ErrorIs(t, err, ErrUnknownRelation)
+	assert.Contains(t, err.Error(), `RelAuthor has no relation "Post"`)
+
+	_, err = Preload(db.NewSelect().Model((*relPost)(nil)), With("Author.Profil")...)
+	require.ErrorIs(t, err, ErrUnknownRelation)
+}
@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/uptrace/bun"
+)
+
+// ReplicaPool is the label of the read replica pool.
+const ReplicaPool = "replica"
+
+// WithReadReplica opens a pool labeled "replica" on the replica DSN and
+// enables read routing, see Client.ReadDB.
+func WithReadReplica(cfg PoolConfig) ClientOption {
+	return func(o *clientOptions) {
+		if o == nil {
+			return
+		}
+		WithPool(ReplicaPool, cfg)(o)
+		o.replicaRouting = true
+	}
+}
+
+type pinPrimaryKey struct{}
+
+type readYourWritesKey struct{}
+
+// PinPrimary returns a context whose reads go to the primary.
+func PinPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinPrimaryKey{}, true)
+}
+
+// WithReadYourWrites scopes ctx to a request, usually in a middleware:
+// once a write runs with the context, or one derived from it, later
+// reads with it go to the primary, so the request sees its own writes
+// despite replication lag.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(readYourWritesKey{}).(*atomic.Bool); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, readYourWritesKey{}, new(atomic.Bool))
+}
+
+// IsPinnedPrimary reports whether reads with ctx go to the primary:
+// after PinPrimary, inside a transaction, or after a write in a
+// WithReadYourWrites scope.
+func IsPinnedPrimary(ctx context.Context) bool {
+	if pinned, _ := ctx.Value(pinPrimaryKey{}).(bool); pinned {
+		return true
+	}
+	if _, ok := TxFromContext(ctx); ok {
+		return true
+	}
+	wrote, ok := ctx.Value(readYourWritesKey{}).(*atomic.Bool)
+	return ok && wrote.Load()
+}
+
+// ReadDB returns the database for reads with ctx: the transaction in
+// ctx, the primary when ctx is pinned, and the replica otherwise.
+// Without WithReadReplica it returns the primary.
+//
+//	err := client.ReadDB(ctx).NewSelect().Model(&users).Scan(ctx)
+func (c Client) ReadDB(ctx context.Context) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	if IsPinnedPrimary(ctx) {
+		return c.db
+	}
+	if replica, ok := c.pools[ReplicaPool]; ok {
+		return replica
+	}
+	return c.db
+}
+
+// writeTrackingHook marks the WithReadYourWrites scope of write queries.
+type writeTrackingHook struct{}
+
+// BeforeQuery implements bun.QueryHook.
+func (writeTrackingHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	wrote, ok := ctx.Value(readYourWritesKey{}).(*atomic.Bool)
+	if !ok || wrote.Load() {
+		return ctx
+	}
+	switch strings.ToUpper(event.Operation()) {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN", "PRAGMA", "SET", "BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT", "RELEASE":
+	default:
+		wrote.Store(true)
+	}
+	return ctx
+}
+
+// AfterQuery implements bun.QueryHook.
+func (writeTrackingHook) AfterQuery(context.Context, *bun.QueryEvent) {}
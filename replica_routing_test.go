@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestClientReadDB(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := "file:" + filepath.Join(dir, "primary.db")
+	sqlDB, err := sql.Open(sqliteshim.ShimName, dsn)
+	require.NoError(t, err)
+
+	client, err := New(
+		NewConfig(WithDSN(dsn), WithPingTimeout(time.Second)),
+		sqlDB,
+		// sqlite files stand in for a replicated database, the postgres
+		// dialect keeps ValidateConfig from rejecting the replica
+		pgdialect.New(),
+		WithLazyConnect(),
+		WithReadReplica(PoolConfig{DSN: "file:" + filepath.Join(dir, "replica.db")}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	replica := client.Pool(ReplicaPool)
+	require.NotSame(t, client.DB(), replica)
+	assert.Same(t, replica, client.ReadDB(ctx))
+	assert.Same(t, client.DB(), client.ReadDB(PinPrimary(ctx)))
+	assert.False(t, IsPinnedPrimary(ctx))
+
+	reqCtx := WithReadYourWrites(ctx)
+	assert.Same(t, reqCtx, WithReadYourWrites(reqCtx))
+	_, err = client.DB().NewRaw("SELECT 1").Exec(reqCtx)
+	require.NoError(t, err)
+	assert.Same(t, replica, client.ReadDB(reqCtx), "reads do not pin")
+
+	_, err = client.DB().ExecContext(reqCtx, "CREATE TABLE routed_items (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	assert.True(t, IsPinnedPrimary(reqCtx))
+	assert.Same(t, client.DB(), client.ReadDB(reqCtx), "reads after a write go to the primary")
+	assert.Same(t, replica, client.ReadDB(WithReadYourWrites(ctx)), "other requests still use the replica")
+
+	err = client.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		assert.Equal(t, tx, client.ReadDB(ctx))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestClientReadDB_WithoutReplica(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	client := Client{db: db}
+	assert.Same(t, db, client.ReadDB(context.Background()))
+}
@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrReturningModel indicates a model that cannot be reloaded without
+// RETURNING support, i.e. anything but a single struct pointer with
+// a primary key.
+var ErrReturningModel = errors.New("persistence: returning fallback requires a struct pointer with a primary key")
+
+// InsertReturning inserts model and populates generated columns. It uses
+// INSERT ... RETURNING where supported and otherwise falls back to
+// LastInsertId plus a select by primary key.
+func InsertReturning(ctx context.Context, db bun.IDB, model any) error {
+	if db.Dialect().Features().Has(feature.InsertReturning) {
+		_, err := db.NewInsert().Model(model).Returning("*").Exec(ctx)
+		return err
+	}
+
+	value, table, err := returningTarget(db, model)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.NewInsert().Model(model).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(table.PKs) == 1 {
+		pk := table.PKs[0].Value(value)
+		if pk.IsZero() && pk.CanSet() {
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			switch pk.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				pk.SetInt(id)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				pk.SetUint(uint64(id))
+			}
+		}
+	}
+
+	return db.NewSelect().Model(model).WherePK().Scan(ctx)
+}
+
+// UpdateReturning updates model by primary key and populates columns
+// changed by the database, e.g. triggers or defaults. It uses
+// UPDATE ... RETURNING where supported and otherwise re-selects the row.
+func UpdateReturning(ctx context.Context, db bun.IDB, model any) error {
+	if db.Dialect().Features().Has(feature.Returning) {
+		_, err := db.NewUpdate().Model(model).WherePK().Returning("*").Exec(ctx)
+		return err
+	}
+
+	if _, _, err := returningTarget(db, model); err != nil {
+		return err
+	}
+	if _, err := db.NewUpdate().Model(model).WherePK().Exec(ctx); err != nil {
+		return err
+	}
+	return db.NewSelect().Model(model).WherePK().Scan(ctx)
+}
+
+func returningTarget(db bun.IDB, model any) (reflect.Value, *schema.Table, error) {
+	value := reflect.ValueOf(model)
+	if !value.IsValid() || value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, ErrReturningModel
+	}
+	table := db.Dialect().Tables().Get(value.Type().Elem())
+	if len(table.PKs) == 0 {
+		return reflect.Value{}, nil, ErrReturningModel
+	}
+	return value.Elem(), table, nil
+}
@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/schema"
+)
+
+type returningTicket struct {
+	bun.BaseModel `bun:"table:returning_tickets"`
+	ID            int64  `bun:"id,pk,autoincrement"`
+	Title         string `bun:"title"`
+	Status        string `bun:"status,nullzero,default:'open'"`
+}
+
+// noReturningDialect hides RETURNING support to exercise fallbacks.
+type noReturningDialect struct {
+	schema.Dialect
+}
+
+func (d noReturningDialect) Features() feature.Feature {
+	return d.Dialect.Features().Remove(feature.InsertReturning | feature.Returning)
+}
+
+func TestInsertReturning(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*returningTicket)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	native := &returningTicket{Title: "native"}
+	require.NoError(t, InsertReturning(ctx, db, native))
+	assert.Equal(t, int64(1), native.ID)
+	assert.Equal(t, "open", native.Status)
+
+	fallbackDB := bun.NewDB(db.DB, noReturningDialect{Dialect: db.Dialect()})
+	fallback := &returningTicket{Title: "fallback"}
+	require.NoError(t, InsertReturning(ctx, fallbackDB, fallback))
+	assert.Equal(t, int64(2), fallback.ID)
+	assert.Equal(t, "open", fallback.Status)
+
+	fallback.Title = "updated"
+	require.NoError(t, UpdateReturning(ctx, fallbackDB, fallback))
+	assert.Equal(t, "updated", fallback.Title)
+
+	assert.ErrorIs(t, InsertReturning(ctx, fallbackDB, &[]returningTicket{}), ErrReturningModel)
+}
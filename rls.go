@@ -0,0 +1,292 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// DefaultRLSClaimsSetting is the setting RLS stores request claims in.
+const DefaultRLSClaimsSetting = "app.claims"
+
+// ErrRLSUnsupported indicates row-level security on a dialect other
+// than Postgres.
+var ErrRLSUnsupported = errors.New("persistence: row-level security requires postgres")
+
+// RLSPolicy is a row-level security policy. Using filters visible and
+// modified rows, Check validates inserted and updated rows.
+type RLSPolicy struct {
+	Name string
+	// Command is ALL, SELECT, INSERT, UPDATE or DELETE, ALL by default.
+	Command string
+	// Roles the policy applies to, PUBLIC by default.
+	Roles []string
+	Using string
+	Check string
+	// Restrictive policies are AND-ed with the permissive ones.
+	Restrictive bool
+}
+
+// Validate checks the policy name, command, roles and expressions.
+func (p RLSPolicy) Validate() error {
+	if err := ValidateIdentifier(p.Name); err != nil {
+		return err
+	}
+	switch strings.ToUpper(p.Command) {
+	case "", "ALL", "SELECT", "INSERT", "UPDATE", "DELETE":
+	default:
+		return apierrors.New("invalid row-level security policy command", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"policy": p.Name, "command": p.Command})
+	}
+	for _, role := range p.Roles {
+		if err := ValidateIdentifier(role); err != nil {
+			return err
+		}
+	}
+	if p.Using == "" && p.Check == "" {
+		return apierrors.New("row-level security policy needs a USING or WITH CHECK expression", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"policy": p.Name})
+	}
+	for _, expr := range []string{p.Using, p.Check} {
+		if err := ValidateExpression(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RLSOption configures RLS
+type RLSOption func(*RLS)
+
+// WithRLSForce also applies the policies to the table owner, which
+// bypasses them otherwise.
+func WithRLSForce() RLSOption {
+	return func(r *RLS) {
+		r.force = true
+	}
+}
+
+// WithRLSClaimsSetting sets the setting claims are stored in,
+// app.claims by default. It must be a two part name.
+func WithRLSClaimsSetting(setting string) RLSOption {
+	return func(r *RLS) {
+		if setting != "" {
+			r.setting = setting
+		}
+	}
+}
+
+// RLS manages Postgres row-level security: it enables policies on model
+// tables and scopes transactions to the role and claims of a request,
+// so tenancy holds even when a query forgets its tenant filter.
+type RLS struct {
+	db      *bun.DB
+	force   bool
+	setting string
+}
+
+// NewRLS creates a row-level security manager for db.
+func NewRLS(db *bun.DB, opts ...RLSOption) *RLS {
+	r := &RLS{db: db, setting: DefaultRLSClaimsSetting}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// Claim returns the SQL expression reading claim key of the request,
+// as text, for policy expressions:
+//
+//	persistence.RLSPolicy{Name: "tenant_isolation", Using: "tenant_id::text = " + rls.Claim("tenant_id")}
+func (r *RLS) Claim(key string) string {
+	return fmt.Sprintf("(current_setting('%s', true)::jsonb ->> '%s')", r.setting, strings.ReplaceAll(key, "'", "''"))
+}
+
+func (r *RLS) check() error {
+	if r.db.Dialect().Name() != dialect.PG {
+		return apierrors.Wrap(ErrRLSUnsupported, apierrors.CategoryBadInput, "row-level security requires postgres").
+			WithMetadata(map[string]any{"dialect": r.db.Dialect().Name().String()})
+	}
+	return ValidateIdentifier(r.setting)
+}
+
+// UpSQL returns the statements enabling row-level security on the
+// table of model and creating the policies.
+func (r *RLS) UpSQL(model any, policies ...RLSPolicy) ([]string, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	table := bun.Safe(r.db.Table(reflect.TypeOf(model)).SQLName)
+
+	stmts := []string{r.format("ALTER TABLE ? ENABLE ROW LEVEL SECURITY", table)}
+	if r.force {
+		stmts = append(stmts, r.format("ALTER TABLE ? FORCE ROW LEVEL SECURITY", table))
+	}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		kind, command := "PERMISSIVE", strings.ToUpper(p.Command)
+		if p.Restrictive {
+			kind = "RESTRICTIVE"
+		}
+		if command == "" {
+			command = "ALL"
+		}
+		roles := []string{"PUBLIC"}
+		if len(p.Roles) > 0 {
+			roles = roles[:0]
+			for _, role := range p.Roles {
+				roles = append(roles, r.format("?", bun.Ident(role)))
+			}
+		}
+
+		stmt := r.format("CREATE POLICY ? ON ? AS ? FOR ? TO ?", bun.Ident(p.Name), table,
+			bun.Safe(kind), bun.Safe(command), bun.Safe(strings.Join(roles, ", ")))
+		if p.Using != "" {
+			stmt += " USING (" + p.Using + ")"
+		}
+		if p.Check != "" {
+			stmt += " WITH CHECK (" + p.Check + ")"
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// DownSQL returns the statements dropping the policies and disabling
+// row-level security.
+func (r *RLS) DownSQL(model any, policies ...RLSPolicy) ([]string, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	table := bun.Safe(r.db.Table(reflect.TypeOf(model)).SQLName)
+
+	var stmts []string
+	for i := len(policies) - 1; i >= 0; i-- {
+		if err := ValidateIdentifier(policies[i].Name); err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, r.format("DROP POLICY IF EXISTS ? ON ?", bun.Ident(policies[i].Name), table))
+	}
+	if r.force {
+		stmts = append(stmts, r.format("ALTER TABLE ? NO FORCE ROW LEVEL SECURITY", table))
+	}
+	return append(stmts, r.format("ALTER TABLE ? DISABLE ROW LEVEL SECURITY", table)), nil
+}
+
+func (r *RLS) format(query string, args ...any) string {
+	return string(schema.NewQueryGen(r.db.Dialect()).AppendQuery(nil, query, args...))
+}
+
+// MigrationFS returns UpSQL and DownSQL as a migration named
+// <version>_<name>, to register with RegisterSQLMigrations.
+func (r *RLS) MigrationFS(version, name string, model any, policies ...RLSPolicy) (fstest.MapFS, error) {
+	up, err := r.UpSQL(model, policies...)
+	if err != nil {
+		return nil, err
+	}
+	down, err := r.DownSQL(model, policies...)
+	if err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("%s_%s", version, name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: []byte(strings.Join(up, ";\n") + ";\n")},
+		base + ".down.sql": {Data: []byte(strings.Join(down, ";\n") + ";\n")},
+	}, nil
+}
+
+// Enable applies UpSQL in one transaction. Prefer MigrationFS when the
+// schema is managed with migrations.
+func (r *RLS) Enable(ctx context.Context, model any, policies ...RLSPolicy) error {
+	stmts, err := r.UpSQL(model, policies...)
+	if err != nil {
+		return err
+	}
+	return RunInTx(ctx, IDBFromContext(ctx, r.db), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to enable row-level security").
+					WithMetadata(map[string]any{"statement": stmt})
+			}
+		}
+		return nil
+	})
+}
+
+// RLSSession is the database role and claims of a request.
+type RLSSession struct {
+	// Role is switched to with SET LOCAL ROLE when set.
+	Role   string
+	Claims map[string]any
+}
+
+type rlsContextKey struct{}
+
+// ContextWithRLSSession stores the request session in ctx, usually from
+// an authentication middleware.
+func ContextWithRLSSession(ctx context.Context, session RLSSession) context.Context {
+	return context.WithValue(ctx, rlsContextKey{}, session)
+}
+
+// RLSSessionFromContext returns the session stored with
+// ContextWithRLSSession.
+func RLSSessionFromContext(ctx context.Context) (RLSSession, bool) {
+	session, ok := ctx.Value(rlsContextKey{}).(RLSSession)
+	return session, ok
+}
+
+// Apply sets the role and claims of the session in ctx for the rest of
+// tx, with SET LOCAL semantics, so they reset on commit or rollback.
+// Without a session it does nothing.
+func (r *RLS) Apply(ctx context.Context, tx bun.Tx) error {
+	session, ok := RLSSessionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if err := r.check(); err != nil {
+		return err
+	}
+	if session.Role != "" {
+		if err := ValidateIdentifier(session.Role); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL ROLE ?", bun.Ident(session.Role)); err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to set row-level security role")
+		}
+	}
+	claims, err := json.Marshal(session.Claims)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to encode row-level security claims")
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT set_config(?, ?, true)", r.setting, string(claims)); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to set row-level security claims")
+	}
+	return nil
+}
+
+// RunInTx runs fn in a transaction scoped to the session in ctx, see
+// Apply. fn gets a context carrying the transaction.
+func (r *RLS) RunInTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	if fn == nil {
+		return ErrTxFuncNil
+	}
+	return RunInTx(ctx, IDBFromContext(ctx, r.db), func(ctx context.Context, tx bun.Tx) error {
+		if err := r.Apply(ctx, tx); err != nil {
+			return err
+		}
+		return fn(ContextWithTx(ctx, tx), tx)
+	})
+}
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type rlsDocument struct {
+	bun.BaseModel `bun:"table:rls_documents"`
+
+	ID       int64  `bun:"id,pk"`
+	TenantID string `bun:"tenant_id"`
+}
+
+func TestRLS_MigrationFS(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	rls := NewRLS(db, WithRLSForce())
+	policy := RLSPolicy{
+		Name:  "tenant_isolation",
+		Roles: []string{"app_rw"},
+		Using: "tenant_id = " + rls.Claim("tenant_id"),
+		Check: "tenant_id = " + rls.Claim("tenant_id"),
+	}
+	fsys, err := rls.MigrationFS("20240101000000", "rls_documents", (*rlsDocument)(nil), policy)
+	require.NoError(t, err)
+
+	assert.Equal(t, `ALTER TABLE "rls_documents" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "rls_documents" FORCE ROW LEVEL SECURITY;
+CREATE POLICY "tenant_isolation" ON "rls_documents" AS PERMISSIVE FOR ALL TO "app_rw" USING (tenant_id = (current_setting('app.claims', true)::jsonb ->> 'tenant_id')) WITH CHECK (tenant_id = (current_setting('app.claims', true)::jsonb ->> 'tenant_id'));
+`, string(fsys["20240101000000_rls_documents.up.sql"].Data))
+	assert.Equal(t, `DROP POLICY IF EXISTS "tenant_isolation" ON "rls_documents";
+ALTER TABLE "rls_documents" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "rls_documents" DISABLE ROW LEVEL SECURITY;
+`, string(fsys["20240101000000_rls_documents.down.sql"].Data))
+
+	_, err = rls.UpSQL((*rlsDocument)(nil), RLSPolicy{Name: "p", Command: "TRUNCATE", Using: "true"})
+	assert.Error(t, err)
+	_, err = rls.UpSQL((*rlsDocument)(nil), RLSPolicy{Name: "p"})
+	assert.Error(t, err)
+	_, err = rls.UpSQL((*rlsDocument)(nil), RLSPolicy{Name: "p", Using: "true; DROP TABLE x"})
+	assert.ErrorIs(t, err, ErrUnsafeExpression)
+}
+
+func TestRLS_RunInTx(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	rls := NewRLS(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL ROLE "app_rw"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('app.claims', '{"tenant_id":"t1"}', true)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM rls_documents`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := ContextWithRLSSession(context.Background(), RLSSession{Role: "app_rw", Claims: map[string]any{"tenant_id": "t1"}})
+	err = rls.RunInTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, ok := TxFromContext(ctx)
+		assert.True(t, ok)
+		_, err := tx.ExecContext(ctx, "DELETE FROM rls_documents")
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRLS_RequiresPostgres(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	err := NewRLS(db).Enable(context.Background(), (*rlsDocument)(nil), RLSPolicy{Name: "p", Using: "true"})
+	assert.ErrorIs(t, err, ErrRLSUnsupported)
+}
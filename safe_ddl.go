@@ -0,0 +1,236 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing/fstest"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	defaultSafeDDLKey       = "id"
+	defaultSafeDDLBatchSize = 1000
+)
+
+// ErrSafeDDLUnsupported indicates SafeDDL on a dialect other than
+// Postgres.
+var ErrSafeDDLUnsupported = errors.New("persistence: safe DDL recipes require postgres")
+
+// SafeDDLOption configures SafeDDL
+type SafeDDLOption func(*SafeDDL)
+
+// WithSafeDDLKey sets the single column key backfills walk in order,
+// "id" by default.
+func WithSafeDDLKey(column string) SafeDDLOption {
+	return func(s *SafeDDL) {
+		if column != "" {
+			s.key = column
+		}
+	}
+}
+
+// WithSafeDDLBatchSize sets the rows updated per backfill transaction,
+// 1000 by default.
+func WithSafeDDLBatchSize(n int) SafeDDLOption {
+	return func(s *SafeDDL) {
+		if n > 0 {
+			s.batchSize = n
+		}
+	}
+}
+
+// SafeDDL generates zero-downtime schema changes as expand/contract
+// plans for Postgres: the expand migration is deployed with code that
+// writes both shapes, the backfill migrates existing rows in small
+// transactions, and the contract migration is deployed once no code
+// depends on the old shape.
+type SafeDDL struct {
+	db        bun.IDB
+	key       string
+	batchSize int
+}
+
+// NewSafeDDL creates a recipe generator for db.
+func NewSafeDDL(db bun.IDB, opts ...SafeDDLOption) *SafeDDL {
+	s := &SafeDDL{db: db, key: defaultSafeDDLKey, batchSize: defaultSafeDDLBatchSize}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// SafeDDLPlan is the coordinated steps of a schema change. Each step
+// has its statements and the statements reverting it.
+type SafeDDLPlan struct {
+	Name         string
+	Expand       []string
+	ExpandDown   []string
+	Contract     []string
+	ContractDown []string
+	// Backfill migrates existing rows between the steps, nil when there
+	// is nothing to migrate.
+	Backfill *BackfillSpec
+}
+
+// ExpandFS returns the expand step as a migration named
+// <version>_<name>_expand.
+func (p *SafeDDLPlan) ExpandFS(version string) fstest.MapFS {
+	return safeDDLMigrationFS(fmt.Sprintf("%s_%s_expand", version, p.Name), p.Expand, p.ExpandDown)
+}
+
+// ContractFS returns the contract step as a migration named
+// <version>_<name>_contract. Register it in a later release than the
+// expand step, after RunBackfill completed.
+func (p *SafeDDLPlan) ContractFS(version string) fstest.MapFS {
+	return safeDDLMigrationFS(fmt.Sprintf("%s_%s_contract", version, p.Name), p.Contract, p.ContractDown)
+}
+
+// RunBackfill runs the Backfill of the plan, see Backfill. Adjust its
+// rate limits on the Backfill field before running it.
+func (p *SafeDDLPlan) RunBackfill(ctx context.Context, db bun.IDB) error {
+	if p.Backfill == nil {
+		return nil
+	}
+	_, err := Backfill(ctx, db, *p.Backfill)
+	return err
+}
+
+func safeDDLMigrationFS(base string, up, down []string) fstest.MapFS {
+	fsys := fstest.MapFS{base + ".up.sql": {Data: []byte(strings.Join(up, ";\n") + ";\n")}}
+	if len(down) > 0 {
+		fsys[base+".down.sql"] = &fstest.MapFile{Data: []byte(strings.Join(down, ";\n") + ";\n")}
+	}
+	return fsys
+}
+
+// AddNotNullColumn adds a NOT NULL column to a populated table without
+// a long lock: expand adds it nullable, the backfill sets it to fill,
+// and contract validates a CHECK constraint, which does not block
+// writes, before SET NOT NULL reuses it to skip the table scan.
+func (s *SafeDDL) AddNotNullColumn(table, column, sqlType, fill string) (*SafeDDLPlan, error) {
+	if err := s.check([]string{table, column}, []string{sqlType, fill}); err != nil {
+		return nil, err
+	}
+	t, c := bun.Ident(table), bun.Ident(column)
+	check := bun.Ident(safeDDLConstraintName(table, column, "not_null"))
+	return &SafeDDLPlan{
+		Name:       safeDDLName("add", table, column),
+		Expand:     []string{s.format("ALTER TABLE ? ADD COLUMN IF NOT EXISTS ? ?", t, c, bun.Safe(sqlType))},
+		ExpandDown: []string{s.format("ALTER TABLE ? DROP COLUMN IF EXISTS ?", t, c)},
+		Contract: []string{
+			s.format("ALTER TABLE ? ADD CONSTRAINT ? CHECK (? IS NOT NULL) NOT VALID", t, check, c),
+			s.format("ALTER TABLE ? VALIDATE CONSTRAINT ?", t, check),
+			s.format("ALTER TABLE ? ALTER COLUMN ? SET NOT NULL", t, c),
+			s.format("ALTER TABLE ? DROP CONSTRAINT ?", t, check),
+		},
+		ContractDown: []string{s.format("ALTER TABLE ? ALTER COLUMN ? DROP NOT NULL", t, c)},
+		Backfill: s.backfill(safeDDLName("add", table, column), table,
+			s.format("? = ?", c, bun.Safe(fill)), s.format("? IS NULL", c)),
+	}, nil
+}
+
+// RenameColumn renames a column through a copy: expand adds the new
+// column, the application writes both meanwhile, the backfill copies
+// the old values, and contract drops the old column.
+func (s *SafeDDL) RenameColumn(table, from, to, sqlType string) (*SafeDDLPlan, error) {
+	if err := s.check([]string{table, from, to}, []string{sqlType}); err != nil {
+		return nil, err
+	}
+	t, f, n := bun.Ident(table), bun.Ident(from), bun.Ident(to)
+	return &SafeDDLPlan{
+		Name:         safeDDLName("rename", table, from, to),
+		Expand:       []string{s.format("ALTER TABLE ? ADD COLUMN IF NOT EXISTS ? ?", t, n, bun.Safe(sqlType))},
+		ExpandDown:   []string{s.format("ALTER TABLE ? DROP COLUMN IF EXISTS ?", t, n)},
+		Contract:     []string{s.format("ALTER TABLE ? DROP COLUMN ?", t, f)},
+		ContractDown: []string{s.format("ALTER TABLE ? ADD COLUMN ? ?", t, f, bun.Safe(sqlType)), s.format("UPDATE ? SET ? = ?", t, f, n)},
+		Backfill: s.backfill(safeDDLName("rename", table, from, to), table,
+			s.format("? = ?", n, f), s.format("? IS DISTINCT FROM ?", n, f)),
+	}, nil
+}
+
+// RenameTable renames a table behind a view with the old name, which
+// Postgres keeps updatable, so old and new code work during the rollout.
+// Contract drops the view.
+func (s *SafeDDL) RenameTable(from, to string) (*SafeDDLPlan, error) {
+	if err := s.check([]string{from, to}, nil); err != nil {
+		return nil, err
+	}
+	f, n := bun.Ident(from), bun.Ident(to)
+	return &SafeDDLPlan{
+		Name: safeDDLName("rename", from, to),
+		Expand: []string{
+			s.format("ALTER TABLE ? RENAME TO ?", f, n),
+			s.format("CREATE VIEW ? AS SELECT * FROM ?", f, n),
+		},
+		ExpandDown: []string{
+			s.format("DROP VIEW IF EXISTS ?", f),
+			s.format("ALTER TABLE ? RENAME TO ?", n, f),
+		},
+		Contract:     []string{s.format("DROP VIEW IF EXISTS ?", f)},
+		ContractDown: []string{s.format("CREATE VIEW ? AS SELECT * FROM ?", f, n)},
+	}, nil
+}
+
+// AddForeignKey adds a foreign key without scanning the table under a
+// lock: expand adds it NOT VALID, enforced for new rows only, and
+// contract validates the existing rows while allowing writes.
+func (s *SafeDDL) AddForeignKey(table, column, refTable, refColumn string) (*SafeDDLPlan, error) {
+	if err := s.check([]string{table, column, refTable, refColumn}, nil); err != nil {
+		return nil, err
+	}
+	t := bun.Ident(table)
+	fk := bun.Ident(safeDDLConstraintName(table, column, "fkey"))
+	return &SafeDDLPlan{
+		Name: safeDDLName("fk", table, column),
+		Expand: []string{s.format("ALTER TABLE ? ADD CONSTRAINT ? FOREIGN KEY (?) REFERENCES ? (?) NOT VALID",
+			t, fk, bun.Ident(column), bun.Ident(refTable), bun.Ident(refColumn))},
+		ExpandDown: []string{s.format("ALTER TABLE ? DROP CONSTRAINT IF EXISTS ?", t, fk)},
+		Contract:   []string{s.format("ALTER TABLE ? VALIDATE CONSTRAINT ?", t, fk)},
+	}, nil
+}
+
+func (s *SafeDDL) check(identifiers, expressions []string) error {
+	if s.db.Dialect().Name() != dialect.PG {
+		return apierrors.Wrap(ErrSafeDDLUnsupported, apierrors.CategoryBadInput, "safe DDL recipes require postgres").
+			WithMetadata(map[string]any{"dialect": s.db.Dialect().Name().String()})
+	}
+	for _, name := range append(identifiers, s.key) {
+		if err := ValidateIdentifier(name); err != nil {
+			return err
+		}
+	}
+	for _, expr := range expressions {
+		if strings.TrimSpace(expr) == "" {
+			return apierrors.New("safe DDL expression is empty", apierrors.CategoryBadInput)
+		}
+		if err := ValidateExpression(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SafeDDL) format(query string, args ...any) string {
+	return string(schema.NewQueryGen(s.db.Dialect()).AppendQuery(nil, query, args...))
+}
+
+func (s *SafeDDL) backfill(name, table, set, where string) *BackfillSpec {
+	return &BackfillSpec{Name: name, Table: table, Key: s.key, Set: set, Where: where, BatchSize: s.batchSize}
+}
+
+func safeDDLName(parts ...string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.Join(parts, "_"), ".", "_"))
+}
+
+func safeDDLConstraintName(table, column, suffix string) string {
+	table = table[strings.LastIndex(table, ".")+1:]
+	return fmt.Sprintf("%s_%s_%s", table, column, suffix)
+}
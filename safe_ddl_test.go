@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestSafeDDL_AddNotNullColumn(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	ddl := NewSafeDDL(bun.NewDB(sqlDB, pgdialect.New()))
+
+	plan, err := ddl.AddNotNullColumn("accounts", "region", "text", "'eu'")
+	require.NoError(t, err)
+	assert.Equal(t, "add_accounts_region", plan.Name)
+	require.NotNil(t, plan.Backfill)
+	assert.Equal(t, `"region" = 'eu'`, plan.Backfill.Set)
+	assert.Equal(t, []string{`ALTER TABLE "accounts" ADD COLUMN IF NOT EXISTS "region" text`}, plan.Expand)
+	assert.Equal(t, []string{
+		`ALTER TABLE "accounts" ADD CONSTRAINT "accounts_region_not_null" CHECK ("region" IS NOT NULL) NOT VALID`,
+		`ALTER TABLE "accounts" VALIDATE CONSTRAINT "accounts_region_not_null"`,
+		`ALTER TABLE "accounts" ALTER COLUMN "region" SET NOT NULL`,
+		`ALTER TABLE "accounts" DROP CONSTRAINT "accounts_region_not_null"`,
+	}, plan.Contract)
+
+	expand := plan.ExpandFS("20250101000000")
+	assert.Contains(t, string(expand["20250101000000_add_accounts_region_expand.up.sql"].Data), "ADD COLUMN")
+	assert.Contains(t, string(expand["20250101000000_add_accounts_region_expand.down.sql"].Data), "DROP COLUMN")
+	contract := plan.ContractFS("20250201000000")
+	assert.Contains(t, string(contract["20250201000000_add_accounts_region_contract.up.sql"].Data), "SET NOT NULL")
+
+	_, err = ddl.AddNotNullColumn("accounts", "region", "text", "'eu'; DROP TABLE accounts")
+	assert.ErrorIs(t, err, ErrUnsafeExpression)
+	_, err = ddl.AddNotNullColumn("accounts", "bad name", "text", "'eu'")
+	assert.ErrorIs(t, err, ErrUnsafeIdentifier)
+}
+
+func TestSafeDDL_OtherRecipes(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	ddl := NewSafeDDL(bun.NewDB(sqlDB, pgdialect.New()))
+
+	plan, err := ddl.RenameColumn("accounts", "name", "display_name", "text")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`ALTER TABLE "accounts" DROP COLUMN "name"`}, plan.Contract)
+	require.NotNil(t, plan.Backfill)
+
+	plan, err = ddl.RenameTable("accounts", "customers")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`ALTER TABLE "accounts" RENAME TO "customers"`, `CREATE VIEW "accounts" AS SELECT * FROM "customers"`}, plan.Expand)
+	assert.Nil(t, plan.Backfill)
+
+	plan, err = ddl.AddForeignKey("orders", "account_id", "accounts", "id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`ALTER TABLE "orders" ADD CONSTRAINT "orders_account_id_fkey" FOREIGN KEY ("account_id") REFERENCES "accounts" ("id") NOT VALID`}, plan.Expand)
+	assert.Equal(t, []string{`ALTER TABLE "orders" VALIDATE CONSTRAINT "orders_account_id_fkey"`}, plan.Contract)
+	_, ok := plan.ContractFS("1")["1_fk_orders_account_id_contract.down.sql"]
+	assert.False(t, ok, "validation has nothing to revert")
+}
+
+func TestSafeDDL_RequiresPostgres(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := NewSafeDDL(db).AddNotNullColumn("accounts", "region", "text", "'eu'")
+	assert.ErrorIs(t, err, ErrSafeDDLUnsupported)
+}
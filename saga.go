@@ -0,0 +1,166 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrSagaStepNil indicates a saga step was registered without an action.
+var ErrSagaStepNil = errors.New("persistence: saga step action is nil")
+
+// ErrSagaStepDuplicate indicates two saga steps share a name. Step names
+// key the compensation errors of a SagaError, so they must be unique.
+var ErrSagaStepDuplicate = errors.New("persistence: duplicate saga step name")
+
+// SagaFunc is a saga action or compensation.
+type SagaFunc func(ctx context.Context) error
+
+// SagaStep is a unit of work with an optional compensation that
+// undoes its effects when a later step fails.
+type SagaStep struct {
+	Name       string
+	Action     SagaFunc
+	Compensate SagaFunc
+}
+
+// SagaError is returned when a saga step fails. It carries the
+// failing step and any errors raised while compensating.
+type SagaError struct {
+	Saga               string
+	Step               string
+	Err                error
+	CompensationErrors map[string]error
+}
+
+func (e *SagaError) Error() string {
+	msg := fmt.Sprintf("persistence: saga %q failed at step %q: %v", e.Saga, e.Step, e.Err)
+	if len(e.CompensationErrors) > 0 {
+		msg += fmt.Sprintf(" (%d compensation errors)", len(e.CompensationErrors))
+	}
+	return msg
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// Compensated returns true if every completed step was compensated.
+func (e *SagaError) Compensated() bool {
+	return len(e.CompensationErrors) == 0
+}
+
+// Saga runs a sequence of steps. If a step fails, the steps that
+// already completed are compensated in reverse order.
+type Saga struct {
+	name  string
+	steps []SagaStep
+	lgr   Logger
+	err   error
+}
+
+// NewSaga creates a new saga
+func NewSaga(name string) *Saga {
+	return &Saga{
+		name: name,
+		lgr:  &defaultLogger{},
+	}
+}
+
+// SetLogger sets the saga logger
+func (s *Saga) SetLogger(logger Logger) *Saga {
+	if logger != nil {
+		s.lgr = logger
+	}
+	return s
+}
+
+// Step adds a step. compensate may be nil for steps without side effects.
+// A name already used by another step is rejected, Execute then returns
+// ErrSagaStepDuplicate without running any step.
+func (s *Saga) Step(name string, action, compensate SagaFunc) *Saga {
+	for _, step := range s.steps {
+		if step.Name == name {
+			if s.err == nil {
+				s.err = fmt.Errorf("%w: %q", ErrSagaStepDuplicate, name)
+			}
+			return s
+		}
+	}
+	s.steps = append(s.steps, SagaStep{
+		Name:       name,
+		Action:     action,
+		Compensate: compensate,
+	})
+	return s
+}
+
+// TxStep adds a step whose action and compensation each run in
+// their own transaction on db, see RunInTx.
+func (s *Saga) TxStep(db bun.IDB, name string, action, compensate func(ctx context.Context, tx bun.Tx) error) *Saga {
+	var actionFn, compensateFn SagaFunc
+	if action != nil {
+		actionFn = func(ctx context.Context) error {
+			return RunInTx(ctx, db, action)
+		}
+	}
+	if compensate != nil {
+		compensateFn = func(ctx context.Context) error {
+			return RunInTx(ctx, db, compensate)
+		}
+	}
+	return s.Step(name, actionFn, compensateFn)
+}
+
+// Execute runs all steps in order. On failure it compensates
+// completed steps in reverse order and returns a *SagaError.
+// Compensations run even if ctx has been cancelled.
+func (s *Saga) Execute(ctx context.Context) error {
+	if s.err != nil {
+		return s.err
+	}
+	completed := make([]SagaStep, 0, len(s.steps))
+
+	for _, step := range s.steps {
+		var err error
+		if step.Action == nil {
+			err = ErrSagaStepNil
+		} else {
+			err = step.Action(ctx)
+		}
+		if err == nil {
+			completed = append(completed, step)
+			continue
+		}
+
+		s.lgr.Warn("saga step failed, compensating", "saga", s.name, "step", step.Name, "error", err)
+		return &SagaError{
+			Saga:               s.name,
+			Step:               step.Name,
+			Err:                err,
+			CompensationErrors: s.compensate(context.WithoutCancel(ctx), completed),
+		}
+	}
+
+	return nil
+}
+
+func (s *Saga) compensate(ctx context.Context, completed []SagaStep) map[string]error {
+	var errs map[string]error
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		if step.Compensate == nil {
+			continue
+		}
+		if err := step.Compensate(ctx); err != nil {
+			s.lgr.Error("saga compensation failed", "saga", s.name, "step", step.Name, "error", err)
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[step.Name] = err
+		}
+	}
+	return errs
+}
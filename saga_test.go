@@ -0,0 +1,112 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestSaga_Succeeds(t *testing.T) {
+	var calls []string
+	step := func(name string) SagaFunc {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	err := NewSaga("order").
+		Step("reserve", step("reserve"), step("release")).
+		Step("charge", step("charge"), step("refund")).
+		Execute(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reserve", "charge"}, calls)
+}
+
+func TestSaga_CompensatesInReverseOrder(t *testing.T) {
+	var calls []string
+	step := func(name string, err error) SagaFunc {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	chargeErr := errors.New("card declined")
+	refundErr := errors.New("refund failed")
+
+	err := NewSaga("order").
+		Step("reserve", step("reserve", nil), step("release", nil)).
+		Step("notify", step("notify", nil), nil).
+		Step("invoice", step("invoice", nil), step("void", refundErr)).
+		Step("charge", step("charge", chargeErr), step("refund", nil)).
+		Execute(context.Background())
+
+	var sagaErr *SagaError
+	require.ErrorAs(t, err, &sagaErr)
+	assert.ErrorIs(t, err, chargeErr)
+	assert.Equal(t, "charge", sagaErr.Step)
+	assert.False(t, sagaErr.Compensated())
+	assert.Equal(t, refundErr, sagaErr.CompensationErrors["invoice"])
+	assert.Equal(t, []string{"reserve", "notify", "invoice", "charge", "void", "release"}, calls)
+}
+
+func TestSaga_TxStep(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	failure := errors.New("remote failure")
+	err = NewSaga("order").
+		TxStep(db, "insert", func(ctx context.Context, tx bun.Tx) error {
+			_, err := tx.NewRaw("INSERT INTO orders VALUES (1)").Exec(ctx)
+			return err
+		}, func(ctx context.Context, tx bun.Tx) error {
+			_, err := tx.NewRaw("DELETE FROM orders WHERE id = 1").Exec(ctx)
+			return err
+		}).
+		Step("remote", func(ctx context.Context) error { return failure }, nil).
+		Execute(context.Background())
+
+	require.ErrorIs(t, err, failure)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaga_NilAction(t *testing.T) {
+	err := NewSaga("broken").Step("missing", nil, nil).Execute(context.Background())
+	assert.ErrorIs(t, err, ErrSagaStepNil)
+}
+
+func TestSaga_RejectsDuplicateStepNames(t *testing.T) {
+	var ran []string
+	step := func(name string) SagaFunc {
+		return func(context.Context) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+
+	err := NewSaga("orders").
+		Step("reserve", step("reserve"), nil).
+		Step("charge", step("charge"), nil).
+		Step("reserve", step("reserve again"), nil).
+		Execute(context.Background())
+	assert.ErrorIs(t, err, ErrSagaStepDuplicate)
+	assert.Contains(t, err.Error(), `"reserve"`)
+	assert.Empty(t, ran, "no step runs")
+}
@@ -0,0 +1,195 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+const defaultSessionTTL = 24 * time.Hour
+
+// ErrSessionNotFound indicates a session that does not exist or expired.
+var ErrSessionNotFound = errors.New("persistence: session not found")
+
+// SessionRecord is a web session stored in the sessions table.
+type SessionRecord struct {
+	bun.BaseModel `bun:"table:sessions"`
+
+	ID        string    `bun:"id,pk"`
+	Data      []byte    `bun:"data"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+}
+
+// SessionsMigrationFS returns up and down migrations for the sessions
+// table and its expires_at index, named <version>_sessions.
+func SessionsMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	fsys := modelTableMigrationFS(db, version, "sessions", (*SessionRecord)(nil))
+	up := fsys[version+"_sessions.up.sql"]
+	up.Data = append(up.Data, "CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);\n"...)
+	return fsys
+}
+
+// SessionStoreOption configures a SessionStore
+type SessionStoreOption func(*SessionStore)
+
+// WithSessionTTL sets how long sessions live after their last save or
+// refresh, 24 hours by default.
+func WithSessionTTL(ttl time.Duration) SessionStoreOption {
+	return func(s *SessionStore) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// SessionStore keeps opaque session payloads in the database, for web
+// apps that want sessions to survive restarts and be shared between
+// instances. Payload encoding is left to the caller, so it can back
+// any session library that persists serialized values by id.
+type SessionStore struct {
+	db  bun.IDB
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSessionStore creates a store backed by db. The sessions table must
+// exist, see SessionsMigrationFS.
+func NewSessionStore(db bun.IDB, opts ...SessionStoreOption) *SessionStore {
+	s := &SessionStore{db: db, ttl: defaultSessionTTL, now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Create stores data under a new random session id.
+func (s *SessionStore) Create(ctx context.Context, data []byte) (*SessionRecord, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to generate session id")
+	}
+
+	now := s.now().UTC()
+	record := &SessionRecord{ID: id, Data: data, ExpiresAt: now.Add(s.ttl), CreatedAt: now, UpdatedAt: now}
+	if _, err := s.db.NewInsert().Model(record).Exec(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to create session")
+	}
+	return record, nil
+}
+
+// Load returns the session with id, or an error wrapping
+// ErrSessionNotFound when it does not exist or expired.
+func (s *SessionStore) Load(ctx context.Context, id string) (*SessionRecord, error) {
+	record := new(SessionRecord)
+	err := s.db.NewSelect().Model(record).
+		Where("id = ?", id).
+		Where("expires_at > ?", s.now().UTC()).
+		Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, apierrors.Wrap(ErrSessionNotFound, apierrors.CategoryNotFound, "session not found")
+	case err != nil:
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to load session")
+	}
+	return record, nil
+}
+
+// Save replaces the data of a live session and extends its expiry.
+func (s *SessionStore) Save(ctx context.Context, id string, data []byte) error {
+	now := s.now().UTC()
+	return s.update(ctx, id, "failed to save session", func(q *bun.UpdateQuery) *bun.UpdateQuery {
+		return q.Set("data = ?", data).Set("expires_at = ?", now.Add(s.ttl)).Set("updated_at = ?", now)
+	})
+}
+
+// Refresh extends the expiry of a live session and returns the new expiry.
+func (s *SessionStore) Refresh(ctx context.Context, id string) (time.Time, error) {
+	now := s.now().UTC()
+	expires := now.Add(s.ttl)
+	err := s.update(ctx, id, "failed to refresh session", func(q *bun.UpdateQuery) *bun.UpdateQuery {
+		return q.Set("expires_at = ?", expires).Set("updated_at = ?", now)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return expires, nil
+}
+
+func (s *SessionStore) update(ctx context.Context, id, msg string, fn func(*bun.UpdateQuery) *bun.UpdateQuery) error {
+	q := s.db.NewUpdate().Model((*SessionRecord)(nil)).
+		Where("id = ?", id).
+		Where("expires_at > ?", s.now().UTC())
+	res, err := fn(q).Exec(ctx)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, msg)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return apierrors.Wrap(ErrSessionNotFound, apierrors.CategoryNotFound, "session not found")
+	}
+	return nil
+}
+
+// Destroy deletes the session with id. Missing sessions are ignored.
+func (s *SessionStore) Destroy(ctx context.Context, id string) error {
+	if _, err := s.db.NewDelete().Model((*SessionRecord)(nil)).Where("id = ?", id).Exec(ctx); err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to destroy session")
+	}
+	return nil
+}
+
+// GC deletes expired sessions and returns how many were removed.
+func (s *SessionStore) GC(ctx context.Context) (int64, error) {
+	res, err := s.db.NewDelete().Model((*SessionRecord)(nil)).Where("expires_at <= ?", s.now().UTC()).Exec(ctx)
+	if err != nil {
+		return 0, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to delete expired sessions")
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// StartGC runs GC every interval until ctx is done or the returned stop
+// function is called. Errors are passed to onError when it is not nil.
+func (s *SessionStore) StartGC(ctx context.Context, interval time.Duration, onError func(error)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.GC(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
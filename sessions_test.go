@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	fsys := SessionsMigrationFS(db, "20240101000000")
+	assert.Contains(t, string(fsys["20240101000000_sessions.up.sql"].Data), "sessions_expires_at_idx")
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(fsys).Migrate(ctx, db))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewSessionStore(db, WithSessionTTL(time.Hour))
+	store.now = func() time.Time { return now }
+
+	record, err := store.Create(ctx, []byte(`{"user":1}`))
+	require.NoError(t, err)
+	assert.Len(t, record.ID, 43)
+	assert.Equal(t, now.Add(time.Hour), record.ExpiresAt)
+
+	loaded, err := store.Load(ctx, record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, `{"user":1}`, string(loaded.Data))
+
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, store.Save(ctx, record.ID, []byte(`{"user":2}`)))
+	expires, err := store.Refresh(ctx, record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), expires)
+
+	other, err := store.Create(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Destroy(ctx, other.ID))
+	_, err = store.Load(ctx, other.ID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	now = now.Add(2 * time.Hour)
+	_, err = store.Load(ctx, record.ID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+	require.ErrorIs(t, store.Save(ctx, record.ID, nil), ErrSessionNotFound)
+
+	removed, err := store.GC(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+}
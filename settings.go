@@ -0,0 +1,261 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// Setting is an application setting stored as JSON in the app_settings table.
+type Setting struct {
+	bun.BaseModel `bun:"table:app_settings"`
+
+	Name      string    `bun:"name,pk" json:"name"`
+	Value     string    `bun:"value,notnull" json:"value"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// SettingChanged is emitted when a setting is written or deleted. Old is
+// nil for new settings and New is nil for deleted ones.
+type SettingChanged struct {
+	Name string
+	Old  json.RawMessage
+	New  json.RawMessage
+	At   time.Time
+}
+
+// SettingsMigrationFS returns up and down migrations for the
+// app_settings table, named <version>_app_settings.
+func SettingsMigrationFS(db bun.IDB, version string) fstest.MapFS {
+	return modelTableMigrationFS(db, version, "app_settings", (*Setting)(nil))
+}
+
+// SettingsOption configures Settings
+type SettingsOption func(*Settings)
+
+// WithSettingsPublisher publishes SettingChanged events in the write
+// transaction, e.g. to an outbox, so other instances can react.
+func WithSettingsPublisher(publisher EventPublisher) SettingsOption {
+	return func(s *Settings) {
+		s.publisher = publisher
+	}
+}
+
+// Settings is a key value store for JSON typed application settings.
+type Settings struct {
+	db        bun.IDB
+	publisher EventPublisher
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]func(SettingChanged)
+}
+
+// NewSettings creates a settings store backed by db. The app_settings
+// table must exist, see SettingsMigrationFS.
+func NewSettings(db bun.IDB, opts ...SettingsOption) *Settings {
+	s := &Settings{db: db, subscribers: make(map[int]func(SettingChanged))}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Subscribe calls fn after every committed change made through s and
+// returns a function removing the subscription.
+func (s *Settings) Subscribe(fn func(SettingChanged)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// Get decodes the named setting into dst and reports whether it exists.
+func (s *Settings) Get(ctx context.Context, name string, dst any) (bool, error) {
+	raw, found, err := s.raw(ctx, s.db, name)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid setting value").
+			WithMetadata(map[string]any{"setting": name})
+	}
+	return true, nil
+}
+
+// GetSetting returns the named setting decoded as T, or def when it
+// does not exist.
+func GetSetting[T any](ctx context.Context, s *Settings, name string, def T) (T, error) {
+	var value T
+	found, err := s.Get(ctx, name, &value)
+	if err != nil || !found {
+		return def, err
+	}
+	return value, nil
+}
+
+// Set stores value as JSON under name.
+func (s *Settings) Set(ctx context.Context, name string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryBadInput, "setting value is not JSON encodable").
+			WithMetadata(map[string]any{"setting": name})
+	}
+	return s.write(ctx, name, data)
+}
+
+// Delete removes the named setting.
+func (s *Settings) Delete(ctx context.Context, name string) error {
+	return s.write(ctx, name, nil)
+}
+
+func (s *Settings) write(ctx context.Context, name string, data json.RawMessage) error {
+	var event SettingChanged
+	err := RunInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		old, _, err := s.raw(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if data == nil {
+			_, err = tx.NewDelete().Model((*Setting)(nil)).Where("name = ?", name).Exec(ctx)
+		} else {
+			_, err = Upsert(ctx, tx, &Setting{Name: name, Value: string(data), UpdatedAt: now}, []string{"name"}, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		event = SettingChanged{Name: name, Old: old, New: data, At: now}
+		if s.publisher != nil {
+			return s.publisher.Publish(ctx, tx, []any{event})
+		}
+		return nil
+	})
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to save setting").
+			WithMetadata(map[string]any{"setting": name})
+	}
+
+	s.mu.Lock()
+	subscribers := make([]func(SettingChanged), 0, len(s.subscribers))
+	for _, fn := range s.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	s.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(event)
+	}
+	return nil
+}
+
+func (s *Settings) raw(ctx context.Context, db bun.IDB, name string) (json.RawMessage, bool, error) {
+	var setting Setting
+	err := db.NewSelect().Model(&setting).Where("name = ?", name).Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read setting").
+			WithMetadata(map[string]any{"setting": name})
+	}
+	return json.RawMessage(setting.Value), true, nil
+}
+
+// Snapshot reads every setting in one query.
+func (s *Settings) Snapshot(ctx context.Context) (SettingsSnapshot, error) {
+	var settings []Setting
+	if err := s.db.NewSelect().Model(&settings).Scan(ctx); err != nil {
+		return SettingsSnapshot{}, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read settings")
+	}
+	values := make(map[string]json.RawMessage, len(settings))
+	for _, setting := range settings {
+		values[setting.Name] = json.RawMessage(setting.Value)
+	}
+	return SettingsSnapshot{values: values, takenAt: time.Now().UTC()}, nil
+}
+
+// SettingsSnapshot is an immutable view of all settings at one point in
+// time, e.g. to configure a request consistently.
+type SettingsSnapshot struct {
+	values  map[string]json.RawMessage
+	takenAt time.Time
+}
+
+// TakenAt returns when the snapshot was read.
+func (s SettingsSnapshot) TakenAt() time.Time {
+	return s.takenAt
+}
+
+// Names returns the setting names in the snapshot.
+func (s SettingsSnapshot) Names() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range maps.Keys(s.values) {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Raw returns the JSON value of the named setting.
+func (s SettingsSnapshot) Raw(name string) (json.RawMessage, bool) {
+	raw, ok := s.values[name]
+	return raw, ok
+}
+
+// Decode decodes the named setting into dst and reports whether it exists.
+func (s SettingsSnapshot) Decode(name string, dst any) (bool, error) {
+	raw, ok := s.values[name]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return false, apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid setting value").
+			WithMetadata(map[string]any{"setting": name})
+	}
+	return true, nil
+}
+
+// String returns the named string setting, or def.
+func (s SettingsSnapshot) String(name, def string) string {
+	return snapshotValue(s, name, def)
+}
+
+// Bool returns the named boolean setting, or def.
+func (s SettingsSnapshot) Bool(name string, def bool) bool {
+	return snapshotValue(s, name, def)
+}
+
+// Int returns the named integer setting, or def.
+func (s SettingsSnapshot) Int(name string, def int64) int64 {
+	return snapshotValue(s, name, def)
+}
+
+// Float returns the named number setting, or def.
+func (s SettingsSnapshot) Float(name string, def float64) float64 {
+	return snapshotValue(s, name, def)
+}
+
+func snapshotValue[T any](s SettingsSnapshot, name string, def T) T {
+	var value T
+	if ok, err := s.Decode(name, &value); !ok || err != nil {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestSettings_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(SettingsMigrationFS(db, "20240101000000")).Migrate(ctx, db))
+
+	var published []any
+	settings := NewSettings(db, WithSettingsPublisher(EventPublisherFunc(func(_ context.Context, _ bun.Tx, events []any) error {
+		published = append(published, events...)
+		return nil
+	})))
+
+	var changes []SettingChanged
+	unsubscribe := settings.Subscribe(func(change SettingChanged) {
+		changes = append(changes, change)
+	})
+
+	type smtp struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	require.NoError(t, settings.Set(ctx, "smtp", smtp{Host: "mail", Port: 25}))
+	require.NoError(t, settings.Set(ctx, "smtp", smtp{Host: "mail", Port: 587}))
+	require.NoError(t, settings.Set(ctx, "maintenance", true))
+	require.NoError(t, settings.Set(ctx, "page_size", 50))
+
+	var got smtp
+	found, err := settings.Get(ctx, "smtp", &got)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 587, got.Port)
+
+	size, err := GetSetting(ctx, settings, "page_size", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 50, size)
+	missing, err := GetSetting(ctx, settings, "missing", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "default", missing)
+
+	require.Len(t, changes, 4)
+	assert.Nil(t, changes[0].Old)
+	assert.JSONEq(t, `{"host":"mail","port":25}`, string(changes[1].Old))
+	assert.JSONEq(t, `{"host":"mail","port":587}`, string(changes[1].New))
+	assert.Len(t, published, 4)
+
+	snapshot, err := settings.Snapshot(ctx)
+	require.NoError(t, err)
+	names := snapshot.Names()
+	slices.Sort(names)
+	assert.Equal(t, []string{"maintenance", "page_size", "smtp"}, names)
+	assert.True(t, snapshot.Bool("maintenance", false))
+	assert.Equal(t, int64(50), snapshot.Int("page_size", 0))
+	assert.Equal(t, "x", snapshot.String("page_size", "x"), "type mismatch returns the default")
+
+	unsubscribe()
+	require.NoError(t, settings.Delete(ctx, "maintenance"))
+	assert.Len(t, changes, 4)
+	require.Len(t, published, 5)
+	assert.Nil(t, published[4].(SettingChanged).New)
+
+	found, err = settings.Get(ctx, "maintenance", new(bool))
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.True(t, snapshot.Bool("maintenance", false), "snapshots are immutable")
+}
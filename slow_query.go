@@ -0,0 +1,269 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const defaultLockSampleTimeout = 2 * time.Second
+
+// SlowQuery describes a query that ran longer than the slow query
+// threshold or was aborted by a deadlock.
+type SlowQuery struct {
+	Operation string
+	Query     string
+	Duration  time.Duration
+	Err       error
+	// Deadlock is set when the database aborted the query to break a
+	// deadlock.
+	Deadlock bool
+	// LockWaits is the blocking chain sampled while the query was
+	// running, see WithLockWaitSampler.
+	LockWaits []LockWait
+}
+
+// LockWait is a session waiting for a lock. On SQLite it reports a
+// query that failed waiting for the database lock, whose holder SQLite
+// does not expose.
+type LockWait struct {
+	PID int64
+	// Lock is the mode and target of the awaited lock, e.g.
+	// "RowExclusiveLock on orders".
+	Lock      string
+	WaitEvent string
+	Waiting   time.Duration
+	Query     string
+	BlockedBy []LockHolder
+}
+
+// LockHolder is a session holding a lock another session waits for.
+// A holder that is itself waiting appears in the chain as a LockWait.
+type LockHolder struct {
+	PID   int64
+	State string
+	Query string
+	// TxAge is how long the transaction of the holder has been open.
+	TxAge time.Duration
+}
+
+type slowQueryOptions struct {
+	threshold     time.Duration
+	lockThreshold time.Duration
+	sampleTimeout time.Duration
+	handler       func(ctx context.Context, q SlowQuery)
+}
+
+func (s *slowQueryOptions) enabled() bool {
+	return s != nil && (s.threshold > 0 || s.lockThreshold > 0)
+}
+
+func slowQueriesOf(opts *clientOptions) *slowQueryOptions {
+	if opts.slowQueries == nil {
+		opts.slowQueries = &slowQueryOptions{sampleTimeout: defaultLockSampleTimeout}
+	}
+	return opts.slowQueries
+}
+
+// WithSlowQueryLog logs queries running longer than threshold at warn
+// level through the query logger.
+func WithSlowQueryLog(threshold time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		slowQueriesOf(opts).threshold = threshold
+	}
+}
+
+// WithLockWaitSampler samples the lock waits of the database when a
+// query is still running after threshold, and attaches the blocking
+// chain to its slow query entry. On Postgres it reads pg_locks and
+// pg_stat_activity on a separate connection; on SQLite, which does not
+// expose lock holders, queries failing with a busy error are reported.
+// The slow query threshold defaults to threshold.
+func WithLockWaitSampler(threshold time.Duration) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		slowQueriesOf(opts).lockThreshold = threshold
+	}
+}
+
+// WithSlowQueryHandler calls fn for every slow query in addition to
+// logging it, e.g. to ship the blocking chains to an incident tool.
+func WithSlowQueryHandler(fn func(ctx context.Context, q SlowQuery)) ClientOption {
+	return func(opts *clientOptions) {
+		if opts == nil {
+			return
+		}
+		slowQueriesOf(opts).handler = fn
+	}
+}
+
+type lockSampleKey struct{}
+
+// lockSample collects the lock waits sampled during one query.
+type lockSample struct {
+	timer *time.Timer
+	done  chan struct{}
+	waits []LockWait
+}
+
+// slowQueryHook reports slow queries and samples their lock waits.
+type slowQueryHook struct {
+	client *Client
+	opts   *slowQueryOptions
+}
+
+func (h *slowQueryHook) QueryHookKey() string {
+	return "slow-query"
+}
+
+func (h *slowQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if h.opts.lockThreshold <= 0 || event.DB == nil || event.DB.Dialect().Name() != dialect.PG {
+		return ctx
+	}
+	sample := &lockSample{done: make(chan struct{})}
+	db, query := event.DB, event.Query
+	sample.timer = time.AfterFunc(h.opts.lockThreshold, func() {
+		defer close(sample.done)
+		sampleCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.opts.sampleTimeout)
+		defer cancel()
+		sample.waits = samplePostgresLockWaits(sampleCtx, db, query)
+	})
+	return context.WithValue(ctx, lockSampleKey{}, sample)
+}
+
+func (h *slowQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	duration := time.Since(event.StartTime)
+	q := SlowQuery{
+		Operation: event.Operation(),
+		Query:     event.Query,
+		Duration:  duration,
+		Err:       event.Err,
+		Deadlock:  isDeadlockError(event.Err),
+	}
+	if sample, ok := ctx.Value(lockSampleKey{}).(*lockSample); ok && !sample.timer.Stop() {
+		<-sample.done
+		q.LockWaits = sample.waits
+	}
+
+	threshold := h.opts.threshold
+	if threshold <= 0 {
+		threshold = h.opts.lockThreshold
+	}
+	if duration < threshold && !q.Deadlock {
+		return
+	}
+	if h.opts.lockThreshold > 0 && event.DB != nil && event.DB.Dialect().Name() == dialect.SQLite && isSQLiteBusyError(event.Err) {
+		q.LockWaits = append(q.LockWaits, LockWait{Lock: "database", WaitEvent: "busy", Waiting: duration, Query: event.Query})
+	}
+	h.report(ctx, q)
+}
+
+func (h *slowQueryHook) report(ctx context.Context, q SlowQuery) {
+	if queryLgr := h.client.queryLogger(); queryLgr != nil {
+		msg := "slow query"
+		if q.Deadlock {
+			msg = "query deadlocked"
+		}
+		fields := []any{"operation", q.Operation, "duration", q.Duration, "query", q.Query}
+		if q.Err != nil {
+			fields = append(fields, "error", q.Err)
+		}
+		if len(q.LockWaits) > 0 {
+			fields = append(fields, "lock_waits", q.LockWaits)
+		}
+		NewContextLogger(queryLgr).WarnCtx(ctx, msg, fields...)
+	}
+	if h.opts.handler != nil {
+		h.opts.handler(ctx, q)
+	}
+}
+
+// samplePostgresLockWaits reads the sessions waiting for a lock with
+// their blockers. Waits of query come first, the rest of the chain
+// after. It queries the raw sql.DB so the hooks do not run again, and
+// returns nil when sampling fails.
+func samplePostgresLockWaits(ctx context.Context, db *bun.DB, query string) []LockWait {
+	rows, err := db.DB.QueryContext(ctx, `SELECT w.pid,
+	COALESCE((SELECT l.mode || ' on ' || COALESCE(l.relation::regclass::text, l.locktype)
+		FROM pg_locks l WHERE l.pid = w.pid AND NOT l.granted LIMIT 1), ''),
+	COALESCE(w.wait_event, ''),
+	COALESCE(EXTRACT(EPOCH FROM now() - w.query_start), 0)::float8,
+	COALESCE(w.query, ''),
+	b.pid,
+	COALESCE(b.state, ''),
+	COALESCE(b.query, ''),
+	COALESCE(EXTRACT(EPOCH FROM now() - b.xact_start), 0)::float8
+FROM pg_stat_activity w
+CROSS JOIN LATERAL unnest(pg_blocking_pids(w.pid)) AS blocking(pid)
+JOIN pg_stat_activity b ON b.pid = blocking.pid
+WHERE w.wait_event_type = 'Lock'
+ORDER BY w.pid, b.pid`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var waits []LockWait
+	for rows.Next() {
+		var w LockWait
+		var h LockHolder
+		var waiting, txAge float64
+		if err := rows.Scan(&w.PID, &w.Lock, &w.WaitEvent, &waiting, &w.Query, &h.PID, &h.State, &h.Query, &txAge); err != nil {
+			return nil
+		}
+		h.TxAge = time.Duration(txAge * float64(time.Second))
+		if n := len(waits); n > 0 && waits[n-1].PID == w.PID {
+			waits[n-1].BlockedBy = append(waits[n-1].BlockedBy, h)
+			continue
+		}
+		w.Waiting = time.Duration(waiting * float64(time.Second))
+		w.BlockedBy = []LockHolder{h}
+		waits = append(waits, w)
+	}
+	if rows.Err() != nil {
+		return nil
+	}
+
+	// pg_stat_activity truncates the query text to track_activity_query_size
+	own := func(w LockWait) bool { return w.Query != "" && strings.HasPrefix(query, w.Query) }
+	ordered := make([]LockWait, 0, len(waits))
+	for _, w := range waits {
+		if own(w) {
+			ordered = append(ordered, w)
+		}
+	}
+	for _, w := range waits {
+		if !own(w) {
+			ordered = append(ordered, w)
+		}
+	}
+	return ordered
+}
+
+func isDeadlockError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var stater interface{ SQLState() string }
+	if errors.As(err, &stater) && stater.SQLState() == sqlStateDeadlockDetected {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "deadlock detected")
+}
+
+func isSQLiteBusyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "sqlite_busy")
+}
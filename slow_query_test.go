@@ -0,0 +1,162 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type slowQueryRecorder struct {
+	mu      sync.Mutex
+	queries []SlowQuery
+}
+
+func (r *slowQueryRecorder) handle(_ context.Context, q SlowQuery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, q)
+}
+
+func (r *slowQueryRecorder) Queries() []SlowQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SlowQuery(nil), r.queries...)
+}
+
+func TestSlowQuery_PostgresLockWaits(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.MatchExpectationsInOrder(false)
+
+	rec := &slowQueryRecorder{}
+	logs := &recordingLogger{}
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, pgdialect.New(),
+		WithLazyConnect(),
+		WithLockWaitSampler(20*time.Millisecond),
+		WithSlowQueryHandler(rec.handle),
+	)
+	require.NoError(t, err)
+	client.SetLogger(logs)
+
+	update := `UPDATE orders SET status = 'paid' WHERE id = 1`
+	mock.ExpectExec(`UPDATE orders`).WillDelayFor(200 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM pg_stat_activity w`).
+		WillReturnRows(sqlmock.NewRows([]string{"pid", "lock", "wait_event", "waiting", "query", "blocker", "state", "blocker_query", "tx_age"}).
+			AddRow(200, "ShareLock on orders", "transactionid", 0.5, "SELECT pg_sleep(1)", 100, "active", "VACUUM orders", 3.0).
+			AddRow(101, "RowExclusiveLock on orders", "tuple", 0.18, update, 100, "idle in transaction", "UPDATE orders SET status = 'new'", 12.5).
+			AddRow(101, "RowExclusiveLock on orders", "tuple", 0.18, update, 102, "active", "SELECT 1", 1.0))
+
+	_, err = client.DB().ExecContext(context.Background(), update)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	queries := rec.Queries()
+	require.Len(t, queries, 1)
+	q := queries[0]
+	assert.Equal(t, update, q.Query)
+	assert.False(t, q.Deadlock)
+	require.Len(t, q.LockWaits, 2)
+
+	own := q.LockWaits[0]
+	assert.Equal(t, int64(101), own.PID, "waits of the slow query come first")
+	assert.Equal(t, "RowExclusiveLock on orders", own.Lock)
+	require.Len(t, own.BlockedBy, 2)
+	assert.Equal(t, int64(100), own.BlockedBy[0].PID)
+	assert.Equal(t, "idle in transaction", own.BlockedBy[0].State)
+	assert.Equal(t, 12500*time.Millisecond, own.BlockedBy[0].TxAge)
+	assert.Equal(t, int64(200), q.LockWaits[1].PID)
+
+	lines := logs.Lines()
+	require.NotEmpty(t, lines)
+	assert.True(t, strings.HasPrefix(lines[len(lines)-1], "WARN slow query"))
+	assert.Contains(t, lines[len(lines)-1], "lock_waits=")
+}
+
+func TestSlowQuery_FastQueriesAreNotSampled(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	rec := &slowQueryRecorder{}
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, pgdialect.New(),
+		WithLazyConnect(),
+		WithSlowQueryLog(time.Minute),
+		WithLockWaitSampler(time.Minute),
+		WithSlowQueryHandler(rec.handle),
+	)
+	require.NoError(t, err)
+
+	mock.ExpectExec(`UPDATE orders`).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = client.DB().ExecContext(context.Background(), `UPDATE orders SET status = 'paid'`)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Empty(t, rec.Queries())
+}
+
+func TestSlowQuery_Deadlock(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	rec := &slowQueryRecorder{}
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, pgdialect.New(),
+		WithLazyConnect(),
+		WithSlowQueryLog(time.Minute),
+		WithSlowQueryHandler(rec.handle),
+	)
+	require.NoError(t, err)
+
+	mock.ExpectExec(`UPDATE orders`).WillReturnError(errors.New("ERROR: deadlock detected (SQLSTATE 40P01)"))
+	_, err = client.DB().ExecContext(context.Background(), `UPDATE orders SET status = 'paid'`)
+	require.Error(t, err)
+
+	queries := rec.Queries()
+	require.Len(t, queries, 1)
+	assert.True(t, queries[0].Deadlock)
+}
+
+func TestSlowQuery_SQLiteBusy(t *testing.T) {
+	ctx := context.Background()
+	path := "file:" + filepath.Join(t.TempDir(), "busy.db") + "?_pragma=busy_timeout(50)"
+
+	holder, err := sql.Open(sqliteshim.ShimName, path)
+	require.NoError(t, err)
+	defer holder.Close()
+	_, err = holder.ExecContext(ctx, "CREATE TABLE events (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	tx, err := holder.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO events (id) VALUES (1)")
+	require.NoError(t, err)
+
+	sqlDB, err := sql.Open(sqliteshim.ShimName, path)
+	require.NoError(t, err)
+	rec := &slowQueryRecorder{}
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, sqlitedialect.New(),
+		WithLazyConnect(),
+		WithLockWaitSampler(10*time.Millisecond),
+		WithSlowQueryHandler(rec.handle),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.DB().ExecContext(ctx, "INSERT INTO events (id) VALUES (2)")
+	require.Error(t, err)
+
+	queries := rec.Queries()
+	require.Len(t, queries, 1)
+	require.Len(t, queries[0].LockWaits, 1)
+	assert.Equal(t, "busy", queries[0].LockWaits[0].WaitEvent)
+	assert.Equal(t, "database", queries[0].LockWaits[0].Lock)
+}
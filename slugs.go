@@ -0,0 +1,273 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	defaultSlugMaxLength = 100
+	defaultSlugRetries   = 3
+	slugSuffixReserve    = 8
+)
+
+// SluggerOption configures a Slugger
+type SluggerOption func(*Slugger)
+
+// Slugger assigns URL slugs to models on insert. Collisions are resolved
+// in the INSERT statement itself by appending the next free numbered
+// suffix, e.g. "hello-world-3", so no read-then-write race is possible.
+// The slug column should have a unique index, concurrent inserts of the
+// same slug that still collide are retried.
+type Slugger struct {
+	column    string
+	source    string
+	separator string
+	maxLength int
+	retries   int
+	scope     []string
+}
+
+// NewSlugger creates a slugger writing column from the source column.
+// An empty source uses the current value of column as the base.
+func NewSlugger(column, source string, opts ...SluggerOption) *Slugger {
+	s := &Slugger{
+		column:    column,
+		source:    source,
+		separator: "-",
+		maxLength: defaultSlugMaxLength,
+		retries:   defaultSlugRetries,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// WithSlugSeparator sets the word and suffix separator, "-" by default.
+func WithSlugSeparator(separator string) SluggerOption {
+	return func(s *Slugger) {
+		if separator != "" {
+			s.separator = separator
+		}
+	}
+}
+
+// WithSlugMaxLength caps the slug length, suffix included.
+func WithSlugMaxLength(n int) SluggerOption {
+	return func(s *Slugger) {
+		if n > slugSuffixReserve {
+			s.maxLength = n
+		}
+	}
+}
+
+// WithSlugRetries sets how many times an insert colliding with a
+// concurrent insert is retried.
+func WithSlugRetries(n int) SluggerOption {
+	return func(s *Slugger) {
+		if n >= 0 {
+			s.retries = n
+		}
+	}
+}
+
+// WithSlugScope makes slugs unique per value of the given columns,
+// e.g. a tenant id, instead of per table.
+func WithSlugScope(columns ...string) SluggerOption {
+	return func(s *Slugger) {
+		s.scope = append(s.scope, columns...)
+	}
+}
+
+// Slugify lowercases s, folds common accented letters to ASCII and joins
+// the remaining letter and digit runs with separator.
+func Slugify(s, separator string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := slugFold[r]; ok {
+			if pending && b.Len() > 0 {
+				b.WriteString(separator)
+			}
+			pending = false
+			b.WriteString(folded)
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if pending && b.Len() > 0 {
+				b.WriteString(separator)
+			}
+			pending = false
+			b.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	return b.String()
+}
+
+var slugFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y", 'ß': "ss",
+}
+
+// Insert inserts model with a unique slug and stores the assigned slug
+// on the model.
+func (s *Slugger) Insert(ctx context.Context, db bun.IDB, model any) error {
+	table, field, strct, err := s.lookup(db, model)
+	if err != nil {
+		return err
+	}
+
+	source := field
+	if s.source != "" {
+		source = table.FieldMap[s.source]
+	}
+	base := s.base(fmt.Sprint(source.Value(strct).Interface()))
+	if base == "" {
+		return apierrors.New("slug source is empty", apierrors.CategoryValidation).
+			WithTextCode("EMPTY_SLUG").
+			WithMetadata(map[string]any{"table": table.Name, "column": s.column})
+	}
+
+	scope := make([]any, 0, len(s.scope))
+	for _, col := range s.scope {
+		scope = append(scope, table.FieldMap[col].Value(strct).Interface())
+	}
+
+	expr, args := s.slugExpr(db.Dialect().Name(), table, base, scope)
+	returning := db.Dialect().Features().Has(feature.InsertReturning)
+	for attempt := 0; ; attempt++ {
+		q := db.NewInsert().Model(model).Value(s.column, expr, args...)
+		if returning {
+			q = q.Returning("?PKs, ?", bun.Ident(s.column))
+		}
+		_, err = q.Exec(ctx)
+		if err == nil {
+			break
+		}
+		if code, _ := classifyDBError(err); code != ErrorCodeUniqueViolation || attempt >= s.retries {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to insert slugged model").
+				WithMetadata(map[string]any{"table": table.Name, "slug": base, "attempts": attempt + 1})
+		}
+	}
+
+	if !returning {
+		err := db.NewSelect().Model(model).Column(s.column).WherePK().Scan(ctx)
+		if err != nil {
+			return apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read assigned slug").
+				WithMetadata(map[string]any{"table": table.Name})
+		}
+	}
+	return nil
+}
+
+func (s *Slugger) lookup(db bun.IDB, model any) (*schema.Table, *schema.Field, reflect.Value, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, nil, reflect.Value{}, apierrors.New("slugger model must be a non-nil struct pointer", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": fmt.Sprintf("%T", model)})
+	}
+
+	table := db.Dialect().Tables().Get(v.Elem().Type())
+	for _, col := range append([]string{s.column, s.source}, s.scope...) {
+		if col != "" && !table.HasField(col) {
+			return nil, nil, reflect.Value{}, apierrors.New("slugger column is not a field of the model", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"model": table.TypeName, "column": col})
+		}
+	}
+	return table, table.FieldMap[s.column], v.Elem(), nil
+}
+
+// base returns the slugified source, truncated to leave room for a suffix.
+func (s *Slugger) base(source string) string {
+	slug := Slugify(source, s.separator)
+	if limit := s.maxLength - slugSuffixReserve; len(slug) > limit {
+		slug = strings.TrimRight(slug[:limit], s.separator)
+	}
+	return slug
+}
+
+// slugExpr returns the expression picking base when it is free, or base
+// followed by one more than the highest numeric suffix in use. Reads go
+// through a derived table so MySQL accepts reading the insert target.
+func (s *Slugger) slugExpr(name dialect.Name, table *schema.Table, base string, scope []any) (string, []any) {
+	col := bun.Ident(s.column)
+	prefix := base + s.separator
+	start := len(prefix) + 1
+
+	var b strings.Builder
+	var args []any
+	writeScope := func() {
+		for i, scopeCol := range s.scope {
+			b.WriteString(" AND ? = ?")
+			args = append(args, bun.Ident(scopeCol), scope[i])
+		}
+	}
+
+	intType, textType := "INTEGER", "TEXT"
+	switch name {
+	case dialect.PG:
+		intType = "BIGINT"
+	case dialect.MySQL:
+		intType, textType = "UNSIGNED", "CHAR"
+	}
+
+	b.WriteString("CASE WHEN NOT EXISTS (SELECT 1 FROM (SELECT * FROM ?) AS slugs WHERE ? = ?")
+	args = append(args, table.SQLName, col, base)
+	writeScope()
+	b.WriteString(") THEN ? ELSE ")
+	args = append(args, base)
+
+	if name == dialect.MySQL {
+		b.WriteString("CONCAT(?, (")
+	} else {
+		b.WriteString("? || (")
+	}
+	args = append(args, prefix)
+
+	fmt.Fprintf(&b, "SELECT CAST(COALESCE(MAX(CAST(SUBSTR(?, ?) AS %s)), 1) + 1 AS %s)", intType, textType)
+	b.WriteString(" FROM (SELECT * FROM ?) AS slugs WHERE ? LIKE ? ESCAPE '!'")
+	args = append(args, col, start, table.SQLName, col, escapeLike(prefix)+"%")
+	writeScope()
+
+	switch name {
+	case dialect.PG:
+		b.WriteString(" AND SUBSTR(?, ?) ~ '^[0-9]+$'")
+		args = append(args, col, start)
+	case dialect.MySQL:
+		b.WriteString(" AND SUBSTR(?, ?) REGEXP '^[0-9]+$'")
+		args = append(args, col, start)
+	default:
+		b.WriteString(" AND SUBSTR(?, ?) <> '' AND SUBSTR(?, ?) NOT GLOB '*[^0-9]*'")
+		args = append(args, col, start, col, start)
+	}
+
+	if name == dialect.MySQL {
+		b.WriteString(")) END")
+	} else {
+		b.WriteString(") END")
+	}
+	return b.String(), args
+}
+
+// escapeLike escapes LIKE wildcards with '!', which unlike a backslash
+// needs no quoting on MySQL.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,97 @@
+package persistence
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type slugArticle struct {
+	bun.BaseModel `bun:"table:slug_articles"`
+
+	ID       int64  `bun:"id,pk,autoincrement"`
+	TenantID int64  `bun:"tenant_id,notnull"`
+	Title    string `bun:"title,notnull"`
+	Slug     string `bun:"slug,notnull"`
+}
+
+func TestSlugify(t *testing.T) {
+	assert.Equal(t, "hello-world", Slugify("  Hello, World! ", "-"))
+	assert.Equal(t, "creme-brulee-2024", Slugify("Crème Brûlée (2024)", "-"))
+	assert.Equal(t, "a_b", Slugify("a b", "_"))
+	assert.Equal(t, "", Slugify("!!!", "-"))
+}
+
+func TestSlugger_InsertSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*slugArticle)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "CREATE UNIQUE INDEX slug_articles_slug_idx ON slug_articles (tenant_id, slug)")
+	require.NoError(t, err)
+
+	slugger := NewSlugger("slug", "title", WithSlugScope("tenant_id"))
+
+	insert := func(tenant int64, title string) string {
+		article := &slugArticle{TenantID: tenant, Title: title}
+		require.NoError(t, slugger.Insert(ctx, db, article))
+		require.NotZero(t, article.ID)
+		return article.Slug
+	}
+
+	assert.Equal(t, "hello-world", insert(1, "Hello World"))
+	assert.Equal(t, "hello-world-2", insert(1, "Hello, World"))
+	assert.Equal(t, "hello-world-3", insert(1, "hello world!"))
+	assert.Equal(t, "hello-world", insert(2, "Hello World"))
+
+	// non numeric suffixes and similar prefixes do not count
+	assert.Equal(t, "hello-world-again", insert(1, "Hello World Again"))
+	assert.Equal(t, "hello-world-4", insert(1, "Hello World"))
+
+	// LIKE wildcards in the base are escaped
+	assert.Equal(t, "a", insert(3, "a"))
+	assert.Equal(t, "a-2", insert(3, "a"))
+
+	var slugs []string
+	require.NoError(t, db.NewSelect().Model((*slugArticle)(nil)).Column("slug").Where("tenant_id = 1").Order("id").Scan(ctx, &slugs))
+	assert.Equal(t, []string{"hello-world", "hello-world-2", "hello-world-3", "hello-world-again", "hello-world-4"}, slugs)
+}
+
+func TestSlugger_Errors(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	err := NewSlugger("missing", "title").Insert(ctx, db, &slugArticle{Title: "x"})
+	require.Error(t, err)
+
+	err = NewSlugger("slug", "title").Insert(ctx, db, &slugArticle{Title: "!!"})
+	assert.Equal(t, "EMPTY_SLUG", ErrorCode(err))
+}
+
+func TestSlugger_MaxLength(t *testing.T) {
+	slugger := NewSlugger("slug", "title", WithSlugMaxLength(20))
+	assert.Equal(t, "a-very-long", slugger.base("a very long title that keeps going"))
+}
+
+func TestSlugger_PostgresExpr(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	slugger := NewSlugger("slug", "title")
+	table := db.Dialect().Tables().Get(reflect.TypeOf(slugArticle{}))
+
+	expr, args := slugger.slugExpr(dialect.PG, table, "a_b", nil)
+	query := db.NewInsert().Model(&slugArticle{Title: "a b"}).Value("slug", expr, args...).String()
+
+	assert.Contains(t, query, `CASE WHEN NOT EXISTS (SELECT 1 FROM (SELECT * FROM "slug_articles") AS slugs WHERE "slug" = 'a_b')`)
+	assert.Contains(t, query, `"slug" LIKE 'a!_b-%' ESCAPE '!'`)
+	assert.Contains(t, query, `SUBSTR("slug", 5) ~ '^[0-9]+$'`)
+	assert.Contains(t, query, "AS BIGINT")
+}
@@ -0,0 +1,88 @@
+package persistence
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes recorded next to the bunotel query attributes.
+const (
+	SpanAttrRowsReturned  = "db.rows_returned"
+	SpanAttrTxAttempt     = "db.tx.attempt"
+	SpanAttrTxRetries     = "db.tx.retries"
+	SpanAttrPoolWait      = "db.pool.wait_ms"
+	SpanAttrPoolWaitCount = "db.pool.wait_count"
+	SpanAttrPoolInUse     = "db.pool.in_use"
+	SpanAttrPoolIdle      = "db.pool.idle"
+)
+
+type spanMetricsKey struct{}
+
+// spanPoolSnapshot is the pool state when a query started.
+type spanPoolSnapshot struct {
+	waitCount    int64
+	waitDuration time.Duration
+	inUse        int
+	idle         int
+}
+
+// spanMetricsHook adds row, retry and pool attributes to the span bunotel
+// opened for a query. It runs after bunotel in BeforeQuery, so it sees the
+// span, and before it in AfterQuery, so the span is still open.
+type spanMetricsHook struct{}
+
+func (spanMetricsHook) QueryHookKey() string {
+	return "span-metrics"
+}
+
+func (spanMetricsHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if event.DB == nil || !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+	stats := event.DB.DB.Stats()
+	return context.WithValue(ctx, spanMetricsKey{}, spanPoolSnapshot{
+		waitCount:    stats.WaitCount,
+		waitDuration: stats.WaitDuration,
+		inUse:        stats.InUse,
+		idle:         stats.Idle,
+	})
+}
+
+// AfterQuery records the rows a SELECT returned, the attempt of the
+// RunInTxWithRetry transaction and the pool usage. Pool waits are the
+// growth of the pool wait counters while the query ran, so under
+// concurrency they include the waits of other queries.
+func (spanMetricsHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, 7)
+	if event.Result != nil && strings.EqualFold(event.Operation(), "SELECT") {
+		if rows, err := event.Result.RowsAffected(); err == nil {
+			attrs = append(attrs, attribute.Int64(SpanAttrRowsReturned, rows))
+		}
+	}
+	if attempt := TxAttempt(ctx); attempt > 0 {
+		attrs = append(attrs,
+			attribute.Int(SpanAttrTxAttempt, attempt),
+			attribute.Int(SpanAttrTxRetries, attempt-1),
+		)
+	}
+	if before, ok := ctx.Value(spanMetricsKey{}).(spanPoolSnapshot); ok {
+		stats := event.DB.DB.Stats()
+		attrs = append(attrs,
+			attribute.Int64(SpanAttrPoolWait, (stats.WaitDuration-before.waitDuration).Milliseconds()),
+			attribute.Int64(SpanAttrPoolWaitCount, stats.WaitCount-before.waitCount),
+			attribute.Int(SpanAttrPoolInUse, before.inUse),
+			attribute.Int(SpanAttrPoolIdle, before.idle),
+		)
+	}
+	span.SetAttributes(attrs...)
+}
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingSpan keeps the attributes set on it.
+type recordingSpan struct {
+	noop.Span
+
+	mu    sync.Mutex
+	attrs map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) Attr(key string) (attribute.Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.attrs[attribute.Key(key)]
+	return v, ok
+}
+
+func newRecordingSpanContext() (context.Context, *recordingSpan) {
+	span := &recordingSpan{attrs: map[attribute.Key]attribute.Value{}}
+	return trace.ContextWithSpan(context.Background(), span), span
+}
+
+func TestSpanMetrics_RowsAndPool(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	db.AddQueryHook(spanMetricsHook{})
+
+	_, err := db.ExecContext(context.Background(), `CREATE TABLE span_rows (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	defer db.ExecContext(context.Background(), `DROP TABLE span_rows`)
+	_, err = db.ExecContext(context.Background(), `INSERT INTO span_rows (id) VALUES (1), (2), (3)`)
+	require.NoError(t, err)
+
+	ctx, span := newRecordingSpanContext()
+	var ids []int64
+	require.NoError(t, db.NewSelect().Table("span_rows").Column("id").Scan(ctx, &ids))
+	require.Len(t, ids, 3)
+
+	rows, ok := span.Attr(SpanAttrRowsReturned)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), rows.AsInt64())
+	for _, key := range []string{SpanAttrPoolWait, SpanAttrPoolWaitCount, SpanAttrPoolInUse, SpanAttrPoolIdle} {
+		_, ok := span.Attr(key)
+		assert.True(t, ok, key)
+	}
+	_, ok = span.Attr(SpanAttrTxAttempt)
+	assert.False(t, ok, "no attempt outside RunInTxWithRetry")
+}
+
+func TestSpanMetrics_TxRetries(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	db.AddQueryHook(spanMetricsHook{})
+
+	ctx, span := newRecordingSpanContext()
+	calls := 0
+	err := RunInTxWithRetry(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+		calls++
+		assert.Equal(t, calls, TxAttempt(ctx))
+		if _, err := tx.ExecContext(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		if calls < 2 {
+			return assert.AnError
+		}
+		return nil
+	}, TxRetryPolicy{
+		MaxAttempts: 3,
+		IsRetryable: func(error) bool { return true },
+	})
+	require.NoError(t, err)
+
+	attempt, ok := span.Attr(SpanAttrTxAttempt)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), attempt.AsInt64())
+	retries, _ := span.Attr(SpanAttrTxRetries)
+	assert.Equal(t, int64(1), retries.AsInt64())
+	assert.Zero(t, TxAttempt(context.Background()))
+}
+
+func TestSpanMetrics_RegisteredWithBunotel(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	applyQueryHooks(db, staticConfig{otelIdentifier: "app"}, &clientOptions{
+		bunotelEnabled:  true,
+		bunotelPriority: defaultBunotelPriority,
+	})
+
+	var keys []string
+	for _, hook := range getHookRegistryEntry(db).hooks {
+		keys = append(keys, hook.key)
+	}
+	require.Len(t, keys, 2)
+	assert.Contains(t, keys[1], "span-metrics", "span metrics run after bunotel")
+}
@@ -0,0 +1,155 @@
+package persistence
+
+import (
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Criteria is a dialect neutral SQL condition using "?" placeholders.
+// Identifiers should be passed as bun.Ident args.
+type Criteria struct {
+	Expr string
+	Args []any
+}
+
+// IsZero returns true when the criteria matches every row.
+func (c Criteria) IsZero() bool {
+	return strings.TrimSpace(c.Expr) == ""
+}
+
+// Specification expresses a domain rule that can be evaluated in
+// memory and translated into query criteria.
+type Specification[T any] interface {
+	IsSatisfiedBy(candidate T) bool
+	ToCriteria() Criteria
+}
+
+// NewSpecification builds a Specification from a predicate and
+// the equivalent SQL condition.
+//
+//	active := persistence.NewSpecification(
+//		func(u *User) bool { return u.Status == "active" },
+//		"? = ?", bun.Ident("status"), "active",
+//	)
+func NewSpecification[T any](predicate func(T) bool, expr string, args ...any) Specification[T] {
+	return funcSpecification[T]{
+		predicate: predicate,
+		criteria:  Criteria{Expr: expr, Args: args},
+	}
+}
+
+type funcSpecification[T any] struct {
+	predicate func(T) bool
+	criteria  Criteria
+}
+
+func (s funcSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	if s.predicate == nil {
+		return true
+	}
+	return s.predicate(candidate)
+}
+
+func (s funcSpecification[T]) ToCriteria() Criteria {
+	return s.criteria
+}
+
+// AndSpec is satisfied when all specs are satisfied.
+func AndSpec[T any](specs ...Specification[T]) Specification[T] {
+	return compositeSpecification[T]{op: "AND", specs: specs}
+}
+
+// OrSpec is satisfied when at least one spec is satisfied.
+func OrSpec[T any](specs ...Specification[T]) Specification[T] {
+	return compositeSpecification[T]{op: "OR", specs: specs}
+}
+
+// NotSpec negates spec.
+func NotSpec[T any](spec Specification[T]) Specification[T] {
+	return notSpecification[T]{spec: spec}
+}
+
+type compositeSpecification[T any] struct {
+	op    string
+	specs []Specification[T]
+}
+
+func (s compositeSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	if len(s.specs) == 0 {
+		return s.op == "AND"
+	}
+	for _, spec := range s.specs {
+		ok := spec.IsSatisfiedBy(candidate)
+		if s.op == "AND" && !ok {
+			return false
+		}
+		if s.op == "OR" && ok {
+			return true
+		}
+	}
+	return s.op == "AND"
+}
+
+func (s compositeSpecification[T]) ToCriteria() Criteria {
+	parts := make([]string, 0, len(s.specs))
+	var args []any
+	for _, spec := range s.specs {
+		criteria := spec.ToCriteria()
+		if criteria.IsZero() {
+			if s.op == "OR" {
+				// an unconditional branch makes the whole OR unconditional
+				return Criteria{}
+			}
+			continue
+		}
+		parts = append(parts, "("+criteria.Expr+")")
+		args = append(args, criteria.Args...)
+	}
+	if len(parts) == 0 {
+		if s.op == "OR" {
+			return Criteria{Expr: "1 = 0"}
+		}
+		return Criteria{}
+	}
+	return Criteria{
+		Expr: strings.Join(parts, " "+s.op+" "),
+		Args: args,
+	}
+}
+
+type notSpecification[T any] struct {
+	spec Specification[T]
+}
+
+func (s notSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	return !s.spec.IsSatisfiedBy(candidate)
+}
+
+func (s notSpecification[T]) ToCriteria() Criteria {
+	criteria := s.spec.ToCriteria()
+	if criteria.IsZero() {
+		return Criteria{Expr: "1 = 0"}
+	}
+	return Criteria{
+		Expr: "NOT (" + criteria.Expr + ")",
+		Args: criteria.Args,
+	}
+}
+
+// ApplySpecification adds the specification criteria to the query. The
+// query fails with ErrUnsafeIdentifier or ErrUnsafeExpression when the
+// criteria do not pass Criteria.Validate.
+func ApplySpecification[T any](q *bun.SelectQuery, spec Specification[T]) *bun.SelectQuery {
+	if spec == nil {
+		return q
+	}
+	criteria := spec.ToCriteria()
+	if criteria.IsZero() {
+		return q
+	}
+	if err := criteria.Validate(); err != nil {
+		return q.Err(err)
+	}
+	return q.Where(criteria.Expr, criteria.Args...)
+}
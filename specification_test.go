@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type specUser struct {
+	bun.BaseModel `bun:"table:users"`
+	ID            int64  `bun:"id,pk"`
+	Status        string `bun:"status"`
+	Age           int    `bun:"age"`
+}
+
+func TestSpecification_Combinators(t *testing.T) {
+	active := NewSpecification(func(u specUser) bool { return u.Status == "active" }, "? = ?", bun.Ident("status"), "active")
+	adult := NewSpecification(func(u specUser) bool { return u.Age >= 18 }, "? >= ?", bun.Ident("age"), 18)
+
+	spec := AndSpec(active, NotSpec(adult))
+	assert.True(t, spec.IsSatisfiedBy(specUser{Status: "active", Age: 10}))
+	assert.False(t, spec.IsSatisfiedBy(specUser{Status: "active", Age: 20}))
+
+	either := OrSpec(active, adult)
+	assert.True(t, either.IsSatisfiedBy(specUser{Status: "blocked", Age: 20}))
+	assert.False(t, either.IsSatisfiedBy(specUser{Status: "blocked", Age: 10}))
+
+	assert.True(t, AndSpec[specUser]().IsSatisfiedBy(specUser{}))
+	assert.False(t, OrSpec[specUser]().IsSatisfiedBy(specUser{}))
+}
+
+func TestApplySpecification(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+
+	active := NewSpecification(func(u specUser) bool { return u.Status == "active" }, "? = ?", bun.Ident("status"), "active")
+	adult := NewSpecification(func(u specUser) bool { return u.Age >= 18 }, "? >= ?", bun.Ident("age"), 18)
+	spec := OrSpec(AndSpec(active, adult), NotSpec(active))
+
+	query := ApplySpecification(db.NewSelect().Model((*specUser)(nil)), spec).String()
+	assert.Contains(t, query, `WHERE ((("status" = 'active') AND ("age" >= 18)) OR (NOT ("status" = 'active')))`)
+
+	all := NewSpecification[specUser](nil, "")
+	query = ApplySpecification(db.NewSelect().Model((*specUser)(nil)), AndSpec(all, active)).String()
+	assert.Contains(t, query, `WHERE (("status" = 'active'))`)
+
+	query = ApplySpecification(db.NewSelect().Model((*specUser)(nil)), OrSpec(all, active)).String()
+	assert.NotContains(t, query, "WHERE")
+}
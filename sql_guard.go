@@ -0,0 +1,140 @@
+package persistence
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrUnsafeIdentifier indicates a column, table or key name that is
+	// not a plain identifier and must not be interpolated into SQL.
+	ErrUnsafeIdentifier = errors.New("persistence: unsafe SQL identifier")
+	// ErrUnsafeExpression indicates raw SQL that looks like an injection
+	// attempt, such as a statement separator or a comment.
+	ErrUnsafeExpression = errors.New("persistence: unsafe SQL expression")
+)
+
+const maxIdentifierLength = 63
+
+var (
+	identifierPartRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	jsonKeyPartRE    = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// ValidateIdentifier returns an error wrapping ErrUnsafeIdentifier unless
+// name is a plain identifier, optionally qualified as table.column.
+func ValidateIdentifier(name string) error {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return unsafeIdentifier(name, "identifier has too many parts")
+	}
+	for _, part := range parts {
+		if len(part) > maxIdentifierLength {
+			return unsafeIdentifier(name, "identifier is too long")
+		}
+		if !identifierPartRE.MatchString(part) {
+			return unsafeIdentifier(name, "identifier contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// ValidateJSONKey returns an error wrapping ErrUnsafeIdentifier unless
+// key is a JSON key or dotted path of letters, digits, "_" and "-".
+func ValidateJSONKey(key string) error {
+	for _, part := range strings.Split(key, ".") {
+		if !jsonKeyPartRE.MatchString(part) {
+			return unsafeIdentifier(key, "JSON key contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// SafeIdent validates name and returns it as a bun.Ident, for column
+// names coming from requests such as sort or filter parameters.
+func SafeIdent(name string) (bun.Ident, error) {
+	if err := ValidateIdentifier(name); err != nil {
+		return "", err
+	}
+	return bun.Ident(name), nil
+}
+
+func unsafeIdentifier(name, reason string) error {
+	return apierrors.Wrap(ErrUnsafeIdentifier, apierrors.CategoryBadInput, reason).
+		WithTextCode("UNSAFE_IDENTIFIER").
+		WithMetadata(map[string]any{"identifier": name})
+}
+
+// IdentifierAllowlist maps public names, e.g. API sort keys, to the
+// columns they may select. Anything not listed is rejected.
+type IdentifierAllowlist struct {
+	columns map[string]string
+}
+
+// NewIdentifierAllowlist allows each of names as a column of the same name.
+func NewIdentifierAllowlist(names ...string) *IdentifierAllowlist {
+	a := &IdentifierAllowlist{columns: make(map[string]string, len(names))}
+	for _, name := range names {
+		a.Allow(name, name)
+	}
+	return a
+}
+
+// Allow maps name to column. It panics when column is not a valid
+// identifier, since allowlists are defined in code.
+func (a *IdentifierAllowlist) Allow(name, column string) *IdentifierAllowlist {
+	if err := ValidateIdentifier(column); err != nil {
+		panic(err)
+	}
+	a.columns[name] = column
+	return a
+}
+
+// Ident returns the column allowed for name as a bun.Ident, or an error
+// wrapping ErrUnsafeIdentifier.
+func (a *IdentifierAllowlist) Ident(name string) (bun.Ident, error) {
+	column, ok := a.columns[name]
+	if !ok {
+		return "", unsafeIdentifier(name, "identifier is not allowed")
+	}
+	return bun.Ident(column), nil
+}
+
+var suspiciousSQLRE = regexp.MustCompile(`;|--|/\*|\*/|\x00`)
+
+// ValidateExpression returns an error wrapping ErrUnsafeExpression when
+// expr contains a statement separator, a comment or a NUL byte, which
+// hand written conditions never need.
+func ValidateExpression(expr string) error {
+	if suspiciousSQLRE.MatchString(expr) {
+		return apierrors.Wrap(ErrUnsafeExpression, apierrors.CategoryBadInput, "SQL expression contains a separator or comment").
+			WithTextCode("UNSAFE_EXPRESSION").
+			WithMetadata(map[string]any{"expression": expr})
+	}
+	return nil
+}
+
+// Validate checks the criteria expression and its bun.Ident and
+// bun.Safe arguments, which are interpolated without escaping.
+func (c Criteria) Validate() error {
+	if err := ValidateExpression(c.Expr); err != nil {
+		return err
+	}
+	for _, arg := range c.Args {
+		switch v := arg.(type) {
+		case bun.Ident:
+			if err := ValidateIdentifier(string(v)); err != nil {
+				return err
+			}
+		case bun.Safe:
+			if err := ValidateExpression(string(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
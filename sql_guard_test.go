@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestValidateIdentifier(t *testing.T) {
+	for _, name := range []string{"id", "created_at", "u.name", "_tmp1"} {
+		assert.NoError(t, ValidateIdentifier(name), name)
+	}
+	for _, name := range []string{"", "1id", "name; DROP TABLE users", `na"me`, "a.b.c", "name--", "a b"} {
+		err := ValidateIdentifier(name)
+		assert.ErrorIs(t, err, ErrUnsafeIdentifier, name)
+	}
+	assert.Equal(t, "UNSAFE_IDENTIFIER", ErrorCode(ValidateIdentifier("x y")))
+
+	assert.NoError(t, ValidateJSONKey("plan"))
+	assert.NoError(t, ValidateJSONKey("billing.plan-id"))
+	assert.ErrorIs(t, ValidateJSONKey("plan') OR 1=1 --"), ErrUnsafeIdentifier)
+	assert.ErrorIs(t, ValidateJSONKey("a..b"), ErrUnsafeIdentifier)
+
+	ident, err := SafeIdent("email")
+	require.NoError(t, err)
+	assert.Equal(t, bun.Ident("email"), ident)
+}
+
+func TestIdentifierAllowlist(t *testing.T) {
+	allow := NewIdentifierAllowlist("name").Allow("newest", "created_at")
+
+	ident, err := allow.Ident("newest")
+	require.NoError(t, err)
+	assert.Equal(t, bun.Ident("created_at"), ident)
+
+	_, err = allow.Ident("password")
+	assert.ErrorIs(t, err, ErrUnsafeIdentifier)
+	assert.Panics(t, func() { allow.Allow("bad", "x; y") })
+}
+
+func TestCriteriaValidate(t *testing.T) {
+	assert.NoError(t, Criteria{Expr: "? = ?", Args: []any{bun.Ident("status"), "a;b"}}.Validate())
+	assert.ErrorIs(t, Criteria{Expr: "status = 1; DELETE FROM users"}.Validate(), ErrUnsafeExpression)
+	assert.ErrorIs(t, Criteria{Expr: "? = 1", Args: []any{bun.Ident("id /* x */")}}.Validate(), ErrUnsafeIdentifier)
+	assert.ErrorIs(t, Criteria{Expr: "?", Args: []any{bun.Safe("1=1 --")}}.Validate(), ErrUnsafeExpression)
+}
+
+func TestApplySpecification_RejectsUnsafeCriteria(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	spec := NewSpecification(func(int) bool { return true }, "? = 1", bun.Ident("id) OR (1"))
+	var out []map[string]any
+	err := ApplySpecification(db.NewSelect().TableExpr("sqlite_master"), spec).Scan(context.Background(), &out)
+	require.ErrorIs(t, err, ErrUnsafeIdentifier)
+}
+
+func TestVirtualFieldExprChecked(t *testing.T) {
+	assert.Equal(t, "metadata->>'it''s'", VirtualFieldExpr(VirtualDialectPostgres, "metadata", "it's", false))
+
+	expr, err := VirtualFieldExprChecked(VirtualDialectSQLite, "metadata", "plan", false)
+	require.NoError(t, err)
+	assert.Equal(t, "json_extract(metadata, '$.plan')", expr)
+
+	_, err = VirtualFieldExprChecked(VirtualDialectSQLite, "metadata", "plan') --", false)
+	assert.ErrorIs(t, err, ErrUnsafeIdentifier)
+	_, err = VirtualFieldExprChecked(VirtualDialectSQLite, "metadata)", "plan", false)
+	assert.ErrorIs(t, err, ErrUnsafeIdentifier)
+}
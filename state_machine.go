@@ -0,0 +1,229 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+var (
+	// ErrInvalidTransition indicates a transition that is not allowed
+	// from the current state.
+	ErrInvalidTransition = errors.New("persistence: invalid state transition")
+	// ErrStaleState indicates the row changed state since the model was read.
+	ErrStaleState = errors.New("persistence: state changed concurrently")
+)
+
+// StateTransition is the domain event emitted by StateMachine.Transition.
+type StateTransition struct {
+	Table  string
+	Column string
+	PK     map[string]any
+	From   string
+	To     string
+	At     time.Time
+}
+
+// StateMachine enforces the allowed transitions of a status column.
+type StateMachine struct {
+	column      string
+	transitions map[string][]string
+	publisher   EventPublisher
+}
+
+// NewStateMachine creates a state machine for column where transitions
+// maps every state to the states it can move to. Terminal states may be
+// omitted from the keys.
+func NewStateMachine(column string, transitions map[string][]string) *StateMachine {
+	copied := make(map[string][]string, len(transitions))
+	for from, to := range transitions {
+		copied[from] = slices.Clone(to)
+	}
+	return &StateMachine{column: column, transitions: copied}
+}
+
+// SetEventPublisher publishes transition events within the transition
+// transaction. Without a publisher, events are recorded on models
+// embedding EventRecorder so a UnitOfWork can publish them.
+func (sm *StateMachine) SetEventPublisher(publisher EventPublisher) *StateMachine {
+	sm.publisher = publisher
+	return sm
+}
+
+// Column returns the status column.
+func (sm *StateMachine) Column() string {
+	return sm.column
+}
+
+// States returns every known state, sorted.
+func (sm *StateMachine) States() []string {
+	var states []string
+	for from, to := range sm.transitions {
+		states = append(states, from)
+		states = append(states, to...)
+	}
+	slices.Sort(states)
+	return slices.Compact(states)
+}
+
+// Can reports whether moving from one state to another is allowed.
+func (sm *StateMachine) Can(from, to string) bool {
+	return slices.Contains(sm.transitions[from], to)
+}
+
+// Validate returns an error wrapping ErrInvalidTransition when moving
+// from one state to another is not allowed.
+func (sm *StateMachine) Validate(from, to string) error {
+	if sm.Can(from, to) {
+		return nil
+	}
+	return apierrors.Wrap(ErrInvalidTransition, apierrors.CategoryValidation,
+		fmt.Sprintf("%s cannot transition from %q to %q", sm.column, from, to),
+	).WithTextCode("INVALID_TRANSITION").WithMetadata(map[string]any{
+		"column":  sm.column,
+		"from":    from,
+		"to":      to,
+		"allowed": slices.Clone(sm.transitions[from]),
+	})
+}
+
+// Transition moves model to state. The update is guarded on the current
+// state of model, so a concurrent transition fails with ErrStaleState
+// instead of being overwritten. On success the model field is updated and
+// a StateTransition event is emitted.
+func (sm *StateMachine) Transition(ctx context.Context, db bun.IDB, model any, to string) error {
+	table, field, strct, err := sm.lookup(db, model)
+	if err != nil {
+		return err
+	}
+	value := field.Value(strct)
+	from := value.String()
+	if err := sm.Validate(from, to); err != nil {
+		return err
+	}
+
+	event := StateTransition{
+		Table:  table.Name,
+		Column: sm.column,
+		PK:     make(map[string]any, len(table.PKs)),
+		From:   from,
+		To:     to,
+		At:     time.Now().UTC(),
+	}
+	for _, pk := range table.PKs {
+		event.PK[pk.Name] = pk.Value(strct).Interface()
+	}
+
+	err = RunInTx(ctx, db, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model(model).
+			Set("? = ?", bun.Ident(sm.column), to).
+			WherePK().
+			Where("?TableAlias.? = ?", bun.Ident(sm.column), from).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return apierrors.Wrap(ErrStaleState, apierrors.CategoryConflict,
+				fmt.Sprintf("%s is no longer %q", table.Name, from),
+			).WithTextCode("STALE_STATE").WithMetadata(map[string]any{
+				"table":  table.Name,
+				"column": sm.column,
+				"from":   from,
+				"to":     to,
+			})
+		}
+		if sm.publisher != nil {
+			return sm.publisher.Publish(ctx, tx, []any{event})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	value.SetString(to)
+	if recorder, ok := model.(interface{ RecordEvent(...any) }); ok && sm.publisher == nil {
+		recorder.RecordEvent(event)
+	}
+	return nil
+}
+
+func (sm *StateMachine) lookup(db bun.IDB, model any) (*schema.Table, *schema.Field, reflect.Value, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, nil, reflect.Value{}, apierrors.New("state machine model must be a non-nil struct pointer", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": fmt.Sprintf("%T", model)})
+	}
+
+	table := db.Dialect().Tables().Get(v.Elem().Type())
+	field, ok := table.FieldMap[sm.column]
+	if !ok || field.IndirectType.Kind() != reflect.String {
+		return nil, nil, reflect.Value{}, apierrors.New("state machine column must be a string field of the model", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": table.TypeName, "column": sm.column})
+	}
+	if len(table.PKs) == 0 {
+		return nil, nil, reflect.Value{}, apierrors.New("state machine model requires a primary key", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": table.TypeName})
+	}
+	return table, field, v.Elem(), nil
+}
+
+// CheckExpr returns the CHECK expression restricting the column to the
+// known states.
+func (sm *StateMachine) CheckExpr() string {
+	states := sm.States()
+	quoted := make([]string, 0, len(states))
+	for _, state := range states {
+		quoted = append(quoted, "'"+strings.ReplaceAll(state, "'", "''")+"'")
+	}
+	return fmt.Sprintf("%s IN (%s)", sm.column, strings.Join(quoted, ", "))
+}
+
+// CheckConstraintName returns the constraint name used for table.
+func (sm *StateMachine) CheckConstraintName(table string) string {
+	return fmt.Sprintf("%s_%s_check", table, sm.column)
+}
+
+// CheckConstraintMigrationFS returns up and down migrations adding the
+// CHECK constraint to the table of model, named
+// <version>_<table>_<column>_check. SQLite cannot add constraints to
+// existing tables, use CheckExpr in its CREATE TABLE statement instead.
+func (sm *StateMachine) CheckConstraintMigrationFS(db bun.IDB, model any, version string) (fstest.MapFS, error) {
+	typ := modelType(reflect.TypeOf(model))
+	if typ == nil {
+		return nil, apierrors.New("state machine model must be a struct", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": fmt.Sprintf("%T", model)})
+	}
+	table := db.Dialect().Tables().Get(typ).Name
+	name := sm.CheckConstraintName(table)
+
+	var down string
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		down = fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;\n", table, name)
+	case dialect.MySQL:
+		down = fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;\n", table, name)
+	default:
+		return nil, apierrors.New("check constraints cannot be added to existing tables for dialect", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"dialect": dialectName(db), "table": table})
+	}
+	up := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s);\n", table, name, sm.CheckExpr())
+
+	base := fmt.Sprintf("%s_%s", version, name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: []byte(up)},
+		base + ".down.sql": {Data: []byte(down)},
+	}, nil
+}
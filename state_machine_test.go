@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+)
+
+type stateOrder struct {
+	bun.BaseModel `bun:"table:state_orders"`
+	EventRecorder
+
+	ID     int64  `bun:"id,pk,autoincrement"`
+	Status string `bun:"status,notnull"`
+}
+
+func newOrderStateMachine() *StateMachine {
+	return NewStateMachine("status", map[string][]string{
+		"pending": {"paid", "canceled"},
+		"paid":    {"shipped", "refunded"},
+	})
+}
+
+func TestStateMachine_Validate(t *testing.T) {
+	sm := newOrderStateMachine()
+
+	assert.Equal(t, []string{"canceled", "paid", "pending", "refunded", "shipped"}, sm.States())
+	assert.True(t, sm.Can("pending", "paid"))
+	assert.False(t, sm.Can("shipped", "pending"))
+
+	err := sm.Validate("pending", "shipped")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	assert.Equal(t, "INVALID_TRANSITION", ErrorCode(err))
+}
+
+func TestStateMachine_TransitionSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*stateOrder)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	order := &stateOrder{Status: "pending"}
+	_, err = db.NewInsert().Model(order).Exec(ctx)
+	require.NoError(t, err)
+
+	sm := newOrderStateMachine()
+	require.NoError(t, sm.Transition(ctx, db, order, "paid"))
+	assert.Equal(t, "paid", order.Status)
+
+	events := order.PullEvents()
+	require.Len(t, events, 1)
+	event := events[0].(StateTransition)
+	assert.Equal(t, "pending", event.From)
+	assert.Equal(t, "paid", event.To)
+	assert.Equal(t, order.ID, event.PK["id"])
+
+	err = sm.Transition(ctx, db, order, "pending")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	stale := &stateOrder{ID: order.ID, Status: "pending"}
+	err = sm.Transition(ctx, db, stale, "canceled")
+	require.ErrorIs(t, err, ErrStaleState)
+	assert.Equal(t, "pending", stale.Status)
+
+	var published []any
+	sm.SetEventPublisher(EventPublisherFunc(func(_ context.Context, _ bun.Tx, events []any) error {
+		published = append(published, events...)
+		return nil
+	}))
+	require.NoError(t, sm.Transition(ctx, db, order, "shipped"))
+	require.Len(t, published, 1)
+	assert.Empty(t, order.PullEvents())
+
+	var status string
+	require.NoError(t, db.NewSelect().Model((*stateOrder)(nil)).Column("status").Where("id = ?", order.ID).Scan(ctx, &status))
+	assert.Equal(t, "shipped", status)
+}
+
+func TestStateMachine_CheckConstraintMigrationFS(t *testing.T) {
+	sm := newOrderStateMachine()
+	db := bun.NewDB(nil, pgdialect.New())
+
+	fsys, err := sm.CheckConstraintMigrationFS(db, (*stateOrder)(nil), "20240101000000")
+	require.NoError(t, err)
+
+	up := string(fsys["20240101000000_state_orders_status_check.up.sql"].Data)
+	assert.Equal(t, "ALTER TABLE state_orders ADD CONSTRAINT state_orders_status_check CHECK (status IN ('canceled', 'paid', 'pending', 'refunded', 'shipped'));\n", up)
+	assert.Contains(t, string(fsys["20240101000000_state_orders_status_check.down.sql"].Data), "DROP CONSTRAINT IF EXISTS")
+
+	_, err = sm.CheckConstraintMigrationFS(bun.NewDB(nil, sqlitedialect.New()), (*stateOrder)(nil), "20240101000000")
+	require.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package persistence
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNamedQueryNotFound is returned when running an unregistered named query.
+var ErrNamedQueryNotFound = errors.New("persistence: named query not found")
+
+// StatementCacheStats reports prepared statement cache counters
+type StatementCacheStats struct {
+	Size      int
+	Capacity  int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// StatementCache is a registry of named SQL queries backed by an LRU of
+// prepared statements. database/sql prepares each statement lazily on
+// every pooled connection it runs on, so a cached statement is reused
+// per connection. Evicted statements are closed once the last caller
+// using them has finished.
+//
+// With a capacity of zero queries run unprepared.
+type StatementCache struct {
+	db       *sql.DB
+	capacity int
+
+	mu      sync.Mutex
+	queries map[string]string
+	lru     *list.List
+	stmts   map[string]*list.Element
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+type cachedStmt struct {
+	name    string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// NewStatementCache creates a cache holding up to capacity statements.
+func NewStatementCache(db *sql.DB, capacity int) *StatementCache {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &StatementCache{
+		db:       db,
+		capacity: capacity,
+		queries:  make(map[string]string),
+		lru:      list.New(),
+		stmts:    make(map[string]*list.Element),
+	}
+}
+
+// Register adds a named query. Registering a name again replaces the
+// query and drops its cached statement.
+func (c *StatementCache) Register(name, query string) *StatementCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.queries[name]; ok && prev != query {
+		c.removeLocked(name)
+	}
+	c.queries[name] = query
+	return c
+}
+
+// ExecContext runs the named query
+func (c *StatementCache) ExecContext(ctx context.Context, name string, args ...any) (sql.Result, error) {
+	cs, query, err := c.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cs == nil {
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	defer c.release(cs)
+	return cs.stmt.ExecContext(ctx, args...)
+}
+
+// QueryContext runs the named query returning rows
+func (c *StatementCache) QueryContext(ctx context.Context, name string, args ...any) (*sql.Rows, error) {
+	cs, query, err := c.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cs == nil {
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	defer c.release(cs)
+	return cs.stmt.QueryContext(ctx, args...)
+}
+
+// QueryRowContext runs the named query returning a single row
+func (c *StatementCache) QueryRowContext(ctx context.Context, name string, args ...any) (*sql.Row, error) {
+	cs, query, err := c.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cs == nil {
+		return c.db.QueryRowContext(ctx, query, args...), nil
+	}
+	defer c.release(cs)
+	return cs.stmt.QueryRowContext(ctx, args...), nil
+}
+
+// Prime prepares registered queries until the cache is full and
+// returns how many statements are cached. It does nothing when the
+// cache is disabled.
+func (c *StatementCache) Prime(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.queries))
+	for name := range c.queries {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		if c.capacity == 0 || c.Stats().Size >= c.capacity {
+			break
+		}
+		cs, _, err := c.acquire(ctx, name)
+		if err != nil {
+			return c.Stats().Size, err
+		}
+		c.release(cs)
+	}
+	return c.Stats().Size, nil
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *StatementCache) Stats() StatementCacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return StatementCacheStats{
+		Size:      size,
+		Capacity:  c.capacity,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// Close closes every cached statement
+func (c *StatementCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for name := range c.stmts {
+		if err := c.removeLocked(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// acquire returns the cached statement for name with a reference held,
+// preparing it on a miss. Rows and Row values returned by a statement
+// stay valid after release; database/sql defers the close until they
+// are closed. A nil statement means the query runs unprepared.
+func (c *StatementCache) acquire(ctx context.Context, name string) (*cachedStmt, string, error) {
+	c.mu.Lock()
+	query, ok := c.queries[name]
+	if !ok {
+		c.mu.Unlock()
+		return nil, "", fmt.Errorf("%w: %s", ErrNamedQueryNotFound, name)
+	}
+	if c.capacity == 0 {
+		c.mu.Unlock()
+		return nil, query, nil
+	}
+	if el, ok := c.stmts[name]; ok {
+		c.hits.Add(1)
+		c.lru.MoveToFront(el)
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		c.mu.Unlock()
+		return cs, query, nil
+	}
+	c.misses.Add(1)
+	c.mu.Unlock()
+
+	// Prepare outside the lock so a slow round trip does not block
+	// callers of other statements.
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, "", fmt.Errorf("persistence: prepare %s: %w", name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.stmts[name]; ok {
+		// Another caller cached it first.
+		_ = stmt.Close()
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		c.lru.MoveToFront(el)
+		return cs, query, nil
+	}
+	cs := &cachedStmt{name: name, stmt: stmt, refs: 1}
+	if c.queries[name] != query {
+		// Re-registered while preparing: use it once and close it.
+		cs.evicted = true
+		return cs, query, nil
+	}
+	c.stmts[name] = c.lru.PushFront(cs)
+
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back().Value.(*cachedStmt)
+		_ = c.removeLocked(oldest.name)
+		c.evictions.Add(1)
+	}
+	return cs, query, nil
+}
+
+// release drops a reference taken by acquire, closing the statement
+// when it was evicted and this was its last user.
+func (c *StatementCache) release(cs *cachedStmt) {
+	if cs == nil {
+		return
+	}
+	c.mu.Lock()
+	cs.refs--
+	closeNow := cs.evicted && cs.refs == 0
+	c.mu.Unlock()
+	if closeNow {
+		_ = cs.stmt.Close()
+	}
+}
+
+// removeLocked drops name from the cache. The statement is closed now
+// if unused, otherwise by the last release.
+func (c *StatementCache) removeLocked(name string) error {
+	el, ok := c.stmts[name]
+	if !ok {
+		return nil
+	}
+	delete(c.stmts, name)
+	c.lru.Remove(el)
+	cs := el.Value.(*cachedStmt)
+	cs.evicted = true
+	if cs.refs > 0 {
+		return nil
+	}
+	return cs.stmt.Close()
+}
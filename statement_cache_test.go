@@ -0,0 +1,115 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementCache_LRU(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.ExecContext(ctx, "CREATE TABLE stmt_items (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+
+	cache := NewStatementCache(db.DB, 1).
+		Register("insert", "INSERT INTO stmt_items (id, name) VALUES (?, ?)").
+		Register("name", "SELECT name FROM stmt_items WHERE id = ?")
+	defer cache.Close()
+
+	_, err = cache.ExecContext(ctx, "insert", 1, "a")
+	require.NoError(t, err)
+	_, err = cache.ExecContext(ctx, "insert", 2, "b")
+	require.NoError(t, err)
+
+	row, err := cache.QueryRowContext(ctx, "name", 2)
+	require.NoError(t, err)
+	var name string
+	require.NoError(t, row.Scan(&name))
+	assert.Equal(t, "b", name)
+
+	stats := cache.Stats()
+	assert.Equal(t, 1, stats.Size)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(1), stats.Evictions)
+
+	_, err = cache.ExecContext(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNamedQueryNotFound)
+}
+
+func TestStatementCache_DisabledRunsUnprepared(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	cache := NewStatementCache(db.DB, 0).Register("one", "SELECT 1")
+
+	rows, err := cache.QueryContext(ctx, "one")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Equal(t, StatementCacheStats{}, cache.Stats())
+}
+
+func TestStatementCache_EvictionWaitsForUsers(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	cache := NewStatementCache(db.DB, 1).
+		Register("one", "SELECT 1").
+		Register("two", "SELECT 2")
+	defer cache.Close()
+
+	cs, _, err := cache.acquire(ctx, "one")
+	require.NoError(t, err)
+
+	// Evict "one" while it is still held.
+	_, err = cache.ExecContext(ctx, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cache.Stats().Evictions)
+
+	var n int
+	require.NoError(t, cs.stmt.QueryRowContext(ctx).Scan(&n))
+	assert.Equal(t, 1, n)
+	cache.release(cs)
+
+	err = cs.stmt.QueryRowContext(ctx).Scan(&n)
+	assert.Error(t, err, "statement closes after its last release")
+}
+
+func TestStatementCache_ConcurrentEviction(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	cache := NewStatementCache(db.DB, 1).
+		Register("one", "SELECT 1").
+		Register("two", "SELECT 2")
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := range 200 {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			var n int
+			row, err := cache.QueryRowContext(ctx, name)
+			if err == nil {
+				err = row.Scan(&n)
+			}
+			errs <- err
+		}([]string{"one", "two"}[i%2])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,176 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// ErrTableStatsUnsupported indicates table statistics on a dialect other
+// than Postgres and SQLite.
+var ErrTableStatsUnsupported = errors.New("persistence: table statistics require postgres or sqlite")
+
+// TableStats is the size and health of a table. Sizes include the
+// indexes, and on Postgres the TOAST data, of the table.
+type TableStats struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	// RowEstimate is approximate, -1 when unknown.
+	RowEstimate int64 `json:"row_estimate"`
+	TotalBytes  int64 `json:"total_bytes"`
+	IndexBytes  int64 `json:"index_bytes"`
+	// DeadTuples is only reported by Postgres.
+	DeadTuples int64 `json:"dead_tuples"`
+	Pages      int64 `json:"pages"`
+	// LastVacuum and LastAnalyze are the latest manual or automatic runs
+	// on Postgres, nil when never run.
+	LastVacuum  *time.Time `json:"last_vacuum,omitempty"`
+	LastAnalyze *time.Time `json:"last_analyze,omitempty"`
+}
+
+// QualifiedName returns the table name prefixed with its schema, if any.
+func (t TableStats) QualifiedName() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// Stats reads table statistics from the database catalog, for
+// dashboards and for deciding when to prune or partition a table.
+type Stats struct {
+	db bun.IDB
+}
+
+// NewStats creates a statistics reader for db.
+func NewStats(db bun.IDB) *Stats {
+	return &Stats{db: db}
+}
+
+// Stats returns a statistics reader for the primary database.
+func (c Client) Stats() *Stats {
+	return NewStats(c.db)
+}
+
+// Tables returns the statistics of every user table, ordered by schema
+// and name. Postgres reads pg_stat_user_tables and pg_class, so
+// estimates are as fresh as the last ANALYZE. SQLite sums the pages of
+// the dbstat virtual table, leaving sizes zero when it is not compiled
+// in, and estimates rows from the largest rowid.
+func (s *Stats) Tables(ctx context.Context) ([]TableStats, error) {
+	switch s.db.Dialect().Name() {
+	case dialect.PG:
+		return s.postgresTables(ctx)
+	case dialect.SQLite:
+		return s.sqliteTables(ctx)
+	default:
+		return nil, apierrors.Wrap(ErrTableStatsUnsupported, apierrors.CategoryBadInput, "table statistics require postgres or sqlite").
+			WithMetadata(map[string]any{"dialect": s.db.Dialect().Name().String()})
+	}
+}
+
+// Table returns the statistics of table, optionally schema qualified.
+func (s *Stats) Table(ctx context.Context, table string) (*TableStats, error) {
+	tables, err := s.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tables {
+		if tables[i].QualifiedName() == table || (!strings.Contains(table, ".") && tables[i].Name == table) {
+			return &tables[i], nil
+		}
+	}
+	return nil, apierrors.New("table not found", apierrors.CategoryNotFound).
+		WithMetadata(map[string]any{"table": table})
+}
+
+func (s *Stats) postgresTables(ctx context.Context) ([]TableStats, error) {
+	// reltuples is -1 before the first ANALYZE on Postgres 14 and later
+	rows, err := s.db.QueryContext(ctx, `SELECT s.schemaname, s.relname,
+	CASE WHEN c.reltuples < 0 THEN s.n_live_tup ELSE c.reltuples::bigint END,
+	pg_total_relation_size(c.oid),
+	pg_indexes_size(c.oid),
+	s.n_dead_tup,
+	c.relpages::bigint,
+	GREATEST(s.last_vacuum, s.last_autovacuum),
+	GREATEST(s.last_analyze, s.last_autoanalyze)
+FROM pg_stat_user_tables s
+JOIN pg_class c ON c.oid = s.relid
+ORDER BY s.schemaname, s.relname`)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics")
+	}
+	return scanTableStats(rows, func(t *TableStats, vacuum, analyze *sql.NullTime) []any {
+		return []any{&t.Schema, &t.Name, &t.RowEstimate, &t.TotalBytes, &t.IndexBytes, &t.DeadTuples, &t.Pages, vacuum, analyze}
+	})
+}
+
+func (s *Stats) sqliteTables(ctx context.Context) ([]TableStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT t.name,
+	COALESCE(SUM(d.pgsize), 0),
+	COALESCE(SUM(CASE WHEN m.type = 'index' THEN d.pgsize END), 0),
+	COUNT(d.pageno)
+FROM sqlite_master t
+JOIN sqlite_master m ON m.tbl_name = t.name AND m.type IN ('table', 'index')
+LEFT JOIN dbstat d ON d.name = m.name
+WHERE t.type = 'table' AND t.name NOT LIKE 'sqlite_%'
+GROUP BY t.name
+ORDER BY t.name`)
+	columns := func(t *TableStats, _, _ *sql.NullTime) []any {
+		return []any{&t.Name, &t.TotalBytes, &t.IndexBytes, &t.Pages}
+	}
+	if err != nil {
+		// dbstat is an optional compile time feature
+		rows, err = s.db.QueryContext(ctx, `SELECT name FROM sqlite_master
+WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+ORDER BY name`)
+		columns = func(t *TableStats, _, _ *sql.NullTime) []any {
+			return []any{&t.Name}
+		}
+	}
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics")
+	}
+	tables, err := scanTableStats(rows, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		tables[i].RowEstimate = -1
+		// WITHOUT ROWID tables have no rowid to estimate from
+		if estimate, ok, err := EstimateTableRows(ctx, s.db, tables[i].Name); err == nil && ok {
+			tables[i].RowEstimate = estimate
+		}
+	}
+	return tables, nil
+}
+
+func scanTableStats(rows *sql.Rows, columns func(t *TableStats, vacuum, analyze *sql.NullTime) []any) ([]TableStats, error) {
+	defer rows.Close()
+	var tables []TableStats
+	for rows.Next() {
+		var t TableStats
+		var vacuum, analyze sql.NullTime
+		if err := rows.Scan(columns(&t, &vacuum, &analyze)...); err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics")
+		}
+		if vacuum.Valid {
+			t.LastVacuum = &vacuum.Time
+		}
+		if analyze.Valid {
+			t.LastAnalyze = &analyze.Time
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read table statistics")
+	}
+	return tables, nil
+}
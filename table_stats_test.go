@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func TestStats_PostgresTables(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	vacuumed := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM pg_stat_user_tables s`)).
+		WillReturnRows(sqlmock.NewRows([]string{"schemaname", "relname", "rows", "total", "index", "dead", "pages", "vacuum", "analyze"}).
+			AddRow("public", "events", 1200000, 524288000, 104857600, 3400, 64000, vacuumed, nil).
+			AddRow("public", "users", 42, 65536, 32768, 0, 1, nil, nil))
+
+	tables, err := NewStats(db).Tables(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tables, 2)
+
+	events := tables[0]
+	assert.Equal(t, "public.events", events.QualifiedName())
+	assert.Equal(t, int64(1200000), events.RowEstimate)
+	assert.Equal(t, int64(524288000), events.TotalBytes)
+	assert.Equal(t, int64(104857600), events.IndexBytes)
+	assert.Equal(t, int64(3400), events.DeadTuples)
+	assert.Equal(t, int64(64000), events.Pages)
+	require.NotNil(t, events.LastVacuum)
+	assert.True(t, vacuumed.Equal(*events.LastVacuum))
+	assert.Nil(t, events.LastAnalyze)
+	assert.Nil(t, tables[1].LastVacuum)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStats_SQLiteTables(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE stats_events (id INTEGER PRIMARY KEY, payload TEXT)`)
+	require.NoError(t, err)
+	defer db.ExecContext(ctx, `DROP TABLE stats_events`)
+	_, err = db.ExecContext(ctx, `CREATE INDEX stats_events_payload_idx ON stats_events (payload)`)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		_, err = db.ExecContext(ctx, `INSERT INTO stats_events (payload) VALUES (?)`, "payload")
+		require.NoError(t, err)
+	}
+
+	table, err := NewStats(db).Table(ctx, "stats_events")
+	require.NoError(t, err)
+	assert.Equal(t, "stats_events", table.Name)
+	assert.Equal(t, int64(50), table.RowEstimate)
+	assert.Equal(t, int64(2), table.Pages)
+	assert.Positive(t, table.IndexBytes)
+	assert.Greater(t, table.TotalBytes, table.IndexBytes)
+	assert.Zero(t, table.DeadTuples)
+
+	_, err = NewStats(db).Table(ctx, "stats_missing")
+	require.Error(t, err)
+}
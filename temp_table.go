@@ -0,0 +1,181 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// TempTable is a session temporary table mirroring the schema of a
+// model table. Temporary tables are only visible to the connection that
+// created them, so a TempTable must be used through a bun.Conn or bun.Tx,
+// see WithTempTable.
+type TempTable struct {
+	db     bun.IDB
+	Name   string
+	source *schema.Table
+}
+
+// CreateTempTable creates an empty temporary table named name with the
+// columns of the table of T.
+func CreateTempTable[T any](ctx context.Context, db bun.IDB, name string) (*TempTable, error) {
+	source := db.Dialect().Tables().Get(reflect.TypeOf((*T)(nil)).Elem())
+
+	_, err := db.NewRaw(
+		"CREATE TEMPORARY TABLE ? AS SELECT * FROM ? WHERE 1 = 0",
+		bun.Ident(name), source.SQLName,
+	).Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: create temp table %s: %w", name, err)
+	}
+	return &TempTable{db: db, Name: name, source: source}, nil
+}
+
+// WithTempTable creates a temporary table for T on a dedicated
+// connection, runs fn and drops the table afterwards.
+func WithTempTable[T any](ctx context.Context, db *bun.DB, name string, fn func(ctx context.Context, tmp *TempTable) error) (err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("persistence: temp table connection: %w", err)
+	}
+	defer conn.Close()
+
+	tmp, err := CreateTempTable[T](ctx, conn, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if dropErr := tmp.Drop(context.WithoutCancel(ctx)); err == nil {
+			err = dropErr
+		}
+	}()
+
+	return fn(ctx, tmp)
+}
+
+// Insert loads rows, a slice of the model, into the temp table.
+func (t *TempTable) Insert(ctx context.Context, rows any) (int64, error) {
+	res, err := t.db.NewInsert().Model(rows).ModelTableExpr("?", bun.Ident(t.Name)).Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: insert into temp table %s: %w", t.Name, err)
+	}
+	return res.RowsAffected()
+}
+
+// MergeUpdate updates the source table from the temp table, matching
+// rows on keyColumns and copying setColumns. keyColumns defaults to the
+// primary key and setColumns to every other column.
+func (t *TempTable) MergeUpdate(ctx context.Context, keyColumns, setColumns []string) (int64, error) {
+	keyColumns, setColumns = t.columns(keyColumns, setColumns)
+	if len(setColumns) == 0 {
+		return 0, nil
+	}
+
+	target := t.source.SQLName
+	tmp := bun.Ident(t.Name)
+
+	var b strings.Builder
+	args := []any{}
+	if t.db.Dialect().Name() == dialect.MySQL {
+		b.WriteString("UPDATE ? JOIN ? ON ")
+		args = append(args, target, tmp)
+		t.writeJoin(&b, &args, keyColumns)
+		b.WriteString(" SET ")
+		t.writeSet(&b, &args, setColumns, target)
+	} else {
+		b.WriteString("UPDATE ? SET ")
+		args = append(args, target)
+		t.writeSet(&b, &args, setColumns, nil)
+		b.WriteString(" FROM ? WHERE ")
+		args = append(args, tmp)
+		t.writeJoin(&b, &args, keyColumns)
+	}
+
+	res, err := t.db.NewRaw(b.String(), args...).Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: merge update from %s: %w", t.Name, err)
+	}
+	return res.RowsAffected()
+}
+
+// InsertMissing copies temp table rows whose keyColumns do not match a
+// row of the source table. columns defaults to every column.
+func (t *TempTable) InsertMissing(ctx context.Context, keyColumns, columns []string) (int64, error) {
+	keyColumns, _ = t.columns(keyColumns, nil)
+	if len(columns) == 0 {
+		for _, field := range t.source.Fields {
+			columns = append(columns, field.Name)
+		}
+	}
+
+	var b strings.Builder
+	args := []any{t.source.SQLName, identList(columns), identList(columns), bun.Ident(t.Name), t.source.SQLName}
+	b.WriteString("INSERT INTO ? (?) SELECT ? FROM ? WHERE NOT EXISTS (SELECT 1 FROM ? WHERE ")
+	t.writeJoin(&b, &args, keyColumns)
+	b.WriteString(")")
+
+	res, err := t.db.NewRaw(b.String(), args...).Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: insert missing from %s: %w", t.Name, err)
+	}
+	return res.RowsAffected()
+}
+
+// Drop drops the temp table
+func (t *TempTable) Drop(ctx context.Context) error {
+	if _, err := t.db.NewRaw("DROP TABLE IF EXISTS ?", bun.Ident(t.Name)).Exec(ctx); err != nil {
+		return fmt.Errorf("persistence: drop temp table %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+func (t *TempTable) columns(keyColumns, setColumns []string) ([]string, []string) {
+	if len(keyColumns) == 0 {
+		for _, pk := range t.source.PKs {
+			keyColumns = append(keyColumns, pk.Name)
+		}
+	}
+	if len(setColumns) == 0 {
+		keys := make(map[string]struct{}, len(keyColumns))
+		for _, key := range keyColumns {
+			keys[key] = struct{}{}
+		}
+		for _, field := range t.source.Fields {
+			if _, ok := keys[field.Name]; !ok {
+				setColumns = append(setColumns, field.Name)
+			}
+		}
+	}
+	return keyColumns, setColumns
+}
+
+func (t *TempTable) writeJoin(b *strings.Builder, args *[]any, keyColumns []string) {
+	for i, key := range keyColumns {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("?.? = ?.?")
+		*args = append(*args, t.source.SQLName, bun.Ident(key), bun.Ident(t.Name), bun.Ident(key))
+	}
+}
+
+// writeSet writes col = tmp.col pairs, qualifying the target column
+// with qualifier when set.
+func (t *TempTable) writeSet(b *strings.Builder, args *[]any, setColumns []string, qualifier any) {
+	for i, column := range setColumns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if qualifier != nil {
+			b.WriteString("?.")
+			*args = append(*args, qualifier)
+		}
+		b.WriteString("? = ?.?")
+		*args = append(*args, bun.Ident(column), bun.Ident(t.Name), bun.Ident(column))
+	}
+}
@@ -0,0 +1,44 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTempTable_MergeUpdateAndInsertMissing(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*findItem)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewInsert().Model(&[]findItem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}).Exec(ctx)
+	require.NoError(t, err)
+
+	err = WithTempTable[findItem](ctx, db, "tmp_find_items", func(ctx context.Context, tmp *TempTable) error {
+		n, err := tmp.Insert(ctx, &[]findItem{{ID: 2, Name: "B"}, {ID: 3, Name: "c"}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		n, err = tmp.MergeUpdate(ctx, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = tmp.InsertMissing(ctx, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		return nil
+	})
+	require.NoError(t, err)
+
+	var items []findItem
+	require.NoError(t, db.NewSelect().Model(&items).Order("id").Scan(ctx))
+	assert.Equal(t, []findItem{{ID: 1, Name: "a"}, {ID: 2, Name: "B"}, {ID: 3, Name: "c"}}, items)
+
+	var tables int
+	require.NoError(t, db.NewRaw("SELECT COUNT(*) FROM sqlite_temp_master WHERE name = 'tmp_find_items'").Scan(ctx, &tables))
+	assert.Equal(t, 0, tables)
+}
@@ -0,0 +1,297 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	historyIDColumn        = "history_id"
+	historyValidFromColumn = "valid_from"
+	historyValidToColumn   = "valid_to"
+)
+
+// HistoryTable describes the shadow table that keeps every past state
+// of a historized model. Each row holds a copy of the model columns and
+// the [valid_from, valid_to) period during which it was current. The
+// row of the current state has a NULL valid_to.
+type HistoryTable struct {
+	// Table is the model table.
+	Table string
+	// Name is the history table, <table>_history.
+	Name string
+	// Columns are the copied model columns, primary keys first.
+	Columns []string
+	// PKs are the model primary key columns.
+	PKs []string
+
+	dialect dialect.Name
+	gen     schema.QueryGen
+	types   []string
+}
+
+// HistoryTableName returns the history table name for table.
+func HistoryTableName(table string) string {
+	return table + "_history"
+}
+
+// Historized describes the history table of model for the dialect of db.
+// The history is maintained by database triggers created by the migration
+// returned from UpSQL, so writes made outside of bun are tracked too.
+func Historized(db bun.IDB, model any) (*HistoryTable, error) {
+	typ := modelType(reflect.TypeOf(model))
+	if typ == nil {
+		return nil, apierrors.New("historized model must be a struct", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": fmt.Sprintf("%T", model)})
+	}
+
+	table := db.Dialect().Tables().Get(typ)
+	if len(table.PKs) == 0 {
+		return nil, apierrors.New("historized model requires a primary key", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"model": table.TypeName})
+	}
+
+	name := db.Dialect().Name()
+	switch name {
+	case dialect.PG, dialect.SQLite, dialect.MySQL:
+	default:
+		return nil, apierrors.New("history tables are not supported for dialect", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"dialect": name.String(), "model": table.TypeName})
+	}
+
+	h := &HistoryTable{
+		Table:   table.Name,
+		Name:    HistoryTableName(table.Name),
+		dialect: name,
+		gen:     schema.NewQueryGen(db.Dialect()),
+	}
+	for _, field := range table.Fields {
+		h.Columns = append(h.Columns, field.Name)
+		h.types = append(h.types, historyColumnType(name, field))
+		if field.IsPK {
+			h.PKs = append(h.PKs, field.Name)
+		}
+	}
+	return h, nil
+}
+
+// historyColumnType returns the column type of field in the history
+// table. Serial types become their plain integer type since the values
+// are copied from the model table.
+func historyColumnType(name dialect.Name, field *schema.Field) string {
+	typ := field.CreateTableSQLType
+	if name == dialect.PG {
+		switch strings.ToUpper(typ) {
+		case "SMALLSERIAL":
+			return "SMALLINT"
+		case "SERIAL":
+			return "INTEGER"
+		case "BIGSERIAL":
+			return "BIGINT"
+		}
+	}
+	return typ
+}
+
+// UpSQL returns the statements creating the history table and the
+// triggers maintaining it, separated by --bun:split markers.
+func (h *HistoryTable) UpSQL() string {
+	var stmts []string
+
+	var cols strings.Builder
+	switch h.dialect {
+	case dialect.PG:
+		fmt.Fprintf(&cols, "\t%s BIGSERIAL PRIMARY KEY", h.ident(historyIDColumn))
+	case dialect.MySQL:
+		fmt.Fprintf(&cols, "\t%s BIGINT AUTO_INCREMENT PRIMARY KEY", h.ident(historyIDColumn))
+	default:
+		fmt.Fprintf(&cols, "\t%s INTEGER PRIMARY KEY AUTOINCREMENT", h.ident(historyIDColumn))
+	}
+	for i, col := range h.Columns {
+		fmt.Fprintf(&cols, ",\n\t%s %s", h.ident(col), h.types[i])
+	}
+	fmt.Fprintf(&cols, ",\n\t%s %s NOT NULL", h.ident(historyValidFromColumn), h.timestampType())
+	fmt.Fprintf(&cols, ",\n\t%s %s NULL", h.ident(historyValidToColumn), h.timestampType())
+	stmts = append(stmts,
+		fmt.Sprintf("CREATE TABLE %s (\n%s\n);", h.ident(h.Name), cols.String()),
+		fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s);",
+			h.ident(h.Name+"_period_idx"), h.ident(h.Name), h.idents(h.PKs), h.ident(historyValidFromColumn)),
+	)
+
+	switch h.dialect {
+	case dialect.PG:
+		stmts = append(stmts, h.pgTriggerSQL()...)
+	default:
+		stmts = append(stmts, h.rowTriggersSQL()...)
+	}
+	return strings.Join(stmts, "\n\n--bun:split\n\n") + "\n"
+}
+
+// DownSQL returns the statements dropping the triggers and history table.
+func (h *HistoryTable) DownSQL() string {
+	var stmts []string
+	switch h.dialect {
+	case dialect.PG:
+		stmts = append(stmts,
+			fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s;", h.ident(h.triggerName("")), h.ident(h.Table)),
+			fmt.Sprintf("DROP FUNCTION IF EXISTS %s();", h.ident(h.triggerName(""))),
+		)
+	default:
+		for _, event := range []string{"insert", "update", "delete"} {
+			stmts = append(stmts, fmt.Sprintf("DROP TRIGGER IF EXISTS %s;", h.ident(h.triggerName(event))))
+		}
+	}
+	stmts = append(stmts, fmt.Sprintf("DROP TABLE IF EXISTS %s;", h.ident(h.Name)))
+	return strings.Join(stmts, "\n\n--bun:split\n\n") + "\n"
+}
+
+// MigrationFS returns a source with the up and down migrations of the
+// history table named <version>_<table>_history, ready for
+// RegisterSQLMigrations.
+func (h *HistoryTable) MigrationFS(version string) fstest.MapFS {
+	base := fmt.Sprintf("%s_%s", version, h.Name)
+	return fstest.MapFS{
+		base + ".up.sql":   {Data: []byte(h.UpSQL())},
+		base + ".down.sql": {Data: []byte(h.DownSQL())},
+	}
+}
+
+func (h *HistoryTable) timestampType() string {
+	switch h.dialect {
+	case dialect.PG:
+		return "TIMESTAMPTZ"
+	case dialect.MySQL:
+		return "DATETIME(6)"
+	default:
+		return "TIMESTAMP"
+	}
+}
+
+func (h *HistoryTable) now() string {
+	switch h.dialect {
+	case dialect.PG:
+		return "clock_timestamp()"
+	case dialect.MySQL:
+		return "UTC_TIMESTAMP(6)"
+	default:
+		// sortable text matching the format bun uses for sqlite timestamps
+		return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	}
+}
+
+func (h *HistoryTable) triggerName(event string) string {
+	if event == "" {
+		return h.Name + "_trg"
+	}
+	return h.Name + "_" + event + "_trg"
+}
+
+// ident quotes name for the dialect, so reserved words such as order
+// can be column names.
+func (h *HistoryTable) ident(name string) string {
+	return string(h.gen.AppendQuery(nil, "?", bun.Ident(name)))
+}
+
+func (h *HistoryTable) idents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = h.ident(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (h *HistoryTable) closeSQL(row string) string {
+	conds := make([]string, 0, len(h.PKs)+1)
+	for _, pk := range h.PKs {
+		conds = append(conds, fmt.Sprintf("%s = %s.%s", h.ident(pk), row, h.ident(pk)))
+	}
+	conds = append(conds, h.ident(historyValidToColumn)+" IS NULL")
+	return fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s;",
+		h.ident(h.Name), h.ident(historyValidToColumn), h.now(), strings.Join(conds, " AND "))
+}
+
+func (h *HistoryTable) openSQL(row string) string {
+	values := make([]string, 0, len(h.Columns)+1)
+	for _, col := range h.Columns {
+		values = append(values, row+"."+h.ident(col))
+	}
+	values = append(values, h.now())
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (%s);",
+		h.ident(h.Name), h.idents(h.Columns), h.ident(historyValidFromColumn), strings.Join(values, ", "))
+}
+
+func (h *HistoryTable) pgTriggerSQL() []string {
+	fn := h.ident(h.triggerName(""))
+	return []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		%s
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		%s
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;`, fn, h.closeSQL("OLD"), h.openSQL("NEW")),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s();",
+			fn, h.ident(h.Table), fn),
+	}
+}
+
+func (h *HistoryTable) rowTriggersSQL() []string {
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s FOR EACH ROW\nBEGIN\n\t%s\nEND;",
+			h.ident(h.triggerName("insert")), h.ident(h.Table), h.openSQL("NEW")),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s FOR EACH ROW\nBEGIN\n\t%s\n\t%s\nEND;",
+			h.ident(h.triggerName("update")), h.ident(h.Table), h.closeSQL("OLD"), h.openSQL("NEW")),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s FOR EACH ROW\nBEGIN\n\t%s\nEND;",
+			h.ident(h.triggerName("delete")), h.ident(h.Table), h.closeSQL("OLD")),
+	}
+}
+
+// AsOf returns the rows of the T table as they were at t, read from its
+// history table. Rows inserted after t or deleted before t are excluded.
+// fns can further filter or order the query.
+func AsOf[T any](ctx context.Context, db bun.IDB, t time.Time, fns ...func(*bun.SelectQuery) *bun.SelectQuery) ([]T, error) {
+	var rows []T
+	q := AsOfQuery(db.NewSelect().Model(&rows), t)
+	for _, fn := range fns {
+		if fn != nil {
+			q = fn(q)
+		}
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to read history").
+			WithMetadata(map[string]any{"as_of": t})
+	}
+	return rows, nil
+}
+
+// AsOfQuery points q at the history table of its model and restricts it
+// to the row versions current at t.
+func AsOfQuery(q *bun.SelectQuery, t time.Time) *bun.SelectQuery {
+	if model := q.GetModel(); model != nil {
+		if typ := modelType(reflect.TypeOf(model.Value())); typ != nil {
+			table := q.DB().Dialect().Tables().Get(typ)
+			q = q.ModelTableExpr("? AS ?", bun.Ident(HistoryTableName(table.Name)), table.SQLAlias)
+		}
+	}
+	at := t.UTC()
+	return q.
+		Where("?TableAlias.? <= ?", bun.Ident(historyValidFromColumn), at).
+		WhereGroup(" AND ", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.
+				Where("?TableAlias.? IS NULL", bun.Ident(historyValidToColumn)).
+				WhereOr("?TableAlias.? > ?", bun.Ident(historyValidToColumn), at)
+		})
+}
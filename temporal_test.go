@@ -0,0 +1,124 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+type temporalPrice struct {
+	bun.BaseModel `bun:"table:temporal_prices"`
+
+	ID     int64  `bun:"id,pk,autoincrement"`
+	SKU    string `bun:"sku,notnull"`
+	Amount int64  `bun:"amount,notnull"`
+}
+
+func TestHistorized_SQLiteAsOf(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*temporalPrice)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	history, err := Historized(db, (*temporalPrice)(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "temporal_prices_history", history.Name)
+	assert.Equal(t, []string{"id"}, history.PKs)
+	assert.Equal(t, []string{"id", "sku", "amount"}, history.Columns)
+
+	migrations := NewMigrations().RegisterSQLMigrations(history.MigrationFS("20240101000000"))
+	require.NoError(t, migrations.Migrate(ctx, db))
+
+	price := &temporalPrice{SKU: "a", Amount: 100}
+	_, err = db.NewInsert().Model(price).Exec(ctx)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	beforeUpdate := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	price.Amount = 150
+	_, err = db.NewUpdate().Model(price).WherePK().Exec(ctx)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	beforeDelete := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = db.NewDelete().Model(price).WherePK().Exec(ctx)
+	require.NoError(t, err)
+
+	rows, err := AsOf[temporalPrice](ctx, db, beforeUpdate)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, int64(100), rows[0].Amount)
+
+	rows, err = AsOf[temporalPrice](ctx, db, beforeDelete, func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("sku = ?", "a")
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, int64(150), rows[0].Amount)
+
+	rows, err = AsOf[temporalPrice](ctx, db, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	require.NoError(t, migrations.RollbackAll(ctx, db))
+	var count int
+	require.NoError(t, db.NewRaw("SELECT count(*) FROM sqlite_master WHERE name LIKE 'temporal_prices_history%'").Scan(ctx, &count))
+	assert.Zero(t, count)
+}
+
+type temporalLine struct {
+	bun.BaseModel `bun:"table:temporal_lines"`
+
+	ID    int64  `bun:"id,pk,autoincrement"`
+	Order int64  `bun:"order,notnull"`
+	Group string `bun:"group"`
+}
+
+func TestHistorized_ReservedWordColumns(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*temporalLine)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	history, err := Historized(db, (*temporalLine)(nil))
+	require.NoError(t, err)
+	assert.Contains(t, history.UpSQL(), `NEW."order"`)
+	require.NoError(t, NewMigrations().RegisterSQLMigrations(history.MigrationFS("20240101000000")).Migrate(ctx, db))
+
+	line := &temporalLine{Order: 1, Group: "a"}
+	_, err = db.NewInsert().Model(line).Exec(ctx)
+	require.NoError(t, err)
+	line.Order = 2
+	_, err = db.NewUpdate().Model(line).WherePK().Exec(ctx)
+	require.NoError(t, err)
+
+	rows, err := AsOf[temporalLine](ctx, db, time.Now())
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, int64(2), rows[0].Order)
+}
+
+func TestHistorized_RequiresPrimaryKey(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	type noPK struct {
+		bun.BaseModel `bun:"table:no_pk"`
+		Name          string `bun:"name"`
+	}
+
+	_, err := Historized(db, (*noPK)(nil))
+	require.Error(t, err)
+}
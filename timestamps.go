@@ -0,0 +1,183 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+type timezoneContextKey struct{}
+
+// ContextWithTimezone returns a context carrying the timezone used to
+// present timestamps read during the request, e.g. the user timezone.
+func ContextWithTimezone(ctx context.Context, loc *time.Location) context.Context {
+	if loc == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, timezoneContextKey{}, loc)
+}
+
+// TimezoneFromContext returns the timezone set with ContextWithTimezone,
+// or UTC.
+func TimezoneFromContext(ctx context.Context) *time.Location {
+	if ctx != nil {
+		if loc, ok := ctx.Value(timezoneContextKey{}).(*time.Location); ok {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// InContextTimezone returns t in the timezone of ctx.
+func InContextTimezone(ctx context.Context, t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(TimezoneFromContext(ctx))
+}
+
+// UTCTimestamps is a model mixin for created_at and updated_at columns.
+// Values are always written in UTC and converted to the timezone of the
+// query context when scanned.
+//
+//	type Post struct {
+//		bun.BaseModel `bun:"table:posts"`
+//		persistence.UTCTimestamps
+//		ID int64 `bun:"id,pk,autoincrement"`
+//	}
+//
+// Models defining their own BeforeAppendModel or AfterScanRow hooks
+// should call the mixin hooks from them.
+type UTCTimestamps struct {
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+var (
+	_ bun.BeforeAppendModelHook = (*UTCTimestamps)(nil)
+	_ bun.AfterScanRowHook      = (*UTCTimestamps)(nil)
+)
+
+// BeforeAppendModel sets the timestamps on insert and update and
+// normalizes them to UTC.
+func (t *UTCTimestamps) BeforeAppendModel(_ context.Context, query bun.Query) error {
+	now := time.Now().UTC()
+	switch query.(type) {
+	case *bun.InsertQuery:
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now
+		}
+		t.UpdatedAt = now
+	case *bun.UpdateQuery:
+		t.UpdatedAt = now
+	}
+	t.CreatedAt = utc(t.CreatedAt)
+	t.UpdatedAt = utc(t.UpdatedAt)
+	return nil
+}
+
+// AfterScanRow converts the timestamps to the timezone of ctx.
+func (t *UTCTimestamps) AfterScanRow(ctx context.Context) error {
+	t.CreatedAt = InContextTimezone(ctx, t.CreatedAt)
+	t.UpdatedAt = InContextTimezone(ctx, t.UpdatedAt)
+	return nil
+}
+
+func utc(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC()
+}
+
+// NormalizeUTC converts every time.Time, *time.Time and bun.NullTime
+// field of model, a struct or slice of structs pointer, to UTC. Call it
+// before writes on models not using UTCTimestamps.
+func NormalizeUTC(model any) {
+	convertTimes(reflect.ValueOf(model), utc)
+}
+
+// ConvertToContextTimezone converts every time field of model to the
+// timezone of ctx, see NormalizeUTC.
+func ConvertToContextTimezone(ctx context.Context, model any) {
+	convertTimes(reflect.ValueOf(model), func(t time.Time) time.Time {
+		return InContextTimezone(ctx, t)
+	})
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(bun.NullTime{})
+)
+
+func convertTimes(v reflect.Value, fn func(time.Time) time.Time) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			convertTimes(v.Index(i), fn)
+		}
+	case reflect.Struct:
+		switch v.Type() {
+		case timeType:
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(fn(v.Interface().(time.Time))))
+			}
+			return
+		case nullTimeType:
+			if v.CanSet() {
+				converted := fn(v.Interface().(bun.NullTime).Time)
+				v.Set(reflect.ValueOf(bun.NullTime{Time: converted}))
+			}
+			return
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				convertTimes(v.Field(i), fn)
+			}
+		}
+	}
+}
+
+// InspectTimestampColumns reports the TIMESTAMP WITHOUT TIME ZONE columns
+// of the current Postgres schema with the LintTimestampWithoutTZ rule.
+// Other dialects return no findings.
+func InspectTimestampColumns(ctx context.Context, db bun.IDB) (LintFindings, error) {
+	if db.Dialect().Name() != dialect.PG {
+		return nil, nil
+	}
+
+	var columns []struct {
+		Table  string `bun:"table_name"`
+		Column string `bun:"column_name"`
+	}
+	err := db.NewRaw(`SELECT table_name, column_name FROM information_schema.columns
+WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+ORDER BY table_name, column_name`).Scan(ctx, &columns)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to inspect timestamp columns")
+	}
+
+	findings := make(LintFindings, 0, len(columns))
+	for _, col := range columns {
+		findings = append(findings, LintFinding{
+			Rule:     LintTimestampWithoutTZ,
+			Severity: LintSeverityWarning,
+			Path:     fmt.Sprintf("%s.%s", col.Table, col.Column),
+			Dialect:  "postgres",
+			Message:  "TIMESTAMP WITHOUT TIME ZONE drops the offset, use TIMESTAMPTZ",
+		})
+	}
+	return findings, nil
+}
@@ -0,0 +1,97 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type timestampPost struct {
+	bun.BaseModel `bun:"table:timestamp_posts"`
+	UTCTimestamps
+
+	ID    int64  `bun:"id,pk,autoincrement"`
+	Title string `bun:"title"`
+}
+
+func TestUTCTimestamps_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*timestampPost)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, tokyo)
+	post := &timestampPost{Title: "hello", UTCTimestamps: UTCTimestamps{CreatedAt: created}}
+	_, err = db.NewInsert().Model(post).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, post.CreatedAt.Location())
+	assert.True(t, post.CreatedAt.Equal(created))
+	assert.False(t, post.UpdatedAt.IsZero())
+
+	var stored string
+	require.NoError(t, db.NewRaw("SELECT substr(created_at, 1, 19) FROM timestamp_posts WHERE id = ?", post.ID).Scan(ctx, &stored))
+	assert.Equal(t, "2024-03-01 00:00:00", stored)
+
+	var loaded timestampPost
+	reqCtx := ContextWithTimezone(ctx, tokyo)
+	require.NoError(t, db.NewSelect().Model(&loaded).Where("id = ?", post.ID).Scan(reqCtx))
+	assert.Equal(t, tokyo, loaded.CreatedAt.Location())
+	assert.Equal(t, 9, loaded.CreatedAt.Hour())
+
+	var plain timestampPost
+	require.NoError(t, db.NewSelect().Model(&plain).Where("id = ?", post.ID).Scan(ctx))
+	assert.Equal(t, time.UTC, plain.CreatedAt.Location())
+}
+
+func TestNormalizeUTC(t *testing.T) {
+	zone := time.FixedZone("X", -5*60*60)
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, zone)
+	type record struct {
+		At      time.Time
+		Ptr     *time.Time
+		Null    bun.NullTime
+		Nested  UTCTimestamps
+		private time.Time
+	}
+
+	records := []record{{At: at, Ptr: &at, Null: bun.NullTime{Time: at}, Nested: UTCTimestamps{CreatedAt: at}, private: at}}
+	NormalizeUTC(&records)
+
+	got := records[0]
+	assert.Equal(t, time.UTC, got.At.Location())
+	assert.Equal(t, 17, got.Ptr.Hour())
+	assert.Equal(t, time.UTC, got.Null.Time.Location())
+	assert.Equal(t, time.UTC, got.Nested.CreatedAt.Location())
+	assert.True(t, got.Nested.UpdatedAt.IsZero())
+	assert.Equal(t, zone, got.private.Location())
+
+	ConvertToContextTimezone(ContextWithTimezone(context.Background(), zone), &records)
+	assert.Equal(t, 12, records[0].At.Hour())
+}
+
+func TestInspectTimestampColumns(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectQuery("information_schema.columns").WillReturnRows(
+		sqlmock.NewRows([]string{"table_name", "column_name"}).AddRow("events", "seen_at"),
+	)
+
+	findings, err := InspectTimestampColumns(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, LintTimestampWithoutTZ, findings[0].Rule)
+	assert.Equal(t, "events.seen_at", findings[0].Path)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,263 @@
+package persistence
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"net/url"
+	"os"
+	"strings"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun/schema"
+)
+
+// TLSMode is how the server certificate is checked, named after the
+// libpq sslmode values.
+type TLSMode string
+
+const (
+	// TLSDisable connects without TLS.
+	TLSDisable TLSMode = "disable"
+	// TLSRequire encrypts without verifying the server certificate.
+	TLSRequire TLSMode = "require"
+	// TLSVerifyCA verifies the certificate chain but not the host name.
+	TLSVerifyCA TLSMode = "verify-ca"
+	// TLSVerifyFull verifies the certificate chain and the host name.
+	TLSVerifyFull TLSMode = "verify-full"
+)
+
+// TLSConfig configures encrypted connections.
+type TLSConfig struct {
+	Mode TLSMode
+	// CAFile is a PEM bundle of the certificate authorities to trust,
+	// the system pool when empty.
+	CAFile string
+	// CertFile and KeyFile are the client certificate and key.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name verified by TLSVerifyFull.
+	ServerName string
+	// MySQLConfigName is the name a tls.Config was registered under with
+	// mysql.RegisterTLSConfig, used as the tls parameter of MySQL DSNs
+	// instead of the mode.
+	MySQLConfigName string
+}
+
+// Validate checks the mode and that client certificates come in pairs.
+func (t TLSConfig) Validate() error {
+	switch t.Mode {
+	case TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return apierrors.New("invalid TLS mode", apierrors.CategoryBadInput).
+			WithMetadata(map[string]any{"mode": string(t.Mode)})
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return apierrors.New("TLS client certificate and key must be set together", apierrors.CategoryBadInput)
+	}
+	return nil
+}
+
+// Config builds the crypto/tls configuration, for drivers configured
+// with a *tls.Config such as pgdriver.WithTLSConfig or
+// mysql.RegisterTLSConfig. It returns nil for TLSDisable.
+func (t TLSConfig) Config() (*tls.Config, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if t.Mode == TLSDisable {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: t.ServerName}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to read TLS CA bundle").
+				WithMetadata(map[string]any{"file": t.CAFile})
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, apierrors.New("TLS CA bundle has no certificates", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"file": t.CAFile})
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "failed to load TLS client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch t.Mode {
+	case TLSRequire:
+		cfg.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// verify the chain ourselves, skipping the host name check
+		cfg.InsecureSkipVerify = true
+		roots := cfg.RootCAs
+		cfg.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(raw))
+			for i, der := range raw {
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return apierrors.New("server sent no TLS certificate", apierrors.CategoryAuth)
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
+
+// ApplyDSN adds the TLS settings to dsn: sslmode, sslrootcert, sslcert
+// and sslkey for Postgres URL and key=value DSNs, tls for MySQL DSNs.
+// SQLite DSNs are returned unchanged.
+//
+// The MySQL tls parameter only names modes, so TLSVerifyCA, CA bundles,
+// client certificates and ServerName need a tls.Config registered with
+// mysql.RegisterTLSConfig, see Config, and MySQLConfigName; without one
+// ApplyDSN returns an error instead of connecting with weaker checks.
+func (t TLSConfig) ApplyDSN(dsn string) (string, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	params := [][2]string{{"sslmode", string(t.Mode)}}
+	for _, p := range [][2]string{{"sslrootcert", t.CAFile}, {"sslcert", t.CertFile}, {"sslkey", t.KeyFile}} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(dsn, "file:") || strings.HasPrefix(dsn, ":memory:"):
+		return dsn, nil
+	case strings.Contains(dsn, "://"):
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid DSN")
+		}
+		query := u.Query()
+		for _, p := range params {
+			query.Set(p[0], p[1])
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	case mysqlUserinfoRE.MatchString(dsn):
+		value := t.MySQLConfigName
+		if value == "" {
+			if t.Mode == TLSVerifyCA || t.CAFile != "" || t.CertFile != "" || t.ServerName != "" {
+				return "", apierrors.New("MySQL DSNs need MySQLConfigName for verify-ca, CA bundles, client certificates and server names", apierrors.CategoryBadInput).
+					WithMetadata(map[string]any{"mode": string(t.Mode)})
+			}
+			value = map[TLSMode]string{TLSDisable: "false", TLSRequire: "skip-verify", TLSVerifyFull: "true"}[t.Mode]
+		}
+		base, rawQuery, _ := strings.Cut(dsn, "?")
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid DSN")
+		}
+		query.Set("tls", value)
+		return base + "?" + query.Encode(), nil
+	default:
+		fields := strings.Fields(dsn)
+		out := fields[:0]
+		for _, field := range fields {
+			switch key, _, _ := strings.Cut(field, "="); key {
+			case "sslmode", "sslrootcert", "sslcert", "sslkey":
+				continue
+			}
+			out = append(out, field)
+		}
+		for _, p := range params {
+			out = append(out, p[0]+"="+quoteDSNValue(p[1]))
+		}
+		return strings.Join(out, " "), nil
+	}
+}
+
+// WithTLS adds the TLS settings to the DSN of the client opened by Open
+// and of the labeled pools, see TLSConfig.ApplyDSN.
+func WithTLS(cfg TLSConfig) ClientOption {
+	return func(o *clientOptions) {
+		if o == nil {
+			return
+		}
+		o.tls = &cfg
+	}
+}
+
+// Open opens the database of cfg, its GetDriver driver with its DSN
+// (GetDSN or GetServer), and creates a client on it. The driver must be
+// registered with database/sql. WithTLS, WithCredentialProvider and
+// WithFailoverTargets apply to the connection, e.g. for RDS IAM
+// authentication:
+//
+//	client, err := persistence.Open(cfg, pgdialect.New(),
+//		persistence.WithTLS(persistence.TLSConfig{Mode: persistence.TLSVerifyFull, CAFile: "rds-ca.pem"}),
+//		persistence.WithCredentialProvider(persistence.RDSIAMAuth{Endpoint: host + ":5432", Region: "us-east-1", User: "app"}),
+//	)
+func Open(cfg Config, dialect schema.Dialect, opts ...ClientOption) (*Client, error) {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	if err := validateConfig(cfg, dialect, o, true); err != nil {
+		return nil, err
+	}
+
+	// sql.Open only looks the driver up, it does not parse the DSN
+	db, err := sql.Open(cfg.GetDriver(), "")
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryInternal, "failed to open database").
+			WithMetadata(map[string]any{"driver": cfg.GetDriver()})
+	}
+	d := db.Driver()
+	_ = db.Close()
+
+	dsns := append([]string{configDSN(cfg)}, o.failoverTargets...)
+	targets := make([]FailoverTarget, len(dsns))
+	for i, dsn := range dsns {
+		if o.tls != nil {
+			if dsn, err = o.tls.ApplyDSN(dsn); err != nil {
+				return nil, err
+			}
+		}
+		targets[i].Name = dsnHost(dsn, i)
+		if o.credentialProvider != nil {
+			targets[i].Connector = NewCredentialConnector(d, dsn, o.credentialProvider, o.credentialOptions...)
+		} else if targets[i].Connector, err = connectorFor(d, dsn); err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryBadInput, "invalid DSN").
+				WithMetadata(map[string]any{"target": targets[i].Name})
+		}
+	}
+
+	var failover *FailoverConnector
+	var sqlDB *sql.DB
+	if len(targets) > 1 {
+		failover = NewFailoverConnector(targets, o.failoverOptions...)
+		sqlDB = failover.OpenDB()
+	} else {
+		sqlDB = sql.OpenDB(targets[0].Connector)
+	}
+
+	client, err := New(cfg, sqlDB, dialect, opts...)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	client.failover = failover
+	return client, nil
+}
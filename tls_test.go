@@ -0,0 +1,165 @@
+package persistence
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestTLSConfig_ApplyDSN(t *testing.T) {
+	cfg := TLSConfig{Mode: TLSVerifyFull, CAFile: "/etc/ssl/rds-ca.pem", CertFile: "/etc/ssl/client.crt", KeyFile: "/etc/ssl/client.key"}
+	cases := map[string]string{
+		"postgres://app@localhost:5432/app?sslmode=disable&application_name=api": "postgres://app@localhost:5432/app?application_name=api&sslcert=%2Fetc%2Fssl%2Fclient.crt&sslkey=%2Fetc%2Fssl%2Fclient.key&sslmode=verify-full&sslrootcert=%2Fetc%2Fssl%2Frds-ca.pem",
+		"host=localhost sslmode=disable dbname=app":                              "host=localhost dbname=app sslmode='verify-full' sslrootcert='/etc/ssl/rds-ca.pem' sslcert='/etc/ssl/client.crt' sslkey='/etc/ssl/client.key'",
+		"file:app.db?cache=shared":                                               "file:app.db?cache=shared",
+	}
+	for dsn, want := range cases {
+		got, err := cfg.ApplyDSN(dsn)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, dsn)
+	}
+
+	got, err := TLSConfig{Mode: TLSVerifyFull}.ApplyDSN("app:x@tcp(localhost:3306)/app?parseTime=true")
+	require.NoError(t, err)
+	assert.Equal(t, "app:x@tcp(localhost:3306)/app?parseTime=true&tls=true", got)
+
+	got, err = TLSConfig{Mode: TLSRequire, MySQLConfigName: "rds"}.ApplyDSN("app:x@tcp(localhost:3306)/app")
+	require.NoError(t, err)
+	assert.Equal(t, "app:x@tcp(localhost:3306)/app?tls=rds", got)
+
+	got, err = TLSConfig{Mode: TLSVerifyCA, CAFile: "/etc/ssl/rds-ca.pem", MySQLConfigName: "rds"}.ApplyDSN("app:x@tcp(localhost:3306)/app")
+	require.NoError(t, err)
+	assert.Equal(t, "app:x@tcp(localhost:3306)/app?tls=rds", got)
+
+	// the mysql tls parameter cannot express these without a registered config
+	for _, mysqlCfg := range []TLSConfig{{Mode: TLSVerifyCA}, cfg, {Mode: TLSRequire, CertFile: "client.crt", KeyFile: "client.key"}} {
+		_, err = mysqlCfg.ApplyDSN("app:x@tcp(localhost:3306)/app")
+		assert.Error(t, err, mysqlCfg)
+	}
+
+	_, err = TLSConfig{Mode: "prefer-maybe"}.ApplyDSN("postgres://localhost/app")
+	assert.Error(t, err)
+	_, err = TLSConfig{Mode: TLSRequire, CertFile: "client.crt"}.ApplyDSN("postgres://localhost/app")
+	assert.Error(t, err)
+}
+
+func TestTLSConfig_Config(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	ca, caKey := writeTestCA(t, caFile)
+
+	cfg, err := TLSConfig{Mode: TLSDisable}.Config()
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = TLSConfig{Mode: TLSVerifyFull, CAFile: caFile, ServerName: "db.internal"}.Config()
+	require.NoError(t, err)
+	assert.False(t, cfg.InsecureSkipVerify)
+	assert.Equal(t, "db.internal", cfg.ServerName)
+	assert.NotNil(t, cfg.RootCAs)
+
+	cfg, err = TLSConfig{Mode: TLSVerifyCA, CAFile: caFile}.Config()
+	require.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+
+	signed := issueTestCert(t, ca, caKey, "other-host")
+	assert.NoError(t, cfg.VerifyPeerCertificate([][]byte{signed}, nil))
+
+	otherCA, otherKey := writeTestCA(t, filepath.Join(dir, "other.pem"))
+	assert.Error(t, cfg.VerifyPeerCertificate([][]byte{issueTestCert(t, otherCA, otherKey, "db")}, nil))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("nothing"), 0o600))
+	_, err = TLSConfig{Mode: TLSVerifyFull, CAFile: filepath.Join(dir, "empty.pem")}.Config()
+	assert.Error(t, err)
+}
+
+func writeTestCA(t *testing.T, path string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func issueTestCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, host string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	return der
+}
+
+func TestOpen_SQLite(t *testing.T) {
+	cfg := NewConfig(WithDriver(sqliteshim.ShimName), WithDSN("file:"+filepath.Join(t.TempDir(), "open.db")))
+	client, err := Open(cfg, sqlitedialect.New(), WithTLS(TLSConfig{Mode: TLSRequire}))
+	require.NoError(t, err)
+	defer client.Close()
+
+	var n int
+	require.NoError(t, client.DB().NewRaw("SELECT 1").Scan(context.Background(), &n))
+	assert.Equal(t, 1, n)
+
+	_, err = Open(NewConfig(WithDriver("missing-driver"), WithDSN("x")), sqlitedialect.New())
+	assert.Error(t, err)
+}
+
+func TestRDSIAMAuth_Credentials(t *testing.T) {
+	auth := RDSIAMAuth{
+		Endpoint: "prod.abc.us-east-1.rds.amazonaws.com:5432",
+		Region:   "us-east-1",
+		User:     "app",
+		AWSCredentials: func(context.Context) (AWSCredentials, error) {
+			return AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "SESSION"}, nil
+		},
+		now: func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	creds, err := auth.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "app", creds.Username)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 15, 0, 0, time.UTC), creds.ExpiresAt)
+	assert.Regexp(t, regexp.MustCompile(`^prod\.abc\.us-east-1\.rds\.amazonaws\.com:5432/\?Action=connect&DBUser=app&X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKID%2F20240101%2Fus-east-1%2Frds-db%2Faws4_request&X-Amz-Date=20240101T000000Z&X-Amz-Expires=900&X-Amz-Security-Token=SESSION&X-Amz-SignedHeaders=host&X-Amz-Signature=[0-9a-f]{64}$`), creds.Password)
+
+	again, err := auth.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, creds.Password, again)
+
+	_, err = RDSIAMAuth{Endpoint: "prod.abc", Region: "us-east-1", User: "app"}.Token(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,300 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+)
+
+// TwoPhaseParticipant is a Postgres database taking part in a
+// two-phase commit. Postgres must run with max_prepared_transactions > 0.
+type TwoPhaseParticipant struct {
+	Name string
+	DB   *bun.DB
+}
+
+// PreparedTx describes a prepared transaction found by a recovery scan.
+type PreparedTx struct {
+	Participant string
+	GID         string
+	Prepared    time.Time
+}
+
+// ErrTwoPhaseNoParticipants is returned by Run for a coordinator
+// without participants.
+var ErrTwoPhaseNoParticipants = errors.New("persistence: two-phase commit has no participants")
+
+// twoPhaseDecisionsTable records the global transactions decided to
+// commit. It lives on the first participant.
+const twoPhaseDecisionsTable = "bun_two_phase_decisions"
+
+// TwoPhaseCoordinator runs best-effort two-phase commits across
+// multiple Postgres databases using PREPARE TRANSACTION and COMMIT PREPARED.
+type TwoPhaseCoordinator struct {
+	prefix       string
+	participants []TwoPhaseParticipant
+	lgr          Logger
+}
+
+// NewTwoPhaseCoordinator creates a coordinator. The prefix is used
+// to tag global transaction identifiers so recovery only touches
+// transactions created by this coordinator.
+func NewTwoPhaseCoordinator(prefix string, participants ...TwoPhaseParticipant) *TwoPhaseCoordinator {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		prefix = Name
+	}
+	return &TwoPhaseCoordinator{
+		prefix:       prefix,
+		participants: participants,
+		lgr:          &defaultLogger{},
+	}
+}
+
+// SetLogger sets the coordinator logger
+func (c *TwoPhaseCoordinator) SetLogger(logger Logger) {
+	if logger != nil {
+		c.lgr = logger
+	}
+}
+
+// Run begins a transaction on every participant and calls fn with each of
+// them. When all callbacks succeed every transaction is prepared and then
+// committed. If any callback or prepare fails, all transactions are rolled back.
+//
+// The commit decision is recorded on the first participant before the
+// first COMMIT PREPARED. A failure during the commit phase leaves prepared
+// transactions behind, use Recover to resolve them. A coordinator without
+// participants returns ErrTwoPhaseNoParticipants.
+func (c *TwoPhaseCoordinator) Run(ctx context.Context, fn func(ctx context.Context, participant string, tx bun.Tx) error) error {
+	if fn == nil {
+		return ErrTxFuncNil
+	}
+	if len(c.participants) == 0 {
+		return apierrors.Wrap(ErrTwoPhaseNoParticipants, apierrors.CategoryBadInput, "two-phase commit has no participants").
+			WithMetadata(map[string]any{"prefix": c.prefix})
+	}
+
+	id, err := twoPhaseID()
+	if err != nil {
+		return apierrors.Wrap(err, apierrors.CategoryInternal, "failed to generate two-phase transaction id")
+	}
+
+	prepared := make([]TwoPhaseParticipant, 0, len(c.participants))
+	gids := make(map[string]string, len(c.participants))
+
+	abort := func(cause error) error {
+		for _, participant := range prepared {
+			if _, err := participant.DB.NewRaw("ROLLBACK PREPARED ?", gids[participant.Name]).Exec(ctx); err != nil {
+				c.lgr.Error("two-phase rollback prepared failed", "participant", participant.Name, "error", err)
+			}
+		}
+		return cause
+	}
+
+	for _, participant := range c.participants {
+		if participant.DB == nil {
+			return abort(apierrors.Wrap(ErrTxDBNil, apierrors.CategoryBadInput, "two-phase participant has no database").
+				WithMetadata(map[string]any{"participant": participant.Name}))
+		}
+
+		gid := fmt.Sprintf("%s_%s_%s", c.prefix, id, participant.Name)
+		tx, err := participant.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return abort(apierrors.Wrap(err, apierrors.CategoryOperation, "failed to begin two-phase transaction").
+				WithMetadata(map[string]any{"participant": participant.Name}))
+		}
+
+		if err := fn(ctx, participant.Name, tx); err != nil {
+			_ = tx.Rollback()
+			return abort(err)
+		}
+
+		if _, err := tx.NewRaw("PREPARE TRANSACTION ?", gid).Exec(ctx); err != nil {
+			_ = tx.Rollback()
+			return abort(apierrors.Wrap(err, apierrors.CategoryOperation, "failed to prepare transaction").
+				WithMetadata(map[string]any{"participant": participant.Name, "gid": gid}))
+		}
+		// the session is no longer in a transaction, release the connection
+		_ = tx.Rollback()
+
+		prepared = append(prepared, participant)
+		gids[participant.Name] = gid
+	}
+
+	global := c.prefix + "_" + id
+	decisions := prepared[0].DB
+	if err := recordTwoPhaseDecision(ctx, decisions, global); err != nil {
+		return abort(apierrors.Wrap(err, apierrors.CategoryOperation, "failed to record two-phase commit decision").
+			WithMetadata(map[string]any{"participant": prepared[0].Name, "gid": global}))
+	}
+
+	var errs []error
+	for _, participant := range prepared {
+		gid := gids[participant.Name]
+		if _, err := participant.DB.NewRaw("COMMIT PREPARED ?", gid).Exec(ctx); err != nil {
+			errs = append(errs, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to commit prepared transaction").
+				WithMetadata(map[string]any{"participant": participant.Name, "gid": gid}))
+		}
+	}
+	if len(errs) > 0 {
+		// the decision stays so Recover commits the remaining participants
+		return apierrors.Wrap(apierrors.Join(errs...), apierrors.CategoryOperation, "two-phase commit partially failed")
+	}
+
+	if _, err := decisions.NewRaw("DELETE FROM ? WHERE gid = ?", bun.Ident(twoPhaseDecisionsTable), global).Exec(ctx); err != nil {
+		c.lgr.Warn("two-phase decision cleanup failed", "gid", global, "error", err)
+	}
+	return nil
+}
+
+func ensureTwoPhaseDecisions(ctx context.Context, db *bun.DB) error {
+	_, err := db.NewRaw(
+		"CREATE TABLE IF NOT EXISTS ? (gid TEXT PRIMARY KEY, decided_at TIMESTAMPTZ NOT NULL DEFAULT now())",
+		bun.Ident(twoPhaseDecisionsTable),
+	).Exec(ctx)
+	return err
+}
+
+func recordTwoPhaseDecision(ctx context.Context, db *bun.DB, global string) error {
+	if err := ensureTwoPhaseDecisions(ctx, db); err != nil {
+		return err
+	}
+	_, err := db.NewRaw("INSERT INTO ? (gid) VALUES (?)", bun.Ident(twoPhaseDecisionsTable), global).Exec(ctx)
+	return err
+}
+
+// PreparedTransactions lists prepared transactions created by this
+// coordinator across all participants.
+func (c *TwoPhaseCoordinator) PreparedTransactions(ctx context.Context) ([]PreparedTx, error) {
+	var out []PreparedTx
+	for _, participant := range c.participants {
+		if participant.DB == nil {
+			continue
+		}
+		var rows []struct {
+			GID      string    `bun:"gid"`
+			Prepared time.Time `bun:"prepared"`
+		}
+		err := participant.DB.NewRaw(
+			"SELECT gid, prepared FROM pg_prepared_xacts WHERE database = current_database() AND gid LIKE ?",
+			twoPhaseGIDPattern(c.prefix),
+		).Scan(ctx, &rows)
+		if err != nil {
+			return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to list prepared transactions").
+				WithMetadata(map[string]any{"participant": participant.Name})
+		}
+		for _, row := range rows {
+			out = append(out, PreparedTx{
+				Participant: participant.Name,
+				GID:         row.GID,
+				Prepared:    row.Prepared,
+			})
+		}
+	}
+	return out, nil
+}
+
+// Recover resolves prepared transactions older than olderThan, typically
+// called at startup. Transactions whose global commit decision was
+// recorded are committed, as some participants may already have
+// committed theirs, the others are rolled back. It returns the number
+// of transactions resolved.
+func (c *TwoPhaseCoordinator) Recover(ctx context.Context, olderThan time.Duration) (int, error) {
+	pending, err := c.PreparedTransactions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var decisions *bun.DB
+	dbs := make(map[string]*bun.DB, len(c.participants))
+	for _, participant := range c.participants {
+		dbs[participant.Name] = participant.DB
+		if decisions == nil {
+			decisions = participant.DB
+		}
+	}
+	if decisions == nil {
+		return 0, nil
+	}
+
+	decided, err := c.decidedTransactions(ctx, decisions)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	remaining := make(map[string]bool)
+	cutoff := time.Now().Add(-olderThan)
+	for _, tx := range pending {
+		global := strings.TrimSuffix(tx.GID, "_"+tx.Participant)
+		if tx.Prepared.After(cutoff) {
+			remaining[global] = true
+			continue
+		}
+
+		query, message := "ROLLBACK PREPARED ?", "failed to roll back orphaned prepared transaction"
+		if decided[global] {
+			query, message = "COMMIT PREPARED ?", "failed to commit decided prepared transaction"
+		}
+		if _, err := dbs[tx.Participant].NewRaw(query, tx.GID).Exec(ctx); err != nil {
+			return recovered, apierrors.Wrap(err, apierrors.CategoryOperation, message).
+				WithMetadata(map[string]any{"participant": tx.Participant, "gid": tx.GID})
+		}
+		c.lgr.Warn("two-phase recovered orphaned prepared transaction", "participant", tx.Participant, "gid", tx.GID, "committed", decided[global])
+		recovered++
+	}
+
+	for global := range decided {
+		if remaining[global] {
+			continue
+		}
+		if _, err := decisions.NewRaw("DELETE FROM ? WHERE gid = ?", bun.Ident(twoPhaseDecisionsTable), global).Exec(ctx); err != nil {
+			return recovered, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to clear two-phase commit decision").
+				WithMetadata(map[string]any{"gid": global})
+		}
+	}
+	return recovered, nil
+}
+
+// decidedTransactions returns the global ids this coordinator decided
+// to commit.
+func (c *TwoPhaseCoordinator) decidedTransactions(ctx context.Context, db *bun.DB) (map[string]bool, error) {
+	if err := ensureTwoPhaseDecisions(ctx, db); err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to prepare two-phase decisions table")
+	}
+	var gids []string
+	err := db.NewRaw("SELECT gid FROM ? WHERE gid LIKE ?", bun.Ident(twoPhaseDecisionsTable), twoPhaseGIDPattern(c.prefix)).
+		Scan(ctx, &gids)
+	if err != nil {
+		return nil, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to list two-phase commit decisions")
+	}
+	decided := make(map[string]bool, len(gids))
+	for _, gid := range gids {
+		decided[gid] = true
+	}
+	return decided, nil
+}
+
+// twoPhaseGIDPattern matches the identifiers created for prefix, with
+// the LIKE wildcards in prefix escaped.
+func twoPhaseGIDPattern(prefix string) string {
+	return likeEscaper.Replace(prefix) + `\_%`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func twoPhaseID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
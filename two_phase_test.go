@@ -0,0 +1,157 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func newTwoPhaseMock(t *testing.T) (*bun.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return bun.NewDB(sqlDB, pgdialect.New()), mock
+}
+
+func TestTwoPhaseCoordinator_CommitsAll(t *testing.T) {
+	ordersDB, orders := newTwoPhaseMock(t)
+	billingDB, billing := newTwoPhaseMock(t)
+
+	for _, mock := range []sqlmock.Sqlmock{orders, billing} {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("PREPARE TRANSACTION 'app_.*'").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+	}
+	orders.ExpectExec("CREATE TABLE IF NOT EXISTS \"bun_two_phase_decisions\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	orders.ExpectExec("INSERT INTO \"bun_two_phase_decisions\" \\(gid\\) VALUES \\('app_[0-9a-f]+'\\)").WillReturnResult(sqlmock.NewResult(0, 1))
+	orders.ExpectExec("COMMIT PREPARED 'app_.*_orders'").WillReturnResult(sqlmock.NewResult(0, 0))
+	billing.ExpectExec("COMMIT PREPARED 'app_.*_billing'").WillReturnResult(sqlmock.NewResult(0, 0))
+	orders.ExpectExec("DELETE FROM \"bun_two_phase_decisions\"").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	coordinator := NewTwoPhaseCoordinator("app",
+		TwoPhaseParticipant{Name: "orders", DB: ordersDB},
+		TwoPhaseParticipant{Name: "billing", DB: billingDB},
+	)
+
+	var seen []string
+	err := coordinator.Run(context.Background(), func(ctx context.Context, participant string, tx bun.Tx) error {
+		seen = append(seen, participant)
+		_, err := tx.NewRaw("INSERT INTO t VALUES (1)").Exec(ctx)
+		return err
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders", "billing"}, seen)
+	assert.NoError(t, orders.ExpectationsWereMet())
+	assert.NoError(t, billing.ExpectationsWereMet())
+}
+
+func TestTwoPhaseCoordinator_RejectsNoParticipants(t *testing.T) {
+	called := false
+	err := NewTwoPhaseCoordinator("app").Run(context.Background(), func(context.Context, string, bun.Tx) error {
+		called = true
+		return nil
+	})
+
+	assert.ErrorIs(t, err, ErrTwoPhaseNoParticipants)
+	assert.False(t, called)
+}
+
+func TestTwoPhaseCoordinator_RollsBackPreparedOnFailure(t *testing.T) {
+	ordersDB, orders := newTwoPhaseMock(t)
+	billingDB, billing := newTwoPhaseMock(t)
+
+	orders.ExpectBegin()
+	orders.ExpectExec("PREPARE TRANSACTION").WillReturnResult(sqlmock.NewResult(0, 0))
+	orders.ExpectRollback()
+	orders.ExpectExec("ROLLBACK PREPARED 'app_.*_orders'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	billing.ExpectBegin()
+	billing.ExpectRollback()
+
+	coordinator := NewTwoPhaseCoordinator("app",
+		TwoPhaseParticipant{Name: "orders", DB: ordersDB},
+		TwoPhaseParticipant{Name: "billing", DB: billingDB},
+	)
+
+	expectedErr := errors.New("insufficient funds")
+	err := coordinator.Run(context.Background(), func(ctx context.Context, participant string, tx bun.Tx) error {
+		if participant == "billing" {
+			return expectedErr
+		}
+		return nil
+	})
+
+	require.ErrorIs(t, err, expectedErr)
+	assert.NoError(t, orders.ExpectationsWereMet())
+	assert.NoError(t, billing.ExpectationsWereMet())
+}
+
+func TestTwoPhaseCoordinator_Recover(t *testing.T) {
+	db, mock := newTwoPhaseMock(t)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT gid, prepared FROM pg_prepared_xacts").WillReturnRows(
+		sqlmock.NewRows([]string{"gid", "prepared"}).
+			AddRow("app_old_orders", now.Add(-time.Hour)).
+			AddRow("app_new_orders", now),
+	)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT gid FROM \"bun_two_phase_decisions\"").WillReturnRows(sqlmock.NewRows([]string{"gid"}))
+	mock.ExpectExec("ROLLBACK PREPARED 'app_old_orders'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	coordinator := NewTwoPhaseCoordinator("app", TwoPhaseParticipant{Name: "orders", DB: db})
+
+	recovered, err := coordinator.Recover(context.Background(), 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoPhaseCoordinator_RecoverAfterPartialCommit(t *testing.T) {
+	ordersDB, orders := newTwoPhaseMock(t)
+	billingDB, billing := newTwoPhaseMock(t)
+
+	old := time.Now().Add(-time.Hour)
+	// app_a committed on orders only, app_b never reached the decision
+	orders.ExpectQuery("SELECT gid, prepared FROM pg_prepared_xacts").WillReturnRows(
+		sqlmock.NewRows([]string{"gid", "prepared"}).AddRow("app_b_orders", old),
+	)
+	billing.ExpectQuery("SELECT gid, prepared FROM pg_prepared_xacts").WillReturnRows(
+		sqlmock.NewRows([]string{"gid", "prepared"}).
+			AddRow("app_a_billing", old).
+			AddRow("app_b_billing", old),
+	)
+	orders.ExpectExec("CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+	orders.ExpectQuery("SELECT gid FROM \"bun_two_phase_decisions\"").
+		WillReturnRows(sqlmock.NewRows([]string{"gid"}).AddRow("app_a"))
+	orders.ExpectExec("ROLLBACK PREPARED 'app_b_orders'").WillReturnResult(sqlmock.NewResult(0, 0))
+	billing.ExpectExec("COMMIT PREPARED 'app_a_billing'").WillReturnResult(sqlmock.NewResult(0, 0))
+	billing.ExpectExec("ROLLBACK PREPARED 'app_b_billing'").WillReturnResult(sqlmock.NewResult(0, 0))
+	orders.ExpectExec("DELETE FROM \"bun_two_phase_decisions\" WHERE gid = 'app_a'").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	coordinator := NewTwoPhaseCoordinator("app",
+		TwoPhaseParticipant{Name: "orders", DB: ordersDB},
+		TwoPhaseParticipant{Name: "billing", DB: billingDB},
+	)
+
+	recovered, err := coordinator.Recover(context.Background(), 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+	assert.NoError(t, orders.ExpectationsWereMet())
+	assert.NoError(t, billing.ExpectationsWereMet())
+}
+
+func TestTwoPhaseGIDPattern(t *testing.T) {
+	assert.Equal(t, `app\_%`, twoPhaseGIDPattern("app"))
+	assert.Equal(t, `my\_app\%1\\x\_%`, twoPhaseGIDPattern(`my_app%1\x`))
+}
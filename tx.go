@@ -2,6 +2,7 @@ package persistence
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 
 	"github.com/uptrace/bun"
@@ -21,6 +22,10 @@ var (
 // Otherwise, a new transaction is started and committed on success, and rolled
 // back on error or panic.
 func RunInTx(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bun.Tx) error) (err error) {
+	return runInTx(ctx, db, nil, fn)
+}
+
+func runInTx(ctx context.Context, db bun.IDB, opts *sql.TxOptions, fn func(ctx context.Context, tx bun.Tx) error) (err error) {
 	if db == nil {
 		return ErrTxDBNil
 	}
@@ -38,7 +43,7 @@ func RunInTx(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bu
 		return fn(ctx, *typed)
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := db.BeginTx(ctx, opts)
 	if err != nil {
 		return err
 	}
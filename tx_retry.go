@@ -0,0 +1,141 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrLockDeadlock    = 1213
+)
+
+// TxRetryPolicy configures RunInTxWithRetry.
+type TxRetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry.
+	Multiplier float64
+	// TxOptions are used to begin each transaction, e.g. to
+	// request sql.LevelSerializable.
+	TxOptions *sql.TxOptions
+	// IsRetryable overrides the default retryable error detection.
+	IsRetryable func(err error) bool
+	// OnRetry is called before each retry, useful to emit metrics.
+	OnRetry func(ctx context.Context, attempt int, err error, delay time.Duration)
+}
+
+// DefaultTxRetryPolicy returns a policy with 3 attempts and
+// exponential backoff starting at 10ms.
+func DefaultTxRetryPolicy() TxRetryPolicy {
+	return TxRetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+}
+
+// RunInTxWithRetry executes fn in a transaction, retrying the whole
+// transaction when it fails with a serialization failure or a deadlock.
+//
+// fn must be safe to run more than once. When db is an existing bun.Tx
+// fn runs once, since the outer transaction owns the retry decision.
+func RunInTxWithRetry(ctx context.Context, db bun.IDB, fn func(ctx context.Context, tx bun.Tx) error, policy TxRetryPolicy) error {
+	switch db.(type) {
+	case bun.Tx, *bun.Tx:
+		return runInTx(ctx, db, policy.TxOptions, fn)
+	}
+
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	isRetryable := policy.IsRetryable
+	if isRetryable == nil {
+		isRetryable = IsRetryableTxError
+	}
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := policy.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = runInTx(context.WithValue(ctx, txAttemptKey{}, attempt), db, policy.TxOptions, fn)
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(ctx, attempt, err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay = time.Duration(float64(delay) * multiplier)
+		if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+}
+
+type txAttemptKey struct{}
+
+// TxAttempt returns the attempt number, from 1, of the RunInTxWithRetry
+// transaction running with ctx, or 0 outside of one.
+func TxAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(txAttemptKey{}).(int)
+	return attempt
+}
+
+// IsRetryableTxError reports whether err is a serialization failure,
+// a deadlock or, on MySQL, a lock wait timeout, which are safe to retry
+// by re-running the transaction.
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var stater interface{ SQLState() string }
+	if errors.As(err, &stater) {
+		switch stater.SQLState() {
+		case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, number := range []int{mysqlErrLockDeadlock, mysqlErrLockWaitTimeout} {
+		// the MySQL driver formats errors as "Error 1213 (40001): ..."
+		code := "error " + strconv.Itoa(number)
+		if strings.Contains(msg, code+":") || strings.Contains(msg, code+" (") {
+			return true
+		}
+	}
+	return strings.Contains(msg, "sqlstate "+sqlStateSerializationFailure) ||
+		strings.Contains(msg, "sqlstate "+strings.ToLower(sqlStateDeadlockDetected)) ||
+		strings.Contains(msg, "could not serialize access") ||
+		strings.Contains(msg, "deadlock detected") ||
+		strings.Contains(msg, "deadlock found when trying to get lock") ||
+		strings.Contains(msg, "lock wait timeout exceeded") ||
+		strings.Contains(msg, "database is locked")
+}
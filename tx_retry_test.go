@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type sqlStateError struct {
+	code string
+}
+
+func (e sqlStateError) Error() string {
+	return "pg error"
+}
+
+func (e sqlStateError) SQLState() string {
+	return e.code
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	assert.False(t, IsRetryableTxError(nil))
+	assert.False(t, IsRetryableTxError(errors.New("unique violation")))
+	assert.True(t, IsRetryableTxError(sqlStateError{code: "40001"}))
+	assert.True(t, IsRetryableTxError(sqlStateError{code: "40P01"}))
+	assert.False(t, IsRetryableTxError(sqlStateError{code: "23505"}))
+	assert.True(t, IsRetryableTxError(errors.New("ERROR: deadlock detected")))
+	assert.True(t, IsRetryableTxError(errors.New("ERROR: conflict (SQLSTATE 40001)")))
+	assert.False(t, IsRetryableTxError(errors.New("record 40001 not found")))
+	assert.True(t, IsRetryableTxError(errors.New("database is locked")))
+}
+
+func TestIsRetryableTxError_MySQL(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadlock", errors.New("Error 1213 (40001): Deadlock found when trying to get lock; try restarting transaction"), true},
+		{"lock wait timeout", errors.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction"), true},
+		{"without sqlstate", errors.New("Error 1213: Deadlock found when trying to get lock"), true},
+		{"wrapped", fmt.Errorf("persistence: unit of work update: %w", errors.New("Error 1205 (HY000): lock wait")), true},
+		{"deadlock message", errors.New("Deadlock found when trying to get lock; try restarting transaction"), true},
+		{"lock wait message", errors.New("Lock wait timeout exceeded; try restarting transaction"), true},
+		{"duplicate entry", errors.New("Error 1062 (23000): Duplicate entry 'a' for key 'sku'"), false},
+		{"other number", errors.New("Error 12130 (HY000): unknown"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryableTxError(tt.err))
+		})
+	}
+}
+
+func TestRunInTxWithRetry_RetriesSerializationFailures(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE").WillReturnError(sqlStateError{code: "40001"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	var retries []int
+	policy := DefaultTxRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.OnRetry = func(ctx context.Context, attempt int, err error, delay time.Duration) {
+		retries = append(retries, attempt)
+	}
+
+	calls := 0
+	err = RunInTxWithRetry(context.Background(), db, func(ctx context.Context, tx bun.Tx) error {
+		calls++
+		_, err := tx.NewRaw("UPDATE accounts SET balance = 1").Exec(ctx)
+		return err
+	}, policy)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []int{1}, retries)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunInTxWithRetry_StopsOnNonRetryableError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	expectedErr := errors.New("validation failed")
+
+	calls := 0
+	err = RunInTxWithRetry(context.Background(), db, func(ctx context.Context, tx bun.Tx) error {
+		calls++
+		return expectedErr
+	}, DefaultTxRetryPolicy())
+
+	require.ErrorIs(t, err, expectedErr)
+	assert.Equal(t, 1, calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunInTxWithRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+	}
+
+	db := bun.NewDB(sqlDB, pgdialect.New())
+	deadlock := sqlStateError{code: "40P01"}
+
+	err = RunInTxWithRetry(context.Background(), db, func(ctx context.Context, tx bun.Tx) error {
+		return deadlock
+	}, TxRetryPolicy{MaxAttempts: 2})
+
+	require.ErrorIs(t, err, deadlock)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,292 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrUnitOfWorkEntity indicates an entity that is not a non-nil struct pointer.
+var ErrUnitOfWorkEntity = errors.New("persistence: unit of work entity must be a non-nil struct pointer")
+
+type entityState uint8
+
+const (
+	entityNew entityState = iota + 1
+	entityDirty
+	entityRemoved
+)
+
+type uowEntry struct {
+	entity any
+	state  entityState
+	table  *schema.Table
+}
+
+// UnitOfWork records entity changes and flushes them in a single
+// transaction on Commit. Inserts run parents first and deletes run
+// children first, following the relations declared on the models.
+type UnitOfWork struct {
+	mu        sync.Mutex
+	db        bun.IDB
+	entries   []*uowEntry
+	index     map[any]*uowEntry
+	publisher EventPublisher
+}
+
+// NewUnitOfWork creates a unit of work bound to db, which
+// may be a *bun.DB or an existing bun.Tx.
+func NewUnitOfWork(db bun.IDB) *UnitOfWork {
+	return &UnitOfWork{
+		db:    db,
+		index: make(map[any]*uowEntry),
+	}
+}
+
+// SetEventPublisher sets the publisher that receives the domain events
+// recorded on registered entities. Events are published inside the
+// commit transaction and cleared from the entities once it commits, so
+// a failed commit can be retried with the same events.
+func (u *UnitOfWork) SetEventPublisher(publisher EventPublisher) *UnitOfWork {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.publisher = publisher
+	return u
+}
+
+// RegisterNew schedules entities for insertion.
+func (u *UnitOfWork) RegisterNew(entities ...any) error {
+	return u.register(entityNew, entities)
+}
+
+// RegisterDirty schedules entities for update by primary key.
+// Entities already registered as new stay new.
+func (u *UnitOfWork) RegisterDirty(entities ...any) error {
+	return u.register(entityDirty, entities)
+}
+
+// RegisterRemoved schedules entities for deletion by primary key.
+// Removing an entity registered as new simply forgets it.
+func (u *UnitOfWork) RegisterRemoved(entities ...any) error {
+	return u.register(entityRemoved, entities)
+}
+
+func (u *UnitOfWork) register(state entityState, entities []any) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, entity := range entities {
+		value := reflect.ValueOf(entity)
+		if !value.IsValid() || value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("%w: got %T", ErrUnitOfWorkEntity, entity)
+		}
+
+		if existing, ok := u.index[entity]; ok {
+			switch {
+			case existing.state == entityNew && state == entityDirty:
+			case existing.state == entityNew && state == entityRemoved:
+				u.forget(existing)
+			default:
+				existing.state = state
+			}
+			continue
+		}
+
+		entry := &uowEntry{
+			entity: entity,
+			state:  state,
+			table:  u.db.Dialect().Tables().Get(value.Type().Elem()),
+		}
+		u.entries = append(u.entries, entry)
+		u.index[entity] = entry
+	}
+	return nil
+}
+
+func (u *UnitOfWork) forget(entry *uowEntry) {
+	delete(u.index, entry.entity)
+	for i, e := range u.entries {
+		if e == entry {
+			u.entries = append(u.entries[:i], u.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pending returns the number of registered changes.
+func (u *UnitOfWork) Pending() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.entries)
+}
+
+// Clear discards all registered changes.
+func (u *UnitOfWork) Clear() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.entries = nil
+	u.index = make(map[any]*uowEntry)
+}
+
+// Commit flushes all registered changes in one transaction.
+// Registered changes are cleared only when the commit succeeds.
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	u.mu.Lock()
+	entries := append([]*uowEntry(nil), u.entries...)
+	publisher := u.publisher
+	u.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	order := uowTableOrder(entries)
+
+	var published []EventSource
+	err := RunInTx(ctx, u.db, func(ctx context.Context, tx bun.Tx) error {
+		for _, table := range order {
+			for _, entry := range entries {
+				if entry.table != table || entry.state != entityNew {
+					continue
+				}
+				if _, err := tx.NewInsert().Model(entry.entity).Exec(ctx); err != nil {
+					return fmt.Errorf("persistence: unit of work insert %s: %w", table.Name, err)
+				}
+			}
+		}
+
+		for _, entry := range entries {
+			if entry.state != entityDirty {
+				continue
+			}
+			if _, err := tx.NewUpdate().Model(entry.entity).WherePK().Exec(ctx); err != nil {
+				return fmt.Errorf("persistence: unit of work update %s: %w", entry.table.Name, err)
+			}
+		}
+
+		for i := len(order) - 1; i >= 0; i-- {
+			table := order[i]
+			for _, entry := range entries {
+				if entry.table != table || entry.state != entityRemoved {
+					continue
+				}
+				if _, err := tx.NewDelete().Model(entry.entity).WherePK().Exec(ctx); err != nil {
+					return fmt.Errorf("persistence: unit of work delete %s: %w", table.Name, err)
+				}
+			}
+		}
+
+		published = nil
+		if publisher == nil {
+			return nil
+		}
+		entities := make([]any, 0, len(entries))
+		for _, entry := range entries {
+			entities = append(entities, entry.entity)
+		}
+		events, sources := collectEvents(entities...)
+		if len(events) == 0 {
+			return nil
+		}
+		if err := publisher.Publish(ctx, tx, events); err != nil {
+			return fmt.Errorf("persistence: unit of work publish events: %w", err)
+		}
+		published = sources
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, source := range published {
+		source.ClearEvents()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, entry := range entries {
+		u.forget(entry)
+	}
+	return nil
+}
+
+// uowTableOrder sorts the tables of the given entries so that
+// referenced tables come before the tables referencing them.
+// Tables without a dependency keep registration order and cycles
+// fall back to registration order.
+func uowTableOrder(entries []*uowEntry) []*schema.Table {
+	var tables []*schema.Table
+	seen := make(map[*schema.Table]struct{})
+	for _, entry := range entries {
+		if _, ok := seen[entry.table]; ok {
+			continue
+		}
+		seen[entry.table] = struct{}{}
+		tables = append(tables, entry.table)
+	}
+
+	deps := make(map[*schema.Table]map[*schema.Table]struct{}, len(tables))
+	addDep := func(child, parent *schema.Table) {
+		if child == parent {
+			return
+		}
+		if _, ok := seen[child]; !ok {
+			return
+		}
+		if _, ok := seen[parent]; !ok {
+			return
+		}
+		if deps[child] == nil {
+			deps[child] = make(map[*schema.Table]struct{})
+		}
+		deps[child][parent] = struct{}{}
+	}
+
+	for _, table := range tables {
+		for _, rel := range table.Relations {
+			switch rel.Type {
+			case schema.BelongsToRelation:
+				addDep(table, rel.JoinTable)
+			case schema.HasOneRelation, schema.HasManyRelation:
+				addDep(rel.JoinTable, table)
+			}
+		}
+	}
+
+	ordered := make([]*schema.Table, 0, len(tables))
+	placed := make(map[*schema.Table]struct{}, len(tables))
+	for len(ordered) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if _, ok := placed[table]; ok {
+				continue
+			}
+			ready := true
+			for parent := range deps[table] {
+				if _, ok := placed[parent]; !ok {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, table)
+				placed[table] = struct{}{}
+				progress = true
+			}
+		}
+		if !progress {
+			for _, table := range tables {
+				if _, ok := placed[table]; !ok {
+					ordered = append(ordered, table)
+					placed[table] = struct{}{}
+				}
+			}
+		}
+	}
+	return ordered
+}
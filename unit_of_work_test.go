@@ -0,0 +1,100 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type uowAuthor struct {
+	bun.BaseModel `bun:"table:authors"`
+	ID            int64      `bun:"id,pk"`
+	Name          string     `bun:"name"`
+	Books         []*uowBook `bun:"rel:has-many,join:id=author_id"`
+}
+
+type uowBook struct {
+	bun.BaseModel `bun:"table:books"`
+	ID            int64      `bun:"id,pk"`
+	AuthorID      int64      `bun:"author_id"`
+	Author        *uowAuthor `bun:"rel:belongs-to,join:author_id=id"`
+}
+
+type uowReview struct {
+	bun.BaseModel `bun:"table:reviews"`
+	ID            int64    `bun:"id,pk"`
+	BookID        int64    `bun:"book_id"`
+	Book          *uowBook `bun:"rel:belongs-to,join:book_id=id"`
+}
+
+func TestUnitOfWork_CommitOrdersByRelations(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "authors"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "books"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "reviews"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "authors"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "reviews"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "books"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	uow := NewUnitOfWork(db)
+	require.NoError(t, uow.RegisterNew(&uowReview{ID: 1, BookID: 1}, &uowBook{ID: 1, AuthorID: 1}, &uowAuthor{ID: 1}))
+	require.NoError(t, uow.RegisterDirty(&uowAuthor{ID: 2, Name: "renamed"}))
+	require.NoError(t, uow.RegisterRemoved(&uowBook{ID: 9}, &uowReview{ID: 9}))
+	assert.Equal(t, 6, uow.Pending())
+
+	require.NoError(t, uow.Commit(context.Background()))
+	assert.Equal(t, 0, uow.Pending())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_RollsBackAndKeepsChanges(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db := bun.NewDB(sqlDB, pgdialect.New())
+
+	insertErr := errors.New("fk violation")
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "authors"`).WillReturnError(insertErr)
+	mock.ExpectRollback()
+
+	uow := NewUnitOfWork(db)
+	require.NoError(t, uow.RegisterNew(&uowAuthor{ID: 1}))
+
+	err = uow.Commit(context.Background())
+	assert.ErrorIs(t, err, insertErr)
+	assert.Equal(t, 1, uow.Pending())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_StateTransitions(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	uow := NewUnitOfWork(db)
+
+	author := &uowAuthor{ID: 1}
+	require.NoError(t, uow.RegisterNew(author))
+	require.NoError(t, uow.RegisterDirty(author))
+	assert.Equal(t, entityNew, uow.index[author].state)
+
+	require.NoError(t, uow.RegisterRemoved(author))
+	assert.Equal(t, 0, uow.Pending())
+
+	assert.ErrorIs(t, uow.RegisterNew(uowAuthor{}), ErrUnitOfWorkEntity)
+	assert.ErrorIs(t, uow.RegisterNew((*uowAuthor)(nil)), ErrUnitOfWorkEntity)
+	assert.ErrorIs(t, uow.RegisterNew(nil), ErrUnitOfWorkEntity)
+
+	uow.Clear()
+	require.NoError(t, uow.Commit(context.Background()))
+}
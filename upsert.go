@@ -0,0 +1,105 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+)
+
+// ErrUpsertUnsupported indicates the dialect has no upsert syntax.
+var ErrUpsertUnsupported = errors.New("persistence: dialect does not support upserts")
+
+// NewUpsertQuery builds an insert that updates updateColumns when a row
+// with the same conflictColumns exists. It uses ON CONFLICT DO UPDATE on
+// Postgres and SQLite and ON DUPLICATE KEY UPDATE on MySQL, where the
+// conflict target is implied by the table unique keys.
+//
+// When updateColumns is empty every non primary key column that is not a
+// conflict column is updated. The query returns all columns on dialects
+// that support INSERT ... RETURNING. When there is nothing to update the
+// conflict is resolved with a no-op update of the first conflict column
+// rather than DO NOTHING, which returns no row, so the existing row is
+// still returned.
+func NewUpsertQuery(db bun.IDB, model any, conflictColumns, updateColumns []string) (*bun.InsertQuery, error) {
+	q := db.NewInsert().Model(model)
+
+	if len(updateColumns) == 0 {
+		updateColumns = upsertDefaultColumns(db, model, conflictColumns)
+	}
+
+	switch {
+	case db.Dialect().Features().Has(feature.InsertOnConflict):
+		if len(conflictColumns) == 0 {
+			return nil, errors.New("persistence: upsert requires conflict columns")
+		}
+		if len(updateColumns) == 0 {
+			updateColumns = conflictColumns[:1]
+		}
+		q = q.On("CONFLICT (?) DO UPDATE", identList(conflictColumns))
+		for _, column := range updateColumns {
+			q = q.Set("? = EXCLUDED.?", bun.Ident(column), bun.Ident(column))
+		}
+	case db.Dialect().Features().Has(feature.InsertOnDuplicateKey):
+		if len(updateColumns) == 0 {
+			q = q.Ignore()
+			break
+		}
+		q = q.On("DUPLICATE KEY UPDATE")
+		for _, column := range updateColumns {
+			q = q.Set("? = VALUES(?)", bun.Ident(column), bun.Ident(column))
+		}
+	default:
+		return nil, ErrUpsertUnsupported
+	}
+
+	if db.Dialect().Features().Has(feature.InsertReturning) {
+		q = q.Returning("*")
+	}
+	return q, nil
+}
+
+// Upsert inserts entity or updates the existing row matching conflictColumns,
+// see NewUpsertQuery. Generated columns are scanned back into entity
+// where RETURNING is supported.
+func Upsert(ctx context.Context, db bun.IDB, entity any, conflictColumns, updateColumns []string) (sql.Result, error) {
+	q, err := NewUpsertQuery(db, entity, conflictColumns, updateColumns)
+	if err != nil {
+		return nil, err
+	}
+	return q.Exec(ctx)
+}
+
+func upsertDefaultColumns(db bun.IDB, model any, conflictColumns []string) []string {
+	typ := modelType(reflect.TypeOf(model))
+	if typ == nil {
+		return nil
+	}
+	table := db.Dialect().Tables().Get(typ)
+
+	skip := make(map[string]struct{}, len(conflictColumns))
+	for _, column := range conflictColumns {
+		skip[strings.ToLower(column)] = struct{}{}
+	}
+
+	columns := make([]string, 0, len(table.DataFields))
+	for _, field := range table.DataFields {
+		if _, ok := skip[strings.ToLower(field.Name)]; ok {
+			continue
+		}
+		columns = append(columns, field.Name)
+	}
+	return columns
+}
+
+func identList(columns []string) any {
+	idents := make([]bun.Ident, 0, len(columns))
+	for _, column := range columns {
+		idents = append(idents, bun.Ident(column))
+	}
+	return bun.In(idents)
+}
@@ -0,0 +1,93 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type upsertTag struct {
+	bun.BaseModel `bun:"table:upsert_tags"`
+	ID            int64  `bun:"id,pk,autoincrement"`
+	Name          string `bun:"name,unique"`
+}
+
+type upsertProduct struct {
+	bun.BaseModel `bun:"table:upsert_products"`
+	ID            int64  `bun:"id,pk,autoincrement"`
+	SKU           string `bun:"sku,unique"`
+	Name          string `bun:"name"`
+	Price         int64  `bun:"price"`
+}
+
+func TestNewUpsertQuery_Postgres(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+
+	q, err := NewUpsertQuery(db, &upsertProduct{SKU: "a", Name: "A", Price: 1}, []string{"sku"}, []string{"name"})
+	require.NoError(t, err)
+	assert.Contains(t, q.String(), `ON CONFLICT ("sku") DO UPDATE SET "name" = EXCLUDED."name" RETURNING *`)
+
+	q, err = NewUpsertQuery(db, &upsertProduct{}, []string{"sku"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, q.String(), `SET "name" = EXCLUDED."name", "price" = EXCLUDED."price"`)
+
+	_, err = NewUpsertQuery(db, &upsertProduct{}, nil, []string{"name"})
+	assert.Error(t, err)
+
+	q, err = NewUpsertQuery(db, &upsertTag{Name: "a"}, []string{"name"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, q.String(), `ON CONFLICT ("name") DO UPDATE SET "name" = EXCLUDED."name" RETURNING *`)
+}
+
+func TestUpsert_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*upsertProduct)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	first := &upsertProduct{SKU: "sku-1", Name: "Widget", Price: 10}
+	_, err = Upsert(ctx, db, first, []string{"sku"}, nil)
+	require.NoError(t, err)
+	assert.NotZero(t, first.ID)
+
+	second := &upsertProduct{SKU: "sku-1", Name: "Widget v2", Price: 20}
+	_, err = Upsert(ctx, db, second, []string{"sku"}, []string{"name"})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, int64(10), second.Price)
+
+	var stored []upsertProduct
+	require.NoError(t, db.NewSelect().Model(&stored).Scan(ctx))
+	require.Len(t, stored, 1)
+	assert.Equal(t, "Widget v2", stored[0].Name)
+	assert.Equal(t, int64(10), stored[0].Price)
+}
+
+func TestUpsert_ConflictWithoutUpdateColumns(t *testing.T) {
+	ctx := context.Background()
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+
+	_, err := db.NewCreateTable().Model((*upsertTag)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	first := &upsertTag{Name: "go"}
+	_, err = Upsert(ctx, db, first, []string{"name"}, nil)
+	require.NoError(t, err)
+	require.NotZero(t, first.ID)
+
+	second := &upsertTag{Name: "go"}
+	_, err = Upsert(ctx, db, second, []string{"name"}, nil)
+	require.NoError(t, err, "the conflicting row is returned")
+	assert.Equal(t, first.ID, second.ID)
+
+	count, err := db.NewSelect().Model((*upsertTag)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
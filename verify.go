@@ -0,0 +1,229 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"sort"
+
+	apierrors "github.com/goliatone/go-errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// TableChecksum is the row count and content checksum of a table.
+type TableChecksum struct {
+	Table    string `json:"table"`
+	Rows     int64  `json:"rows"`
+	Checksum string `json:"checksum"`
+}
+
+// TableVerification compares the checksums of a table on two sides. A
+// nil side means the table was not checksummed there.
+type TableVerification struct {
+	Table  string         `json:"table"`
+	Source *TableChecksum `json:"source,omitempty"`
+	Target *TableChecksum `json:"target,omitempty"`
+	Match  bool           `json:"match"`
+}
+
+// VerifyReport is the result of Verify or CompareChecksums.
+type VerifyReport struct {
+	Tables []TableVerification `json:"tables"`
+}
+
+// Diverged returns the tables whose checksums differ.
+func (r *VerifyReport) Diverged() []TableVerification {
+	var out []TableVerification
+	for _, t := range r.Tables {
+		if !t.Match {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// VerifyOption configures Checksums and Verify
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	models     []any
+	allColumns bool
+}
+
+// WithVerifyModels restricts the checksums to the tables of models. By
+// default every table known to the database dialect is checksummed.
+func WithVerifyModels(models ...any) VerifyOption {
+	return func(o *verifyOptions) {
+		o.models = append(o.models, models...)
+	}
+}
+
+// WithVerifyAllColumns hashes every column instead of the primary key
+// and updated_at, to detect changes to rows without an updated_at.
+func WithVerifyAllColumns() VerifyOption {
+	return func(o *verifyOptions) {
+		o.allColumns = true
+	}
+}
+
+// Checksums counts the rows of each table and hashes its primary key and
+// updated_at columns in primary key order, streaming the rows so large
+// tables are not loaded in memory. Tables without a primary key are
+// hashed in the order of all their columns. Take checksums before and
+// after a risky migration and compare them with CompareChecksums.
+func Checksums(ctx context.Context, db bun.IDB, opts ...VerifyOption) ([]TableChecksum, error) {
+	o := verifyOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	tables, err := verifyTables(db, o.models)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TableChecksum, 0, len(tables))
+	for _, table := range tables {
+		sum, err := tableChecksum(ctx, db, table, o.allColumns)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sum)
+	}
+	return out, nil
+}
+
+// Verify checksums the same tables on source and target, e.g. a primary
+// and its replica, and reports the tables that diverge.
+func Verify(ctx context.Context, source, target bun.IDB, opts ...VerifyOption) (*VerifyReport, error) {
+	before, err := Checksums(ctx, source, opts...)
+	if err != nil {
+		return nil, err
+	}
+	after, err := Checksums(ctx, target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return CompareChecksums(before, after), nil
+}
+
+// CompareChecksums matches two sets of checksums by table name.
+func CompareChecksums(source, target []TableChecksum) *VerifyReport {
+	byTable := map[string]*TableVerification{}
+	for i := range source {
+		byTable[source[i].Table] = &TableVerification{Table: source[i].Table, Source: &source[i]}
+	}
+	for i := range target {
+		v, ok := byTable[target[i].Table]
+		if !ok {
+			v = &TableVerification{Table: target[i].Table}
+			byTable[target[i].Table] = v
+		}
+		v.Target = &target[i]
+	}
+
+	report := &VerifyReport{Tables: make([]TableVerification, 0, len(byTable))}
+	for _, v := range byTable {
+		v.Match = v.Source != nil && v.Target != nil && *v.Source == *v.Target
+		report.Tables = append(report.Tables, *v)
+	}
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].Table < report.Tables[j].Table })
+	return report
+}
+
+// VerifyReplica runs Verify between the primary and the pool labeled
+// "replica", see WithReadReplica.
+func (c Client) VerifyReplica(ctx context.Context, opts ...VerifyOption) (*VerifyReport, error) {
+	replica, ok := c.pools[ReplicaPool]
+	if !ok {
+		return nil, apierrors.New("no replica pool configured", apierrors.CategoryBadInput)
+	}
+	return Verify(ctx, c.db, replica, opts...)
+}
+
+func verifyTables(db bun.IDB, models []any) ([]*schema.Table, error) {
+	var tables []*schema.Table
+	if len(models) == 0 {
+		for _, table := range db.Dialect().Tables().All() {
+			if table.Type.PkgPath() != "github.com/uptrace/bun/migrate" {
+				tables = append(tables, table)
+			}
+		}
+	}
+	for _, model := range models {
+		typ := modelType(reflect.TypeOf(model))
+		if typ == nil {
+			return nil, apierrors.New("verify model must be a struct", apierrors.CategoryBadInput).
+				WithMetadata(map[string]any{"model": reflect.TypeOf(model).String()})
+		}
+		tables = append(tables, db.Dialect().Tables().Get(typ))
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
+
+func tableChecksum(ctx context.Context, db bun.IDB, table *schema.Table, allColumns bool) (TableChecksum, error) {
+	var columns, order []*schema.Field
+	switch {
+	case allColumns || len(table.PKs) == 0:
+		columns = table.Fields
+	default:
+		columns = append(columns, table.PKs...)
+		if table.HasField("updated_at") {
+			columns = append(columns, table.FieldMap["updated_at"])
+		}
+	}
+	order = table.PKs
+	if len(order) == 0 {
+		order = table.Fields
+	}
+
+	q := db.NewSelect().TableExpr("?", table.SQLName)
+	for _, field := range columns {
+		q = q.ColumnExpr("?", field.SQLName)
+	}
+	for _, field := range order {
+		q = q.OrderExpr("? ASC", field.SQLName)
+	}
+
+	rows, err := q.Rows(ctx)
+	if err != nil {
+		return TableChecksum{}, EnrichError(err, OperationInfo{Operation: "verify", Table: table.Name})
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var count int64
+	var size [8]byte
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return TableChecksum{}, EnrichError(err, OperationInfo{Operation: "verify", Table: table.Name})
+		}
+		for _, v := range values {
+			// length prefix each value, with a marker for NULL
+			if v == nil {
+				hash.Write([]byte{0})
+				continue
+			}
+			hash.Write([]byte{1})
+			binary.BigEndian.PutUint64(size[:], uint64(len(v)))
+			hash.Write(size[:])
+			hash.Write(v)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return TableChecksum{}, EnrichError(err, OperationInfo{Operation: "verify", Table: table.Name})
+	}
+	return TableChecksum{Table: table.Name, Rows: count, Checksum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
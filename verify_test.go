@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type verifyOrder struct {
+	bun.BaseModel `bun:"table:verify_orders"`
+
+	ID        int64     `bun:"id,pk"`
+	Status    string    `bun:"status"`
+	UpdatedAt time.Time `bun:"updated_at"`
+}
+
+func newVerifyTestDB(t *testing.T, name string) *bun.DB {
+	t.Helper()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), name))
+	require.NoError(t, err)
+	db := bun.NewDB(sqlDB, sqlitedialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := context.Background()
+	_, err = db.NewCreateTable().Model((*verifyOrder)(nil)).Exec(ctx)
+	require.NoError(t, err)
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	orders := []verifyOrder{{ID: 2, Status: "paid", UpdatedAt: at}, {ID: 1, Status: "new", UpdatedAt: at}}
+	_, err = db.NewInsert().Model(&orders).Exec(ctx)
+	require.NoError(t, err)
+	return db
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	primary := newVerifyTestDB(t, "primary.db")
+	replica := newVerifyTestDB(t, "replica.db")
+
+	report, err := Verify(ctx, primary, replica, WithVerifyModels((*verifyOrder)(nil)))
+	require.NoError(t, err)
+	require.Len(t, report.Tables, 1)
+	assert.True(t, report.Tables[0].Match)
+	assert.EqualValues(t, 2, report.Tables[0].Source.Rows)
+	assert.Empty(t, report.Diverged())
+
+	// a status change without touching updated_at is only seen by all
+	// column checksums
+	_, err = replica.NewUpdate().Model((*verifyOrder)(nil)).Set("status = 'void'").Where("id = 1").Exec(ctx)
+	require.NoError(t, err)
+	report, err = Verify(ctx, primary, replica, WithVerifyModels((*verifyOrder)(nil)))
+	require.NoError(t, err)
+	assert.Empty(t, report.Diverged())
+	report, err = Verify(ctx, primary, replica, WithVerifyModels((*verifyOrder)(nil)), WithVerifyAllColumns())
+	require.NoError(t, err)
+	assert.Len(t, report.Diverged(), 1)
+
+	_, err = replica.NewUpdate().Model((*verifyOrder)(nil)).Set("updated_at = ?", time.Now()).Where("id = 1").Exec(ctx)
+	require.NoError(t, err)
+	report, err = Verify(ctx, primary, replica, WithVerifyModels((*verifyOrder)(nil)))
+	require.NoError(t, err)
+	diverged := report.Diverged()
+	require.Len(t, diverged, 1)
+	assert.Equal(t, "verify_orders", diverged[0].Table)
+	assert.Equal(t, diverged[0].Source.Rows, diverged[0].Target.Rows)
+}
+
+func TestCompareChecksums(t *testing.T) {
+	before := []TableChecksum{{Table: "a", Rows: 1, Checksum: "x"}, {Table: "b", Rows: 2, Checksum: "y"}}
+	after := []TableChecksum{{Table: "a", Rows: 1, Checksum: "x"}, {Table: "c", Rows: 0, Checksum: "z"}}
+
+	report := CompareChecksums(before, after)
+	require.Len(t, report.Tables, 3)
+	assert.True(t, report.Tables[0].Match)
+	assert.Nil(t, report.Tables[1].Target, "b was dropped")
+	assert.Nil(t, report.Tables[2].Source, "c was created")
+	assert.Len(t, report.Diverged(), 2)
+}
@@ -1,7 +1,13 @@
 package persistence
 
-import "fmt"
-import "strings"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
 
 const (
 	VirtualDialectPostgres = "postgres"
@@ -11,7 +17,13 @@ const (
 // VirtualFieldExpr returns a SQL snippet for the given dialect to access a JSON/JSONB field.
 // When asJSON is false, text extraction is used (suitable for comparisons/order-by).
 // When asJSON is true, the raw JSON value is returned.
+// sourceField is interpolated as is, use VirtualFieldExprChecked for
+// names that do not come from code.
+//
+// Deprecated: use NewVirtualField, which quotes the column, binds the
+// keys as arguments and supports nested paths.
 func VirtualFieldExpr(dialect, sourceField, key string, asJSON bool) string {
+	key = strings.ReplaceAll(key, "'", "''")
 	switch strings.ToLower(dialect) {
 	case VirtualDialectSQLite:
 		// json_extract(metadata, '$.key')
@@ -27,3 +39,115 @@ func VirtualFieldExpr(dialect, sourceField, key string, asJSON bool) string {
 		return fmt.Sprintf("%s->>'%s'", sourceField, key)
 	}
 }
+
+// VirtualFieldExprChecked is VirtualFieldExpr after validating
+// sourceField with ValidateIdentifier and key with ValidateJSONKey.
+func VirtualFieldExprChecked(dialect, sourceField, key string, asJSON bool) (string, error) {
+	if err := ValidateIdentifier(sourceField); err != nil {
+		return "", err
+	}
+	if err := ValidateJSONKey(key); err != nil {
+		return "", err
+	}
+	return VirtualFieldExpr(dialect, sourceField, key, asJSON), nil
+}
+
+// VirtualField is a bun.QueryAppender reading a key or nested path of a
+// JSON column. The column is quoted as an identifier and the keys are
+// appended as escaped literals, so both are safe to take from input once
+// validated. Use it as a query argument:
+//
+//	q.Where("? = ?", persistence.NewVirtualField("metadata", "billing.plan"), "pro")
+type VirtualField struct {
+	Source string
+	Path   []string
+	AsJSON bool
+}
+
+// NewVirtualField reads key from the JSON column source as text. Nested
+// keys are written as a dotted path "a.b.c" or in Postgres array form
+// "{a,b,c}".
+func NewVirtualField(source, key string) VirtualField {
+	return VirtualField{Source: source, Path: parseVirtualPath(key)}
+}
+
+// JSON returns a copy of f reading the raw JSON value instead of text.
+func (f VirtualField) JSON() VirtualField {
+	f.AsJSON = true
+	return f
+}
+
+func parseVirtualPath(key string) []string {
+	if strings.HasPrefix(key, "{") && strings.HasSuffix(key, "}") {
+		return strings.Split(key[1:len(key)-1], ",")
+	}
+	return strings.Split(key, ".")
+}
+
+// Validate checks the column with ValidateIdentifier and every key with
+// ValidateJSONKey.
+func (f VirtualField) Validate() error {
+	if err := ValidateIdentifier(f.Source); err != nil {
+		return err
+	}
+	if len(f.Path) == 0 {
+		return unsafeIdentifier("", "JSON path is empty")
+	}
+	for _, key := range f.Path {
+		if err := ValidateJSONKey(key); err != nil || strings.Contains(key, ".") {
+			return unsafeIdentifier(key, "JSON key contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// AppendQuery implements bun.QueryAppender. Invalid names are not
+// appended, bun renders the error in their place so the query fails;
+// call Validate first to report them before querying.
+func (f VirtualField) AppendQuery(gen schema.QueryGen, b []byte) ([]byte, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	source := bun.Ident(f.Source)
+	switch gen.Dialect().Name() {
+	case dialect.SQLite:
+		return gen.AppendQuery(b, "json_extract(?, ?)", source, f.jsonPath()), nil
+	case dialect.MySQL:
+		if f.AsJSON {
+			return gen.AppendQuery(b, "JSON_EXTRACT(?, ?)", source, f.jsonPath()), nil
+		}
+		return gen.AppendQuery(b, "JSON_UNQUOTE(JSON_EXTRACT(?, ?))", source, f.jsonPath()), nil
+	default:
+		op := "->>"
+		if f.AsJSON {
+			op = "->"
+		}
+		if len(f.Path) == 1 {
+			return gen.AppendQuery(b, "?"+op+"?", source, f.Path[0]), nil
+		}
+		// metadata #>> ARRAY['a','b']
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(f.Path)), ",")
+		args := make([]any, 0, len(f.Path)+1)
+		args = append(args, source)
+		for _, key := range f.Path {
+			args = append(args, key)
+		}
+		return gen.AppendQuery(b, "? #"+op[1:]+" ARRAY["+placeholders+"]", args...), nil
+	}
+}
+
+// jsonPath returns the SQLite and MySQL path of f, e.g. $.a."b-c".
+func (f VirtualField) jsonPath() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range f.Path {
+		b.WriteString(".")
+		if identifierPartRE.MatchString(key) {
+			b.WriteString(key)
+		} else {
+			b.WriteString(`"` + key + `"`)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+)
+
+func renderVirtualField(t *testing.T, db *bun.DB, expr VirtualField) string {
+	t.Helper()
+	return db.NewSelect().ColumnExpr("?", expr).String()
+}
+
+func TestVirtualFieldPostgres(t *testing.T) {
+	db := bun.NewDB(new(sql.DB), pgdialect.New())
+
+	assert.Equal(t, `SELECT "metadata"->>'plan'`, renderVirtualField(t, db, NewVirtualField("metadata", "plan")))
+	assert.Equal(t, `SELECT "metadata"->'plan'`, renderVirtualField(t, db, NewVirtualField("metadata", "plan").JSON()))
+	assert.Equal(t, `SELECT "u"."metadata" #>> ARRAY['billing','plan']`, renderVirtualField(t, db, NewVirtualField("u.metadata", "billing.plan")))
+	assert.Equal(t, `SELECT "metadata" #> ARRAY['billing','plan']`, renderVirtualField(t, db, NewVirtualField("metadata", "{billing,plan}").JSON()))
+}
+
+func TestVirtualFieldSQLite(t *testing.T) {
+	db := bun.NewDB(new(sql.DB), sqlitedialect.New())
+
+	assert.Equal(t, `SELECT json_extract("metadata", '$.plan')`, renderVirtualField(t, db, NewVirtualField("metadata", "plan")))
+	assert.Equal(t, `SELECT json_extract("metadata", '$.billing."plan-id"')`, renderVirtualField(t, db, NewVirtualField("metadata", "billing.plan-id")))
+}
+
+func TestVirtualFieldRejectsUnsafeInput(t *testing.T) {
+	db := bun.NewDB(new(sql.DB), pgdialect.New())
+
+	for _, expr := range []VirtualField{
+		NewVirtualField("metadata", "plan'; DROP TABLE users"),
+		NewVirtualField("metadata; --", "plan"),
+		NewVirtualField("metadata", "billing..plan"),
+		NewVirtualField("metadata", "{billing,pl an}"),
+	} {
+		err := expr.Validate()
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrUnsafeIdentifier))
+
+		_, err = expr.AppendQuery(db.QueryGen(), nil)
+		assert.Error(t, err)
+		assert.NotContains(t, renderVirtualField(t, db, expr), "DROP")
+	}
+}
+
+func TestVirtualFieldQueriesNestedJSON(t *testing.T) {
+	db, cleanup := newSQLiteTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE accounts (id INTEGER PRIMARY KEY, metadata TEXT)`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO accounts (id, metadata) VALUES (1, '{"billing":{"plan":"pro"}}'), (2, '{"billing":{"plan":"free"}}')`)
+	require.NoError(t, err)
+
+	var ids []int64
+	err = db.NewSelect().
+		Table("accounts").
+		Column("id").
+		Where("? = ?", NewVirtualField("metadata", "billing.plan"), "pro").
+		Scan(ctx, &ids)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+}
@@ -0,0 +1,93 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	apierrors "github.com/goliatone/go-errors"
+)
+
+// WarmupOptions configures Client.Warmup.
+type WarmupOptions struct {
+	// Connections is how many pool connections to open. They are
+	// returned to the pool idle, so keep it within SetMaxIdleConns.
+	Connections int
+	// PrepareStatements prepares the named queries of the statement
+	// cache, see WithStatementCache.
+	PrepareStatements bool
+	// Queries are cheap statements run once each, e.g. SELECT 1 or a
+	// lookup that loads hot pages into the database cache.
+	Queries []string
+}
+
+// WarmupReport describes what Client.Warmup did.
+type WarmupReport struct {
+	Connections int
+	Statements  int
+	Queries     int
+	Duration    time.Duration
+}
+
+// Warmup prepares the client for traffic after a deploy by opening pool
+// connections, preparing statements and running priming queries, so the
+// first requests do not pay for them.
+func (c *Client) Warmup(ctx context.Context, opts WarmupOptions) (WarmupReport, error) {
+	start := time.Now()
+	var report WarmupReport
+
+	conns, err := c.warmConnections(ctx, opts.Connections)
+	report.Connections = len(conns)
+	// hold every connection until all are open so each is a new one,
+	// then return them to the pool idle
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+
+	if err == nil && opts.PrepareStatements && c.statements != nil {
+		report.Statements, err = c.statements.Prime(ctx)
+	}
+	if err == nil {
+		for _, query := range opts.Queries {
+			if _, err = c.db.ExecContext(ctx, query); err != nil {
+				break
+			}
+			report.Queries++
+		}
+	}
+	report.Duration = time.Since(start)
+	if err != nil {
+		return report, apierrors.Wrap(err, apierrors.CategoryOperation, "failed to warm up database client").
+			WithMetadata(map[string]any{
+				"connections": report.Connections,
+				"statements":  report.Statements,
+				"queries":     report.Queries,
+			})
+	}
+	c.lgr.Debug("database client warmed up",
+		"connections", report.Connections,
+		"statements", report.Statements,
+		"queries", report.Queries,
+		"duration", report.Duration,
+	)
+	return report, nil
+}
+
+func (c *Client) warmConnections(ctx context.Context, n int) ([]*sql.Conn, error) {
+	conns := make([]*sql.Conn, 0, max(n, 0))
+	for range n {
+		conn, err := c.sqlDB.Conn(ctx)
+		if err == nil {
+			err = conn.PingContext(ctx)
+			if err != nil {
+				err = errors.Join(err, conn.Close())
+			}
+		}
+		if err != nil {
+			return conns, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
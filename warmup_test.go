@@ -0,0 +1,46 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestClientWarmup(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := sql.Open(sqliteshim.ShimName, "file:"+filepath.Join(t.TempDir(), "warmup.db"))
+	require.NoError(t, err)
+	sqlDB.SetMaxIdleConns(4)
+
+	client, err := New(staticConfig{pingTimeout: time.Second}, sqlDB, sqlitedialect.New(), WithLazyConnect(), WithStatementCache(2))
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = sqlDB.ExecContext(ctx, "CREATE TABLE warm_items (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	client.Statements().
+		Register("count", "SELECT COUNT(*) FROM warm_items").
+		Register("first", "SELECT id FROM warm_items LIMIT 1").
+		Register("last", "SELECT id FROM warm_items ORDER BY id DESC LIMIT 1")
+
+	report, err := client.Warmup(ctx, WarmupOptions{
+		Connections:       3,
+		PrepareStatements: true,
+		Queries:           []string{"SELECT 1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Connections)
+	assert.Equal(t, 2, report.Statements, "priming stops at the cache capacity")
+	assert.Equal(t, 1, report.Queries)
+	assert.Equal(t, 3, sqlDB.Stats().OpenConnections)
+
+	_, err = client.Warmup(ctx, WarmupOptions{Queries: []string{"SELECT * FROM missing_table"}})
+	require.Error(t, err)
+}